@@ -28,6 +28,9 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 )
 
+// structs being iterated, to stop on recursive types (their fields are documented once, at the outer level)
+var iterating = map[reflect.Type]bool{}
+
 func iterate(output io.Writer, data interface{}, indent int) {
 	newIndent := indent + 1
 	d := reflect.ValueOf(data)
@@ -45,6 +48,11 @@ func iterate(output io.Writer, data interface{}, indent int) {
 		return
 	case reflect.Struct:
 		// DEBUG code: fmt.Fprintf(output,"%s %s <-- %s \n",strings.Repeat(" ",4*indent),dataTypeName,dataType )
+		if iterating[d.Type()] {
+			return
+		}
+		iterating[d.Type()] = true
+		defer delete(iterating, d.Type())
 		for i := 0; i < d.NumField(); i++ {
 			val := reflect.Indirect(reflect.ValueOf(data))
 			fieldName := val.Type().Field(i).Tag.Get(api.TagYaml)
@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	alertsOutput   string
+	alertsRuleName string
+)
+
+// generateAlertsCmd writes Prometheus alerting rules for the prom encode metrics having an alertThreshold
+var generateAlertsCmd = &cobra.Command{
+	Use:   "generate-alerts",
+	Short: "Generate a PrometheusRule from the metrics of the pipeline configuration that have an alertThreshold",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if cfgFile == "" {
+			return errors.New("a pipeline configuration file must be set with --config")
+		}
+		return generateAlerts(cfgFile, alertsRuleName, alertsOutput)
+	},
+}
+
+func initGenerateAlertsFlags() {
+	generateAlertsCmd.Flags().StringVar(&alertsOutput, "output", "", "output file (default: standard output)")
+	generateAlertsCmd.Flags().StringVar(&alertsRuleName, "name", "flowlogs-pipeline-alerts", "name of the generated PrometheusRule")
+	rootCmd.AddCommand(generateAlertsCmd)
+}
+
+func generateAlerts(cfgPath, name, output string) error {
+	params, err := config.ReadStageParams(cfgPath)
+	if err != nil {
+		return err
+	}
+	rule, err := encode.GenerateAlerts(name, params)
+	if err != nil {
+		return err
+	}
+	if len(rule.Spec.Groups) == 0 {
+		fmt.Fprintln(os.Stderr, "no metric has an alertThreshold: the PrometheusRule is empty")
+	}
+	out, err := yaml.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	return os.WriteFile(output, out, 0644)
+}
@@ -18,6 +18,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -45,9 +46,12 @@ var (
 	buildVersion       = "unknown"
 	buildDate          = "unknown"
 	cfgFile            string
+	configMapRef       string
+	configMapSource    *pipeline.ConfigMapSource
 	logLevel           string
 	envPrefix          = "FLOWLOGS-PIPELINE"
 	defaultLogFileName = ".flowlogs-pipeline"
+	adminTokenEnvVar   = "FLP_ADMIN_TOKEN"
 	opts               config.Options
 )
 
@@ -64,7 +68,11 @@ var rootCmd = &cobra.Command{
 func initConfig() {
 	v := viper.New()
 
-	if cfgFile != "" {
+	var cfgErr error
+	if configMapRef != "" {
+		// Use the config file held by the ConfigMap
+		cfgErr = readConfigMap(v)
+	} else if cfgFile != "" {
 		// Use config file from the flag.
 		v.SetConfigFile(cfgFile)
 	} else {
@@ -83,7 +91,9 @@ func initConfig() {
 	v.AutomaticEnv()
 
 	// If a config file is found, read it in.
-	cfgErr := v.ReadInConfig()
+	if configMapRef == "" {
+		cfgErr = v.ReadInConfig()
+	}
 
 	bindFlags(rootCmd, v)
 
@@ -104,6 +114,21 @@ func initLogger() {
 	log.SetFormatter(&log.TextFormatter{DisableColors: false, FullTimestamp: true, PadLevelText: true, DisableQuote: true})
 }
 
+// readConfigMap reads the config file from the ConfigMap, which is then watched for hot reloads
+func readConfigMap(v *viper.Viper) error {
+	source, err := pipeline.NewConfigMapSource(configMapRef)
+	if err != nil {
+		return err
+	}
+	content, err := source.Read(context.Background())
+	if err != nil {
+		return err
+	}
+	configMapSource = source
+	v.SetConfigType("yaml")
+	return v.ReadConfig(bytes.NewReader(content))
+}
+
 func dumpConfig(opts *config.Options) {
 	configAsJSON, err := json.MarshalIndent(opts, "", "    ")
 	if err != nil {
@@ -141,14 +166,19 @@ func bindFlags(cmd *cobra.Command, v *viper.Viper) {
 func initFlags() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", fmt.Sprintf("config file (default is $HOME/%s)", defaultLogFileName))
+	rootCmd.PersistentFlags().StringVar(&configMapRef, "config-from-configmap", "", "config file held by a ConfigMap, as <namespace>/<name> or <namespace>/<name>/<key>, and reloaded when it changes; takes precedence over --config")
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "error", "Log level: debug, info, warning, error")
 	rootCmd.PersistentFlags().StringVar(&opts.Health.Address, "health.address", "0.0.0.0", "Health server address")
 	rootCmd.PersistentFlags().StringVar(&opts.Health.Port, "health.port", "8080", "Health server port")
+	rootCmd.PersistentFlags().StringVar(&opts.Admin.Address, "admin.address", "0.0.0.0", "Admin API address")
+	rootCmd.PersistentFlags().StringVar(&opts.Admin.Port, "admin.port", "8080", fmt.Sprintf("Admin API port, shared with the health server when equal (0 to disable); the bearer token is read from $%s", adminTokenEnvVar))
 	rootCmd.PersistentFlags().IntVar(&opts.Profile.Port, "profile.port", 0, "Go pprof tool port (default: disabled)")
 	rootCmd.PersistentFlags().StringVar(&opts.PipeLine, "pipeline", "", "json of config file pipeline field")
 	rootCmd.PersistentFlags().StringVar(&opts.Parameters, "parameters", "", "json of config file parameters field")
 	rootCmd.PersistentFlags().StringVar(&opts.DynamicParameters, "dynamicParameters", "", "json of configmap location for dynamic parameters")
 	rootCmd.PersistentFlags().StringVar(&opts.MetricsSettings, "metricsSettings", "", "json for global metrics settings")
+	rootCmd.PersistentFlags().StringVar(&opts.Telemetry, "telemetry", "", "json for pipeline telemetry settings")
+	initGenerateAlertsFlags()
 }
 
 func main() {
@@ -198,8 +228,36 @@ func run() {
 		}()
 	}
 
+	// Serve the pipeline stage metrics on their own endpoint
+	var telemetryServer *prometheus.PromServer
+	if mainPipeline.Telemetry != nil {
+		telemetryServer = prometheus.StartServerAsync(&cfg.Telemetry.PromConnectionInfo, "telemetry", mainPipeline.Telemetry.Registry)
+	}
+
+	// Reload the pipeline configuration on SIGHUP, or when its ConfigMap changes; the admin API reloads it from the same source
+	var reload func(context.Context) error
+	if configMapSource != nil {
+		mainPipeline.WatchConfigMap(configMapSource)
+		reload = func(ctx context.Context) error { return mainPipeline.ReloadFromConfigMap(ctx, configMapSource) }
+	} else if cfgFile != "" {
+		mainPipeline.WatchReloadSignal(cfgFile)
+		reload = func(context.Context) error { return mainPipeline.ReloadFromFile(cfgFile) }
+	}
+
+	// Serve the admin API, on the health server when they share the same address
+	var adminAPI http.Handler
+	var adminServer *http.Server
+	if opts.Admin.Port != "0" {
+		opts.Admin.Token = os.Getenv(adminTokenEnvVar)
+		adminAPI = mainPipeline.AdminHandler(reload, opts.Admin.Token)
+		if opts.Admin.Address != opts.Health.Address || opts.Admin.Port != opts.Health.Port {
+			adminServer = operational.NewAdminServer(&opts, adminAPI)
+			adminAPI = nil
+		}
+	}
+
 	// Start health report server
-	healthServer := operational.NewHealthServer(&opts, mainPipeline.IsAlive, mainPipeline.IsReady)
+	healthServer := operational.NewHealthServer(&opts, mainPipeline.Health, pipeline.AdminAPIPrefix, adminAPI)
 
 	// Starts the flows pipeline
 	mainPipeline.Run()
@@ -207,6 +265,12 @@ func run() {
 	if promServer != nil {
 		_ = promServer.Shutdown(context.Background())
 	}
+	if telemetryServer != nil {
+		_ = telemetryServer.Shutdown(context.Background())
+	}
+	if adminServer != nil {
+		_ = adminServer.Shutdown(context.Background())
+	}
 	_ = healthServer.Shutdown(context.Background())
 
 	// Give all threads a chance to exit and then exit the process
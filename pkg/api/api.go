@@ -23,6 +23,7 @@ const (
 	FileChunksType  = "file_chunks"
 	SyntheticType   = "synthetic"
 	CollectorType   = "collector"
+	SFlowType       = "sflow"
 	StdinType       = "stdin"
 	GRPCType        = "grpc"
 	FakeType        = "fake"
@@ -34,12 +35,19 @@ const (
 	StdoutType      = "stdout"
 	LokiType        = "loki"
 	IpfixType       = "ipfix"
+	ClickHouseType  = "clickhouse"
+	InfluxDBType    = "influxdb"
+	PcapType        = "pcap"
+	CSVType         = "csv"
 	AggregateType   = "aggregates"
 	TimebasedType   = "timebased"
 	PromType        = "prom"
 	GenericType     = "generic"
 	NetworkType     = "network"
 	FilterType      = "filter"
+	DedupeType      = "dedupe"
+	BiflowType      = "biflow"
+	ExplodeType     = "explode"
 	ConnTrackType   = "conntrack"
 	NoneType        = "none"
 
@@ -53,15 +61,25 @@ type API struct {
 	PromEncode         PromEncode        `yaml:"prom" doc:"## Prometheus encode API\nFollowing is the supported API format for prometheus encode:\n"`
 	KafkaEncode        EncodeKafka       `yaml:"kafka" doc:"## Kafka encode API\nFollowing is the supported API format for kafka encode:\n"`
 	S3Encode           EncodeS3          `yaml:"s3" doc:"## S3 encode API\nFollowing is the supported API format for S3 encode:\n"`
+	CSVEncode          EncodeCSV         `yaml:"csv" doc:"## CSV encode API\nFollowing is the supported API format for CSV encode:\n"`
 	IngestCollector    IngestCollector   `yaml:"collector" doc:"## Ingest collector API\nFollowing is the supported API format for the NetFlow / IPFIX collector:\n"`
+	IngestSFlow        IngestSFlow       `yaml:"sflow" doc:"## Ingest sFlow API\nFollowing is the supported API format for the sFlow collector:\n"`
 	IngestKafka        IngestKafka       `yaml:"kafka" doc:"## Ingest Kafka API\nFollowing is the supported API format for the kafka ingest:\n"`
 	IngestGRPCProto    IngestGRPCProto   `yaml:"grpc" doc:"## Ingest GRPC from Network Observability eBPF Agent\nFollowing is the supported API format for the Network Observability eBPF ingest:\n"`
 	IngestStdin        IngestStdin       `yaml:"stdin" doc:"## Ingest Standard Input\nFollowing is the supported API format for the standard input ingest:\n"`
 	TransformGeneric   TransformGeneric  `yaml:"generic" doc:"## Transform Generic API\nFollowing is the supported API format for generic transformations:\n"`
 	TransformFilter    TransformFilter   `yaml:"filter" doc:"## Transform Filter API\nFollowing is the supported API format for filter transformations:\n"`
 	TransformNetwork   TransformNetwork  `yaml:"network" doc:"## Transform Network API\nFollowing is the supported API format for network transformations:\n"`
+	TransformDedupe    TransformDedupe   `yaml:"dedupe" doc:"## Transform Dedupe API\nFollowing is the supported API format for flows deduplication:\n"`
+	TransformBiflow    TransformBiflow   `yaml:"biflow" doc:"## Transform Biflow API\nFollowing is the supported API format for stitching unidirectional flows into bidirectional ones:\n"`
+	TransformExplode   TransformExplode  `yaml:"explode" doc:"## Transform Explode API\nFollowing is the supported API format for splitting a flow into several records:\n"`
 	WriteLoki          WriteLoki         `yaml:"loki" doc:"## Write Loki API\nFollowing is the supported API format for writing to loki:\n"`
 	WriteStdout        WriteStdout       `yaml:"stdout" doc:"## Write Standard Output\nFollowing is the supported API format for writing to standard output:\n"`
+	WriteClickHouse    WriteClickHouse   `yaml:"clickhouse" doc:"## Write ClickHouse API\nFollowing is the supported API format for writing to ClickHouse:\n"`
+	WriteInfluxDB      WriteInfluxDB     `yaml:"influxdb" doc:"## Write InfluxDB API\nFollowing is the supported API format for writing to InfluxDB 2.x:\n"`
+	WritePcap          WritePcap         `yaml:"pcap" doc:"## Write PCAP API\nFollowing is the supported API format for writing flows as synthetic packets to PCAP files:\n"`
+	WriteS3            WriteS3           `yaml:"s3" doc:"## Write S3 API\nFollowing is the supported API format for archiving flows into an S3 bucket:\n"`
+	WriteDLQ           DeadLetterQueue   `yaml:"deadLetterQueue" doc:"## Write Dead-Letter Queue\nFollowing is the supported API format for the dead-letter queue of write stages:\n"`
 	ExtractAggregate   Aggregates        `yaml:"aggregates" doc:"## Aggregate metrics API\nFollowing is the supported API format for specifying metrics aggregations:\n"`
 	ConnectionTracking ConnTrack         `yaml:"conntrack" doc:"## Connection tracking API\nFollowing is the supported API format for specifying connection tracking:\n"`
 	ExtractTimebased   ExtractTimebased  `yaml:"timebased" doc:"## Time-based Filters API\nFollowing is the supported API format for specifying metrics time-based filters:\n"`
@@ -19,6 +19,7 @@ package api
 
 import (
 	"fmt"
+	"slices"
 )
 
 const (
@@ -28,12 +29,13 @@ const (
 )
 
 type ConnTrack struct {
-	KeyDefinition         KeyDefinition                   `yaml:"keyDefinition,omitempty" json:"keyDefinition,omitempty" doc:"fields that are used to identify the connection"`
-	OutputRecordTypes     []ConnTrackOutputRecordTypeEnum `yaml:"outputRecordTypes,omitempty" json:"outputRecordTypes,omitempty" doc:"(enum) output record types to emit"`
-	OutputFields          []OutputField                   `yaml:"outputFields,omitempty" json:"outputFields,omitempty" doc:"list of output fields"`
-	Scheduling            []ConnTrackSchedulingGroup      `yaml:"scheduling,omitempty" json:"scheduling,omitempty" doc:"list of timeouts and intervals to apply per selector"`
-	MaxConnectionsTracked int                             `yaml:"maxConnectionsTracked,omitempty" json:"maxConnectionsTracked,omitempty" doc:"maximum number of connections we keep in our cache (0 means no limit)"`
-	TCPFlags              ConnTrackTCPFlags               `yaml:"tcpFlags,omitempty" json:"tcpFlags,omitempty" doc:"settings for handling TCP flags"`
+	KeyDefinition         KeyDefinition                     `yaml:"keyDefinition,omitempty" json:"keyDefinition,omitempty" doc:"fields that are used to identify the connection"`
+	OutputRecordTypes     []ConnTrackOutputRecordTypeEnum   `yaml:"outputRecordTypes,omitempty" json:"outputRecordTypes,omitempty" doc:"(enum) output record types to emit"`
+	OutputFields          []OutputField                     `yaml:"outputFields,omitempty" json:"outputFields,omitempty" doc:"list of output fields"`
+	Scheduling            []ConnTrackSchedulingGroup        `yaml:"scheduling,omitempty" json:"scheduling,omitempty" doc:"list of timeouts and intervals to apply per selector"`
+	MaxConnectionsTracked int                               `yaml:"maxConnectionsTracked,omitempty" json:"maxConnectionsTracked,omitempty" doc:"maximum number of connections we keep in our cache (0 means no limit)"`
+	MaxConnectionsPolicy  ConnTrackMaxConnectionsPolicyEnum `yaml:"maxConnectionsPolicy,omitempty" json:"maxConnectionsPolicy,omitempty" doc:"(enum) what to do with a new connection when maxConnectionsTracked is reached; one of the following:"`
+	TCPFlags              ConnTrackTCPFlags                 `yaml:"tcpFlags,omitempty" json:"tcpFlags,omitempty" doc:"settings for handling TCP flags"`
 }
 
 type ConnTrackOutputRecordTypeEnum string
@@ -46,6 +48,15 @@ const (
 	ConnTrackFlowLog       ConnTrackOutputRecordTypeEnum = "flowLog"       // Flow log
 )
 
+type ConnTrackMaxConnectionsPolicyEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	ConnTrackDropNew      ConnTrackMaxConnectionsPolicyEnum = "dropNew"      // ignore the flow logs of new connections (default)
+	ConnTrackEvictOldest  ConnTrackMaxConnectionsPolicyEnum = "evictOldest"  // evict the connection the closest to expire, without reporting it
+	ConnTrackEmitAndEvict ConnTrackMaxConnectionsPolicyEnum = "emitAndEvict" // evict the connection the closest to expire and emit its endConnection record
+)
+
 type KeyDefinition struct {
 	FieldGroups []FieldGroup  `yaml:"fieldGroups,omitempty" json:"fieldGroups,omitempty" doc:"list of field group definitions"`
 	Hash        ConnTrackHash `yaml:"hash,omitempty" json:"hash,omitempty" doc:"how to build the connection hash"`
@@ -74,6 +85,7 @@ type OutputField struct {
 	SplitAB       bool                   `yaml:"splitAB,omitempty" json:"splitAB,omitempty" doc:"When true, 2 output fields will be created. One for A->B and one for B->A flows."`
 	Input         string                 `yaml:"input,omitempty" json:"input,omitempty" doc:"The input field to base the operation on. When omitted, 'name' is used"`
 	ReportMissing bool                   `yaml:"reportMissing,omitempty" json:"reportMissing,omitempty" doc:"When true, missing input will produce MissingFieldError metric and error logs"`
+	Delta         bool                   `yaml:"delta,omitempty" json:"delta,omitempty" doc:"When true, an additional '<name>_delta' field holds the value aggregated since the previous record of the connection (sum and count only)"`
 }
 
 type ConnTrackOperationEnum string
@@ -96,9 +108,11 @@ type ConnTrackSchedulingGroup struct {
 }
 
 type ConnTrackTCPFlags struct {
-	FieldName           string `yaml:"fieldName,omitempty" json:"fieldName,omitempty" doc:"name of the field containing TCP flags"`
-	DetectEndConnection bool   `yaml:"detectEndConnection,omitempty" json:"detectEndConnection,omitempty" doc:"detect end connections by FIN flag"`
-	SwapAB              bool   `yaml:"swapAB,omitempty" json:"swapAB,omitempty" doc:"swap source and destination when the first flowlog contains the SYN_ACK flag"`
+	FieldName              string `yaml:"fieldName,omitempty" json:"fieldName,omitempty" doc:"name of the field containing TCP flags"`
+	DetectEndConnection    bool   `yaml:"detectEndConnection,omitempty" json:"detectEndConnection,omitempty" doc:"detect end connections by FIN flag"`
+	EndConnectionFlags     uint32 `yaml:"endConnectionFlags,omitempty" json:"endConnectionFlags,omitempty" doc:"bit mask of the TCP flags detecting end connections: a flow log having any of them ends the connection (default: 1, the FIN flag)"`
+	ImmediateEndConnection bool   `yaml:"immediateEndConnection,omitempty" json:"immediateEndConnection,omitempty" doc:"end detected connections immediately instead of waiting for terminatingTimeout"`
+	SwapAB                 bool   `yaml:"swapAB,omitempty" json:"swapAB,omitempty" doc:"swap source and destination when the first flowlog contains the SYN_ACK flag"`
 }
 
 //nolint:cyclop
@@ -120,6 +134,10 @@ func (ct *ConnTrack) Validate() error {
 			return conntrackInvalidError{unknownOperation: true,
 				msg: fmt.Errorf("unknown operation %q in output field %q", of.Operation, of.Name)}
 		}
+		if of.Delta && of.Operation != ConnTrackSum && of.Operation != ConnTrackCount {
+			return conntrackInvalidError{deltaWithUnsupportedOperation: true,
+				msg: fmt.Errorf("output field %q has delta=true although operation %q is neither sum nor count", of.Name, of.Operation)}
+		}
 	}
 
 	outputFieldNames := map[string]struct{}{}
@@ -214,11 +232,27 @@ func (ct *ConnTrack) Validate() error {
 		return conntrackInvalidError{emptyTCPFlagsField: true,
 			msg: fmt.Errorf("TCPFlags.FieldName is empty although DetectEndConnection or SwapAB are enabled")}
 	}
+	if !ct.TCPFlags.DetectEndConnection && (ct.TCPFlags.EndConnectionFlags != 0 || ct.TCPFlags.ImmediateEndConnection) {
+		return conntrackInvalidError{endConnectionWithoutDetection: true,
+			msg: fmt.Errorf("TCPFlags.EndConnectionFlags or ImmediateEndConnection are set although DetectEndConnection is disabled")}
+	}
 	if ct.TCPFlags.SwapAB && !isBidi {
 		return conntrackInvalidError{swapABWithNoBidi: true,
 			msg: fmt.Errorf("SwapAB is enabled although bidirection is not enabled (fieldGroupARef is empty)")}
 	}
 
+	switch ct.MaxConnectionsPolicy {
+	case "", ConnTrackDropNew, ConnTrackEvictOldest:
+	case ConnTrackEmitAndEvict:
+		if !slices.Contains(ct.OutputRecordTypes, ConnTrackEndConnection) {
+			return conntrackInvalidError{invalidMaxConnectionsPolicy: true,
+				msg: fmt.Errorf("maxConnectionsPolicy %q requires the %q output record type", ct.MaxConnectionsPolicy, ConnTrackEndConnection)}
+		}
+	default:
+		return conntrackInvalidError{invalidMaxConnectionsPolicy: true,
+			msg: fmt.Errorf("unknown maxConnectionsPolicy %q", ct.MaxConnectionsPolicy)}
+	}
+
 	fieldsA, fieldsB := ct.GetABFields()
 	if len(fieldsA) != len(fieldsB) {
 		return conntrackInvalidError{mismatchABFieldsCount: true,
@@ -282,22 +316,25 @@ func isOutputRecordTypeValid(value ConnTrackOutputRecordTypeEnum) bool {
 }
 
 type conntrackInvalidError struct {
-	msg                       error
-	fieldGroupABOnlyOneIsSet  bool
-	splitABWithNoBidi         bool
-	unknownOperation          bool
-	duplicateFieldGroup       bool
-	duplicateOutputFieldNames bool
-	undefinedFieldGroupARef   bool
-	undefinedFieldGroupBRef   bool
-	undefinedFieldGroupRef    bool
-	unknownOutputRecord       bool
-	undefinedSelectorKey      bool
-	defaultGroupAndNotLast    bool
-	exactlyOneDefaultSelector bool
-	swapABWithNoBidi          bool
-	emptyTCPFlagsField        bool
-	mismatchABFieldsCount     bool
+	msg                           error
+	fieldGroupABOnlyOneIsSet      bool
+	splitABWithNoBidi             bool
+	deltaWithUnsupportedOperation bool
+	unknownOperation              bool
+	duplicateFieldGroup           bool
+	duplicateOutputFieldNames     bool
+	undefinedFieldGroupARef       bool
+	undefinedFieldGroupBRef       bool
+	undefinedFieldGroupRef        bool
+	unknownOutputRecord           bool
+	undefinedSelectorKey          bool
+	defaultGroupAndNotLast        bool
+	exactlyOneDefaultSelector     bool
+	swapABWithNoBidi              bool
+	emptyTCPFlagsField            bool
+	endConnectionWithoutDetection bool
+	invalidMaxConnectionsPolicy   bool
+	mismatchABFieldsCount         bool
 }
 
 func (err conntrackInvalidError) Error() string {
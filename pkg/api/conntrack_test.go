@@ -47,6 +47,15 @@ func TestConnTrackValidate(t *testing.T) {
 			},
 			conntrackInvalidError{splitABWithNoBidi: true},
 		},
+		{
+			"delta with unsupported operation",
+			ConnTrack{
+				OutputFields: []OutputField{
+					{Name: "TimeFlowEnd", Operation: "max", Delta: true},
+				},
+			},
+			conntrackInvalidError{deltaWithUnsupportedOperation: true},
+		},
 		{
 			"Unknown operation",
 			ConnTrack{
@@ -228,6 +237,39 @@ func TestConnTrackValidate(t *testing.T) {
 			},
 			conntrackInvalidError{emptyTCPFlagsField: true},
 		},
+		{
+			"End connection flags without detection",
+			ConnTrack{
+				Scheduling: []ConnTrackSchedulingGroup{{Selector: map[string]interface{}{}}},
+				TCPFlags:   ConnTrackTCPFlags{FieldName: "Flags", EndConnectionFlags: 0x04},
+			},
+			conntrackInvalidError{endConnectionWithoutDetection: true},
+		},
+		{
+			"Immediate end connection without detection",
+			ConnTrack{
+				Scheduling: []ConnTrackSchedulingGroup{{Selector: map[string]interface{}{}}},
+				TCPFlags:   ConnTrackTCPFlags{FieldName: "Flags", ImmediateEndConnection: true},
+			},
+			conntrackInvalidError{endConnectionWithoutDetection: true},
+		},
+		{
+			"Unknown max connections policy",
+			ConnTrack{
+				Scheduling:           []ConnTrackSchedulingGroup{{Selector: map[string]interface{}{}}},
+				MaxConnectionsPolicy: "dropOld",
+			},
+			conntrackInvalidError{invalidMaxConnectionsPolicy: true},
+		},
+		{
+			"emitAndEvict without endConnection records",
+			ConnTrack{
+				Scheduling:           []ConnTrackSchedulingGroup{{Selector: map[string]interface{}{}}},
+				OutputRecordTypes:    []ConnTrackOutputRecordTypeEnum{ConnTrackNewConnection},
+				MaxConnectionsPolicy: ConnTrackEmitAndEvict,
+			},
+			conntrackInvalidError{invalidMaxConnectionsPolicy: true},
+		},
 		{
 			"Mismatch between field count of FieldGroupARef and FieldGroupBRef",
 			ConnTrack{
@@ -1,7 +1,10 @@
 package api
 
 type Decoder struct {
-	Type DecoderEnum `yaml:"type" json:"type" doc:"(enum) one of the following:"`
+	Type  DecoderEnum   `yaml:"type" json:"type" doc:"(enum) one of the following:"`
+	Proto *ProtoDecoder `yaml:"proto,omitempty" json:"proto,omitempty" doc:"generic protobuf decoder configuration, used when type is proto"`
+	JSON  *JSONDecoder  `yaml:"json,omitempty" json:"json,omitempty" doc:"JSON decoder configuration, used when type is json"`
+	CSV   *CSVDecoder   `yaml:"csv,omitempty" json:"csv,omitempty" doc:"CSV decoder configuration, used when type is csv"`
 }
 
 type DecoderEnum string
@@ -9,5 +12,25 @@ type DecoderEnum string
 const (
 	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
 	DecoderJSON     DecoderEnum = "json"     // JSON decoder
-	DecoderProtobuf DecoderEnum = "protobuf" // Protobuf decoder
+	DecoderProtobuf DecoderEnum = "protobuf" // Protobuf decoder, for records sent by the NetObserv eBPF agent
+	DecoderProto    DecoderEnum = "proto"    // Generic protobuf (proto3) decoder, using a user-provided message definition
+	DecoderCSV      DecoderEnum = "csv"      // CSV decoder, whose field names are read from the header row of the file
 )
+
+type ProtoDecoder struct {
+	ProtoFile         string            `yaml:"protoFile,omitempty" json:"protoFile,omitempty" doc:".proto file path defining the message; imports are resolved relatively to its directory (either protoFile or descriptorSetFile must be set)"`
+	DescriptorSetFile string            `yaml:"descriptorSetFile,omitempty" json:"descriptorSetFile,omitempty" doc:"binary FileDescriptorSet file path, as generated by protoc --descriptor_set_out --include_imports"`
+	MessageType       string            `yaml:"messageType,omitempty" json:"messageType,omitempty" doc:"fully-qualified name of the message to decode (e.g. mycompany.flows.v1.Record)"`
+	Mapping           map[string]string `yaml:"mapping,omitempty" json:"mapping,omitempty" doc:"mapping from field paths (e.g. src.addr) to output field names; when empty, all fields are output, nested fields being named after their path with '_' separators"`
+}
+
+type JSONDecoder struct {
+	Strict          bool             `yaml:"strict,omitempty" json:"strict,omitempty" doc:"stop the process on the first malformed record, for debugging; by default, malformed records are skipped and counted in the decode_malformed_records_total operational metric"`
+	DeadLetterQueue *DeadLetterQueue `yaml:"deadLetterQueue,omitempty" json:"deadLetterQueue,omitempty" doc:"dead-letter queue receiving the malformed records, with their raw content in the _raw field and the parse error in the _dlq_reason field; retries are not used"`
+}
+
+type CSVDecoder struct {
+	Delimiter  string   `yaml:"delimiter,omitempty" json:"delimiter,omitempty" doc:"field delimiter, a single character (default: ,)"`
+	LazyQuotes bool     `yaml:"lazyQuotes,omitempty" json:"lazyQuotes,omitempty" doc:"accept quotes in unquoted fields, and unescaped quotes in quoted fields (default: false)"`
+	Fields     []string `yaml:"fields,omitempty" json:"fields,omitempty" doc:"field names, for records without a header row, e.g. from Kafka; by default, they are read from the first row of the file"`
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+type EncodeCSV struct {
+	Filename  string         `yaml:"filename" json:"filename" doc:"path of the CSV file, truncated when the stage starts"`
+	Fields    []string       `yaml:"fields" json:"fields" doc:"flow fields written as columns, in this order; the header row holds their names"`
+	Delimiter string         `yaml:"delimiter,omitempty" json:"delimiter,omitempty" doc:"field delimiter, a single character (default: ,)"`
+	Quoting   CSVQuotingEnum `yaml:"quoting,omitempty" json:"quoting,omitempty" doc:"(enum) quoting of the values:"`
+}
+
+type CSVQuotingEnum string
+
+const (
+	CSVQuoteMinimal CSVQuotingEnum = "minimal" // quote the values holding the delimiter, quotes, line breaks or leading spaces (default)
+	CSVQuoteAll     CSVQuotingEnum = "all"     // quote all the values
+)
+
+func (e *EncodeCSV) Validate() error {
+	if e.Filename == "" {
+		return errors.New("filename can't be empty")
+	}
+	if len(e.Fields) == 0 {
+		return errors.New("fields can't be empty")
+	}
+	switch e.Quoting {
+	case "", CSVQuoteMinimal, CSVQuoteAll:
+	default:
+		return fmt.Errorf("unknown quoting %q", e.Quoting)
+	}
+	_, err := e.GetDelimiter()
+	return err
+}
+
+func (e *EncodeCSV) GetDelimiter() (rune, error) {
+	return csvDelimiter(e.Delimiter)
+}
+
+func (d *CSVDecoder) GetDelimiter() (rune, error) {
+	if d == nil {
+		return ',', nil
+	}
+	return csvDelimiter(d.Delimiter)
+}
+
+func csvDelimiter(delimiter string) (rune, error) {
+	if delimiter == "" {
+		return ',', nil
+	}
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("invalid CSV delimiter %q: it must be a single character, other than quotes and line breaks", delimiter)
+	}
+	return r, nil
+}
@@ -17,6 +17,8 @@
 
 package api
 
+import "fmt"
+
 type EncodeKafka struct {
 	Address      string                  `yaml:"address" json:"address" doc:"address of kafka server"`
 	Topic        string                  `yaml:"topic" json:"topic" doc:"kafka topic to write to"`
@@ -25,10 +27,34 @@ type EncodeKafka struct {
 	ReadTimeout  int64                   `yaml:"readTimeout,omitempty" json:"readTimeout,omitempty" doc:"timeout (in seconds) for read operation performed by the Writer"`
 	BatchBytes   int64                   `yaml:"batchBytes,omitempty" json:"batchBytes,omitempty" doc:"limit the maximum size of a request in bytes before being sent to a partition"`
 	BatchSize    int                     `yaml:"batchSize,omitempty" json:"batchSize,omitempty" doc:"limit on how many messages will be buffered before being sent to a partition"`
+	BatchTimeout *Duration               `yaml:"batchTimeout,omitempty" json:"batchTimeout,omitempty" doc:"time limit on how often incomplete message batches will be flushed to kafka (default: flushed immediately)"`
+	Compression  KafkaCompressionEnum    `yaml:"compression,omitempty" json:"compression,omitempty" doc:"(enum) compression codec used to compress messages; one of the following:"`
+	RequiredAcks KafkaRequiredAcksEnum   `yaml:"requiredAcks,omitempty" json:"requiredAcks,omitempty" doc:"(enum) number of acknowledges from partition replicas required before receiving a response; one of the following:"`
+	PartitionKey []string                `yaml:"partitionKey,omitempty" json:"partitionKey,omitempty" doc:"flow fields whose values make the message key, so that the flows having the same values are sent to the same partition; the balancer defaults to hash (optional)"`
 	TLS          *ClientTLS              `yaml:"tls" json:"tls" doc:"TLS client configuration (optional)"`
 	SASL         *SASLConfig             `yaml:"sasl" json:"sasl" doc:"SASL configuration (optional)"`
 }
 
+func (e *EncodeKafka) Validate() error {
+	switch e.Compression {
+	case "", KafkaCompressionNone, KafkaCompressionGzip, KafkaCompressionSnappy, KafkaCompressionLz4, KafkaCompressionZstd:
+	default:
+		return fmt.Errorf("unknown kafka compression codec %q", e.Compression)
+	}
+	switch e.RequiredAcks {
+	case "", KafkaRequireNone, KafkaRequireOne, KafkaRequireAll:
+	default:
+		return fmt.Errorf("unknown kafka required acks %q", e.RequiredAcks)
+	}
+	if e.BatchTimeout != nil && e.BatchTimeout.Duration < 0 {
+		return fmt.Errorf("kafka batch timeout can't be negative: %v", e.BatchTimeout.Duration)
+	}
+	if len(e.PartitionKey) > 0 && (e.Balancer == KafkaRoundRobin || e.Balancer == KafkaLeastBytes) {
+		return fmt.Errorf("kafka balancer %s ignores the partition key: use hash, crc32 or murmur2", e.Balancer)
+	}
+	return nil
+}
+
 type KafkaEncodeBalancerEnum string
 
 const (
@@ -39,3 +65,23 @@ const (
 	KafkaCrc32      KafkaEncodeBalancerEnum = "crc32"      // Crc32 balancer
 	KafkaMurmur2    KafkaEncodeBalancerEnum = "murmur2"    // Murmur2 balancer
 )
+
+type KafkaCompressionEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	KafkaCompressionNone   KafkaCompressionEnum = "none"   // no compression (default)
+	KafkaCompressionGzip   KafkaCompressionEnum = "gzip"   // Gzip compression
+	KafkaCompressionSnappy KafkaCompressionEnum = "snappy" // Snappy compression
+	KafkaCompressionLz4    KafkaCompressionEnum = "lz4"    // LZ4 compression
+	KafkaCompressionZstd   KafkaCompressionEnum = "zstd"   // Zstandard compression
+)
+
+type KafkaRequiredAcksEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	KafkaRequireNone KafkaRequiredAcksEnum = "none" // do not wait for acknowledges (default)
+	KafkaRequireOne  KafkaRequiredAcksEnum = "one"  // wait for the leader to acknowledge the writes
+	KafkaRequireAll  KafkaRequiredAcksEnum = "all"  // wait for the full ISR to acknowledge the writes
+)
@@ -23,15 +23,35 @@ type EncodeOtlpLogs struct {
 
 type EncodeOtlpTraces struct {
 	*OtlpConnectionInfo `json:",inline" doc:"OpenTelemetry connection info; includes:"`
-	SpanSplitter        []string `yaml:"spanSplitter,omitempty" json:"spanSplitter,omitempty" doc:"separate span for each prefix listed"`
+	SpanSplitter        []string             `yaml:"spanSplitter,omitempty" json:"spanSplitter,omitempty" doc:"separate span for each prefix listed"`
+	Connections         *OtlpConnectionSpans `yaml:"connections,omitempty" json:"connections,omitempty" doc:"turn the endConnection records of a conntrack stage into spans covering the connections, other records being ignored; includes:"`
+}
+
+type OtlpConnectionSpans struct {
+	ConversationIDField string `yaml:"conversationIdField,omitempty" json:"conversationIdField,omitempty" doc:"field shared by the connections of a conversation, whose spans get the same trace ID (default: _HashId, i.e. one trace per connection)"`
+	StartTimeField      string `yaml:"startTimeField,omitempty" json:"startTimeField,omitempty" doc:"field holding the start time of the connection, in milliseconds (default: TimeFlowStartMs)"`
+	EndTimeField        string `yaml:"endTimeField,omitempty" json:"endTimeField,omitempty" doc:"field holding the end time of the connection, in milliseconds (default: TimeFlowEndMs)"`
+}
+
+func (c *OtlpConnectionSpans) SetDefaults() {
+	if c.ConversationIDField == "" {
+		c.ConversationIDField = HashIDFieldName
+	}
+	if c.StartTimeField == "" {
+		c.StartTimeField = "TimeFlowStartMs"
+	}
+	if c.EndTimeField == "" {
+		c.EndTimeField = "TimeFlowEndMs"
+	}
 }
 
 type EncodeOtlpMetrics struct {
 	*OtlpConnectionInfo `json:",inline" doc:"OpenTelemetry connection info; includes:"`
-	Prefix              string       `yaml:"prefix,omitempty" json:"prefix,omitempty" doc:"prefix added to each metric name"`
-	Metrics             MetricsItems `yaml:"metrics,omitempty" json:"metrics,omitempty" doc:"list of metric definitions, each includes:"`
-	PushTimeInterval    Duration     `yaml:"pushTimeInterval,omitempty" json:"pushTimeInterval,omitempty" doc:"how often should metrics be sent to collector:"`
-	ExpiryTime          Duration     `yaml:"expiryTime,omitempty" json:"expiryTime,omitempty" doc:"time duration of no-flow to wait before deleting data item"`
+	Prefix              string            `yaml:"prefix,omitempty" json:"prefix,omitempty" doc:"prefix added to each metric name"`
+	Metrics             MetricsItems      `yaml:"metrics,omitempty" json:"metrics,omitempty" doc:"list of metric definitions, each includes:"`
+	PushTimeInterval    Duration          `yaml:"pushTimeInterval,omitempty" json:"pushTimeInterval,omitempty" doc:"how often should metrics be sent to collector:"`
+	ExpiryTime          Duration          `yaml:"expiryTime,omitempty" json:"expiryTime,omitempty" doc:"time duration of no-flow to wait before deleting data item"`
+	ResourceAttributes  map[string]string `yaml:"resourceAttributes,omitempty" json:"resourceAttributes,omitempty" doc:"attributes added to the resource of the metrics, e.g. to identify the cluster (optional)"`
 }
 
 type OtlpConnectionInfo struct {
@@ -39,5 +59,5 @@ type OtlpConnectionInfo struct {
 	Port           int               `yaml:"port" json:"port" doc:"endpoint port number to expose"`
 	ConnectionType string            `yaml:"connectionType" json:"connectionType" doc:"interface mechanism: either http or grpc"`
 	TLS            *ClientTLS        `yaml:"tls,omitempty" json:"tls,omitempty" doc:"TLS configuration for the endpoint"`
-	Headers        map[string]string `yaml:"headers,omitempty" json:"headers,omitempty" doc:"headers to add to messages (optional)"`
+	Headers        map[string]string `yaml:"headers,omitempty" json:"headers,omitempty" doc:"headers to add to messages, e.g. for bearer token authentication (optional)"`
 }
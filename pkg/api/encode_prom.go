@@ -17,6 +17,13 @@
 
 package api
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type PromTLSConf struct {
 	CertPath string `yaml:"certPath,omitempty" json:"certPath,omitempty" doc:"path to the certificate file"`
 	KeyPath  string `yaml:"keyPath,omitempty" json:"keyPath,omitempty" doc:"path to the key file"`
@@ -28,6 +35,107 @@ type PromEncode struct {
 	Prefix              string       `yaml:"prefix,omitempty" json:"prefix,omitempty" doc:"prefix added to each metric name"`
 	ExpiryTime          Duration     `yaml:"expiryTime,omitempty" json:"expiryTime,omitempty" doc:"time duration of no-flow to wait before deleting prometheus data item"`
 	MaxMetrics          int          `yaml:"maxMetrics,omitempty" json:"maxMetrics,omitempty" doc:"maximum number of metrics to report (default: unlimited)"`
+	MaxLabelLength      int          `yaml:"maxLabelLength,omitempty" json:"maxLabelLength,omitempty" doc:"maximum number of characters of the label values; longer values are truncated, ending with a ... marker, so that the flows of similar long values share a series (default: unlimited)"`
+	TruncateFromLeft    bool         `yaml:"truncateFromLeft,omitempty" json:"truncateFromLeft,omitempty" doc:"truncate the beginning of the long label values rather than their end, keeping their suffix, which is often more unique, as for the generated suffixes of pod names; the values then start with the ... marker (default: false)"`
+	CardinalityLimit    int          `yaml:"cardinalityLimit,omitempty" json:"cardinalityLimit,omitempty" doc:"maximum number of series of each metric; the flows of the new label sets beyond it are counted in a series whose label values are __overflow__, and their number is exposed in a <metric>_overflow_count gauge (default: unlimited)"`
+	ExemplarFields      []string     `yaml:"exemplarFields,omitempty" json:"exemplarFields,omitempty" doc:"entry fields, such as trace or span IDs, attached as exemplar labels to the counter increments; exemplars are only exposed to OpenMetrics scrapes (optional)"`
+	Istio               *PromIstio   `yaml:"istio,omitempty" json:"istio,omitempty" doc:"also export the TCP flows as Istio metrics, for Kiali to draw the topology without a service mesh (optional); includes:"`
+}
+
+// Labels of the Istio TCP metrics, as read by Kiali
+const (
+	IstioSourceWorkload               = "source_workload"
+	IstioSourceWorkloadNamespace      = "source_workload_namespace"
+	IstioSourceApp                    = "source_app"
+	IstioDestinationWorkload          = "destination_workload"
+	IstioDestinationWorkloadNamespace = "destination_workload_namespace"
+	IstioDestinationApp               = "destination_app"
+	IstioRequestProtocol              = "request_protocol"
+	IstioResponseFlags                = "response_flags"
+	IstioReporter                     = "reporter"
+)
+
+type PromIstio struct {
+	Labels             map[string]string `yaml:"labels,omitempty" json:"labels,omitempty" doc:"Istio labels mapped to the flow fields they are read from, merged with the defaults; an empty field removes the label (default: source_workload: SrcK8S_OwnerName, source_workload_namespace: SrcK8S_Namespace, source_app: SrcK8S_Labels_app, and the same for destination with DstK8S)"`
+	ConstLabels        map[string]string `yaml:"constLabels,omitempty" json:"constLabels,omitempty" doc:"Istio labels with a fixed value, merged with the defaults; an empty value removes the label (default: request_protocol: tcp, response_flags: -, reporter: source)"`
+	SentBytesField     string            `yaml:"sentBytesField,omitempty" json:"sentBytesField,omitempty" doc:"flow field counted by istio_tcp_sent_bytes_total (default: Bytes)"`
+	ReceivedBytesField string            `yaml:"receivedBytesField,omitempty" json:"receivedBytesField,omitempty" doc:"flow field counted by istio_tcp_received_bytes_total (default: Bytes)"`
+}
+
+func (i *PromIstio) SetDefaults() {
+	i.Labels = mergeIstioLabels(map[string]string{
+		IstioSourceWorkload:               "SrcK8S_OwnerName",
+		IstioSourceWorkloadNamespace:      "SrcK8S_Namespace",
+		IstioSourceApp:                    "SrcK8S_Labels_app",
+		IstioDestinationWorkload:          "DstK8S_OwnerName",
+		IstioDestinationWorkloadNamespace: "DstK8S_Namespace",
+		IstioDestinationApp:               "DstK8S_Labels_app",
+	}, i.Labels)
+	i.ConstLabels = mergeIstioLabels(map[string]string{
+		IstioRequestProtocol: "tcp",
+		IstioResponseFlags:   "-",
+		IstioReporter:        "source",
+	}, i.ConstLabels)
+	if i.SentBytesField == "" {
+		i.SentBytesField = "Bytes"
+	}
+	if i.ReceivedBytesField == "" {
+		i.ReceivedBytesField = "Bytes"
+	}
+}
+
+func mergeIstioLabels(defaults, overrides map[string]string) map[string]string {
+	for label, v := range overrides {
+		if v == "" {
+			delete(defaults, label)
+		} else {
+			defaults[label] = v
+		}
+	}
+	return defaults
+}
+
+// Metrics returns the definitions of the Istio TCP metrics, restricted to the TCP flows
+func (i *PromIstio) Metrics() MetricsItems {
+	labels := make([]string, 0, len(i.Labels))
+	remap := make(map[string]string, len(i.Labels))
+	for label, field := range i.Labels {
+		labels = append(labels, field)
+		remap[field] = label
+	}
+	sort.Strings(labels)
+	item := func(name, valueKey string) MetricsItem {
+		return MetricsItem{
+			Name:        name,
+			Type:        MetricCounter,
+			Filters:     []MetricsFilter{{Key: "Proto", Value: "6", Type: MetricFilterEqual}},
+			ValueKey:    valueKey,
+			Labels:      labels,
+			Remap:       remap,
+			ConstLabels: i.ConstLabels,
+		}
+	}
+	return MetricsItems{
+		item("istio_tcp_sent_bytes_total", i.SentBytesField),
+		item("istio_tcp_received_bytes_total", i.ReceivedBytesField),
+	}
+}
+
+func (i *PromIstio) Validate(prefix string) error {
+	if prefix != "" {
+		return fmt.Errorf("the Istio metrics can't be prefixed, remove the prefix %q", prefix)
+	}
+	fields := map[string]string{}
+	for label, field := range i.Labels {
+		if other, ok := fields[field]; ok {
+			return fmt.Errorf("the Istio labels %s and %s can't be read from the same field %s", other, label, field)
+		}
+		fields[field] = label
+		if _, ok := i.ConstLabels[label]; ok {
+			return fmt.Errorf("the Istio label %s can't be both read from a field and constant", label)
+		}
+	}
+	return nil
 }
 
 type MetricEncodeOperationEnum string
@@ -43,7 +151,34 @@ const (
 type PromConnectionInfo struct {
 	Address string       `yaml:"address,omitempty" json:"address,omitempty" doc:"endpoint address to expose"`
 	Port    int          `yaml:"port,omitempty" json:"port,omitempty" doc:"endpoint port number to expose"`
+	Path    string       `yaml:"path,omitempty" json:"path,omitempty" doc:"endpoint HTTP path serving the metrics (default: /metrics)"`
 	TLS     *PromTLSConf `yaml:"tls,omitempty" json:"tls,omitempty" doc:"TLS configuration for the endpoint"`
+	Auth    *PromAuth    `yaml:"auth,omitempty" json:"auth,omitempty" doc:"authentication required from the scrapers, answered with 401 Unauthorized otherwise (optional); either a bearer token or a basic authentication:"`
+}
+
+type PromAuth struct {
+	BearerTokenPath string `yaml:"bearerTokenPath,omitempty" json:"bearerTokenPath,omitempty" doc:"path to the file containing the bearer token expected in the Authorization header"`
+	Username        string `yaml:"username,omitempty" json:"username,omitempty" doc:"username of the basic authentication"`
+	PasswordPath    string `yaml:"passwordPath,omitempty" json:"passwordPath,omitempty" doc:"path to the file containing the password of the basic authentication"`
+}
+
+func (c *PromConnectionInfo) Validate() error {
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("invalid metrics path %q: it must start with /", c.Path)
+	}
+	if c.Auth == nil {
+		return nil
+	}
+	basic := c.Auth.Username != "" || c.Auth.PasswordPath != ""
+	switch {
+	case c.Auth.BearerTokenPath != "" && basic:
+		return errors.New("metrics endpoint auth: bearerTokenPath and basic authentication can't be both set")
+	case basic && (c.Auth.Username == "" || c.Auth.PasswordPath == ""):
+		return errors.New("metrics endpoint auth: basic authentication requires a username and a passwordPath")
+	case c.Auth.BearerTokenPath == "" && !basic:
+		return errors.New("metrics endpoint auth requires a bearerTokenPath, or a username and a passwordPath")
+	}
+	return nil
 }
 
 type MetricsItem struct {
@@ -56,6 +191,40 @@ type MetricsItem struct {
 	Flatten    []string                  `yaml:"flatten" json:"flatten" doc:"list fields to be flattened"`
 	Buckets    []float64                 `yaml:"buckets" json:"buckets" doc:"histogram buckets"`
 	ValueScale float64                   `yaml:"valueScale,omitempty" json:"valueScale,omitempty" doc:"scale factor of the value (MetricVal := FlowVal / Scale)"`
+	// NativeHistogram is only supported by the prometheus encoder
+	NativeHistogram *NativeHistogram `yaml:"nativeHistogram,omitempty" json:"nativeHistogram,omitempty" doc:"expose a native histogram rather than a classic one, for histogram types with the prometheus encoder (optional); includes:"`
+	ExpiryTime      *Duration        `yaml:"expiryTime,omitempty" json:"expiryTime,omitempty" doc:"time duration of no-flow to wait before deleting a label series of this metric (default: the encoder expiryTime)"`
+	// ConstLabels is only supported by the prometheus encoder
+	ConstLabels map[string]string `yaml:"constLabels,omitempty" json:"constLabels,omitempty" doc:"labels with a fixed value, added to all the series of the metric, with the prometheus encoder (optional)"`
+	// AlertThreshold and AlertSeverity are only read by the generate-alerts command
+	AlertThreshold *float64 `yaml:"alertThreshold,omitempty" json:"alertThreshold,omitempty" doc:"threshold above which the generate-alerts command emits an alert: per second for counters, on the average for histograms (optional)"`
+	AlertSeverity  string   `yaml:"alertSeverity,omitempty" json:"alertSeverity,omitempty" doc:"severity label of the generated alert (default: warning)"`
+}
+
+const DefaultAlertSeverity = "warning"
+
+type NativeHistogram struct {
+	BucketFactor    float64 `yaml:"bucketFactor,omitempty" json:"bucketFactor,omitempty" doc:"maximum growth factor between two consecutive buckets, must be greater than 1 (default: 1.1)"`
+	MaxBucketNumber uint32  `yaml:"maxBucketNumber,omitempty" json:"maxBucketNumber,omitempty" doc:"maximum number of buckets; when exceeded, the resolution is reduced (default: 160)"`
+}
+
+func (m *MetricsItem) Validate() error {
+	if m.ExpiryTime != nil && m.ExpiryTime.Duration < 0 {
+		return fmt.Errorf("metric %s: expiryTime must not be negative", m.Name)
+	}
+	if m.AlertSeverity != "" && m.AlertThreshold == nil {
+		return fmt.Errorf("metric %s: alertSeverity is set without alertThreshold", m.Name)
+	}
+	if m.NativeHistogram == nil {
+		return nil
+	}
+	if m.Type != MetricHistogram && m.Type != MetricAggHistogram {
+		return fmt.Errorf("metric %s: nativeHistogram is only supported with the histogram and agg_histogram types", m.Name)
+	}
+	if m.NativeHistogram.BucketFactor != 0 && m.NativeHistogram.BucketFactor <= 1 {
+		return fmt.Errorf("metric %s: nativeHistogram bucketFactor must be greater than 1", m.Name)
+	}
+	return nil
 }
 
 type MetricsItems []MetricsItem
@@ -27,6 +27,51 @@ type EncodeS3 struct {
 	BatchSize              int                    `yaml:"batchSize,omitempty" json:"batchSize,omitempty" doc:"limit on how many flows will be buffered before being sent to an object"`
 	Secure                 bool                   `yaml:"secure,omitempty" json:"secure,omitempty" doc:"true for https, false for http (default: false)"`
 	ObjectHeaderParameters map[string]interface{} `yaml:"objectHeaderParameters,omitempty" json:"objectHeaderParameters,omitempty" doc:"parameters to include in object header (key/value pairs)"`
+	KeyTemplate            string                 `yaml:"keyTemplate,omitempty" json:"keyTemplate,omitempty" doc:"template of the object keys, made of the {account}, {year}, {month}, {day}, {hour}, {stream-id}, {seq} and {field:<name>} tokens; it must contain {seq} (default: {account}/year={year}/month={month}/day={day}/hour={hour}/stream-id={stream-id}/{seq})"`
+	MissingFieldValue      string                 `yaml:"missingFieldValue,omitempty" json:"missingFieldValue,omitempty" doc:"value of the {field:<name>} tokens for the flows missing the field (default: __HIVE_DEFAULT_PARTITION__)"`
+	Format                 S3FormatEnum           `yaml:"format,omitempty" json:"format,omitempty" doc:"(enum) format of the objects:"`
+	Parquet                *EncodeS3Parquet       `yaml:"parquet,omitempty" json:"parquet,omitempty" doc:"Parquet format configuration (optional)"`
 	// TBD: (TLS?) security parameters
 	// TLS                    *ClientTLS             `yaml:"tls" json:"tls" doc:"TLS client configuration (optional)"`
 }
+
+type S3FormatEnum string
+
+const (
+	S3JSON    S3FormatEnum = "json"    // JSON object holding the header fields and the flow logs (default)
+	S3Parquet S3FormatEnum = "parquet" // Parquet file with a row per flow log, the header fields being stored as key/value metadata
+)
+
+type EncodeS3Parquet struct {
+	Compression ParquetCompressionEnum `yaml:"compression,omitempty" json:"compression,omitempty" doc:"(enum) compression of the columns (default: snappy):"`
+	Columns     []ParquetColumn        `yaml:"columns,omitempty" json:"columns,omitempty" doc:"typed columns; the other flow fields are written with a type derived from their values (optional)"`
+}
+
+type ParquetColumn struct {
+	Name        string                 `yaml:"name" json:"name" doc:"name of the flow field, also used as column name"`
+	Type        ParquetTypeEnum        `yaml:"type" json:"type" doc:"(enum) type of the column; missing fields and values that can't be converted are written as null:"`
+	Compression ParquetCompressionEnum `yaml:"compression,omitempty" json:"compression,omitempty" doc:"compression of the column, overriding the file compression (optional)"`
+}
+
+type ParquetCompressionEnum string
+
+const (
+	ParquetUncompressed ParquetCompressionEnum = "none"   // no compression
+	ParquetSnappy       ParquetCompressionEnum = "snappy" // Snappy compression
+	ParquetGzip         ParquetCompressionEnum = "gzip"   // Gzip compression
+	ParquetZstd         ParquetCompressionEnum = "zstd"   // Zstandard compression
+)
+
+type ParquetTypeEnum string
+
+const (
+	ParquetString      ParquetTypeEnum = "string"       // string
+	ParquetBool        ParquetTypeEnum = "bool"         // boolean
+	ParquetInt64       ParquetTypeEnum = "int64"        // 64 bits signed integer
+	ParquetUint64      ParquetTypeEnum = "uint64"       // 64 bits unsigned integer, e.g. for bytes and packets
+	ParquetDouble      ParquetTypeEnum = "double"       // floating point number
+	ParquetPort        ParquetTypeEnum = "port"         // 16 bits unsigned integer
+	ParquetIP          ParquetTypeEnum = "ip"           // IP address, as a string in its canonical form
+	ParquetTimestamp   ParquetTypeEnum = "timestamp"    // timestamp with milliseconds precision, from a field in seconds
+	ParquetTimestampMs ParquetTypeEnum = "timestamp_ms" // timestamp with milliseconds precision, from a field in milliseconds
+)
@@ -20,6 +20,19 @@ package api
 type Aggregates struct {
 	DefaultExpiryTime Duration             `yaml:"defaultExpiryTime,omitempty" json:"defaultExpiryTime,omitempty" doc:"default time duration of data aggregation to perform rules (default: 2 minutes)"`
 	Rules             AggregateDefinitions `yaml:"rules,omitempty" json:"rules,omitempty" doc:"list of aggregation rules, each includes:"`
+	StateStore        *AggregateStateStore `yaml:"stateStore,omitempty" json:"stateStore,omitempty" doc:"store where the running totals of the aggregates are persisted, to resume from them after a restart (default: none, the state is kept in memory only)"`
+}
+
+type AggregateStateStoreEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	AggregateStateStoreBadger AggregateStateStoreEnum = "badger" // BadgerDB embedded key-value store (default)
+)
+
+type AggregateStateStore struct {
+	Type AggregateStateStoreEnum `yaml:"type,omitempty" json:"type,omitempty" doc:"(enum) one of the following:"`
+	Path string                  `yaml:"path,omitempty" json:"path,omitempty" doc:"directory of the store; the state is kept in memory only when empty"`
 }
 
 type AggregateBy []string
@@ -27,9 +40,49 @@ type AggregateOperation string
 type AggregateDefinitions []AggregateDefinition
 
 type AggregateDefinition struct {
-	Name          string             `yaml:"name,omitempty" json:"name,omitempty" doc:"description of aggregation result"`
-	GroupByKeys   AggregateBy        `yaml:"groupByKeys,omitempty" json:"groupByKeys,omitempty" doc:"list of fields on which to aggregate"`
-	OperationType AggregateOperation `yaml:"operationType,omitempty" json:"operationType,omitempty" doc:"sum, min, max, count, avg or raw_values"`
-	OperationKey  string             `yaml:"operationKey,omitempty" json:"operationKey,omitempty" doc:"internal field on which to perform the operation"`
-	ExpiryTime    Duration           `yaml:"expiryTime,omitempty" json:"expiryTime,omitempty" doc:"time interval over which to perform the operation"`
+	Name             string                        `yaml:"name,omitempty" json:"name,omitempty" doc:"description of aggregation result"`
+	GroupByKeys      AggregateBy                   `yaml:"groupByKeys,omitempty" json:"groupByKeys,omitempty" doc:"list of fields on which to aggregate"`
+	OperationType    AggregateOperation            `yaml:"operationType,omitempty" json:"operationType,omitempty" doc:"sum, min, max, count, avg, percentile, raw_values, topN, distinct_count or rate"`
+	OperationKey     string                        `yaml:"operationKey,omitempty" json:"operationKey,omitempty" doc:"internal field on which to perform the operation"`
+	ExpiryTime       Duration                      `yaml:"expiryTime,omitempty" json:"expiryTime,omitempty" doc:"time interval over which to perform the operation"`
+	Percentiles      []float64                     `yaml:"percentiles,omitempty" json:"percentiles,omitempty" doc:"percentiles to compute with the percentile operation, between 0 and 100 (e.g. [50, 90, 99])"`
+	PercentileOutput AggregatePercentileOutputEnum `yaml:"percentileOutput,omitempty" json:"percentileOutput,omitempty" doc:"(enum) how the percentiles are reported; one of the following:"`
+	ErrorBound       float64                       `yaml:"errorBound,omitempty" json:"errorBound,omitempty" doc:"relative error of the computed percentiles (default: 0.01), or standard error of the distinct_count estimate (default: 0.02); lower values are more accurate but use more memory"`
+	Window           *AggregateWindow              `yaml:"window,omitempty" json:"window,omitempty" doc:"time window over which the recent values are computed (default: the recent batch)"`
+	TopN             int                           `yaml:"topN,omitempty" json:"topN,omitempty" doc:"number of groups with the highest operationKey sum (or count, without operationKey) to report per window with the topN operation"`
+	TopNCapacity     int                           `yaml:"topNCapacity,omitempty" json:"topNCapacity,omitempty" doc:"number of groups tracked by the topN operation, at least topN; tracking more groups than reported makes the reported values more accurate (default: topN)"`
+	TopNOther        bool                          `yaml:"topNOther,omitempty" json:"topNOther,omitempty" doc:"with the topN operation, report the flows of the groups beyond the topN ones in an additional record, whose group keys are set to 'other'; requires topNCapacity to be greater than topN"`
+}
+
+type AggregatePercentileOutputEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	AggregatePercentileRecords AggregatePercentileOutputEnum = "records" // one output record per percentile, named <name>_p<percentile> (default)
+	AggregatePercentileFields  AggregatePercentileOutputEnum = "fields"  // a single output record, with recent_p<percentile> and total_p<percentile> fields
+)
+
+type AggregateWindowEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	AggregateWindowTumbling AggregateWindowEnum = "tumbling" // recent values are computed over the recent batch, and reset once reported (default)
+	AggregateWindowSliding  AggregateWindowEnum = "sliding"  // recent values are computed over the last `size` duration, and reported every `slide` duration
+)
+
+type AggregateWindow struct {
+	Type            AggregateWindowEnum     `yaml:"type,omitempty" json:"type,omitempty" doc:"(enum) one of the following:"`
+	Size            Duration                `yaml:"size,omitempty" json:"size,omitempty" doc:"duration of the sliding window (e.g. 5m)"`
+	Slide           Duration                `yaml:"slide,omitempty" json:"slide,omitempty" doc:"duration after which the sliding window advances and is reported (e.g. 30s); size must be a multiple of slide, up to 120 times"`
+	TimeField       string                  `yaml:"timeField,omitempty" json:"timeField,omitempty" doc:"field holding the event time of the flows, in milliseconds since the epoch (e.g. TimeFlowEndMs): the flows are counted in the slide of their event time, and a slide is completed once the watermark passes its end (default: the processing time is used)"`
+	AllowedLateness Duration                `yaml:"allowedLateness,omitempty" json:"allowedLateness,omitempty" doc:"with timeField, how far the watermark lags behind the latest event time, to wait for the flows received out of order (default: 0)"`
+	LatePolicy      AggregateLatePolicyEnum `yaml:"latePolicy,omitempty" json:"latePolicy,omitempty" doc:"(enum) with timeField, what to do with the flows older than the watermark:"`
 }
+
+type AggregateLatePolicyEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	AggregateLateDrop   AggregateLatePolicyEnum = "drop"        // late flows are dropped, and counted in the aggregate_late_flows operational metric (default)
+	AggregateLateBucket AggregateLatePolicyEnum = "late_bucket" // late flows are aggregated apart, and reported with the <name>_late name
+)
@@ -30,17 +30,27 @@ const (
 	FilterOperationDiff FilterOperationEnum = "diff"  // set output field to the difference of the first and last parameters fields in the time window
 )
 
+type TimebasedDirectionEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	TimebasedTop    TimebasedDirectionEnum = "top"    // highest values first (default, unless reversed is set)
+	TimebasedBottom TimebasedDirectionEnum = "bottom" // lowest values first
+)
+
 type ExtractTimebased struct {
 	Rules []TimebasedFilterRule `yaml:"rules,omitempty" json:"rules,omitempty" doc:"list of filter rules, each includes:"`
 }
 
 type TimebasedFilterRule struct {
-	Name          string              `yaml:"name,omitempty" json:"name,omitempty" doc:"description of filter result"`
-	IndexKey      string              `yaml:"indexKey,omitempty" json:"indexKey,omitempty" doc:"internal field to index TopK. Deprecated, use indexKeys instead"`
-	IndexKeys     []string            `yaml:"indexKeys,omitempty" json:"indexKeys,omitempty" doc:"internal fields to index TopK"`
-	OperationType FilterOperationEnum `yaml:"operationType,omitempty" json:"operationType,omitempty" doc:"(enum) sum, min, max, avg, count, last or diff"`
-	OperationKey  string              `yaml:"operationKey,omitempty" json:"operationKey,omitempty" doc:"internal field on which to perform the operation"`
-	TopK          int                 `yaml:"topK,omitempty" json:"topK,omitempty" doc:"number of highest incidence to report (default - report all)"`
-	Reversed      bool                `yaml:"reversed,omitempty" json:"reversed,omitempty" doc:"report lowest incidence instead of highest (default - false)"`
-	TimeInterval  Duration            `yaml:"timeInterval,omitempty" json:"timeInterval,omitempty" doc:"time duration of data to use to compute the metric"`
+	Name          string                 `yaml:"name,omitempty" json:"name,omitempty" doc:"description of filter result"`
+	IndexKey      string                 `yaml:"indexKey,omitempty" json:"indexKey,omitempty" doc:"internal field to index TopK. Deprecated, use indexKeys instead"`
+	IndexKeys     []string               `yaml:"indexKeys,omitempty" json:"indexKeys,omitempty" doc:"internal fields to index TopK"`
+	OperationType FilterOperationEnum    `yaml:"operationType,omitempty" json:"operationType,omitempty" doc:"(enum) sum, min, max, avg, count, last or diff"`
+	OperationKey  string                 `yaml:"operationKey,omitempty" json:"operationKey,omitempty" doc:"internal field on which to perform the operation"`
+	TopK          int                    `yaml:"topK,omitempty" json:"topK,omitempty" doc:"number of highest incidence to report (default - report all)"`
+	Reversed      bool                   `yaml:"reversed,omitempty" json:"reversed,omitempty" doc:"report lowest incidence instead of highest (default - false). Deprecated, use direction instead"`
+	Direction     TimebasedDirectionEnum `yaml:"direction,omitempty" json:"direction,omitempty" doc:"(enum) ranking of the reported entries; one of the following:"`
+	Abs           bool                   `yaml:"abs,omitempty" json:"abs,omitempty" doc:"rank the entries by the absolute value of the operation result, e.g. for a diff; the reported value keeps its sign (default - false)"`
+	TimeInterval  Duration               `yaml:"timeInterval,omitempty" json:"timeInterval,omitempty" doc:"time duration of data to use to compute the metric"`
 }
@@ -17,9 +17,77 @@
 
 package api
 
+import (
+	"fmt"
+	"time"
+)
+
 type IngestCollector struct {
-	HostName    string `yaml:"hostName,omitempty" json:"hostName,omitempty" doc:"the hostname to listen on"`
-	Port        int    `yaml:"port,omitempty" json:"port,omitempty" doc:"the port number to listen on, for IPFIX/NetFlow v9. Omit or set to 0 to disable IPFIX/NetFlow v9 ingestion"`
-	PortLegacy  int    `yaml:"portLegacy,omitempty" json:"portLegacy,omitempty" doc:"the port number to listen on, for legacy NetFlow v5. Omit or set to 0 to disable NetFlow v5 ingestion"`
-	BatchMaxLen int    `yaml:"batchMaxLen,omitempty" json:"batchMaxLen,omitempty" doc:"the number of accumulated flows before being forwarded for processing"`
+	HostName               string              `yaml:"hostName,omitempty" json:"hostName,omitempty" doc:"the hostname to listen on"`
+	Port                   int                 `yaml:"port,omitempty" json:"port,omitempty" doc:"the port number to listen on, for IPFIX/NetFlow v9. Omit or set to 0 to disable IPFIX/NetFlow v9 ingestion"`
+	PortLegacy             int                 `yaml:"portLegacy,omitempty" json:"portLegacy,omitempty" doc:"the port number to listen on, for legacy NetFlow v5. Omit or set to 0 to disable NetFlow v5 ingestion"`
+	PortTCP                int                 `yaml:"portTCP,omitempty" json:"portTCP,omitempty" doc:"the TCP port number to listen on, for IPFIX over TCP. Omit or set to 0 to disable it"`
+	BatchMaxLen            int                 `yaml:"batchMaxLen,omitempty" json:"batchMaxLen,omitempty" doc:"the number of accumulated flows before being forwarded for processing"`
+	EnterpriseElements     []EnterpriseElement `yaml:"enterpriseElements,omitempty" json:"enterpriseElements,omitempty" doc:"IPFIX enterprise-specific information elements to decode into named fields; the other ones are kept as hexadecimal strings in Enterprise_<pen>_<id> fields. Each includes:"`
+	EnterpriseElementsPath string              `yaml:"enterpriseElementsPath,omitempty" json:"enterpriseElementsPath,omitempty" doc:"path to a YAML file listing more enterprise-specific information elements, in the enterpriseElements format"`
+	OrphanTimeout          *Duration           `yaml:"orphanTimeout,omitempty" json:"orphanTimeout,omitempty" doc:"how long to keep the NetFlow v9 / IPFIX datagrams received before the template of their data records, to decode them once the template is received; 0 to drop them (default: 5s)"`
+	MaxOrphanDatagrams     int                 `yaml:"maxOrphanDatagrams,omitempty" json:"maxOrphanDatagrams,omitempty" doc:"maximum number of datagrams waiting for their template; further ones are dropped (default: 1000)"`
+}
+
+type EnterpriseElementTypeEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	EnterpriseElementUnsigned EnterpriseElementTypeEnum = "unsigned" // unsigned integer, in network byte order (default)
+	EnterpriseElementSigned   EnterpriseElementTypeEnum = "signed"   // signed integer, in network byte order
+	EnterpriseElementIP       EnterpriseElementTypeEnum = "ip"       // IPv4 or IPv6 address
+	EnterpriseElementMAC      EnterpriseElementTypeEnum = "mac"      // MAC address
+	EnterpriseElementString   EnterpriseElementTypeEnum = "string"   // UTF-8 string
+	EnterpriseElementBytes    EnterpriseElementTypeEnum = "bytes"    // raw octets, as an hexadecimal string
+)
+
+type EnterpriseElement struct {
+	PEN  uint32                    `yaml:"pen,omitempty" json:"pen,omitempty" doc:"private enterprise number of the element"`
+	ID   uint16                    `yaml:"id,omitempty" json:"id,omitempty" doc:"element ID, without the enterprise bit"`
+	Name string                    `yaml:"name,omitempty" json:"name,omitempty" doc:"name of the flow field holding the element value"`
+	Type EnterpriseElementTypeEnum `yaml:"type,omitempty" json:"type,omitempty" doc:"(enum) type of the element value, one of the following:"`
+}
+
+func (c *IngestCollector) SetDefaults() {
+	if c.OrphanTimeout == nil {
+		c.OrphanTimeout = &Duration{Duration: 5 * time.Second}
+	}
+	if c.MaxOrphanDatagrams == 0 {
+		c.MaxOrphanDatagrams = 1000
+	}
+}
+
+func (c *IngestCollector) Validate() error {
+	if c.OrphanTimeout != nil && c.OrphanTimeout.Duration < 0 {
+		return fmt.Errorf("invalid orphanTimeout: %v. Required >= 0", c.OrphanTimeout.Duration)
+	}
+	if c.MaxOrphanDatagrams < 0 {
+		return fmt.Errorf("invalid maxOrphanDatagrams: %d. Required >= 0", c.MaxOrphanDatagrams)
+	}
+	seen := map[[2]uint32]bool{}
+	for _, e := range c.EnterpriseElements {
+		if e.PEN == 0 || e.Name == "" {
+			return fmt.Errorf("enterprise element %d: pen and name must be provided", e.ID)
+		}
+		if e.ID >= 0x8000 {
+			return fmt.Errorf("enterprise element %d of PEN %d: invalid id, must be lower than 32768", e.ID, e.PEN)
+		}
+		switch e.Type {
+		case "", EnterpriseElementUnsigned, EnterpriseElementSigned, EnterpriseElementIP, EnterpriseElementMAC,
+			EnterpriseElementString, EnterpriseElementBytes:
+		default:
+			return fmt.Errorf("enterprise element %s: unknown type %s", e.Name, e.Type)
+		}
+		key := [2]uint32{e.PEN, uint32(e.ID)}
+		if seen[key] {
+			return fmt.Errorf("enterprise element %d of PEN %d is defined more than once", e.ID, e.PEN)
+		}
+		seen[key] = true
+	}
+	return nil
 }
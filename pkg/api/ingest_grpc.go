@@ -1,6 +1,9 @@
 package api
 
 type IngestGRPCProto struct {
-	Port      int `yaml:"port,omitempty" json:"port,omitempty" doc:"the port number to listen on"`
-	BufferLen int `yaml:"bufferLength,omitempty" json:"bufferLength,omitempty" doc:"the length of the ingest channel buffer, in groups of flows, containing each group hundreds of flows (default: 100)"`
+	Address        string     `yaml:"address,omitempty" json:"address,omitempty" doc:"the address to listen on (default: all interfaces)"`
+	Port           int        `yaml:"port,omitempty" json:"port,omitempty" doc:"the port number to listen on"`
+	BufferLen      int        `yaml:"bufferLength,omitempty" json:"bufferLength,omitempty" doc:"the length of the ingest channel buffer, in groups of flows, containing each group hundreds of flows (default: 100)"`
+	MaxMessageSize int        `yaml:"maxMessageSize,omitempty" json:"maxMessageSize,omitempty" doc:"the maximum size of a received group of flows, in bytes (default: 4MB)"`
+	TLS            *ServerTLS `yaml:"tls,omitempty" json:"tls,omitempty" doc:"TLS server configuration (optional)"`
 }
@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import "fmt"
+
+type IngestRateLimit struct {
+	FlowsPerSecond float64            `yaml:"flowsPerSecond,omitempty" json:"flowsPerSecond,omitempty" doc:"maximum number of flows per second accepted from each source (default: unlimited)"`
+	Burst          int                `yaml:"burst,omitempty" json:"burst,omitempty" doc:"number of flows accepted at once from a source, above its rate (default: the rate, rounded up)"`
+	Sources        map[string]float64 `yaml:"sources,omitempty" json:"sources,omitempty" doc:"maximum number of flows per second of specific sources, overriding flowsPerSecond (0 means unlimited)"`
+	KafkaHeader    string             `yaml:"kafkaHeader,omitempty" json:"kafkaHeader,omitempty" doc:"for the kafka ingester, the message header identifying the source (default: the message key)"`
+	MaxSources     int                `yaml:"maxSources,omitempty" json:"maxSources,omitempty" doc:"maximum number of sources tracked at once (default: 10000)"`
+}
+
+func (r *IngestRateLimit) SetDefaults() {
+	if r.MaxSources == 0 {
+		r.MaxSources = 10000
+	}
+}
+
+func (r *IngestRateLimit) Validate() error {
+	if r.FlowsPerSecond < 0 || r.Burst < 0 || r.MaxSources < 0 {
+		return fmt.Errorf("rate limit flowsPerSecond, burst and maxSources can't be negative")
+	}
+	for source, limit := range r.Sources {
+		if limit < 0 {
+			return fmt.Errorf("rate limit of source %s can't be negative", source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import "fmt"
+
+var DefaultSamplingFields = []string{"SrcAddr", "DstAddr", "SrcPort", "DstPort", "Proto"}
+
+type IngestSampling struct {
+	Rate   int      `yaml:"rate,omitempty" json:"rate,omitempty" doc:"1 flow out of <rate> is kept, and its Bytes and Packets are multiplied by <rate> (1 keeps all the flows)"`
+	Fields []string `yaml:"fields,omitempty" json:"fields,omitempty" doc:"fields hashed to decide whether a flow is kept; fields starting with Src are paired with their Dst counterpart so that both directions of a conversation get the same decision (default: SrcAddr, DstAddr, SrcPort, DstPort, Proto)"`
+}
+
+func (s *IngestSampling) SetDefaults() {
+	if s.Rate == 0 {
+		s.Rate = 1
+	}
+	if len(s.Fields) == 0 {
+		s.Fields = DefaultSamplingFields
+	}
+}
+
+func (s *IngestSampling) Validate() error {
+	if s.Rate < 1 {
+		return fmt.Errorf("sampling rate must be at least 1, got %d", s.Rate)
+	}
+	return nil
+}
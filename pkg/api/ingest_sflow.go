@@ -0,0 +1,25 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+type IngestSFlow struct {
+	HostName          string `yaml:"hostName,omitempty" json:"hostName,omitempty" doc:"the hostname to listen on"`
+	Port              int    `yaml:"port,omitempty" json:"port,omitempty" doc:"the port number to listen on, for sFlow v5"`
+	ForwardCounters   bool   `yaml:"forwardCounters,omitempty" json:"forwardCounters,omitempty" doc:"when true, interface counter samples are forwarded as records with _RecordType set to 'counters'; otherwise they are discarded (default)"`
+	ApplySamplingRate bool   `yaml:"applySamplingRate,omitempty" json:"applySamplingRate,omitempty" doc:"when true, the Bytes and Packets of flow samples are multiplied by their sampling rate, to estimate the actual traffic; otherwise they are forwarded as sampled (default)"`
+}
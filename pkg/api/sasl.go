@@ -1,9 +1,15 @@
 package api
 
+import (
+	"errors"
+	"fmt"
+)
+
 type SASLConfig struct {
 	Type             SASLTypeEnum `yaml:"type,omitempty" json:"type,omitempty" doc:"SASL type"`
+	Username         string       `yaml:"username,omitempty" json:"username,omitempty" doc:"SASL username, as an alternative to clientIDPath"`
 	ClientIDPath     string       `yaml:"clientIDPath,omitempty" json:"clientIDPath,omitempty" doc:"path to the client ID / SASL username"`
-	ClientSecretPath string       `yaml:"clientSecretPath,omitempty" json:"clientSecretPath,omitempty" doc:"path to the client secret / SASL password"`
+	ClientSecretPath string       `yaml:"clientSecretPath,omitempty" json:"clientSecretPath,omitempty" doc:"path to the client secret / SASL password, e.g. a mounted Kubernetes secret"`
 }
 
 type SASLTypeEnum string
@@ -11,5 +17,24 @@ type SASLTypeEnum string
 const (
 	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
 	SASLPlain       SASLTypeEnum = "plain"       // Plain SASL
+	SASLScramSHA256 SASLTypeEnum = "scramSHA256" // SCRAM/SHA256 SASL
 	SASLScramSHA512 SASLTypeEnum = "scramSHA512" // SCRAM/SHA512 SASL
 )
+
+func (s *SASLConfig) Validate() error {
+	switch s.Type {
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+	default:
+		return fmt.Errorf("unknown SASL type: %s", s.Type)
+	}
+	if s.Username == "" && s.ClientIDPath == "" {
+		return errors.New("SASL requires a username or a clientIDPath")
+	}
+	if s.Username != "" && s.ClientIDPath != "" {
+		return errors.New("SASL username and clientIDPath can't be both set")
+	}
+	if s.ClientSecretPath == "" {
+		return errors.New("SASL requires a clientSecretPath")
+	}
+	return nil
+}
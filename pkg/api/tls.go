@@ -21,6 +21,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"os"
 )
 
@@ -41,26 +42,59 @@ func (c *ClientTLS) Build() (*tls.Config, error) {
 			return nil, err
 		}
 		tlsConfig.RootCAs = x509.NewCertPool()
-		tlsConfig.RootCAs.AppendCertsFromPEM(caCert)
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %s", c.CACertPath)
+		}
+	}
+	// the user certificate may be set without CA, when the server certificate is signed by a system CA
+	if c.UserCertPath != "" && c.UserKeyPath != "" {
+		userCert, err := os.ReadFile(c.UserCertPath)
+		if err != nil {
+			return nil, err
+		}
+		userKey, err := os.ReadFile(c.UserKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		pair, err := tls.X509KeyPair(userCert, userKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	} else if c.UserCertPath != "" || c.UserKeyPath != "" {
+		return nil, errors.New("userCertPath and userKeyPath must be both present or both absent")
+	}
+	return tlsConfig, nil
+}
+
+type ServerTLS struct {
+	CertPath         string `yaml:"certPath,omitempty" json:"certPath,omitempty" doc:"path to the server certificate"`
+	KeyPath          string `yaml:"keyPath,omitempty" json:"keyPath,omitempty" doc:"path to the server private key"`
+	ClientCACertPath string `yaml:"clientCACertPath,omitempty" json:"clientCACertPath,omitempty" doc:"path to the CA certificate verifying the client certificates; when set, the clients must present a certificate (optional)"`
+}
 
-		if c.UserCertPath != "" && c.UserKeyPath != "" {
-			userCert, err := os.ReadFile(c.UserCertPath)
-			if err != nil {
-				return nil, err
-			}
-			userKey, err := os.ReadFile(c.UserKeyPath)
-			if err != nil {
-				return nil, err
-			}
-			pair, err := tls.X509KeyPair(userCert, userKey)
-			if err != nil {
-				return nil, err
-			}
-			tlsConfig.Certificates = []tls.Certificate{pair}
-		} else if c.UserCertPath != "" || c.UserKeyPath != "" {
-			return nil, errors.New("userCertPath and userKeyPath must be both present or both absent")
+func (s *ServerTLS) Build() (*tls.Config, error) {
+	if s.CertPath == "" || s.KeyPath == "" {
+		return nil, errors.New("certPath and keyPath must be both present")
+	}
+	pair, err := tls.LoadX509KeyPair(s.CertPath, s.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if s.ClientCACertPath != "" {
+		caCert, err := os.ReadFile(s.ClientCACertPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("no certificate found in clientCACertPath")
 		}
-		return tlsConfig, nil
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 	return tlsConfig, nil
 }
@@ -0,0 +1,23 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+type TransformBiflow struct {
+	Window     Duration `yaml:"window,omitempty" json:"window,omitempty" doc:"time to wait for the flow of the opposite direction; an unmatched flow is then forwarded as-is (default: 10s)"`
+	MaxPending int      `yaml:"maxPending,omitempty" json:"maxPending,omitempty" doc:"maximum number of flows waiting for the opposite direction; when exceeded, the oldest one is forwarded as-is (default: 100000)"`
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+type TransformDedupeHashEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	DedupeHashFNV    TransformDedupeHashEnum = "fnv"    // 64-bit FNV-1a (default)
+	DedupeHashXXHash TransformDedupeHashEnum = "xxhash" // 64-bit xxHash, faster on large keys
+)
+
+type TransformDedupeModeEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	DedupeKeepFirst TransformDedupeModeEnum = "keep_first" // forward the first flow of a window and drop its duplicates; with countField, the flow is forwarded when the window ends (default)
+	DedupeMerge     TransformDedupeModeEnum = "merge"      // hold the first flow of a window, add the mergeFields of its duplicates to it, and forward it when the window ends
+)
+
+type TransformDedupe struct {
+	Keys        []string                `yaml:"keys,omitempty" json:"keys,omitempty" doc:"list of fields identifying a flow: flows having the same values for all these fields are duplicates"`
+	Window      Duration                `yaml:"window,omitempty" json:"window,omitempty" doc:"time window, starting at the first flow of a fingerprint, during which its duplicates are dropped (default: 10s)"`
+	MaxEntries  int                     `yaml:"maxEntries,omitempty" json:"maxEntries,omitempty" doc:"maximum number of fingerprints kept; when exceeded, the least recently seen one is evicted (default: 100000)"`
+	Hash        TransformDedupeHashEnum `yaml:"hash,omitempty" json:"hash,omitempty" doc:"(enum) hash function used to compute fingerprints:"`
+	CountField  string                  `yaml:"countField,omitempty" json:"countField,omitempty" doc:"when set, output field holding the number of duplicates dropped, or merged in merge mode, during the window of the flow, which is then forwarded when its window ends (e.g. dedupe_count)"`
+	Mode        TransformDedupeModeEnum `yaml:"mode,omitempty" json:"mode,omitempty" doc:"(enum) what to do with duplicates:"`
+	MergeFields []string                `yaml:"mergeFields,omitempty" json:"mergeFields,omitempty" doc:"in merge mode, numeric fields summed over the duplicates (default: [Bytes, Packets])"`
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import "errors"
+
+type TransformExplode struct {
+	Outputs []ExplodeOutput `yaml:"outputs,omitempty" json:"outputs,omitempty" doc:"records emitted for each flow, in this order; each includes:"`
+}
+
+type ExplodeOutput struct {
+	When   string         `yaml:"when,omitempty" json:"when,omitempty" doc:"field that must be present in the flow for the record to be emitted (optional)"`
+	Remove []string       `yaml:"remove,omitempty" json:"remove,omitempty" doc:"fields of the flow removed from the record"`
+	Set    []ExplodeField `yaml:"set,omitempty" json:"set,omitempty" doc:"fields of the record set from a field of the flow or a fixed value; each includes:"`
+}
+
+type ExplodeField struct {
+	Output string `yaml:"output,omitempty" json:"output,omitempty" doc:"field of the record"`
+	Input  string `yaml:"input,omitempty" json:"input,omitempty" doc:"field of the flow copied to the output; when the flow doesn't have it, the output is removed from the record"`
+	Value  string `yaml:"value,omitempty" json:"value,omitempty" doc:"fixed value of the output, when input is not set"`
+}
+
+func (t *TransformExplode) Validate() error {
+	if len(t.Outputs) == 0 {
+		return errors.New("explode: at least one output must be provided")
+	}
+	for i := range t.Outputs {
+		for _, field := range t.Outputs[i].Set {
+			if field.Output == "" {
+				return errors.New("explode: the output of set fields must be provided")
+			}
+		}
+	}
+	return nil
+}
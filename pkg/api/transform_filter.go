@@ -45,6 +45,9 @@ const (
 	AddLabel                 TransformFilterEnum = "add_label"                    // add (input) field to list of labels with value taken from Value field (key=input, value=value)
 	AddLabelIf               TransformFilterEnum = "add_label_if"                 // add output field to list of labels with value taken from assignee field if input field satisfies criteria from parameters field
 	ConditionalSampling      TransformFilterEnum = "conditional_sampling"         // define conditional sampling rules
+	CIDRFilter               TransformFilterEnum = "cidr"                         // keeps the entry if the field is an IP belonging to one of the CIDRs, or removes it when keepMatching is false
+	KeepEntryExpression      TransformFilterEnum = "keep_entry_expression"        // keeps the entry if the boolean expression, combining keep_entry_* conditions with and / or / not, is satisfied
+	KeepEntryCEL             TransformFilterEnum = "cel"                          // keeps the entry if the CEL (Common Expression Language) boolean expression is satisfied
 )
 
 type TransformFilterRemoveEntryEnum string
@@ -59,12 +62,18 @@ const (
 type TransformFilterKeepEntryEnum string
 
 const (
-	KeepEntryIfExists        TransformFilterKeepEntryEnum = "keep_entry_if_exists"          // keeps the entry if the field exists
-	KeepEntryIfDoesntExist   TransformFilterKeepEntryEnum = "keep_entry_if_doesnt_exist"    // keeps the entry if the field does not exist
-	KeepEntryIfEqual         TransformFilterKeepEntryEnum = "keep_entry_if_equal"           // keeps the entry if the field value equals specified value
-	KeepEntryIfNotEqual      TransformFilterKeepEntryEnum = "keep_entry_if_not_equal"       // keeps the entry if the field value does not equal specified value
-	KeepEntryIfRegexMatch    TransformFilterKeepEntryEnum = "keep_entry_if_regex_match"     // keeps the entry if the field value matches the specified regex
-	KeepEntryIfNotRegexMatch TransformFilterKeepEntryEnum = "keep_entry_if_not_regex_match" // keeps the entry if the field value does not match the specified regex
+	KeepEntryIfExists        TransformFilterKeepEntryEnum = "keep_entry_if_exists"           // keeps the entry if the field exists
+	KeepEntryIfDoesntExist   TransformFilterKeepEntryEnum = "keep_entry_if_doesnt_exist"     // keeps the entry if the field does not exist
+	KeepEntryIfEqual         TransformFilterKeepEntryEnum = "keep_entry_if_equal"            // keeps the entry if the field value equals specified value
+	KeepEntryIfNotEqual      TransformFilterKeepEntryEnum = "keep_entry_if_not_equal"        // keeps the entry if the field value does not equal specified value
+	KeepEntryIfRegexMatch    TransformFilterKeepEntryEnum = "keep_entry_if_regex_match"      // keeps the entry if the field value matches the specified regex
+	KeepEntryIfNotRegexMatch TransformFilterKeepEntryEnum = "keep_entry_if_not_regex_match"  // keeps the entry if the field value does not match the specified regex
+	KeepEntryIfGreaterThan   TransformFilterKeepEntryEnum = "keep_entry_if_greater_than"     // keeps the entry if the field value is greater than the specified value
+	KeepEntryIfGreaterOrEq   TransformFilterKeepEntryEnum = "keep_entry_if_greater_or_equal" // keeps the entry if the field value is greater than or equal to the specified value
+	KeepEntryIfLessThan      TransformFilterKeepEntryEnum = "keep_entry_if_less_than"        // keeps the entry if the field value is less than the specified value
+	KeepEntryIfLessOrEq      TransformFilterKeepEntryEnum = "keep_entry_if_less_or_equal"    // keeps the entry if the field value is less than or equal to the specified value
+	KeepEntryIfIn            TransformFilterKeepEntryEnum = "keep_entry_if_in"               // keeps the entry if the field value equals one of the values from the specified list
+	KeepEntryIfNotIn         TransformFilterKeepEntryEnum = "keep_entry_if_not_in"           // keeps the entry if the field value does not equal any of the values from the specified list
 )
 
 type TransformFilterRule struct {
@@ -81,6 +90,9 @@ type TransformFilterRule struct {
 	AddLabel                *TransformFilterGenericRule      `yaml:"addLabel,omitempty" json:"addLabel,omitempty" doc:"configuration for add_label rule"`
 	AddLabelIf              *TransformFilterRuleWithAssignee `yaml:"addLabelIf,omitempty" json:"addLabelIf,omitempty" doc:"configuration for add_label_if rule"`
 	ConditionalSampling     []*SamplingCondition             `yaml:"conditionalSampling,omitempty" json:"conditionalSampling,omitempty" doc:"sampling configuration rules"`
+	CIDR                    *TransformFilterCIDRRule         `yaml:"cidr,omitempty" json:"cidr,omitempty" doc:"configuration for cidr rule"`
+	KeepEntryExpression     *FilterExpression                `yaml:"keepEntryExpression,omitempty" json:"keepEntryExpression,omitempty" doc:"configuration for keep_entry_expression rule; exactly one of the following must be set:"`
+	CEL                     *TransformFilterCELRule          `yaml:"cel,omitempty" json:"cel,omitempty" doc:"configuration for cel rule"`
 }
 
 func (r *TransformFilterRule) preprocess() {
@@ -99,6 +111,9 @@ func (r *TransformFilterRule) preprocess() {
 	for i := range r.ConditionalSampling {
 		r.ConditionalSampling[i].preprocess()
 	}
+	if r.KeepEntryExpression != nil {
+		r.KeepEntryExpression.preprocess()
+	}
 }
 
 type TransformFilterGenericRule struct {
@@ -122,6 +137,54 @@ type TransformFilterRuleWithAssignee struct {
 	Assignee   string `yaml:"assignee,omitempty" json:"assignee,omitempty" doc:"value needs to assign to output field"`
 }
 
+type TransformFilterCIDRRule struct {
+	Input        string   `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field, holding an IP address"`
+	CIDRs        []string `yaml:"cidrs,omitempty" json:"cidrs,omitempty" doc:"list of IPv4 and/or IPv6 CIDRs"`
+	KeepMatching *bool    `yaml:"keepMatching,omitempty" json:"keepMatching,omitempty" doc:"when true (default), entries matching one of the CIDRs are kept and others are removed; when false, matching entries are removed. Entries with a missing or invalid IP never match"`
+}
+
+type TransformFilterCELRule struct {
+	Expression string     `yaml:"expression,omitempty" json:"expression,omitempty" doc:"boolean CEL expression, referencing the flow fields as flow.<field> (e.g. flow.Proto == 6 && flow.DstPort < 1024)"`
+	Fields     []CELField `yaml:"fields,omitempty" json:"fields,omitempty" doc:"fields referenced by the expression that are not part of the default flow schema, or whose type differs"`
+}
+
+type CELField struct {
+	Name string           `yaml:"name,omitempty" json:"name,omitempty" doc:"field name"`
+	Type CELFieldTypeEnum `yaml:"type,omitempty" json:"type,omitempty" doc:"field type; one of: int, double, string, bool"`
+}
+
+type CELFieldTypeEnum string
+
+const (
+	CELInt    CELFieldTypeEnum = "int"
+	CELDouble CELFieldTypeEnum = "double"
+	CELString CELFieldTypeEnum = "string"
+	CELBool   CELFieldTypeEnum = "bool"
+)
+
+// FilterExpression is a node of a boolean expression tree, whose leaves are keep_entry_* conditions
+type FilterExpression struct {
+	And       []*FilterExpression `yaml:"and,omitempty" json:"and,omitempty" doc:"satisfied when all of the listed expressions are satisfied, evaluated in order"`
+	Or        []*FilterExpression `yaml:"or,omitempty" json:"or,omitempty" doc:"satisfied when at least one of the listed expressions is satisfied, evaluated in order"`
+	Not       *FilterExpression   `yaml:"not,omitempty" json:"not,omitempty" doc:"satisfied when the expression is not satisfied"`
+	Condition *KeepEntryRule      `yaml:"condition,omitempty" json:"condition,omitempty" doc:"satisfied when the keep_entry_* condition is satisfied"`
+}
+
+func (e *FilterExpression) preprocess() {
+	for _, sub := range e.And {
+		sub.preprocess()
+	}
+	for _, sub := range e.Or {
+		sub.preprocess()
+	}
+	if e.Not != nil {
+		e.Not.preprocess()
+	}
+	if e.Condition != nil && e.Condition.KeepEntry != nil {
+		e.Condition.KeepEntry.preprocess()
+	}
+}
+
 type RemoveEntryRule struct {
 	Type        TransformFilterRemoveEntryEnum `yaml:"type,omitempty" json:"type,omitempty" doc:"(enum) one of the following:"`
 	RemoveEntry *TransformFilterGenericRule    `yaml:"removeEntry,omitempty" json:"removeEntry,omitempty" doc:"configuration for remove_entry_* rules"`
@@ -31,9 +31,60 @@ const (
 )
 
 type GenericTransformRule struct {
-	Input      string `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field"`
-	Output     string `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field"`
-	Multiplier int    `yaml:"multiplier,omitempty" json:"multiplier,omitempty" doc:"scaling factor to compenstate for sampling"`
+	Input        string               `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field"`
+	Output       string               `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field"`
+	Multiplier   int                  `yaml:"multiplier,omitempty" json:"multiplier,omitempty" doc:"scaling factor to compenstate for sampling"`
+	Operation    GenericOperationEnum `yaml:"operation,omitempty" json:"operation,omitempty" doc:"(enum) arithmetic operation applied to the input field and the operand, the result being a float; one of the following:"`
+	Operand      float64              `yaml:"operand,omitempty" json:"operand,omitempty" doc:"constant operand of the arithmetic operation"`
+	OperandField string               `yaml:"operandField,omitempty" json:"operandField,omitempty" doc:"entry field holding the operand of the arithmetic operation; takes precedence over operand"`
+	Regex        string               `yaml:"regex,omitempty" json:"regex,omitempty" doc:"regular expression with named capture groups applied to the input field; each matched group sets the output field named after the group (the output field is not used)"`
+	Expression   string               `yaml:"expression,omitempty" json:"expression,omitempty" doc:"arithmetic expression of the math operation, made of field names, numbers, parentheses and the + - * / operators (e.g. (TimeFlowEndMs - TimeFlowStartMs) / 1000)"`
+	Fallback     float64              `yaml:"fallback,omitempty" json:"fallback,omitempty" doc:"result of the math operation when dividing by zero (default: 0)"`
+	TargetType   ConvertTypeEnum      `yaml:"targetType,omitempty" json:"targetType,omitempty" doc:"(enum) target type of the convert_type operation; one of the following:"`
+	OnError      string               `yaml:"onError,omitempty" json:"onError,omitempty" doc:"value of the convert_type operation output, converted to the target type, when the input can't be converted (default: the zero value of the target type); value of the json_extract operation output when the input isn't JSON or lacks the path (default: empty string)"`
+	Fields       []string             `yaml:"fields,omitempty" json:"fields,omitempty" doc:"fields updated in place by the sampling_normalize operation (default: [Bytes, Packets]) or by the normalize_timestamp operation (required)"`
+	Separator    string               `yaml:"separator,omitempty" json:"separator,omitempty" doc:"separator on which the split operation splits the input field"`
+	TargetFields []string             `yaml:"targetFields,omitempty" json:"targetFields,omitempty" doc:"fields set to the tokens of the split operation, in order"`
+	RemoveInput  bool                 `yaml:"removeInput,omitempty" json:"removeInput,omitempty" doc:"remove the input field once split (default: false)"`
+	Path         string               `yaml:"path,omitempty" json:"path,omitempty" doc:"JSON path of the value extracted by the json_extract operation, made of object keys and array indexes (e.g. $.metadata.labels[0] or $['app.kubernetes.io/name'])"`
+	InputFormat  TimestampFormatEnum  `yaml:"inputFormat,omitempty" json:"inputFormat,omitempty" doc:"(enum) format of the timestamps read by the normalize_timestamp operation; one of the following:"`
+	InvalidField string               `yaml:"invalidField,omitempty" json:"invalidField,omitempty" doc:"field set to true by the normalize_timestamp operation when a timestamp is invalid, which is then left unchanged (default: InvalidTimestamp)"`
 }
 
+type GenericOperationEnum string
+
+const (
+	OperationAdd       GenericOperationEnum = "add"                 // input + operand
+	OperationSubtract  GenericOperationEnum = "subtract"            // input - operand
+	OperationMultiply  GenericOperationEnum = "multiply"            // input * operand
+	OperationDivide    GenericOperationEnum = "divide"              // input / operand; no output is set when the operand is 0
+	OperationMath      GenericOperationEnum = "math"                // evaluates the expression; the input field and operand are not used
+	OperationConvert   GenericOperationEnum = "convert_type"        // converts the input field to the target type, in place unless the output field is set
+	OperationSampling  GenericOperationEnum = "sampling_normalize"  // multiplies the fields by the sampling rate read from operandField (default: SamplingRate); rates of 0 and 1 leave them unchanged
+	OperationSplit     GenericOperationEnum = "split"               // splits the input field on the separator into the target fields; extra tokens are discarded, and target fields without a token are set to an empty string
+	OperationTimestamp GenericOperationEnum = "normalize_timestamp" // converts the timestamp fields in place to milliseconds since the epoch, as int64
+	OperationJSON      GenericOperationEnum = "json_extract"        // parses the input field as JSON and sets the output field to the value at the path; objects and arrays are set as JSON strings
+)
+
+type ConvertTypeEnum string
+
+const (
+	ConvertInt64   ConvertTypeEnum = "int64"   // signed integer; floats must have no fractional part
+	ConvertUint64  ConvertTypeEnum = "uint64"  // unsigned integer; negative values can't be converted
+	ConvertFloat64 ConvertTypeEnum = "float64" // floating point number
+	ConvertBool    ConvertTypeEnum = "bool"    // boolean; numbers must be 0 or 1, strings one of those accepted by strconv.ParseBool
+	ConvertString  ConvertTypeEnum = "string"  // string
+)
+
+type TimestampFormatEnum string
+
+const (
+	TimestampAuto    TimestampFormatEnum = "auto"    // numbers are read in the unit matching their magnitude (seconds below 1e11, milliseconds below 1e14, microseconds below 1e17, nanoseconds above), and other strings as RFC3339 (default)
+	TimestampSeconds TimestampFormatEnum = "seconds" // number of seconds since the epoch, possibly fractional
+	TimestampMillis  TimestampFormatEnum = "millis"  // number of milliseconds since the epoch
+	TimestampMicros  TimestampFormatEnum = "micros"  // number of microseconds since the epoch
+	TimestampNanos   TimestampFormatEnum = "nanos"   // number of nanoseconds since the epoch
+	TimestampRFC3339 TimestampFormatEnum = "rfc3339" // RFC3339 string, such as 2024-05-21T09:36:12.5Z; leap seconds (:60) are read as the next second
+)
+
 type GenericTransform []GenericTransformRule
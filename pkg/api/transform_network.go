@@ -17,6 +17,13 @@
 
 package api
 
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
 type TransformNetwork struct {
 	Rules         NetworkTransformRules         `yaml:"rules" json:"rules" doc:"list of transform rules, each includes:"`
 	KubeConfig    NetworkTransformKubeConfig    `yaml:"kubeConfig,omitempty" json:"kubeConfig,omitempty" doc:"global configuration related to Kubernetes (optional)"`
@@ -46,6 +53,41 @@ type NetworkTransformKubeConfig struct {
 	ConfigPath        string             `yaml:"configPath,omitempty" json:"configPath,omitempty" doc:"path to kubeconfig file (optional)"`
 	SecondaryNetworks []SecondaryNetwork `yaml:"secondaryNetworks,omitempty" json:"secondaryNetworks,omitempty" doc:"configuration for secondary networks"`
 	ManagedCNI        []string           `yaml:"managedCNI,omitempty" json:"managedCNI,omitempty" doc:"a list of CNI (network plugins) to manage, for detecting additional interfaces. Currently supported: ovn"`
+	SyncTimeout       *Duration          `yaml:"syncTimeout,omitempty" json:"syncTimeout,omitempty" doc:"maximum time to wait for the initial synchronization of the Kubernetes caches, before failing (default: no timeout)"`
+	Context           string             `yaml:"context,omitempty" json:"context,omitempty" doc:"kubeconfig context to use (default: the current context)"`
+	Clusters          []KubeCluster      `yaml:"clusters,omitempty" json:"clusters,omitempty" doc:"clusters to look the flow addresses up in, in order; when set, the enriched flows get the name of the cluster"`
+}
+
+type KubeCluster struct {
+	Name       string `yaml:"name" json:"name" doc:"name of the cluster, set in the enriched flows"`
+	ConfigPath string `yaml:"configPath,omitempty" json:"configPath,omitempty" doc:"path to the kubeconfig file of the cluster (default: kubeConfig.configPath)"`
+	Context    string `yaml:"context,omitempty" json:"context,omitempty" doc:"kubeconfig context of the cluster (default: the current context)"`
+}
+
+// ForCluster returns the configuration of one of the clusters
+func (cfg *NetworkTransformKubeConfig) ForCluster(cluster *KubeCluster) NetworkTransformKubeConfig {
+	clusterCfg := *cfg
+	clusterCfg.Clusters = nil
+	if cluster.ConfigPath != "" {
+		clusterCfg.ConfigPath = cluster.ConfigPath
+	}
+	clusterCfg.Context = cluster.Context
+	return clusterCfg
+}
+
+func (cfg *NetworkTransformKubeConfig) Validate() error {
+	names := map[string]bool{}
+	for i := range cfg.Clusters {
+		name := cfg.Clusters[i].Name
+		if name == "" {
+			return errors.New("kubeConfig clusters must have a name")
+		}
+		if names[name] {
+			return fmt.Errorf("kubeConfig cluster %s is declared twice", name)
+		}
+		names[name] = true
+	}
+	return nil
 }
 
 type TransformNetworkOperationEnum string
@@ -60,6 +102,13 @@ const (
 	NetworkReinterpretDirection TransformNetworkOperationEnum = "reinterpret_direction" // reinterpret flow direction at the node level (instead of net interface), to ease the deduplication process
 	NetworkAddSubnetLabel       TransformNetworkOperationEnum = "add_subnet_label"      // categorize IPs based on known subnets configuration
 	NetworkDecodeTCPFlags       TransformNetworkOperationEnum = "decode_tcp_flags"      // decode bitwise TCP flags into a string
+	NetworkAddGeoIP             TransformNetworkOperationEnum = "add_geoip"             // add output country, ASN and city fields from input IP, using MaxMind databases
+	NetworkHash                 TransformNetworkOperationEnum = "hash"                  // replace the input field value with its HMAC-SHA256 hex digest, to pseudonymize IPs or MACs
+	NetworkDuration             TransformNetworkOperationEnum = "duration"              // compute the duration in milliseconds between two timestamp fields in seconds
+	NetworkPrefix               TransformNetworkOperationEnum = "network_prefix"        // replace the input IP with its enclosing network prefix, to reduce the cardinality of IP-keyed metrics
+	NetworkDNSReverse           TransformNetworkOperationEnum = "dns_reverse"           // add output hostname field from the PTR record of the input IP, looked up asynchronously
+	NetworkPortToService        TransformNetworkOperationEnum = "port_to_service"       // add output service name field from input port and protocol fields, using a bundled IANA service name registry
+	NetworkPolicyCheck          TransformNetworkOperationEnum = "netpol_check"          // add output field telling whether the Kubernetes NetworkPolicies allow the flow, from the add_kubernetes fields
 )
 
 type NetworkTransformRule struct {
@@ -71,6 +120,13 @@ type NetworkTransformRule struct {
 	AddSubnetLabel  *NetworkAddSubnetLabelRule    `yaml:"add_subnet_label,omitempty" json:"add_subnet_label,omitempty" doc:"Add subnet label rule configuration"`
 	AddService      *NetworkAddServiceRule        `yaml:"add_service,omitempty" json:"add_service,omitempty" doc:"Add service rule configuration"`
 	DecodeTCPFlags  *NetworkGenericRule           `yaml:"decode_tcp_flags,omitempty" json:"decode_tcp_flags,omitempty" doc:"Decode bitwise TCP flags into a string"`
+	AddGeoIP        *NetworkAddGeoIPRule          `yaml:"add_geoip,omitempty" json:"add_geoip,omitempty" doc:"Add GeoIP rule configuration"`
+	Hash            *NetworkHashRule              `yaml:"hash,omitempty" json:"hash,omitempty" doc:"Hash rule configuration"`
+	Duration        *NetworkDurationRule          `yaml:"duration,omitempty" json:"duration,omitempty" doc:"Duration rule configuration"`
+	NetworkPrefix   *NetworkPrefixRule            `yaml:"network_prefix,omitempty" json:"network_prefix,omitempty" doc:"Network prefix rule configuration"`
+	DNSReverse      *NetworkDNSReverseRule        `yaml:"dns_reverse,omitempty" json:"dns_reverse,omitempty" doc:"DNS reverse lookup rule configuration"`
+	PortToService   *NetworkPortToServiceRule     `yaml:"port_to_service,omitempty" json:"port_to_service,omitempty" doc:"Port to service rule configuration"`
+	NetpolCheck     *NetworkPolicyCheckRule       `yaml:"netpol_check,omitempty" json:"netpol_check,omitempty" doc:"NetworkPolicy check rule configuration"`
 }
 
 type K8sInfraRule struct {
@@ -86,14 +142,16 @@ type K8sReference struct {
 }
 
 type K8sRule struct {
-	IPField         string `yaml:"ipField,omitempty" json:"ipField,omitempty" doc:"entry IP input field"`
-	InterfacesField string `yaml:"interfacesField,omitempty" json:"interfacesField,omitempty" doc:"entry Interfaces input field"`
-	UDNsField       string `yaml:"udnsField,omitempty" json:"udnsField,omitempty" doc:"entry UDNs input field"`
-	MACField        string `yaml:"macField,omitempty" json:"macField,omitempty" doc:"entry MAC input field"`
-	Output          string `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field"`
-	Assignee        string `yaml:"assignee,omitempty" json:"assignee,omitempty" doc:"value needs to assign to output field"`
-	LabelsPrefix    string `yaml:"labels_prefix,omitempty" json:"labels_prefix,omitempty" doc:"labels prefix to use to copy input lables, if empty labels will not be copied"`
-	AddZone         bool   `yaml:"add_zone,omitempty" json:"add_zone,omitempty" doc:"if true the rule will add the zone"`
+	IPField               string `yaml:"ipField,omitempty" json:"ipField,omitempty" doc:"entry IP input field"`
+	InterfacesField       string `yaml:"interfacesField,omitempty" json:"interfacesField,omitempty" doc:"entry Interfaces input field"`
+	UDNsField             string `yaml:"udnsField,omitempty" json:"udnsField,omitempty" doc:"entry UDNs input field"`
+	MACField              string `yaml:"macField,omitempty" json:"macField,omitempty" doc:"entry MAC input field"`
+	PortField             string `yaml:"portField,omitempty" json:"portField,omitempty" doc:"entry port input field, used to resolve host-network pods when the IP belongs to a node (optional)"`
+	Output                string `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field"`
+	Assignee              string `yaml:"assignee,omitempty" json:"assignee,omitempty" doc:"value needs to assign to output field"`
+	LabelsPrefix          string `yaml:"labels_prefix,omitempty" json:"labels_prefix,omitempty" doc:"labels prefix to use to copy input lables, if empty labels will not be copied"`
+	NamespaceLabelsPrefix string `yaml:"namespace_labels_prefix,omitempty" json:"namespace_labels_prefix,omitempty" doc:"labels prefix to use to copy the labels of the object namespace, if empty namespace labels will not be copied"`
+	AddZone               bool   `yaml:"add_zone,omitempty" json:"add_zone,omitempty" doc:"if true the rule will add the zone"`
 }
 
 type SecondaryNetwork struct {
@@ -113,8 +171,9 @@ type NetworkAddSubnetRule struct {
 }
 
 type NetworkAddSubnetLabelRule struct {
-	Input  string `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field"`
-	Output string `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field"`
+	Input   string `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field"`
+	Output  string `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field"`
+	Default string `yaml:"default,omitempty" json:"default,omitempty" doc:"label of the IPs matching no subnet (optional, default: no label)"`
 }
 
 type NetworkAddServiceRule struct {
@@ -123,6 +182,182 @@ type NetworkAddServiceRule struct {
 	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty" doc:"entry protocol field"`
 }
 
+type NetworkPortToServiceRule struct {
+	Input     string                `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field, holding the port number"`
+	Protocol  string                `yaml:"protocol,omitempty" json:"protocol,omitempty" doc:"entry protocol field, holding the protocol number or name (optional: when unset, TCP, UDP then SCTP are looked up)"`
+	Output    string                `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field; unknown ports are written as unknown_<port>"`
+	Overrides []PortServiceOverride `yaml:"overrides,omitempty" json:"overrides,omitempty" doc:"site-specific service names, taking precedence over the registry"`
+}
+
+type PortServiceOverride struct {
+	Port     int    `yaml:"port,omitempty" json:"port,omitempty" doc:"port number"`
+	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty" doc:"protocol name: tcp, udp, sctp or dccp (optional, default: any protocol)"`
+	Service  string `yaml:"service,omitempty" json:"service,omitempty" doc:"service name"`
+}
+
+type NetworkAddGeoIPRule struct {
+	Input     string       `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field"`
+	Output    string       `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field prefix (optional, default: same as input)"`
+	DBPath    string       `yaml:"dbPath,omitempty" json:"dbPath,omitempty" doc:"path to a MaxMind .mmdb database providing country and city (e.g. GeoLite2-City)"`
+	ASNDBPath string       `yaml:"asnDbPath,omitempty" json:"asnDbPath,omitempty" doc:"path to a MaxMind .mmdb database providing ASN (e.g. GeoLite2-ASN) (optional)"`
+	Fields    *GeoIPFields `yaml:"fields,omitempty" json:"fields,omitempty" doc:"names of the output fields; only the named fields are generated (default: <output>_Country, <output>_City, <output>_Latitude, <output>_Longitude and <output>_ASN); includes:"`
+}
+
+type GeoIPFields struct {
+	Country   string `yaml:"country,omitempty" json:"country,omitempty" doc:"output field of the country ISO code"`
+	City      string `yaml:"city,omitempty" json:"city,omitempty" doc:"output field of the city name, in English"`
+	Latitude  string `yaml:"latitude,omitempty" json:"latitude,omitempty" doc:"output field of the latitude"`
+	Longitude string `yaml:"longitude,omitempty" json:"longitude,omitempty" doc:"output field of the longitude"`
+	ASN       string `yaml:"asn,omitempty" json:"asn,omitempty" doc:"output field of the autonomous system number"`
+}
+
+// OutputFields returns the names of the generated fields
+func (r *NetworkAddGeoIPRule) OutputFields() GeoIPFields {
+	if r.Fields != nil {
+		return *r.Fields
+	}
+	prefix := r.Output
+	if prefix == "" {
+		prefix = r.Input
+	}
+	return GeoIPFields{
+		Country:   prefix + "_Country",
+		City:      prefix + "_City",
+		Latitude:  prefix + "_Latitude",
+		Longitude: prefix + "_Longitude",
+		ASN:       prefix + "_ASN",
+	}
+}
+
+type NetworkHashRule struct {
+	Input    string `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field, whose value is replaced by its digest"`
+	KeyEnv   string `yaml:"keyEnv,omitempty" json:"keyEnv,omitempty" doc:"name of the environment variable holding the HMAC key"`
+	KeyFile  string `yaml:"keyFile,omitempty" json:"keyFile,omitempty" doc:"path to a file holding the HMAC key, such as a mounted Kubernetes secret"`
+	Truncate int    `yaml:"truncate,omitempty" json:"truncate,omitempty" doc:"number of hex characters of the digest to keep (optional, default: all 64)"`
+}
+
+type NetworkDurationRule struct {
+	Start  string `yaml:"start,omitempty" json:"start,omitempty" doc:"entry input field holding the start timestamp, in Unix seconds"`
+	End    string `yaml:"end,omitempty" json:"end,omitempty" doc:"entry input field holding the end timestamp, in Unix seconds"`
+	Output string `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field, holding the duration in milliseconds"`
+}
+
+type NetworkPrefixRule struct {
+	Input            string `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field, holding an IP"`
+	Output           string `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field, holding the prefix in CIDR notation (optional, default: same as input)"`
+	IPv4PrefixLength int    `yaml:"ipv4PrefixLength,omitempty" json:"ipv4PrefixLength,omitempty" doc:"prefix length for IPv4 addresses (default: 24)"`
+	IPv6PrefixLength int    `yaml:"ipv6PrefixLength,omitempty" json:"ipv6PrefixLength,omitempty" doc:"prefix length for IPv6 addresses (default: 48)"`
+}
+
+func (r *NetworkPrefixRule) SetDefaults() {
+	if r.Output == "" {
+		r.Output = r.Input
+	}
+	if r.IPv4PrefixLength == 0 {
+		r.IPv4PrefixLength = 24
+	}
+	if r.IPv6PrefixLength == 0 {
+		r.IPv6PrefixLength = 48
+	}
+}
+
+func (r *NetworkPrefixRule) Validate() error {
+	if r.Input == "" {
+		return errors.New("missing input")
+	}
+	if r.IPv4PrefixLength < 0 || r.IPv4PrefixLength > 32 {
+		return fmt.Errorf("ipv4PrefixLength must be between 1 and 32, got %d", r.IPv4PrefixLength)
+	}
+	if r.IPv6PrefixLength < 0 || r.IPv6PrefixLength > 128 {
+		return fmt.Errorf("ipv6PrefixLength must be between 1 and 128, got %d", r.IPv6PrefixLength)
+	}
+	return nil
+}
+
+type NetworkDNSReverseRule struct {
+	Input       string    `yaml:"input,omitempty" json:"input,omitempty" doc:"entry input field, holding an IP"`
+	Output      string    `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field, holding the hostname (optional, default: <input>_ReverseDNS)"`
+	Server      string    `yaml:"server,omitempty" json:"server,omitempty" doc:"address (host:port) of the DNS server to query (optional, default: the servers of /etc/resolv.conf)"`
+	TTL         *Duration `yaml:"ttl,omitempty" json:"ttl,omitempty" doc:"time to cache the results, overriding the TTL of the DNS records (optional)"`
+	NegativeTTL *Duration `yaml:"negativeTtl,omitempty" json:"negativeTtl,omitempty" doc:"time to cache the IPs without PTR record, overriding ttl and the SOA record of the DNS zone (optional)"`
+	CacheSize   int       `yaml:"cacheSize,omitempty" json:"cacheSize,omitempty" doc:"maximum number of cached IPs, the least recently used being evicted (default: 10000)"`
+	RateLimit   int       `yaml:"rateLimit,omitempty" json:"rateLimit,omitempty" doc:"maximum number of DNS queries per second (default: 100)"`
+	Timeout     *Duration `yaml:"timeout,omitempty" json:"timeout,omitempty" doc:"timeout of a DNS query (default: 2s)"`
+}
+
+func (r *NetworkDNSReverseRule) SetDefaults() {
+	if r.Output == "" {
+		r.Output = r.Input + "_ReverseDNS"
+	}
+	if r.CacheSize == 0 {
+		r.CacheSize = 10000
+	}
+	if r.RateLimit == 0 {
+		r.RateLimit = 100
+	}
+	if r.Timeout == nil {
+		r.Timeout = &Duration{Duration: 2 * time.Second}
+	}
+}
+
+func (r *NetworkDNSReverseRule) Validate() error {
+	if r.Input == "" {
+		return errors.New("missing input")
+	}
+	if r.CacheSize < 0 {
+		return fmt.Errorf("cacheSize must be positive, got %d", r.CacheSize)
+	}
+	if r.RateLimit < 0 {
+		return fmt.Errorf("rateLimit must be positive, got %d", r.RateLimit)
+	}
+	if r.TTL != nil && r.TTL.Duration <= 0 {
+		return fmt.Errorf("ttl must be positive, got %s", r.TTL.Duration)
+	}
+	if r.NegativeTTL != nil && r.NegativeTTL.Duration <= 0 {
+		return fmt.Errorf("negativeTtl must be positive, got %s", r.NegativeTTL.Duration)
+	}
+	if r.Server != "" {
+		if _, _, err := net.SplitHostPort(r.Server); err != nil {
+			return fmt.Errorf("invalid server %q: %w", r.Server, err)
+		}
+	}
+	return nil
+}
+
+type NetworkPolicyCheckRule struct {
+	SrcPrefix string `yaml:"srcPrefix,omitempty" json:"srcPrefix,omitempty" doc:"output prefix of the add_kubernetes rule of the source, holding the _Namespace, _Name and _Type fields (default: SrcK8S)"`
+	DstPrefix string `yaml:"dstPrefix,omitempty" json:"dstPrefix,omitempty" doc:"output prefix of the add_kubernetes rule of the destination (default: DstK8S)"`
+	SrcIP     string `yaml:"srcIP,omitempty" json:"srcIP,omitempty" doc:"entry input field holding the source IP, matched against ipBlock peers (default: SrcAddr)"`
+	DstIP     string `yaml:"dstIP,omitempty" json:"dstIP,omitempty" doc:"entry input field holding the destination IP, matched against ipBlock peers (default: DstAddr)"`
+	DstPort   string `yaml:"dstPort,omitempty" json:"dstPort,omitempty" doc:"entry input field holding the destination port (default: DstPort)"`
+	Protocol  string `yaml:"protocol,omitempty" json:"protocol,omitempty" doc:"entry input field holding the protocol number or name (default: Proto)"`
+	Output    string `yaml:"output,omitempty" json:"output,omitempty" doc:"entry output field, holding allowed, denied or unknown (default: NetworkPolicyAction)"`
+}
+
+func (r *NetworkPolicyCheckRule) SetDefaults() {
+	if r.SrcPrefix == "" {
+		r.SrcPrefix = "SrcK8S"
+	}
+	if r.DstPrefix == "" {
+		r.DstPrefix = "DstK8S"
+	}
+	if r.SrcIP == "" {
+		r.SrcIP = "SrcAddr"
+	}
+	if r.DstIP == "" {
+		r.DstIP = "DstAddr"
+	}
+	if r.DstPort == "" {
+		r.DstPort = "DstPort"
+	}
+	if r.Protocol == "" {
+		r.Protocol = "Proto"
+	}
+	if r.Output == "" {
+		r.Output = "NetworkPolicyAction"
+	}
+}
+
 type NetworkTransformDirectionInfo struct {
 	ReporterIPField    string `yaml:"reporterIPField,omitempty" json:"reporterIPField,omitempty" doc:"field providing the reporter (agent) host IP"`
 	SrcHostField       string `yaml:"srcHostField,omitempty" json:"srcHostField,omitempty" doc:"source host field"`
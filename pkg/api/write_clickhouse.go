@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var clickHouseIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type WriteClickHouse struct {
+	Addresses     []string          `yaml:"addresses,omitempty" json:"addresses,omitempty" doc:"addresses (host:port) of the ClickHouse servers, using the native protocol"`
+	Database      string            `yaml:"database,omitempty" json:"database,omitempty" doc:"database of the table (default: default)"`
+	Table         string            `yaml:"table,omitempty" json:"table,omitempty" doc:"table to insert the flows into; it is created from the columns when it does not exist (default: flows)"`
+	Username      string            `yaml:"username,omitempty" json:"username,omitempty" doc:"username to authenticate with"`
+	PasswordPath  string            `yaml:"passwordPath,omitempty" json:"passwordPath,omitempty" doc:"path to the file containing the password"`
+	TLS           *ClientTLS        `yaml:"tls,omitempty" json:"tls,omitempty" doc:"TLS client configuration (optional)"`
+	Columns       []ClickHouseField `yaml:"columns,omitempty" json:"columns,omitempty" doc:"flow fields written as table columns (default: the main flow fields)"`
+	BatchSize     int               `yaml:"batchSize,omitempty" json:"batchSize,omitempty" doc:"maximum number of flows in an insert (default: 10000)"`
+	FlushInterval *Duration         `yaml:"flushInterval,omitempty" json:"flushInterval,omitempty" doc:"maximum time to wait before inserting an incomplete batch (default: 5s)"`
+	MaxBacklog    int               `yaml:"maxBacklog,omitempty" json:"maxBacklog,omitempty" doc:"maximum number of batches waiting to be inserted, e.g. while ClickHouse is unavailable; further batches are dropped (default: 10)"`
+	MinBackoff    *Duration         `yaml:"minBackoff,omitempty" json:"minBackoff,omitempty" doc:"initial time to wait before retrying a failed insert, doubled on each retry (default: 1s)"`
+	MaxBackoff    *Duration         `yaml:"maxBackoff,omitempty" json:"maxBackoff,omitempty" doc:"maximum time to wait before retrying a failed insert (default: 1m)"`
+}
+
+type ClickHouseField struct {
+	Name string             `yaml:"name" json:"name" doc:"name of the flow field, also used as column name"`
+	Type ClickHouseTypeEnum `yaml:"type" json:"type" doc:"(enum) type of the column; missing fields are written with the type zero value:"`
+}
+
+type ClickHouseTypeEnum string
+
+const (
+	ClickHouseUInt8      ClickHouseTypeEnum = "UInt8"      // 8 bits unsigned integer
+	ClickHouseUInt16     ClickHouseTypeEnum = "UInt16"     // 16 bits unsigned integer
+	ClickHouseUInt32     ClickHouseTypeEnum = "UInt32"     // 32 bits unsigned integer, e.g. for ports
+	ClickHouseUInt64     ClickHouseTypeEnum = "UInt64"     // 64 bits unsigned integer, e.g. for bytes and packets
+	ClickHouseInt64      ClickHouseTypeEnum = "Int64"      // 64 bits signed integer
+	ClickHouseFloat64    ClickHouseTypeEnum = "Float64"    // floating point number
+	ClickHouseString     ClickHouseTypeEnum = "String"     // string
+	ClickHouseBool       ClickHouseTypeEnum = "Bool"       // boolean
+	ClickHouseIPv6       ClickHouseTypeEnum = "IPv6"       // IP address, IPv4 addresses being mapped to IPv6
+	ClickHouseDateTime   ClickHouseTypeEnum = "DateTime"   // timestamp from a field in seconds
+	ClickHouseDateTime64 ClickHouseTypeEnum = "DateTime64" // timestamp with milliseconds precision, from a field in milliseconds
+)
+
+// DefaultClickHouseColumns are the columns written when none is configured
+var DefaultClickHouseColumns = []ClickHouseField{
+	{Name: "TimeReceived", Type: ClickHouseDateTime},
+	{Name: "TimeFlowStartMs", Type: ClickHouseDateTime64},
+	{Name: "TimeFlowEndMs", Type: ClickHouseDateTime64},
+	{Name: "SrcAddr", Type: ClickHouseIPv6},
+	{Name: "DstAddr", Type: ClickHouseIPv6},
+	{Name: "SrcPort", Type: ClickHouseUInt32},
+	{Name: "DstPort", Type: ClickHouseUInt32},
+	{Name: "Proto", Type: ClickHouseUInt8},
+	{Name: "Etype", Type: ClickHouseUInt32},
+	{Name: "Flags", Type: ClickHouseUInt32},
+	{Name: "Bytes", Type: ClickHouseUInt64},
+	{Name: "Packets", Type: ClickHouseUInt64},
+	{Name: "SrcMac", Type: ClickHouseString},
+	{Name: "DstMac", Type: ClickHouseString},
+	{Name: "AgentIP", Type: ClickHouseIPv6},
+	{Name: "FlowDirection", Type: ClickHouseUInt8},
+	{Name: "SrcK8S_Name", Type: ClickHouseString},
+	{Name: "SrcK8S_Namespace", Type: ClickHouseString},
+	{Name: "SrcK8S_OwnerName", Type: ClickHouseString},
+	{Name: "SrcK8S_Type", Type: ClickHouseString},
+	{Name: "DstK8S_Name", Type: ClickHouseString},
+	{Name: "DstK8S_Namespace", Type: ClickHouseString},
+	{Name: "DstK8S_OwnerName", Type: ClickHouseString},
+	{Name: "DstK8S_Type", Type: ClickHouseString},
+	{Name: "K8S_FlowLayer", Type: ClickHouseString},
+}
+
+func (w *WriteClickHouse) SetDefaults() {
+	if w.Database == "" {
+		w.Database = "default"
+	}
+	if w.Table == "" {
+		w.Table = "flows"
+	}
+	if len(w.Columns) == 0 {
+		w.Columns = DefaultClickHouseColumns
+	}
+	if w.BatchSize == 0 {
+		w.BatchSize = 10000
+	}
+	if w.FlushInterval == nil {
+		w.FlushInterval = &Duration{Duration: 5 * time.Second}
+	}
+	if w.MaxBacklog == 0 {
+		w.MaxBacklog = 10
+	}
+	if w.MinBackoff == nil {
+		w.MinBackoff = &Duration{Duration: time.Second}
+	}
+	if w.MaxBackoff == nil {
+		w.MaxBackoff = &Duration{Duration: time.Minute}
+	}
+}
+
+func (w *WriteClickHouse) Validate() error {
+	if w == nil {
+		return errors.New("you must provide a configuration")
+	}
+	if len(w.Addresses) == 0 {
+		return errors.New("addresses can't be empty")
+	}
+	for _, name := range []string{w.Database, w.Table} {
+		if !clickHouseIdentifier.MatchString(name) {
+			return fmt.Errorf("invalid database or table name: %q", name)
+		}
+	}
+	for _, col := range w.Columns {
+		if !clickHouseIdentifier.MatchString(col.Name) {
+			return fmt.Errorf("invalid column name: %q", col.Name)
+		}
+		switch col.Type {
+		case ClickHouseUInt8, ClickHouseUInt16, ClickHouseUInt32, ClickHouseUInt64, ClickHouseInt64, ClickHouseFloat64,
+			ClickHouseString, ClickHouseBool, ClickHouseIPv6, ClickHouseDateTime, ClickHouseDateTime64:
+		default:
+			return fmt.Errorf("column %s: unknown type %q", col.Name, col.Type)
+		}
+	}
+	if w.BatchSize <= 0 {
+		return fmt.Errorf("invalid batchSize: %v. Required > 0", w.BatchSize)
+	}
+	if w.FlushInterval.Duration <= 0 {
+		return fmt.Errorf("invalid flushInterval: %v. Required > 0", w.FlushInterval.Duration)
+	}
+	if w.MaxBacklog <= 0 {
+		return fmt.Errorf("invalid maxBacklog: %v. Required > 0", w.MaxBacklog)
+	}
+	if w.MinBackoff.Duration <= 0 || w.MaxBackoff.Duration < w.MinBackoff.Duration {
+		return fmt.Errorf("invalid backoff: minBackoff (%v) must be > 0 and <= maxBackoff (%v)", w.MinBackoff.Duration, w.MaxBackoff.Duration)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	DLQReasonFieldName = "_dlq_reason"
+	DLQRawFieldName    = "_raw"
+)
+
+type DeadLetterQueue struct {
+	Retries     int                     `yaml:"retries,omitempty" json:"retries,omitempty" doc:"number of times a failed write is retried before sending the flow to the dead-letter queue (default: 0)"`
+	QueueLength int                     `yaml:"queueLength,omitempty" json:"queueLength,omitempty" doc:"maximum number of flows waiting to be written to the dead-letter queue; further flows are dropped (default: 1000)"`
+	Type        DeadLetterQueueTypeEnum `yaml:"type" json:"type" doc:"(enum) type of the dead-letter queue target; one of the following:"`
+	File        *DeadLetterQueueFile    `yaml:"file,omitempty" json:"file,omitempty" doc:"file target configuration"`
+	Kafka       *EncodeKafka            `yaml:"kafka,omitempty" json:"kafka,omitempty" doc:"kafka target configuration"`
+}
+
+type DeadLetterQueueTypeEnum string
+
+const (
+	// For doc generation, enum definitions must match format `Constant Type = "value" // doc`
+	DLQFile   DeadLetterQueueTypeEnum = "file"   // append flows as JSON lines to a local file
+	DLQStdout DeadLetterQueueTypeEnum = "stdout" // write flows as JSON lines to the standard output
+	DLQKafka  DeadLetterQueueTypeEnum = "kafka"  // write flows as JSON to a kafka topic
+)
+
+type DeadLetterQueueFile struct {
+	Path string `yaml:"path" json:"path" doc:"path of the file where flows are appended"`
+}
+
+func (d *DeadLetterQueue) Validate() error {
+	if d.Retries < 0 || d.QueueLength < 0 {
+		return errors.New("retries and queueLength can't be negative")
+	}
+	switch d.Type {
+	case DLQFile:
+		if d.File == nil || d.File.Path == "" {
+			return errors.New("file path must be provided for a file dead-letter queue")
+		}
+	case DLQStdout:
+	case DLQKafka:
+		if d.Kafka == nil {
+			return errors.New("kafka configuration must be provided for a kafka dead-letter queue")
+		}
+		return d.Kafka.Validate()
+	default:
+		return fmt.Errorf("unknown dead-letter queue type %q", d.Type)
+	}
+	return nil
+}
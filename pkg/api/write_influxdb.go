@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type WriteInfluxDB struct {
+	URL            string     `yaml:"url,omitempty" json:"url,omitempty" doc:"URL of the InfluxDB 2.x server (default: http://localhost:8086)"`
+	Org            string     `yaml:"org,omitempty" json:"org,omitempty" doc:"organization owning the bucket"`
+	Bucket         string     `yaml:"bucket,omitempty" json:"bucket,omitempty" doc:"bucket to write the flows into"`
+	TokenPath      string     `yaml:"tokenPath,omitempty" json:"tokenPath,omitempty" doc:"path to the file containing the API token"`
+	TLS            *ClientTLS `yaml:"tls,omitempty" json:"tls,omitempty" doc:"TLS client configuration (optional)"`
+	Measurement    string     `yaml:"measurement,omitempty" json:"measurement,omitempty" doc:"measurement of the points (default: flows)"`
+	Tags           []string   `yaml:"tags,omitempty" json:"tags,omitempty" doc:"flow fields written as tags, which are indexed: use low-cardinality fields (default: namespaces, owners and protocol)"`
+	Fields         []string   `yaml:"fields,omitempty" json:"fields,omitempty" doc:"flow fields written as fields, which are not indexed (default: Bytes and Packets)"`
+	TimestampField string     `yaml:"timestampField,omitempty" json:"timestampField,omitempty" doc:"flow field holding the point timestamp, in milliseconds; flows without it get the time they are written (default: TimeFlowEndMs)"`
+	BatchSize      int        `yaml:"batchSize,omitempty" json:"batchSize,omitempty" doc:"maximum number of flows in a write request (default: 5000)"`
+	FlushInterval  *Duration  `yaml:"flushInterval,omitempty" json:"flushInterval,omitempty" doc:"maximum time to wait before writing an incomplete batch (default: 5s)"`
+	MaxBacklog     int        `yaml:"maxBacklog,omitempty" json:"maxBacklog,omitempty" doc:"maximum number of batches waiting to be written, e.g. while InfluxDB is unavailable or over quota; further batches are dropped (default: 10)"`
+	MinBackoff     *Duration  `yaml:"minBackoff,omitempty" json:"minBackoff,omitempty" doc:"initial time to wait before retrying a failed write, doubled on each retry (default: 1s)"`
+	MaxBackoff     *Duration  `yaml:"maxBackoff,omitempty" json:"maxBackoff,omitempty" doc:"maximum time to wait before retrying a failed write (default: 1m)"`
+}
+
+// DefaultInfluxDBTags are the tags written when none is configured
+var DefaultInfluxDBTags = []string{"SrcK8S_Namespace", "SrcK8S_OwnerName", "DstK8S_Namespace", "DstK8S_OwnerName", "Proto"}
+
+// DefaultInfluxDBFields are the fields written when none is configured
+var DefaultInfluxDBFields = []string{"Bytes", "Packets"}
+
+func (w *WriteInfluxDB) SetDefaults() {
+	if w.URL == "" {
+		w.URL = "http://localhost:8086"
+	}
+	if w.Measurement == "" {
+		w.Measurement = "flows"
+	}
+	if len(w.Tags) == 0 {
+		w.Tags = DefaultInfluxDBTags
+	}
+	if len(w.Fields) == 0 {
+		w.Fields = DefaultInfluxDBFields
+	}
+	if w.TimestampField == "" {
+		w.TimestampField = "TimeFlowEndMs"
+	}
+	if w.BatchSize == 0 {
+		w.BatchSize = 5000
+	}
+	if w.FlushInterval == nil {
+		w.FlushInterval = &Duration{Duration: 5 * time.Second}
+	}
+	if w.MaxBacklog == 0 {
+		w.MaxBacklog = 10
+	}
+	if w.MinBackoff == nil {
+		w.MinBackoff = &Duration{Duration: time.Second}
+	}
+	if w.MaxBackoff == nil {
+		w.MaxBackoff = &Duration{Duration: time.Minute}
+	}
+}
+
+func (w *WriteInfluxDB) Validate() error {
+	if w == nil {
+		return errors.New("you must provide a configuration")
+	}
+	if w.Org == "" || w.Bucket == "" {
+		return errors.New("org and bucket can't be empty")
+	}
+	tags := map[string]bool{}
+	for _, tag := range w.Tags {
+		tags[tag] = true
+	}
+	for _, field := range w.Fields {
+		if tags[field] {
+			return fmt.Errorf("%s can't be both a tag and a field", field)
+		}
+	}
+	if w.BatchSize <= 0 {
+		return fmt.Errorf("invalid batchSize: %v. Required > 0", w.BatchSize)
+	}
+	if w.FlushInterval.Duration <= 0 {
+		return fmt.Errorf("invalid flushInterval: %v. Required > 0", w.FlushInterval.Duration)
+	}
+	if w.MaxBacklog <= 0 {
+		return fmt.Errorf("invalid maxBacklog: %v. Required > 0", w.MaxBacklog)
+	}
+	if w.MinBackoff.Duration <= 0 || w.MaxBackoff.Duration < w.MinBackoff.Duration {
+		return fmt.Errorf("invalid backoff: minBackoff (%v) must be > 0 and <= maxBackoff (%v)", w.MinBackoff.Duration, w.MaxBackoff.Duration)
+	}
+	return nil
+}
@@ -26,19 +26,21 @@ import (
 )
 
 type WriteLoki struct {
-	URL            string                       `yaml:"url,omitempty" json:"url,omitempty" doc:"the address of an existing Loki service to push the flows to"`
-	TenantID       string                       `yaml:"tenantID,omitempty" json:"tenantID,omitempty" doc:"identifies the tenant for the request"`
-	BatchWait      string                       `yaml:"batchWait,omitempty" json:"batchWait,omitempty" doc:"maximum amount of time to wait before sending a batch"`
-	BatchSize      int                          `yaml:"batchSize,omitempty" json:"batchSize,omitempty" doc:"maximum batch size (in bytes) of logs to accumulate before sending"`
-	Timeout        string                       `yaml:"timeout,omitempty" json:"timeout,omitempty" doc:"maximum time to wait for a server to respond to a request"`
-	MinBackoff     string                       `yaml:"minBackoff,omitempty" json:"minBackoff,omitempty" doc:"initial backoff time for client connection between retries"`
-	MaxBackoff     string                       `yaml:"maxBackoff,omitempty" json:"maxBackoff,omitempty" doc:"maximum backoff time for client connection between retries"`
-	MaxRetries     int                          `yaml:"maxRetries,omitempty" json:"maxRetries,omitempty" doc:"maximum number of retries for client connections"`
-	Labels         []string                     `yaml:"labels,omitempty" json:"labels,omitempty" doc:"map of record fields to be used as labels"`
-	StaticLabels   model.LabelSet               `yaml:"staticLabels,omitempty" json:"staticLabels,omitempty" doc:"map of common labels to set on each flow"`
-	IgnoreList     []string                     `yaml:"ignoreList,omitempty" json:"ignoreList,omitempty" doc:"map of record fields to be removed from the record"`
-	ClientConfig   *promConfig.HTTPClientConfig `yaml:"clientConfig,omitempty" json:"clientConfig,omitempty" doc:"clientConfig"`
-	TimestampLabel model.LabelName              `yaml:"timestampLabel,omitempty" json:"timestampLabel,omitempty" doc:"label to use for time indexing"`
+	URL                string                       `yaml:"url,omitempty" json:"url,omitempty" doc:"the address of an existing Loki service to push the flows to"`
+	TenantID           string                       `yaml:"tenantID,omitempty" json:"tenantID,omitempty" doc:"identifies the tenant for the request"`
+	BatchWait          string                       `yaml:"batchWait,omitempty" json:"batchWait,omitempty" doc:"maximum amount of time to wait before sending a batch"`
+	BatchSize          int                          `yaml:"batchSize,omitempty" json:"batchSize,omitempty" doc:"maximum batch size (in bytes) of logs to accumulate before sending"`
+	MaxBatchSizeBytes  int                          `yaml:"maxBatchSizeBytes,omitempty" json:"maxBatchSizeBytes,omitempty" doc:"maximum estimated size (in bytes) of a push request, labels included; larger entries are dropped (0 = no limit)"`
+	Timeout            string                       `yaml:"timeout,omitempty" json:"timeout,omitempty" doc:"maximum time to wait for a server to respond to a request"`
+	MinBackoff         string                       `yaml:"minBackoff,omitempty" json:"minBackoff,omitempty" doc:"initial backoff time for client connection between retries"`
+	MaxBackoff         string                       `yaml:"maxBackoff,omitempty" json:"maxBackoff,omitempty" doc:"maximum backoff time for client connection between retries"`
+	MaxRetries         int                          `yaml:"maxRetries,omitempty" json:"maxRetries,omitempty" doc:"maximum number of retries for client connections"`
+	Labels             []string                     `yaml:"labels,omitempty" json:"labels,omitempty" doc:"map of record fields to be used as labels"`
+	StructuredMetadata []string                     `yaml:"structuredMetadata,omitempty" json:"structuredMetadata,omitempty" doc:"record fields to send as structured metadata, stored with the log line without being indexed (requires Loki 3.x)"`
+	StaticLabels       model.LabelSet               `yaml:"staticLabels,omitempty" json:"staticLabels,omitempty" doc:"map of common labels to set on each flow"`
+	IgnoreList         []string                     `yaml:"ignoreList,omitempty" json:"ignoreList,omitempty" doc:"map of record fields to be removed from the record"`
+	ClientConfig       *promConfig.HTTPClientConfig `yaml:"clientConfig,omitempty" json:"clientConfig,omitempty" doc:"clientConfig"`
+	TimestampLabel     model.LabelName              `yaml:"timestampLabel,omitempty" json:"timestampLabel,omitempty" doc:"label to use for time indexing"`
 	// TimestampScale provides the scale in time of the units from the timestamp
 	// E.g. UNIX timescale is '1s' (one second) while other clock sources might have
 	// scales of '1ms' (one millisecond) or just '1' (one nanosecond)
@@ -86,5 +88,18 @@ func (w *WriteLoki) Validate() error {
 	if w.BatchSize <= 0 {
 		return fmt.Errorf("invalid batchSize: %v. Required > 0", w.BatchSize)
 	}
+	if w.MaxBatchSizeBytes < 0 {
+		return fmt.Errorf("invalid maxBatchSizeBytes: %v. Required >= 0", w.MaxBatchSizeBytes)
+	}
+	for _, field := range w.StructuredMetadata {
+		if !model.LabelName(field).IsValidLegacy() {
+			return fmt.Errorf("invalid structuredMetadata field: %q is not a valid Loki label name", field)
+		}
+		for _, label := range w.Labels {
+			if field == label {
+				return fmt.Errorf("invalid structuredMetadata field: %q is already a label", field)
+			}
+		}
+	}
 	return nil
 }
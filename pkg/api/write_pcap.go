@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+type WritePcap struct {
+	Directory        string   `yaml:"directory,omitempty" json:"directory,omitempty" doc:"directory where the PCAP files are written, created if needed"`
+	FilePrefix       string   `yaml:"filePrefix,omitempty" json:"filePrefix,omitempty" doc:"prefix of the file names, followed by the IP family and the creation time, e.g. flows-ipv4-20240102T150405.000Z.pcap (default: flows)"`
+	MaxFileSize      int64    `yaml:"maxFileSize,omitempty" json:"maxFileSize,omitempty" doc:"size in bytes after which a new file is started (default: 100MB)"`
+	RotationInterval Duration `yaml:"rotationInterval,omitempty" json:"rotationInterval,omitempty" doc:"age after which a new file is started, e.g. 1h; files are only rotated by size when not set"`
+}
+
+func (w *WritePcap) SetDefaults() {
+	if w.FilePrefix == "" {
+		w.FilePrefix = "flows"
+	}
+	if w.MaxFileSize == 0 {
+		w.MaxFileSize = 100 * 1024 * 1024
+	}
+}
+
+func (w *WritePcap) Validate() error {
+	if w == nil {
+		return errors.New("you must provide a configuration")
+	}
+	if w.Directory == "" {
+		return errors.New("directory can't be empty")
+	}
+	if w.MaxFileSize < 0 {
+		return fmt.Errorf("invalid maxFileSize: %v. Required > 0", w.MaxFileSize)
+	}
+	if w.RotationInterval.Duration < 0 {
+		return fmt.Errorf("invalid rotationInterval: %v. Required >= 0", w.RotationInterval.Duration)
+	}
+	return nil
+}
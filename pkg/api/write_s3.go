@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// minS3PartSize is the minimum size of the parts of an S3 multipart upload, except the last one
+const minS3PartSize = 5 * 1024 * 1024
+
+type WriteS3 struct {
+	Endpoint      string    `yaml:"endpoint,omitempty" json:"endpoint,omitempty" doc:"address of the S3 server, e.g. minio.minio.svc:9000 (default: s3.amazonaws.com)"`
+	Region        string    `yaml:"region,omitempty" json:"region,omitempty" doc:"region of the bucket; it is looked up when not set"`
+	Bucket        string    `yaml:"bucket,omitempty" json:"bucket,omitempty" doc:"bucket into which the objects are uploaded"`
+	Insecure      bool      `yaml:"insecure,omitempty" json:"insecure,omitempty" doc:"use http rather than https (default: false)"`
+	Prefix        string    `yaml:"prefix,omitempty" json:"prefix,omitempty" doc:"prefix of the object keys, followed by the date, e.g. flows/2024/01/02/20240102T150405.000Z-<instance id>-00000001.jsonl.gz (default: flows)"`
+	MaxObjectSize int64     `yaml:"maxObjectSize,omitempty" json:"maxObjectSize,omitempty" doc:"compressed size in bytes after which the object is uploaded (default: 64MB)"`
+	FlushInterval *Duration `yaml:"flushInterval,omitempty" json:"flushInterval,omitempty" doc:"maximum time to wait before uploading an incomplete object (default: 5m)"`
+	PartSize      int64     `yaml:"partSize,omitempty" json:"partSize,omitempty" doc:"size in bytes of the parts of the multipart uploads, used for the objects larger than this size; at least 5MB (default: 16MB)"`
+	MaxBacklog    int       `yaml:"maxBacklog,omitempty" json:"maxBacklog,omitempty" doc:"maximum number of objects waiting to be uploaded, e.g. while S3 is unavailable; the flows of further objects are dropped (default: 4)"`
+}
+
+func (w *WriteS3) SetDefaults() {
+	if w.Endpoint == "" {
+		w.Endpoint = "s3.amazonaws.com"
+	}
+	if w.Prefix == "" {
+		w.Prefix = "flows"
+	}
+	if w.MaxObjectSize == 0 {
+		w.MaxObjectSize = 64 * 1024 * 1024
+	}
+	if w.FlushInterval == nil {
+		w.FlushInterval = &Duration{Duration: 5 * time.Minute}
+	}
+	if w.PartSize == 0 {
+		w.PartSize = 16 * 1024 * 1024
+	}
+	if w.MaxBacklog == 0 {
+		w.MaxBacklog = 4
+	}
+}
+
+func (w *WriteS3) Validate() error {
+	if w == nil {
+		return errors.New("you must provide a configuration")
+	}
+	if w.Bucket == "" {
+		return errors.New("bucket can't be empty")
+	}
+	if w.MaxObjectSize < 0 {
+		return fmt.Errorf("invalid maxObjectSize: %v. Required > 0", w.MaxObjectSize)
+	}
+	if w.FlushInterval.Duration <= 0 {
+		return fmt.Errorf("invalid flushInterval: %v. Required > 0", w.FlushInterval.Duration)
+	}
+	if w.PartSize < minS3PartSize {
+		return fmt.Errorf("invalid partSize: %v. Required >= %d", w.PartSize, minS3PartSize)
+	}
+	if w.MaxBacklog < 0 {
+		return fmt.Errorf("invalid maxBacklog: %v. Required > 0", w.MaxBacklog)
+	}
+	return nil
+}
@@ -20,10 +20,12 @@ package config
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
 type Options struct {
@@ -31,7 +33,9 @@ type Options struct {
 	Parameters        string
 	DynamicParameters string
 	MetricsSettings   string
+	Telemetry         string
 	Health            Health
+	Admin             Admin
 	Profile           Profile
 }
 
@@ -45,6 +49,7 @@ type ConfigFileStruct struct {
 	Parameters        []StageParam      `yaml:"parameters,omitempty" json:"parameters,omitempty"`
 	PerfSettings      PerfSettings      `yaml:"perfSettings,omitempty" json:"perfSettings,omitempty"`
 	DynamicParameters DynamicParameters `yaml:"dynamicParameters,omitempty" json:"dynamicParameters,omitempty"`
+	Telemetry         *Telemetry        `yaml:"telemetry,omitempty" json:"telemetry,omitempty"`
 }
 
 type DynamicParameters struct {
@@ -63,6 +68,14 @@ type Health struct {
 	Port    string
 }
 
+// Admin configures the admin API server. It shares the health server when both have the same address and port.
+type Admin struct {
+	Address string
+	Port    string
+	// Token, when set, is the bearer token expected by the admin API; it is read from an environment variable
+	Token string `json:"-"`
+}
+
 type Profile struct {
 	Port int
 }
@@ -78,16 +91,82 @@ type MetricsSettings struct {
 	SuppressGoMetrics      bool   `yaml:"suppressGoMetrics,omitempty" json:"suppressGoMetrics,omitempty" doc:"filter out Go and process metrics"`
 }
 
+const (
+	// DefaultMetricsPort is the port of the metrics servers, when not set
+	DefaultMetricsPort = 9090
+	// DefaultTelemetryPort is the port of the telemetry server, when not set
+	DefaultTelemetryPort = 9091
+)
+
+// Telemetry enables the pipeline throughput and latency metrics, served on their own endpoint (default port 9091)
+type Telemetry struct {
+	api.PromConnectionInfo `yaml:",inline"`
+}
+
+// validate sets the default port, and checks that the telemetry server doesn't listen on the port of the global
+// metrics server
+func (t *Telemetry) validate(metrics *MetricsSettings) error {
+	if t.Port == 0 {
+		t.Port = DefaultTelemetryPort
+	}
+	if metrics.DisableGlobalServer {
+		return nil
+	}
+	metricsPort := metrics.Port
+	if metricsPort == 0 {
+		metricsPort = DefaultMetricsPort
+	}
+	if t.Port == metricsPort && (t.Address == metrics.Address || t.Address == "" || metrics.Address == "") {
+		return fmt.Errorf("telemetry port %d is already the metricsSettings port: set another port in the telemetry section", t.Port)
+	}
+	return nil
+}
+
 // PerfSettings allows setting some internal configuration parameters
 type PerfSettings struct {
 	BatcherMaxLen  int           `yaml:"batcherMaxLen,omitempty" json:"batcherMaxLen,omitempty"`
 	BatcherTimeout time.Duration `yaml:"batcherMaxTimeout,omitempty" json:"batcherMaxTimeout,omitempty"`
 	NodeBufferLen  int           `yaml:"nodeBufferLen,omitempty" json:"nodeBufferLen,omitempty"`
+	// Overflow is the default overflow policy of the stages
+	Overflow OverflowPolicy `yaml:"overflow,omitempty" json:"overflow,omitempty"`
+}
+
+// OverflowPolicy tells what a stage does with the flows it receives while its input channel, holding up to
+// nodeBufferLen flows, is full
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"       // wait for the stage to catch up, slowing down the previous stages (default)
+	OverflowDropOldest OverflowPolicy = "drop-oldest" // drop the oldest flow of the channel to make room for the received flow
+	OverflowDropNewest OverflowPolicy = "drop-newest" // drop the received flow
+)
+
+func (p OverflowPolicy) Validate() error {
+	switch p {
+	case "", OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+		return nil
+	}
+	return fmt.Errorf("unknown overflow policy %q, expected %s, %s or %s", p, OverflowBlock, OverflowDropOldest, OverflowDropNewest)
 }
 
 type Stage struct {
 	Name    string `yaml:"name" json:"name"`
 	Follows string `yaml:"follows,omitempty" json:"follows,omitempty"`
+	// FollowsList lists the stages that the stage receives flows from, when it merges the flows of several stages
+	FollowsList []string `yaml:"followsList,omitempty" json:"followsList,omitempty"`
+	// Workers is the number of goroutines processing the flows of a stateless transform stage (default: 1)
+	Workers int `yaml:"workers,omitempty" json:"workers,omitempty"`
+	// Overflow overrides the overflow policy of perfSettings for the stage
+	Overflow OverflowPolicy `yaml:"overflow,omitempty" json:"overflow,omitempty"`
+}
+
+// FollowedStages returns the stages that the stage receives flows from: the stage named by Follows, then the stages
+// of FollowsList
+func (s *Stage) FollowedStages() []string {
+	if s.Follows == "" {
+		return s.FollowsList
+	}
+	return append([]string{s.Follows}, s.FollowsList...)
 }
 
 type StageParam struct {
@@ -103,10 +182,13 @@ type Ingest struct {
 	Type      string               `yaml:"type" json:"type"`
 	File      *File                `yaml:"file,omitempty" json:"file,omitempty"`
 	Collector *api.IngestCollector `yaml:"collector,omitempty" json:"collector,omitempty"`
+	SFlow     *api.IngestSFlow     `yaml:"sflow,omitempty" json:"sflow,omitempty"`
 	Kafka     *api.IngestKafka     `yaml:"kafka,omitempty" json:"kafka,omitempty"`
 	GRPC      *api.IngestGRPCProto `yaml:"grpc,omitempty" json:"grpc,omitempty"`
 	Synthetic *api.IngestSynthetic `yaml:"synthetic,omitempty" json:"synthetic,omitempty"`
 	Stdin     *api.IngestStdin     `yaml:"stdin,omitempty" json:"stdin,omitempty"`
+	RateLimit *api.IngestRateLimit `yaml:"rateLimit,omitempty" json:"rateLimit,omitempty"`
+	Sampling  *api.IngestSampling  `yaml:"sampling,omitempty" json:"sampling,omitempty"`
 }
 
 type File struct {
@@ -121,6 +203,9 @@ type Transform struct {
 	Generic *api.TransformGeneric `yaml:"generic,omitempty" json:"generic,omitempty"`
 	Filter  *api.TransformFilter  `yaml:"filter,omitempty" json:"filter,omitempty"`
 	Network *api.TransformNetwork `yaml:"network,omitempty" json:"network,omitempty"`
+	Dedupe  *api.TransformDedupe  `yaml:"dedupe,omitempty" json:"dedupe,omitempty"`
+	Biflow  *api.TransformBiflow  `yaml:"biflow,omitempty" json:"biflow,omitempty"`
+	Explode *api.TransformExplode `yaml:"explode,omitempty" json:"explode,omitempty"`
 }
 
 type Extract struct {
@@ -135,17 +220,23 @@ type Encode struct {
 	Prom        *api.PromEncode        `yaml:"prom,omitempty" json:"prom,omitempty"`
 	Kafka       *api.EncodeKafka       `yaml:"kafka,omitempty" json:"kafka,omitempty"`
 	S3          *api.EncodeS3          `yaml:"s3,omitempty" json:"s3,omitempty"`
+	CSV         *api.EncodeCSV         `yaml:"csv,omitempty" json:"csv,omitempty"`
 	OtlpLogs    *api.EncodeOtlpLogs    `yaml:"otlplogs,omitempty" json:"otlplogs,omitempty"`
 	OtlpMetrics *api.EncodeOtlpMetrics `yaml:"otlpmetrics,omitempty" json:"otlpmetrics,omitempty"`
 	OtlpTraces  *api.EncodeOtlpTraces  `yaml:"otlptraces,omitempty" json:"otlptraces,omitempty"`
 }
 
 type Write struct {
-	Type   string           `yaml:"type" json:"type"`
-	Loki   *api.WriteLoki   `yaml:"loki,omitempty" json:"loki,omitempty"`
-	Stdout *api.WriteStdout `yaml:"stdout,omitempty" json:"stdout,omitempty"`
-	Ipfix  *api.WriteIpfix  `yaml:"ipfix,omitempty" json:"ipfix,omitempty"`
-	GRPC   *api.WriteGRPC   `yaml:"grpc,omitempty" json:"grpc,omitempty"`
+	Type            string               `yaml:"type" json:"type"`
+	Loki            *api.WriteLoki       `yaml:"loki,omitempty" json:"loki,omitempty"`
+	Stdout          *api.WriteStdout     `yaml:"stdout,omitempty" json:"stdout,omitempty"`
+	Ipfix           *api.WriteIpfix      `yaml:"ipfix,omitempty" json:"ipfix,omitempty"`
+	GRPC            *api.WriteGRPC       `yaml:"grpc,omitempty" json:"grpc,omitempty"`
+	ClickHouse      *api.WriteClickHouse `yaml:"clickhouse,omitempty" json:"clickhouse,omitempty"`
+	InfluxDB        *api.WriteInfluxDB   `yaml:"influxdb,omitempty" json:"influxdb,omitempty"`
+	Pcap            *api.WritePcap       `yaml:"pcap,omitempty" json:"pcap,omitempty"`
+	S3              *api.WriteS3         `yaml:"s3,omitempty" json:"s3,omitempty"`
+	DeadLetterQueue *api.DeadLetterQueue `yaml:"deadLetterQueue,omitempty" json:"deadLetterQueue,omitempty"`
 }
 
 // ParseConfig creates the internal unmarshalled representation from the Pipeline and Parameters json
@@ -187,9 +278,56 @@ func ParseConfig(opts *Options) (ConfigFileStruct, error) {
 		logrus.Infof("using default metrics settings")
 	}
 
+	if opts.Telemetry != "" {
+		err = JSONUnmarshalStrict([]byte(opts.Telemetry), &out.Telemetry)
+		if err != nil {
+			logrus.Errorf("error when parsing telemetry settings: %v", err)
+			return out, err
+		}
+		if out.Telemetry != nil {
+			if err = out.Telemetry.validate(&out.MetricsSettings); err != nil {
+				logrus.Errorf("error in telemetry settings: %v", err)
+				return out, err
+			}
+		}
+		logrus.Debugf("telemetry = %v ", out.Telemetry)
+	}
+
 	return out, nil
 }
 
+// ReadStageParams reads the stage parameters from the "parameters" field of a configuration file
+func ReadStageParams(path string) ([]StageParam, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("can't read config file: %w", err)
+	}
+	return stageParams(v)
+}
+
+// ParseStageParams reads the stage parameters from the "parameters" field of a YAML configuration
+func ParseStageParams(content []byte) ([]StageParam, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("can't read config: %w", err)
+	}
+	return stageParams(v)
+}
+
+func stageParams(v *viper.Viper) ([]StageParam, error) {
+	b, err := json.Marshal(v.Get("parameters"))
+	if err != nil {
+		return nil, err
+	}
+	var params []StageParam
+	if err := JSONUnmarshalStrict(b, &params); err != nil {
+		return nil, fmt.Errorf("can't parse config parameters: %w", err)
+	}
+	return params, nil
+}
+
 // JsonUnmarshalStrict is like Unmarshal except that any fields that are found
 // in the data that do not have corresponding struct members, or mapping
 // keys that are duplicates, will result in an error.
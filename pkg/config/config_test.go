@@ -78,3 +78,44 @@ func TestUnmarshalFromViper(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "netobserv", cfs.Parameters[0].Write.Loki.TenantID)
 }
+
+func TestFollows(t *testing.T) {
+	var stages []Stage
+	require.NoError(t, JSONUnmarshalStrict([]byte(`[{"name":"ingest1"},{"name":"decode","follows":"ingest1"},{"name":"merge","followsList":["ingest1","ingest2"]}]`), &stages))
+	assert.Equal(t, []Stage{
+		{Name: "ingest1"},
+		{Name: "decode", Follows: "ingest1"},
+		{Name: "merge", FollowsList: []string{"ingest1", "ingest2"}},
+	}, stages)
+	assert.Empty(t, stages[0].FollowedStages())
+	assert.Equal(t, []string{"ingest1"}, stages[1].FollowedStages())
+	assert.Equal(t, []string{"ingest1", "ingest2"}, stages[2].FollowedStages())
+
+	// both fields can be set
+	both := Stage{Name: "merge", Follows: "ingest1", FollowsList: []string{"ingest2"}}
+	assert.Equal(t, []string{"ingest1", "ingest2"}, both.FollowedStages())
+
+	b, err := yaml.Marshal(stages)
+	require.NoError(t, err)
+	var fromYAML []Stage
+	require.NoError(t, yaml.UnmarshalStrict(b, &fromYAML))
+	assert.Equal(t, stages, fromYAML)
+}
+
+func TestTelemetryPort(t *testing.T) {
+	cfs, err := ParseConfig(&Options{PipeLine: "[]", Parameters: "[]", Telemetry: `{}`})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTelemetryPort, cfs.Telemetry.Port)
+
+	// the telemetry server can't listen on the port of the metrics server
+	_, err = ParseConfig(&Options{PipeLine: "[]", Parameters: "[]", Telemetry: `{"port":9090}`})
+	require.ErrorContains(t, err, "telemetry port 9090")
+	_, err = ParseConfig(&Options{PipeLine: "[]", Parameters: "[]", MetricsSettings: `{"port":9091}`, Telemetry: `{}`})
+	require.ErrorContains(t, err, "telemetry port 9091")
+
+	// unless they listen on different addresses, or the metrics server is disabled
+	_, err = ParseConfig(&Options{PipeLine: "[]", Parameters: "[]", MetricsSettings: `{"address":"10.0.0.1"}`, Telemetry: `{"address":"127.0.0.1","port":9090}`})
+	require.NoError(t, err)
+	_, err = ParseConfig(&Options{PipeLine: "[]", Parameters: "[]", MetricsSettings: `{"disableGlobalServer":true}`, Telemetry: `{"port":9090}`})
+	require.NoError(t, err)
+}
@@ -55,6 +55,9 @@ func NewPipeline(name string, ingest *Ingest) (PipelineBuilderStage, error) {
 	if ingest.Collector != nil {
 		return NewCollectorPipeline(name, *ingest.Collector), nil
 	}
+	if ingest.SFlow != nil {
+		return NewSFlowPipeline(name, *ingest.SFlow), nil
+	}
 	if ingest.GRPC != nil {
 		return NewGRPCPipeline(name, *ingest.GRPC), nil
 	}
@@ -75,6 +78,17 @@ func NewCollectorPipeline(name string, ingest api.IngestCollector) PipelineBuild
 	return PipelineBuilderStage{pipeline: &p, lastStage: name}
 }
 
+// NewSFlowPipeline creates a new pipeline from an `IngestSFlow` initial stage (listening for sFlow v5)
+//
+//nolint:golint,gocritic
+func NewSFlowPipeline(name string, ingest api.IngestSFlow) PipelineBuilderStage {
+	p := pipeline{
+		stages: []Stage{{Name: name}},
+		config: []StageParam{NewSFlowParams(name, ingest)},
+	}
+	return PipelineBuilderStage{pipeline: &p, lastStage: name}
+}
+
 // NewGRPCPipeline creates a new pipeline from an `IngestGRPCProto` initial stage (listening for NetObserv's eBPF agent protobuf)
 //
 //nolint:golint,gocritic
@@ -112,6 +126,16 @@ func (b *PipelineBuilderStage) next(name string, param StageParam) PipelineBuild
 	return PipelineBuilderStage{pipeline: b.pipeline, lastStage: name}
 }
 
+// WithWorkers sets the number of goroutines processing the flows of the current stage, which must be a stateless transform
+func (b *PipelineBuilderStage) WithWorkers(workers int) PipelineBuilderStage {
+	for i := range b.pipeline.stages {
+		if b.pipeline.stages[i].Name == b.lastStage {
+			b.pipeline.stages[i].Workers = workers
+		}
+	}
+	return *b
+}
+
 // Aggregate chains the current stage with an aggregate stage and returns that new stage
 func (b *PipelineBuilderStage) Aggregate(name string, aggs api.Aggregates) PipelineBuilderStage {
 	return b.next(name, NewAggregateParams(name, aggs))
@@ -139,6 +163,21 @@ func (b *PipelineBuilderStage) TransformNetwork(name string, nw api.TransformNet
 	return b.next(name, NewTransformNetworkParams(name, nw))
 }
 
+// TransformDedupe chains the current stage with a TransformDedupe stage and returns that new stage
+func (b *PipelineBuilderStage) TransformDedupe(name string, dedupe api.TransformDedupe) PipelineBuilderStage {
+	return b.next(name, NewTransformDedupeParams(name, dedupe))
+}
+
+// TransformBiflow chains the current stage with a TransformBiflow stage and returns that new stage
+func (b *PipelineBuilderStage) TransformBiflow(name string, biflow api.TransformBiflow) PipelineBuilderStage {
+	return b.next(name, NewTransformBiflowParams(name, biflow))
+}
+
+// TransformExplode chains the current stage with a TransformExplode stage and returns that new stage
+func (b *PipelineBuilderStage) TransformExplode(name string, explode api.TransformExplode) PipelineBuilderStage {
+	return b.next(name, NewTransformExplodeParams(name, explode))
+}
+
 // ConnTrack chains the current stage with a ConnTrack stage and returns that new stage
 //
 //nolint:golint,gocritic
@@ -165,6 +204,11 @@ func (b *PipelineBuilderStage) EncodeS3(name string, s3 api.EncodeS3) PipelineBu
 	return b.next(name, NewEncodeS3Params(name, s3))
 }
 
+// EncodeCSV chains the current stage with an EncodeCSV stage (writing to a CSV file) and returns that new stage
+func (b *PipelineBuilderStage) EncodeCSV(name string, csv api.EncodeCSV) PipelineBuilderStage {
+	return b.next(name, NewEncodeCSVParams(name, csv))
+}
+
 // EncodeOtelLogs chains the current stage with an EncodeOtelLogs stage (writing logs to open telemetry) and returns that new stage
 //
 //nolint:golint,gocritic
@@ -203,6 +247,26 @@ func (b *PipelineBuilderStage) WriteIpfix(name string, ipfix api.WriteIpfix) Pip
 	return b.next(name, NewWriteIpfixParams(name, ipfix))
 }
 
+// WriteClickHouse chains the current stage with a WriteClickHouse stage and returns that new stage
+func (b *PipelineBuilderStage) WriteClickHouse(name string, clickHouse api.WriteClickHouse) PipelineBuilderStage {
+	return b.next(name, NewWriteClickHouseParams(name, clickHouse))
+}
+
+// WriteInfluxDB chains the current stage with a WriteInfluxDB stage and returns that new stage
+func (b *PipelineBuilderStage) WriteInfluxDB(name string, influxDB api.WriteInfluxDB) PipelineBuilderStage {
+	return b.next(name, NewWriteInfluxDBParams(name, influxDB))
+}
+
+// WritePcap chains the current stage with a WritePcap stage and returns that new stage
+func (b *PipelineBuilderStage) WritePcap(name string, pcap api.WritePcap) PipelineBuilderStage {
+	return b.next(name, NewWritePcapParams(name, pcap))
+}
+
+// WriteS3 chains the current stage with a WriteS3 stage and returns that new stage
+func (b *PipelineBuilderStage) WriteS3(name string, s3 api.WriteS3) PipelineBuilderStage {
+	return b.next(name, NewWriteS3Params(name, s3))
+}
+
 // GetStages returns the current pipeline stages. It can be called from any of the stages, they share the same pipeline reference.
 func (b *PipelineBuilderStage) GetStages() []Stage {
 	return b.pipeline.stages
@@ -25,6 +25,10 @@ func NewCollectorParams(name string, ingest api.IngestCollector) StageParam {
 	return StageParam{Name: name, Ingest: &Ingest{Type: api.CollectorType, Collector: &ingest}}
 }
 
+func NewSFlowParams(name string, ingest api.IngestSFlow) StageParam {
+	return StageParam{Name: name, Ingest: &Ingest{Type: api.SFlowType, SFlow: &ingest}}
+}
+
 func NewGRPCParams(name string, ingest api.IngestGRPCProto) StageParam {
 	return StageParam{Name: name, Ingest: &Ingest{Type: api.GRPCType, GRPC: &ingest}}
 }
@@ -51,6 +55,18 @@ func NewTransformNetworkParams(name string, nw api.TransformNetwork) StageParam
 	return StageParam{Name: name, Transform: &Transform{Type: api.NetworkType, Network: &nw}}
 }
 
+func NewTransformDedupeParams(name string, dedupe api.TransformDedupe) StageParam {
+	return StageParam{Name: name, Transform: &Transform{Type: api.DedupeType, Dedupe: &dedupe}}
+}
+
+func NewTransformExplodeParams(name string, explode api.TransformExplode) StageParam {
+	return StageParam{Name: name, Transform: &Transform{Type: api.ExplodeType, Explode: &explode}}
+}
+
+func NewTransformBiflowParams(name string, biflow api.TransformBiflow) StageParam {
+	return StageParam{Name: name, Transform: &Transform{Type: api.BiflowType, Biflow: &biflow}}
+}
+
 //nolint:golint,gocritic
 func NewConnTrackParams(name string, ct api.ConnTrack) StageParam {
 	return StageParam{Name: name, Extract: &Extract{Type: api.ConnTrackType, ConnTrack: &ct}}
@@ -74,6 +90,10 @@ func NewEncodeS3Params(name string, s3 api.EncodeS3) StageParam {
 	return StageParam{Name: name, Encode: &Encode{Type: api.S3Type, S3: &s3}}
 }
 
+func NewEncodeCSVParams(name string, csv api.EncodeCSV) StageParam {
+	return StageParam{Name: name, Encode: &Encode{Type: api.CSVType, CSV: &csv}}
+}
+
 //nolint:golint,gocritic
 func NewEncodeOtelLogsParams(name string, otelLogs api.EncodeOtlpLogs) StageParam {
 	return StageParam{Name: name, Encode: &Encode{Type: api.OtlpLogsType, OtlpLogs: &otelLogs}}
@@ -101,3 +121,19 @@ func NewWriteLokiParams(name string, loki api.WriteLoki) StageParam {
 func NewWriteIpfixParams(name string, ipfix api.WriteIpfix) StageParam {
 	return StageParam{Name: name, Write: &Write{Type: api.IpfixType, Ipfix: &ipfix}}
 }
+
+func NewWriteClickHouseParams(name string, clickHouse api.WriteClickHouse) StageParam {
+	return StageParam{Name: name, Write: &Write{Type: api.ClickHouseType, ClickHouse: &clickHouse}}
+}
+
+func NewWriteInfluxDBParams(name string, influxDB api.WriteInfluxDB) StageParam {
+	return StageParam{Name: name, Write: &Write{Type: api.InfluxDBType, InfluxDB: &influxDB}}
+}
+
+func NewWritePcapParams(name string, pcap api.WritePcap) StageParam {
+	return StageParam{Name: name, Write: &Write{Type: api.PcapType, Pcap: &pcap}}
+}
+
+func NewWriteS3Params(name string, s3 api.WriteS3) StageParam {
+	return StageParam{Name: name, Write: &Write{Type: api.S3Type, S3: &s3}}
+}
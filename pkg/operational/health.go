@@ -18,24 +18,61 @@
 package operational
 
 import (
+	"context"
+	"errors"
 	"net"
 	"net/http"
 	"time"
 
 	"github.com/heptiolabs/healthcheck"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	"github.com/netobserv/flowlogs-pipeline/pkg/server"
 	log "github.com/sirupsen/logrus"
 )
 
-func NewHealthServer(opts *config.Options, isAlive healthcheck.Check, isReady healthcheck.Check) *http.Server {
-	handler := healthcheck.NewHandler()
+const adminShutdownTimeout = 5 * time.Second
+
+// ReadinessContributor is implemented by the pipeline components depending on an external system, such as a Kafka
+// ingester or a Loki writer: Ready returns an error while they can't reach it. Unlike liveness failures, which get the
+// process restarted, readiness failures only report the pipeline as unable to process its flows for now.
+type ReadinessContributor interface {
+	Ready() error
+}
+
+// Health gathers the liveness and readiness checks of the pipeline and of its components. The readiness probe
+// (/ready) fails when any check fails, liveness ones included, while the liveness probe (/live) only runs the
+// liveness checks. Appending ?full=1 to the probes lists the result of each check.
+type Health struct {
+	handler healthcheck.Handler
+}
+
+func NewHealth() *Health {
+	return &Health{handler: healthcheck.NewHandler()}
+}
+
+// AddLivenessCheck adds a check that fails when the process can't recover without a restart, e.g. when deadlocked
+func (h *Health) AddLivenessCheck(name string, check healthcheck.Check) {
+	h.handler.AddLivenessCheck(name, check)
+}
+
+// AddReadinessCheck adds a check that fails while a component can't process flows, e.g. when its source or sink is
+// unreachable
+func (h *Health) AddReadinessCheck(name string, check healthcheck.Check) {
+	h.handler.AddReadinessCheck(name, check)
+}
+
+// NewHealthServer starts the health server. The admin API, if provided, is served under apiPrefix on the same server.
+func NewHealthServer(opts *config.Options, health *Health, apiPrefix string, api http.Handler) *http.Server {
 	address := net.JoinHostPort(opts.Health.Address, opts.Health.Port)
-	handler.AddLivenessCheck("PipelineCheck", isAlive)
-	handler.AddReadinessCheck("PipelineCheck", isReady)
 
+	mux := http.NewServeMux()
+	mux.Handle("/", health.handler)
+	if api != nil {
+		mux.Handle(apiPrefix, api)
+	}
 	server := server.Default(&http.Server{
-		Handler: handler,
+		Handler: mux,
 		Addr:    address,
 	})
 
@@ -49,3 +86,24 @@ func NewHealthServer(opts *config.Options, isAlive healthcheck.Check, isReady he
 
 	return server
 }
+
+// NewAdminServer starts the admin API server on its own address, and shuts it down when the pipeline exits
+func NewAdminServer(opts *config.Options, api http.Handler) *http.Server {
+	server := server.Default(&http.Server{
+		Handler: api,
+		Addr:    net.JoinHostPort(opts.Admin.Address, opts.Admin.Port),
+	})
+	go func() {
+		log.WithField("address", server.Addr).Info("starting admin API server")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.WithError(err).Error("admin API server stopped working")
+		}
+	}()
+	go func() {
+		<-utils.ExitChannel()
+		ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+	return server
+}
@@ -74,6 +74,12 @@ var (
 		TypeGauge,
 		"stage",
 	)
+	stageDroppedFlows = DefineMetric(
+		"stage_dropped_flows_total",
+		"Number of flows dropped by a pipeline stage with a drop overflow policy, as its input queue was full",
+		TypeCounter,
+		"stage",
+	)
 	stageDuration = DefineMetric(
 		"stage_duration_ms",
 		"Pipeline stage duration in milliseconds",
@@ -111,18 +117,31 @@ func verifyMetricType(def *MetricDefinition, t metricType) {
 type Metrics struct {
 	settings           *config.MetricsSettings
 	stageDurationHisto *prometheus.HistogramVec
+	reuseRegistered    bool
 }
 
 func NewMetrics(settings *config.MetricsSettings) *Metrics {
 	return &Metrics{settings: settings}
 }
 
-// register will register against the default registry. May panic or not depending on settings
-func (o *Metrics) register(c prometheus.Collector, name string) {
+// ForReload returns metrics for the stages rebuilt on a configuration reload: the collectors that the replaced
+// stages registered are reused instead of being reported as duplicates, so that they keep being exported.
+func (o *Metrics) ForReload() *Metrics {
+	reloaded := *o
+	reloaded.reuseRegistered = true
+	return &reloaded
+}
+
+// register will register against the default registry. May panic or not depending on settings.
+// It returns the registered collector, which is the existing one when reusing registered collectors.
+func (o *Metrics) register(c prometheus.Collector, name string) prometheus.Collector {
 	err := prometheus.DefaultRegisterer.Register(c)
 	if err != nil {
 		var castErr prometheus.AlreadyRegisteredError
 		if errors.As(err, &castErr) {
+			if o.reuseRegistered {
+				return castErr.ExistingCollector
+			}
 			logrus.Warningf("metrics registration error [%s]: %v", name, err)
 		} else if o.settings.NoPanic {
 			logrus.Errorf("metrics registration error [%s]: %v", name, err)
@@ -130,6 +149,15 @@ func (o *Metrics) register(c prometheus.Collector, name string) {
 			logrus.Panicf("metrics registration error [%s]: %v", name, err)
 		}
 	}
+	return c
+}
+
+// registerOrReuse registers c, and returns either c or the registered collector that it reuses
+func registerOrReuse[C prometheus.Collector](o *Metrics, c C, name string) C {
+	if registered, ok := o.register(c, name).(C); ok {
+		return registered
+	}
+	return c
 }
 
 func (o *Metrics) NewCounter(def *MetricDefinition, labels ...string) prometheus.Counter {
@@ -140,8 +168,7 @@ func (o *Metrics) NewCounter(def *MetricDefinition, labels ...string) prometheus
 		Help:        def.Help,
 		ConstLabels: def.mapLabels(labels),
 	})
-	o.register(c, fullName)
-	return c
+	return registerOrReuse(o, c, fullName)
 }
 
 func (o *Metrics) NewCounterVec(def *MetricDefinition) *prometheus.CounterVec {
@@ -151,8 +178,7 @@ func (o *Metrics) NewCounterVec(def *MetricDefinition) *prometheus.CounterVec {
 		Name: fullName,
 		Help: def.Help,
 	}, def.Labels)
-	o.register(c, fullName)
-	return c
+	return registerOrReuse(o, c, fullName)
 }
 
 func (o *Metrics) NewGauge(def *MetricDefinition, labels ...string) prometheus.Gauge {
@@ -163,8 +189,7 @@ func (o *Metrics) NewGauge(def *MetricDefinition, labels ...string) prometheus.G
 		Help:        def.Help,
 		ConstLabels: def.mapLabels(labels),
 	})
-	o.register(c, fullName)
-	return c
+	return registerOrReuse(o, c, fullName)
 }
 
 func (o *Metrics) NewGaugeVec(def *MetricDefinition) *prometheus.GaugeVec {
@@ -174,8 +199,7 @@ func (o *Metrics) NewGaugeVec(def *MetricDefinition) *prometheus.GaugeVec {
 		Name: fullName,
 		Help: def.Help,
 	}, def.Labels)
-	o.register(c, fullName)
-	return c
+	return registerOrReuse(o, c, fullName)
 }
 
 func (o *Metrics) NewGaugeFunc(def *MetricDefinition, f func() float64, labels ...string) {
@@ -186,7 +210,11 @@ func (o *Metrics) NewGaugeFunc(def *MetricDefinition, f func() float64, labels .
 		Help:        def.Help,
 		ConstLabels: def.mapLabels(labels),
 	}, f)
-	o.register(c, fullName)
+	// the function of a replaced stage is replaced as well, rather than reused
+	if registered := o.register(c, fullName); registered != c {
+		prometheus.DefaultRegisterer.Unregister(registered)
+		o.register(c, fullName)
+	}
 }
 
 func (o *Metrics) NewHistogram(def *MetricDefinition, buckets []float64, labels ...string) prometheus.Histogram {
@@ -198,8 +226,7 @@ func (o *Metrics) NewHistogram(def *MetricDefinition, buckets []float64, labels
 		Buckets:     buckets,
 		ConstLabels: def.mapLabels(labels),
 	})
-	o.register(c, fullName)
-	return c
+	return registerOrReuse(o, c, fullName)
 }
 
 func (o *Metrics) NewHistogramVec(def *MetricDefinition, buckets []float64) *prometheus.HistogramVec {
@@ -210,8 +237,7 @@ func (o *Metrics) NewHistogramVec(def *MetricDefinition, buckets []float64) *pro
 		Help:    def.Help,
 		Buckets: buckets,
 	}, def.Labels)
-	o.register(c, fullName)
-	return c
+	return registerOrReuse(o, c, fullName)
 }
 
 func (o *Metrics) NewSummary(def *MetricDefinition, labels ...string) prometheus.Summary {
@@ -227,8 +253,7 @@ func (o *Metrics) NewSummary(def *MetricDefinition, labels ...string) prometheus
 			0.95: 0.01,
 		},
 	})
-	o.register(c, fullName)
-	return c
+	return registerOrReuse(o, c, fullName)
 }
 
 func (o *Metrics) CreateRecordsWrittenCounter(stage string) prometheus.Counter {
@@ -243,6 +268,10 @@ func (o *Metrics) CreateOutQueueSizeGauge(stage string, f func() int) {
 	o.NewGaugeFunc(&stageOutQueueSize, func() float64 { return float64(f()) }, stage)
 }
 
+func (o *Metrics) CreateDroppedFlowsCounter(stage string) prometheus.Counter {
+	return o.NewCounter(&stageDroppedFlows, stage)
+}
+
 func (o *Metrics) GetOrCreateStageDurationHisto() *prometheus.HistogramVec {
 	if o.stageDurationHisto == nil {
 		o.stageDurationHisto = o.NewHistogramVec(&stageDuration, []float64{.001, .01, .1, 1, 10, 100, 1000, 10000})
@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package operational
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	flowsProcessed = DefineMetric(
+		"flows_processed_total",
+		"Number of flows processed per pipeline stage (telemetry endpoint)",
+		TypeCounter,
+		"stage", "type",
+	)
+	processingDuration = DefineMetric(
+		"processing_duration_seconds",
+		"Pipeline stage processing duration in seconds, per flow or per batch for extract stages (telemetry endpoint)",
+		TypeHistogram,
+		"stage", "type",
+	)
+	channelDepth = DefineMetric(
+		"channel_depth",
+		"Number of flows buffered in the pipeline stage input channel (telemetry endpoint)",
+		TypeGauge,
+		"stage", "type",
+	)
+	stageErrors = DefineMetric(
+		"errors_total",
+		"Number of flows that the pipeline stage failed to process (telemetry endpoint)",
+		TypeCounter,
+		"stage", "type",
+	)
+
+	processingDurationBuckets = []float64{.00001, .0001, .001, .01, .1, 1, 10}
+)
+
+// PipelineMetrics instruments the pipeline stages with throughput and latency metrics.
+// They are kept in their own registry, to be served on the telemetry endpoint.
+type PipelineMetrics struct {
+	Registry  *prometheus.Registry
+	processed *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+}
+
+func NewPipelineMetrics() *PipelineMetrics {
+	pm := &PipelineMetrics{
+		Registry: prometheus.NewRegistry(),
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: flowsProcessed.Name,
+			Help: flowsProcessed.Help,
+		}, flowsProcessed.Labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    processingDuration.Name,
+			Help:    processingDuration.Help,
+			Buckets: processingDurationBuckets,
+		}, processingDuration.Labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: stageErrors.Name,
+			Help: stageErrors.Help,
+		}, stageErrors.Labels),
+	}
+	pm.Registry.MustRegister(pm.processed, pm.duration, pm.errors)
+	return pm
+}
+
+// StageMetrics are the pipeline metrics of a stage, resolved once so that recording them doesn't allocate.
+// A nil StageMetrics, used when telemetry is disabled, records nothing.
+type StageMetrics struct {
+	processed prometheus.Counter
+	duration  prometheus.Observer
+	errors    prometheus.Counter
+}
+
+// ForStage returns the metrics of a stage; depth, if provided, reports the number of flows in the stage input channel
+func (pm *PipelineMetrics) ForStage(stage, stageType string, depth func() int) *StageMetrics {
+	if pm == nil {
+		return nil
+	}
+	if depth != nil {
+		pm.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        channelDepth.Name,
+			Help:        channelDepth.Help,
+			ConstLabels: channelDepth.mapLabels([]string{stage, stageType}),
+		}, func() float64 { return float64(depth()) }))
+	}
+	return &StageMetrics{
+		processed: pm.processed.WithLabelValues(stage, stageType),
+		duration:  pm.duration.WithLabelValues(stage, stageType),
+		errors:    pm.errors.WithLabelValues(stage, stageType),
+	}
+}
+
+// Processed counts flows that went through the stage
+func (sm *StageMetrics) Processed(flows int) {
+	if sm != nil {
+		sm.processed.Add(float64(flows))
+	}
+}
+
+// Observe records the processing duration of a flow, or of a batch of flows
+func (sm *StageMetrics) Observe(duration time.Duration) {
+	if sm != nil {
+		sm.duration.Observe(duration.Seconds())
+	}
+}
+
+// Failed counts a flow that the stage failed to process
+func (sm *StageMetrics) Failed() {
+	if sm != nil {
+		sm.errors.Inc()
+	}
+}
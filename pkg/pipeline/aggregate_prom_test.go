@@ -90,7 +90,7 @@ parameters:
 	v, cfg := test.InitConfig(t, yamlConfig)
 	require.NotNil(t, v)
 
-	extractAggregate, err := extract.NewExtractAggregate(cfg.Parameters[0])
+	extractAggregate, err := extract.NewExtractAggregate(operational.NewMetrics(&config.MetricsSettings{}), cfg.Parameters[0])
 	require.NoError(t, err)
 
 	promEncode, err := encode.NewEncodeProm(operational.NewMetrics(&config.MetricsSettings{}), cfg.Parameters[1])
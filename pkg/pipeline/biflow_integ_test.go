@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/stretchr/testify/require"
+)
+
+// chanIngester forwards the flows of a channel, until it is closed
+type chanIngester chan config.GenericMap
+
+func (c chanIngester) Ingest(out chan<- config.GenericMap) {
+	for flow := range c {
+		out <- flow
+	}
+}
+
+func TestBiflowPipeline(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	builder := config.NewPresetIngesterPipeline()
+	builder.TransformBiflow("biflow", api.TransformBiflow{Window: api.Duration{Duration: 500 * time.Millisecond}})
+	cfg := builder.ToConfigFileStruct()
+	cfg.Pipeline = append(cfg.Pipeline, config.Stage{Name: "writer", Follows: "biflow"})
+	cfg.Parameters = append(cfg.Parameters, config.StageParam{Name: "writer", Write: &config.Write{Type: api.FakeType}})
+	in := make(chanIngester, 10)
+	p, err := newPipelineFromIngester(cfg, in)
+	require.NoError(t, err)
+	writer := p.pipelineEntryMap["writer"].Writer.(*write.Fake)
+	done := make(chan struct{})
+	go func() {
+		p.Run()
+		close(done)
+	}()
+
+	in <- config.GenericMap{"SrcAddr": "10.0.0.1", "SrcPort": 40000, "DstAddr": "10.0.0.2", "DstPort": 443, "Proto": 6, "Bytes": 500}
+	in <- config.GenericMap{"SrcAddr": "10.0.0.3", "SrcPort": 40000, "DstAddr": "10.0.0.2", "DstPort": 443, "Proto": 6, "Bytes": 100}
+	in <- config.GenericMap{"SrcAddr": "10.0.0.2", "SrcPort": 443, "DstAddr": "10.0.0.1", "DstPort": 40000, "Proto": 6, "Bytes": 9000}
+
+	// the merged flow is forwarded at once, the unmatched one once the window has elapsed
+	require.Eventually(t, func() bool { return len(writer.AllRecords()) == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, 9000, writer.AllRecords()[0]["BytesBA"])
+	require.Eventually(t, func() bool { return len(writer.AllRecords()) == 2 }, 3*time.Second, 10*time.Millisecond)
+	require.Equal(t, 100, writer.AllRecords()[1]["Bytes"])
+
+	// on shutdown, the pending flows are released and all the stage goroutines end
+	in <- config.GenericMap{"SrcAddr": "10.0.0.4", "SrcPort": 40000, "DstAddr": "10.0.0.2", "DstPort": 443, "Proto": 6, "Bytes": 100}
+	close(in)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the pipeline didn't stop")
+	}
+	require.Len(t, writer.AllRecords(), 3)
+	// require.Eventually runs its condition in a goroutine of its own: poll the goroutines count without it
+	for deadline := time.Now().Add(2 * time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+}
@@ -22,19 +22,30 @@ import (
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
-	"github.com/netobserv/netobserv-ebpf-agent/pkg/decode"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 )
 
 type Decoder interface {
 	Decode(in []byte) (config.GenericMap, error)
 }
 
-func GetDecoder(params api.Decoder) (Decoder, error) {
+// Reloader is implemented by the decoders reading definitions from files, which are read again when the
+// pipeline configuration is reloaded
+type Reloader interface {
+	Reload() error
+}
+
+// GetDecoder creates the decoder of a stage
+func GetDecoder(opMetrics *operational.Metrics, stage string, params api.Decoder) (Decoder, error) {
 	switch params.Type {
 	case api.DecoderJSON:
-		return NewDecodeJSON()
+		return newStageDecodeJSON(opMetrics, stage, params.JSON)
 	case api.DecoderProtobuf:
-		return decode.NewProtobuf()
+		return NewDecodeProtobuf(), nil
+	case api.DecoderProto:
+		return NewDecodeProto(params.Proto)
+	case api.DecoderCSV:
+		return NewDecodeCSV(params.CSV)
 	}
 	panic(fmt.Sprintf("`decode` type %s not defined", params.Type))
 }
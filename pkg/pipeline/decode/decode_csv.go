@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package decode
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+)
+
+// DecodeCSV decodes CSV records, whose field names are either configured or read from the header row of the file
+//
+//nolint:revive
+type DecodeCSV struct {
+	delimiter  rune
+	lazyQuotes bool
+	header     []string
+}
+
+// NewDecodeCSV creates a new CSV decoder
+func NewDecodeCSV(cfg *api.CSVDecoder) (*DecodeCSV, error) {
+	delimiter, err := cfg.GetDelimiter()
+	if err != nil {
+		return nil, err
+	}
+	d := &DecodeCSV{delimiter: delimiter}
+	if cfg != nil {
+		d.lazyQuotes = cfg.LazyQuotes
+		d.header = cfg.Fields
+	}
+	return d, nil
+}
+
+func (d *DecodeCSV) newReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = d.delimiter
+	reader.LazyQuotes = d.lazyQuotes
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return reader
+}
+
+// HasHeader tells whether the field names are known, or must be read from the first record
+func (d *DecodeCSV) HasHeader() bool {
+	return len(d.header) > 0
+}
+
+// SplitRecords splits CSV data into raw records; unlike lines, records may hold line breaks in quoted fields
+func (d *DecodeCSV) SplitRecords(data []byte) ([][]byte, error) {
+	reader := d.newReader(bytes.NewReader(data))
+	var records [][]byte
+	var start int64
+	for {
+		_, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		end := reader.InputOffset()
+		records = append(records, data[start:end])
+		start = end
+	}
+}
+
+// SetHeader reads the field names from the header record
+func (d *DecodeCSV) SetHeader(record []byte) error {
+	fields, err := d.newReader(bytes.NewReader(record)).Read()
+	if err != nil {
+		return fmt.Errorf("can't read CSV header: %w", err)
+	}
+	d.header = append([]string{}, fields...)
+	return nil
+}
+
+// Decode decodes a CSV record into a flow, whose values are typed as integers, floats, booleans or strings.
+// Empty values are skipped, as missing fields.
+func (d *DecodeCSV) Decode(record []byte) (config.GenericMap, error) {
+	if !d.HasHeader() {
+		return nil, errors.New("CSV field names are unknown: the header row was not read")
+	}
+	values, err := d.newReader(bytes.NewReader(record)).Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(d.header) {
+		return nil, fmt.Errorf("CSV record has %d fields, while the header has %d", len(values), len(d.header))
+	}
+	flow := make(config.GenericMap, len(values))
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		flow[d.header[i]] = inferCSVValue(value)
+	}
+	return flow, nil
+}
+
+func inferCSVValue(value string) interface{} {
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	return value
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package decode
+
+import (
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCSV(t *testing.T) {
+	decoder, err := NewDecodeCSV(&api.CSVDecoder{Delimiter: ";"})
+	require.NoError(t, err)
+	records, err := decoder.SplitRecords([]byte("SrcAddr;DstPort;Bytes;Ratio;Dup;Comment\n" +
+		"10.0.0.1;443;1500;0.5;true;\"multi\nline; quoted\"\n" +
+		"10.0.0.2;;20;1e3;false;plain\n"))
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.False(t, decoder.HasHeader())
+	require.NoError(t, decoder.SetHeader(records[0]))
+
+	out, err := decoder.Decode(records[1])
+	require.NoError(t, err)
+	require.Equal(t, config.GenericMap{
+		"SrcAddr": "10.0.0.1",
+		"DstPort": int64(443),
+		"Bytes":   int64(1500),
+		"Ratio":   0.5,
+		"Dup":     true,
+		"Comment": "multi\nline; quoted",
+	}, out)
+
+	// empty values are missing fields
+	out, err = decoder.Decode(records[2])
+	require.NoError(t, err)
+	require.Equal(t, config.GenericMap{
+		"SrcAddr": "10.0.0.2",
+		"Bytes":   int64(20),
+		"Ratio":   float64(1000),
+		"Dup":     false,
+		"Comment": "plain",
+	}, out)
+
+	_, err = decoder.Decode([]byte("10.0.0.3;80\n"))
+	require.Error(t, err, "a record must have as many fields as the header")
+}
+
+func TestDecodeCSVConfiguredFields(t *testing.T) {
+	decoder, err := GetDecoder(opMetrics, "decode", api.Decoder{Type: api.DecoderCSV, CSV: &api.CSVDecoder{Fields: []string{"SrcAddr", "Proto"}}})
+	require.NoError(t, err)
+	out, err := decoder.Decode([]byte("10.0.0.1,NaN"))
+	require.NoError(t, err)
+	require.Equal(t, config.GenericMap{"SrcAddr": "10.0.0.1", "Proto": "NaN"}, out)
+
+	_, err = NewDecodeCSV(&api.CSVDecoder{Delimiter: "::"})
+	require.Error(t, err)
+	decoder, err = NewDecodeCSV(nil)
+	require.NoError(t, err)
+	_, err = decoder.Decode([]byte("10.0.0.1,6"))
+	require.Error(t, err, "the field names are unknown")
+}
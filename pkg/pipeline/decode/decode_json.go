@@ -19,14 +19,31 @@ package decode
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
+var malformedRecordsDef = operational.DefineMetric(
+	"decode_malformed_records_total",
+	"Counter of the records that the JSON decoder couldn't parse",
+	operational.TypeCounter,
+	"stage",
+)
+
 //nolint:revive
 type DecodeJSON struct {
+	strict bool
+	// malformed and deadLetter are nil unless the decoder is created for a stage
+	malformed  prometheus.Counter
+	deadLetter func(config.GenericMap, error)
+	fatal      func(format string, args ...interface{})
 }
 
 // Decode decodes input strings to a list of flow entries
@@ -36,7 +53,12 @@ func (c *DecodeJSON) Decode(line []byte) (config.GenericMap, error) {
 		log.Debugf("decodeJSON: line = %v", string(line))
 	}
 	var decodedLine map[string]interface{}
-	if err := json.Unmarshal(line, &decodedLine); err != nil {
+	err := json.Unmarshal(line, &decodedLine)
+	if err == nil && decodedLine == nil {
+		err = errors.New("not a JSON object")
+	}
+	if err != nil {
+		c.reportMalformed(line, err)
 		return nil, err
 	}
 	decodedLine2 := make(config.GenericMap, len(decodedLine))
@@ -52,8 +74,42 @@ func (c *DecodeJSON) Decode(line []byte) (config.GenericMap, error) {
 	return decodedLine2, nil
 }
 
+// reportMalformed counts the malformed record and sends it to the dead-letter queue, if any; in strict mode,
+// it stops the process
+func (c *DecodeJSON) reportMalformed(line []byte, err error) {
+	if c.malformed != nil {
+		c.malformed.Inc()
+	}
+	if c.deadLetter != nil {
+		c.deadLetter(config.GenericMap{api.DLQRawFieldName: string(line)}, err)
+	}
+	if c.strict {
+		c.fatal("strict JSON decoder: malformed record %q: %v", line, err)
+	}
+}
+
 // NewDecodeJSON create a new decode
 func NewDecodeJSON() (Decoder, error) {
 	log.Debugf("entering NewDecodeJSON")
 	return &DecodeJSON{}, nil
 }
+
+// newStageDecodeJSON creates the JSON decoder of a stage, counting the malformed records
+func newStageDecodeJSON(opMetrics *operational.Metrics, stage string, cfg *api.JSONDecoder) (Decoder, error) {
+	log.Debugf("entering newStageDecodeJSON")
+	c := &DecodeJSON{
+		malformed: opMetrics.NewCounter(&malformedRecordsDef, stage),
+		fatal:     log.Fatalf,
+	}
+	if cfg == nil {
+		return c, nil
+	}
+	c.strict = cfg.Strict
+	if cfg.DeadLetterQueue != nil {
+		var err error
+		if c.deadLetter, err = write.NewDeadLetter(opMetrics, stage, cfg.DeadLetterQueue); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
@@ -18,11 +18,23 @@
 package decode
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 )
 
+var opMetrics = operational.NewMetrics(&config.MetricsSettings{})
+
 func initNewDecodeJSON(t *testing.T) Decoder {
 	newDecode, err := NewDecodeJSON()
 	require.Equal(t, nil, err)
@@ -58,3 +70,56 @@ func TestDecodeJSONTimestamps(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, float64(1645104030), out["unixTime"])
 }
+
+func TestDecodeJSONMalformed(t *testing.T) {
+	dlqPath := filepath.Join(t.TempDir(), "dlq.json")
+	dec, err := GetDecoder(opMetrics, "decode-malformed", api.Decoder{Type: api.DecoderJSON, JSON: &api.JSONDecoder{
+		DeadLetterQueue: &api.DeadLetterQueue{Type: api.DLQFile, File: &api.DeadLetterQueueFile{Path: dlqPath}},
+	}})
+	require.NoError(t, err)
+	decodeJSON := dec.(*DecodeJSON)
+
+	malformed := []string{`{"Bytes": 12`, `null`, `[1, 2]`, `"flow"`, `{"Bytes": 1}}`, ``}
+	for _, line := range malformed {
+		_, err = decodeJSON.Decode([]byte(line))
+		require.Error(t, err, "line %q", line)
+	}
+	// valid records are still decoded
+	out, err := decodeJSON.Decode([]byte(`{"Bytes": 12}`))
+	require.NoError(t, err)
+	require.Equal(t, float64(12), out["Bytes"])
+
+	m := &dto.Metric{}
+	require.NoError(t, decodeJSON.malformed.Write(m))
+	require.Equal(t, float64(len(malformed)), m.GetCounter().GetValue())
+
+	// the malformed records are sent to the dead-letter queue, with the parse error
+	var lines []string
+	require.Eventually(t, func() bool {
+		content, _ := os.ReadFile(dlqPath)
+		lines = strings.Split(strings.TrimSpace(string(content)), "\n")
+		return len(lines) == len(malformed)
+	}, 5*time.Second, 10*time.Millisecond)
+	for i, line := range lines {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		require.Equal(t, malformed[i], entry[api.DLQRawFieldName])
+		require.NotEmpty(t, entry[api.DLQReasonFieldName])
+	}
+}
+
+func TestDecodeJSONStrict(t *testing.T) {
+	dec, err := GetDecoder(opMetrics, "decode-strict", api.Decoder{Type: api.DecoderJSON, JSON: &api.JSONDecoder{Strict: true}})
+	require.NoError(t, err)
+	decodeJSON := dec.(*DecodeJSON)
+	var failure string
+	decodeJSON.fatal = func(format string, args ...interface{}) { failure = fmt.Sprintf(format, args...) }
+
+	_, err = decodeJSON.Decode([]byte(`{"Bytes": 12}`))
+	require.NoError(t, err)
+	require.Empty(t, failure)
+
+	_, err = decodeJSON.Decode([]byte(`{"Bytes": }`))
+	require.Error(t, err)
+	require.Contains(t, failure, `malformed record "{\"Bytes\": }"`)
+}
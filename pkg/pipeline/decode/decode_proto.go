@@ -0,0 +1,214 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package decode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var plog = log.WithField("component", "decode.Proto")
+
+// DecodeProto decodes protobuf messages described by a user-provided definition
+//
+//nolint:revive
+type DecodeProto struct {
+	cfg        api.ProtoDecoder
+	descriptor atomic.Pointer[protoreflect.MessageDescriptor]
+}
+
+// Decode decodes a protobuf message into a flow entry
+func (c *DecodeProto) Decode(in []byte) (config.GenericMap, error) {
+	msg := dynamicpb.NewMessage(*c.descriptor.Load())
+	if err := proto.Unmarshal(in, msg); err != nil {
+		return nil, fmt.Errorf("cannot decode %s message: %w", c.cfg.MessageType, err)
+	}
+	out := config.GenericMap{}
+	c.flatten(out, "", msg)
+	// same as for the JSON decoder: if the record contains a TimeReceived field, it overrides this one
+	if _, ok := out["TimeReceived"]; !ok {
+		out["TimeReceived"] = time.Now().Unix()
+	}
+	return out, nil
+}
+
+func (c *DecodeProto) flatten(out config.GenericMap, prefix string, msg protoreflect.Message) {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+		// unset oneof variants and messages are skipped. Variants unknown to the descriptor
+		// are kept by the protobuf library as unknown fields, which are ignored
+		if (fd.ContainingOneof() != nil || fd.Message() != nil) && !msg.Has(fd) {
+			continue
+		}
+		v := msg.Get(fd)
+		switch {
+		case fd.IsMap():
+			c.set(out, path, formatMap(fd, v.Map()))
+		case fd.IsList():
+			if fd.Message() != nil {
+				plog.Tracef("skipping repeated message field %s", path)
+				continue
+			}
+			if v.List().Len() > 0 {
+				c.set(out, path, formatList(fd, v.List()))
+			}
+		case fd.Message() != nil:
+			c.flatten(out, path+".", v.Message())
+		default:
+			c.set(out, path, scalar(fd, v))
+		}
+	}
+}
+
+func (c *DecodeProto) set(out config.GenericMap, path string, value interface{}) {
+	if len(c.cfg.Mapping) == 0 {
+		out[strings.ReplaceAll(path, ".", "_")] = value
+	} else if key, ok := c.cfg.Mapping[path]; ok {
+		out[key] = value
+	}
+}
+
+func scalar(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	if fd.Kind() == protoreflect.EnumKind {
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(v.Enum())
+	}
+	return v.Interface()
+}
+
+// formatList serializes repeated fields as comma-separated strings
+func formatList(fd protoreflect.FieldDescriptor, list protoreflect.List) string {
+	items := make([]string, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		items = append(items, fmt.Sprint(scalar(fd, list.Get(i))))
+	}
+	return strings.Join(items, ",")
+}
+
+// formatMap serializes map fields as comma-separated key=value strings, sorted by key
+func formatMap(fd protoreflect.FieldDescriptor, m protoreflect.Map) string {
+	items := make([]string, 0, m.Len())
+	m.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		if fd.MapValue().Message() == nil {
+			items = append(items, fmt.Sprintf("%v=%v", k.Interface(), scalar(fd.MapValue(), v)))
+		}
+		return true
+	})
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func (c *DecodeProto) load() error {
+	md, err := loadMessageDescriptor(&c.cfg)
+	if err != nil {
+		return err
+	}
+	c.descriptor.Store(&md)
+	return nil
+}
+
+// Reload reloads the message definition, with the pipeline configuration. On error, the previous
+// definition remains in use.
+func (c *DecodeProto) Reload() error {
+	if err := c.load(); err != nil {
+		return fmt.Errorf("can't reload protobuf definition of %s, keeping the previous one: %w", c.cfg.MessageType, err)
+	}
+	plog.Infof("protobuf definition of %s reloaded", c.cfg.MessageType)
+	return nil
+}
+
+func loadMessageDescriptor(cfg *api.ProtoDecoder) (protoreflect.MessageDescriptor, error) {
+	var files interface {
+		FindDescriptorByName(protoreflect.FullName) (protoreflect.Descriptor, error)
+	}
+	switch {
+	case cfg.ProtoFile != "":
+		compiler := protocompile.Compiler{
+			Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+				ImportPaths: []string{filepath.Dir(cfg.ProtoFile)},
+			}),
+		}
+		compiled, err := compiler.Compile(context.Background(), filepath.Base(cfg.ProtoFile))
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile proto file %q: %w", cfg.ProtoFile, err)
+		}
+		files = compiled.AsResolver()
+	case cfg.DescriptorSetFile != "":
+		content, err := os.ReadFile(cfg.DescriptorSetFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read descriptor set file: %w", err)
+		}
+		fds := descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(content, &fds); err != nil {
+			return nil, fmt.Errorf("cannot decode descriptor set file %q: %w", cfg.DescriptorSetFile, err)
+		}
+		registry, err := protodesc.NewFiles(&fds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid descriptor set file %q: %w", cfg.DescriptorSetFile, err)
+		}
+		files = registry
+	default:
+		return nil, errors.New("either protoFile or descriptorSetFile must be provided")
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(cfg.MessageType))
+	if err != nil {
+		return nil, fmt.Errorf("message type %q not found: %w", cfg.MessageType, err)
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message type", cfg.MessageType)
+	}
+	return md, nil
+}
+
+// NewDecodeProto creates a new generic protobuf decoder. The message definition is loaded once,
+// and reloaded with the pipeline configuration.
+func NewDecodeProto(cfg *api.ProtoDecoder) (Decoder, error) {
+	if cfg == nil {
+		return nil, errors.New("missing proto decoder configuration")
+	}
+	if cfg.MessageType == "" {
+		return nil, errors.New("proto decoder: messageType must be provided")
+	}
+	dec := &DecodeProto{cfg: *cfg}
+	if err := dec.load(); err != nil {
+		return nil, err
+	}
+	return dec, nil
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package decode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const testProto = `syntax = "proto3";
+package test.flows;
+
+enum Direction {
+  INGRESS = 0;
+  EGRESS = 1;
+}
+
+message Endpoint {
+  string addr = 1;
+  uint32 port = 2;
+}
+
+message Record {
+  Endpoint src = 1;
+  Endpoint dst = 2;
+  uint64 bytes = 3;
+  repeated string interfaces = 4;
+  repeated uint32 dscp = 5;
+  Direction direction = 6;
+  oneof extra {
+    string dns_name = 7;
+    uint32 drop_cause = 8;
+  }
+  map<string, string> labels = 9;
+}
+`
+
+func writeTestProto(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "flows.proto")
+	require.NoError(t, os.WriteFile(path, []byte(testProto), 0o600))
+	return path
+}
+
+func newTestRecord(t *testing.T, protoFile string) []byte {
+	compiled, err := (&protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{filepath.Dir(protoFile)}},
+	}).Compile(context.Background(), filepath.Base(protoFile))
+	require.NoError(t, err)
+	md := compiled[0].Messages().ByName("Record")
+	endpoint := func(addr string, port uint32) protoreflect.Value {
+		ep := dynamicpb.NewMessage(md.Fields().ByName("src").Message())
+		ep.Set(ep.Descriptor().Fields().ByName("addr"), protoreflect.ValueOfString(addr))
+		ep.Set(ep.Descriptor().Fields().ByName("port"), protoreflect.ValueOfUint32(port))
+		return protoreflect.ValueOfMessage(ep)
+	}
+
+	rec := dynamicpb.NewMessage(md)
+	fields := md.Fields()
+	rec.Set(fields.ByName("src"), endpoint("10.0.0.1", 1234))
+	rec.Set(fields.ByName("dst"), endpoint("10.0.0.2", 443))
+	rec.Set(fields.ByName("bytes"), protoreflect.ValueOfUint64(1500))
+	ifaces := rec.Mutable(fields.ByName("interfaces")).List()
+	ifaces.Append(protoreflect.ValueOfString("eth0"))
+	ifaces.Append(protoreflect.ValueOfString("br-ex"))
+	dscp := rec.Mutable(fields.ByName("dscp")).List()
+	dscp.Append(protoreflect.ValueOfUint32(10))
+	dscp.Append(protoreflect.ValueOfUint32(46))
+	rec.Set(fields.ByName("direction"), protoreflect.ValueOfEnum(1))
+	rec.Set(fields.ByName("dns_name"), protoreflect.ValueOfString("example.com"))
+	labels := rec.Mutable(fields.ByName("labels")).Map()
+	labels.Set(protoreflect.ValueOfString("zone").MapKey(), protoreflect.ValueOfString("a"))
+	labels.Set(protoreflect.ValueOfString("app").MapKey(), protoreflect.ValueOfString("web"))
+	b, err := proto.Marshal(rec)
+	require.NoError(t, err)
+	return b
+}
+
+func TestDecodeProto(t *testing.T) {
+	protoFile := writeTestProto(t)
+	dec, err := GetDecoder(opMetrics, "decode", api.Decoder{Type: api.DecoderProto, Proto: &api.ProtoDecoder{
+		ProtoFile:   protoFile,
+		MessageType: "test.flows.Record",
+	}})
+	require.NoError(t, err)
+
+	out, err := dec.Decode(newTestRecord(t, protoFile))
+	require.NoError(t, err)
+	require.NotZero(t, out["TimeReceived"])
+	delete(out, "TimeReceived")
+	require.Equal(t, map[string]interface{}{
+		"src_addr":   "10.0.0.1",
+		"src_port":   uint32(1234),
+		"dst_addr":   "10.0.0.2",
+		"dst_port":   uint32(443),
+		"bytes":      uint64(1500),
+		"interfaces": "eth0,br-ex",
+		"dscp":       "10,46",
+		"direction":  "EGRESS",
+		"dns_name":   "example.com",
+		"labels":     "app=web,zone=a",
+	}, map[string]interface{}(out))
+}
+
+func TestDecodeProtoReload(t *testing.T) {
+	protoFile := writeTestProto(t)
+	dec, err := NewDecodeProto(&api.ProtoDecoder{ProtoFile: protoFile, MessageType: "test.flows.Record"})
+	require.NoError(t, err)
+	record := newTestRecord(t, protoFile)
+
+	// the field is renamed in the new definition
+	require.NoError(t, os.WriteFile(protoFile, []byte(strings.Replace(testProto, "uint64 bytes", "uint64 octets", 1)), 0o600))
+	require.NoError(t, dec.(Reloader).Reload())
+	out, err := dec.Decode(record)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1500), out["octets"])
+	require.NotContains(t, out, "bytes")
+
+	// an invalid definition keeps the previous one
+	require.NoError(t, os.WriteFile(protoFile, []byte("syntax = "), 0o600))
+	require.Error(t, dec.(Reloader).Reload())
+	out, err = dec.Decode(record)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1500), out["octets"])
+}
+
+func TestDecodeProtoMapping(t *testing.T) {
+	protoFile := writeTestProto(t)
+	dec, err := NewDecodeProto(&api.ProtoDecoder{
+		ProtoFile:   protoFile,
+		MessageType: "test.flows.Record",
+		Mapping: map[string]string{
+			"src.addr":   "SrcAddr",
+			"dst.port":   "DstPort",
+			"interfaces": "Interfaces",
+			"drop_cause": "DropCause",
+		},
+	})
+	require.NoError(t, err)
+
+	out, err := dec.Decode(newTestRecord(t, protoFile))
+	require.NoError(t, err)
+	delete(out, "TimeReceived")
+	// drop_cause is not the oneof variant being set
+	require.Equal(t, map[string]interface{}{
+		"SrcAddr":    "10.0.0.1",
+		"DstPort":    uint32(443),
+		"Interfaces": "eth0,br-ex",
+	}, map[string]interface{}(out))
+}
+
+func TestDecodeProtoDescriptorSet(t *testing.T) {
+	protoFile := writeTestProto(t)
+	compiled, err := (&protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{filepath.Dir(protoFile)}},
+	}).Compile(context.Background(), filepath.Base(protoFile))
+	require.NoError(t, err)
+	fds, err := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(compiled[0])},
+	})
+	require.NoError(t, err)
+	fdsFile := filepath.Join(t.TempDir(), "flows.pb")
+	require.NoError(t, os.WriteFile(fdsFile, fds, 0o600))
+
+	dec, err := NewDecodeProto(&api.ProtoDecoder{
+		DescriptorSetFile: fdsFile,
+		MessageType:       "test.flows.Record",
+	})
+	require.NoError(t, err)
+
+	// Add a oneof variant that is unknown to the descriptor (field 10): it must be skipped
+	payload := newTestRecord(t, protoFile)
+	payload = protowire.AppendTag(payload, 10, protowire.VarintType)
+	payload = protowire.AppendVarint(payload, 42)
+	out, err := dec.Decode(payload)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1", out["src_addr"])
+	require.Equal(t, "example.com", out["dns_name"])
+	require.Len(t, out, 11)
+}
+
+func TestDecodeProtoMalformed(t *testing.T) {
+	dec, err := NewDecodeProto(&api.ProtoDecoder{
+		ProtoFile:   writeTestProto(t),
+		MessageType: "test.flows.Record",
+	})
+	require.NoError(t, err)
+
+	require.NotPanics(t, func() {
+		_, err = dec.Decode([]byte{0xff, 0xff, 0xff})
+	})
+	require.Error(t, err)
+}
+
+func TestNewDecodeProtoErrors(t *testing.T) {
+	protoFile := writeTestProto(t)
+	_, err := NewDecodeProto(nil)
+	require.Error(t, err)
+	_, err = NewDecodeProto(&api.ProtoDecoder{MessageType: "test.flows.Record"})
+	require.Error(t, err)
+	_, err = NewDecodeProto(&api.ProtoDecoder{ProtoFile: protoFile})
+	require.Error(t, err)
+	_, err = NewDecodeProto(&api.ProtoDecoder{ProtoFile: protoFile, MessageType: "test.flows.Unknown"})
+	require.Error(t, err)
+	_, err = NewDecodeProto(&api.ProtoDecoder{ProtoFile: protoFile, MessageType: "test.flows.Direction"})
+	require.Error(t, err)
+	_, err = NewDecodeProto(&api.ProtoDecoder{ProtoFile: filepath.Join(t.TempDir(), "missing.proto"), MessageType: "test.flows.Record"})
+	require.Error(t, err)
+}
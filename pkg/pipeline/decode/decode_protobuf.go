@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package decode
+
+import (
+	"fmt"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/decode"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/pbflow"
+	"google.golang.org/protobuf/proto"
+)
+
+// DecodeProtobuf decodes the records sent by the NetObserv eBPF agent, with the field names of its flows
+//
+//nolint:revive
+type DecodeProtobuf struct{}
+
+func NewDecodeProtobuf() *DecodeProtobuf {
+	return &DecodeProtobuf{}
+}
+
+func (d *DecodeProtobuf) Decode(in []byte) (config.GenericMap, error) {
+	record := pbflow.Record{}
+	if err := proto.Unmarshal(in, &record); err != nil {
+		return nil, fmt.Errorf("unmarshaling ProtoBuf record: %w", err)
+	}
+	normalizeRecord(&record)
+	return decode.PBFlowToMap(&record), nil
+}
+
+// normalizeRecord fills the optional parts of a record that the conversion to a flow expects
+func normalizeRecord(record *pbflow.Record) {
+	// the network and transport layers are dereferenced by the conversion, even for non-IP flows
+	if record.Network == nil {
+		record.Network = &pbflow.Network{}
+	}
+	if record.Transport == nil {
+		record.Transport = &pbflow.Transport{}
+	}
+	// records that weren't deduplicated by the agent only have a single interface, outside of the list of interfaces
+	if len(record.DupList) == 0 && record.Interface != "" {
+		record.DupList = []*pbflow.DupMapEntry{{Interface: record.Interface, Direction: record.Direction}}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package decode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/pbflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func marshalRecord(t *testing.T, record *pbflow.Record) []byte {
+	b, err := proto.Marshal(record)
+	require.NoError(t, err)
+	return b
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	decoder, err := GetDecoder(opMetrics, "decode", api.Decoder{Type: api.DecoderProtobuf})
+	require.NoError(t, err)
+	start := time.UnixMilli(1700000000000)
+
+	out, err := decoder.Decode(marshalRecord(t, &pbflow.Record{
+		EthProtocol:   0x800,
+		TimeFlowStart: timestamppb.New(start),
+		TimeFlowEnd:   timestamppb.New(start.Add(time.Second)),
+		Network: &pbflow.Network{
+			SrcAddr: &pbflow.IP{IpFamily: &pbflow.IP_Ipv4{Ipv4: 0x0a000001}},
+			DstAddr: &pbflow.IP{IpFamily: &pbflow.IP_Ipv4{Ipv4: 0x0a000002}},
+		},
+		Transport: &pbflow.Transport{Protocol: 6, SrcPort: 1234, DstPort: 443},
+		Bytes:     1500,
+		Packets:   3,
+		DupList: []*pbflow.DupMapEntry{
+			{Interface: "eth0", Direction: pbflow.Direction_INGRESS},
+			{Interface: "br-ex", Direction: pbflow.Direction_EGRESS},
+		},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", out["SrcAddr"])
+	assert.Equal(t, "10.0.0.2", out["DstAddr"])
+	assert.Equal(t, uint16(1234), out["SrcPort"])
+	assert.Equal(t, uint16(443), out["DstPort"])
+	assert.Equal(t, uint64(1500), out["Bytes"])
+	assert.Equal(t, int64(1700000000000), out["TimeFlowStartMs"])
+	assert.Equal(t, []string{"eth0", "br-ex"}, out["Interfaces"])
+	assert.Equal(t, []int{0, 1}, out["IfDirections"])
+
+	_, err = decoder.Decode([]byte{0xff, 0xff})
+	require.Error(t, err)
+}
+
+func TestDecodeProtobufOptionalFields(t *testing.T) {
+	decoder := NewDecodeProtobuf()
+
+	// a non-IP flow doesn't have the network and transport layers
+	out, err := decoder.Decode(marshalRecord(t, &pbflow.Record{EthProtocol: 0x806, Bytes: 60}))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(60), out["Bytes"])
+	assert.NotContains(t, out, "SrcAddr")
+	assert.NotContains(t, out, "Proto")
+
+	// a record without a list of interfaces has a single interface
+	out, err = decoder.Decode(marshalRecord(t, &pbflow.Record{
+		EthProtocol: 0x800,
+		Interface:   "eth0",
+		Direction:   pbflow.Direction_EGRESS,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eth0"}, out["Interfaces"])
+	assert.Equal(t, []int{1}, out["IfDirections"])
+}
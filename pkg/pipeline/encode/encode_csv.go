@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encode
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+type encodeCSV struct {
+	fields         []string
+	delimiter      string
+	quoteAll       bool
+	mutex          sync.Mutex
+	out            io.Writer
+	recordsWritten prometheus.Counter
+}
+
+// Encode writes the configured fields of the flow as a CSV row; missing fields are written as empty values
+func (e *encodeCSV) Encode(entry config.GenericMap) {
+	values := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		if v, ok := entry[field]; ok && v != nil {
+			values[i] = utils.ConvertToString(v)
+		}
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if err := e.writeRow(values); err != nil {
+		log.WithError(err).Error("can't write CSV row")
+		return
+	}
+	e.recordsWritten.Inc()
+}
+
+// The mutex must be held when calling writeRow
+func (e *encodeCSV) writeRow(values []string) error {
+	var sb strings.Builder
+	for i, value := range values {
+		if i > 0 {
+			sb.WriteString(e.delimiter)
+		}
+		if e.quoteAll || e.needsQuotes(value) {
+			sb.WriteByte('"')
+			sb.WriteString(strings.ReplaceAll(value, `"`, `""`))
+			sb.WriteByte('"')
+		} else {
+			sb.WriteString(value)
+		}
+	}
+	sb.WriteByte('\n')
+	_, err := io.WriteString(e.out, sb.String())
+	return err
+}
+
+func (e *encodeCSV) needsQuotes(value string) bool {
+	return strings.Contains(value, e.delimiter) || strings.ContainsAny(value, "\"\r\n") ||
+		strings.HasPrefix(value, " ") || strings.HasPrefix(value, "\t")
+}
+
+func (e *encodeCSV) Update(_ config.StageParam) {
+	log.Warn("Encode CSV, update not supported")
+}
+
+// NewEncodeCSV creates an encoder writing flows as rows of a CSV file
+func NewEncodeCSV(opMetrics *operational.Metrics, params config.StageParam) (Encoder, error) {
+	log.Debugf("entering NewEncodeCSV")
+	cfg := api.EncodeCSV{}
+	if params.Encode != nil && params.Encode.CSV != nil {
+		cfg = *params.Encode.CSV
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("the provided config is not valid: %w", err)
+	}
+	delimiter, _ := cfg.GetDelimiter()
+	file, err := os.Create(cfg.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("can't create CSV file: %w", err)
+	}
+	return newEncodeCSV(opMetrics, params.Name, &cfg, delimiter, file)
+}
+
+func newEncodeCSV(opMetrics *operational.Metrics, stage string, cfg *api.EncodeCSV, delimiter rune, out io.Writer) (*encodeCSV, error) {
+	e := &encodeCSV{
+		fields:         cfg.Fields,
+		delimiter:      string(delimiter),
+		quoteAll:       cfg.Quoting == api.CSVQuoteAll,
+		out:            out,
+		recordsWritten: opMetrics.CreateRecordsWrittenCounter(stage),
+	}
+	if err := e.writeRow(cfg.Fields); err != nil {
+		return nil, fmt.Errorf("can't write CSV header: %w", err)
+	}
+	return e, nil
+}
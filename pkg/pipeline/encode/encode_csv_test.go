@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encode
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flows.csv")
+	encoder, err := NewEncodeCSV(operational.NewMetrics(&config.MetricsSettings{}), config.NewEncodeCSVParams("csv", api.EncodeCSV{
+		Filename: path,
+		Fields:   []string{"SrcAddr", "DstPort", "Bytes", "Comment"},
+	}))
+	require.NoError(t, err)
+
+	encoder.Encode(config.GenericMap{"SrcAddr": "10.0.0.1", "DstPort": 443, "Bytes": uint64(1500), "Proto": 6})
+	encoder.Encode(config.GenericMap{"SrcAddr": "10.0.0.2", "Comment": "say \"hi\", twice"})
+	encoder.Encode(config.GenericMap{"Comment": " leading space\nand line break"})
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "SrcAddr,DstPort,Bytes,Comment\n"+
+		"10.0.0.1,443,1500,\n"+
+		"10.0.0.2,,,\"say \"\"hi\"\", twice\"\n"+
+		",,,\" leading space\nand line break\"\n", string(content))
+}
+
+func TestEncodeCSVQuoteAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flows.csv")
+	encoder, err := NewEncodeCSV(operational.NewMetrics(&config.MetricsSettings{}), config.NewEncodeCSVParams("csv", api.EncodeCSV{
+		Filename:  path,
+		Fields:    []string{"SrcAddr", "Bytes"},
+		Delimiter: "\t",
+		Quoting:   api.CSVQuoteAll,
+	}))
+	require.NoError(t, err)
+	encoder.Encode(config.GenericMap{"SrcAddr": "10.0.0.1", "Bytes": 20})
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "\"SrcAddr\"\t\"Bytes\"\n\"10.0.0.1\"\t\"20\"\n", string(content))
+
+	_, err = NewEncodeCSV(operational.NewMetrics(&config.MetricsSettings{}), config.NewEncodeCSVParams("csv", api.EncodeCSV{Filename: path}))
+	require.Error(t, err, "fields are required")
+}
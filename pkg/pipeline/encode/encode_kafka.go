@@ -19,12 +19,15 @@ package encode
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
-	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	putils "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	kafkago "github.com/segmentio/kafka-go"
 	log "github.com/sirupsen/logrus"
@@ -34,6 +37,23 @@ import (
 const (
 	defaultReadTimeoutSeconds  = int64(10)
 	defaultWriteTimeoutSeconds = int64(10)
+	// same as the kafka-go default dialer
+	kafkaDialTimeout = 3 * time.Second
+)
+
+var (
+	kafkaMessageBytes = operational.DefineMetric(
+		"encode_kafka_message_bytes_total",
+		"Number of bytes of the messages written to Kafka, before compression",
+		operational.TypeCounter,
+		"stage",
+	)
+	kafkaSentBytes = operational.DefineMetric(
+		"encode_kafka_sent_bytes_total",
+		"Number of bytes sent to the Kafka brokers, after compression and including the protocol overhead",
+		operational.TypeCounter,
+		"stage",
+	)
 )
 
 type kafkaWriteMessage interface {
@@ -44,6 +64,31 @@ type encodeKafka struct {
 	kafkaParams    api.EncodeKafka
 	kafkaWriter    kafkaWriteMessage
 	recordsWritten prometheus.Counter
+	messageBytes   prometheus.Counter
+}
+
+// sentBytesConn counts the bytes written to the broker connections: compared with the message bytes,
+// it measures the savings of the compression
+type sentBytesConn struct {
+	net.Conn
+	sentBytes prometheus.Counter
+}
+
+func (c *sentBytesConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sentBytes.Add(float64(n))
+	return n, err
+}
+
+func sentBytesDialer(sentBytes prometheus.Counter) func(context.Context, string, string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: kafkaDialTimeout}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return &sentBytesConn{Conn: conn, sentBytes: sentBytes}, nil
+	}
 }
 
 // Encode writes entries to kafka topic
@@ -56,6 +101,7 @@ func (r *encodeKafka) Encode(entry config.GenericMap) {
 		return
 	}
 	msg := kafkago.Message{
+		Key:   r.partitionKey(entry),
 		Value: entryByteArray,
 	}
 	err = r.kafkaWriter.WriteMessages(context.Background(), msg)
@@ -63,9 +109,33 @@ func (r *encodeKafka) Encode(entry config.GenericMap) {
 		log.Errorf("encodeKafka error: %v", err)
 	} else {
 		r.recordsWritten.Inc()
+		r.messageBytes.Add(float64(len(msg.Key) + len(msg.Value)))
 	}
 }
 
+// partitionKey concatenates the values of the partition key fields. The key is nil when none of the fields
+// is present, so that the balancer falls back to round-robin (or random, for crc32 and murmur2).
+func (r *encodeKafka) partitionKey(entry config.GenericMap) []byte {
+	if len(r.kafkaParams.PartitionKey) == 0 {
+		return nil
+	}
+	var key []byte
+	found := false
+	for i, field := range r.kafkaParams.PartitionKey {
+		if i > 0 {
+			key = append(key, '|')
+		}
+		if v, ok := entry[field]; ok && v != nil {
+			found = true
+			key = append(key, utils.ConvertToString(v)...)
+		}
+	}
+	if !found {
+		return nil
+	}
+	return key
+}
+
 func (r *encodeKafka) Update(_ config.StageParam) {
 	log.Warn("Encode Kafka, update not supported")
 }
@@ -77,6 +147,9 @@ func NewEncodeKafka(opMetrics *operational.Metrics, params config.StageParam) (E
 	if params.Encode != nil && params.Encode.Kafka != nil {
 		config = *params.Encode.Kafka
 	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kafka encode config: %w", err)
+	}
 
 	var balancer kafkago.Balancer
 	switch config.Balancer {
@@ -92,6 +165,39 @@ func NewEncodeKafka(opMetrics *operational.Metrics, params config.StageParam) (E
 		balancer = &kafkago.Murmur2Balancer{}
 	default:
 		balancer = nil
+		if len(config.PartitionKey) > 0 {
+			balancer = &kafkago.Hash{}
+		}
+	}
+
+	var compression kafkago.Compression
+	switch config.Compression {
+	case api.KafkaCompressionGzip:
+		compression = kafkago.Gzip
+	case api.KafkaCompressionSnappy:
+		compression = kafkago.Snappy
+	case api.KafkaCompressionLz4:
+		compression = kafkago.Lz4
+	case api.KafkaCompressionZstd:
+		compression = kafkago.Zstd
+	case "", api.KafkaCompressionNone:
+	}
+
+	var requiredAcks kafkago.RequiredAcks
+	switch config.RequiredAcks {
+	case api.KafkaRequireOne:
+		requiredAcks = kafkago.RequireOne
+	case api.KafkaRequireAll:
+		requiredAcks = kafkago.RequireAll
+	case "", api.KafkaRequireNone:
+		requiredAcks = kafkago.RequireNone
+	}
+
+	// Temporary fix may be we should implement a batching systems
+	// https://github.com/segmentio/kafka-go/issues/326#issuecomment-519375403
+	batchTimeout := time.Nanosecond
+	if config.BatchTimeout != nil && config.BatchTimeout.Duration > 0 {
+		batchTimeout = config.BatchTimeout.Duration
 	}
 
 	readTimeoutSecs := defaultReadTimeoutSeconds
@@ -104,7 +210,8 @@ func NewEncodeKafka(opMetrics *operational.Metrics, params config.StageParam) (E
 		writeTimeoutSecs = config.WriteTimeout
 	}
 
-	transport := kafkago.Transport{}
+	sentBytes := opMetrics.NewCounter(&kafkaSentBytes, params.Name)
+	transport := kafkago.Transport{Dial: sentBytesDialer(sentBytes)}
 	if config.TLS != nil {
 		log.Infof("Using TLS configuration: %v", config.TLS)
 		tlsConfig, err := config.TLS.Build()
@@ -115,7 +222,7 @@ func NewEncodeKafka(opMetrics *operational.Metrics, params config.StageParam) (E
 	}
 
 	if config.SASL != nil {
-		m, err := utils.SetupSASLMechanism(config.SASL)
+		m, err := putils.SetupSASLMechanism(config.SASL)
 		if err != nil {
 			return nil, err
 		}
@@ -131,9 +238,9 @@ func NewEncodeKafka(opMetrics *operational.Metrics, params config.StageParam) (E
 		WriteTimeout: time.Duration(writeTimeoutSecs) * time.Second,
 		BatchSize:    config.BatchSize,
 		BatchBytes:   config.BatchBytes,
-		// Temporary fix may be we should implement a batching systems
-		// https://github.com/segmentio/kafka-go/issues/326#issuecomment-519375403
-		BatchTimeout: time.Nanosecond,
+		BatchTimeout: batchTimeout,
+		Compression:  compression,
+		RequiredAcks: requiredAcks,
 		Transport:    &transport,
 	}
 
@@ -141,5 +248,6 @@ func NewEncodeKafka(opMetrics *operational.Metrics, params config.StageParam) (E
 		kafkaParams:    config,
 		kafkaWriter:    &kafkaWriter,
 		recordsWritten: opMetrics.CreateRecordsWrittenCounter(params.Name),
+		messageBytes:   opMetrics.NewCounter(&kafkaMessageBytes, params.Name),
 	}, nil
 }
@@ -19,12 +19,17 @@ package encode
 
 import (
 	"encoding/json"
+	"io"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	kafkago "github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -86,6 +91,84 @@ func Test_EncodeKafka(t *testing.T) {
 	require.Equal(t, expectedOutput, receivedData)
 }
 
+func Test_EncodeKafkaPartitionKey(t *testing.T) {
+	test.ResetPromRegistry()
+	pipeline := config.NewCollectorPipeline("ingest", api.IngestCollector{})
+	pipeline.EncodeKafka("encode-kafka", api.EncodeKafka{
+		Address:      "any",
+		Topic:        "topic",
+		PartitionKey: []string{"SrcAddr", "DstAddr", "DstPort"},
+	})
+	newEncode, err := NewEncodeKafka(operational.NewMetrics(&config.MetricsSettings{}), pipeline.GetStageParams()[1])
+	require.NoError(t, err)
+	encodeKafka := newEncode.(*encodeKafka)
+	require.IsType(t, &kafkago.Hash{}, encodeKafka.kafkaWriter.(*kafkago.Writer).Balancer)
+	encodeKafka.kafkaWriter = &fakeKafkaWriter{}
+	receivedData = nil
+
+	newEncode.Encode(config.GenericMap{"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "DstPort": 443, "Bytes": 10})
+	newEncode.Encode(config.GenericMap{"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "DstPort": 443, "Bytes": 20})
+	// missing fields are left empty
+	newEncode.Encode(config.GenericMap{"SrcAddr": "10.0.0.1", "Bytes": 30})
+	// without any of the fields, the key is nil: the balancer falls back to round-robin
+	newEncode.Encode(config.GenericMap{"Bytes": 40})
+
+	require.Len(t, receivedData, 4)
+	require.Equal(t, []byte("10.0.0.1|10.0.0.2|443"), receivedData[0].Key)
+	require.Equal(t, receivedData[0].Key, receivedData[1].Key)
+	require.Equal(t, []byte("10.0.0.1||"), receivedData[2].Key)
+	require.Nil(t, receivedData[3].Key)
+
+	// the flows having the same key go to the same partition
+	balancer := kafkago.Hash{}
+	require.Equal(t, balancer.Balance(receivedData[0], 0, 1, 2, 3), balancer.Balance(receivedData[1], 0, 1, 2, 3))
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := dto.Metric{}
+	require.NoError(t, c.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func Test_EncodeKafkaBytes(t *testing.T) {
+	test.ResetPromRegistry()
+	pipeline := config.NewCollectorPipeline("ingest", api.IngestCollector{})
+	pipeline.EncodeKafka("encode-kafka", api.EncodeKafka{
+		Address:      "any",
+		Topic:        "topic",
+		PartitionKey: []string{"SrcAddr"},
+		Compression:  api.KafkaCompressionZstd,
+	})
+	newEncode, err := NewEncodeKafka(operational.NewMetrics(&config.MetricsSettings{}), pipeline.GetStageParams()[1])
+	require.NoError(t, err)
+	encodeKafka := newEncode.(*encodeKafka)
+	require.Equal(t, kafkago.Zstd, encodeKafka.kafkaWriter.(*kafkago.Writer).Compression)
+	encodeKafka.kafkaWriter = &fakeKafkaWriter{}
+
+	newEncode.Encode(config.GenericMap{"SrcAddr": "10.0.0.1"})
+	// key + value
+	require.Equal(t, float64(len("10.0.0.1")+len(`{"SrcAddr":"10.0.0.1"}`)), counterValue(t, encodeKafka.messageBytes))
+}
+
+func Test_KafkaSentBytes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			_, _ = io.Copy(io.Discard, conn)
+		}
+	}()
+
+	sentBytes := prometheus.NewCounter(prometheus.CounterOpts{Name: "sent"})
+	conn, err := sentBytesDialer(sentBytes)(context.Background(), "tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("compressed"))
+	require.NoError(t, err)
+	require.Equal(t, float64(10), counterValue(t, sentBytes))
+}
+
 func Test_TLSConfigEmpty(t *testing.T) {
 	test.ResetPromRegistry()
 	pipeline := config.NewCollectorPipeline("ingest", api.IngestCollector{})
@@ -145,3 +228,108 @@ func Test_MutualTLSConfig(t *testing.T) {
 	require.NotNil(t, tlsConfig.RootCAs)
 	require.Len(t, tlsConfig.RootCAs.Subjects(), 1) //nolint:staticcheck
 }
+
+func Test_MutualTLSConfigWithoutCA(t *testing.T) {
+	test.ResetPromRegistry()
+	_, user, userKey, cleanup := test.CreateAllCerts(t)
+	defer cleanup()
+	pipeline := config.NewCollectorPipeline("ingest", api.IngestCollector{})
+	pipeline.EncodeKafka("encode-kafka", api.EncodeKafka{
+		Address: "any",
+		Topic:   "topic",
+		TLS: &api.ClientTLS{
+			UserCertPath: user,
+			UserKeyPath:  userKey,
+		},
+	})
+	newEncode, err := NewEncodeKafka(operational.NewMetrics(&config.MetricsSettings{}), pipeline.GetStageParams()[1])
+	require.NoError(t, err)
+
+	tlsConfig := newEncode.(*encodeKafka).kafkaWriter.(*kafkago.Writer).Transport.(*kafkago.Transport).TLS
+
+	// the system CAs are used
+	require.Len(t, tlsConfig.Certificates, 1)
+	require.Nil(t, tlsConfig.RootCAs)
+}
+
+func Test_SASLConfig(t *testing.T) {
+	id, cleanupID, err := test.DumpToTemp("flp")
+	require.NoError(t, err)
+	defer cleanupID()
+	secret, cleanupSecret, err := test.DumpToTemp("s3cr3t")
+	require.NoError(t, err)
+	defer cleanupSecret()
+	for _, tc := range []struct {
+		cfg       api.SASLConfig
+		mechanism string
+	}{
+		{cfg: api.SASLConfig{Type: api.SASLPlain, ClientIDPath: id, ClientSecretPath: secret}, mechanism: "PLAIN"},
+		{cfg: api.SASLConfig{Type: api.SASLScramSHA256, Username: "flp", ClientSecretPath: secret}, mechanism: "SCRAM-SHA-256"},
+		{cfg: api.SASLConfig{Type: api.SASLScramSHA512, ClientIDPath: id, ClientSecretPath: secret}, mechanism: "SCRAM-SHA-512"},
+		{cfg: api.SASLConfig{Type: api.SASLPlain, Username: "flp", ClientIDPath: id, ClientSecretPath: secret}},
+		{cfg: api.SASLConfig{Type: api.SASLPlain, ClientIDPath: "/does/not/exist", ClientSecretPath: secret}},
+	} {
+		test.ResetPromRegistry()
+		pipeline := config.NewCollectorPipeline("ingest", api.IngestCollector{})
+		pipeline.EncodeKafka("encode-kafka", api.EncodeKafka{
+			Address: "any",
+			Topic:   "topic",
+			SASL:    &tc.cfg,
+		})
+		newEncode, err := NewEncodeKafka(operational.NewMetrics(&config.MetricsSettings{}), pipeline.GetStageParams()[1])
+		if tc.mechanism == "" {
+			require.Error(t, err, "%+v", tc.cfg)
+			continue
+		}
+		require.NoError(t, err)
+		sasl := newEncode.(*encodeKafka).kafkaWriter.(*kafkago.Writer).Transport.(*kafkago.Transport).SASL
+		require.Equal(t, tc.mechanism, sasl.Name())
+	}
+}
+
+func Test_KafkaCompressionCodecs(t *testing.T) {
+	codecs := map[api.KafkaCompressionEnum]kafkago.Compression{
+		"":                         0,
+		api.KafkaCompressionNone:   0,
+		api.KafkaCompressionGzip:   kafkago.Gzip,
+		api.KafkaCompressionSnappy: kafkago.Snappy,
+		api.KafkaCompressionLz4:    kafkago.Lz4,
+		api.KafkaCompressionZstd:   kafkago.Zstd,
+	}
+	for codec, expected := range codecs {
+		t.Run(string(codec), func(t *testing.T) {
+			test.ResetPromRegistry()
+			pipeline := config.NewCollectorPipeline("ingest", api.IngestCollector{})
+			pipeline.EncodeKafka("encode-kafka", api.EncodeKafka{
+				Address:      "any",
+				Topic:        "topic",
+				Compression:  codec,
+				RequiredAcks: api.KafkaRequireAll,
+				BatchSize:    500,
+				BatchTimeout: &api.Duration{Duration: 50 * time.Millisecond},
+			})
+			newEncode, err := NewEncodeKafka(operational.NewMetrics(&config.MetricsSettings{}), pipeline.GetStageParams()[1])
+			require.NoError(t, err)
+			writer := newEncode.(*encodeKafka).kafkaWriter.(*kafkago.Writer)
+			require.Equal(t, expected, writer.Compression)
+			require.Equal(t, kafkago.RequireAll, writer.RequiredAcks)
+			require.Equal(t, 500, writer.BatchSize)
+			require.Equal(t, 50*time.Millisecond, writer.BatchTimeout)
+		})
+	}
+}
+
+func Test_KafkaInvalidConfig(t *testing.T) {
+	for _, cfg := range []api.EncodeKafka{
+		{Address: "any", Topic: "topic", Compression: "brotli"},
+		{Address: "any", Topic: "topic", RequiredAcks: "two"},
+		{Address: "any", Topic: "topic", BatchTimeout: &api.Duration{Duration: -time.Second}},
+		{Address: "any", Topic: "topic", PartitionKey: []string{"SrcAddr"}, Balancer: api.KafkaRoundRobin},
+	} {
+		test.ResetPromRegistry()
+		pipeline := config.NewCollectorPipeline("ingest", api.IngestCollector{})
+		pipeline.EncodeKafka("encode-kafka", cfg)
+		_, err := NewEncodeKafka(operational.NewMetrics(&config.MetricsSettings{}), pipeline.GetStageParams()[1])
+		require.Error(t, err)
+	}
+}
@@ -18,31 +18,40 @@
 package encode
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode/metrics"
 	promserver "github.com/netobserv/flowlogs-pipeline/pkg/prometheus"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"github.com/sirupsen/logrus"
 )
 
 var plog = logrus.WithField("component", "encode.Prometheus")
 
-const defaultExpiryTime = time.Duration(2 * time.Minute)
+const (
+	defaultExpiryTime                     = time.Duration(2 * time.Minute)
+	defaultNativeHistogramBucketFactor    = 1.1
+	defaultNativeHistogramMaxBucketNumber = 160
+)
 
 // nolint:revive
 type EncodeProm struct {
 	cfg          *api.PromEncode
 	registerer   prometheus.Registerer
 	metricCommon *MetricsCommonStruct
-	updateChan   chan config.StageParam
 	server       *promserver.PromServer
 	regName      string
+	// exemplar of the record being encoded, nil when there is none
+	exemplar prometheus.Labels
 }
 
 func (e *EncodeProm) Gatherer() prometheus.Gatherer {
@@ -52,8 +61,8 @@ func (e *EncodeProm) Gatherer() prometheus.Gatherer {
 // Encode encodes a metric before being stored; the heavy work is done by the MetricCommonEncode
 func (e *EncodeProm) Encode(metricRecord config.GenericMap) {
 	plog.Tracef("entering EncodeMetric. metricRecord = %v", metricRecord)
+	e.exemplar = e.extractExemplar(metricRecord)
 	e.metricCommon.MetricCommonEncode(e, metricRecord)
-	e.checkConfUpdate()
 }
 
 func (e *EncodeProm) ProcessCounter(m interface{}, labels map[string]string, value float64) error {
@@ -62,10 +71,67 @@ func (e *EncodeProm) ProcessCounter(m interface{}, labels map[string]string, val
 	if err != nil {
 		return err
 	}
+	if e.exemplar != nil {
+		mm.(prometheus.ExemplarAdder).AddWithExemplar(value, e.exemplar)
+		return nil
+	}
 	mm.Add(value)
 	return nil
 }
 
+// extractExemplar returns the exemplar labels of the record. They are attached to the counter increments only,
+// so their cardinality doesn't leak into the series labels.
+func (e *EncodeProm) extractExemplar(metricRecord config.GenericMap) prometheus.Labels {
+	if len(e.cfg.ExemplarFields) == 0 {
+		return nil
+	}
+	var exemplar prometheus.Labels
+	runes := 0
+	for _, field := range e.cfg.ExemplarFields {
+		raw, ok := metricRecord[field]
+		if !ok || raw == nil {
+			continue
+		}
+		v := utils.ConvertToString(raw)
+		if v == "" {
+			continue
+		}
+		if exemplar == nil {
+			exemplar = prometheus.Labels{}
+		}
+		exemplar[field] = v
+		runes += utf8.RuneCountInString(field) + utf8.RuneCountInString(v)
+	}
+	if runes > prometheus.ExemplarMaxRunes {
+		// the exemplar would be rejected, with a panic
+		e.metricCommon.errorsCounter.WithLabelValues("ExemplarTooLong", "", "").Inc()
+		return nil
+	}
+	return exemplar
+}
+
+// withIstioMetrics validates the Istio mode, and adds the Istio metrics to the configured ones
+func withIstioMetrics(cfg *api.PromEncode) error {
+	if cfg.Istio == nil {
+		return nil
+	}
+	cfg.Istio.SetDefaults()
+	if err := cfg.Istio.Validate(cfg.Prefix); err != nil {
+		return err
+	}
+	cfg.Metrics = append(append(api.MetricsItems{}, cfg.Metrics...), cfg.Istio.Metrics()...)
+	return nil
+}
+
+func validateExemplarFields(fields []string) error {
+	for _, field := range fields {
+		if !model.LabelName(field).IsValid() {
+			return fmt.Errorf("exemplar field %q is not a valid label name", field)
+		}
+	}
+	return nil
+}
+
 func (e *EncodeProm) ProcessGauge(m interface{}, labels map[string]string, value float64, _ string) error {
 	gauge := m.(*prometheus.GaugeVec)
 	mm, err := gauge.GetMetricWith(labels)
@@ -116,42 +182,70 @@ func (e *EncodeProm) Cleanup(cleanupFunc interface{}) {
 }
 
 func (e *EncodeProm) addCounter(fullMetricName string, mInfo *metrics.Preprocessed) prometheus.Collector {
-	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: fullMetricName, Help: ""}, mInfo.TargetLabels())
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: fullMetricName, Help: "", ConstLabels: mInfo.ConstLabels}, mInfo.TargetLabels())
 	e.metricCommon.AddCounter(fullMetricName, counter, mInfo)
 	return counter
 }
 
 func (e *EncodeProm) addGauge(fullMetricName string, mInfo *metrics.Preprocessed) prometheus.Collector {
-	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: fullMetricName, Help: ""}, mInfo.TargetLabels())
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: fullMetricName, Help: "", ConstLabels: mInfo.ConstLabels}, mInfo.TargetLabels())
 	e.metricCommon.AddGauge(fullMetricName, gauge, mInfo)
 	return gauge
 }
 
+// histogramOpts returns the options of a classic histogram, or of a native one if configured
+func histogramOpts(fullMetricName string, mInfo *metrics.Preprocessed) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{Name: fullMetricName, Help: "", ConstLabels: mInfo.ConstLabels}
+	if nh := mInfo.NativeHistogram; nh != nil {
+		// without explicit buckets, only the native histogram is exposed
+		opts.NativeHistogramBucketFactor = nh.BucketFactor
+		if opts.NativeHistogramBucketFactor == 0 {
+			opts.NativeHistogramBucketFactor = defaultNativeHistogramBucketFactor
+		}
+		opts.NativeHistogramMaxBucketNumber = nh.MaxBucketNumber
+		if opts.NativeHistogramMaxBucketNumber == 0 {
+			opts.NativeHistogramMaxBucketNumber = defaultNativeHistogramMaxBucketNumber
+		}
+	}
+	return opts
+}
+
 func (e *EncodeProm) addHistogram(fullMetricName string, mInfo *metrics.Preprocessed) prometheus.Collector {
-	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: fullMetricName, Help: ""}, mInfo.TargetLabels())
+	histogram := prometheus.NewHistogramVec(histogramOpts(fullMetricName, mInfo), mInfo.TargetLabels())
 	e.metricCommon.AddHist(fullMetricName, histogram, mInfo)
 	return histogram
 }
 
 func (e *EncodeProm) addAgghistogram(fullMetricName string, mInfo *metrics.Preprocessed) prometheus.Collector {
-	agghistogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: fullMetricName, Help: ""}, mInfo.TargetLabels())
+	agghistogram := prometheus.NewHistogramVec(histogramOpts(fullMetricName, mInfo), mInfo.TargetLabels())
 	e.metricCommon.AddAggHist(fullMetricName, agghistogram, mInfo)
 	return agghistogram
 }
 
-func (e *EncodeProm) unregisterMetric(c interface{}) {
-	if c, ok := c.(prometheus.Collector); ok {
+func (e *EncodeProm) registerMetric(fullMetricName string, c prometheus.Collector) {
+	if err := e.registerer.Register(c); err != nil {
+		plog.Errorf("error in prometheus.Register: %v", err)
+	}
+	if limiter := e.metricCommon.limiter(fullMetricName); limiter != nil {
+		if err := e.registerer.Register(limiter.overflowCount); err != nil {
+			plog.Errorf("error in prometheus.Register: %v", err)
+		}
+	}
+}
+
+func (e *EncodeProm) unregisterMetric(m mInfoStruct) {
+	if c, ok := m.genericMetric.(prometheus.Collector); ok {
 		e.registerer.Unregister(c)
 	}
+	if m.limiter != nil {
+		e.registerer.Unregister(m.limiter.overflowCount)
+	}
 }
 
 func (e *EncodeProm) cleanDeletedGeneric(newCfg api.PromEncode, metrics map[string]mInfoStruct) {
 	for fullName, m := range metrics {
 		if !strings.HasPrefix(fullName, newCfg.Prefix) {
-			if c, ok := m.genericMetric.(prometheus.Collector); ok {
-				e.registerer.Unregister(c)
-			}
-			e.unregisterMetric(m.genericMetric)
+			e.unregisterMetric(m)
 			delete(metrics, fullName)
 		}
 		metricName := strings.TrimPrefix(fullName, newCfg.Prefix)
@@ -163,7 +257,7 @@ func (e *EncodeProm) cleanDeletedGeneric(newCfg api.PromEncode, metrics map[stri
 			}
 		}
 		if !found {
-			e.unregisterMetric(m.genericMetric)
+			e.unregisterMetric(m)
 			delete(metrics, fullName)
 		}
 	}
@@ -188,66 +282,70 @@ func (e *EncodeProm) checkMetricUpdate(prefix string, apiItem *api.MetricsItem,
 		}
 		if !reflect.DeepEqual(mInfo.MetricsItem, oldMetric.info.MetricsItem) {
 			plog.Debug("Changes detected: unregistering and replacing")
-			e.unregisterMetric(oldMetric.genericMetric)
+			e.unregisterMetric(oldMetric)
 			c := createMetric(fullMetricName, mInfo)
-			err := e.registerer.Register(c)
-			if err != nil {
-				plog.Errorf("error in prometheus.Register: %v", err)
-			}
+			e.registerMetric(fullMetricName, c)
 		} else {
 			plog.Debug("No changes found")
 		}
 	} else {
 		plog.Debug("New metric")
 		c := createMetric(fullMetricName, mInfo)
-		err := e.registerer.Register(c)
-		if err != nil {
-			plog.Errorf("error in prometheus.Register: %v", err)
-		}
+		e.registerMetric(fullMetricName, c)
 	}
 	return false
 }
 
-func (e *EncodeProm) checkConfUpdate() {
-	select {
-	case stage := <-e.updateChan:
-		cfg := api.PromEncode{}
-		if stage.Encode != nil && stage.Encode.Prom != nil {
-			cfg = *stage.Encode.Prom
+// Update applies a new configuration. It must not be called concurrently with Encode: the pipeline holds
+// the stage lock during both.
+func (e *EncodeProm) Update(stage config.StageParam) {
+	cfg := api.PromEncode{}
+	if stage.Encode != nil && stage.Encode.Prom != nil {
+		cfg = *stage.Encode.Prom
+	}
+	plog.Infof("Received config update: %v", cfg)
+	if err := validateExemplarFields(cfg.ExemplarFields); err != nil {
+		plog.Errorf("invalid exemplar fields, ignoring them: %v", err)
+		cfg.ExemplarFields = nil
+	}
+	if len(cfg.ExemplarFields) > 0 {
+		e.server.EnableOpenMetrics()
+	}
+	if err := withIstioMetrics(&cfg); err != nil {
+		plog.Errorf("invalid Istio mode, ignoring it: %v", err)
+		cfg.Istio = nil
+	}
+
+	e.cleanDeletedMetrics(cfg)
+
+	needNewRegistry := false
+	for i := range cfg.Metrics {
+		if err := cfg.Metrics[i].Validate(); err != nil {
+			plog.Errorf("invalid metric, skipping: %v", err)
+			continue
 		}
-		plog.Infof("Received config update: %v", cfg)
-
-		e.cleanDeletedMetrics(cfg)
-
-		needNewRegistry := false
-		for i := range cfg.Metrics {
-			switch cfg.Metrics[i].Type {
-			case api.MetricCounter:
-				needNewRegistry = e.checkMetricUpdate(cfg.Prefix, &cfg.Metrics[i], e.metricCommon.counters, e.addCounter)
-			case api.MetricGauge:
-				needNewRegistry = e.checkMetricUpdate(cfg.Prefix, &cfg.Metrics[i], e.metricCommon.gauges, e.addGauge)
-			case api.MetricHistogram:
-				needNewRegistry = e.checkMetricUpdate(cfg.Prefix, &cfg.Metrics[i], e.metricCommon.histos, e.addHistogram)
-			case api.MetricAggHistogram:
-				needNewRegistry = e.checkMetricUpdate(cfg.Prefix, &cfg.Metrics[i], e.metricCommon.aggHistos, e.addAgghistogram)
-			case "default":
-				plog.Errorf("invalid metric type = %v, skipping", cfg.Metrics[i].Type)
-				continue
-			}
-			if needNewRegistry {
-				break
-			}
+		switch cfg.Metrics[i].Type {
+		case api.MetricCounter:
+			needNewRegistry = e.checkMetricUpdate(cfg.Prefix, &cfg.Metrics[i], e.metricCommon.counters, e.addCounter)
+		case api.MetricGauge:
+			needNewRegistry = e.checkMetricUpdate(cfg.Prefix, &cfg.Metrics[i], e.metricCommon.gauges, e.addGauge)
+		case api.MetricHistogram:
+			needNewRegistry = e.checkMetricUpdate(cfg.Prefix, &cfg.Metrics[i], e.metricCommon.histos, e.addHistogram)
+		case api.MetricAggHistogram:
+			needNewRegistry = e.checkMetricUpdate(cfg.Prefix, &cfg.Metrics[i], e.metricCommon.aggHistos, e.addAgghistogram)
+		case "default":
+			plog.Errorf("invalid metric type = %v, skipping", cfg.Metrics[i].Type)
+			continue
 		}
-		e.cfg = &cfg
 		if needNewRegistry {
-			// cf https://pkg.go.dev/github.com/prometheus/client_golang@v1.19.0/prometheus#Registerer.Unregister
-			plog.Info("Changes detected on labels: need registry reset.")
-			e.resetRegistry()
 			break
 		}
-	default:
-		// Nothing to do
-		return
+	}
+	e.cfg = &cfg
+	if needNewRegistry {
+		// cf https://pkg.go.dev/github.com/prometheus/client_golang@v1.19.0/prometheus#Registerer.Unregister
+		plog.Info("Changes detected on labels: need registry reset.")
+		e.resetRegistry()
 	}
 }
 
@@ -275,10 +373,7 @@ func (e *EncodeProm) resetRegistry() {
 			continue
 		}
 		if m != nil {
-			err := e.registerer.Register(m)
-			if err != nil {
-				plog.Errorf("error in prometheus.Register: %v", err)
-			}
+			e.registerMetric(fullMetricName, m)
 		}
 	}
 	e.server.SetRegistry(e.regName, reg)
@@ -290,6 +385,29 @@ func NewEncodeProm(opMetrics *operational.Metrics, params config.StageParam) (En
 		cfg = *params.Encode.Prom
 	}
 
+	for i := range cfg.Metrics {
+		if err := cfg.Metrics[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateExemplarFields(cfg.ExemplarFields); err != nil {
+		return nil, err
+	}
+	if cfg.MaxLabelLength < 0 || (cfg.MaxLabelLength > 0 && cfg.MaxLabelLength <= len(labelTruncationMarker)) {
+		return nil, fmt.Errorf("invalid maxLabelLength %d: it must be larger than the %q marker", cfg.MaxLabelLength, labelTruncationMarker)
+	}
+	if cfg.PromConnectionInfo != nil {
+		if err := cfg.PromConnectionInfo.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CardinalityLimit < 0 {
+		return nil, fmt.Errorf("invalid cardinalityLimit %d: it can't be negative", cfg.CardinalityLimit)
+	}
+	if err := withIstioMetrics(&cfg); err != nil {
+		return nil, err
+	}
+
 	expiryTime := cfg.ExpiryTime
 	if expiryTime.Duration == 0 {
 		expiryTime.Duration = defaultExpiryTime
@@ -301,7 +419,6 @@ func NewEncodeProm(opMetrics *operational.Metrics, params config.StageParam) (En
 	w := &EncodeProm{
 		cfg:        &cfg,
 		registerer: registry,
-		updateChan: make(chan config.StageParam),
 		server:     promserver.SharedServer,
 		regName:    params.Name,
 	}
@@ -310,8 +427,13 @@ func NewEncodeProm(opMetrics *operational.Metrics, params config.StageParam) (En
 		// Start new server
 		w.server = promserver.StartServerAsync(cfg.PromConnectionInfo, params.Name, registry)
 	}
+	if len(cfg.ExemplarFields) > 0 {
+		w.server.EnableOpenMetrics()
+	}
 
 	metricCommon := NewMetricsCommonStruct(opMetrics, cfg.MaxMetrics, params.Name, expiryTime, w.Cleanup)
+	metricCommon.SetLabelTruncation(cfg.MaxLabelLength, cfg.TruncateFromLeft)
+	metricCommon.SetCardinalityLimit(cfg.CardinalityLimit)
 	w.metricCommon = metricCommon
 
 	// Init metrics
@@ -319,7 +441,3 @@ func NewEncodeProm(opMetrics *operational.Metrics, params config.StageParam) (En
 
 	return w, nil
 }
-
-func (e *EncodeProm) Update(config config.StageParam) {
-	e.updateChan <- config
-}
@@ -18,9 +18,15 @@
 package encode
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,7 +35,9 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 const testConfig = `---
@@ -566,6 +574,101 @@ func Test_MissingLabels(t *testing.T) {
 	require.Contains(t, exposed, `my_counter{namespace=""} 4`)
 }
 
+func Test_MaxLabelLength(t *testing.T) {
+	flows := []config.GenericMap{
+		{"pod": "flowlogs-pipeline-7d9f8b6c4-abcde", "bytes": 7},
+		{"pod": "flowlogs-pipeline-7d9f8b6c4-fghij", "bytes": 1},
+		{"pod": "flowlogs-pipeline-5c8d7e9f1-abcde", "bytes": 2},
+		// already as long as the truncated values
+		{"pod": "flowlogs-pipeline-7d9...", "bytes": 4},
+		{"pod": "loki-0", "bytes": 3},
+	}
+	params := api.PromEncode{
+		MaxLabelLength: 24,
+		Metrics: []api.MetricsItem{
+			{Name: "my_counter", Type: "counter", ValueKey: "bytes", Labels: []string{"pod"}},
+		},
+	}
+
+	encodeProm, err := initProm(&params)
+	require.NoError(t, err)
+	for _, flow := range flows {
+		encodeProm.Encode(flow)
+	}
+	exposed := test.ReadExposedMetrics(t, encodeProm.server)
+
+	// the pods of the same deployment share a series, counted once per flow
+	require.Contains(t, exposed, `my_counter{pod="flowlogs-pipeline-7d9..."} 12`)
+	require.Contains(t, exposed, `my_counter{pod="flowlogs-pipeline-5c8..."} 2`)
+	require.Contains(t, exposed, `my_counter{pod="loki-0"} 3`)
+	require.Equal(t, 3, strings.Count(exposed, "my_counter{"))
+
+	params.TruncateFromLeft = true
+	params.Prefix = "left_"
+	encodeProm, err = initProm(&params)
+	require.NoError(t, err)
+	for _, flow := range flows {
+		encodeProm.Encode(flow)
+	}
+	exposed = test.ReadExposedMetrics(t, encodeProm.server)
+
+	// the suffixes are kept
+	require.Contains(t, exposed, `left_my_counter{pod="...eline-7d9f8b6c4-abcde"} 7`)
+	require.Contains(t, exposed, `left_my_counter{pod="...eline-7d9f8b6c4-fghij"} 1`)
+	require.Contains(t, exposed, `left_my_counter{pod="...eline-5c8d7e9f1-abcde"} 2`)
+	require.Contains(t, exposed, `left_my_counter{pod="flowlogs-pipeline-7d9..."} 4`)
+
+	params.MaxLabelLength = 3
+	_, err = initProm(&params)
+	require.Error(t, err)
+}
+
+func Test_TruncateLabelValue(t *testing.T) {
+	require.Equal(t, "abcdef", truncateLabelValue("abcdef", 6, false))
+	require.Equal(t, "abc...", truncateLabelValue("abcdefg", 6, false))
+	require.Equal(t, "...efg", truncateLabelValue("abcdefg", 6, true))
+	// characters are counted rather than bytes
+	require.Equal(t, "héllo", truncateLabelValue("héllo", 5, false))
+	require.Equal(t, "hé...", truncateLabelValue("héllo wörld", 5, false))
+}
+
+func Test_CardinalityLimit(t *testing.T) {
+	params := api.PromEncode{
+		CardinalityLimit: 10,
+		Metrics: []api.MetricsItem{
+			{Name: "my_counter", Type: "counter", ValueKey: "bytes", Labels: []string{"namespace", "pod"}},
+		},
+	}
+
+	encodeProm, err := initProm(&params)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		encodeProm.Encode(config.GenericMap{"namespace": "A", "pod": fmt.Sprintf("pod-%d", i), "bytes": 1})
+	}
+	// known series are still updated past the limit
+	encodeProm.Encode(config.GenericMap{"namespace": "A", "pod": "pod-0", "bytes": 5})
+	encodeProm.Encode(config.GenericMap{"namespace": "A", "pod": "pod-99", "bytes": 5})
+	exposed := test.ReadExposedMetrics(t, encodeProm.server)
+
+	require.Contains(t, exposed, `my_counter{namespace="A",pod="pod-0"} 6`)
+	require.Contains(t, exposed, `my_counter{namespace="A",pod="pod-9"} 1`)
+	require.Contains(t, exposed, `my_counter{namespace="__overflow__",pod="__overflow__"} 95`)
+	require.Equal(t, 11, strings.Count(exposed, "my_counter{"))
+	require.Contains(t, exposed, `my_counter_overflow_count 90`)
+
+	// the expired series release their room
+	encodeProm.metricCommon.mCache.CleanupExpiredEntries(0, encodeProm.Cleanup)
+	require.Equal(t, int64(0), encodeProm.metricCommon.limiter("my_counter").count.Load())
+	encodeProm.Encode(config.GenericMap{"namespace": "B", "pod": "pod-0", "bytes": 1})
+	exposed = test.ReadExposedMetrics(t, encodeProm.server)
+	require.Contains(t, exposed, `my_counter{namespace="B",pod="pod-0"} 1`)
+	require.Contains(t, exposed, `my_counter_overflow_count 0`)
+
+	params.CardinalityLimit = -1
+	_, err = initProm(&params)
+	require.Error(t, err)
+}
+
 func Test_Remap(t *testing.T) {
 	metrics := []config.GenericMap{
 		{
@@ -946,3 +1049,284 @@ func Test_MultipleProm(t *testing.T) {
 
 	// TODO: Add test for different addresses, but need to deal with StartPromServer (ListenAndServe)
 }
+
+func Test_NativeHistogram(t *testing.T) {
+	params := api.PromEncode{
+		Prefix:     "test_",
+		ExpiryTime: api.Duration{Duration: time.Duration(60 * time.Second)},
+		Metrics: []api.MetricsItem{
+			{
+				Name:            "rtt_seconds",
+				Type:            "histogram",
+				ValueKey:        "rtt",
+				ValueScale:      1_000_000_000,
+				NativeHistogram: &api.NativeHistogram{},
+			},
+			{
+				Name:       "classic_rtt_seconds",
+				Type:       "histogram",
+				ValueKey:   "rtt",
+				ValueScale: 1_000_000_000,
+			},
+		},
+	}
+
+	encodeProm, err := initProm(&params)
+	require.NoError(t, err)
+	encodeProm.Encode(config.GenericMap{"rtt": 15_000_000})
+	encodeProm.Encode(config.GenericMap{"rtt": 110_000_000})
+
+	families, err := encodeProm.Gatherer().Gather()
+	require.NoError(t, err)
+	histos := map[string]*dto.Histogram{}
+	for _, f := range families {
+		histos[f.GetName()] = f.GetMetric()[0].GetHistogram()
+	}
+	native := histos["test_rtt_seconds"]
+	require.NotNil(t, native)
+	require.EqualValues(t, 2, native.GetSampleCount())
+	require.Empty(t, native.GetBucket(), "classic buckets must not be exposed")
+	// bucket factor 1.1 => schema 3
+	require.EqualValues(t, 3, native.GetSchema())
+	require.NotEmpty(t, native.GetPositiveSpan())
+
+	// classic histograms remain the default
+	classic := histos["test_classic_rtt_seconds"]
+	require.NotNil(t, classic)
+	require.Len(t, classic.GetBucket(), len(prometheus.DefBuckets))
+	require.Empty(t, classic.GetPositiveSpan())
+}
+
+func Test_NativeHistogramInvalid(t *testing.T) {
+	for _, item := range []api.MetricsItem{
+		{Name: "rtt", Type: "histogram", ValueKey: "rtt", NativeHistogram: &api.NativeHistogram{BucketFactor: 1}},
+		{Name: "flows", Type: "counter", NativeHistogram: &api.NativeHistogram{}},
+	} {
+		_, err := initProm(&api.PromEncode{Metrics: []api.MetricsItem{item}})
+		require.Error(t, err)
+	}
+}
+
+func Test_MetricExpiryTime(t *testing.T) {
+	params := api.PromEncode{
+		Prefix:     "test_",
+		ExpiryTime: api.Duration{Duration: time.Hour},
+		Metrics: []api.MetricsItem{
+			{
+				Name:       "bytes_by_ip",
+				Type:       "counter",
+				ValueKey:   "bytes",
+				Labels:     []string{"srcIP", "dstIP"},
+				ExpiryTime: &api.Duration{Duration: 100 * time.Millisecond},
+			},
+			{
+				Name:     "bytes",
+				Type:     "counter",
+				ValueKey: "bytes",
+			},
+		},
+	}
+	encodeProm, err := initProm(&params)
+	require.NoError(t, err)
+
+	encodeProm.Encode(config.GenericMap{"srcIP": "10.0.0.1", "dstIP": "10.0.0.2", "bytes": 7})
+	encodeProm.Encode(config.GenericMap{"srcIP": "10.0.0.1", "dstIP": "10.0.0.2", "bytes": 3})
+	exposed := test.ReadExposedMetrics(t, encodeProm.server)
+	require.Contains(t, exposed, `test_bytes_by_ip{dstIP="10.0.0.2",srcIP="10.0.0.1"} 10`)
+	require.Contains(t, exposed, `test_bytes 10`)
+
+	// only the series of the metric with a short expiry are deleted
+	require.Eventually(t, func() bool {
+		return !strings.Contains(test.ReadExposedMetrics(t, encodeProm.server), `test_bytes_by_ip{`)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, encodeProm.metricCommon.cacheLen())
+	require.Contains(t, test.ReadExposedMetrics(t, encodeProm.server), `test_bytes 10`)
+
+	// a resurrected series restarts from zero
+	encodeProm.Encode(config.GenericMap{"srcIP": "10.0.0.1", "dstIP": "10.0.0.2", "bytes": 5})
+	exposed = test.ReadExposedMetrics(t, encodeProm.server)
+	require.Contains(t, exposed, `test_bytes_by_ip{dstIP="10.0.0.2",srcIP="10.0.0.1"} 5`)
+	require.Contains(t, exposed, `test_bytes 15`)
+}
+
+func Test_MetricExpiryTimeMaxMetrics(t *testing.T) {
+	params := api.PromEncode{
+		MaxMetrics: 2,
+		Metrics: []api.MetricsItem{
+			{Name: "bytes_by_src", Type: "counter", ValueKey: "bytes", Labels: []string{"srcIP"}, ExpiryTime: &api.Duration{Duration: time.Hour}},
+			{Name: "bytes_by_dst", Type: "counter", ValueKey: "bytes", Labels: []string{"dstIP"}},
+		},
+	}
+	encodeProm, err := initProm(&params)
+	require.NoError(t, err)
+
+	// the limit applies to all the series, whatever their expiry
+	encodeProm.Encode(config.GenericMap{"srcIP": "10.0.0.1", "dstIP": "10.0.0.2", "bytes": 7})
+	encodeProm.Encode(config.GenericMap{"srcIP": "10.0.0.3", "dstIP": "10.0.0.4", "bytes": 7})
+	require.Equal(t, 2, encodeProm.metricCommon.cacheLen())
+
+	_, err = initProm(&api.PromEncode{Metrics: []api.MetricsItem{{Name: "flows", Type: "counter", ExpiryTime: &api.Duration{Duration: -time.Second}}}})
+	require.Error(t, err)
+}
+
+func Test_Exemplars(t *testing.T) {
+	params := api.PromEncode{
+		PromConnectionInfo: &api.PromConnectionInfo{Port: 9193},
+		Prefix:             "test_",
+		ExemplarFields:     []string{"TraceID", "SpanID"},
+		Metrics: []api.MetricsItem{
+			{Name: "bytes", Type: "counter", ValueKey: "bytes", Labels: []string{"srcIP"}},
+		},
+	}
+	encodeProm, err := initProm(&params)
+	require.NoError(t, err)
+	defer func() { _ = encodeProm.server.Shutdown(context.Background()) }()
+
+	encodeProm.Encode(config.GenericMap{"srcIP": "10.0.0.1", "bytes": 7, "TraceID": "4bf92f3577b34da6a3ce929d0e0e4736", "SpanID": 42})
+
+	scrape := func(accept string) string {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:9193/metrics", nil)
+		require.NoError(t, err)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	var exposed string
+	require.Eventually(t, func() bool {
+		exposed = scrape("application/openmetrics-text;version=1.0.0")
+		return exposed != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Contains(t, exposed, `test_bytes{srcIP="10.0.0.1"} 7.0 # {`)
+	require.Contains(t, exposed, `TraceID="4bf92f3577b34da6a3ce929d0e0e4736"`)
+	require.Contains(t, exposed, `SpanID="42"`)
+
+	// exemplars are not part of the classic text format, and their labels never make it into the series labels
+	exposed = scrape("")
+	require.Contains(t, exposed, `test_bytes{srcIP="10.0.0.1"} 7`)
+	require.NotContains(t, exposed, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	// flows without trace are counted without exemplar
+	encodeProm.Encode(config.GenericMap{"srcIP": "10.0.0.1", "bytes": 3})
+	require.Contains(t, scrape(""), `test_bytes{srcIP="10.0.0.1"} 10`)
+
+	_, err = initProm(&api.PromEncode{ExemplarFields: []string{"trace.id"}})
+	require.Error(t, err)
+}
+
+func Test_IstioMetrics(t *testing.T) {
+	params := api.PromEncode{Istio: &api.PromIstio{}}
+	encodeProm, err := initProm(&params)
+	require.NoError(t, err)
+
+	flow := config.GenericMap{
+		"Proto": 6, "Bytes": 1000,
+		"SrcK8S_OwnerName": "frontend", "SrcK8S_Namespace": "shop", "SrcK8S_Labels_app": "web",
+		"DstK8S_OwnerName": "backend", "DstK8S_Namespace": "shop", "DstK8S_Labels_app": "api",
+	}
+	encodeProm.Encode(flow)
+	// UDP flows are not part of the TCP metrics
+	encodeProm.Encode(config.GenericMap{"Proto": 17, "Bytes": 500, "SrcK8S_OwnerName": "frontend"})
+
+	families, err := encodeProm.Gatherer().Gather()
+	require.NoError(t, err)
+	names := map[string]*dto.Metric{}
+	for _, f := range families {
+		require.Equal(t, dto.MetricType_COUNTER, f.GetType())
+		require.Len(t, f.GetMetric(), 1)
+		names[f.GetName()] = f.GetMetric()[0]
+	}
+	// metric names and label keys read by Kiali
+	require.Len(t, names, 2)
+	for _, name := range []string{"istio_tcp_sent_bytes_total", "istio_tcp_received_bytes_total"} {
+		m := names[name]
+		require.NotNilf(t, m, "metric %s", name)
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		require.Equal(t, map[string]string{
+			"source_workload":                "frontend",
+			"source_workload_namespace":      "shop",
+			"source_app":                     "web",
+			"destination_workload":           "backend",
+			"destination_workload_namespace": "shop",
+			"destination_app":                "api",
+			"request_protocol":               "tcp",
+			"response_flags":                 "-",
+			"reporter":                       "source",
+		}, labels)
+		require.EqualValues(t, 1000, m.GetCounter().GetValue())
+	}
+}
+
+func Test_IstioMetricsMapping(t *testing.T) {
+	params := api.PromEncode{
+		Metrics: []api.MetricsItem{{Name: "flows_total", Type: "counter", Labels: []string{"SrcK8S_Namespace"}}},
+		Istio: &api.PromIstio{
+			Labels:             map[string]string{"source_app": "SrcK8S_Labels_k8s-app", "destination_app": ""},
+			ConstLabels:        map[string]string{"reporter": "destination"},
+			ReceivedBytesField: "Bytes_AB",
+			SentBytesField:     "Bytes_BA",
+		},
+	}
+	encodeProm, err := initProm(&params)
+	require.NoError(t, err)
+	encodeProm.Encode(config.GenericMap{
+		"Proto": 6, "Bytes_AB": 300, "Bytes_BA": 2000,
+		"SrcK8S_OwnerName": "frontend", "SrcK8S_Namespace": "shop", "SrcK8S_Labels_k8s-app": "web",
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	exposed := test.ReadExposedMetrics(t, encodeProm.server)
+	require.Contains(t, exposed, `istio_tcp_received_bytes_total{destination_workload="",destination_workload_namespace="",reporter="destination",request_protocol="tcp",response_flags="-",source_app="web",source_workload="frontend",source_workload_namespace="shop"} 300`)
+	require.Contains(t, exposed, `istio_tcp_sent_bytes_total{destination_workload="",destination_workload_namespace="",reporter="destination",request_protocol="tcp",response_flags="-",source_app="web",source_workload="frontend",source_workload_namespace="shop"} 2000`)
+	require.Contains(t, exposed, `flows_total{SrcK8S_Namespace="shop"}`)
+}
+
+func Test_IstioMetricsInvalid(t *testing.T) {
+	for _, params := range []api.PromEncode{
+		{Prefix: "netobserv_", Istio: &api.PromIstio{}},
+		{Istio: &api.PromIstio{Labels: map[string]string{"source_app": "SrcK8S_OwnerName"}}},
+		{Istio: &api.PromIstio{ConstLabels: map[string]string{"source_app": "web"}}},
+	} {
+		_, err := initProm(&params)
+		require.Error(t, err)
+	}
+}
+
+func Test_GenerateAlerts(t *testing.T) {
+	for _, name := range []string{"single-stage", "multi-stage"} {
+		t.Run(name, func(t *testing.T) {
+			params, err := config.ReadStageParams(filepath.Join("testdata", "alerts", name+".yaml"))
+			require.NoError(t, err)
+			rule, err := GenerateAlerts("flowlogs-pipeline-alerts", params)
+			require.NoError(t, err)
+			out, err := yaml.Marshal(rule)
+			require.NoError(t, err)
+
+			golden, err := os.ReadFile(filepath.Join("testdata", "alerts", name+".golden.yaml"))
+			require.NoError(t, err)
+			require.Equal(t, string(golden), string(out))
+		})
+	}
+}
+
+func Test_GenerateAlertsInvalid(t *testing.T) {
+	threshold := 10.0
+	for _, item := range []api.MetricsItem{
+		{Name: "m", Type: api.MetricCounter, AlertSeverity: "critical"},
+		{Name: "m", Type: "summary", AlertThreshold: &threshold},
+	} {
+		params := []config.StageParam{{Name: "prom", Encode: &config.Encode{Type: "prom", Prom: &api.PromEncode{Metrics: api.MetricsItems{item}}}}}
+		_, err := GenerateAlerts("alerts", params)
+		require.Error(t, err, "metric %v", item)
+	}
+}
@@ -21,6 +21,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,32 +32,49 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
-	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	putils "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 )
 
 const (
-	flpS3Version     = "v0.1"
-	defaultBatchSize = 10
+	flpS3Version             = "v0.1"
+	defaultBatchSize         = 10
+	defaultS3KeyTemplate     = "{account}/year={year}/month={month}/day={day}/hour={hour}/stream-id={stream-id}/{seq}"
+	defaultMissingFieldValue = "__HIVE_DEFAULT_PARTITION__"
+	s3SeqToken               = "{seq}"
 )
 
 var (
-	defaultTimeOut = api.Duration{Duration: 60 * time.Second}
+	defaultTimeOut  = api.Duration{Duration: 60 * time.Second}
+	s3KeyTokenRegex = regexp.MustCompile(`\{([a-z-]+)(?::([^}]+))?\}`)
 )
 
 type encodeS3 struct {
-	s3Params          api.EncodeS3
-	s3Writer          s3WriteEntries
-	recordsWritten    prometheus.Counter
-	pendingEntries    []config.GenericMap
-	mutex             *sync.Mutex
-	expiryTime        time.Time
-	exitChan          <-chan struct{}
-	streamID          string
-	intervalStartTime time.Time
-	sequenceNumber    int64
+	s3Params       api.EncodeS3
+	s3Writer       s3WriteEntries
+	recordsWritten prometheus.Counter
+	keyTemplate    []s3KeyPart
+	// partitions holds the pending entries by object key prefix, which is the key with the {seq} token left unresolved
+	partitions     map[string]*s3Partition
+	mutex          *sync.Mutex
+	exitChan       <-chan struct{}
+	streamID       string
+	sequenceNumber int64
+}
+
+type s3Partition struct {
+	entries   []config.GenericMap
+	startTime time.Time
+}
+
+// s3KeyPart is either a literal part of the key template, or a token
+type s3KeyPart struct {
+	literal string
+	token   string
+	field   string
 }
 
 type s3WriteEntries interface {
@@ -66,25 +86,90 @@ type encodeS3Writer struct {
 	s3Params *api.EncodeS3
 }
 
+func parseS3KeyTemplate(template string) ([]s3KeyPart, error) {
+	if !strings.Contains(template, s3SeqToken) {
+		return nil, fmt.Errorf("invalid S3 key template %q: it must contain %s, for unique object keys", template, s3SeqToken)
+	}
+	var parts []s3KeyPart
+	last := 0
+	for _, match := range s3KeyTokenRegex.FindAllStringSubmatchIndex(template, -1) {
+		if match[0] > last {
+			parts = append(parts, s3KeyPart{literal: template[last:match[0]]})
+		}
+		token := template[match[2]:match[3]]
+		part := s3KeyPart{token: token}
+		switch token {
+		case "account", "year", "month", "day", "hour", "stream-id", "seq":
+			if match[4] >= 0 {
+				return nil, fmt.Errorf("invalid S3 key template %q: token {%s} doesn't take a parameter", template, token)
+			}
+		case "field":
+			if match[4] < 0 {
+				return nil, fmt.Errorf("invalid S3 key template %q: a field name must be provided, as in {field:SrcK8S_Namespace}", template)
+			}
+			part.field = template[match[4]:match[5]]
+		default:
+			return nil, fmt.Errorf("invalid S3 key template %q: unknown token {%s}", template, token)
+		}
+		parts = append(parts, part)
+		last = match[1]
+	}
+	if last < len(template) {
+		parts = append(parts, s3KeyPart{literal: template[last:]})
+	}
+	return parts, nil
+}
+
+// partitionKey resolves the key template for the entry, except {seq} that is resolved when the object is written.
+// Field values are path-escaped, so that they can't add levels to the key.
+func (s *encodeS3) partitionKey(entry config.GenericMap, now time.Time) string {
+	var sb strings.Builder
+	for _, part := range s.keyTemplate {
+		switch part.token {
+		case "":
+			sb.WriteString(part.literal)
+		case "account":
+			sb.WriteString(s.s3Params.Account)
+		case "year":
+			fmt.Fprintf(&sb, "%04d", now.Year())
+		case "month":
+			fmt.Fprintf(&sb, "%02d", now.Month())
+		case "day":
+			fmt.Fprintf(&sb, "%02d", now.Day())
+		case "hour":
+			fmt.Fprintf(&sb, "%02d", now.Hour())
+		case "stream-id":
+			sb.WriteString(s.streamID)
+		case "seq":
+			sb.WriteString(s3SeqToken)
+		case "field":
+			value, ok := entry[part.field]
+			str := ""
+			if ok && value != nil {
+				str = utils.ConvertToString(value)
+			}
+			if str == "" {
+				str = s.s3Params.MissingFieldValue
+			}
+			sb.WriteString(url.PathEscape(str))
+		}
+	}
+	return sb.String()
+}
+
 // The mutex must be held when calling writeObject
-func (s *encodeS3) writeObject() error {
-	nLogs := len(s.pendingEntries)
+func (s *encodeS3) writeObject(key string, partition *s3Partition) error {
+	nLogs := len(partition.entries)
 	if nLogs > s.s3Params.BatchSize {
 		nLogs = s.s3Params.BatchSize
 	}
 	now := time.Now()
-	object := s.GenerateStoreHeader(s.pendingEntries[0:nLogs], s.intervalStartTime, now)
-	year := fmt.Sprintf("%04d", now.Year())
-	month := fmt.Sprintf("%02d", now.Month())
-	day := fmt.Sprintf("%02d", now.Day())
-	hour := fmt.Sprintf("%02d", now.Hour())
-	seq := fmt.Sprintf("%08d", s.sequenceNumber)
-	objectName := s.s3Params.Account + "/year=" + year + "/month=" + month + "/day=" + day + "/hour=" + hour + "/stream-id=" + s.streamID + "/" + seq
+	object := s.GenerateStoreHeader(partition.entries[0:nLogs], partition.startTime, now)
+	objectName := strings.ReplaceAll(key, s3SeqToken, fmt.Sprintf("%08d", s.sequenceNumber))
 	log.Debugf("S3 writeObject: objectName = %s", objectName)
 	log.Debugf("S3 writeObject: object = %v", object)
-	s.pendingEntries = s.pendingEntries[nLogs:]
-	s.intervalStartTime = now
-	s.expiryTime = now.Add(s.s3Params.WriteTimeout.Duration)
+	partition.entries = partition.entries[nLogs:]
+	partition.startTime = now
 	s.sequenceNumber++
 	// send object to object store
 	err := s.s3Writer.putObject(s.s3Params.Bucket, objectName, object)
@@ -122,24 +207,49 @@ func (s *encodeS3) createObjectTimeoutLoop() {
 			log.Debugf("exiting createObjectTimeoutLoop because of signal")
 			return
 		case <-ticker.C:
-			now := time.Now()
-			log.Debugf("time now = %v, expiryTime = %v", now, s.expiryTime)
 			s.mutex.Lock()
-			_ = s.writeObject()
+			s.flush()
 			s.mutex.Unlock()
 		}
 	}
 }
 
+// flush writes all the pending entries, or an empty object when there are none, except in Parquet format where
+// a file without rows would have no schema. The mutex must be held when calling flush
+func (s *encodeS3) flush() {
+	if len(s.partitions) == 0 {
+		if s.s3Params.Format == api.S3Parquet {
+			return
+		}
+		now := time.Now()
+		_ = s.writeObject(s.partitionKey(config.GenericMap{}, now), &s3Partition{startTime: now.Add(-s.s3Params.WriteTimeout.Duration)})
+		return
+	}
+	for key, partition := range s.partitions {
+		for len(partition.entries) > 0 {
+			_ = s.writeObject(key, partition)
+		}
+		delete(s.partitions, key)
+	}
+}
+
 // Encode queues entries to be sent to object store
 func (s *encodeS3) Encode(entry config.GenericMap) {
 	log.Debugf("Encode S3, entry = %v", entry)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.pendingEntries = append(s.pendingEntries, entry)
+	now := time.Now()
+	key := s.partitionKey(entry, now)
+	partition, ok := s.partitions[key]
+	if !ok {
+		partition = &s3Partition{startTime: now}
+		s.partitions[key] = partition
+	}
+	partition.entries = append(partition.entries, entry)
 	s.recordsWritten.Inc()
-	if len(s.pendingEntries) >= s.s3Params.BatchSize {
-		_ = s.writeObject()
+	if len(partition.entries) >= s.s3Params.BatchSize {
+		_ = s.writeObject(key, partition)
+		delete(s.partitions, key)
 	}
 }
 
@@ -159,17 +269,35 @@ func NewEncodeS3(opMetrics *operational.Metrics, params config.StageParam) (Enco
 	if configParams.BatchSize == 0 {
 		configParams.BatchSize = defaultBatchSize
 	}
+	if configParams.KeyTemplate == "" {
+		configParams.KeyTemplate = defaultS3KeyTemplate
+	}
+	if configParams.MissingFieldValue == "" {
+		configParams.MissingFieldValue = defaultMissingFieldValue
+	}
+	keyTemplate, err := parseS3KeyTemplate(configParams.KeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	switch configParams.Format {
+	case "", api.S3JSON:
+	case api.S3Parquet:
+		if err := validateParquet(configParams.Parquet); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown S3 format %q", configParams.Format)
+	}
 
 	s := &encodeS3{
-		s3Params:          configParams,
-		s3Writer:          s3Writer,
-		recordsWritten:    opMetrics.CreateRecordsWrittenCounter(params.Name),
-		pendingEntries:    make([]config.GenericMap, 0),
-		expiryTime:        time.Now().Add(configParams.WriteTimeout.Duration),
-		exitChan:          utils.ExitChannel(),
-		streamID:          time.Now().Format(time.RFC3339),
-		intervalStartTime: time.Now(),
-		mutex:             &sync.Mutex{},
+		s3Params:       configParams,
+		s3Writer:       s3Writer,
+		recordsWritten: opMetrics.CreateRecordsWrittenCounter(params.Name),
+		keyTemplate:    keyTemplate,
+		partitions:     map[string]*s3Partition{},
+		exitChan:       putils.ExitChannel(),
+		streamID:       time.Now().Format(time.RFC3339),
+		mutex:          &sync.Mutex{},
 	}
 	go s.createObjectTimeoutLoop()
 	return s, nil
@@ -208,14 +336,25 @@ func (e *encodeS3Writer) putObject(bucket string, objectName string, object map[
 		e.s3Client = s3Client
 	}
 	b := new(bytes.Buffer)
-	err := json.NewEncoder(b).Encode(object)
-	if err != nil {
-		log.Errorf("error encoding object: %v", err)
-		return err
+	contentType := "application/octet-stream"
+	if e.s3Params.Format == api.S3Parquet {
+		encoded, err := encodeParquet(object, e.s3Params.Parquet)
+		if err != nil {
+			log.Errorf("error encoding object: %v", err)
+			return err
+		}
+		b.Write(encoded)
+		contentType = "application/vnd.apache.parquet"
+	} else {
+		err := json.NewEncoder(b).Encode(object)
+		if err != nil {
+			log.Errorf("error encoding object: %v", err)
+			return err
+		}
+		log.Debugf("encoded object = %v", b)
 	}
-	log.Debugf("encoded object = %v", b)
 	// TBD: add necessary headers such as authorization (token), gzip, md5, etc
-	uploadInfo, err := e.s3Client.PutObject(context.Background(), bucket, objectName, b, int64(b.Len()), minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	uploadInfo, err := e.s3Client.PutObject(context.Background(), bucket, objectName, b, int64(b.Len()), minio.PutObjectOptions{ContentType: contentType})
 	log.Debugf("uploadInfo = %v", uploadInfo)
 	return err
 }
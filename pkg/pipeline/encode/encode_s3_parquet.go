@@ -0,0 +1,264 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	 http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	log "github.com/sirupsen/logrus"
+)
+
+type parquetColumn struct {
+	api.ParquetColumn
+	index int
+}
+
+func parquetCodec(compression api.ParquetCompressionEnum) (compress.Codec, error) {
+	switch compression {
+	case api.ParquetSnappy, "":
+		return &parquet.Snappy, nil
+	case api.ParquetGzip:
+		return &parquet.Gzip, nil
+	case api.ParquetZstd:
+		return &parquet.Zstd, nil
+	case api.ParquetUncompressed:
+		return &parquet.Uncompressed, nil
+	}
+	return nil, fmt.Errorf("unknown Parquet compression %q", compression)
+}
+
+func validateParquet(params *api.EncodeS3Parquet) error {
+	if params == nil {
+		return nil
+	}
+	if _, err := parquetCodec(params.Compression); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i := range params.Columns {
+		col := &params.Columns[i]
+		if col.Name == "" || names[col.Name] {
+			return fmt.Errorf("invalid Parquet column %q: names must be set and unique", col.Name)
+		}
+		names[col.Name] = true
+		if _, err := parquetNode(col.Type); err != nil {
+			return err
+		}
+		if col.Compression != "" {
+			if _, err := parquetCodec(col.Compression); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parquetNode(t api.ParquetTypeEnum) (parquet.Node, error) {
+	switch t {
+	case api.ParquetString, api.ParquetIP:
+		return parquet.String(), nil
+	case api.ParquetBool:
+		return parquet.Leaf(parquet.BooleanType), nil
+	case api.ParquetInt64:
+		return parquet.Int(64), nil
+	case api.ParquetUint64:
+		return parquet.Uint(64), nil
+	case api.ParquetDouble:
+		return parquet.Leaf(parquet.DoubleType), nil
+	case api.ParquetPort:
+		return parquet.Uint(16), nil
+	case api.ParquetTimestamp, api.ParquetTimestampMs:
+		return parquet.Timestamp(parquet.Millisecond), nil
+	}
+	return nil, fmt.Errorf("unknown Parquet column type %q", t)
+}
+
+// inferParquetType returns the column type for the fields that are not configured
+func inferParquetType(v any) api.ParquetTypeEnum {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool:
+		return api.ParquetBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return api.ParquetInt64
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return api.ParquetUint64
+	case reflect.Float32, reflect.Float64:
+		return api.ParquetDouble
+	default:
+		return api.ParquetString
+	}
+}
+
+func parquetValue(t api.ParquetTypeEnum, v any) (parquet.Value, error) {
+	switch t {
+	case api.ParquetBool:
+		b, err := utils.ConvertToBool(v)
+		return parquet.BooleanValue(b), err
+	case api.ParquetInt64:
+		n, err := utils.ConvertToInt64(v)
+		return parquet.Int64Value(n), err
+	case api.ParquetUint64:
+		n, err := utils.ConvertToUint64(v)
+		return parquet.Int64Value(int64(n)), err
+	case api.ParquetDouble:
+		f, err := utils.ConvertToFloat64(v)
+		return parquet.DoubleValue(f), err
+	case api.ParquetPort:
+		n, err := utils.ConvertToUint64(v)
+		if err == nil && n > 65535 {
+			err = fmt.Errorf("port %d out of range", n)
+		}
+		return parquet.Int32Value(int32(n)), err
+	case api.ParquetIP:
+		addr, err := netip.ParseAddr(utils.ConvertToString(v))
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.ByteArrayValue([]byte(addr.Unmap().String())), nil
+	case api.ParquetTimestamp:
+		n, err := utils.ConvertToInt64(v)
+		return parquet.Int64Value(time.Unix(n, 0).UnixMilli()), err
+	case api.ParquetTimestampMs:
+		n, err := utils.ConvertToInt64(v)
+		return parquet.Int64Value(n), err
+	}
+	return parquet.ByteArrayValue([]byte(utils.ConvertToString(v))), nil
+}
+
+// parquetColumns returns the configured columns, plus a column for each other field found in the flows.
+// The flows may have different fields: the schema is the superset of their fields, missing fields being null.
+// When a field has values of different types, it is written as a string.
+func parquetColumns(flows []config.GenericMap, params *api.EncodeS3Parquet) map[string]*parquetColumn {
+	columns := map[string]*parquetColumn{}
+	configured := map[string]bool{}
+	if params != nil {
+		for _, col := range params.Columns {
+			columns[col.Name] = &parquetColumn{ParquetColumn: col}
+			configured[col.Name] = true
+		}
+	}
+	for _, flow := range flows {
+		for name, v := range flow {
+			if v == nil || configured[name] {
+				continue
+			}
+			t := inferParquetType(v)
+			if col, ok := columns[name]; !ok {
+				columns[name] = &parquetColumn{ParquetColumn: api.ParquetColumn{Name: name, Type: t}}
+			} else if col.Type != t {
+				col.Type = api.ParquetString
+			}
+		}
+	}
+	return columns
+}
+
+// encodeParquet writes the object as a Parquet file: the flow logs are the rows, and the other header fields
+// are stored as key/value metadata
+func encodeParquet(object map[string]interface{}, params *api.EncodeS3Parquet) ([]byte, error) {
+	flows, _ := object["flow_logs"].([]config.GenericMap)
+	columns := parquetColumns(flows, params)
+	if len(columns) == 0 {
+		return nil, errors.New("can't write a Parquet file without columns")
+	}
+
+	group := parquet.Group{}
+	for name, col := range columns {
+		node, err := parquetNode(col.Type)
+		if err != nil {
+			return nil, err
+		}
+		if col.Compression != "" {
+			codec, err := parquetCodec(col.Compression)
+			if err != nil {
+				return nil, err
+			}
+			node = parquet.Compressed(node, codec)
+		}
+		group[name] = parquet.Optional(node)
+	}
+	schema := parquet.NewSchema("flow", group)
+	for name, col := range columns {
+		leaf, _ := schema.Lookup(name)
+		col.index = leaf.ColumnIndex
+	}
+
+	var compression api.ParquetCompressionEnum
+	if params != nil {
+		compression = params.Compression
+	}
+	codec, err := parquetCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+	options := []parquet.WriterOption{schema, parquet.Compression(codec)}
+	for key, value := range object {
+		if key == "flow_logs" {
+			continue
+		}
+		str, ok := value.(string)
+		if !ok {
+			b, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			str = string(b)
+		}
+		options = append(options, parquet.KeyValueMetadata(key, str))
+	}
+
+	buf := new(bytes.Buffer)
+	writer := parquet.NewWriter(buf, options...)
+	rows := make([]parquet.Row, 0, len(flows))
+	for _, flow := range flows {
+		row := make(parquet.Row, len(columns))
+		for name, col := range columns {
+			v, ok := flow[name]
+			if !ok || v == nil {
+				row[col.index] = parquet.NullValue().Level(0, 0, col.index)
+				continue
+			}
+			value, err := parquetValue(col.Type, v)
+			if err != nil {
+				log.Debugf("can't convert field %s to %s, writing null: %v", name, col.Type, err)
+				row[col.index] = parquet.NullValue().Level(0, 0, col.index)
+				continue
+			}
+			row[col.index] = value.Level(0, 1, col.index)
+		}
+		rows = append(rows, row)
+	}
+	if _, err := writer.WriteRows(rows); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
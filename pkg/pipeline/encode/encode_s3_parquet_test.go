@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	 http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encode
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+// readParquet returns the rows of a Parquet file as maps, null values being omitted
+func readParquet(t *testing.T, b []byte) (*parquet.File, []map[string]parquet.Value) {
+	f, err := parquet.OpenFile(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	reader := parquet.NewReader(f)
+	defer reader.Close()
+	rows := make([]parquet.Row, reader.NumRows())
+	n, err := reader.ReadRows(rows)
+	if err != io.EOF {
+		require.NoError(t, err)
+	}
+	var result []map[string]parquet.Value
+	for _, row := range rows[:n] {
+		values := map[string]parquet.Value{}
+		for _, v := range row {
+			if !v.IsNull() {
+				values[f.Schema().Columns()[v.Column()][0]] = v
+			}
+		}
+		result = append(result, values)
+	}
+	return f, result
+}
+
+func Test_EncodeParquet(t *testing.T) {
+	params := &api.EncodeS3Parquet{
+		Compression: api.ParquetZstd,
+		Columns: []api.ParquetColumn{
+			{Name: "SrcAddr", Type: api.ParquetIP},
+			{Name: "SrcPort", Type: api.ParquetPort, Compression: api.ParquetUncompressed},
+			{Name: "TimeFlowEndMs", Type: api.ParquetTimestampMs},
+			{Name: "TimeReceived", Type: api.ParquetTimestamp},
+			{Name: "Bytes", Type: api.ParquetUint64},
+		},
+	}
+	require.NoError(t, validateParquet(params))
+	object := map[string]interface{}{
+		"version":             flpS3Version,
+		"number_of_flow_logs": 3,
+		"flow_logs": []config.GenericMap{
+			{"SrcAddr": "::ffff:10.0.0.1", "SrcPort": 8080, "TimeFlowEndMs": int64(1700000000123), "TimeReceived": 1700000000, "Bytes": float64(100), "Namespace": "ns1"},
+			// heterogeneous flows: missing fields are null
+			{"SrcAddr": "fe80::1", "Packets": 3, "Namespace": 5},
+			// values that can't be converted are null
+			{"SrcAddr": "invalid", "SrcPort": 70000, "Duplicate": true},
+		},
+	}
+
+	b, err := encodeParquet(object, params)
+	require.NoError(t, err)
+	f, rows := readParquet(t, b)
+
+	version, _ := f.Lookup("version")
+	require.Equal(t, flpS3Version, version)
+	count, _ := f.Lookup("number_of_flow_logs")
+	require.Equal(t, "3", count)
+
+	// configured and inferred columns
+	schema := f.Schema()
+	for name, expected := range map[string]string{
+		"SrcAddr":       "STRING",
+		"SrcPort":       "INT(16,false)",
+		"TimeFlowEndMs": "TIMESTAMP(isAdjustedToUTC=true,unit=MILLIS)",
+		"Bytes":         "INT(64,false)",
+		"Packets":       "INT(64,true)",
+		"Duplicate":     "BOOLEAN",
+		// int and string values: written as strings
+		"Namespace": "STRING",
+	} {
+		leaf, ok := schema.Lookup(name)
+		require.True(t, ok, name)
+		require.Equal(t, expected, leaf.Node.Type().String(), name)
+	}
+
+	require.Len(t, rows, 3)
+	require.Equal(t, "10.0.0.1", rows[0]["SrcAddr"].String())
+	require.Equal(t, int32(8080), rows[0]["SrcPort"].Int32())
+	require.Equal(t, int64(1700000000123), rows[0]["TimeFlowEndMs"].Int64())
+	require.Equal(t, int64(1700000000000), rows[0]["TimeReceived"].Int64())
+	require.Equal(t, int64(100), rows[0]["Bytes"].Int64())
+	require.Equal(t, "ns1", rows[0]["Namespace"].String())
+	require.NotContains(t, rows[0], "Packets")
+
+	require.Equal(t, "fe80::1", rows[1]["SrcAddr"].String())
+	require.Equal(t, "5", rows[1]["Namespace"].String())
+	require.NotContains(t, rows[1], "SrcPort")
+
+	require.NotContains(t, rows[2], "SrcAddr")
+	require.NotContains(t, rows[2], "SrcPort")
+	require.True(t, rows[2]["Duplicate"].Boolean())
+}
+
+func Test_EncodeParquetEmpty(t *testing.T) {
+	_, err := encodeParquet(map[string]interface{}{"flow_logs": []config.GenericMap{}}, nil)
+	require.Error(t, err)
+
+	// with configured columns, the schema is known
+	b, err := encodeParquet(map[string]interface{}{"flow_logs": []config.GenericMap{}}, &api.EncodeS3Parquet{
+		Columns: []api.ParquetColumn{{Name: "SrcAddr", Type: api.ParquetIP}},
+	})
+	require.NoError(t, err)
+	_, rows := readParquet(t, b)
+	require.Empty(t, rows)
+}
+
+func Test_ValidateParquet(t *testing.T) {
+	for _, params := range []*api.EncodeS3Parquet{
+		{Compression: "lz5"},
+		{Columns: []api.ParquetColumn{{Name: "SrcAddr", Type: "inet"}}},
+		{Columns: []api.ParquetColumn{{Name: "SrcAddr", Type: api.ParquetIP}, {Name: "SrcAddr", Type: api.ParquetString}}},
+		{Columns: []api.ParquetColumn{{Name: "SrcAddr", Type: api.ParquetIP, Compression: "lz5"}}},
+	} {
+		require.Error(t, validateParquet(params), "%v", params)
+	}
+}
+
+func Test_EncodeS3Format(t *testing.T) {
+	for format, valid := range map[api.S3FormatEnum]bool{"": true, api.S3JSON: true, api.S3Parquet: true, "avro": false} {
+		_, err := NewEncodeS3(operational.NewMetrics(&config.MetricsSettings{}), config.StageParam{
+			Encode: &config.Encode{Type: api.S3Type, S3: &api.EncodeS3{Format: format}},
+		})
+		require.Equal(t, valid, err == nil, format)
+	}
+}
@@ -19,6 +19,7 @@ package encode
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -188,3 +189,84 @@ func Test_defaults(t *testing.T) {
 	require.Equal(t, defaultBatchSize, encodeS3.s3Params.BatchSize)
 	utils.CloseExitChannel()
 }
+
+const testS3ConfigPartitions = `---
+log-level: debug
+pipeline:
+  - name: encode3
+parameters:
+  - name: encode3
+    encode:
+      type: s3
+      s3:
+        endpoint: 1.2.3.4:9000
+        bucket: bucket1
+        account: account1
+        accessKeyId: accessKey1
+        secretAccessKey: secretAccessKey1
+        writeTimeout: 1h
+        batchSize: 2
+        keyTemplate: "flows/ns={field:SrcK8S_Namespace}/dt={year}-{month}-{day}/{seq}.json"
+        missingFieldValue: none
+`
+
+func Test_EncodeS3Partitions(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	encodeS3 := initNewEncodeS3(t, testS3ConfigPartitions)
+	fakeWriter := encodeS3.s3Writer.(*fakeS3Writer)
+	now := time.Now()
+	date := fmt.Sprintf("%04d-%02d-%02d", now.Year(), now.Month(), now.Day())
+
+	encodeS3.Encode(config.GenericMap{"SrcK8S_Namespace": "ns1", "Bytes": 1})
+	encodeS3.Encode(config.GenericMap{"SrcK8S_Namespace": "ns2", "Bytes": 2})
+	encodeS3.Encode(config.GenericMap{"Bytes": 3})
+	// the ns1 partition is full: it's written without waiting for the others
+	encodeS3.Encode(config.GenericMap{"SrcK8S_Namespace": "ns1", "Bytes": 4})
+	<-syncChan
+	fakeWriter.mutex.Lock()
+	require.Equal(t, []string{"flows/ns=ns1/dt=" + date + "/00000000.json"}, fakeWriter.objectNames)
+	require.Equal(t, 2, fakeWriter.objects[0]["number_of_flow_logs"])
+	fakeWriter.mutex.Unlock()
+
+	// values that would add levels to the key are escaped
+	encodeS3.Encode(config.GenericMap{"SrcK8S_Namespace": "a/b", "Bytes": 5})
+
+	// the remaining partitions are written on timeout
+	encodeS3.mutex.Lock()
+	encodeS3.flush()
+	encodeS3.mutex.Unlock()
+	for i := 0; i < 3; i++ {
+		<-syncChan
+	}
+	fakeWriter.mutex.Lock()
+	var prefixes, seqs []string
+	for _, name := range fakeWriter.objectNames[1:] {
+		i := strings.LastIndex(name, "/")
+		prefixes = append(prefixes, name[:i])
+		seqs = append(seqs, name[i+1:])
+	}
+	require.ElementsMatch(t, []string{
+		"flows/ns=ns2/dt=" + date,
+		"flows/ns=none/dt=" + date,
+		"flows/ns=a%2Fb/dt=" + date,
+	}, prefixes)
+	require.ElementsMatch(t, []string{"00000001.json", "00000002.json", "00000003.json"}, seqs)
+	fakeWriter.mutex.Unlock()
+	require.Empty(t, encodeS3.partitions)
+}
+
+func Test_S3KeyTemplateErrors(t *testing.T) {
+	for _, template := range []string{
+		"{account}/{year}",
+		"{account}/{unknown}/{seq}",
+		"{field}/{seq}",
+		"{year:2024}/{seq}",
+	} {
+		_, err := parseS3KeyTemplate(template)
+		require.Error(t, err, template)
+	}
+	parts, err := parseS3KeyTemplate(defaultS3KeyTemplate)
+	require.NoError(t, err)
+	require.Len(t, parts, 13)
+}
@@ -20,6 +20,7 @@ package encode
 import (
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
@@ -31,9 +32,12 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const labelTruncationMarker = "..."
+
 type mInfoStruct struct {
 	genericMetric interface{} // can be a counter, gauge, or histogram pointer
 	info          *metrics.Preprocessed
+	limiter       *cardinalityLimiter // nil without cardinality limit
 }
 
 type MetricsCommonStruct struct {
@@ -42,12 +46,20 @@ type MetricsCommonStruct struct {
 	histos           map[string]mInfoStruct
 	aggHistos        map[string]mInfoStruct
 	mCache           *putils.TimedCache
+	ttlCaches        map[time.Duration]*putils.TimedCache // series of the metrics that override expiryTime, by expiry
+	maxCacheEntries  int
+	cacheCallback    putils.CacheCallback
 	mChacheLenMetric prometheus.Gauge
 	metricsProcessed prometheus.Counter
 	metricsDropped   prometheus.Counter
 	errorsCounter    *prometheus.CounterVec
 	expiryTime       time.Duration
 	exitChan         <-chan struct{}
+	maxLabelLength   int
+	truncateFromLeft bool
+	cardinalityLimit int
+	// limiters are kept by metric name across the reloads, as the cached series release their room on expiry
+	limiters map[string]*cardinalityLimiter
 }
 
 type MetricsCommonInterface interface {
@@ -86,23 +98,35 @@ var (
 )
 
 func (m *MetricsCommonStruct) AddCounter(name string, g interface{}, info *metrics.Preprocessed) {
-	mStruct := mInfoStruct{genericMetric: g, info: info}
-	m.counters[name] = mStruct
+	m.counters[name] = m.newInfoStruct(name, g, info)
 }
 
 func (m *MetricsCommonStruct) AddGauge(name string, g interface{}, info *metrics.Preprocessed) {
-	mStruct := mInfoStruct{genericMetric: g, info: info}
-	m.gauges[name] = mStruct
+	m.gauges[name] = m.newInfoStruct(name, g, info)
 }
 
 func (m *MetricsCommonStruct) AddHist(name string, g interface{}, info *metrics.Preprocessed) {
-	mStruct := mInfoStruct{genericMetric: g, info: info}
-	m.histos[name] = mStruct
+	m.histos[name] = m.newInfoStruct(name, g, info)
 }
 
 func (m *MetricsCommonStruct) AddAggHist(name string, g interface{}, info *metrics.Preprocessed) {
+	m.aggHistos[name] = m.newInfoStruct(name, g, info)
+}
+
+func (m *MetricsCommonStruct) newInfoStruct(name string, g interface{}, info *metrics.Preprocessed) mInfoStruct {
 	mStruct := mInfoStruct{genericMetric: g, info: info}
-	m.aggHistos[name] = mStruct
+	if m.cardinalityLimit > 0 {
+		if m.limiters[name] == nil {
+			m.limiters[name] = newCardinalityLimiter(name, m.cardinalityLimit)
+		}
+		mStruct.limiter = m.limiters[name]
+	}
+	return mStruct
+}
+
+// SetCardinalityLimit caps the number of series of each metric added afterwards; 0 means unlimited
+func (m *MetricsCommonStruct) SetCardinalityLimit(limit int) {
+	m.cardinalityLimit = limit
 }
 
 func (m *MetricsCommonStruct) MetricCommonEncode(mci MetricsCommonInterface, metricRecord config.GenericMap) {
@@ -110,7 +134,7 @@ func (m *MetricsCommonStruct) MetricCommonEncode(mci MetricsCommonInterface, met
 
 	// Process counters
 	for _, mInfo := range m.counters {
-		labelSets, value := m.prepareMetric(mci, metricRecord, mInfo.info, mInfo.genericMetric)
+		labelSets, value := m.prepareMetric(mci, metricRecord, mInfo.info, mInfo.genericMetric, mInfo.limiter)
 		if labelSets == nil {
 			continue
 		}
@@ -127,7 +151,7 @@ func (m *MetricsCommonStruct) MetricCommonEncode(mci MetricsCommonInterface, met
 
 	// Process gauges
 	for _, mInfo := range m.gauges {
-		labelSets, value := m.prepareMetric(mci, metricRecord, mInfo.info, mInfo.genericMetric)
+		labelSets, value := m.prepareMetric(mci, metricRecord, mInfo.info, mInfo.genericMetric, mInfo.limiter)
 		if labelSets == nil {
 			continue
 		}
@@ -144,7 +168,7 @@ func (m *MetricsCommonStruct) MetricCommonEncode(mci MetricsCommonInterface, met
 
 	// Process histograms
 	for _, mInfo := range m.histos {
-		labelSets, value := m.prepareMetric(mci, metricRecord, mInfo.info, mInfo.genericMetric)
+		labelSets, value := m.prepareMetric(mci, metricRecord, mInfo.info, mInfo.genericMetric, mInfo.limiter)
 		if labelSets == nil {
 			continue
 		}
@@ -161,7 +185,7 @@ func (m *MetricsCommonStruct) MetricCommonEncode(mci MetricsCommonInterface, met
 
 	// Process pre-aggregated histograms
 	for _, mInfo := range m.aggHistos {
-		labelSets, values := m.prepareAggHisto(mci, metricRecord, mInfo.info, mInfo.genericMetric)
+		labelSets, values := m.prepareAggHisto(mci, metricRecord, mInfo.info, mInfo.genericMetric, mInfo.limiter)
 		if labelSets == nil {
 			continue
 		}
@@ -177,7 +201,7 @@ func (m *MetricsCommonStruct) MetricCommonEncode(mci MetricsCommonInterface, met
 	}
 }
 
-func (m *MetricsCommonStruct) prepareMetric(mci MetricsCommonInterface, flow config.GenericMap, info *metrics.Preprocessed, mv interface{}) ([]labelsKeyAndMap, float64) {
+func (m *MetricsCommonStruct) prepareMetric(mci MetricsCommonInterface, flow config.GenericMap, info *metrics.Preprocessed, mv interface{}, limiter *cardinalityLimiter) ([]labelsKeyAndMap, float64) {
 	flatParts := info.GenerateFlatParts(flow)
 	ok, flatParts := info.ApplyFilters(flow, flatParts)
 	if !ok {
@@ -200,12 +224,19 @@ func (m *MetricsCommonStruct) prepareMetric(mci MetricsCommonInterface, flow con
 	labelSets := extractLabels(flow, flatParts, info)
 	var lkms []labelsKeyAndMap
 	for _, ls := range labelSets {
+		m.truncateLabels(ls)
 		// Update entry for expiry mechanism (the entry itself is its own cleanup function)
-		lkm := ls.toKeyAndMap(info)
+		lkm, overflow := limitLabels(ls, info, limiter)
 		lkms = append(lkms, lkm)
 		cacheEntry := mci.GetChacheEntry(lkm.lMap, mv)
-		ok := m.mCache.UpdateCacheEntry(lkm.key, cacheEntry)
+		if limiter != nil {
+			cacheEntry = limiter.withRelease(cacheEntry, lkm.key, overflow)
+		}
+		ok := m.updateCacheEntry(info, lkm.key, cacheEntry)
 		if !ok {
+			if limiter != nil && !overflow {
+				limiter.release(lkm.key, false)
+			}
 			m.metricsDropped.Inc()
 			return nil, 0
 		}
@@ -213,7 +244,7 @@ func (m *MetricsCommonStruct) prepareMetric(mci MetricsCommonInterface, flow con
 	return lkms, floatVal
 }
 
-func (m *MetricsCommonStruct) prepareAggHisto(mci MetricsCommonInterface, flow config.GenericMap, info *metrics.Preprocessed, mc interface{}) ([]labelsKeyAndMap, []float64) {
+func (m *MetricsCommonStruct) prepareAggHisto(mci MetricsCommonInterface, flow config.GenericMap, info *metrics.Preprocessed, mc interface{}, limiter *cardinalityLimiter) ([]labelsKeyAndMap, []float64) {
 	flatParts := info.GenerateFlatParts(flow)
 	ok, flatParts := info.ApplyFilters(flow, flatParts)
 	if !ok {
@@ -233,12 +264,19 @@ func (m *MetricsCommonStruct) prepareAggHisto(mci MetricsCommonInterface, flow c
 	labelSets := extractLabels(flow, flatParts, info)
 	var lkms []labelsKeyAndMap
 	for _, ls := range labelSets {
+		m.truncateLabels(ls)
 		// Update entry for expiry mechanism (the entry itself is its own cleanup function)
-		lkm := ls.toKeyAndMap(info)
+		lkm, overflow := limitLabels(ls, info, limiter)
 		lkms = append(lkms, lkm)
 		cacheEntry := mci.GetChacheEntry(lkm.lMap, mc)
-		ok := m.mCache.UpdateCacheEntry(lkm.key, cacheEntry)
+		if limiter != nil {
+			cacheEntry = limiter.withRelease(cacheEntry, lkm.key, overflow)
+		}
+		ok := m.updateCacheEntry(info, lkm.key, cacheEntry)
 		if !ok {
+			if limiter != nil && !overflow {
+				limiter.release(lkm.key, false)
+			}
 			m.metricsDropped.Inc()
 			return nil, nil
 		}
@@ -246,6 +284,36 @@ func (m *MetricsCommonStruct) prepareAggHisto(mci MetricsCommonInterface, flow c
 	return lkms, values
 }
 
+// updateCacheEntry refreshes the series in the cache matching the metric expiry. When a series expires, the cache
+// callback deletes it: if it shows up again later, it restarts from zero rather than from its previous value.
+func (m *MetricsCommonStruct) updateCacheEntry(info *metrics.Preprocessed, key string, entry interface{}) bool {
+	cache := m.mCache
+	if info.ExpiryTime != nil && info.ExpiryTime.Duration != 0 && info.ExpiryTime.Duration != m.expiryTime {
+		expiry := info.ExpiryTime.Duration
+		var ok bool
+		if cache, ok = m.ttlCaches[expiry]; !ok {
+			cache = putils.NewTimedCache(0, m.mChacheLenMetric)
+			m.ttlCaches[expiry] = cache
+			go m.cleanupExpiredEntriesLoop(cache, expiry, m.cacheCallback)
+		}
+	}
+	if m.maxCacheEntries > 0 && len(m.ttlCaches) > 0 {
+		// maxCacheEntries applies to all the series, whatever their expiry
+		if _, found := cache.GetCacheEntry(key); !found && m.cacheLen() >= m.maxCacheEntries {
+			return false
+		}
+	}
+	return cache.UpdateCacheEntry(key, entry)
+}
+
+func (m *MetricsCommonStruct) cacheLen() int {
+	total := m.mCache.GetCacheLen()
+	for _, cache := range m.ttlCaches {
+		total += cache.GetCacheLen()
+	}
+	return total
+}
+
 func (m *MetricsCommonStruct) extractGenericValue(flow config.GenericMap, info *metrics.Preprocessed) interface{} {
 	if info.ValueKey == "" {
 		// No value key means it's a records / flows counter (1 flow = 1 increment), so just return 1
@@ -313,15 +381,44 @@ func newLabelSet(part config.GenericMap, labels []metrics.MappedLabel) labelSet
 	return ls
 }
 
-func (m *MetricsCommonStruct) cleanupExpiredEntriesLoop(callback putils.CacheCallback) {
-	ticker := time.NewTicker(m.expiryTime)
+// SetLabelTruncation limits the number of characters of the label values; 0 means unlimited
+func (m *MetricsCommonStruct) SetLabelTruncation(maxLength int, fromLeft bool) {
+	m.maxLabelLength = maxLength
+	m.truncateFromLeft = fromLeft
+}
+
+// truncateLabels truncates the long label values before the series key is built, so that the flows of values
+// truncated the same way, or equal to the truncated value, are counted in the same series
+func (m *MetricsCommonStruct) truncateLabels(ls labelSet) {
+	if m.maxLabelLength == 0 {
+		return
+	}
+	for i := range ls {
+		ls[i].value = truncateLabelValue(ls[i].value, m.maxLabelLength, m.truncateFromLeft)
+	}
+}
+
+func truncateLabelValue(value string, maxLength int, fromLeft bool) string {
+	if len(value) <= maxLength || utf8.RuneCountInString(value) <= maxLength {
+		return value
+	}
+	runes := []rune(value)
+	kept := maxLength - len(labelTruncationMarker)
+	if fromLeft {
+		return labelTruncationMarker + string(runes[len(runes)-kept:])
+	}
+	return string(runes[:kept]) + labelTruncationMarker
+}
+
+func (m *MetricsCommonStruct) cleanupExpiredEntriesLoop(cache *putils.TimedCache, expiry time.Duration, callback putils.CacheCallback) {
+	ticker := time.NewTicker(expiry)
 	for {
 		select {
 		case <-m.exitChan:
 			log.Debugf("exiting cleanupExpiredEntriesLoop because of signal")
 			return
 		case <-ticker.C:
-			m.mCache.CleanupExpiredEntries(m.expiryTime, callback)
+			cache.CleanupExpiredEntries(expiry, callback)
 		}
 	}
 }
@@ -337,6 +434,9 @@ func NewMetricsCommonStruct(opMetrics *operational.Metrics, maxCacheEntries int,
 	mChacheLenMetric := opMetrics.NewGauge(&mChacheLen, name)
 	m := &MetricsCommonStruct{
 		mCache:           putils.NewTimedCache(maxCacheEntries, mChacheLenMetric),
+		ttlCaches:        map[time.Duration]*putils.TimedCache{},
+		maxCacheEntries:  maxCacheEntries,
+		cacheCallback:    callback,
 		mChacheLenMetric: mChacheLenMetric,
 		metricsProcessed: opMetrics.NewCounter(&metricsProcessed, name),
 		metricsDropped:   opMetrics.NewCounter(&metricsDropped, name),
@@ -347,7 +447,8 @@ func NewMetricsCommonStruct(opMetrics *operational.Metrics, maxCacheEntries int,
 		counters:         map[string]mInfoStruct{},
 		histos:           map[string]mInfoStruct{},
 		aggHistos:        map[string]mInfoStruct{},
+		limiters:         map[string]*cardinalityLimiter{},
 	}
-	go m.cleanupExpiredEntriesLoop(callback)
+	go m.cleanupExpiredEntriesLoop(m.mCache, m.expiryTime, callback)
 	return m
 }
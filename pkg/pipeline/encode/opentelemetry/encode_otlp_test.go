@@ -18,8 +18,17 @@
 package opentelemetry
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	otel "github.com/agoda-com/opentelemetry-logs-go"
 	"github.com/agoda-com/opentelemetry-logs-go/logs"
@@ -27,8 +36,15 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 const testOtlpConfig = `---
@@ -173,6 +189,79 @@ func Test_EncodeOtlpTraces(t *testing.T) {
 	require.NotNil(t, newEncode)
 }
 
+type spanRecorder struct {
+	sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (r *spanRecorder) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	r.Lock()
+	defer r.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Shutdown(_ context.Context) error {
+	return nil
+}
+
+func Test_EncodeOtlpConnectionSpans(t *testing.T) {
+	recorder := &spanRecorder{}
+	connections := api.OtlpConnectionSpans{ConversationIDField: "ConversationId"}
+	connections.SetDefaults()
+	encoder := &EncodeOtlpTrace{
+		cfg: api.EncodeOtlpTraces{Connections: &connections},
+		ctx: context.Background(),
+		tp: sdktrace.NewTracerProvider(
+			sdktrace.WithSyncer(recorder),
+			sdktrace.WithIDGenerator(conversationIDGenerator{}),
+		),
+	}
+
+	connection := func(recordType any, conversation string, srcPort int) config.GenericMap {
+		return config.GenericMap{
+			api.RecordTypeFieldName: recordType,
+			"ConversationId":        conversation,
+			"SrcAddr":               "10.0.0.1",
+			"SrcPort":               srcPort,
+			"DstAddr":               "10.0.0.2",
+			"DstPort":               443,
+			"Bytes":                 1234,
+			"TimeFlowStartMs":       1700000000000,
+			"TimeFlowEndMs":         1700000002500,
+		}
+	}
+	encoder.Encode(connection(api.ConnTrackEndConnection, "conv1", 1000))
+	// records decoded from JSON hold the record type as a string
+	encoder.Encode(connection("endConnection", "conv1", 1001))
+	encoder.Encode(connection(api.ConnTrackEndConnection, "conv2", 1002))
+	// other records are ignored
+	encoder.Encode(connection(api.ConnTrackFlowLog, "conv1", 1003))
+	encoder.Encode(config.GenericMap{"SrcAddr": "10.0.0.1"})
+
+	require.Len(t, recorder.spans, 3)
+	traceIDs := make([]trace.TraceID, 0, 3)
+	for _, span := range recorder.spans {
+		traceIDs = append(traceIDs, span.SpanContext().TraceID())
+		require.Equal(t, "connection", span.Name())
+		require.Equal(t, trace.SpanKindClient, span.SpanKind())
+		require.False(t, span.Parent().IsValid())
+		require.Equal(t, time.UnixMilli(1700000000000), span.StartTime())
+		require.Equal(t, 2500*time.Millisecond, span.EndTime().Sub(span.StartTime()))
+		attributes := map[string]string{}
+		for _, a := range span.Attributes() {
+			attributes[string(a.Key)] = a.Value.Emit()
+		}
+		require.Equal(t, "10.0.0.1", attributes["source.address"])
+		require.Equal(t, "443", attributes["destination.port"])
+		require.Equal(t, "1234", attributes["Bytes"])
+	}
+	// the connections of a conversation share the same trace
+	require.Equal(t, traceIDs[0], traceIDs[1])
+	require.NotEqual(t, traceIDs[0], traceIDs[2])
+	require.True(t, traceIDs[2].IsValid())
+}
+
 func Test_EncodeOtlpMetrics(t *testing.T) {
 	cfg := config.StageParam{
 		Encode: &config.Encode{
@@ -196,3 +285,115 @@ func Test_EncodeOtlpMetrics(t *testing.T) {
 	require.NotNil(t, newEncode)
 	// TODO: add more tests
 }
+
+func Test_EncodeOtlpMetricsRoundTrip(t *testing.T) {
+	// mock OTLP/HTTP receiver
+	received := make(chan *colmetricpb.ExportMetricsServiceRequest, 10)
+	var authHeader atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := colmetricpb.ExportMetricsServiceRequest{}
+		require.NoError(t, proto.Unmarshal(body, &req))
+		authHeader.Store(r.Header.Get("Authorization"))
+		received <- &req
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		out, _ := proto.Marshal(&colmetricpb.ExportMetricsServiceResponse{})
+		_, _ = w.Write(out)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(serverURL.Port())
+	require.NoError(t, err)
+
+	utils.InitExitChannel()
+	cfg := config.StageParam{
+		Encode: &config.Encode{
+			OtlpMetrics: &api.EncodeOtlpMetrics{
+				OtlpConnectionInfo: &api.OtlpConnectionInfo{
+					Address:        serverURL.Hostname(),
+					Port:           port,
+					ConnectionType: "http",
+					Headers:        map[string]string{"Authorization": "Bearer my-token"},
+				},
+				Prefix: "flp_",
+				// long enough so that only the flush on exit pushes metrics
+				PushTimeInterval:   api.Duration{Duration: time.Hour},
+				ResourceAttributes: map[string]string{"k8s.cluster.name": "my-cluster"},
+				Metrics: []api.MetricsItem{
+					{Name: "bytes_total", Type: "counter", ValueKey: "Bytes", Labels: []string{"SrcNamespace"}},
+					{Name: "rtt", Type: "gauge", ValueKey: "Rtt", Labels: []string{"SrcNamespace"}},
+					{Name: "packets", Type: "histogram", ValueKey: "Packets", Labels: []string{"SrcNamespace"}, Buckets: []float64{1, 10, 100}},
+					{Name: "flow_bytes", Type: "agg_histogram", ValueKey: "recent_raw_values", Labels: []string{"SrcNamespace"}, Buckets: []float64{100, 1000}},
+				},
+			}},
+	}
+	newEncode, err := NewEncodeOtlpMetrics(operational.NewMetrics(&config.MetricsSettings{}), cfg)
+	require.NoError(t, err)
+
+	newEncode.Encode(config.GenericMap{"SrcNamespace": "ns-a", "Bytes": 100, "Rtt": 5, "Packets": 3})
+	newEncode.Encode(config.GenericMap{"SrcNamespace": "ns-a", "Bytes": 50, "Rtt": 7, "Packets": 20})
+	newEncode.Encode(config.GenericMap{"SrcNamespace": "ns-b", "Bytes": 10, "Rtt": 1, "Packets": 1})
+	newEncode.Encode(config.GenericMap{"SrcNamespace": "ns-a", "recent_raw_values": []float64{50, 500, 5000}})
+
+	// pending metrics are flushed on exit
+	utils.CloseExitChannel()
+	var req *colmetricpb.ExportMetricsServiceRequest
+	select {
+	case req = <-received:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timeout waiting for metrics to be exported")
+	}
+	require.Equal(t, "Bearer my-token", authHeader.Load())
+
+	byName := map[string]*metricpb.Metric{}
+	for _, rm := range req.ResourceMetrics {
+		resourceAttributes := map[string]string{}
+		for _, a := range rm.Resource.Attributes {
+			resourceAttributes[a.Key] = a.Value.GetStringValue()
+		}
+		require.Equal(t, "my-cluster", resourceAttributes["k8s.cluster.name"])
+		require.Equal(t, "netobserv-otlp", resourceAttributes["service.name"])
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				byName[m.Name] = m
+			}
+		}
+	}
+	require.Len(t, byName, 4)
+
+	nsValue := func(attrs []*commonpb.KeyValue) string {
+		for _, a := range attrs {
+			if a.Key == "SrcNamespace" {
+				return a.Value.GetStringValue()
+			}
+		}
+		return ""
+	}
+
+	counters := map[string]float64{}
+	for _, dp := range byName["flp_bytes_total"].GetSum().DataPoints {
+		counters[nsValue(dp.Attributes)] = dp.GetAsDouble()
+	}
+	require.Equal(t, map[string]float64{"ns-a": 150, "ns-b": 10}, counters)
+
+	gauges := map[string]float64{}
+	for _, dp := range byName["flp_rtt"].GetGauge().DataPoints {
+		gauges[nsValue(dp.Attributes)] = dp.GetAsDouble()
+	}
+	require.Equal(t, map[string]float64{"ns-a": 7, "ns-b": 1}, gauges)
+
+	histos := map[string][]uint64{}
+	for _, dp := range byName["flp_packets"].GetHistogram().DataPoints {
+		require.Equal(t, []float64{1, 10, 100}, dp.ExplicitBounds)
+		histos[nsValue(dp.Attributes)] = dp.BucketCounts
+	}
+	require.Equal(t, map[string][]uint64{"ns-a": {0, 1, 1, 0}, "ns-b": {1, 0, 0, 0}}, histos)
+
+	aggHistos := map[string][]uint64{}
+	for _, dp := range byName["flp_flow_bytes"].GetHistogram().DataPoints {
+		aggHistos[nsValue(dp.Attributes)] = dp.BucketCounts
+	}
+	require.Equal(t, map[string][]uint64{"ns-a": {1, 1, 1}}, aggHistos)
+}
@@ -55,7 +55,7 @@ func NewEncodeOtlpLogs(_ *operational.Metrics, params config.StageParam) (encode
 	log.Debugf("NewEncodeOtlpLogs cfg = %v \n", cfg)
 
 	ctx := context.Background()
-	res := newResource()
+	res := newResource(nil)
 
 	lp, err := NewOtlpLoggerProvider(ctx, params, res)
 	if err != nil {
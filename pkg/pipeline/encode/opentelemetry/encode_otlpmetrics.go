@@ -19,6 +19,7 @@ package opentelemetry
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
@@ -26,8 +27,8 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode/metrics"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	log "github.com/sirupsen/logrus"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
@@ -35,6 +36,7 @@ import (
 )
 
 const defaultExpiryTime = time.Duration(2 * time.Minute)
+const shutdownTimeout = 5 * time.Second
 const flpMeterName = "flp_meter"
 
 type EncodeOtlpMetrics struct {
@@ -65,7 +67,7 @@ func (e *EncodeOtlpMetrics) ProcessCounter(m interface{}, labels map[string]stri
 }
 
 func (e *EncodeOtlpMetrics) ProcessGauge(m interface{}, labels map[string]string, value float64, key string) error {
-	obs := m.(Float64Gauge)
+	obs := m.(*Float64Gauge)
 	// set attributes using the labels
 	attributes := obtainAttributesFromLabels(labels)
 	obs.Set(key, value, attributes)
@@ -103,7 +105,7 @@ func NewEncodeOtlpMetrics(opMetrics *operational.Metrics, params config.StagePar
 	log.Debugf("NewEncodeOtlpMetrics cfg = %v \n", cfg)
 
 	ctx := context.Background()
-	res := newResource()
+	res := newResource(cfg.ResourceAttributes)
 
 	mp, err := NewOtlpMetricsProvider(ctx, params, res)
 	if err != nil {
@@ -118,14 +120,12 @@ func NewEncodeOtlpMetrics(opMetrics *operational.Metrics, params config.StagePar
 		expiryTime.Duration = defaultExpiryTime
 	}
 
-	meterFactory := otel.Meter(flpMeterName)
-
 	w := &EncodeOtlpMetrics{
 		cfg:   cfg,
 		ctx:   ctx,
 		res:   res,
 		mp:    mp,
-		meter: meterFactory,
+		meter: meter,
 	}
 
 	metricCommon := encode.NewMetricsCommonStruct(opMetrics, 0, params.Name, expiryTime, nil)
@@ -147,8 +147,8 @@ func NewEncodeOtlpMetrics(opMetrics *operational.Metrics, params config.StagePar
 			metricCommon.AddCounter(fullMetricName, counter, mInfo)
 		case api.MetricGauge:
 			// at implementation time, only asynchronous gauges are supported by otel in golang
-			obs := Float64Gauge{observations: make(map[string]Float64GaugeEntry)}
-			gauge, err := meterFactory.Float64ObservableGauge(
+			obs := &Float64Gauge{observations: make(map[string]Float64GaugeEntry)}
+			_, err := meter.Float64ObservableGauge(
 				fullMetricName,
 				metric.WithFloat64Callback(obs.Callback),
 			)
@@ -156,8 +156,8 @@ func NewEncodeOtlpMetrics(opMetrics *operational.Metrics, params config.StagePar
 				log.Errorf("error during gauge creation: %v", err)
 				return nil, err
 			}
-			metricCommon.AddGauge(fullMetricName, gauge, mInfo)
-		case api.MetricHistogram:
+			metricCommon.AddGauge(fullMetricName, obs, mInfo)
+		case api.MetricHistogram, api.MetricAggHistogram:
 			var histo metric.Float64Histogram
 			if len(mCfg.Buckets) == 0 {
 				histo, err = meter.Float64Histogram(fullMetricName)
@@ -171,18 +171,35 @@ func NewEncodeOtlpMetrics(opMetrics *operational.Metrics, params config.StagePar
 				log.Errorf("error during histogram creation: %v", err)
 				return nil, err
 			}
-			metricCommon.AddHist(fullMetricName, histo, mInfo)
-		case api.MetricAggHistogram:
-			fallthrough
+			// agg_histogram records the raw values of each aggregate, e.g. recent_raw_values
+			if mCfg.Type == api.MetricAggHistogram {
+				metricCommon.AddAggHist(fullMetricName, histo, mInfo)
+			} else {
+				metricCommon.AddHist(fullMetricName, histo, mInfo)
+			}
 		default:
 			log.Errorf("invalid metric type = %v, skipping", mCfg.Type)
 			continue
 		}
 	}
 
+	w.shutdownOnExit(utils.ExitChannel())
+
 	return w, nil
 }
 
+// shutdownOnExit flushes pending metrics to the collector, then stops the exporter, when the pipeline exits
+func (e *EncodeOtlpMetrics) shutdownOnExit(exitChan <-chan struct{}) {
+	go func() {
+		<-exitChan
+		ctx, cancel := context.WithTimeout(e.ctx, shutdownTimeout)
+		defer cancel()
+		if err := e.mp.Shutdown(ctx); err != nil {
+			log.WithError(err).Warn("error while flushing OTLP metrics on shutdown")
+		}
+	}()
+}
+
 // At present, golang only supports asynchronous gauge, so we have some function here to support this
 
 type Float64GaugeEntry struct {
@@ -191,12 +208,15 @@ type Float64GaugeEntry struct {
 }
 
 type Float64Gauge struct {
+	mutex        sync.Mutex
 	observations map[string]Float64GaugeEntry
 }
 
 // Callback implements the callback function for the underlying asynchronous gauge
 // it observes the current state of all previous Set() calls.
 func (f *Float64Gauge) Callback(_ context.Context, o metric.Float64Observer) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	for _, fEntry := range f.observations {
 		o.Observe(fEntry.value, metric.WithAttributes(fEntry.attributes...))
 	}
@@ -206,6 +226,8 @@ func (f *Float64Gauge) Callback(_ context.Context, o metric.Float64Observer) err
 }
 
 func (f *Float64Gauge) Set(key string, val float64, attrs []attribute.KeyValue) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	f.observations[key] = Float64GaugeEntry{
 		value:      val,
 		attributes: attrs,
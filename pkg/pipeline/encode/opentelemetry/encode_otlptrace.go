@@ -19,22 +19,37 @@ package opentelemetry
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"strings"
+	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	flpTracerName     = "flp_tracer"
-	flpEncodeSpanName = "flp_encode"
+	flpTracerName         = "flp_tracer"
+	flpEncodeSpanName     = "flp_encode"
+	flpConnectionSpanName = "connection"
 )
 
+// endpoint fields of the connections, mapped to the OpenTelemetry semantic conventions
+var connectionEndpointAttributes = map[string]attribute.Key{
+	"SrcAddr": "source.address",
+	"SrcPort": "source.port",
+	"DstAddr": "destination.address",
+	"DstPort": "destination.port",
+}
+
 type EncodeOtlpTrace struct {
 	cfg api.EncodeOtlpTraces
 	ctx context.Context
@@ -45,6 +60,10 @@ type EncodeOtlpTrace struct {
 // Encode encodes a metric to be exported
 func (e *EncodeOtlpTrace) Encode(entry config.GenericMap) {
 	log.Tracef("entering EncodeOtlpTrace. entry = %v", entry)
+	if e.cfg.Connections != nil {
+		e.encodeConnection(entry)
+		return
+	}
 	tr := e.tp.Tracer(flpTracerName)
 	ll := len(e.cfg.SpanSplitter)
 
@@ -91,6 +110,62 @@ OUTER:
 	}
 }
 
+// encodeConnection reports an endConnection record as a span going from the connection start to its end
+func (e *EncodeOtlpTrace) encodeConnection(entry config.GenericMap) {
+	if recordType, ok := entry[api.RecordTypeFieldName]; !ok || utils.ConvertToString(recordType) != string(api.ConnTrackEndConnection) {
+		return
+	}
+	cfg := e.cfg.Connections
+	ctx := e.ctx
+	if conversationID, ok := entry[cfg.ConversationIDField]; ok {
+		ctx = withConversationTraceID(ctx, utils.ConvertToString(conversationID))
+	}
+	start, end := time.Now(), time.Now()
+	if ms, err := utils.ConvertToInt64(entry[cfg.StartTimeField]); err == nil {
+		start = time.UnixMilli(ms)
+	}
+	if ms, err := utils.ConvertToInt64(entry[cfg.EndTimeField]); err == nil {
+		end = time.UnixMilli(ms)
+	}
+	attributes := *obtainAttributesFromEntry(entry)
+	for field, key := range connectionEndpointAttributes {
+		if v, ok := entry[field]; ok {
+			attributes = append(attributes, key.String(utils.ConvertToString(v)))
+		}
+	}
+	_, span := e.tp.Tracer(flpTracerName).Start(ctx, flpConnectionSpanName,
+		trace.WithTimestamp(start), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	span.End(trace.WithTimestamp(end))
+}
+
+type conversationTraceIDKey struct{}
+
+// withConversationTraceID sets the trace ID of the spans started from the context, derived from the conversation ID
+func withConversationTraceID(ctx context.Context, conversationID string) context.Context {
+	sum := sha256.Sum256([]byte(conversationID))
+	var traceID trace.TraceID
+	copy(traceID[:], sum[:])
+	return context.WithValue(ctx, conversationTraceIDKey{}, traceID)
+}
+
+// conversationIDGenerator gives the root spans the trace ID set by withConversationTraceID, so that the
+// connections of a conversation share the same trace. Other IDs are random.
+type conversationIDGenerator struct{}
+
+func (conversationIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	traceID, ok := ctx.Value(conversationTraceIDKey{}).(trace.TraceID)
+	if !ok {
+		_, _ = rand.Read(traceID[:])
+	}
+	return traceID, conversationIDGenerator{}.NewSpanID(ctx, traceID)
+}
+
+func (conversationIDGenerator) NewSpanID(_ context.Context, _ trace.TraceID) trace.SpanID {
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+	return spanID
+}
+
 func (e *EncodeOtlpTrace) Update(_ config.StageParam) {
 	log.Warn("EncodeOtlpTrace, update not supported")
 }
@@ -101,12 +176,15 @@ func NewEncodeOtlpTraces(_ *operational.Metrics, params config.StageParam) (enco
 	if params.Encode != nil && params.Encode.OtlpTraces != nil {
 		cfg = *params.Encode.OtlpTraces
 	}
+	if cfg.Connections != nil {
+		cfg.Connections.SetDefaults()
+	}
 	log.Debugf("NewEncodeOtlpTraces cfg = %v \n", cfg)
 
 	ctx := context.Background()
-	res := newResource()
+	res := newResource(nil)
 
-	tp, err := NewOtlpTracerProvider(ctx, params, res)
+	tp, err := NewOtlpTracerProvider(ctx, params, res, sdktrace.WithIDGenerator(conversationIDGenerator{}))
 	if err != nil {
 		return nil, err
 	}
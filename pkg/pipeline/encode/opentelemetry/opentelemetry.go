@@ -60,7 +60,7 @@ const (
 	httpType               = "http"
 )
 
-func NewOtlpTracerProvider(ctx context.Context, params config.StageParam, res *resource.Resource) (*sdktrace.TracerProvider, error) {
+func NewOtlpTracerProvider(ctx context.Context, params config.StageParam, res *resource.Resource, opts ...sdktrace.TracerProviderOption) (*sdktrace.TracerProvider, error) {
 	cfg := api.EncodeOtlpTraces{}
 	if params.Encode != nil && params.Encode.OtlpTraces != nil {
 		cfg = *params.Encode.OtlpTraces
@@ -113,10 +113,11 @@ func NewOtlpTracerProvider(ctx context.Context, params config.StageParam, res *r
 	} else {
 		return nil, fmt.Errorf("must specify grpcaddress or httpaddress")
 	}
-	traceProvider = sdktrace.NewTracerProvider(
+	opts = append([]sdktrace.TracerProviderOption{
 		sdktrace.WithResource(res),
 		sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(traceExporter)),
-	)
+	}, opts...)
+	traceProvider = sdktrace.NewTracerProvider(opts...)
 
 	otel.SetTracerProvider(traceProvider)
 	return traceProvider, nil
@@ -150,7 +151,8 @@ func NewOtlpMetricsProvider(ctx context.Context, params config.StageParam, res *
 			tlsOption = otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig))
 		}
 		expOption = otlpmetricgrpc.WithEndpoint(addr)
-		metricExporter, err = otlpmetricgrpc.New(ctx, expOption, tlsOption)
+		metricExporter, err = otlpmetricgrpc.New(ctx, expOption, tlsOption,
+			otlpmetricgrpc.WithHeaders(cfg.Headers))
 		if err != nil {
 			return nil, err
 		}
@@ -172,7 +174,8 @@ func NewOtlpMetricsProvider(ctx context.Context, params config.StageParam, res *
 			tlsOption = otlpmetrichttp.WithTLSClientConfig(tlsConfig)
 		}
 		expOption = otlpmetrichttp.WithEndpoint(addr)
-		metricExporter, err = otlpmetrichttp.New(ctx, expOption, tlsOption)
+		metricExporter, err = otlpmetrichttp.New(ctx, expOption, tlsOption,
+			otlpmetrichttp.WithHeaders(cfg.Headers))
 		if err != nil {
 			return nil, err
 		}
@@ -339,15 +342,16 @@ func (e *EncodeOtlpMetrics) MetricWrite(_ config.GenericMap) {
 	// nothing more to do at present
 }
 
-// newResource returns a resource describing this application.
-func newResource() *resource.Resource {
+// newResource returns a resource describing this application, with the given extra attributes.
+func newResource(extraAttributes map[string]string) *resource.Resource {
+	attributes := []attribute.KeyValue{
+		semconv.ServiceName(flpOtlpResourceName),
+		semconv.ServiceVersion(flpOtlpResourceVersion),
+	}
+	attributes = append(attributes, obtainAttributesFromLabels(extraAttributes)...)
 	r, _ := resource.Merge(
 		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName(flpOtlpResourceName),
-			semconv.ServiceVersion(flpOtlpResourceVersion),
-		),
+		resource.NewWithAttributes(semconv.SchemaURL, attributes...),
 	)
 	return r
 }
@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode/metrics"
+)
+
+// alertRateInterval is the range of the rate computed for counters and histograms
+const alertRateInterval = "5m"
+
+// PrometheusRule is the subset of the prometheus-operator PrometheusRule resource used for alerting rules
+type PrometheusRule struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   PrometheusRuleMeta `yaml:"metadata"`
+	Spec       PrometheusRuleSpec `yaml:"spec"`
+}
+
+type PrometheusRuleMeta struct {
+	Name string `yaml:"name"`
+}
+
+type PrometheusRuleSpec struct {
+	Groups []RuleGroup `yaml:"groups"`
+}
+
+type RuleGroup struct {
+	Name  string      `yaml:"name"`
+	Rules []AlertRule `yaml:"rules"`
+}
+
+type AlertRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// GenerateAlerts builds a PrometheusRule with an alert for every metric of the prom encode stages
+// that has an alertThreshold, in a rule group per stage.
+func GenerateAlerts(name string, params []config.StageParam) (*PrometheusRule, error) {
+	rule := PrometheusRule{
+		APIVersion: "monitoring.coreos.com/v1",
+		Kind:       "PrometheusRule",
+		Metadata:   PrometheusRuleMeta{Name: name},
+	}
+	for i := range params {
+		if params[i].Encode == nil || params[i].Encode.Prom == nil {
+			continue
+		}
+		group := RuleGroup{Name: params[i].Name}
+		prom := params[i].Encode.Prom
+		for j := range prom.Metrics {
+			item := &prom.Metrics[j]
+			if err := item.Validate(); err != nil {
+				return nil, fmt.Errorf("stage %s: %w", params[i].Name, err)
+			}
+			if item.AlertThreshold == nil {
+				continue
+			}
+			alert, err := metricAlert(prom.Prefix+item.Name, item)
+			if err != nil {
+				return nil, fmt.Errorf("stage %s: %w", params[i].Name, err)
+			}
+			group.Rules = append(group.Rules, alert)
+		}
+		if len(group.Rules) > 0 {
+			rule.Spec.Groups = append(rule.Spec.Groups, group)
+		}
+	}
+	return &rule, nil
+}
+
+// metricAlert compares the threshold with the per-second rate of counters, the value of gauges and the
+// average of histograms
+func metricAlert(fullName string, item *api.MetricsItem) (AlertRule, error) {
+	threshold := strconv.FormatFloat(*item.AlertThreshold, 'g', -1, 64)
+	var expr, summary string
+	switch item.Type {
+	case api.MetricCounter:
+		expr = fmt.Sprintf("rate(%s[%s]) > %s", fullName, alertRateInterval, threshold)
+		summary = fmt.Sprintf("%s is above %s per second", fullName, threshold)
+	case api.MetricGauge:
+		expr = fmt.Sprintf("%s > %s", fullName, threshold)
+		summary = fmt.Sprintf("%s is above %s", fullName, threshold)
+	case api.MetricHistogram, api.MetricAggHistogram:
+		expr = fmt.Sprintf("rate(%s_sum[%s]) / rate(%s_count[%s]) > %s", fullName, alertRateInterval, fullName, alertRateInterval, threshold)
+		summary = fmt.Sprintf("average of %s is above %s", fullName, threshold)
+	default:
+		return AlertRule{}, fmt.Errorf("metric %s: alerts are not supported for type %q", item.Name, item.Type)
+	}
+	if labels := metrics.Preprocess(item).TargetLabels(); len(labels) > 0 {
+		values := make([]string, 0, len(labels))
+		for _, l := range labels {
+			values = append(values, fmt.Sprintf("%s={{ $labels.%s }}", l, l))
+		}
+		summary += " (" + strings.Join(values, ", ") + ")"
+	}
+	severity := item.AlertSeverity
+	if severity == "" {
+		severity = api.DefaultAlertSeverity
+	}
+	return AlertRule{
+		Alert:  alertName(fullName),
+		Expr:   expr,
+		Labels: map[string]string{"severity": severity},
+		Annotations: map[string]string{
+			"summary":     summary,
+			"description": fmt.Sprintf("%s crossed the threshold of %s; current value: {{ $value }}", fullName, threshold),
+		},
+	}, nil
+}
+
+// alertName converts a metric name to CamelCase, e.g. netobserv_bytes_total gives NetobservBytesTotalAboveThreshold
+func alertName(metricName string) string {
+	var sb strings.Builder
+	for _, part := range strings.Split(metricName, "_") {
+		if part == "" {
+			continue
+		}
+		sb.WriteString(strings.ToUpper(part[:1]))
+		sb.WriteString(part[1:])
+	}
+	sb.WriteString("AboveThreshold")
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package encode
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const overflowLabelValue = "__overflow__"
+
+// cardinalityLimiter caps the number of series of a metric: beyond the limit, the label values of the new series are
+// replaced with __overflow__, so that their flows are all counted in a single overflow series. Checking a known series
+// doesn't take any lock, as the encoder checks each series of each flow.
+type cardinalityLimiter struct {
+	limit int64
+	count atomic.Int64
+	// series holds the keys of the admitted series, released when they expire
+	series sync.Map
+	// overflowed holds the keys of the series counted in the overflow series, forgotten when it expires
+	overflowed    sync.Map
+	overflowCount prometheus.Gauge
+}
+
+func newCardinalityLimiter(fullMetricName string, limit int) *cardinalityLimiter {
+	return &cardinalityLimiter{
+		limit: int64(limit),
+		overflowCount: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: fullMetricName + "_overflow_count",
+			Help: "Number of label sets of " + fullMetricName + " counted in its " + overflowLabelValue + " series, beyond its cardinality limit",
+		}),
+	}
+}
+
+// admit tells whether the series can be registered, taking room for it when it is new
+func (l *cardinalityLimiter) admit(key string) bool {
+	if _, ok := l.series.Load(key); ok {
+		return true
+	}
+	if l.count.Add(1) > l.limit {
+		l.count.Add(-1)
+		if _, loaded := l.overflowed.LoadOrStore(key, struct{}{}); !loaded {
+			l.overflowCount.Inc()
+		}
+		return false
+	}
+	if _, loaded := l.series.LoadOrStore(key, struct{}{}); loaded {
+		l.count.Add(-1)
+	}
+	return true
+}
+
+// release frees the room of a series. Releasing the overflow series forgets the label sets it counted.
+func (l *cardinalityLimiter) release(key string, overflow bool) {
+	if overflow {
+		l.overflowed.Clear()
+		l.overflowCount.Set(0)
+		return
+	}
+	if _, ok := l.series.LoadAndDelete(key); ok {
+		l.count.Add(-1)
+	}
+}
+
+// withRelease makes the cleanup function of a series, called on expiry, also release its room
+func (l *cardinalityLimiter) withRelease(entry interface{}, key string, overflow bool) interface{} {
+	cleanup, ok := entry.(func())
+	if !ok {
+		return entry
+	}
+	return func() {
+		cleanup()
+		l.release(key, overflow)
+	}
+}
+
+func (l labelSet) setOverflow() {
+	for i := range l {
+		l[i].value = overflowLabelValue
+	}
+}
+
+// limitLabels returns the key and labels of the series, which are the overflow ones when the series is beyond the
+// cardinality limit
+func limitLabels(ls labelSet, info *metrics.Preprocessed, limiter *cardinalityLimiter) (labelsKeyAndMap, bool) {
+	lkm := ls.toKeyAndMap(info)
+	if limiter == nil || limiter.admit(lkm.key) {
+		return lkm, false
+	}
+	ls.setOverflow()
+	return ls.toKeyAndMap(info), true
+}
+
+// limiter returns the cardinality limiter of a metric, nil when the metric isn't limited
+func (m *MetricsCommonStruct) limiter(name string) *cardinalityLimiter {
+	return m.limiters[name]
+}
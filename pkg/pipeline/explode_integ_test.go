@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplodePipeline(t *testing.T) {
+	builder := config.NewPresetIngesterPipeline()
+	builder.TransformExplode("explode", api.TransformExplode{Outputs: []api.ExplodeOutput{
+		{Remove: []string{"InnerSrcAddr"}},
+		{When: "InnerSrcAddr", Remove: []string{"InnerSrcAddr"}, Set: []api.ExplodeField{{Output: "SrcAddr", Input: "InnerSrcAddr"}}},
+	}})
+	cfg := builder.ToConfigFileStruct()
+	cfg.Pipeline = append(cfg.Pipeline,
+		config.Stage{Name: "none", Follows: "explode"},
+		config.Stage{Name: "writer", Follows: "none"})
+	cfg.Parameters = append(cfg.Parameters,
+		config.StageParam{Name: "none", Transform: &config.Transform{Type: api.NoneType}},
+		config.StageParam{Name: "writer", Write: &config.Write{Type: api.FakeType}})
+	in := make(chanIngester, 10)
+	p, err := newPipelineFromIngester(cfg, in)
+	require.NoError(t, err)
+
+	in <- config.GenericMap{"SrcAddr": "192.168.0.1", "InnerSrcAddr": "10.0.0.1", "Seq": 1}
+	in <- config.GenericMap{"SrcAddr": "192.168.0.1", "Seq": 2}
+	in <- config.GenericMap{"SrcAddr": "192.168.0.2", "InnerSrcAddr": "10.0.0.2", "Seq": 3}
+	close(in)
+	p.Run()
+
+	// the records of a flow reach the following stages in order, before those of the next flow
+	require.Equal(t, []config.GenericMap{
+		{"SrcAddr": "192.168.0.1", "Seq": 1},
+		{"SrcAddr": "10.0.0.1", "Seq": 1},
+		{"SrcAddr": "192.168.0.1", "Seq": 2},
+		{"SrcAddr": "192.168.0.2", "Seq": 3},
+		{"SrcAddr": "10.0.0.2", "Seq": 3},
+	}, p.pipelineEntryMap["writer"].Writer.(*write.Fake).AllRecords())
+}
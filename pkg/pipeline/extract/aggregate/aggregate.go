@@ -34,12 +34,18 @@ import (
 )
 
 const (
-	OperationSum       = "sum"
-	OperationAvg       = "avg"
-	OperationMax       = "max"
-	OperationMin       = "min"
-	OperationCount     = "count"
-	OperationRawValues = "raw_values"
+	OperationSum        = "sum"
+	OperationAvg        = "avg"
+	OperationMax        = "max"
+	OperationMin        = "min"
+	OperationCount      = "count"
+	OperationRawValues  = "raw_values"
+	OperationPercentile = "percentile"
+	OperationTopN       = "topN"
+	// OperationDistinctCount estimates the number of distinct values of the operation key with HyperLogLog
+	OperationDistinctCount = "distinct_count"
+	// OperationRate reports the per-second rate of the operation key sum, or of the flows, over a sliding window
+	OperationRate = "rate"
 )
 
 type Labels map[string]string
@@ -50,16 +56,35 @@ type Aggregate struct {
 	cache      *utils.TimedCache
 	mutex      *sync.Mutex
 	expiryTime time.Duration
+	// window is nil unless a sliding window is configured
+	window *slidingWindow
+	// topN is nil unless the operation is topN: its groups are tracked there instead of the cache
+	topN *topNHeap
+	// store is nil unless a state store is configured
+	store StateStore
+	now   func() time.Time
 }
 
 type GroupState struct {
 	normalizedValues NormalizedValues
 	labels           Labels
 	recentRawValues  []float64
+	recentSketch     *sketch
+	totalSketch      *sketch
+	recentHLL        *hll
+	totalHLL         *hll
 	recentOpValue    float64
 	recentCount      int
 	totalValue       float64
 	totalCount       int
+	// sliding window state: index of the slide accumulated in the recent values, and the last completed slides
+	slideIndex int64
+	slides     []slideState
+	// event time state: the slides following the recent one, by index, and the late flows of the late_bucket policy
+	ahead map[int64]*slideState
+	late  *slideState
+	// rate state: whether the window was empty when last reported, so that a rate of 0 is reported only once
+	rateZero bool
 }
 
 func (aggregate *Aggregate) LabelsFromEntry(entry config.GenericMap) (Labels, bool) {
@@ -109,7 +134,7 @@ func (aggregate *Aggregate) filterEntry(entry config.GenericMap) (NormalizedValu
 
 func getInitValue(operation string) float64 {
 	switch operation {
-	case OperationSum, OperationAvg, OperationMax, OperationCount:
+	case OperationSum, OperationAvg, OperationMax, OperationCount, OperationPercentile, OperationTopN, OperationDistinctCount, OperationRate:
 		return 0
 	case OperationMin:
 		return math.MaxFloat64
@@ -127,6 +152,23 @@ func (aggregate *Aggregate) UpdateByEntry(entry config.GenericMap, normalizedVal
 	aggregate.mutex.Lock()
 	defer aggregate.mutex.Unlock()
 
+	if aggregate.topN != nil {
+		aggregate.updateTopN(entry, normalizedValues, labels)
+		return nil
+	}
+
+	var eventTime time.Time
+	if aggregate.window != nil && aggregate.window.eventTime != nil {
+		var ok bool
+		if eventTime, ok = aggregate.window.eventTime.observe(entry); !ok {
+			return fmt.Errorf("missing or invalid event time")
+		}
+		if eventTime.Before(aggregate.window.eventTime.watermark()) && aggregate.window.eventTime.policy == api.AggregateLateDrop {
+			aggregate.window.eventTime.lateFlows.Inc()
+			return nil
+		}
+	}
+
 	var groupState *GroupState
 	oldEntry, ok := aggregate.cache.GetCacheEntry(string(normalizedValues))
 	if !ok {
@@ -137,18 +179,47 @@ func (aggregate *Aggregate) UpdateByEntry(entry config.GenericMap, normalizedVal
 		if aggregate.definition.OperationType == OperationRawValues {
 			groupState.recentRawValues = make([]float64, 0)
 		}
+		if aggregate.definition.OperationType == OperationPercentile {
+			groupState.recentSketch = newSketch(aggregate.errorBound())
+			groupState.totalSketch = newSketch(aggregate.errorBound())
+		}
+		if aggregate.definition.OperationType == OperationDistinctCount {
+			groupState.recentHLL = newHLL(aggregate.errorBound())
+			groupState.totalHLL = newHLL(aggregate.errorBound())
+		}
+		if aggregate.window != nil {
+			groupState.slideIndex = aggregate.windowIndex()
+		}
 	} else {
 		groupState = oldEntry.(*GroupState)
+		if aggregate.window != nil {
+			aggregate.rotate(groupState, aggregate.windowIndex())
+		}
 	}
 	aggregate.cache.UpdateCacheEntry(string(normalizedValues), groupState)
 
+	if aggregate.window != nil && aggregate.window.eventTime != nil {
+		if s, _ := aggregate.eventSlide(groupState, eventTime); s != nil {
+			// the flow is counted in the recent values, swapped with its slide in the meantime
+			groupState.swapRecent(s)
+			defer groupState.swapRecent(s)
+		}
+	}
+
 	// update value
 	operationKey := aggregate.definition.OperationKey
 	operation := aggregate.definition.OperationType
 
-	if operation == OperationCount {
+	if operation == OperationCount || (operation == OperationRate && operationKey == "") {
 		groupState.totalValue = float64(groupState.totalCount + 1)
 		groupState.recentOpValue = float64(groupState.recentCount + 1)
+	} else if operation == OperationDistinctCount {
+		// the values are counted as strings, e.g. IP addresses
+		if value, ok := entry[operationKey]; ok {
+			valueString := util.ConvertToString(value)
+			groupState.recentHLL.add(valueString)
+			groupState.totalHLL.add(valueString)
+		}
 	} else if operationKey != "" {
 		value, ok := entry[operationKey]
 		if ok {
@@ -158,7 +229,7 @@ func (aggregate *Aggregate) UpdateByEntry(entry config.GenericMap, normalizedVal
 				log.Debugf("UpdateByEntry error when parsing float '%s': %v", valueString, err)
 			} else {
 				switch operation {
-				case OperationSum:
+				case OperationSum, OperationRate:
 					groupState.totalValue += valueFloat64
 					groupState.recentOpValue += valueFloat64
 				case OperationMax:
@@ -172,6 +243,9 @@ func (aggregate *Aggregate) UpdateByEntry(entry config.GenericMap, normalizedVal
 					groupState.recentOpValue = (groupState.recentOpValue*float64(groupState.recentCount) + valueFloat64) / float64(groupState.recentCount+1)
 				case OperationRawValues:
 					groupState.recentRawValues = append(groupState.recentRawValues, valueFloat64)
+				case OperationPercentile:
+					groupState.recentSketch.add(valueFloat64)
+					groupState.totalSketch.add(valueFloat64)
 				}
 			}
 		}
@@ -207,36 +281,204 @@ func (aggregate *Aggregate) GetMetrics() []config.GenericMap {
 	aggregate.mutex.Lock()
 	defer aggregate.mutex.Unlock()
 
+	if aggregate.topN != nil {
+		return aggregate.topNEntries()
+	}
+
+	var index int64
+	if aggregate.window != nil {
+		if et := aggregate.window.eventTime; et != nil && !et.seen {
+			return nil
+		}
+		index = aggregate.windowIndex()
+		if index <= aggregate.window.lastReported {
+			// sliding windows are only reported when advancing
+			return nil
+		}
+		aggregate.window.lastReported = index
+	}
+
 	var metrics []config.GenericMap
 
 	// iterate over the items in the cache
 	aggregate.cache.Iterate(func(_ string, value interface{}) {
 		group := value.(*GroupState)
-		newEntry := config.GenericMap{
-			"name":              aggregate.definition.Name,
-			"operation_type":    aggregate.definition.OperationType,
-			"operation_key":     aggregate.definition.OperationKey,
-			"by":                strings.Join(aggregate.definition.GroupByKeys, ","),
-			"aggregate":         string(group.normalizedValues),
-			"total_value":       group.totalValue,
-			"total_count":       group.totalCount,
-			"recent_raw_values": group.recentRawValues,
-			"recent_op_value":   group.recentOpValue,
-			"recent_count":      group.recentCount,
-			strings.Join(aggregate.definition.GroupByKeys, "_"): string(group.normalizedValues),
-		}
-		// add the items in aggregate.definition.GroupByKeys individually to the entry
-		for _, key := range aggregate.definition.GroupByKeys {
-			newEntry[key] = group.labels[key]
+		recent := slideState{
+			opValue:   group.recentOpValue,
+			count:     group.recentCount,
+			rawValues: group.recentRawValues,
+			sketch:    group.recentSketch,
+			hll:       group.recentHLL,
 		}
-		metrics = append(metrics, newEntry)
-		// Once reported, we reset the recentXXX fields
-		if aggregate.definition.OperationType == OperationRawValues {
-			group.recentRawValues = make([]float64, 0)
+		if group.late != nil {
+			metrics = append(metrics, aggregate.groupEntries(group, aggregate.definition.Name+"_late", group.late)...)
+			group.late = nil
+		}
+		if aggregate.window != nil {
+			aggregate.rotate(group, index)
+			recent = aggregate.windowValues(group)
+			if recent.count == 0 {
+				// nothing left in the window; a rate is reported once as 0 rather than holding its last value
+				if aggregate.definition.OperationType != OperationRate || group.rateZero {
+					return
+				}
+				group.rateZero = true
+			} else {
+				group.rateZero = false
+			}
+		}
+		metrics = append(metrics, aggregate.groupEntries(group, aggregate.definition.Name, &recent)...)
+		// Once reported, we reset the recentXXX fields, unless they hold the current slide of a sliding window
+		if aggregate.window == nil {
+			aggregate.resetRecent(group)
 		}
-		group.recentCount = 0
-		group.recentOpValue = getInitValue(string(aggregate.definition.OperationType))
 	})
+	if aggregate.persisted() {
+		aggregate.saveState()
+	}
 
 	return metrics
 }
+
+// groupEntries returns the entries reporting the group, with the given recent values
+func (aggregate *Aggregate) groupEntries(group *GroupState, name string, recent *slideState) []config.GenericMap {
+	newEntry := config.GenericMap{
+		"name":              name,
+		"operation_type":    aggregate.definition.OperationType,
+		"operation_key":     aggregate.definition.OperationKey,
+		"by":                strings.Join(aggregate.definition.GroupByKeys, ","),
+		"aggregate":         string(group.normalizedValues),
+		"total_value":       group.totalValue,
+		"total_count":       group.totalCount,
+		"recent_raw_values": recent.rawValues,
+		"recent_op_value":   recent.opValue,
+		"recent_count":      recent.count,
+		strings.Join(aggregate.definition.GroupByKeys, "_"): string(group.normalizedValues),
+	}
+	// add the items in aggregate.definition.GroupByKeys individually to the entry
+	for _, key := range aggregate.definition.GroupByKeys {
+		newEntry[key] = group.labels[key]
+	}
+	if aggregate.definition.OperationType == OperationDistinctCount {
+		newEntry["total_value"] = group.totalHLL.estimate()
+		newEntry["recent_op_value"] = recent.hll.estimate()
+	}
+	if aggregate.definition.OperationType == OperationRate {
+		newEntry["rate"] = recent.opValue / aggregate.window.size().Seconds()
+	}
+	if aggregate.definition.OperationType == OperationPercentile {
+		return aggregate.percentileEntries(newEntry, group.totalSketch, recent.sketch)
+	}
+	return []config.GenericMap{newEntry}
+}
+
+func (aggregate *Aggregate) resetRecent(group *GroupState) {
+	if aggregate.definition.OperationType == OperationRawValues {
+		group.recentRawValues = make([]float64, 0)
+	}
+	if aggregate.definition.OperationType == OperationPercentile {
+		group.recentSketch.reset()
+	}
+	if aggregate.definition.OperationType == OperationDistinctCount {
+		group.recentHLL.reset()
+	}
+	group.recentCount = 0
+	group.recentOpValue = getInitValue(string(aggregate.definition.OperationType))
+}
+
+func (aggregate *Aggregate) errorBound() float64 {
+	if aggregate.definition.ErrorBound == 0 {
+		if aggregate.definition.OperationType == OperationDistinctCount {
+			return defaultHLLErrorBound
+		}
+		return defaultErrorBound
+	}
+	return aggregate.definition.ErrorBound
+}
+
+// percentileEntries returns one entry per configured percentile, named <entry name>_p<percentile>,
+// or a single entry with a recent_p<percentile> and a total_p<percentile> field per percentile
+func (aggregate *Aggregate) percentileEntries(entry config.GenericMap, total, recent *sketch) []config.GenericMap {
+	if aggregate.definition.PercentileOutput == api.AggregatePercentileFields {
+		delete(entry, "total_value")
+		delete(entry, "recent_op_value")
+		for _, p := range aggregate.definition.Percentiles {
+			suffix := "_p" + strconv.FormatFloat(p, 'f', -1, 64)
+			entry["total"+suffix] = total.quantile(p / 100)
+			entry["recent"+suffix] = recent.quantile(p / 100)
+		}
+		return []config.GenericMap{entry}
+	}
+	entries := make([]config.GenericMap, 0, len(aggregate.definition.Percentiles))
+	for _, p := range aggregate.definition.Percentiles {
+		pEntry := make(config.GenericMap, len(entry))
+		for k, v := range entry {
+			pEntry[k] = v
+		}
+		pEntry["name"] = entry["name"].(string) + "_p" + strconv.FormatFloat(p, 'f', -1, 64)
+		pEntry["total_value"] = total.quantile(p / 100)
+		pEntry["recent_op_value"] = recent.quantile(p / 100)
+		entries = append(entries, pEntry)
+	}
+	return entries
+}
+
+// updateTopN adds the operationKey value of the entry to its group, or 1 to count the flows when there is no operationKey
+func (aggregate *Aggregate) updateTopN(entry config.GenericMap, normalizedValues NormalizedValues, labels Labels) {
+	value := 1.0
+	if operationKey := aggregate.definition.OperationKey; operationKey != "" {
+		v, ok := entry[operationKey]
+		if !ok {
+			return
+		}
+		var err error
+		if value, err = util.ConvertToFloat64(v); err != nil {
+			log.Debugf("updateTopN error when parsing float '%v': %v", v, err)
+			return
+		}
+	}
+	aggregate.topN.add(normalizedValues, labels, value)
+}
+
+// topNEntries returns the top groups of the window, highest value first, followed by the other groups
+// when topNOther is set, and starts a new window
+func (aggregate *Aggregate) topNEntries() []config.GenericMap {
+	items := aggregate.topN.sorted()
+	if len(items) > aggregate.definition.TopN {
+		items = items[:aggregate.definition.TopN]
+	}
+	entries := make([]config.GenericMap, 0, len(items)+1)
+	otherValue, otherCount := aggregate.topN.total, aggregate.topN.count
+	for i, item := range items {
+		entry := aggregate.topNEntry(string(item.normalizedValues), item.value, item.count)
+		entry["rank"] = i + 1
+		for _, key := range aggregate.definition.GroupByKeys {
+			entry[key] = item.labels[key]
+		}
+		entries = append(entries, entry)
+		otherValue -= item.value
+		otherCount -= item.count
+	}
+	if aggregate.definition.TopNOther && otherCount > 0 {
+		entry := aggregate.topNEntry(topNOtherGroup, max(otherValue, 0), otherCount)
+		for _, key := range aggregate.definition.GroupByKeys {
+			entry[key] = topNOtherGroup
+		}
+		entries = append(entries, entry)
+	}
+	aggregate.topN.reset()
+	return entries
+}
+
+func (aggregate *Aggregate) topNEntry(group string, value float64, count int) config.GenericMap {
+	return config.GenericMap{
+		"name":            aggregate.definition.Name,
+		"operation_type":  aggregate.definition.OperationType,
+		"operation_key":   aggregate.definition.OperationKey,
+		"by":              strings.Join(aggregate.definition.GroupByKeys, ","),
+		"aggregate":       group,
+		"recent_op_value": value,
+		"recent_count":    count,
+		strings.Join(aggregate.definition.GroupByKeys, "_"): group,
+	}
+}
@@ -18,6 +18,7 @@
 package aggregate
 
 import (
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -147,3 +148,90 @@ func Test_GetMetrics(t *testing.T) {
 	valueFloat64 := metrics[0]["total_value"].(float64)
 	require.Equal(t, float64(7), valueFloat64)
 }
+
+func Test_GetMetricsPercentiles(t *testing.T) {
+	aggregate := GetMockAggregate()
+	aggregate.definition.Name = "latency"
+	aggregate.definition.OperationType = OperationPercentile
+	aggregate.definition.Percentiles = []float64{50, 90, 99.9}
+	var entries []config.GenericMap
+	for i := 1; i <= 100; i++ {
+		entry := test.GetIngestMockEntry(false)
+		entry["value"] = i
+		entries = append(entries, entry)
+	}
+
+	_ = aggregate.Evaluate(entries)
+	metrics := aggregate.GetMetrics()
+
+	require.Len(t, metrics, 3)
+	require.Equal(t, "latency_p50", metrics[0]["name"])
+	require.InEpsilon(t, 50, metrics[0]["recent_op_value"], defaultErrorBound)
+	require.Equal(t, "latency_p90", metrics[1]["name"])
+	require.InEpsilon(t, 90, metrics[1]["recent_op_value"], defaultErrorBound)
+	require.Equal(t, "latency_p99.9", metrics[2]["name"])
+	require.InEpsilon(t, 99, metrics[2]["recent_op_value"], defaultErrorBound)
+	require.Equal(t, 100, metrics[0]["recent_count"])
+
+	// The recent sketch is reset after being reported, the total one is kept
+	_ = aggregate.Evaluate([]config.GenericMap{entries[0]})
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 3)
+	require.InEpsilon(t, 1, metrics[0]["recent_op_value"], defaultErrorBound)
+	require.InEpsilon(t, 50, metrics[0]["total_value"], defaultErrorBound)
+	require.Equal(t, 1, metrics[0]["recent_count"])
+}
+
+func Test_GetMetricsPercentileFields(t *testing.T) {
+	aggregate := GetMockAggregate()
+	aggregate.definition.Name = "latency"
+	aggregate.definition.OperationType = OperationPercentile
+	aggregate.definition.Percentiles = []float64{50, 99}
+	aggregate.definition.PercentileOutput = api.AggregatePercentileFields
+	var entries []config.GenericMap
+	for i := 1; i <= 100; i++ {
+		entry := test.GetIngestMockEntry(false)
+		entry["value"] = i
+		entries = append(entries, entry)
+	}
+
+	require.NoError(t, aggregate.Evaluate(entries))
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, "latency", metrics[0]["name"])
+	require.InEpsilon(t, 50, metrics[0]["recent_p50"], defaultErrorBound)
+	require.InEpsilon(t, 99, metrics[0]["recent_p99"], defaultErrorBound)
+	require.InEpsilon(t, 50, metrics[0]["total_p50"], defaultErrorBound)
+	require.InEpsilon(t, 99, metrics[0]["total_p99"], defaultErrorBound)
+	require.NotContains(t, metrics[0], "recent_op_value")
+	require.Equal(t, 100, metrics[0]["recent_count"])
+}
+
+func Test_GetMetricsDistinctCount(t *testing.T) {
+	aggregate := GetMockAggregate()
+	aggregate.definition.OperationType = OperationDistinctCount
+	aggregate.definition.OperationKey = "srcIP"
+	aggregate.definition.GroupByKeys = api.AggregateBy{"dstIP"}
+	var entries []config.GenericMap
+	for i := 0; i < 300; i++ {
+		entry := test.GetIngestMockEntry(false)
+		entry["srcIP"] = fmt.Sprintf("10.0.%d.%d", i%100/10, i%10)
+		entries = append(entries, entry)
+	}
+
+	require.NoError(t, aggregate.Evaluate(entries))
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.InEpsilon(t, 100.0, metrics[0]["recent_op_value"], defaultHLLErrorBound)
+	require.InEpsilon(t, 100.0, metrics[0]["total_value"], defaultHLLErrorBound)
+	require.Equal(t, 300, metrics[0]["recent_count"])
+
+	// The recent sketch is reset after being reported, the total one is kept
+	entry := test.GetIngestMockEntry(false)
+	entry["srcIP"] = "10.1.0.1"
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entry, entries[0]}))
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.InEpsilon(t, 2.0, metrics[0]["recent_op_value"], defaultHLLErrorBound)
+	require.InEpsilon(t, 101.0, metrics[0]["total_value"], defaultHLLErrorBound)
+}
@@ -18,11 +18,14 @@
 package aggregate
 
 import (
+	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -32,8 +35,12 @@ var cleanupLoopTime = 2 * time.Minute
 
 type Aggregates struct {
 	Aggregates        []Aggregate
+	opMetrics         *operational.Metrics
 	cleanupLoopTime   time.Duration
 	defaultExpiryTime time.Duration
+	stopCleanup       chan struct{}
+	// store is nil unless a state store is configured
+	store StateStore
 }
 
 func (aggregates *Aggregates) Evaluate(entries []config.GenericMap) error {
@@ -68,21 +75,47 @@ func (aggregates *Aggregates) addAggregate(aggregateDefinition *api.AggregateDef
 		cache:      utils.NewTimedCache(0, nil),
 		mutex:      &sync.Mutex{},
 		expiryTime: expiryTime.Duration,
+		window:     newSlidingWindow(aggregateDefinition.Window, time.Now()),
+		store:      aggregates.store,
+		now:        time.Now,
+	}
+	if aggregateDefinition.OperationType == OperationTopN {
+		aggregate.topN = newTopNHeap(max(aggregateDefinition.TopN, aggregateDefinition.TopNCapacity))
+	}
+	if aggregate.window != nil {
+		// groups must not expire while their last values are still in the window
+		minExpiry := aggregateDefinition.Window.Size.Duration + aggregateDefinition.Window.Slide.Duration
+		if aggregateDefinition.OperationType == OperationRate {
+			// the empty window must be reported before the group expires, for the rate to drop to 0
+			minExpiry += aggregateDefinition.Window.Slide.Duration
+		}
+		if et := aggregate.window.eventTime; et != nil {
+			minExpiry += et.lateness
+			et.lateFlows = aggregates.opMetrics.NewCounter(&lateFlowsDef, aggregateDefinition.Name, string(et.policy))
+		}
+		if aggregate.expiryTime < minExpiry {
+			aggregate.expiryTime = minExpiry
+		}
 	}
 
 	return append(aggregates.Aggregates, aggregate)
 }
 
 func (aggregates *Aggregates) cleanupExpiredEntriesLoop() {
-
-	ticker := time.NewTicker(aggregates.cleanupLoopTime)
+	// the loop works on a copy, so that Update can replace the aggregates while it runs
+	current := *aggregates
+	exitChan := utils.ExitChannel()
+	ticker := time.NewTicker(current.cleanupLoopTime)
 	go func() {
+		defer ticker.Stop()
 		for {
 			select {
-			case <-utils.ExitChannel():
+			case <-exitChan:
+				return
+			case <-current.stopCleanup:
 				return
 			case <-ticker.C:
-				aggregates.cleanupExpiredEntries()
+				current.cleanupExpiredEntries()
 			}
 		}
 	}()
@@ -96,20 +129,131 @@ func (aggregates *Aggregates) cleanupExpiredEntries() {
 	}
 }
 
-func NewAggregatesFromConfig(aggConfig *api.Aggregates) (Aggregates, error) {
+func validatePercentiles(def *api.AggregateDefinition) error {
+	if def.OperationType != OperationPercentile {
+		if def.PercentileOutput != "" {
+			return fmt.Errorf("aggregate %s: percentileOutput requires the percentile operation", def.Name)
+		}
+		return nil
+	}
+	switch def.PercentileOutput {
+	case "", api.AggregatePercentileRecords, api.AggregatePercentileFields:
+	default:
+		return fmt.Errorf("aggregate %s: unknown percentileOutput %s", def.Name, def.PercentileOutput)
+	}
+	if len(def.Percentiles) == 0 {
+		return fmt.Errorf("aggregate %s: percentiles must be provided for the percentile operation", def.Name)
+	}
+	for _, p := range def.Percentiles {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("aggregate %s: invalid percentile %v, must be between 0 and 100", def.Name, p)
+		}
+	}
+	if def.ErrorBound < 0 || def.ErrorBound >= 1 {
+		return fmt.Errorf("aggregate %s: invalid errorBound %v, must be between 0 and 1", def.Name, def.ErrorBound)
+	}
+	return nil
+}
+
+func validateDistinctCount(def *api.AggregateDefinition) error {
+	if def.OperationType != OperationDistinctCount {
+		return nil
+	}
+	if def.OperationKey == "" {
+		return fmt.Errorf("aggregate %s: operationKey must be provided for the distinct_count operation", def.Name)
+	}
+	if def.ErrorBound < 0 || def.ErrorBound >= 1 {
+		return fmt.Errorf("aggregate %s: invalid errorBound %v, must be between 0 and 1", def.Name, def.ErrorBound)
+	}
+	return nil
+}
+
+func validateRate(def *api.AggregateDefinition) error {
+	if def.OperationType != OperationRate {
+		return nil
+	}
+	if def.Window == nil || def.Window.Type != api.AggregateWindowSliding {
+		return fmt.Errorf("aggregate %s: the rate operation requires a sliding window", def.Name)
+	}
+	return nil
+}
+
+func NewAggregatesFromConfig(opMetrics *operational.Metrics, aggConfig *api.Aggregates) (Aggregates, error) {
+	store, err := newStateStore(aggConfig.StateStore)
+	if err != nil {
+		return Aggregates{}, err
+	}
+	aggregates, err := newAggregates(opMetrics, aggConfig, store)
+	if err != nil {
+		if store != nil {
+			_ = store.Close()
+		}
+		return aggregates, err
+	}
+	// the running totals saved before a restart are resumed
+	for i := range aggregates.Aggregates {
+		if aggregates.Aggregates[i].persisted() {
+			if err := aggregates.Aggregates[i].loadState(); err != nil {
+				log.WithError(err).Warnf("can't load the state of aggregate %s", aggregates.Aggregates[i].definition.Name)
+			}
+		}
+	}
+	aggregates.cleanupExpiredEntriesLoop()
+	return aggregates, nil
+}
+
+// Update replaces the aggregate definitions with the ones from aggConfig. The aggregates whose definition
+// didn't change keep their state, so that their metrics aren't reset. The state store opened at startup is kept.
+func (aggregates *Aggregates) Update(aggConfig *api.Aggregates) error {
+	updated, err := newAggregates(aggregates.opMetrics.ForReload(), aggConfig, aggregates.store)
+	if err != nil {
+		return err
+	}
+	for i := range updated.Aggregates {
+		for _, current := range aggregates.Aggregates {
+			if reflect.DeepEqual(current.definition, updated.Aggregates[i].definition) {
+				updated.Aggregates[i] = current
+				break
+			}
+		}
+	}
+	if aggregates.stopCleanup != nil {
+		close(aggregates.stopCleanup)
+	}
+	*aggregates = updated
+	aggregates.cleanupExpiredEntriesLoop()
+	return nil
+}
+
+func newAggregates(opMetrics *operational.Metrics, aggConfig *api.Aggregates, store StateStore) (Aggregates, error) {
 	aggregates := Aggregates{
+		opMetrics:         opMetrics,
+		store:             store,
 		cleanupLoopTime:   cleanupLoopTime,
 		defaultExpiryTime: aggConfig.DefaultExpiryTime.Duration,
+		stopCleanup:       make(chan struct{}),
 	}
 	if aggregates.defaultExpiryTime == 0 {
 		aggregates.defaultExpiryTime = defaultExpiryTime
 	}
 
 	for i := range aggConfig.Rules {
+		if err := validatePercentiles(&aggConfig.Rules[i]); err != nil {
+			return aggregates, err
+		}
+		if err := validateDistinctCount(&aggConfig.Rules[i]); err != nil {
+			return aggregates, err
+		}
+		if err := validateWindow(&aggConfig.Rules[i]); err != nil {
+			return aggregates, err
+		}
+		if err := validateTopN(&aggConfig.Rules[i]); err != nil {
+			return aggregates, err
+		}
+		if err := validateRate(&aggConfig.Rules[i]); err != nil {
+			return aggregates, err
+		}
 		aggregates.Aggregates = aggregates.addAggregate(&aggConfig.Rules[i])
 	}
-
-	aggregates.cleanupExpiredEntriesLoop()
-
 	return aggregates, nil
 }
@@ -21,11 +21,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
 	"github.com/stretchr/testify/require"
 )
 
+var opMetrics = operational.NewMetrics(&config.MetricsSettings{})
+
 func initAggregates(t *testing.T) Aggregates {
 	var yamlConfig = `
 log-level: debug
@@ -46,7 +50,7 @@ parameters:
 `
 	v, cfg := test.InitConfig(t, yamlConfig)
 	require.NotNil(t, v)
-	aggregates, err := NewAggregatesFromConfig(cfg.Parameters[0].Extract.Aggregates)
+	aggregates, err := NewAggregatesFromConfig(opMetrics, cfg.Parameters[0].Extract.Aggregates)
 	require.NoError(t, err)
 
 	return aggregates
@@ -76,3 +80,167 @@ func Test_CleanupExpiredEntriesLoop(t *testing.T) {
 	time.Sleep(3 * time.Second) // expires after 3 more seconds (5 seconds in total)
 	require.Equal(t, 0, len(aggregates.Aggregates[0].GetMetrics()))
 }
+
+func Test_NewAggregatesFromConfigPercentiles(t *testing.T) {
+	def := api.AggregateDefinition{
+		Name:          "latency",
+		GroupByKeys:   api.AggregateBy{"srcIP"},
+		OperationType: OperationPercentile,
+		OperationKey:  "value",
+	}
+	_, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Percentiles = []float64{50, 101}
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Percentiles = []float64{50, 99}
+	def.ErrorBound = 1
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.ErrorBound = 0.001
+	def.PercentileOutput = "columns"
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.PercentileOutput = api.AggregatePercentileFields
+	aggregates, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.NoError(t, err)
+	require.Equal(t, 0.001, aggregates.Aggregates[0].errorBound())
+}
+
+func Test_NewAggregatesFromConfigWindow(t *testing.T) {
+	def := api.AggregateDefinition{
+		Name:          "bytes",
+		GroupByKeys:   api.AggregateBy{"srcIP"},
+		OperationType: OperationSum,
+		OperationKey:  "value",
+		Window:        &api.AggregateWindow{Type: api.AggregateWindowSliding},
+	}
+	_, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window.Size = api.Duration{Duration: 5 * time.Minute}
+	def.Window.Slide = api.Duration{Duration: 45 * time.Second}
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window.Slide = api.Duration{Duration: time.Second}
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window.Type = "hopping"
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window.Type = api.AggregateWindowSliding
+	def.Window.Slide = api.Duration{Duration: 30 * time.Second}
+	aggregates, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.NoError(t, err)
+	require.Equal(t, 10, aggregates.Aggregates[0].window.slides)
+	// groups don't expire before leaving the window
+	require.Equal(t, 5*time.Minute+30*time.Second, aggregates.Aggregates[0].expiryTime)
+}
+
+func Test_NewAggregatesFromConfigEventTime(t *testing.T) {
+	def := api.AggregateDefinition{
+		Name:          "bytes",
+		GroupByKeys:   api.AggregateBy{"srcIP"},
+		OperationType: OperationSum,
+		OperationKey:  "value",
+		Window:        &api.AggregateWindow{Type: api.AggregateWindowTumbling, TimeField: "TimeFlowEndMs"},
+	}
+	_, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window = &api.AggregateWindow{
+		Type:            api.AggregateWindowSliding,
+		Size:            api.Duration{Duration: time.Minute},
+		Slide:           api.Duration{Duration: 30 * time.Second},
+		AllowedLateness: api.Duration{Duration: time.Minute},
+	}
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window.TimeField = "TimeFlowEndMs"
+	def.Window.LatePolicy = "keep"
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window.LatePolicy = ""
+	def.Window.AllowedLateness = api.Duration{Duration: -time.Minute}
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window.AllowedLateness = api.Duration{Duration: time.Minute}
+	aggregates, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.NoError(t, err)
+	require.Equal(t, api.AggregateLateDrop, aggregates.Aggregates[0].window.eventTime.policy)
+	// groups don't expire before their late flows are accepted
+	require.Equal(t, 2*time.Minute+30*time.Second, aggregates.Aggregates[0].expiryTime)
+}
+
+func Test_NewAggregatesFromConfigRate(t *testing.T) {
+	def := api.AggregateDefinition{
+		Name:          "bytes_rate",
+		GroupByKeys:   api.AggregateBy{"srcIP"},
+		OperationType: OperationRate,
+		OperationKey:  "value",
+		ExpiryTime:    api.Duration{Duration: 10 * time.Second},
+	}
+	_, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window = &api.AggregateWindow{Type: api.AggregateWindowTumbling}
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window = &api.AggregateWindow{
+		Type:  api.AggregateWindowSliding,
+		Size:  api.Duration{Duration: time.Minute},
+		Slide: api.Duration{Duration: 30 * time.Second},
+	}
+	aggregates, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.NoError(t, err)
+	// groups don't expire before their empty window is reported
+	require.Equal(t, 2*time.Minute, aggregates.Aggregates[0].expiryTime)
+}
+
+func Test_UpdateAggregates(t *testing.T) {
+	bytes := api.AggregateDefinition{
+		Name:          "bytes",
+		GroupByKeys:   api.AggregateBy{"srcIP"},
+		OperationType: OperationSum,
+		OperationKey:  "value",
+	}
+	packets := api.AggregateDefinition{
+		Name:          "packets",
+		GroupByKeys:   api.AggregateBy{"srcIP"},
+		OperationType: OperationCount,
+	}
+	aggregates, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{bytes}})
+	require.NoError(t, err)
+	require.NoError(t, aggregates.Evaluate([]config.GenericMap{{"srcIP": "10.0.0.1", "value": 10}}))
+
+	// unchanged aggregates keep their state, new ones start empty
+	require.NoError(t, aggregates.Update(&api.Aggregates{Rules: api.AggregateDefinitions{bytes, packets}}))
+	require.Len(t, aggregates.Aggregates, 2)
+	require.NoError(t, aggregates.Evaluate([]config.GenericMap{{"srcIP": "10.0.0.1", "value": 5}}))
+	metrics := aggregates.GetMetrics()
+	require.Len(t, metrics, 2)
+	require.Equal(t, "bytes", metrics[0]["name"])
+	require.Equal(t, float64(15), metrics[0]["total_value"])
+	require.Equal(t, "packets", metrics[1]["name"])
+	require.Equal(t, float64(1), metrics[1]["total_value"])
+
+	// invalid definitions are rejected and the current aggregates are kept
+	invalid := api.AggregateDefinition{Name: "latency", OperationType: OperationPercentile}
+	require.Error(t, aggregates.Update(&api.Aggregates{Rules: api.AggregateDefinitions{invalid}}))
+	require.Len(t, aggregates.Aggregates, 2)
+
+	require.NoError(t, aggregates.Update(&api.Aggregates{Rules: api.AggregateDefinitions{packets}}))
+	require.Len(t, aggregates.Aggregates, 1)
+	require.Equal(t, "packets", aggregates.Aggregates[0].definition.Name)
+}
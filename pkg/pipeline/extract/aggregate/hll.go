@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	defaultHLLErrorBound = 0.02
+	hllMinPrecision      = 4
+	hllMaxPrecision      = 16
+)
+
+// hll is a HyperLogLog sketch (http://algo.inria.fr/flajolet/Publications/FlFuGaMe07.pdf) estimating the number of
+// distinct values added, with a standard error of 1.04/sqrt(2^precision). It uses one byte per register,
+// e.g. 4KB for the default error bound, whatever the number of values.
+type hll struct {
+	precision uint8
+	registers []uint8
+}
+
+// hllPrecision returns the lowest precision whose standard error is below errorBound
+func hllPrecision(errorBound float64) uint8 {
+	p := math.Ceil(math.Log2(math.Pow(1.04/errorBound, 2)))
+	return uint8(math.Min(math.Max(p, hllMinPrecision), hllMaxPrecision))
+}
+
+func newHLL(errorBound float64) *hll {
+	precision := hllPrecision(errorBound)
+	return &hll{precision: precision, registers: make([]uint8, 1<<precision)}
+}
+
+func (h *hll) add(value string) {
+	hash := xxhash.Sum64String(value)
+	// the first bits select the register, which keeps the longest run of leading zeros of the other bits
+	index := hash >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1)) + 1)
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// merge adds the values counted in other, which must have been created with the same error bound
+func (h *hll) merge(other *hll) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// estimate returns the estimated number of distinct values
+func (h *hll) estimate() float64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small cardinalities
+		return math.Round(m * math.Log(m/float64(zeros)))
+	}
+	return math.Round(estimate)
+}
+
+func (h *hll) reset() {
+	clear(h.registers)
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHLLPrecision(t *testing.T) {
+	require.EqualValues(t, 12, hllPrecision(defaultHLLErrorBound))
+	require.EqualValues(t, 14, hllPrecision(0.01))
+	require.EqualValues(t, hllMinPrecision, hllPrecision(0.9))
+	require.EqualValues(t, hllMaxPrecision, hllPrecision(0.0001))
+}
+
+func TestHLLEstimate(t *testing.T) {
+	for _, errorBound := range []float64{0.01, defaultHLLErrorBound, 0.05} {
+		stdErr := 1.04 / math.Sqrt(float64(int(1)<<hllPrecision(errorBound)))
+		require.LessOrEqual(t, stdErr, errorBound)
+		for _, cardinality := range []int{10, 1000, 50000, 500000} {
+			h := newHLL(errorBound)
+			for i := 0; i < cardinality; i++ {
+				ip := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+				// duplicates don't change the estimate
+				h.add(ip)
+				h.add(ip)
+			}
+			require.InEpsilon(t, cardinality, h.estimate(), errorBound, "cardinality %d, error bound %v", cardinality, errorBound)
+		}
+	}
+}
+
+func TestHLLMergeAndReset(t *testing.T) {
+	h1, h2 := newHLL(defaultHLLErrorBound), newHLL(defaultHLLErrorBound)
+	for i := 0; i < 3000; i++ {
+		h1.add(fmt.Sprint(i))
+		h2.add(fmt.Sprint(i + 2000))
+	}
+	h1.merge(h2)
+	require.InEpsilon(t, 5000, h1.estimate(), defaultHLLErrorBound)
+	require.InEpsilon(t, 3000, h2.estimate(), defaultHLLErrorBound)
+
+	h1.reset()
+	require.Zero(t, h1.estimate())
+	h1.add("10.0.0.1")
+	require.Equal(t, 1.0, h1.estimate())
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	defaultErrorBound = 0.01
+	// with the default error bound, 2048 bins cover about 18 orders of magnitude without collapsing
+	sketchMaxBins = 2048
+)
+
+// sketch is a DDSketch (https://arxiv.org/abs/1908.10693): values are counted in logarithmic buckets,
+// so that any quantile is estimated with a relative error lower than the error bound.
+// Memory is bounded by sketchMaxBins per sign: when exceeded, the buckets closest to zero are collapsed,
+// which only degrades accuracy for the smallest magnitudes.
+type sketch struct {
+	gamma     float64
+	logGamma  float64
+	positive  map[int]uint64
+	negative  map[int]uint64
+	zeroCount uint64
+	count     uint64
+}
+
+func newSketch(errorBound float64) *sketch {
+	gamma := (1 + errorBound) / (1 - errorBound)
+	return &sketch{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		positive: map[int]uint64{},
+		negative: map[int]uint64{},
+	}
+}
+
+func (s *sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+func (s *sketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+func (s *sketch) add(v float64) {
+	switch {
+	case v > 0:
+		s.addToStore(s.positive, s.index(v), 1)
+	case v < 0:
+		s.addToStore(s.negative, s.index(-v), 1)
+	default:
+		s.zeroCount++
+	}
+	s.count++
+}
+
+func (s *sketch) addToStore(store map[int]uint64, index int, count uint64) {
+	store[index] += count
+	if len(store) > sketchMaxBins {
+		// merge the lowest bucket into the next one
+		lowest, next := math.MaxInt, math.MaxInt
+		for i := range store {
+			if i < lowest {
+				lowest, next = i, lowest
+			} else if i < next {
+				next = i
+			}
+		}
+		store[next] += store[lowest]
+		delete(store, lowest)
+	}
+}
+
+// merge adds the values counted in other, which must have been created with the same error bound
+func (s *sketch) merge(other *sketch) {
+	for i, c := range other.positive {
+		s.addToStore(s.positive, i, c)
+	}
+	for i, c := range other.negative {
+		s.addToStore(s.negative, i, c)
+	}
+	s.zeroCount += other.zeroCount
+	s.count += other.count
+}
+
+// quantile returns the estimated value at quantile q (between 0 and 1), or 0 when the sketch is empty
+func (s *sketch) quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.count-1))
+	var cumulated uint64
+	// negative values first, from the highest magnitude
+	for _, i := range sortedIndexes(s.negative, true) {
+		cumulated += s.negative[i]
+		if cumulated > rank {
+			return -s.value(i)
+		}
+	}
+	cumulated += s.zeroCount
+	if cumulated > rank {
+		return 0
+	}
+	for _, i := range sortedIndexes(s.positive, false) {
+		cumulated += s.positive[i]
+		if cumulated > rank {
+			return s.value(i)
+		}
+	}
+	// not reached, as rank < count
+	return 0
+}
+
+func (s *sketch) reset() {
+	clear(s.positive)
+	clear(s.negative)
+	s.zeroCount = 0
+	s.count = 0
+}
+
+func sortedIndexes(store map[int]uint64, reverse bool) []int {
+	indexes := make([]int, 0, len(store))
+	for i := range store {
+		indexes = append(indexes, i)
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	} else {
+		sort.Ints(indexes)
+	}
+	return indexes
+}
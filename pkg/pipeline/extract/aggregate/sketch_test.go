@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketchQuantiles(t *testing.T) {
+	s := newSketch(defaultErrorBound)
+	require.Equal(t, 0.0, s.quantile(0.5))
+
+	values := make([]float64, 0, 10000)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		// latency-like distribution, in milliseconds
+		v := math.Exp(rnd.NormFloat64()) * 20
+		values = append(values, v)
+		s.add(v)
+	}
+	sort.Float64s(values)
+	for _, q := range []float64{0, 0.5, 0.9, 0.99, 1} {
+		expected := values[int(q*float64(len(values)-1))]
+		require.InEpsilon(t, expected, s.quantile(q), defaultErrorBound, "quantile %v", q)
+	}
+}
+
+func TestSketchNegativeAndZero(t *testing.T) {
+	s := newSketch(defaultErrorBound)
+	for _, v := range []float64{-100, -10, 0, 0, 10, 100} {
+		s.add(v)
+	}
+	require.InEpsilon(t, -100, s.quantile(0), defaultErrorBound)
+	require.InEpsilon(t, -10, s.quantile(0.2), defaultErrorBound)
+	require.Equal(t, 0.0, s.quantile(0.5))
+	require.InEpsilon(t, 100, s.quantile(1), defaultErrorBound)
+}
+
+func TestSketchBoundedAndReset(t *testing.T) {
+	s := newSketch(defaultErrorBound)
+	for i := -1500; i <= 1500; i++ {
+		s.add(math.Pow(10, float64(i)/100))
+	}
+	require.Len(t, s.positive, sketchMaxBins)
+	require.EqualValues(t, 3001, s.count)
+	// high quantiles are not affected by collapsing
+	require.InEpsilon(t, math.Pow(10, 15), s.quantile(1), defaultErrorBound)
+	require.InEpsilon(t, math.Pow(10, 7.5), s.quantile(0.75), defaultErrorBound)
+
+	s.reset()
+	require.EqualValues(t, 0, s.count)
+	require.Empty(t, s.positive)
+	s.add(42)
+	require.InEpsilon(t, 42, s.quantile(0.5), defaultErrorBound)
+}
+
+func TestSketchMerge(t *testing.T) {
+	s1, s2 := newSketch(defaultErrorBound), newSketch(defaultErrorBound)
+	for i := 1; i <= 50; i++ {
+		s1.add(float64(i))
+		s2.add(float64(-i))
+	}
+	s2.add(0)
+	s1.merge(s2)
+	require.EqualValues(t, 101, s1.count)
+	require.InEpsilon(t, -50, s1.quantile(0), defaultErrorBound)
+	require.Equal(t, 0.0, s1.quantile(0.5))
+	require.InEpsilon(t, 50, s1.quantile(1), defaultErrorBound)
+	// the merged sketch is unchanged
+	require.EqualValues(t, 51, s2.count)
+}
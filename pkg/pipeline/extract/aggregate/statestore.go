@@ -0,0 +1,215 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const stateKeyPrefix = "aggregate/"
+
+// StateStore persists the running totals of the aggregates, so that they resume from them after a restart
+type StateStore interface {
+	Save(key, value []byte) error
+	// Load returns nil when nothing was saved for the key
+	Load(key []byte) ([]byte, error)
+	Close() error
+}
+
+type badgerStateStore struct {
+	db *badger.DB
+}
+
+// NewBadgerStateStore opens, or creates, a BadgerDB state store in the directory
+func NewBadgerStateStore(path string) (StateStore, error) {
+	opts := badger.DefaultOptions(path).
+		WithLogger(log.WithField("component", "aggregate.StateStore")).
+		WithLoggingLevel(badger.WARNING)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("can't open state store %s: %w", path, err)
+	}
+	return &badgerStateStore{db: db}, nil
+}
+
+func (s *badgerStateStore) Save(key, value []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+}
+
+func (s *badgerStateStore) Load(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s *badgerStateStore) Close() error {
+	return s.db.Close()
+}
+
+// newStateStore returns the configured state store, or nil when the state is kept in memory only
+func newStateStore(cfg *api.AggregateStateStore) (StateStore, error) {
+	if cfg == nil || cfg.Path == "" {
+		return nil, nil
+	}
+	switch cfg.Type {
+	case "", api.AggregateStateStoreBadger:
+	default:
+		return nil, fmt.Errorf("unknown state store type %s", cfg.Type)
+	}
+	store, err := NewBadgerStateStore(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-utils.ExitChannel()
+		if err := store.Close(); err != nil {
+			log.WithError(err).Warn("can't close the aggregates state store")
+		}
+	}()
+	return store, nil
+}
+
+// aggregateSnapshot is the persisted state of an aggregate. The definition is saved along, so that the state
+// of a definition that changed meanwhile is discarded.
+type aggregateSnapshot struct {
+	Definition json.RawMessage `json:"definition"`
+	Groups     []groupSnapshot `json:"groups"`
+}
+
+type groupSnapshot struct {
+	Labels        Labels          `json:"labels"`
+	TotalValue    float64         `json:"totalValue"`
+	TotalCount    int             `json:"totalCount"`
+	RecentOpValue float64         `json:"recentOpValue"`
+	RecentCount   int             `json:"recentCount"`
+	SlideIndex    int64           `json:"slideIndex,omitempty"`
+	Slides        []slideSnapshot `json:"slides,omitempty"`
+}
+
+type slideSnapshot struct {
+	OpValue float64 `json:"opValue"`
+	Count   int     `json:"count"`
+}
+
+// persisted tells whether the state of the aggregate is saved: the values of the percentile, distinct_count,
+// raw_values and topN operations aren't running totals, so they always start from scratch
+func (aggregate *Aggregate) persisted() bool {
+	if aggregate.store == nil {
+		return false
+	}
+	switch aggregate.definition.OperationType {
+	case OperationSum, OperationAvg, OperationMax, OperationMin, OperationCount, OperationRate:
+		return true
+	}
+	return false
+}
+
+func (aggregate *Aggregate) stateKey() []byte {
+	return []byte(stateKeyPrefix + aggregate.definition.Name)
+}
+
+// saveState saves the running totals of the groups; it is called with the mutex held, when a window closes
+func (aggregate *Aggregate) saveState() {
+	definition, err := json.Marshal(aggregate.definition)
+	if err != nil {
+		log.WithError(err).Warnf("can't save the state of aggregate %s", aggregate.definition.Name)
+		return
+	}
+	snapshot := aggregateSnapshot{Definition: definition}
+	aggregate.cache.Iterate(func(_ string, value interface{}) {
+		group := value.(*GroupState)
+		gs := groupSnapshot{
+			Labels:        group.labels,
+			TotalValue:    group.totalValue,
+			TotalCount:    group.totalCount,
+			RecentOpValue: group.recentOpValue,
+			RecentCount:   group.recentCount,
+			SlideIndex:    group.slideIndex,
+		}
+		for i := range group.slides {
+			gs.Slides = append(gs.Slides, slideSnapshot{OpValue: group.slides[i].opValue, Count: group.slides[i].count})
+		}
+		snapshot.Groups = append(snapshot.Groups, gs)
+	})
+	value, err := json.Marshal(&snapshot)
+	if err == nil {
+		err = aggregate.store.Save(aggregate.stateKey(), value)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("can't save the state of aggregate %s", aggregate.definition.Name)
+	}
+}
+
+// loadState restores the groups saved by a previous run, unless the definition of the aggregate changed
+func (aggregate *Aggregate) loadState() error {
+	value, err := aggregate.store.Load(aggregate.stateKey())
+	if err != nil || value == nil {
+		return err
+	}
+	var snapshot aggregateSnapshot
+	if err := json.Unmarshal(value, &snapshot); err != nil {
+		return err
+	}
+	definition, err := json.Marshal(aggregate.definition)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(definition, snapshot.Definition) {
+		log.Infof("aggregate %s definition changed, discarding its saved state", aggregate.definition.Name)
+		return nil
+	}
+	for i := range snapshot.Groups {
+		gs := &snapshot.Groups[i]
+		normalizedValues := gs.Labels.getNormalizedValues()
+		group := &GroupState{
+			normalizedValues: normalizedValues,
+			labels:           gs.Labels,
+			totalValue:       gs.TotalValue,
+			totalCount:       gs.TotalCount,
+			recentOpValue:    gs.RecentOpValue,
+			recentCount:      gs.RecentCount,
+			slideIndex:       gs.SlideIndex,
+		}
+		for _, s := range gs.Slides {
+			group.slides = append(group.slides, slideState{opValue: s.OpValue, count: s.Count})
+		}
+		aggregate.cache.UpdateCacheEntry(string(normalizedValues), group)
+	}
+	log.Infof("aggregate %s resumed %d groups from its saved state", aggregate.definition.Name, len(snapshot.Groups))
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func stateStoreConfig(path string, rules ...api.AggregateDefinition) *api.Aggregates {
+	return &api.Aggregates{
+		Rules:      rules,
+		StateStore: &api.AggregateStateStore{Type: api.AggregateStateStoreBadger, Path: path},
+	}
+}
+
+func metricsByName(metrics []config.GenericMap) map[string]config.GenericMap {
+	byName := map[string]config.GenericMap{}
+	for _, m := range metrics {
+		byName[m["name"].(string)] = m
+	}
+	return byName
+}
+
+func Test_StateStoreRestart(t *testing.T) {
+	path := t.TempDir()
+	sum := api.AggregateDefinition{Name: "sum", GroupByKeys: api.AggregateBy{"srcIP"}, OperationType: OperationSum, OperationKey: "value"}
+	avg := api.AggregateDefinition{Name: "avg", GroupByKeys: api.AggregateBy{"srcIP"}, OperationType: OperationAvg, OperationKey: "value"}
+	percentile := api.AggregateDefinition{Name: "p50", GroupByKeys: api.AggregateBy{"srcIP"}, OperationType: OperationPercentile, OperationKey: "value", Percentiles: []float64{50}}
+
+	aggregates, err := NewAggregatesFromConfig(opMetrics, stateStoreConfig(path, sum, avg, percentile))
+	require.NoError(t, err)
+	require.NoError(t, aggregates.Evaluate([]config.GenericMap{entryWithValue(10), entryWithValue(20)}))
+	require.Len(t, aggregates.GetMetrics(), 3)
+	// simulated restart
+	require.NoError(t, aggregates.store.Close())
+
+	aggregates, err = NewAggregatesFromConfig(opMetrics, stateStoreConfig(path, sum, avg, percentile))
+	require.NoError(t, err)
+	defer aggregates.store.Close()
+	require.NoError(t, aggregates.Evaluate([]config.GenericMap{entryWithValue(60)}))
+	metrics := metricsByName(aggregates.GetMetrics())
+	require.Len(t, metrics, 3)
+
+	// the totals resume from the saved state, while the recent values start from the new window
+	require.Equal(t, float64(90), metrics["sum"]["total_value"])
+	require.Equal(t, 3, metrics["sum"]["total_count"])
+	require.Equal(t, float64(60), metrics["sum"]["recent_op_value"])
+	require.Equal(t, 1, metrics["sum"]["recent_count"])
+	require.Equal(t, float64(30), metrics["avg"]["total_value"])
+	require.Equal(t, 3, metrics["avg"]["total_count"])
+	// the percentile sketches aren't saved
+	require.Equal(t, 1, metrics["p50_p50"]["total_count"])
+}
+
+func Test_StateStoreDefinitionChanged(t *testing.T) {
+	path := t.TempDir()
+	def := api.AggregateDefinition{Name: "sum", GroupByKeys: api.AggregateBy{"srcIP"}, OperationType: OperationSum, OperationKey: "value"}
+
+	aggregates, err := NewAggregatesFromConfig(opMetrics, stateStoreConfig(path, def))
+	require.NoError(t, err)
+	require.NoError(t, aggregates.Evaluate([]config.GenericMap{entryWithValue(10)}))
+	require.Len(t, aggregates.GetMetrics(), 1)
+	require.NoError(t, aggregates.store.Close())
+
+	// the saved state doesn't match the new definition
+	def.GroupByKeys = api.AggregateBy{"dstIP"}
+	aggregates, err = NewAggregatesFromConfig(opMetrics, stateStoreConfig(path, def))
+	require.NoError(t, err)
+	defer aggregates.store.Close()
+	require.NoError(t, aggregates.Evaluate([]config.GenericMap{entryWithValue(5)}))
+	metrics := aggregates.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, float64(5), metrics[0]["total_value"])
+}
+
+func Test_StateStoreConfig(t *testing.T) {
+	def := api.AggregateDefinition{Name: "sum", GroupByKeys: api.AggregateBy{"srcIP"}, OperationType: OperationSum, OperationKey: "value"}
+
+	// in memory only without a path
+	aggregates, err := NewAggregatesFromConfig(opMetrics, stateStoreConfig("", def))
+	require.NoError(t, err)
+	require.Nil(t, aggregates.store)
+	require.False(t, aggregates.Aggregates[0].persisted())
+
+	cfg := stateStoreConfig(t.TempDir(), def)
+	cfg.StateStore.Type = "redis"
+	_, err = NewAggregatesFromConfig(opMetrics, cfg)
+	require.Error(t, err)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+)
+
+// topNOtherGroup is the value of the group keys of the record reporting the groups beyond the topN ones
+const topNOtherGroup = "other"
+
+type topNItem struct {
+	normalizedValues NormalizedValues
+	labels           Labels
+	value            float64
+	count            int
+	index            int
+}
+
+// topNHeap tracks at most n groups per window, with the Space-Saving algorithm: when a new group comes in
+// while the heap is full, it replaces the group having the lowest value, and inherits that value.
+// The values are thus overestimated by at most the inherited value, but any group whose value exceeds
+// the window total divided by n is guaranteed to be tracked.
+// As the values are inherited, they always add up to the window total: total and count are kept apart, so that
+// the groups beyond the reported ones can be accounted for.
+type topNHeap struct {
+	n      int
+	items  []*topNItem
+	groups map[NormalizedValues]*topNItem
+	total  float64
+	count  int
+}
+
+func newTopNHeap(n int) *topNHeap {
+	return &topNHeap{n: n, groups: make(map[NormalizedValues]*topNItem, n)}
+}
+
+// heap.Interface implementation: a min-heap on the values
+
+func (h *topNHeap) Len() int { return len(h.items) }
+
+func (h *topNHeap) Less(i, j int) bool { return h.items[i].value < h.items[j].value }
+
+func (h *topNHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *topNHeap) Push(x any) {
+	item := x.(*topNItem)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *topNHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+func (h *topNHeap) add(normalizedValues NormalizedValues, labels Labels, value float64) {
+	h.total += value
+	h.count++
+	if item, ok := h.groups[normalizedValues]; ok {
+		item.value += value
+		item.count++
+		heap.Fix(h, item.index)
+		return
+	}
+	if len(h.items) < h.n {
+		item := &topNItem{normalizedValues: normalizedValues, labels: labels, value: value, count: 1}
+		heap.Push(h, item)
+		h.groups[normalizedValues] = item
+		return
+	}
+	// the group having the lowest value leaves the heap
+	lowest := h.items[0]
+	delete(h.groups, lowest.normalizedValues)
+	lowest.normalizedValues = normalizedValues
+	lowest.labels = labels
+	lowest.value += value
+	lowest.count = 1
+	h.groups[normalizedValues] = lowest
+	heap.Fix(h, 0)
+}
+
+// sorted returns the tracked groups, highest value first
+func (h *topNHeap) sorted() []*topNItem {
+	items := make([]*topNItem, len(h.items))
+	copy(items, h.items)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].value == items[j].value {
+			return items[i].normalizedValues < items[j].normalizedValues
+		}
+		return items[i].value > items[j].value
+	})
+	return items
+}
+
+func (h *topNHeap) reset() {
+	h.items = h.items[:0]
+	clear(h.groups)
+	h.total = 0
+	h.count = 0
+}
+
+func validateTopN(def *api.AggregateDefinition) error {
+	if def.OperationType != OperationTopN {
+		return nil
+	}
+	if def.TopN <= 0 {
+		return fmt.Errorf("aggregate %s: topN must be provided for the topN operation", def.Name)
+	}
+	if def.TopNCapacity != 0 && def.TopNCapacity < def.TopN {
+		return fmt.Errorf("aggregate %s: topNCapacity %d must not be lower than topN %d", def.Name, def.TopNCapacity, def.TopN)
+	}
+	if def.TopNOther && def.TopNCapacity <= def.TopN {
+		return fmt.Errorf("aggregate %s: topNOther requires topNCapacity to be greater than topN", def.Name)
+	}
+	if def.Window != nil && def.Window.Type == api.AggregateWindowSliding {
+		return fmt.Errorf("aggregate %s: the topN operation doesn't support sliding windows", def.Name)
+	}
+	return nil
+}
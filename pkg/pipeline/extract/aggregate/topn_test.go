@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func getMockTopNAggregate(n int) Aggregate {
+	aggregate := GetMockAggregate()
+	aggregate.definition.Name = "top_sources"
+	aggregate.definition.GroupByKeys = api.AggregateBy{"srcIP"}
+	aggregate.definition.OperationType = OperationTopN
+	aggregate.definition.TopN = n
+	aggregate.topN = newTopNHeap(n)
+	return aggregate
+}
+
+func srcEntry(srcIP string, value float64) config.GenericMap {
+	return config.GenericMap{"srcIP": srcIP, "value": value}
+}
+
+func topNValues(metrics []config.GenericMap) map[string]float64 {
+	values := map[string]float64{}
+	for _, m := range metrics {
+		values[m["srcIP"].(string)] = m["recent_op_value"].(float64)
+	}
+	return values
+}
+
+func Test_TopN(t *testing.T) {
+	aggregate := getMockTopNAggregate(2)
+
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{
+		srcEntry("10.0.0.1", 10),
+		srcEntry("10.0.0.2", 5),
+		srcEntry("10.0.0.1", 2),
+	}))
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 2)
+	require.Equal(t, config.GenericMap{
+		"name":            "top_sources",
+		"operation_type":  api.AggregateOperation(OperationTopN),
+		"operation_key":   "value",
+		"by":              "srcIP",
+		"aggregate":       "10.0.0.1",
+		"srcIP":           "10.0.0.1",
+		"recent_op_value": float64(12),
+		"recent_count":    2,
+		"rank":            1,
+	}, metrics[0])
+	require.Equal(t, "10.0.0.2", metrics[1]["srcIP"])
+	require.Equal(t, 2, metrics[1]["rank"])
+
+	// a new window starts after the metrics are reported
+	require.Empty(t, aggregate.GetMetrics())
+}
+
+func Test_TopNKeysEnterAndLeave(t *testing.T) {
+	aggregate := getMockTopNAggregate(2)
+
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{
+		srcEntry("10.0.0.1", 10),
+		srcEntry("10.0.0.2", 5),
+		// 10.0.0.2 leaves the heap: 10.0.0.3 inherits its value
+		srcEntry("10.0.0.3", 1),
+		// 10.0.0.3 leaves the heap in turn
+		srcEntry("10.0.0.4", 20),
+	}))
+	require.Equal(t, map[string]float64{"10.0.0.4": 26, "10.0.0.1": 10}, topNValues(aggregate.GetMetrics()))
+
+	// groups that left in the previous window can come back
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{
+		srcEntry("10.0.0.2", 3),
+		srcEntry("10.0.0.3", 4),
+	}))
+	require.Equal(t, map[string]float64{"10.0.0.2": 3, "10.0.0.3": 4}, topNValues(aggregate.GetMetrics()))
+}
+
+func Test_TopNCount(t *testing.T) {
+	aggregate := getMockTopNAggregate(1)
+	aggregate.definition.OperationKey = ""
+
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{
+		srcEntry("10.0.0.1", 100),
+		srcEntry("10.0.0.2", 1),
+		srcEntry("10.0.0.2", 1),
+	}))
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, "10.0.0.2", metrics[0]["srcIP"])
+	require.Equal(t, float64(3), metrics[0]["recent_op_value"])
+}
+
+func Test_TopNOther(t *testing.T) {
+	aggregate := getMockTopNAggregate(2)
+	aggregate.definition.TopNCapacity = 4
+	aggregate.definition.TopNOther = true
+	aggregate.topN = newTopNHeap(4)
+
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{
+		srcEntry("10.0.0.1", 10),
+		srcEntry("10.0.0.2", 5),
+		srcEntry("10.0.0.3", 3),
+		srcEntry("10.0.0.4", 1),
+		// 10.0.0.4 leaves the heap, but its flow is still counted in the other groups
+		srcEntry("10.0.0.5", 1),
+	}))
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 3)
+	require.Equal(t, map[string]float64{"10.0.0.1": 10, "10.0.0.2": 5, "other": 5}, topNValues(metrics))
+	require.Equal(t, config.GenericMap{
+		"name":            "top_sources",
+		"operation_type":  api.AggregateOperation(OperationTopN),
+		"operation_key":   "value",
+		"by":              "srcIP",
+		"aggregate":       "other",
+		"srcIP":           "other",
+		"recent_op_value": float64(5),
+		"recent_count":    3,
+	}, metrics[2])
+
+	// no other record when all the groups are reported
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{srcEntry("10.0.0.1", 10)}))
+	require.Len(t, aggregate.GetMetrics(), 1)
+}
+
+func Test_NewAggregatesFromConfigTopN(t *testing.T) {
+	def := api.AggregateDefinition{
+		Name:          "top_sources",
+		GroupByKeys:   api.AggregateBy{"srcIP"},
+		OperationType: OperationTopN,
+		OperationKey:  "value",
+	}
+	_, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.TopN = 10
+	def.Window = &api.AggregateWindow{Type: api.AggregateWindowSliding}
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.Window = nil
+	aggregates, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.NoError(t, err)
+	require.Equal(t, 10, aggregates.Aggregates[0].topN.n)
+
+	def.TopNOther = true
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.TopNCapacity = 5
+	_, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.Error(t, err)
+
+	def.TopNCapacity = 100
+	aggregates, err = NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.NoError(t, err)
+	require.Equal(t, 100, aggregates.Aggregates[0].topN.n)
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	util "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxWindowSlides bounds the number of slides kept per group, hence the memory used by sliding windows
+const maxWindowSlides = 120
+
+// slidingWindow splits the time in slides of equal duration, aligned on the epoch. A slide starts
+// inclusively and ends exclusively, so a flow received right at a boundary belongs to the new slide.
+// Each group accumulates the current slide in its recent values, and keeps the values of the last
+// completed slides; the window value is computed from these completed slides when reported.
+type slidingWindow struct {
+	slide        time.Duration
+	slides       int
+	lastReported int64
+	// eventTime is nil unless a time field is configured: the slides then follow the watermark rather than the clock
+	eventTime *eventTime
+}
+
+var lateFlowsDef = operational.DefineMetric(
+	"aggregate_late_flows",
+	"Counter of the flows older than the watermark of an aggregate with event time, dropped or counted apart according to the late policy",
+	operational.TypeCounter,
+	"aggregate", "policy",
+)
+
+// eventTime tracks the watermark of an aggregate: the latest event time seen minus the allowed lateness.
+// Flows older than the watermark are late, as the slide they belong to may be already completed.
+type eventTime struct {
+	field     string
+	lateness  time.Duration
+	policy    api.AggregateLatePolicyEnum
+	latest    time.Time
+	seen      bool
+	lateFlows prometheus.Counter
+}
+
+func (e *eventTime) watermark() time.Time {
+	return e.latest.Add(-e.lateness)
+}
+
+// observe returns the event time of the entry, and advances the watermark
+func (e *eventTime) observe(entry config.GenericMap) (time.Time, bool) {
+	v, ok := entry[e.field]
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := util.ConvertToInt64(v)
+	if err != nil {
+		log.Debugf("can't parse event time %s '%v': %v", e.field, v, err)
+		return time.Time{}, false
+	}
+	t := time.UnixMilli(ms)
+	if !e.seen || t.After(e.latest) {
+		e.latest = t
+		e.seen = true
+	}
+	return t, true
+}
+
+// slideState holds the aggregated values of a completed slide
+type slideState struct {
+	opValue   float64
+	count     int
+	rawValues []float64
+	sketch    *sketch
+	hll       *hll
+}
+
+func newSlidingWindow(cfg *api.AggregateWindow, now time.Time) *slidingWindow {
+	if cfg == nil || cfg.Type != api.AggregateWindowSliding {
+		return nil
+	}
+	w := &slidingWindow{
+		slide:  cfg.Slide.Duration,
+		slides: int(cfg.Size.Duration / cfg.Slide.Duration),
+	}
+	if cfg.TimeField != "" {
+		w.eventTime = &eventTime{field: cfg.TimeField, lateness: cfg.AllowedLateness.Duration, policy: cfg.LatePolicy}
+		if w.eventTime.policy == "" {
+			w.eventTime.policy = api.AggregateLateDrop
+		}
+		// nothing is reported until the watermark is known
+		w.lastReported = math.MinInt64
+	} else {
+		w.lastReported = w.slideIndex(now)
+	}
+	return w
+}
+
+func (w *slidingWindow) size() time.Duration {
+	return w.slide * time.Duration(w.slides)
+}
+
+func (w *slidingWindow) slideIndex(t time.Time) int64 {
+	return t.UnixNano() / int64(w.slide)
+}
+
+func validateWindow(def *api.AggregateDefinition) error {
+	if def.Window == nil {
+		return nil
+	}
+	switch def.Window.Type {
+	case "", api.AggregateWindowTumbling:
+		if def.Window.TimeField != "" {
+			return fmt.Errorf("aggregate %s: timeField requires a sliding window", def.Name)
+		}
+		return nil
+	case api.AggregateWindowSliding:
+		size, slide := def.Window.Size.Duration, def.Window.Slide.Duration
+		if size <= 0 || slide <= 0 {
+			return fmt.Errorf("aggregate %s: sliding window size and slide must be provided", def.Name)
+		}
+		if size%slide != 0 {
+			return fmt.Errorf("aggregate %s: sliding window size %v must be a multiple of slide %v", def.Name, size, slide)
+		}
+		if size/slide > maxWindowSlides {
+			return fmt.Errorf("aggregate %s: sliding window size %v can't be more than %d times the slide %v", def.Name, size, maxWindowSlides, slide)
+		}
+		return validateEventTime(def)
+	}
+	return fmt.Errorf("aggregate %s: unknown window type %s", def.Name, def.Window.Type)
+}
+
+func validateEventTime(def *api.AggregateDefinition) error {
+	w := def.Window
+	if w.TimeField == "" {
+		if w.AllowedLateness.Duration != 0 || w.LatePolicy != "" {
+			return fmt.Errorf("aggregate %s: allowedLateness and latePolicy require a timeField", def.Name)
+		}
+		return nil
+	}
+	if w.AllowedLateness.Duration < 0 {
+		return fmt.Errorf("aggregate %s: allowedLateness must not be negative", def.Name)
+	}
+	if w.AllowedLateness.Duration/w.Slide.Duration > maxWindowSlides {
+		return fmt.Errorf("aggregate %s: allowedLateness %v can't be more than %d times the slide %v", def.Name, w.AllowedLateness.Duration, maxWindowSlides, w.Slide.Duration)
+	}
+	switch w.LatePolicy {
+	case "", api.AggregateLateDrop, api.AggregateLateBucket:
+		return nil
+	}
+	return fmt.Errorf("aggregate %s: unknown late policy %s", def.Name, w.LatePolicy)
+}
+
+// windowIndex returns the index of the current slide: the slide of the watermark with event time, or else of the clock
+func (aggregate *Aggregate) windowIndex() int64 {
+	if et := aggregate.window.eventTime; et != nil {
+		return aggregate.window.slideIndex(et.watermark())
+	}
+	return aggregate.window.slideIndex(aggregate.now())
+}
+
+// eventSlide returns the slide where the flow of the given event time is counted: nil for the recent values
+// of the group, or a slide ahead of the watermark, or the late bucket. It returns false when the flow is dropped.
+func (aggregate *Aggregate) eventSlide(group *GroupState, t time.Time) (*slideState, bool) {
+	et := aggregate.window.eventTime
+	if t.Before(et.watermark()) {
+		et.lateFlows.Inc()
+		if et.policy != api.AggregateLateBucket {
+			return nil, false
+		}
+		if group.late == nil {
+			group.late = aggregate.newSlide()
+		}
+		return group.late, true
+	}
+	index := aggregate.window.slideIndex(t)
+	if index <= group.slideIndex {
+		return nil, true
+	}
+	if group.ahead == nil {
+		group.ahead = map[int64]*slideState{}
+	}
+	s, ok := group.ahead[index]
+	if !ok {
+		s = aggregate.newSlide()
+		group.ahead[index] = s
+	}
+	return s, true
+}
+
+// swapRecent exchanges the recent values of the group with the slide, so that the flows are counted in the slide
+func (group *GroupState) swapRecent(s *slideState) {
+	group.recentOpValue, s.opValue = s.opValue, group.recentOpValue
+	group.recentCount, s.count = s.count, group.recentCount
+	group.recentRawValues, s.rawValues = s.rawValues, group.recentRawValues
+	group.recentSketch, s.sketch = s.sketch, group.recentSketch
+	group.recentHLL, s.hll = s.hll, group.recentHLL
+}
+
+// rotate completes the group's slides until index becomes its current slide
+func (aggregate *Aggregate) rotate(group *GroupState, index int64) {
+	// with event time, the slides received ahead of the watermark become the recent values in turn
+	for len(group.ahead) > 0 && group.slideIndex < index {
+		aggregate.completeSlide(group)
+		group.slideIndex++
+		if s, ok := group.ahead[group.slideIndex]; ok {
+			group.swapRecent(s)
+			delete(group.ahead, group.slideIndex)
+		}
+	}
+	steps := index - group.slideIndex
+	if steps <= 0 {
+		return
+	}
+	if steps > int64(aggregate.window.slides) {
+		// the current slide is already out of the window
+		aggregate.resetRecent(group)
+		steps = int64(aggregate.window.slides)
+	}
+	for ; steps > 0; steps-- {
+		aggregate.completeSlide(group)
+	}
+	group.slideIndex = index
+}
+
+// completeSlide moves the recent values to the completed slides, dropping the oldest one when the window is full
+func (aggregate *Aggregate) completeSlide(group *GroupState) {
+	var recycled *sketch
+	var recycledHLL *hll
+	if len(group.slides) == aggregate.window.slides {
+		recycled = group.slides[0].sketch
+		recycledHLL = group.slides[0].hll
+		group.slides = append(group.slides[:0], group.slides[1:]...)
+	}
+	group.slides = append(group.slides, slideState{
+		opValue:   group.recentOpValue,
+		count:     group.recentCount,
+		rawValues: group.recentRawValues,
+		sketch:    group.recentSketch,
+		hll:       group.recentHLL,
+	})
+	operation := aggregate.definition.OperationType
+	group.recentCount = 0
+	group.recentOpValue = getInitValue(string(operation))
+	if operation == OperationRawValues {
+		group.recentRawValues = make([]float64, 0)
+	}
+	if operation == OperationPercentile {
+		if recycled != nil {
+			recycled.reset()
+			group.recentSketch = recycled
+		} else {
+			group.recentSketch = newSketch(aggregate.errorBound())
+		}
+	}
+	if operation == OperationDistinctCount {
+		if recycledHLL != nil {
+			recycledHLL.reset()
+			group.recentHLL = recycledHLL
+		} else {
+			group.recentHLL = newHLL(aggregate.errorBound())
+		}
+	}
+}
+
+// newSlide returns an empty slide
+func (aggregate *Aggregate) newSlide() *slideState {
+	operation := aggregate.definition.OperationType
+	s := &slideState{opValue: getInitValue(string(operation))}
+	if operation == OperationRawValues {
+		s.rawValues = make([]float64, 0)
+	}
+	if operation == OperationPercentile {
+		s.sketch = newSketch(aggregate.errorBound())
+	}
+	if operation == OperationDistinctCount {
+		s.hll = newHLL(aggregate.errorBound())
+	}
+	return s
+}
+
+// windowValues combines the completed slides of the group
+func (aggregate *Aggregate) windowValues(group *GroupState) slideState {
+	operation := aggregate.definition.OperationType
+	window := *aggregate.newSlide()
+	for i := range group.slides {
+		s := &group.slides[i]
+		if s.count == 0 {
+			continue
+		}
+		switch operation {
+		case OperationSum, OperationCount, OperationRate:
+			window.opValue += s.opValue
+		case OperationMax:
+			window.opValue = math.Max(window.opValue, s.opValue)
+		case OperationMin:
+			window.opValue = math.Min(window.opValue, s.opValue)
+		case OperationAvg:
+			window.opValue += s.opValue * float64(s.count)
+		case OperationRawValues:
+			window.rawValues = append(window.rawValues, s.rawValues...)
+		case OperationPercentile:
+			window.sketch.merge(s.sketch)
+		case OperationDistinctCount:
+			window.hll.merge(s.hll)
+		}
+		window.count += s.count
+	}
+	if operation == OperationAvg && window.count > 0 {
+		window.opValue /= float64(window.count)
+	}
+	return window
+}
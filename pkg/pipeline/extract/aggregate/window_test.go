@@ -0,0 +1,338 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+// slide boundaries are aligned on the epoch: 3000s is the start of a 30s slide
+var windowStart = time.Unix(3000, 0)
+
+func getMockSlidingAggregate(operation string, clock *time.Time) Aggregate {
+	aggregate := GetMockAggregate()
+	aggregate.definition.OperationType = api.AggregateOperation(operation)
+	aggregate.definition.Window = &api.AggregateWindow{
+		Type:  api.AggregateWindowSliding,
+		Size:  api.Duration{Duration: time.Minute},
+		Slide: api.Duration{Duration: 30 * time.Second},
+	}
+	aggregate.window = newSlidingWindow(aggregate.definition.Window, *clock)
+	aggregate.now = func() time.Time { return *clock }
+	return aggregate
+}
+
+func entryWithValue(value float64) config.GenericMap {
+	entry := test.GetIngestMockEntry(false)
+	entry["value"] = value
+	return entry
+}
+
+func Test_SlidingWindow(t *testing.T) {
+	clock := windowStart
+	aggregate := getMockSlidingAggregate(OperationSum, &clock)
+
+	clock = windowStart.Add(10 * time.Second)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(1)}))
+	// the window has not advanced yet: nothing reported
+	require.Empty(t, aggregate.GetMetrics())
+
+	// a flow arriving right at the boundary belongs to the next slide
+	clock = windowStart.Add(30 * time.Second)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(2)}))
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, 1, metrics[0]["recent_count"])
+	require.Equal(t, float64(1), metrics[0]["recent_op_value"])
+	require.Equal(t, float64(3), metrics[0]["total_value"])
+
+	// reported only once per slide
+	clock = windowStart.Add(50 * time.Second)
+	require.Empty(t, aggregate.GetMetrics())
+
+	// both slides are in the window
+	clock = windowStart.Add(60 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, 2, metrics[0]["recent_count"])
+	require.Equal(t, float64(3), metrics[0]["recent_op_value"])
+
+	// the first slide left the window
+	clock = windowStart.Add(90 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, 1, metrics[0]["recent_count"])
+	require.Equal(t, float64(2), metrics[0]["recent_op_value"])
+
+	// the window is empty
+	clock = windowStart.Add(120 * time.Second)
+	require.Empty(t, aggregate.GetMetrics())
+
+	// values older than the window are dropped when the group is updated after a long time
+	clock = windowStart.Add(10 * time.Minute)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(5)}))
+	clock = clock.Add(30 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, 1, metrics[0]["recent_count"])
+	require.Equal(t, float64(5), metrics[0]["recent_op_value"])
+	require.Equal(t, float64(8), metrics[0]["total_value"])
+}
+
+func Test_SlidingWindowOperations(t *testing.T) {
+	for _, tc := range []struct {
+		operation string
+		expected  float64
+	}{
+		{operation: OperationSum, expected: 15},
+		{operation: OperationCount, expected: 3},
+		{operation: OperationMin, expected: 2},
+		{operation: OperationMax, expected: 9},
+		{operation: OperationAvg, expected: 5},
+	} {
+		t.Run(tc.operation, func(t *testing.T) {
+			clock := windowStart
+			aggregate := getMockSlidingAggregate(tc.operation, &clock)
+			require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(4), entryWithValue(9)}))
+			clock = windowStart.Add(30 * time.Second)
+			require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(2)}))
+			// 2 slides later, the first slide is still in the window
+			clock = windowStart.Add(60 * time.Second)
+			metrics := aggregate.GetMetrics()
+			require.Len(t, metrics, 1)
+			require.Equal(t, tc.expected, metrics[0]["recent_op_value"])
+			require.Equal(t, 3, metrics[0]["recent_count"])
+		})
+	}
+}
+
+func Test_SlidingWindowRate(t *testing.T) {
+	clock := windowStart
+	aggregate := getMockSlidingAggregate(OperationRate, &clock)
+
+	clock = windowStart.Add(10 * time.Second)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(30)}))
+	clock = windowStart.Add(30*time.Second - time.Millisecond)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(30)}))
+	// right at the boundary: counted in the next slide
+	clock = windowStart.Add(30 * time.Second)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(60)}))
+
+	// the sum of the window is divided by the 1 minute window size
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, float64(60), metrics[0]["recent_op_value"])
+	require.Equal(t, float64(1), metrics[0]["rate"])
+	require.Equal(t, float64(120), metrics[0]["total_value"])
+
+	clock = windowStart.Add(60 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, float64(2), metrics[0]["rate"])
+
+	// the group went silent: the rate decays as its slides leave the window
+	clock = windowStart.Add(90 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, float64(1), metrics[0]["rate"])
+
+	// then drops to 0, reported once
+	clock = windowStart.Add(120 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, float64(0), metrics[0]["rate"])
+	require.Equal(t, 0, metrics[0]["recent_count"])
+	clock = windowStart.Add(150 * time.Second)
+	require.Empty(t, aggregate.GetMetrics())
+
+	// and is reported again once the group gets new flows
+	clock = windowStart.Add(160 * time.Second)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(6)}))
+	clock = windowStart.Add(180 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, 0.1, metrics[0]["rate"])
+
+	// without operationKey, the rate of the flows is reported
+	clock = windowStart
+	aggregate = getMockSlidingAggregate(OperationRate, &clock)
+	aggregate.definition.OperationKey = ""
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(4), entryWithValue(9), entryWithValue(2)}))
+	clock = windowStart.Add(30 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, 0.05, metrics[0]["rate"])
+}
+
+func Test_SlidingWindowRawValuesAndPercentiles(t *testing.T) {
+	clock := windowStart
+	aggregate := getMockSlidingAggregate(OperationRawValues, &clock)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(4), entryWithValue(9)}))
+	clock = windowStart.Add(30 * time.Second)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(2)}))
+	clock = windowStart.Add(60 * time.Second)
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, []float64{4, 9, 2}, metrics[0]["recent_raw_values"])
+
+	clock = windowStart
+	aggregate = getMockSlidingAggregate(OperationPercentile, &clock)
+	aggregate.definition.Percentiles = []float64{50}
+	for i := 1; i <= 50; i++ {
+		require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(float64(i))}))
+	}
+	clock = windowStart.Add(30 * time.Second)
+	for i := 51; i <= 100; i++ {
+		require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(float64(i))}))
+	}
+	clock = windowStart.Add(60 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.InEpsilon(t, 50, metrics[0]["recent_op_value"], defaultErrorBound)
+	// the first slide leaves the window, its sketch is recycled
+	clock = windowStart.Add(90 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.InEpsilon(t, 75, metrics[0]["recent_op_value"], defaultErrorBound)
+	require.Equal(t, 50, metrics[0]["recent_count"])
+}
+
+func Test_SlidingWindowDistinctCount(t *testing.T) {
+	clock := windowStart
+	aggregate := getMockSlidingAggregate(OperationDistinctCount, &clock)
+	// values 1 to 50, then 26 to 75: 75 distinct values over the window
+	for i := 1; i <= 50; i++ {
+		require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(float64(i))}))
+	}
+	clock = windowStart.Add(30 * time.Second)
+	for i := 26; i <= 75; i++ {
+		require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryWithValue(float64(i))}))
+	}
+	clock = windowStart.Add(60 * time.Second)
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.InEpsilon(t, 75.0, metrics[0]["recent_op_value"], defaultHLLErrorBound)
+	// the first slide leaves the window, its sketch is recycled
+	clock = windowStart.Add(90 * time.Second)
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.InEpsilon(t, 50.0, metrics[0]["recent_op_value"], defaultHLLErrorBound)
+	require.InEpsilon(t, 75.0, metrics[0]["total_value"], defaultHLLErrorBound)
+}
+
+func getMockEventTimeAggregate(t *testing.T, policy api.AggregateLatePolicyEnum) Aggregate {
+	def := api.AggregateDefinition{
+		Name:          "bytes",
+		GroupByKeys:   api.AggregateBy{"srcIP"},
+		OperationType: OperationSum,
+		OperationKey:  "value",
+		Window: &api.AggregateWindow{
+			Type:            api.AggregateWindowSliding,
+			Size:            api.Duration{Duration: time.Minute},
+			Slide:           api.Duration{Duration: 30 * time.Second},
+			TimeField:       "time",
+			AllowedLateness: api.Duration{Duration: 30 * time.Second},
+			LatePolicy:      policy,
+		},
+	}
+	aggregates, err := NewAggregatesFromConfig(opMetrics, &api.Aggregates{Rules: api.AggregateDefinitions{def}})
+	require.NoError(t, err)
+	return aggregates.Aggregates[0]
+}
+
+// entryAt returns a flow with the given event time, relative to windowStart
+func entryAt(offset time.Duration, value float64) config.GenericMap {
+	return config.GenericMap{"srcIP": "10.0.0.1", "value": value, "time": windowStart.Add(offset).UnixMilli()}
+}
+
+func lateFlows(t *testing.T, aggregate *Aggregate) float64 {
+	var m dto.Metric
+	require.NoError(t, aggregate.window.eventTime.lateFlows.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func Test_SlidingWindowEventTime(t *testing.T) {
+	aggregate := getMockEventTimeAggregate(t, api.AggregateLateDrop)
+	// nothing is reported before the first event time
+	require.Empty(t, aggregate.GetMetrics())
+
+	// the watermark is 30s behind the latest event time
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(10*time.Second, 1)}))
+	require.Empty(t, aggregate.GetMetrics())
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(40*time.Second, 2)}))
+	// out of order, but within the allowed lateness: counted in its own slide
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(20*time.Second, 4)}))
+	// the slide [0s, 30s) is still open
+	require.Empty(t, aggregate.GetMetrics())
+
+	// the watermark passes 30s: the slide [0s, 30s) is completed
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(70*time.Second, 8)}))
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, "bytes", metrics[0]["name"])
+	require.Equal(t, float64(5), metrics[0]["recent_op_value"])
+	require.Equal(t, 2, metrics[0]["recent_count"])
+
+	// older than the watermark: dropped and counted
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(5*time.Second, 100)}))
+	require.Equal(t, float64(1), lateFlows(t, &aggregate))
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(100*time.Second, 16)}))
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, float64(7), metrics[0]["recent_op_value"])
+	require.Equal(t, 3, metrics[0]["recent_count"])
+
+	// flows without event time are ignored
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{{"srcIP": "10.0.0.1", "value": 32}}))
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(130*time.Second, 64)}))
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, float64(10), metrics[0]["recent_op_value"])
+}
+
+func Test_SlidingWindowEventTimeLateBucket(t *testing.T) {
+	aggregate := getMockEventTimeAggregate(t, api.AggregateLateBucket)
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(10*time.Second, 1), entryAt(70*time.Second, 2)}))
+	require.Len(t, aggregate.GetMetrics(), 1)
+
+	// older than the watermark: counted in the late bucket, reported apart on the next slide
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(5*time.Second, 4), entryAt(15*time.Second, 8)}))
+	require.Equal(t, float64(2), lateFlows(t, &aggregate))
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(100*time.Second, 16)}))
+	metrics := aggregate.GetMetrics()
+	require.Len(t, metrics, 2)
+	require.Equal(t, "bytes_late", metrics[0]["name"])
+	require.Equal(t, float64(12), metrics[0]["recent_op_value"])
+	require.Equal(t, 2, metrics[0]["recent_count"])
+	require.Equal(t, "bytes", metrics[1]["name"])
+	require.Equal(t, float64(1), metrics[1]["recent_op_value"])
+
+	// the late bucket is reset once reported
+	require.NoError(t, aggregate.Evaluate([]config.GenericMap{entryAt(130*time.Second, 32)}))
+	metrics = aggregate.GetMetrics()
+	require.Len(t, metrics, 1)
+	require.Equal(t, "bytes", metrics[0]["name"])
+	require.Equal(t, float64(2), metrics[0]["recent_op_value"])
+}
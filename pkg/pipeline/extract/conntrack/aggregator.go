@@ -34,6 +34,8 @@ type aggregator interface {
 	addField(conn connection)
 	// update updates the aggregate field in the connection based on the flow log.
 	update(conn connection, flowLog config.GenericMap, d direction, isFirst bool)
+	// resetDelta resets the delta fields of the connection, after a connection record has been emitted
+	resetDelta(conn connection)
 }
 
 type aggregateBase struct {
@@ -43,6 +45,7 @@ type aggregateBase struct {
 	initVal       interface{}
 	metrics       *metricsType
 	reportMissing bool
+	delta         bool
 }
 
 type aSum struct{ aggregateBase }
@@ -65,7 +68,7 @@ func newAggregator(of api.OutputField, metrics *metricsType) (aggregator, error)
 	} else {
 		inputField = of.Name
 	}
-	aggBase := aggregateBase{inputField: inputField, outputField: of.Name, splitAB: of.SplitAB, metrics: metrics, reportMissing: of.ReportMissing}
+	aggBase := aggregateBase{inputField: inputField, outputField: of.Name, splitAB: of.SplitAB, metrics: metrics, reportMissing: of.ReportMissing, delta: of.Delta}
 	var agg aggregator
 	switch of.Operation {
 	case api.ConnTrackSum:
@@ -132,12 +135,36 @@ func (agg *aggregateBase) getInputFieldValue(flowLog config.GenericMap) (float64
 	return floatValue, nil
 }
 
-func (agg *aggregateBase) addField(conn connection) {
+func (agg *aggregateBase) outputFields() []string {
 	if agg.splitAB {
-		conn.addAgg(agg.getOutputField(dirAB), agg.initVal)
-		conn.addAgg(agg.getOutputField(dirBA), agg.initVal)
-	} else {
-		conn.addAgg(agg.getOutputField(dirNA), agg.initVal)
+		return []string{agg.getOutputField(dirAB), agg.getOutputField(dirBA)}
+	}
+	return []string{agg.getOutputField(dirNA)}
+}
+
+func (agg *aggregateBase) addField(conn connection) {
+	for _, outputField := range agg.outputFields() {
+		conn.addAgg(outputField, agg.initVal)
+		if agg.delta {
+			conn.addAgg(outputField+"_delta", agg.initVal)
+		}
+	}
+}
+
+// updateFnValue updates the output field and its delta field, if any
+func (agg *aggregateBase) updateFnValue(conn connection, outputField string, newValueFn func(curr float64) float64) {
+	conn.updateAggFnValue(outputField, newValueFn)
+	if agg.delta {
+		conn.updateAggFnValue(outputField+"_delta", newValueFn)
+	}
+}
+
+func (agg *aggregateBase) resetDelta(conn connection) {
+	if !agg.delta {
+		return
+	}
+	for _, outputField := range agg.outputFields() {
+		conn.updateAggValue(outputField+"_delta", agg.initVal)
 	}
 }
 
@@ -148,14 +175,14 @@ func (agg *aSum) update(conn connection, flowLog config.GenericMap, d direction,
 		log.Errorf("error updating connection %x: %v", conn.getHash().hashTotal, err)
 		return
 	}
-	conn.updateAggFnValue(outputField, func(curr float64) float64 {
+	agg.updateFnValue(conn, outputField, func(curr float64) float64 {
 		return curr + v
 	})
 }
 
 func (agg *aCount) update(conn connection, _ config.GenericMap, d direction, _ bool) {
 	outputField := agg.getOutputField(d)
-	conn.updateAggFnValue(outputField, func(curr float64) float64 {
+	agg.updateFnValue(conn, outputField, func(curr float64) float64 {
 		return curr + 1
 	})
 }
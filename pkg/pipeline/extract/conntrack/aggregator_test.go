@@ -66,52 +66,57 @@ func TestNewAggregator_Valid(t *testing.T) {
 		{
 			name:        "Default SplitAB",
 			outputField: api.OutputField{Name: "MyAgg", Operation: "sum"},
-			expected:    &aSum{aggregateBase{"MyAgg", "MyAgg", false, float64(0), nil, false}},
+			expected:    &aSum{aggregateBase{"MyAgg", "MyAgg", false, float64(0), nil, false, false}},
 		},
 		{
 			name:        "Default input",
 			outputField: api.OutputField{Name: "MyAgg", Operation: "sum", SplitAB: true},
-			expected:    &aSum{aggregateBase{"MyAgg", "MyAgg", true, float64(0), nil, false}},
+			expected:    &aSum{aggregateBase{"MyAgg", "MyAgg", true, float64(0), nil, false, false}},
 		},
 		{
 			name:        "Custom input",
 			outputField: api.OutputField{Name: "MyAgg", Operation: "sum", Input: "MyInput"},
-			expected:    &aSum{aggregateBase{"MyInput", "MyAgg", false, float64(0), nil, false}},
+			expected:    &aSum{aggregateBase{"MyInput", "MyAgg", false, float64(0), nil, false, false}},
 		},
 		{
 			name:        "OperationType sum with errors",
 			outputField: api.OutputField{Name: "MyAgg", Operation: "sum", ReportMissing: true},
-			expected:    &aSum{aggregateBase{"MyAgg", "MyAgg", false, float64(0), nil, true}},
+			expected:    &aSum{aggregateBase{"MyAgg", "MyAgg", false, float64(0), nil, true, false}},
 		},
 		{
 			name:        "OperationType count with errors",
 			outputField: api.OutputField{Name: "MyAgg", Operation: "count", ReportMissing: true},
-			expected:    &aCount{aggregateBase{"MyAgg", "MyAgg", false, float64(0), nil, true}},
+			expected:    &aCount{aggregateBase{"MyAgg", "MyAgg", false, float64(0), nil, true, false}},
+		},
+		{
+			name:        "OperationType count with delta",
+			outputField: api.OutputField{Name: "MyAgg", Operation: "count", Delta: true},
+			expected:    &aCount{aggregateBase{"MyAgg", "MyAgg", false, float64(0), nil, false, true}},
 		},
 		{
 			name:        "OperationType max",
 			outputField: api.OutputField{Name: "MyAgg", Operation: "max"},
-			expected:    &aMax{aggregateBase{"MyAgg", "MyAgg", false, -math.MaxFloat64, nil, false}},
+			expected:    &aMax{aggregateBase{"MyAgg", "MyAgg", false, -math.MaxFloat64, nil, false, false}},
 		},
 		{
 			name:        "OperationType min",
 			outputField: api.OutputField{Name: "MyAgg", Operation: "min"},
-			expected:    &aMin{aggregateBase{"MyAgg", "MyAgg", false, math.MaxFloat64, nil, false}},
+			expected:    &aMin{aggregateBase{"MyAgg", "MyAgg", false, math.MaxFloat64, nil, false, false}},
 		},
 		{
 			name:        "Default first",
 			outputField: api.OutputField{Name: "MyCp", Operation: "first"},
-			expected:    &aFirst{aggregateBase{"MyCp", "MyCp", false, nil, nil, false}},
+			expected:    &aFirst{aggregateBase{"MyCp", "MyCp", false, nil, nil, false, false}},
 		},
 		{
 			name:        "Custom input first",
 			outputField: api.OutputField{Name: "MyCp", Operation: "first", Input: "MyInput"},
-			expected:    &aFirst{aggregateBase{"MyInput", "MyCp", false, nil, nil, false}},
+			expected:    &aFirst{aggregateBase{"MyInput", "MyCp", false, nil, nil, false, false}},
 		},
 		{
 			name:        "Default last",
 			outputField: api.OutputField{Name: "MyCp", Operation: "last"},
-			expected:    &aLast{aggregateBase{"MyCp", "MyCp", false, nil, nil, false}},
+			expected:    &aLast{aggregateBase{"MyCp", "MyCp", false, nil, nil, false, false}},
 		},
 	}
 
@@ -280,3 +285,51 @@ func TestFloat64ConversionError(t *testing.T) {
 	exposed := test.ReadExposedMetrics(t, prometheus.DefaultGatherer)
 	require.Contains(t, exposed, `conntrack_aggregator_errors{error="Float64ConversionError",field="Bytes"} 1`)
 }
+
+func TestDelta(t *testing.T) {
+	ofs := []api.OutputField{
+		{Name: "Bytes", Operation: "sum", SplitAB: true, Delta: true},
+		{Name: "numFlowLogs", Operation: "count", Delta: true},
+	}
+	conn := newConnBuilder(nil).Build()
+	var aggs []aggregator
+	for _, of := range ofs {
+		agg, err := newAggregator(of, nil)
+		require.NoError(t, err)
+		agg.addField(conn)
+		aggs = append(aggs, agg)
+	}
+	update := func(bytes int, d direction) {
+		for _, agg := range aggs {
+			agg.update(conn, config.GenericMap{"Bytes": bytes}, d, false)
+		}
+	}
+	resetDelta := func() {
+		for _, agg := range aggs {
+			agg.resetDelta(conn)
+		}
+	}
+
+	update(100, dirAB)
+	update(300, dirBA)
+	require.Equal(t, map[string]interface{}{
+		"Bytes_AB":          float64(100),
+		"Bytes_AB_delta":    float64(100),
+		"Bytes_BA":          float64(300),
+		"Bytes_BA_delta":    float64(300),
+		"numFlowLogs":       float64(2),
+		"numFlowLogs_delta": float64(2),
+	}, conn.(*connType).aggFields)
+
+	// deltas restart from zero after a report, totals are kept
+	resetDelta()
+	update(50, dirAB)
+	require.Equal(t, map[string]interface{}{
+		"Bytes_AB":          float64(150),
+		"Bytes_AB_delta":    float64(50),
+		"Bytes_BA":          float64(300),
+		"Bytes_BA_delta":    float64(0),
+		"numFlowLogs":       float64(3),
+		"numFlowLogs_delta": float64(1),
+	}, conn.(*connType).aggFields)
+}
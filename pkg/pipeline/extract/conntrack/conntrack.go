@@ -49,6 +49,7 @@ type conntrackImpl struct {
 	hashProvider                     func() hash.Hash64
 	connStore                        *connectionStore
 	aggregators                      []aggregator
+	endConnectionFlags               uint32
 	shouldOutputFlowLogs             bool
 	shouldOutputNewConnection        bool
 	shouldOutputEndConnection        bool
@@ -85,7 +86,7 @@ func (ct *conntrackImpl) Extract(flowLogs []config.GenericMap) []config.GenericM
 		} else {
 			conn, exists, _ := ct.connStore.getConnection(computedHash.hashTotal)
 			if !exists {
-				if (ct.config.MaxConnectionsTracked > 0) && (ct.connStore.len() >= ct.config.MaxConnectionsTracked) {
+				if !ct.makeRoomForConnection(&outputRecords) {
 					log.Warningf("too many connections; skipping flow log %v: ", fl)
 					ct.metrics.inputRecords.WithLabelValues("discarded").Inc()
 				} else {
@@ -103,6 +104,7 @@ func (ct *conntrackImpl) Extract(flowLogs []config.GenericMap) []config.GenericM
 					ct.metrics.inputRecords.WithLabelValues("newConnection").Inc()
 					if ct.shouldOutputNewConnection {
 						record := conn.toGenericMap()
+						ct.resetDeltas(conn)
 						addHashField(record, computedHash.hashTotal)
 						addTypeField(record, api.ConnTrackNewConnection)
 						isFirst := conn.markReported()
@@ -147,19 +149,48 @@ func (ct *conntrackImpl) popEndConnections() []config.GenericMap {
 	var outputRecords []config.GenericMap
 	// Convert the connections to GenericMaps and add meta fields
 	for _, conn := range connections {
-		record := conn.toGenericMap()
-		addHashField(record, conn.getHash().hashTotal)
-		addTypeField(record, api.ConnTrackEndConnection)
-		var isFirst bool
-		if ct.shouldOutputEndConnection {
-			isFirst = conn.markReported()
-		}
-		addIsFirstField(record, isFirst)
-		outputRecords = append(outputRecords, record)
+		outputRecords = append(outputRecords, ct.endConnectionRecord(conn))
 	}
 	return outputRecords
 }
 
+func (ct *conntrackImpl) endConnectionRecord(conn connection) config.GenericMap {
+	record := conn.toGenericMap()
+	addHashField(record, conn.getHash().hashTotal)
+	addTypeField(record, api.ConnTrackEndConnection)
+	var isFirst bool
+	if ct.shouldOutputEndConnection {
+		isFirst = conn.markReported()
+	}
+	addIsFirstField(record, isFirst)
+	return record
+}
+
+// makeRoomForConnection applies the maxConnectionsPolicy when the store is full. It returns false when the new
+// connection must not be tracked. The endConnection record of an evicted connection may be added to outputRecords.
+func (ct *conntrackImpl) makeRoomForConnection(outputRecords *[]config.GenericMap) bool {
+	if ct.config.MaxConnectionsTracked <= 0 || ct.connStore.len() < ct.config.MaxConnectionsTracked {
+		return true
+	}
+	policy := ct.config.MaxConnectionsPolicy
+	if policy == "" {
+		policy = api.ConnTrackDropNew
+	}
+	ct.metrics.maxConnReached.WithLabelValues(string(policy)).Inc()
+	if policy == api.ConnTrackDropNew {
+		return false
+	}
+	evicted, ok := ct.connStore.popOldestConnection()
+	if !ok {
+		return false
+	}
+	if policy == api.ConnTrackEmitAndEvict {
+		*outputRecords = append(*outputRecords, ct.endConnectionRecord(evicted))
+		ct.metrics.outputRecords.WithLabelValues("endConnection").Inc()
+	}
+	return true
+}
+
 func (ct *conntrackImpl) prepareHeartbeatRecords() []config.GenericMap {
 	connections := ct.connStore.prepareHeartbeats()
 
@@ -167,6 +198,7 @@ func (ct *conntrackImpl) prepareHeartbeatRecords() []config.GenericMap {
 	// Convert the connections to GenericMaps and add meta fields
 	for _, conn := range connections {
 		record := conn.toGenericMap()
+		ct.resetDeltas(conn)
 		addHashField(record, conn.getHash().hashTotal)
 		addTypeField(record, api.ConnTrackHeartbeat)
 		var isFirst bool
@@ -179,15 +211,26 @@ func (ct *conntrackImpl) prepareHeartbeatRecords() []config.GenericMap {
 	return outputRecords
 }
 
+// resetDeltas resets the delta fields of the connection once a connection record has been emitted
+func (ct *conntrackImpl) resetDeltas(conn connection) {
+	for _, agg := range ct.aggregators {
+		agg.resetDelta(conn)
+	}
+}
+
 func (ct *conntrackImpl) updateConnection(conn connection, flowLog config.GenericMap, flowLogHash totalHashType, isNew bool) {
 	d := ct.getFlowLogDirection(conn, flowLogHash)
 	for _, agg := range ct.aggregators {
 		agg.update(conn, flowLog, d, isNew)
 	}
 
-	if ct.config.TCPFlags.DetectEndConnection && ct.containsTCPFlag(flowLog, FINFlag) {
+	if ct.config.TCPFlags.DetectEndConnection && ct.containsAnyTCPFlag(flowLog, ct.endConnectionFlags) {
 		ct.metrics.tcpFlags.WithLabelValues("detectEndConnection").Inc()
-		ct.connStore.setConnectionTerminating(flowLogHash.hashTotal)
+		if ct.config.TCPFlags.ImmediateEndConnection {
+			ct.connStore.endConnection(flowLogHash.hashTotal)
+		} else {
+			ct.connStore.setConnectionTerminating(flowLogHash.hashTotal)
+		}
 	} else {
 		ct.connStore.updateConnectionExpiryTime(flowLogHash.hashTotal)
 	}
@@ -210,6 +253,21 @@ func (ct *conntrackImpl) containsTCPFlag(flowLog config.GenericMap, queryFlag ui
 	return false
 }
 
+// containsAnyTCPFlag returns true when the flow log has at least one of the flags of the mask
+func (ct *conntrackImpl) containsAnyTCPFlag(flowLog config.GenericMap, mask uint32) bool {
+	tcpFlagsRaw, ok := flowLog[ct.config.TCPFlags.FieldName]
+	if ok {
+		tcpFlags, err := utils.ConvertToUint32(tcpFlagsRaw)
+		if err != nil {
+			log.Warningf("cannot convert TCP flag %q to uint32: %v", tcpFlagsRaw, err)
+			return false
+		}
+		return tcpFlags&mask != 0
+	}
+
+	return false
+}
+
 func (ct *conntrackImpl) getFlowLogDirection(conn connection, flowLogHash totalHashType) direction {
 	d := dirNA
 	if ct.config.KeyDefinition.Hash.FieldGroupARef != "" {
@@ -260,6 +318,11 @@ func NewConnectionTrack(opMetrics *operational.Metrics, params config.StageParam
 		}
 	}
 
+	endConnectionFlags := cfg.TCPFlags.EndConnectionFlags
+	if endConnectionFlags == 0 {
+		endConnectionFlags = FINFlag
+	}
+
 	endpointAFields, endpointBFields := cfg.GetABFields()
 	conntrack := &conntrackImpl{
 		clock:                     clock,
@@ -269,6 +332,7 @@ func NewConnectionTrack(opMetrics *operational.Metrics, params config.StageParam
 		endpointBFields:           endpointBFields,
 		hashProvider:              fnv.New64a,
 		aggregators:               aggregators,
+		endConnectionFlags:        endConnectionFlags,
 		shouldOutputFlowLogs:      shouldOutputFlowLogs,
 		shouldOutputNewConnection: shouldOutputNewConnection,
 		shouldOutputEndConnection: shouldOutputEndConnection,
@@ -286,6 +286,74 @@ func TestEndConn_Bidirectional(t *testing.T) {
 	}
 }
 
+// TestEndConn_BidirectionalOneWay tests a bidirectional setting where only one direction of the connection is seen.
+// The endpoint of the first flow log becomes A, so only the _AB fields are reported.
+func TestEndConn_BidirectionalOneWay(t *testing.T) {
+	test.ResetPromRegistry()
+	clk := clock.NewMock()
+	heartbeatInterval := 10 * time.Second
+	endConnectionTimeout := 30 * time.Second
+	terminatingTimeout := 5 * time.Second
+
+	conf := buildMockConnTrackConfig(true, []api.ConnTrackOutputRecordTypeEnum{"newConnection", "endConnection"},
+		heartbeatInterval, endConnectionTimeout, terminatingTimeout)
+	ct, err := NewConnectionTrack(opMetrics, *conf, clk)
+	require.NoError(t, err)
+
+	ipA := "10.0.0.1"
+	ipB := "10.0.0.2"
+	portA := 9001
+	portB := 9002
+	protocol := 6
+	flowDir := 0
+	hashID := "705baa5149302fa1"
+
+	flBA1 := newMockFlowLog(ipB, portB, ipA, portA, protocol, flowDir, 111, 11, false)
+	flBA2 := newMockFlowLog(ipB, portB, ipA, portA, protocol, flowDir, 222, 22, false)
+	startTime := clk.Now()
+	table := []struct {
+		name          string
+		time          time.Time
+		inputFlowLogs []config.GenericMap
+		expected      []config.GenericMap
+	}{
+		{
+			"start: flow BA",
+			startTime.Add(0 * time.Second),
+			[]config.GenericMap{flBA1},
+			[]config.GenericMap{
+				newMockRecordNewConnAB(ipB, portB, ipA, portA, protocol, 111, 0, 11, 0, 1).withHash(hashID).get(),
+			},
+		},
+		{
+			"10s: flow BA",
+			startTime.Add(10 * time.Second),
+			[]config.GenericMap{flBA2},
+			nil,
+		},
+		{
+			"41s: end conn",
+			startTime.Add(41 * time.Second),
+			nil,
+			[]config.GenericMap{
+				newMockRecordEndConnAB(ipB, portB, ipA, portA, protocol, 333, 0, 33, 0, 2).withHash(hashID).get(),
+			},
+		},
+	}
+
+	var prevTime time.Time
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Less(t, prevTime, tt.time)
+			prevTime = tt.time
+			clk.Set(tt.time)
+			actual := ct.Extract(tt.inputFlowLogs)
+			require.Equal(t, tt.expected, actual)
+			assertStoreConsistency(t, ct)
+		})
+	}
+}
+
 // TestEndConn_Unidirectional tests that end connection records are outputted correctly and in the right time in
 // unidirectional setting.
 // The test simulates 2 flow logs from A to B and 2 from B to A in different timestamps.
@@ -548,6 +616,51 @@ func TestHeartbeat_Unidirectional(t *testing.T) {
 
 // TestIsFirst_LongConnection tests the IsFirst works right in long connections that have multiple heartbeat records.
 // In the following test, there should be 2 heartbeat records and 1 endConnection. Only the first heartbeat record has isFirst set to true.
+func TestHeartbeat_Delta(t *testing.T) {
+	test.ResetPromRegistry()
+	clk := clock.NewMock()
+	heartbeatInterval := 10 * time.Second
+	endConnectionTimeout := 30 * time.Second
+	terminatingTimeout := 5 * time.Second
+
+	conf := buildMockConnTrackConfig(false, []api.ConnTrackOutputRecordTypeEnum{"newConnection", "heartbeat", "endConnection"},
+		heartbeatInterval, endConnectionTimeout, terminatingTimeout)
+	conf.Extract.ConnTrack.OutputFields[0].Delta = true
+	ct, err := NewConnectionTrack(opMetrics, *conf, clk)
+	require.NoError(t, err)
+
+	flAB := func(bytes int) config.GenericMap {
+		return newMockFlowLog("10.0.0.1", 9001, "10.0.0.2", 9002, 6, 0, bytes, 1, false)
+	}
+	startTime := clk.Now()
+	table := []struct {
+		name          string
+		time          time.Time
+		inputFlowLogs []config.GenericMap
+		expectedType  api.ConnTrackOutputRecordTypeEnum
+		expectedBytes float64
+		expectedDelta interface{}
+	}{
+		{"start: new connection", startTime, []config.GenericMap{flAB(100)}, api.ConnTrackNewConnection, 100, float64(100)},
+		{"11s: heartbeat", startTime.Add(11 * time.Second), []config.GenericMap{flAB(200)}, api.ConnTrackHeartbeat, 300, float64(200)},
+		{"22s: heartbeat", startTime.Add(22 * time.Second), []config.GenericMap{flAB(50)}, api.ConnTrackHeartbeat, 350, float64(50)},
+		// zero values are omitted from the records
+		{"33s: heartbeat without new flow logs", startTime.Add(33 * time.Second), nil, api.ConnTrackHeartbeat, 350, nil},
+		{"70s: end connection", startTime.Add(70 * time.Second), nil, api.ConnTrackEndConnection, 350, nil},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Set(tt.time)
+			actual := ct.Extract(tt.inputFlowLogs)
+			require.Len(t, actual, 1)
+			require.Equal(t, tt.expectedType, actual[0][api.RecordTypeFieldName])
+			require.Equal(t, tt.expectedBytes, actual[0]["Bytes"])
+			require.Equal(t, tt.expectedDelta, actual[0]["Bytes_delta"])
+		})
+	}
+}
+
 func TestIsFirst_LongConnection(t *testing.T) {
 	test.ResetPromRegistry()
 	clk := clock.NewMock()
@@ -964,6 +1077,45 @@ func TestMaxConnections(t *testing.T) {
 	require.Equal(t, maxConnections, ct.connStore.len())
 }
 
+func TestMaxConnections_Evict(t *testing.T) {
+	for _, policy := range []api.ConnTrackMaxConnectionsPolicyEnum{api.ConnTrackEvictOldest, api.ConnTrackEmitAndEvict} {
+		t.Run(string(policy), func(t *testing.T) {
+			test.ResetPromRegistry()
+			clk := clock.NewMock()
+			conf := buildMockConnTrackConfig(false, []api.ConnTrackOutputRecordTypeEnum{"newConnection", "endConnection"},
+				10*time.Second, 30*time.Second, 5*time.Second)
+			conf.Extract.ConnTrack.MaxConnectionsTracked = 2
+			conf.Extract.ConnTrack.MaxConnectionsPolicy = policy
+			ct, err := NewConnectionTrack(opMetrics, *conf, clk)
+			require.NoError(t, err)
+
+			flA := newMockFlowLog("10.0.0.1", 9001, "10.0.0.2", 80, 6, 0, 100, 1, false)
+			flB := newMockFlowLog("10.0.0.3", 9001, "10.0.0.2", 80, 6, 0, 200, 2, false)
+			flC := newMockFlowLog("10.0.0.4", 9001, "10.0.0.2", 80, 6, 0, 300, 3, false)
+			ct.Extract([]config.GenericMap{flA})
+			clk.Add(time.Second)
+			ct.Extract([]config.GenericMap{flB})
+			clk.Add(time.Second)
+			// flA is the closest to expire, so it makes room for flC
+			actual := ct.Extract([]config.GenericMap{flC})
+			expected := []config.GenericMap{
+				newMockRecordNewConn("10.0.0.4", 9001, "10.0.0.2", 80, 6, 300, 3, 1).withHash("d0cc4c3a6b834131").markFirst().get(),
+			}
+			if policy == api.ConnTrackEmitAndEvict {
+				expected = append([]config.GenericMap{
+					newMockRecordEndConn("10.0.0.1", 9001, "10.0.0.2", 80, 6, 100, 1, 1).withHash("657a189e6a3f5b24").get(),
+				}, expected...)
+			}
+			require.Equal(t, expected, actual)
+			assertStoreConsistency(t, ct)
+			require.Equal(t, 2, ct.(*conntrackImpl).connStore.len())
+
+			exposed := test.ReadExposedMetrics(t, prometheus.DefaultGatherer)
+			require.Contains(t, exposed, fmt.Sprintf(`conntrack_max_connections_reached{policy="%s"} 1`, policy))
+		})
+	}
+}
+
 func TestGenerateConnectionFlowEntries(t *testing.T) {
 	n := 100000
 	flowLogs := utils.GenerateConnectionFlowEntries(n)
@@ -1129,6 +1281,87 @@ func TestDetectEndConnection(t *testing.T) {
 	require.Contains(t, exposed, `conntrack_input_records{classification="duplicate"} 1`)
 }
 
+func TestDetectEndConnection_Immediate(t *testing.T) {
+	test.ResetPromRegistry()
+	clk := clock.NewMock()
+	defaultUpdateConnectionInterval := 30 * time.Second
+	defaultEndConnectionTimeout := 10 * time.Second
+	defaultTerminatingTimeout := 5 * time.Second
+
+	conf := buildMockConnTrackConfig(true, []api.ConnTrackOutputRecordTypeEnum{"newConnection", "endConnection"},
+		defaultUpdateConnectionInterval, defaultEndConnectionTimeout, defaultTerminatingTimeout)
+	tcpFlagsFieldName := "TCPFlags"
+	conf.Extract.ConnTrack.TCPFlags = api.ConnTrackTCPFlags{
+		FieldName:              tcpFlagsFieldName,
+		DetectEndConnection:    true,
+		EndConnectionFlags:     RSTFlag | FINACKFlag | RSTACKFlag,
+		ImmediateEndConnection: true,
+	}
+	ct, err := NewConnectionTrack(opMetrics, *conf, clk)
+	require.NoError(t, err)
+
+	ipA := "10.0.0.1"
+	ipB := "10.0.0.2"
+	portA := 9001
+	portB := 9002
+	protocolTCP := 6
+	flowDir := 0
+	hashIDTCP := "705baa5149302fa1"
+	flTCP1 := newMockFlowLog(ipA, portA, ipB, portB, protocolTCP, flowDir, 111, 11, false)
+	// FIN is not part of the mask: the connection goes on
+	flTCP1[tcpFlagsFieldName] = FINFlag
+	flTCP2 := newMockFlowLog(ipB, portB, ipA, portA, protocolTCP, flowDir, 222, 22, false)
+	flTCP2[tcpFlagsFieldName] = RSTFlag | ACKFlag
+	flTCP3 := newMockFlowLog(ipA, portA, ipB, portB, protocolTCP, flowDir, 333, 33, false)
+
+	startTime := clk.Now()
+	table := []struct {
+		name          string
+		time          time.Time
+		inputFlowLogs []config.GenericMap
+		expected      []config.GenericMap
+	}{
+		{
+			"start: new connection",
+			startTime.Add(0 * time.Second),
+			[]config.GenericMap{flTCP1},
+			[]config.GenericMap{
+				newMockRecordNewConnAB(ipA, portA, ipB, portB, protocolTCP, 111, 0, 11, 0, 1).withHash(hashIDTCP).markFirst().get(),
+			},
+		},
+		{
+			"5s: end connection without waiting for the terminating timeout",
+			startTime.Add(5 * time.Second),
+			[]config.GenericMap{flTCP2},
+			[]config.GenericMap{
+				newMockRecordEndConnAB(ipA, portA, ipB, portB, protocolTCP, 111, 222, 11, 22, 2).withHash(hashIDTCP).get(),
+			},
+		},
+		{
+			"6s: same tuple starts a new connection",
+			startTime.Add(6 * time.Second),
+			[]config.GenericMap{flTCP3},
+			[]config.GenericMap{
+				newMockRecordNewConnAB(ipA, portA, ipB, portB, protocolTCP, 333, 0, 33, 0, 1).withHash(hashIDTCP).markFirst().get(),
+			},
+		},
+	}
+
+	var prevTime time.Time
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Less(t, prevTime, tt.time)
+			prevTime = tt.time
+			clk.Set(tt.time)
+			actual := ct.Extract(tt.inputFlowLogs)
+			require.Equal(t, tt.expected, actual)
+			assertStoreConsistency(t, ct)
+		})
+	}
+	exposed := test.ReadExposedMetrics(t, prometheus.DefaultGatherer)
+	require.Contains(t, exposed, `conntrack_tcp_flags{action="detectEndConnection"} 1`)
+}
+
 func TestSwapAB(t *testing.T) {
 	test.ResetPromRegistry()
 	clk := clock.NewMock()
@@ -65,6 +65,13 @@ var (
 		"error", "field",
 	)
 
+	maxConnectionsReachedDef = operational.DefineMetric(
+		"conntrack_max_connections_reached",
+		"The total number of new connections exceeding the maximum number of tracked connections, per applied policy",
+		operational.TypeCounter,
+		"policy",
+	)
+
 	endConnectionsDef = operational.DefineMetric(
 		"conntrack_end_connections",
 		"The total number of connections ended per group and reason",
@@ -81,6 +88,7 @@ type metricsType struct {
 	hashErrors       *prometheus.CounterVec
 	aggregatorErrors *prometheus.CounterVec
 	endConnections   *prometheus.CounterVec
+	maxConnReached   *prometheus.CounterVec
 }
 
 func newMetrics(opMetrics *operational.Metrics) *metricsType {
@@ -92,5 +100,6 @@ func newMetrics(opMetrics *operational.Metrics) *metricsType {
 		hashErrors:       opMetrics.NewCounterVec(&hashErrorsDef),
 		aggregatorErrors: opMetrics.NewCounterVec(&aggregatorErrorsDef),
 		endConnections:   opMetrics.NewCounterVec(&endConnectionsDef),
+		maxConnReached:   opMetrics.NewCounterVec(&maxConnectionsReachedDef),
 	}
 }
@@ -52,7 +52,10 @@ type groupType struct {
 	// connections that detected EndConnection from TCP FIN flag. These will not trigger updates anymore until pop
 	// check expireConnection func
 	terminatingMom *utils.MultiOrderedMap
-	labelValue     string
+	// connections that detected EndConnection from TCP flags with immediateEndConnection. These are already removed
+	// from the store and are returned by the next pop
+	endedConnections []connection
+	labelValue       string
 }
 
 func (cs *connectionStore) getGroupIdx(conn connection) (groupIdx int) {
@@ -135,6 +138,26 @@ func (cs *connectionStore) setConnectionTerminating(hashID uint64) {
 	cs.metrics.connStoreLength.WithLabelValues(groupLabel, terminatingLabel).Set(float64(terminatingLen))
 }
 
+// endConnection removes the connection from the store without waiting for its expiry time.
+// It will be returned by the next call to popEndConnections.
+func (cs *connectionStore) endConnection(hashID uint64) {
+	conn, ok, active := cs.getConnection(hashID)
+	if !ok {
+		log.Panicf("BUG. connection hash %x doesn't exist", hashID)
+		return
+	}
+	groupIdx := cs.hashID2groupIdx[hashID]
+	group := cs.groups[groupIdx]
+	mom, phaseLabel := group.activeMom, activeLabel
+	if !active {
+		mom, phaseLabel = group.terminatingMom, terminatingLabel
+	}
+	mom.RemoveRecord(utils.Key(hashID))
+	cs.metrics.connStoreLength.WithLabelValues(group.labelValue, phaseLabel).Set(float64(mom.Len()))
+	delete(cs.hashID2groupIdx, hashID)
+	group.endedConnections = append(group.endedConnections, conn)
+}
+
 func (cs *connectionStore) updateConnectionExpiryTime(hashID uint64) {
 	conn, ok, active := cs.getConnection(hashID)
 	if !ok {
@@ -216,7 +239,9 @@ func (cs *connectionStore) popEndConnections() []connection {
 	var poppedConnections []connection
 	for _, group := range cs.groups {
 		// Pop terminating connections first
-		terminatedConnections := cs.popEndConnectionOfMap(group.terminatingMom, group)
+		terminatedConnections := group.endedConnections
+		group.endedConnections = nil
+		terminatedConnections = append(terminatedConnections, cs.popEndConnectionOfMap(group.terminatingMom, group)...)
 		poppedConnections = append(poppedConnections, terminatedConnections...)
 		cs.metrics.endConnections.WithLabelValues(group.labelValue, "FIN_flag").Add(float64(len(terminatedConnections)))
 
@@ -228,6 +253,39 @@ func (cs *connectionStore) popEndConnections() []connection {
 	return poppedConnections
 }
 
+// popOldestConnection removes the connection that is the closest to expire, among all the scheduling groups.
+// It returns false when the store is empty.
+func (cs *connectionStore) popOldestConnection() (connection, bool) {
+	var oldest connection
+	var oldestGroup *groupType
+	var oldestMom *utils.MultiOrderedMap
+	for _, group := range cs.groups {
+		for _, mom := range []*utils.MultiOrderedMap{group.terminatingMom, group.activeMom} {
+			// connections are sorted by expiry time: only the first one of each map is a candidate
+			mom.IterateFrontToBack(expiryOrder, func(r utils.Record) (shouldDelete, shouldStop bool) {
+				conn := r.(connection)
+				if oldest == nil || conn.getExpiryTime().Before(oldest.getExpiryTime()) {
+					oldest, oldestGroup, oldestMom = conn, group, mom
+				}
+				return false, true
+			})
+		}
+	}
+	if oldest == nil {
+		return nil, false
+	}
+	hashID := oldest.getHash().hashTotal
+	oldestMom.RemoveRecord(utils.Key(hashID))
+	delete(cs.hashID2groupIdx, hashID)
+	phaseLabel := activeLabel
+	if oldestMom == oldestGroup.terminatingMom {
+		phaseLabel = terminatingLabel
+	}
+	cs.metrics.connStoreLength.WithLabelValues(oldestGroup.labelValue, phaseLabel).Set(float64(oldestMom.Len()))
+	cs.metrics.endConnections.WithLabelValues(oldestGroup.labelValue, "evicted").Inc()
+	return oldest, true
+}
+
 func (cs *connectionStore) prepareHeartbeats() []connection {
 	var connections []connection
 	// Iterate over the connections by scheduling groups.
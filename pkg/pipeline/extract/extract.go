@@ -26,6 +26,11 @@ type Extractor interface {
 	Extract(in []config.GenericMap) []config.GenericMap
 }
 
+// Updater is implemented by the extractors that support hot-reloading their configuration
+type Updater interface {
+	Update(params config.StageParam) error
+}
+
 type extractNone struct {
 }
 
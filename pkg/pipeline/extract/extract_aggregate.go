@@ -19,6 +19,7 @@ package extract
 
 import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	agg "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/extract/aggregate"
 	log "github.com/sirupsen/logrus"
 )
@@ -40,9 +41,9 @@ func (ea *aggregates) Extract(entries []config.GenericMap) []config.GenericMap {
 }
 
 // NewExtractAggregate creates a new extractor
-func NewExtractAggregate(params config.StageParam) (Extractor, error) {
+func NewExtractAggregate(opMetrics *operational.Metrics, params config.StageParam) (Extractor, error) {
 	log.Debugf("entering NewExtractAggregate")
-	cfg, err := agg.NewAggregatesFromConfig(params.Extract.Aggregates)
+	cfg, err := agg.NewAggregatesFromConfig(opMetrics, params.Extract.Aggregates)
 	if err != nil {
 		log.Errorf("error in NewAggregatesFromConfig: %v", err)
 		return nil, err
@@ -52,3 +53,8 @@ func NewExtractAggregate(params config.StageParam) (Extractor, error) {
 		Aggregates: cfg,
 	}, nil
 }
+
+// Update applies new aggregate definitions; the unchanged ones keep their state
+func (ea *aggregates) Update(params config.StageParam) error {
+	return ea.Aggregates.Update(params.Extract.Aggregates)
+}
@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/extract/aggregate"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
 	"github.com/stretchr/testify/require"
@@ -76,7 +77,7 @@ parameters:
 	v, cfg := test.InitConfig(t, yamlConfig)
 	require.NotNil(t, v)
 
-	extractAggregate, err := NewExtractAggregate(cfg.Parameters[0])
+	extractAggregate, err := NewExtractAggregate(operational.NewMetrics(&config.MetricsSettings{}), cfg.Parameters[0])
 	require.NoError(t, err)
 
 	// Test cases
@@ -129,23 +129,12 @@ func getInitValue(operation api.FilterOperationEnum) float64 {
 }
 
 func (fs *FilterStruct) ComputeTopkBotk() {
-	var output []filterOperationResult
 	if fs.Rule.TopK > 0 {
-		if fs.Rule.Reversed {
-			output = fs.computeBotK(fs.Results)
-		} else {
-			output = fs.computeTopK(fs.Results)
-		}
+		fs.Output = fs.computeTopK(fs.Results)
 	} else {
-		// return all Results; convert map to array
-		output = make([]filterOperationResult, len(fs.Results))
-		i := 0
-		for _, item := range fs.Results {
-			output[i] = *item
-			i++
-		}
+		// return all Results, ranked
+		fs.Output = fs.sortResults(fs.Results)
 	}
-	fs.Output = output
 }
 
 func (fs *FilterStruct) CreateGenericMap() []config.GenericMap {
@@ -20,7 +20,9 @@ package timebased
 import (
 	"container/heap"
 	"math"
+	"sort"
 
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -32,61 +34,96 @@ type heapItem struct {
 	result *filterOperationResult
 }
 
-type topkHeap []heapItem
-type botkHeap []heapItem
+// rankedBefore tells whether an item ranks before another: higher values first, or lower values first for the
+// bottom direction. Ties are broken by the index values, so that the output doesn't depend on the map order.
+type rankedBefore func(a, b *heapItem) bool
+
+func newRankedBefore(direction api.TimebasedDirectionEnum) rankedBefore {
+	if direction == api.TimebasedBottom {
+		return func(a, b *heapItem) bool {
+			if a.value != b.value {
+				return a.value < b.value
+			}
+			return a.result.values < b.result.values
+		}
+	}
+	return func(a, b *heapItem) bool {
+		if a.value != b.value {
+			return a.value > b.value
+		}
+		return a.result.values < b.result.values
+	}
+}
 
-func (h topkHeap) Len() int {
-	return len(h)
+// rankHeap keeps the lowest ranked item at its root, to be dropped first
+type rankHeap struct {
+	items  []heapItem
+	before rankedBefore
 }
 
-func (h topkHeap) Less(i, j int) bool {
-	return h[i].value < h[j].value
+func (h *rankHeap) Len() int {
+	return len(h.items)
 }
 
-func (h topkHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
+func (h *rankHeap) Less(i, j int) bool {
+	return h.before(&h.items[j], &h.items[i])
 }
 
-func (h *topkHeap) Push(x interface{}) {
-	*h = append(*h, x.(heapItem))
+func (h *rankHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
 }
 
-func (h *topkHeap) Pop() interface{} {
-	old := *h
+func (h *rankHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(heapItem))
+}
+
+func (h *rankHeap) Pop() interface{} {
+	old := h.items
 	n := len(old)
 	x := old[n-1]
-	*h = old[0 : n-1]
+	h.items = old[0 : n-1]
 	return x
 }
 
+// direction returns the direction of the rule, where reversed is the deprecated way to set the bottom direction
+func (fs *FilterStruct) direction() api.TimebasedDirectionEnum {
+	if fs.Rule.Direction == "" && fs.Rule.Reversed {
+		return api.TimebasedBottom
+	}
+	return fs.Rule.Direction
+}
+
+// rankValue is the value by which a result is ranked: its absolute value with the abs option
+func (fs *FilterStruct) rankValue(result *filterOperationResult) float64 {
+	if fs.Rule.Abs {
+		return math.Abs(result.operationResult)
+	}
+	return result.operationResult
+}
+
+// computeTopK returns the K best ranked results, best first, according to the direction of the rule
 func (fs *FilterStruct) computeTopK(inputs filterOperationResults) []filterOperationResult {
-	// maintain a heap with k items, always dropping the lowest
-	// we will be left with the TopK items
-	var prevMin float64
-	prevMin = -math.MaxFloat64
+	// maintain a heap with k items, always dropping the lowest ranked one
 	topk := fs.Rule.TopK
-	h := &topkHeap{}
-	for key, metricMap := range inputs {
-		val := metricMap.operationResult
-		if val < prevMin {
-			continue
-		}
+	h := &rankHeap{before: newRankedBefore(fs.direction())}
+	for key := range inputs {
 		item := heapItem{
 			result: inputs[key],
-			value:  val,
+			value:  fs.rankValue(inputs[key]),
+		}
+		if h.Len() == topk && !h.before(&item, &h.items[0]) {
+			continue
 		}
 		heap.Push(h, item)
 		if h.Len() > topk {
-			x := heap.Pop(h)
-			prevMin = x.(heapItem).value
+			heap.Pop(h)
 		}
 	}
-	log.Debugf("heap: %v", h)
+	log.Debugf("heap: %v", h.items)
 
 	// convert the remaining heap to a sorted array
 	result := make([]filterOperationResult, h.Len())
-	heapLen := h.Len()
-	for i := heapLen; i > 0; i-- {
+	for i := h.Len(); i > 0; i-- {
 		poppedItem := heap.Pop(h).(heapItem)
 		log.Debugf("poppedItem: %v", poppedItem)
 		result[i-1] = *poppedItem.result
@@ -95,63 +132,17 @@ func (fs *FilterStruct) computeTopK(inputs filterOperationResults) []filterOpera
 	return result
 }
 
-func (h botkHeap) Len() int {
-	return len(h)
-}
-
-// For a botk heap, we reverse the order of the Less() operation
-func (h botkHeap) Less(i, j int) bool {
-	return h[i].value > h[j].value
-}
-
-func (h botkHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
-}
-
-func (h *botkHeap) Push(x interface{}) {
-	*h = append(*h, x.(heapItem))
-}
-
-func (h *botkHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	x := old[n-1]
-	*h = old[0 : n-1]
-	return x
-}
-
-func (fs *FilterStruct) computeBotK(inputs filterOperationResults) []filterOperationResult {
-	// maintain a heap with k items, always dropping the highest
-	// we will be left with the BotK items
-	var prevMax float64
-	prevMax = math.MaxFloat64
-	botk := fs.Rule.TopK
-	h := &botkHeap{}
-	for key, metricMap := range inputs {
-		val := metricMap.operationResult
-		if val > prevMax {
-			continue
-		}
-		item := heapItem{
-			result: inputs[key],
-			value:  val,
-		}
-		heap.Push(h, item)
-		if h.Len() > botk {
-			x := heap.Pop(h)
-			prevMax = x.(heapItem).value
-		}
+// sortResults returns all the results, best ranked first
+func (fs *FilterStruct) sortResults(inputs filterOperationResults) []filterOperationResult {
+	items := make([]heapItem, 0, len(inputs))
+	for key := range inputs {
+		items = append(items, heapItem{result: inputs[key], value: fs.rankValue(inputs[key])})
 	}
-	log.Debugf("heap: %v", h)
-
-	// convert the remaining heap to a sorted array
-	result := make([]filterOperationResult, h.Len())
-	heapLen := h.Len()
-	for i := heapLen; i > 0; i-- {
-		poppedItem := heap.Pop(h).(heapItem)
-		log.Debugf("poppedItem: %v", poppedItem)
-		result[i-1] = *poppedItem.result
+	before := newRankedBefore(fs.direction())
+	sort.Slice(items, func(i, j int) bool { return before(&items[i], &items[j]) })
+	result := make([]filterOperationResult, len(items))
+	for i := range items {
+		result[i] = *items[i].result
 	}
-	log.Debugf("botk items: %v", result)
 	return result
 }
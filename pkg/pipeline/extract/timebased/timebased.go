@@ -83,6 +83,12 @@ func CreateIndexKeysAndFilters(rules []api.TimebasedFilterRule) (map[string]*Ind
 		} else if filterRule.TimeInterval.Duration > rStruct.maxTimeInterval {
 			rStruct.maxTimeInterval = filterRule.TimeInterval.Duration
 		}
+		switch filterRule.Direction {
+		case "", api.TimebasedTop, api.TimebasedBottom:
+		default:
+			log.Errorf("illegal direction %s for filter %s", filterRule.Direction, filterRule.Name)
+			continue
+		}
 		// verify the validity of the OperationType field in the filterRule
 		switch filterRule.OperationType {
 		case api.FilterOperationLast,
@@ -123,3 +123,59 @@ func Test_AddAndDeleteEntryToTables(t *testing.T) {
 	require.Equal(t, 0, indexKeyStructs["DstAddr"].dataTableMap["11.0.0.1"].Len())
 	require.Equal(t, 3, indexKeyStructs["SrcAddr"].dataTableMap["10.0.0.1"].Len())
 }
+
+func rankedKeys(fs *FilterStruct) []string {
+	fs.ComputeTopkBotk()
+	keys := make([]string, 0, len(fs.Output))
+	for _, result := range fs.Output {
+		keys = append(keys, result.values)
+	}
+	return keys
+}
+
+func Test_ComputeTopkBotkDirections(t *testing.T) {
+	results := filterOperationResults{}
+	for key, value := range map[string]float64{"a": 5, "b": -20, "c": 5, "d": 12, "e": 0, "f": 5} {
+		results[key] = &filterOperationResult{values: key, operationResult: value}
+	}
+	fs := FilterStruct{Rule: api.TimebasedFilterRule{TopK: 3}, Results: results}
+	// ties are broken by index values
+	require.Equal(t, []string{"d", "a", "c"}, rankedKeys(&fs))
+
+	fs.Rule.Direction = api.TimebasedBottom
+	require.Equal(t, []string{"b", "e", "a"}, rankedKeys(&fs))
+
+	// the deprecated reversed flag applies when no direction is set
+	fs.Rule.Direction = ""
+	fs.Rule.Reversed = true
+	require.Equal(t, []string{"b", "e", "a"}, rankedKeys(&fs))
+	fs.Rule.Direction = api.TimebasedTop
+	require.Equal(t, []string{"d", "a", "c"}, rankedKeys(&fs))
+
+	// ranked by absolute value, reported with their sign
+	fs.Rule.Abs = true
+	require.Equal(t, []string{"b", "d", "a"}, rankedKeys(&fs))
+	require.Equal(t, float64(-20), fs.Output[0].operationResult)
+	fs.Rule.Direction = api.TimebasedBottom
+	require.Equal(t, []string{"e", "a", "c"}, rankedKeys(&fs))
+
+	// without topK, all the results are reported, ranked
+	fs.Rule.TopK = 0
+	require.Equal(t, []string{"e", "a", "c", "f", "d", "b"}, rankedKeys(&fs))
+	fs.Rule.Abs = false
+	fs.Rule.Direction = api.TimebasedTop
+	require.Equal(t, []string{"d", "a", "c", "f", "e", "b"}, rankedKeys(&fs))
+
+	// more than available
+	fs.Rule.TopK = 10
+	require.Len(t, rankedKeys(&fs), 6)
+}
+
+func Test_CreateIndexKeysAndFiltersDirection(t *testing.T) {
+	rules := getTimebasedRules()
+	rules[0].Direction = "sideways"
+	rules[1].Direction = api.TimebasedBottom
+	_, filters := CreateIndexKeysAndFilters(rules)
+	require.Len(t, filters, 2)
+	require.Equal(t, "Bot2_last", filters[0].Rule.Name)
+}
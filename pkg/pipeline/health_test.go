@@ -18,7 +18,9 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"testing"
@@ -26,6 +28,7 @@ import (
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
 	"github.com/stretchr/testify/require"
 )
 
@@ -39,7 +42,8 @@ func TestNewHealthServer(t *testing.T) {
 		address  string
 	}
 	type want struct {
-		statusCode int
+		liveStatusCode  int
+		readyStatusCode int
 	}
 
 	tests := []struct {
@@ -47,8 +51,12 @@ func TestNewHealthServer(t *testing.T) {
 		args args
 		want want
 	}{
-		{name: "pipeline running", args: args{pipeline: Pipeline{IsRunning: true}, port: "7000", address: "0.0.0.0"}, want: want{statusCode: 200}},
-		{name: "pipeline not running", args: args{pipeline: Pipeline{IsRunning: false}, port: "7001", address: "0.0.0.0"}, want: want{statusCode: 503}},
+		{name: "pipeline running", args: args{pipeline: Pipeline{IsRunning: true}, port: "7000", address: "0.0.0.0"}, want: want{liveStatusCode: 200, readyStatusCode: 200}},
+		{name: "pipeline not running", args: args{pipeline: Pipeline{IsRunning: false}, port: "7001", address: "0.0.0.0"}, want: want{liveStatusCode: 503, readyStatusCode: 503}},
+		{name: "stage not ready", args: args{pipeline: Pipeline{IsRunning: true, pipelineEntryMap: map[string]*pipelineEntry{
+			"loki":   {stageName: "loki", stageType: StageWrite, Writer: &notReadyWriter{}},
+			"writer": {stageName: "writer", stageType: StageWrite, Writer: &write.Fake{}},
+		}}, port: "7002", address: "0.0.0.0"}, want: want{liveStatusCode: 200, readyStatusCode: 503}},
 	}
 
 	for _, tt := range tests {
@@ -56,7 +64,8 @@ func TestNewHealthServer(t *testing.T) {
 
 			opts := config.Options{Health: config.Health{Port: tt.args.port, Address: tt.args.address}}
 			expectedAddr := fmt.Sprintf("%s:%s", opts.Health.Address, opts.Health.Port)
-			server := operational.NewHealthServer(&opts, tt.args.pipeline.IsAlive, tt.args.pipeline.IsReady)
+			tt.args.pipeline.initHealth()
+			server := operational.NewHealthServer(&opts, tt.args.pipeline.Health, "", nil)
 			require.NotNil(t, server)
 			require.Equal(t, expectedAddr, server.Addr)
 
@@ -66,13 +75,48 @@ func TestNewHealthServer(t *testing.T) {
 			readyURL := url.URL{Scheme: "http", Host: expectedAddr, Path: readyPath}
 			var resp, err = client.Get(readyURL.String())
 			require.NoError(t, err)
-			require.Equal(t, tt.want.statusCode, resp.StatusCode)
+			require.Equal(t, tt.want.readyStatusCode, resp.StatusCode)
 
 			liveURL := url.URL{Scheme: "http", Host: expectedAddr, Path: livePath}
 			resp, err = client.Get(liveURL.String())
 			require.NoError(t, err)
-			require.Equal(t, tt.want.statusCode, resp.StatusCode)
-
+			require.Equal(t, tt.want.liveStatusCode, resp.StatusCode)
 		})
 	}
 }
+
+type notReadyWriter struct {
+	write.Fake
+}
+
+func (w *notReadyWriter) Ready() error {
+	return errors.New("can't push")
+}
+
+func TestHealth_ReadinessContributors(t *testing.T) {
+	writer := &notReadyWriter{}
+	p := Pipeline{IsRunning: true, pipelineEntryMap: map[string]*pipelineEntry{
+		"loki": {stageName: "loki", stageType: StageWrite, Writer: writer},
+	}}
+	p.initHealth()
+	opts := config.Options{Health: config.Health{Port: "7003", Address: "0.0.0.0"}}
+	server := operational.NewHealthServer(&opts, p.Health, "", nil)
+	require.NotNil(t, server)
+	time.Sleep(time.Second)
+
+	resp, err := http.Get("http://0.0.0.0:7003/ready?full=1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.JSONEq(t, `{"PipelineCheck": "OK", "stage loki": "can't push"}`, string(body))
+
+	// a reload replacing the writer replaces its contribution
+	p.pipelineEntryMap["loki"].Writer = &write.Fake{}
+	p.pipelineEntryMap["loki"].updateContributor()
+	resp2, err := http.Get("http://0.0.0.0:7003/ready")
+	require.NoError(t, err)
+	defer resp2.Body.Close()
+	require.Equal(t, http.StatusOK, resp2.StatusCode)
+}
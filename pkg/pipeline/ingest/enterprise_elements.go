@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netsampler/goflow2/decoders/netflow"
+	"gopkg.in/yaml.v2"
+)
+
+type enterpriseKey struct {
+	pen uint32
+	id  uint16
+}
+
+// enterpriseElements decodes the IPFIX enterprise-specific information elements, which goflow2 ignores
+type enterpriseElements map[enterpriseKey]api.EnterpriseElement
+
+func newEnterpriseElements(cfg []api.EnterpriseElement) enterpriseElements {
+	elements := enterpriseElements{}
+	for _, e := range cfg {
+		elements[enterpriseKey{pen: e.PEN, id: e.ID}] = e
+	}
+	return elements
+}
+
+// loadEnterpriseElements reads a YAML list of enterprise-specific elements, e.g. shared by several collectors
+func loadEnterpriseElements(path string) ([]api.EnterpriseElement, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read enterprise elements file: %w", err)
+	}
+	var elements []api.EnterpriseElement
+	if err := yaml.UnmarshalStrict(content, &elements); err != nil {
+		return nil, fmt.Errorf("can't parse enterprise elements file %s: %w", path, err)
+	}
+	return elements, nil
+}
+
+// decode adds the enterprise-specific elements of the data record to the flow: the configured ones under their
+// name, the others under Enterprise_<pen>_<id> as hexadecimal strings
+func (e enterpriseElements) decode(fields []netflow.DataField, flow map[string]interface{}) {
+	for _, field := range fields {
+		if !field.PenProvided {
+			continue
+		}
+		value, ok := field.Value.([]byte)
+		if !ok {
+			continue
+		}
+		element, ok := e[enterpriseKey{pen: field.Pen, id: field.Type}]
+		if !ok {
+			flow[fmt.Sprintf("Enterprise_%d_%d", field.Pen, field.Type)] = hex.EncodeToString(value)
+			continue
+		}
+		flow[element.Name] = decodeEnterpriseValue(element.Type, value)
+	}
+}
+
+// decodeEnterpriseValue converts the value to the configured type, falling back to an hexadecimal string
+// when its length doesn't match the type
+func decodeEnterpriseValue(t api.EnterpriseElementTypeEnum, value []byte) interface{} {
+	switch t {
+	case "", api.EnterpriseElementUnsigned:
+		if len(value) <= 8 {
+			var u uint64
+			for _, b := range value {
+				u = u<<8 | uint64(b)
+			}
+			return u
+		}
+	case api.EnterpriseElementSigned:
+		if len(value) > 0 && len(value) <= 8 {
+			// the first byte is sign-extended
+			i := int64(int8(value[0]))
+			for _, b := range value[1:] {
+				i = i<<8 | int64(b)
+			}
+			return i
+		}
+	case api.EnterpriseElementIP:
+		if len(value) == net.IPv4len || len(value) == net.IPv6len {
+			return net.IP(value).String()
+		}
+	case api.EnterpriseElementMAC:
+		return net.HardwareAddr(value).String()
+	case api.EnterpriseElementString:
+		return strings.TrimRight(string(value), "\x00")
+	}
+	return hex.EncodeToString(value)
+}
+
+// netFlowDataRecords returns the data records of a NetFlow v9 or IPFIX packet, in the order of the flow messages
+// produced by goflow2
+func netFlowDataRecords(packet interface{}) []netflow.DataRecord {
+	var flowSets []interface{}
+	switch p := packet.(type) {
+	case netflow.NFv9Packet:
+		flowSets = p.FlowSets
+	case netflow.IPFIXPacket:
+		flowSets = p.FlowSets
+	}
+	var records []netflow.DataRecord
+	for _, fs := range flowSets {
+		if data, ok := fs.(netflow.DataFlowSet); ok {
+			records = append(records, data.Records...)
+		}
+	}
+	return records
+}
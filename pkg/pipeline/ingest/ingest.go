@@ -17,10 +17,27 @@
 
 package ingest
 
-import "github.com/netobserv/flowlogs-pipeline/pkg/config"
+import (
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/decode"
+)
 
 type Ingester interface {
 	Ingest(out chan<- config.GenericMap)
 }
+
+// Reloader is implemented by the ingesters reading definitions from files, such as the protobuf definition of
+// their decoder. Ingesters aren't rebuilt when the pipeline configuration is reloaded, but these files are read again.
+type Reloader interface {
+	Reload() error
+}
+
+func reloadDecoder(decoder decode.Decoder) error {
+	if reloader, ok := decoder.(decode.Reloader); ok {
+		return reloader.Reload()
+	}
+	return nil
+}
+
 type IngesterNone struct {
 }
@@ -18,22 +18,26 @@
 package ingest
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
 	ms "github.com/mitchellh/mapstructure"
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	pUtils "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
-	"github.com/netsampler/goflow2/decoders/netflow/templates"
-	_ "github.com/netsampler/goflow2/decoders/netflow/templates/memory" // required for goflow in-memory templates
+	"github.com/netsampler/goflow2/decoders/netflow"
 	goflowFormat "github.com/netsampler/goflow2/format"
 	goflowCommonFormat "github.com/netsampler/goflow2/format/common"
 	_ "github.com/netsampler/goflow2/format/protobuf" // required for goflow protobuf
 	goflowpb "github.com/netsampler/goflow2/pb"
+	"github.com/netsampler/goflow2/producer"
 	"github.com/netsampler/goflow2/utils"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/proto"
@@ -47,14 +51,23 @@ type ingestCollector struct {
 	hostname   string
 	port       int
 	portLegacy int
+	portTCP    int
 	in         chan map[string]interface{}
 	exitChan   <-chan struct{}
 	metrics    *metrics
+	limiter    *rateLimiter
+	enterprise enterpriseElements
+	// NetFlow v9 / IPFIX decoding state, per exporter
+	templates    *netFlowTemplates
+	orphans      *orphanDatagrams
+	sampling     map[string]producer.SamplingRateSystem
+	samplingLock sync.Mutex
 }
 
 // TransportWrapper is an implementation of the goflow2 transport interface
 type TransportWrapper struct {
-	c chan map[string]interface{}
+	c       chan map[string]interface{}
+	limiter *rateLimiter
 }
 
 func NewWrapper(c chan map[string]interface{}) *TransportWrapper {
@@ -91,6 +104,10 @@ func (w *TransportWrapper) Send(_, data []byte) error {
 		log.Error(err)
 		return err
 	}
+	// the sampler address is the address of the exporter that sent the datagram
+	if !w.limiter.allow(net.IP(message.SamplerAddress).String()) {
+		return nil
+	}
 	renderedMsg, err := RenderMessage(&message)
 	if err == nil {
 		w.c <- renderedMsg
@@ -112,29 +129,28 @@ func (c *ingestCollector) Ingest(out chan<- config.GenericMap) {
 
 func (c *ingestCollector) initCollectorListener(ctx context.Context) {
 	transporter := NewWrapper(c.in)
+	transporter.limiter = c.limiter
 	formatter, err := goflowFormat.FindFormat(ctx, "pb")
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	if c.port > 0 {
-		// cf https://github.com/netsampler/goflow2/pull/49
-		tpl, err := templates.FindTemplateSystem(ctx, "memory")
-		if err != nil {
-			log.Fatalf("goflow2 error: could not find memory template system: %v", err)
-		}
-		defer tpl.Close(ctx)
-
 		go func() {
-			sNF := utils.NewStateNetFlow()
-			sNF.Format = formatter
-			sNF.Transport = transporter
-			sNF.Logger = log.StandardLogger()
-			sNF.TemplateSystem = tpl
-
 			log.Infof("listening for netflow on host %s, port = %d", c.hostname, c.port)
-			err = sNF.FlowRoutine(1, c.hostname, c.port, false)
-			log.Fatal(err)
+			err := utils.UDPStoppableRoutine(c.exitChan, "NetFlow", c.decodeNetFlow, 1, c.hostname, c.port, false, log.StandardLogger())
+			if err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if c.portTCP > 0 {
+		go func() {
+			log.Infof("listening for IPFIX over TCP on host %s, port = %d", c.hostname, c.portTCP)
+			if err := c.listenTCP(); err != nil {
+				log.Fatal(err)
+			}
 		}()
 	}
 
@@ -152,6 +168,113 @@ func (c *ingestCollector) initCollectorListener(ctx context.Context) {
 	}
 }
 
+// decodeNetFlow decodes NetFlow v9 / IPFIX datagrams like goflow2 does, and also keeps the enterprise-specific
+// elements of the data records, which goflow2 drops.
+// Datagrams received before the template of their data records, e.g. after a collector restart, are buffered and
+// decoded again once the template is received.
+func (c *ingestCollector) decodeNetFlow(msg interface{}) error {
+	pkt := msg.(utils.BaseMessage)
+	return c.decodeFrom(pkt.Src.String(), pkt)
+}
+
+// decodeFrom decodes a datagram using the templates of the key: the exporter address for UDP, the session for TCP
+func (c *ingestCollector) decodeFrom(key string, pkt utils.BaseMessage) error {
+	now := time.Now()
+	c.orphans.expire(now)
+	templates := &exporterTemplates{store: c.templates, source: key}
+	_, err := c.processNetFlow(pkt, templates)
+	var notFound *netflow.ErrorTemplateNotFound
+	if errors.As(err, &notFound) {
+		log.WithError(err).Debugf("buffering NetFlow datagram from %s until its template is received", key)
+		c.orphans.add(orphanDatagram{source: key, payload: pkt.Payload, missing: templates.missing, received: now})
+	} else if err != nil {
+		return err
+	}
+	c.reprocessOrphans(pkt, templates.added)
+	return nil
+}
+
+// reprocessOrphans decodes the buffered datagrams waiting for one of the templates just received
+func (c *ingestCollector) reprocessOrphans(pkt utils.BaseMessage, added []templateKey) {
+	for _, orphan := range c.orphans.take(added) {
+		templates := &exporterTemplates{store: c.templates, source: orphan.source, local: map[templateKey]interface{}{}}
+		pkt.Payload = orphan.payload
+		count, err := c.processNetFlow(pkt, templates)
+		var notFound *netflow.ErrorTemplateNotFound
+		if errors.As(err, &notFound) {
+			// the datagram also contains data records for another missing template
+			orphan.missing = templates.missing
+			c.orphans.add(orphan)
+		} else if err == nil {
+			c.orphans.reprocessed.Add(float64(count))
+		}
+		// the reprocessed datagram may have defined templates awaited by other datagrams
+		c.reprocessOrphans(pkt, templates.added)
+	}
+}
+
+// processNetFlow decodes a datagram and forwards its flows, and returns how many flows were forwarded
+func (c *ingestCollector) processNetFlow(pkt utils.BaseMessage, templates *exporterTemplates) (int, error) {
+	samplerAddress := pkt.Src
+	if v4 := samplerAddress.To4(); v4 != nil {
+		samplerAddress = v4
+	}
+	packet, err := netflow.DecodeMessageContext(context.Background(), bytes.NewBuffer(pkt.Payload), templates.source, templates)
+	if err != nil {
+		var notFound *netflow.ErrorTemplateNotFound
+		if !errors.As(err, &notFound) {
+			c.metrics.error("Cannot decode NetFlow datagram")
+			log.WithError(err).Debugf("cannot decode NetFlow datagram from %s", templates.source)
+		}
+		return 0, err
+	}
+	flowMessages, err := producer.ProcessMessageNetFlowConfig(packet, c.samplingSystem(templates.source), nil)
+	if err != nil {
+		c.metrics.error("Cannot process NetFlow datagram")
+		return 0, err
+	}
+	records := netFlowDataRecords(packet)
+	ts := uint64(time.Now().UTC().Unix())
+	count := 0
+	for i, fmsg := range flowMessages {
+		if !c.limiter.allow(pkt.Src.String()) {
+			continue
+		}
+		fmsg.TimeReceived = ts
+		fmsg.SamplerAddress = samplerAddress
+		record, err := RenderMessage(fmsg)
+		if err != nil {
+			c.metrics.error("Cannot render NetFlow message")
+			continue
+		}
+		if i < len(records) {
+			c.enterprise.decode(records[i].Values, record)
+		}
+		c.in <- record
+		count++
+	}
+	return count, nil
+}
+
+func (c *ingestCollector) samplingSystem(key string) producer.SamplingRateSystem {
+	c.samplingLock.Lock()
+	defer c.samplingLock.Unlock()
+	sampling, ok := c.sampling[key]
+	if !ok {
+		sampling = producer.CreateSamplingSystem()
+		c.sampling[key] = sampling
+	}
+	return sampling
+}
+
+// forgetSession drops the decoding state of an IPFIX over TCP session, whose templates don't outlive it
+func (c *ingestCollector) forgetSession(key string) {
+	c.templates.removeSource(key)
+	c.samplingLock.Lock()
+	delete(c.sampling, key)
+	c.samplingLock.Unlock()
+}
+
 func (c *ingestCollector) processLogLines(out chan<- config.GenericMap) {
 	for {
 		select {
@@ -173,13 +296,25 @@ func NewIngestCollector(opMetrics *operational.Metrics, params config.StageParam
 	if jsonIngestCollector.HostName == "" {
 		return nil, fmt.Errorf("ingest hostname not specified")
 	}
-	if jsonIngestCollector.Port == 0 && jsonIngestCollector.PortLegacy == 0 {
+	if jsonIngestCollector.Port == 0 && jsonIngestCollector.PortLegacy == 0 && jsonIngestCollector.PortTCP == 0 {
 		return nil, fmt.Errorf("no ingest port specified")
 	}
+	if jsonIngestCollector.EnterpriseElementsPath != "" {
+		elements, err := loadEnterpriseElements(jsonIngestCollector.EnterpriseElementsPath)
+		if err != nil {
+			return nil, err
+		}
+		jsonIngestCollector.EnterpriseElements = append(jsonIngestCollector.EnterpriseElements, elements...)
+	}
+	jsonIngestCollector.SetDefaults()
+	if err := jsonIngestCollector.Validate(); err != nil {
+		return nil, err
+	}
 
 	log.Infof("hostname = %s", jsonIngestCollector.HostName)
 	log.Infof("port = %d", jsonIngestCollector.Port)
 	log.Infof("portLegacy = %d", jsonIngestCollector.PortLegacy)
+	log.Infof("portTCP = %d", jsonIngestCollector.PortTCP)
 
 	in := make(chan map[string]interface{}, channelSize)
 	metrics := newMetrics(opMetrics, params.Name, params.Ingest.Type, func() int { return len(in) })
@@ -188,8 +323,15 @@ func NewIngestCollector(opMetrics *operational.Metrics, params config.StageParam
 		hostname:   jsonIngestCollector.HostName,
 		port:       jsonIngestCollector.Port,
 		portLegacy: jsonIngestCollector.PortLegacy,
+		portTCP:    jsonIngestCollector.PortTCP,
 		exitChan:   pUtils.ExitChannel(),
 		in:         in,
 		metrics:    metrics,
+		limiter:    newRateLimiter(opMetrics, params.Name, params.Ingest.RateLimit),
+		enterprise: newEnterpriseElements(jsonIngestCollector.EnterpriseElements),
+		templates:  newNetFlowTemplates(),
+		orphans: newOrphanDatagrams(opMetrics, params.Name, jsonIngestCollector.OrphanTimeout.Duration,
+			jsonIngestCollector.MaxOrphanDatagrams),
+		sampling: map[string]producer.SamplingRateSystem{},
 	}, nil
 }
@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/netsampler/goflow2/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readPcapUDP returns the UDP datagrams of a pcap file captured on Ethernet, with their IPv4 source address
+func readPcapUDP(t *testing.T, path string) []utils.BaseMessage {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Greater(t, len(content), 24)
+	require.Equal(t, uint32(0xa1b2c3d4), binary.LittleEndian.Uint32(content), "only little-endian pcap files are supported")
+	var datagrams []utils.BaseMessage
+	for rest := content[24:]; len(rest) > 0; {
+		require.GreaterOrEqual(t, len(rest), 16)
+		length := int(binary.LittleEndian.Uint32(rest[8:]))
+		frame := rest[16 : 16+length]
+		rest = rest[16+length:]
+		// Ethernet, IPv4 without options, UDP
+		if binary.BigEndian.Uint16(frame[12:]) != 0x0800 || frame[23] != 17 {
+			continue
+		}
+		ip := frame[14:]
+		udp := ip[int(ip[0]&0x0f)*4:]
+		datagrams = append(datagrams, utils.BaseMessage{
+			Src:     net.IP(ip[12:16]),
+			Payload: udp[8:binary.BigEndian.Uint16(udp[4:])],
+		})
+	}
+	return datagrams
+}
+
+func TestIngestIPFIXCapture(t *testing.T) {
+	// the capture contains, in order:
+	// - a datagram from 192.0.2.1, with a data record whose template isn't known yet
+	// - a datagram from 192.0.2.1, with the template and two data records
+	// - a datagram from 192.0.2.2, with a data record whose template is never received
+	c := newTestCollector(t, api.IngestCollector{EnterpriseElementsPath: "testdata/enterprise_elements.yaml"})
+	for _, datagram := range readPcapUDP(t, "testdata/ipfix.pcap") {
+		require.NoError(t, c.decodeNetFlow(datagram))
+	}
+
+	require.Len(t, c.in, 3)
+	flows := map[string]map[string]interface{}{}
+	for i := 0; i < 3; i++ {
+		flow := <-c.in
+		flows[fmt.Sprint(flow["SrcAddr"])] = flow
+	}
+	require.Contains(t, flows, "10.0.0.1", "the data record received before its template should be decoded")
+	assert.Equal(t, "10.0.0.2", flows["10.0.0.1"]["DstAddr"])
+	assert.EqualValues(t, 40000, flows["10.0.0.1"]["SrcPort"])
+	assert.EqualValues(t, 443, flows["10.0.0.1"]["DstPort"])
+	assert.EqualValues(t, 6, flows["10.0.0.1"]["Proto"])
+	assert.EqualValues(t, 1500, flows["10.0.0.1"]["Bytes"])
+	assert.EqualValues(t, 3, flows["10.0.0.1"]["Packets"])
+	assert.EqualValues(t, 1700000000, flows["10.0.0.1"]["TimeFlowStart"])
+	assert.EqualValues(t, 1700000001, flows["10.0.0.1"]["TimeFlowEnd"])
+	assert.Equal(t, []byte{192, 0, 2, 1}, flows["10.0.0.1"]["SamplerAddress"])
+	assert.Equal(t, uint64(7), flows["10.0.0.1"]["AppID"])
+	assert.Equal(t, "red", flows["10.0.0.1"]["Tenant"])
+
+	require.Contains(t, flows, "10.0.0.3")
+	assert.EqualValues(t, 17, flows["10.0.0.3"]["Proto"])
+	assert.Equal(t, "blue", flows["10.0.0.3"]["Tenant"])
+	require.Contains(t, flows, "10.0.0.5")
+	assert.EqualValues(t, 9000, flows["10.0.0.5"]["Bytes"])
+	assert.Equal(t, "", flows["10.0.0.5"]["Tenant"])
+
+	// templates are scoped to the exporter: the datagram from 192.0.2.2 waits for its own template
+	assert.Equal(t, float64(1), counter(t, c.orphans.reprocessed))
+	assert.Len(t, c.orphans.datagrams, 1)
+}
+
+func TestIngestIPFIXOverTCP(t *testing.T) {
+	port, err := test.UDPPort()
+	require.NoError(t, err)
+	stage := config.NewCollectorPipeline("ingest-ipfix-tcp", api.IngestCollector{HostName: "127.0.0.1", PortTCP: port})
+	c := newTestCollectorFromStage(t, stage)
+	forwarded := make(chan config.GenericMap, 10)
+	go c.Ingest(forwarded)
+
+	datagrams := readPcapUDP(t, "testdata/ipfix.pcap")
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		return err == nil
+	}, timeout, 10*time.Millisecond)
+	key := conn.LocalAddr().String()
+
+	// the stream carries the template then the data records; a data record before the template waits for it
+	_, err = conn.Write(append(append([]byte{}, datagrams[0].Payload...), datagrams[1].Payload...))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(forwarded) == 3 }, timeout, 10*time.Millisecond)
+	_, ok := c.templates.get(templateKey{source: key, version: 10, obsDomainID: 1, templateID: 256})
+	assert.True(t, ok)
+
+	// templates are forgotten when the session ends
+	require.NoError(t, conn.Close())
+	require.Eventually(t, func() bool {
+		_, ok := c.templates.get(templateKey{source: key, version: 10, obsDomainID: 1, templateID: 256})
+		return !ok
+	}, timeout, 10*time.Millisecond)
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/netsampler/goflow2/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// ipfixHeaderLen is the length of the IPFIX message header, whose length field delimits the messages of a TCP stream
+const ipfixHeaderLen = 16
+
+// listenTCP accepts IPFIX over TCP sessions (RFC 7011, section 10.4) until the exit channel is closed
+func (c *ingestCollector) listenTCP() error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(c.hostname, strconv.Itoa(c.portTCP)))
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-c.exitChan
+		_ = listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-c.exitChan:
+				return nil
+			default:
+				return err
+			}
+		}
+		go c.handleTCPSession(conn)
+	}
+}
+
+// handleTCPSession decodes the IPFIX messages of a session. Templates are scoped to the session, so they are
+// forgotten when it ends.
+func (c *ingestCollector) handleTCPSession(conn net.Conn) {
+	key := conn.RemoteAddr().String()
+	var src net.IP
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		src = addr.IP
+	}
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		_ = conn.Close()
+		c.forgetSession(key)
+		log.Debugf("IPFIX session from %s closed", key)
+	}()
+	go func() {
+		select {
+		case <-c.exitChan:
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	log.Debugf("IPFIX session from %s opened", key)
+
+	reader := bufio.NewReader(conn)
+	header := make([]byte, ipfixHeaderLen)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.WithError(err).Debugf("can't read IPFIX message from %s", key)
+			}
+			return
+		}
+		version := binary.BigEndian.Uint16(header[0:2])
+		length := int(binary.BigEndian.Uint16(header[2:4]))
+		if version != 10 || length < ipfixHeaderLen {
+			// the stream can't be resynchronized
+			c.metrics.error("Invalid IPFIX message")
+			log.Warnf("invalid IPFIX message from %s (version %d, length %d), closing the session", key, version, length)
+			return
+		}
+		msg := make([]byte, length)
+		copy(msg, header)
+		if _, err := io.ReadFull(reader, msg[ipfixHeaderLen:]); err != nil {
+			log.WithError(err).Debugf("can't read IPFIX message from %s", key)
+			return
+		}
+		// decoding errors are already counted: the next messages may still be decoded
+		_ = c.decodeFrom(key, utils.BaseMessage{Src: src, Payload: msg})
+	}
+}
@@ -18,6 +18,7 @@
 package ingest
 
 import (
+	"net"
 	"testing"
 	"time"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vmware/go-ipfix/pkg/entities"
 )
 
 const timeout = 5 * time.Second
@@ -55,6 +57,66 @@ func TestIngest(t *testing.T) {
 	assert.Equal(t, "1.2.3.4", flow["SrcAddr"])
 }
 
+func TestIngestEnterpriseElements(t *testing.T) {
+	collectorPort, err := test.UDPPort()
+	require.NoError(t, err)
+	stage := config.NewCollectorPipeline("ingest-ipfix", api.IngestCollector{
+		HostName: "0.0.0.0",
+		Port:     collectorPort,
+		EnterpriseElements: []api.EnterpriseElement{
+			{PEN: 32473, ID: 1, Name: "AppID"},
+			{PEN: 32473, ID: 2, Name: "Tenant", Type: api.EnterpriseElementString},
+			{PEN: 32473, ID: 3, Name: "NextHop", Type: api.EnterpriseElementIP},
+		},
+	})
+	ic, err := NewIngestCollector(operational.NewMetrics(&config.MetricsSettings{}), stage.GetStageParams()[0])
+	require.NoError(t, err)
+	forwarded := make(chan config.GenericMap)
+	go ic.Ingest(forwarded)
+
+	client, err := test.NewIPFIXClient(collectorPort)
+	require.NoError(t, err)
+	client.EnterpriseElements = []entities.InfoElementWithValue{
+		entities.NewUnsigned32InfoElement(entities.NewInfoElement("appId", 1, entities.Unsigned32, 32473, 4), 42),
+		entities.NewStringInfoElement(entities.NewInfoElement("tenant", 2, entities.String, 32473, 65535), "blue"),
+		entities.NewIPAddressInfoElement(entities.NewInfoElement("nextHop", 3, entities.Ipv4Address, 32473, 4), net.ParseIP("10.0.0.254")),
+		// not configured: kept as an hexadecimal string
+		entities.NewUnsigned16InfoElement(entities.NewInfoElement("vendorId", 4, entities.Unsigned16, 32473, 2), 0xabcd),
+	}
+
+	flow := waitForFlow(t, client, forwarded)
+	assert.Equal(t, "1.2.3.4", flow["SrcAddr"])
+	assert.Equal(t, uint64(42), flow["AppID"])
+	assert.Equal(t, "blue", flow["Tenant"])
+	assert.Equal(t, "10.0.0.254", flow["NextHop"])
+	assert.Equal(t, "abcd", flow["Enterprise_32473_4"])
+}
+
+func TestIngestEnterpriseElementsValidation(t *testing.T) {
+	for _, elements := range [][]api.EnterpriseElement{
+		{{ID: 1, Name: "AppID"}},
+		{{PEN: 32473, ID: 1}},
+		{{PEN: 32473, ID: 0x8001, Name: "AppID"}},
+		{{PEN: 32473, ID: 1, Name: "AppID", Type: "float"}},
+		{{PEN: 32473, ID: 1, Name: "AppID"}, {PEN: 32473, ID: 1, Name: "Other"}},
+	} {
+		stage := config.NewCollectorPipeline("ingest-ipfix", api.IngestCollector{HostName: "0.0.0.0", Port: 1, EnterpriseElements: elements})
+		_, err := NewIngestCollector(operational.NewMetrics(&config.MetricsSettings{}), stage.GetStageParams()[0])
+		require.Error(t, err, "%v", elements)
+	}
+}
+
+func TestDecodeEnterpriseValue(t *testing.T) {
+	assert.Equal(t, uint64(0x0102), decodeEnterpriseValue(api.EnterpriseElementUnsigned, []byte{1, 2}))
+	assert.Equal(t, int64(-2), decodeEnterpriseValue(api.EnterpriseElementSigned, []byte{0xff, 0xfe}))
+	assert.Equal(t, "2001:db8::1", decodeEnterpriseValue(api.EnterpriseElementIP, net.ParseIP("2001:db8::1")))
+	assert.Equal(t, "00:11:22:33:44:55", decodeEnterpriseValue(api.EnterpriseElementMAC, []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55}))
+	assert.Equal(t, "eth0", decodeEnterpriseValue(api.EnterpriseElementString, []byte("eth0\x00\x00")))
+	// values whose length doesn't match the type are kept as hexadecimal strings
+	assert.Equal(t, "010203", decodeEnterpriseValue(api.EnterpriseElementIP, []byte{1, 2, 3}))
+	assert.Equal(t, "010203", decodeEnterpriseValue(api.EnterpriseElementBytes, []byte{1, 2, 3}))
+}
+
 // The IPFIX client might send information before the Ingester is actually listening,
 // so we might need to repeat the submission until the ingest starts forwarding logs
 func waitForFlow(t *testing.T, client *test.IPFIXClient, forwarded chan config.GenericMap) config.GenericMap {
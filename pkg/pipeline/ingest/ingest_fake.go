@@ -40,7 +40,11 @@ func (inf *Fake) Ingest(out chan<- config.GenericMap) {
 		case <-inf.exitChan:
 			log.Debugf("exiting IngestFake because of signal")
 			return
-		case records := <-inf.In:
+		case records, ok := <-inf.In:
+			if !ok {
+				log.Debugf("exiting IngestFake because its input is closed")
+				return
+			}
 			out <- records
 			atomic.AddInt64(&inf.Count, 1)
 		}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/decode"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	log "github.com/sirupsen/logrus"
@@ -42,27 +43,21 @@ const (
 	chunkLines   = 100
 )
 
+// Reload reads the definitions of the decoder again
+func (ingestF *ingestFile) Reload() error {
+	return reloadDecoder(ingestF.decoder)
+}
+
 // Ingest ingests entries from a file and resends the same data every delaySeconds seconds
 func (ingestF *ingestFile) Ingest(out chan<- config.GenericMap) {
 	var filename string
 	if ingestF.params.File != nil {
 		filename = ingestF.params.File.Filename
 	}
-	var lines [][]byte
-	file, err := os.Open(filename)
+	lines, err := ingestF.readLines(filename)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer func() {
-		_ = file.Close()
-	}()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		text := scanner.Text()
-		log.Debugf("%s", text)
-		lines = append(lines, []byte(text))
-	}
 
 	log.Debugf("Ingesting %d log lines from %s", len(lines), filename)
 	switch ingestF.params.Type {
@@ -95,6 +90,44 @@ func (ingestF *ingestFile) Ingest(out chan<- config.GenericMap) {
 	}
 }
 
+// readLines returns the lines of the file, or its records after the header row for CSV files
+func (ingestF *ingestFile) readLines(filename string) ([][]byte, error) {
+	if csvDecoder, ok := ingestF.decoder.(*decode.DecodeCSV); ok {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		records, err := csvDecoder.SplitRecords(data)
+		if err != nil {
+			return nil, fmt.Errorf("can't read CSV file %s: %w", filename, err)
+		}
+		if !csvDecoder.HasHeader() && len(records) > 0 {
+			if err := csvDecoder.SetHeader(records[0]); err != nil {
+				return nil, err
+			}
+			records = records[1:]
+		}
+		return records, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := scanner.Text()
+		log.Debugf("%s", text)
+		lines = append(lines, []byte(text))
+	}
+	return lines, nil
+}
+
 func (ingestF *ingestFile) sendAllLines(lines [][]byte, out chan<- config.GenericMap) {
 	log.Debugf("ingestFile sending %d lines", len(lines))
 	ingestF.TotalRecords = len(lines)
@@ -109,14 +142,14 @@ func (ingestF *ingestFile) sendAllLines(lines [][]byte, out chan<- config.Generi
 }
 
 // NewIngestFile create a new ingester
-func NewIngestFile(params config.StageParam) (Ingester, error) {
+func NewIngestFile(opMetrics *operational.Metrics, params config.StageParam) (Ingester, error) {
 	log.Debugf("entering NewIngestFile")
 	if params.Ingest == nil || params.Ingest.File == nil || params.Ingest.File.Filename == "" {
 		return nil, fmt.Errorf("ingest filename not specified")
 	}
 
 	log.Debugf("input file name = %s", params.Ingest.File.Filename)
-	decoder, err := decode.GetDecoder(params.Ingest.File.Decoder)
+	decoder, err := decode.GetDecoder(opMetrics, params.Name, params.Ingest.File.Decoder)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,8 @@ package ingest
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
@@ -10,11 +12,13 @@ import (
 	pUtils "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/decode"
-	grpc "github.com/netobserv/netobserv-ebpf-agent/pkg/grpc/flow"
 	"github.com/netobserv/netobserv-ebpf-agent/pkg/pbflow"
 
 	"github.com/sirupsen/logrus"
 	grpc2 "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
@@ -27,9 +31,30 @@ const (
 
 // GRPCProtobuf ingests data from the NetObserv eBPF Agent, using Protocol Buffers over gRPC
 type GRPCProtobuf struct {
-	collector   *grpc.CollectorServer
+	server      *grpc2.Server
+	address     string
 	flowPackets chan *pbflow.Records
 	metrics     *metrics
+	exitChan    <-chan struct{}
+}
+
+// collectorAPI forwards the groups of flows sent by the agents to the ingest channel. When the pipeline is
+// saturated, Send waits for room in the channel, which slows the agents down instead of dropping their flows;
+// the flows are rejected with the Unavailable code if the agent cancels the call, or if its deadline expires.
+type collectorAPI struct {
+	pbflow.UnimplementedCollectorServer
+	flowPackets chan<- *pbflow.Records
+}
+
+var okReply = &pbflow.CollectorReply{}
+
+func (c *collectorAPI) Send(ctx context.Context, records *pbflow.Records) (*pbflow.CollectorReply, error) {
+	select {
+	case c.flowPackets <- records:
+		return okReply, nil
+	case <-ctx.Done():
+		return nil, status.Errorf(codes.Unavailable, "the pipeline is saturated: %v", ctx.Err())
+	}
 }
 
 func NewGRPCProtobuf(opMetrics *operational.Metrics, params config.StageParam) (*GRPCProtobuf, error) {
@@ -40,43 +65,68 @@ func NewGRPCProtobuf(opMetrics *operational.Metrics, params config.StageParam) (
 	if netObserv.Port == 0 {
 		return nil, fmt.Errorf("ingest port not specified")
 	}
+	if netObserv.MaxMessageSize < 0 {
+		return nil, fmt.Errorf("maxMessageSize can't be negative: %d", netObserv.MaxMessageSize)
+	}
 	bufLen := netObserv.BufferLen
 	if bufLen == 0 {
 		bufLen = defaultBufferLen
 	}
 	flowPackets := make(chan *pbflow.Records, bufLen)
 	metrics := newMetrics(opMetrics, params.Name, params.Ingest.Type, func() int { return len(flowPackets) })
-	collector, err := grpc.StartCollector(netObserv.Port, flowPackets,
-		grpc.WithGRPCServerOptions(grpc2.UnaryInterceptor(instrumentGRPC(metrics))))
+
+	options := []grpc2.ServerOption{grpc2.UnaryInterceptor(instrumentGRPC(metrics))}
+	if netObserv.MaxMessageSize > 0 {
+		options = append(options, grpc2.MaxRecvMsgSize(netObserv.MaxMessageSize))
+	}
+	if netObserv.TLS != nil {
+		tlsConfig, err := netObserv.TLS.Build()
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+		}
+		options = append(options, grpc2.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(netObserv.Address, strconv.Itoa(netObserv.Port)))
 	if err != nil {
 		return nil, err
 	}
+	server := grpc2.NewServer(options...)
+	pbflow.RegisterCollectorServer(server, &collectorAPI{flowPackets: flowPackets})
+	reflection.Register(server)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			glog.WithError(err).Error("gRPC server stopped")
+		}
+	}()
 	return &GRPCProtobuf{
-		collector:   collector,
+		server:      server,
+		address:     listener.Addr().String(),
 		flowPackets: flowPackets,
 		metrics:     metrics,
+		exitChan:    pUtils.ExitChannel(),
 	}, nil
 }
 
 func (no *GRPCProtobuf) Ingest(out chan<- config.GenericMap) {
 	no.metrics.createOutQueueLen(out)
-	go func() {
-		<-pUtils.ExitChannel()
-		close(no.flowPackets)
-		no.collector.Close()
-	}()
-	for fp := range no.flowPackets {
-		glog.Debugf("Ingested %v records", len(fp.Entries))
-		for _, entry := range fp.Entries {
-			out <- decode.PBFlowToMap(entry)
+	defer no.server.Stop()
+	for {
+		select {
+		case <-no.exitChan:
+			glog.Debug("exiting ingest gRPC because of signal")
+			return
+		case fp := <-no.flowPackets:
+			glog.Debugf("Ingested %v records", len(fp.Entries))
+			for _, entry := range fp.Entries {
+				out <- decode.PBFlowToMap(entry)
+			}
 		}
 	}
 }
 
 func (no *GRPCProtobuf) Close() error {
-	err := no.collector.Close()
-	close(no.flowPackets)
-	return err
+	no.server.Stop()
+	return nil
 }
 
 func instrumentGRPC(m *metrics) grpc2.UnaryServerInterceptor {
@@ -99,9 +149,6 @@ func instrumentGRPC(m *metrics) grpc2.UnaryServerInterceptor {
 			m.latency.Observe(delay)
 		}
 
-		// instrument flows processed counter
-		m.flowsProcessed.Add(float64(len(flowRecords.Entries)))
-
 		// instrument message bytes
 		m.batchSizeBytes.Observe(float64(proto.Size(flowRecords)))
 
@@ -110,6 +157,9 @@ func instrumentGRPC(m *metrics) grpc2.UnaryServerInterceptor {
 			// "trace" level used to minimize performance impact
 			glog.Tracef("Reporting metric error: %v", err)
 			m.error(utils.ConvertToString(status.Code(err)))
+		} else {
+			// instrument flows processed counter: the flows rejected because of backpressure are not counted
+			m.flowsProcessed.Add(float64(len(flowRecords.Entries)))
 		}
 
 		// Stage duration
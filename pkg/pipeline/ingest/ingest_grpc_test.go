@@ -0,0 +1,206 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	test2 "github.com/mariomac/guara/pkg/test"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/netobserv-ebpf-agent/pkg/pbflow"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newTestGRPC(t *testing.T, params api.IngestGRPCProto) *GRPCProtobuf {
+	port, err := test2.FreeTCPPort()
+	require.NoError(t, err)
+	params.Address = "127.0.0.1"
+	params.Port = port
+	ingester, err := NewGRPCProtobuf(operational.NewMetrics(&config.MetricsSettings{}), config.NewGRPCParams("ingest-grpc", params))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ingester.Close() })
+	return ingester
+}
+
+func grpcClient(t *testing.T, address string, creds credentials.TransportCredentials) pbflow.CollectorClient {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pbflow.NewCollectorClient(conn)
+}
+
+func grpcRecords(iface string) *pbflow.Records {
+	return &pbflow.Records{Entries: []*pbflow.Record{{
+		Interface:     iface,
+		EthProtocol:   2048,
+		Bytes:         456,
+		Packets:       123,
+		TimeFlowStart: timestamppb.Now(),
+		TimeFlowEnd:   timestamppb.Now(),
+		Network: &pbflow.Network{
+			SrcAddr: &pbflow.IP{IpFamily: &pbflow.IP_Ipv4{Ipv4: 0x0a000001}},
+			DstAddr: &pbflow.IP{IpFamily: &pbflow.IP_Ipv4{Ipv4: 0x0a000002}},
+		},
+		DataLink:  &pbflow.DataLink{},
+		Transport: &pbflow.Transport{},
+	}}}
+}
+
+func TestGRPCIngest(t *testing.T) {
+	ingester := newTestGRPC(t, api.IngestGRPCProto{})
+	require.True(t, strings.HasPrefix(ingester.address, "127.0.0.1:"))
+	exitChan := make(chan struct{})
+	ingester.exitChan = exitChan
+	out := make(chan config.GenericMap, 10)
+	done := make(chan struct{})
+	go func() {
+		ingester.Ingest(out)
+		close(done)
+	}()
+
+	client := grpcClient(t, ingester.address, insecure.NewCredentials())
+	_, err := client.Send(context.Background(), grpcRecords("eth0"))
+	require.NoError(t, err)
+	flow := <-out
+	require.Equal(t, "10.0.0.1", flow["SrcAddr"])
+	require.EqualValues(t, 456, flow["Bytes"])
+
+	// the server stops with the ingester
+	close(exitChan)
+	<-done
+	_, err = client.Send(context.Background(), grpcRecords("eth0"))
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestGRPCIngestBackpressure(t *testing.T) {
+	// the pipeline doesn't read the flows: the channel is full after the first group of flows
+	ingester := newTestGRPC(t, api.IngestGRPCProto{BufferLen: 1})
+	client := grpcClient(t, ingester.address, insecure.NewCredentials())
+	_, err := client.Send(context.Background(), grpcRecords("eth0"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.Send(ctx, grpcRecords("eth1"))
+	require.Error(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "the call must wait for room in the channel")
+	require.Eventually(t, func() bool {
+		var m dto.Metric
+		require.NoError(t, ingester.metrics.errors.WithLabelValues("ingest-grpc", "grpc", "Unavailable").Write(&m))
+		return m.GetCounter().GetValue() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// once there is room, the flows are accepted
+	<-ingester.flowPackets
+	_, err = client.Send(context.Background(), grpcRecords("eth2"))
+	require.NoError(t, err)
+
+	var m dto.Metric
+	require.NoError(t, ingester.metrics.flowsProcessed.Write(&m))
+	require.Equal(t, float64(2), m.GetCounter().GetValue(), "rejected flows must not be counted")
+}
+
+func TestGRPCIngestMaxMessageSize(t *testing.T) {
+	ingester := newTestGRPC(t, api.IngestGRPCProto{MaxMessageSize: 200})
+	client := grpcClient(t, ingester.address, insecure.NewCredentials())
+	_, err := client.Send(context.Background(), grpcRecords("eth0"))
+	require.NoError(t, err)
+	_, err = client.Send(context.Background(), grpcRecords(strings.Repeat("x", 300)))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = NewGRPCProtobuf(operational.NewMetrics(&config.MetricsSettings{}), config.NewGRPCParams("ingest-grpc", api.IngestGRPCProto{Port: 1, MaxMessageSize: -1}))
+	require.Error(t, err)
+}
+
+// writeServerCert writes a self-signed certificate for 127.0.0.1, and returns its paths and the pool verifying it
+func writeServerCert(t *testing.T) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certPath, keyPath, pool
+}
+
+func TestGRPCIngestTLS(t *testing.T) {
+	certPath, keyPath, pool := writeServerCert(t)
+	ingester := newTestGRPC(t, api.IngestGRPCProto{TLS: &api.ServerTLS{CertPath: certPath, KeyPath: keyPath}})
+
+	client := grpcClient(t, ingester.address, credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+	_, err := client.Send(context.Background(), grpcRecords("eth0"))
+	require.NoError(t, err)
+
+	// plain-text clients are rejected
+	client = grpcClient(t, ingester.address, insecure.NewCredentials())
+	_, err = client.Send(context.Background(), grpcRecords("eth0"))
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	// the client CA requires the clients to present a certificate
+	ingester = newTestGRPC(t, api.IngestGRPCProto{TLS: &api.ServerTLS{CertPath: certPath, KeyPath: keyPath, ClientCACertPath: certPath}})
+	client = grpcClient(t, ingester.address, credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+	_, err = client.Send(context.Background(), grpcRecords("eth0"))
+	require.Error(t, err)
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	require.NoError(t, err)
+	client = grpcClient(t, ingester.address, credentials.NewTLS(&tls.Config{RootCAs: pool, Certificates: []tls.Certificate{pair}, MinVersion: tls.VersionTLS12}))
+	_, err = client.Send(context.Background(), grpcRecords("eth0"))
+	require.NoError(t, err)
+}
@@ -19,6 +19,7 @@ package ingest
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
@@ -34,20 +35,26 @@ import (
 var klog = logrus.WithField("component", "ingest.Kafka")
 
 type kafkaReadMessage interface {
-	ReadMessage(ctx context.Context) (kafkago.Message, error)
+	FetchMessage(ctx context.Context) (kafkago.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
 	Config() kafkago.ReaderConfig
 	Stats() kafkago.ReaderStats
+	Close() error
 }
 
 type ingestKafka struct {
 	kafkaReader      kafkaReadMessage
 	decoder          decode.Decoder
-	in               chan []byte
+	in               chan kafkago.Message
+	commit           bool
 	exitChan         <-chan struct{}
 	batchReadTimeout int64
 	batchMaxLength   int
 	metrics          *metrics
 	canLogMessages   bool
+	lagReporter      *kafkaLagReporter
+	limiter          *rateLimiter
+	limiterHeader    string
 }
 
 const defaultBatchReadTimeout = int64(1000)
@@ -55,6 +62,12 @@ const defaultKafkaBatchMaxLength = 500
 const defaultKafkaCommitInterval = 500
 
 const kafkaStatsPeriod = 15 * time.Second
+const kafkaReadinessTimeout = 2 * time.Second
+
+// Reload reads the definitions of the decoder again
+func (k *ingestKafka) Reload() error {
+	return reloadDecoder(k.decoder)
+}
 
 // Ingest ingests entries from kafka topic
 func (k *ingestKafka) Ingest(out chan<- config.GenericMap) {
@@ -75,6 +88,9 @@ func (k *ingestKafka) kafkaListener() {
 	if logrus.IsLevelEnabled(logrus.DebugLevel) {
 		go k.reportStats()
 	}
+	if k.lagReporter != nil {
+		go k.lagReporter.run(k.exitChan)
+	}
 
 	go func() {
 		for {
@@ -84,8 +100,13 @@ func (k *ingestKafka) kafkaListener() {
 			}
 			klog.Trace("fetching messages from Kafka")
 			// block until a message arrives
-			kafkaMessage, err := k.kafkaReader.ReadMessage(context.Background())
+			kafkaMessage, err := k.kafkaReader.FetchMessage(context.Background())
 			if err != nil {
+				if k.isStopped() {
+					// the reader was closed on exit
+					klog.Info("gracefully exiting")
+					return
+				}
 				klog.Errorln(err)
 				k.metrics.error("Cannot read message")
 				continue
@@ -96,14 +117,25 @@ func (k *ingestKafka) kafkaListener() {
 			k.metrics.flowsProcessed.Inc()
 			messageLen := len(kafkaMessage.Value)
 			k.metrics.batchSizeBytes.Observe(float64(messageLen) + float64(len(kafkaMessage.Key)))
-			if messageLen > 0 {
-				// process message
-				k.in <- kafkaMessage.Value
-			}
+			// process message
+			k.in <- kafkaMessage
 		}
 	}()
 }
 
+// messageSource returns the rate limit source of a message: its key, or the value of the configured header
+func (k *ingestKafka) messageSource(msg *kafkago.Message) string {
+	if k.limiterHeader == "" {
+		return string(msg.Key)
+	}
+	for _, header := range msg.Headers {
+		if header.Key == k.limiterHeader {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
 func (k *ingestKafka) isStopped() bool {
 	select {
 	case <-k.exitChan:
@@ -145,19 +177,63 @@ func (k *ingestKafka) processRecord(record []byte, out chan<- config.GenericMap)
 	out <- decoded
 }
 
+// processMessage sends the message down the pipeline, unless it is empty or rate limited, then commits its offset.
+// The messages fetched but not processed yet aren't committed: the consumer group reads them again on restart.
+func (k *ingestKafka) processMessage(msg *kafkago.Message, out chan<- config.GenericMap) {
+	if len(msg.Value) > 0 && k.limiter.allow(k.messageSource(msg)) {
+		k.processRecord(msg.Value, out)
+	}
+	if !k.commit {
+		return
+	}
+	if err := k.kafkaReader.CommitMessages(context.Background(), *msg); err != nil {
+		klog.WithError(err).Warn("can't commit Kafka message")
+		k.metrics.error("Cannot commit message")
+	}
+}
+
 // read items from ingestKafka input channel, pool them, and send down the pipeline
 func (k *ingestKafka) processLogLines(out chan<- config.GenericMap) {
 	for {
 		select {
 		case <-k.exitChan:
 			klog.Debugf("exiting ingestKafka because of signal")
+			k.close()
 			return
-		case record := <-k.in:
-			k.processRecord(record, out)
+		case msg := <-k.in:
+			k.processMessage(&msg, out)
 		}
 	}
 }
 
+// close stops reading and commits the offsets of the messages processed since the last commit, so that the consumer
+// group resumes from there on restart
+func (k *ingestKafka) close() {
+	if err := k.kafkaReader.Close(); err != nil {
+		klog.WithError(err).Warn("can't close Kafka reader")
+	}
+}
+
+// Ready fails while none of the brokers can be reached
+func (k *ingestKafka) Ready() error {
+	cfg := k.kafkaReader.Config()
+	dialer := cfg.Dialer
+	if dialer == nil {
+		dialer = kafkago.DefaultDialer
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaReadinessTimeout)
+	defer cancel()
+	err := errors.New("no brokers")
+	for _, broker := range cfg.Brokers {
+		var conn *kafkago.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", broker); err == nil {
+			_ = conn.Close()
+			return nil
+		}
+	}
+	return fmt.Errorf("can't reach the Kafka brokers: %w", err)
+}
+
 // reportStats periodically reports kafka stats
 func (k *ingestKafka) reportStats() {
 	ticker := time.NewTicker(kafkaStatsPeriod)
@@ -166,6 +242,7 @@ func (k *ingestKafka) reportStats() {
 		select {
 		case <-k.exitChan:
 			klog.Debug("gracefully exiting stats reporter")
+			return
 		case <-ticker.C:
 			klog.Debugf("reader stats: %#v", k.kafkaReader.Stats())
 		}
@@ -273,7 +350,7 @@ func NewIngestKafka(opMetrics *operational.Metrics, params config.StageParam) (I
 		return nil, errors.New(errMsg)
 	}
 
-	decoder, err := decode.GetDecoder(jsonIngestKafka.Decoder)
+	decoder, err := decode.GetDecoder(opMetrics, params.Name, jsonIngestKafka.Decoder)
 	if err != nil {
 		return nil, err
 	}
@@ -283,17 +360,41 @@ func NewIngestKafka(opMetrics *operational.Metrics, params config.StageParam) (I
 		bml = jsonIngestKafka.BatchMaxLen
 	}
 
-	in := make(chan []byte, 2*bml)
+	in := make(chan kafkago.Message, 2*bml)
 	metrics := newMetrics(opMetrics, params.Name, ingestType, func() int { return len(in) })
 
+	// the lag is computed from the offsets committed by the consumer group
+	var lagReporter *kafkaLagReporter
+	if jsonIngestKafka.GroupID != "" && jsonIngestKafka.LagInterval >= 0 {
+		lagInterval := defaultKafkaLagInterval
+		if jsonIngestKafka.LagInterval != 0 {
+			lagInterval = jsonIngestKafka.LagInterval
+		}
+		client := &kafkago.Client{
+			Addr:      kafkago.TCP(jsonIngestKafka.Brokers...),
+			Transport: &kafkago.Transport{TLS: dialer.TLS, SASL: dialer.SASLMechanism},
+		}
+		lagReporter = newKafkaLagReporter(opMetrics, params.Name, jsonIngestKafka.Topic, jsonIngestKafka.GroupID,
+			time.Duration(lagInterval)*time.Millisecond, client)
+	}
+
+	var limiterHeader string
+	if params.Ingest.RateLimit != nil {
+		limiterHeader = params.Ingest.RateLimit.KafkaHeader
+	}
+
 	return &ingestKafka{
 		kafkaReader:      kafkaReader,
 		decoder:          decoder,
 		exitChan:         utils.ExitChannel(),
 		in:               in,
+		commit:           jsonIngestKafka.GroupID != "",
 		batchMaxLength:   bml,
 		batchReadTimeout: batchReadTimeout,
 		metrics:          metrics,
 		canLogMessages:   jsonIngestKafka.Decoder.Type == api.DecoderJSON,
+		lagReporter:      lagReporter,
+		limiter:          newRateLimiter(opMetrics, params.Name, params.Ingest.RateLimit),
+		limiterHeader:    limiterHeader,
 	}, nil
 }
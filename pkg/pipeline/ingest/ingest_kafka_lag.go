@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	 http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/prometheus/client_golang/prometheus"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const defaultKafkaLagInterval = int64(30000)
+
+var kafkaLagGauge = operational.DefineMetric(
+	"ingest_kafka_lag",
+	"Kafka consumer lag per partition: difference between the latest offset and the offset committed by the consumer group",
+	operational.TypeGauge,
+	"stage", "topic", "partition",
+)
+
+// kafkaOffsetsClient is the subset of the kafka-go client used to compute the lag
+type kafkaOffsetsClient interface {
+	Metadata(ctx context.Context, req *kafkago.MetadataRequest) (*kafkago.MetadataResponse, error)
+	OffsetFetch(ctx context.Context, req *kafkago.OffsetFetchRequest) (*kafkago.OffsetFetchResponse, error)
+	ListOffsets(ctx context.Context, req *kafkago.ListOffsetsRequest) (*kafkago.ListOffsetsResponse, error)
+}
+
+// kafkaLagReporter periodically compares the offsets committed by the consumer group with the latest offsets
+// of the topic partitions. Unlike the reader stats, the lag is reported for all the partitions, including those
+// assigned to other members of the group.
+type kafkaLagReporter struct {
+	client   kafkaOffsetsClient
+	stage    string
+	topic    string
+	groupID  string
+	interval time.Duration
+	timeout  time.Duration
+	lag      *prometheus.GaugeVec
+}
+
+func newKafkaLagReporter(opMetrics *operational.Metrics, stage, topic, groupID string, interval time.Duration, client kafkaOffsetsClient) *kafkaLagReporter {
+	return &kafkaLagReporter{
+		client:   client,
+		stage:    stage,
+		topic:    topic,
+		groupID:  groupID,
+		interval: interval,
+		timeout:  interval,
+		lag:      opMetrics.NewGaugeVec(&kafkaLagGauge),
+	}
+}
+
+func (r *kafkaLagReporter) run(exitChan <-chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exitChan:
+			klog.Debug("gracefully exiting lag reporter")
+			return
+		case <-ticker.C:
+			if err := r.report(); err != nil {
+				klog.WithError(err).Warn("can't compute Kafka consumer lag")
+			}
+		}
+	}
+}
+
+func (r *kafkaLagReporter) report() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	metadata, err := r.client.Metadata(ctx, &kafkago.MetadataRequest{Topics: []string{r.topic}})
+	if err != nil {
+		return fmt.Errorf("fetching metadata: %w", err)
+	}
+	var partitions []int
+	var latestRequests []kafkago.OffsetRequest
+	for i := range metadata.Topics {
+		if metadata.Topics[i].Name != r.topic {
+			continue
+		}
+		if metadata.Topics[i].Error != nil {
+			return fmt.Errorf("fetching metadata: %w", metadata.Topics[i].Error)
+		}
+		for _, p := range metadata.Topics[i].Partitions {
+			partitions = append(partitions, p.ID)
+			latestRequests = append(latestRequests, kafkago.LastOffsetOf(p.ID))
+		}
+	}
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	committed, err := r.client.OffsetFetch(ctx, &kafkago.OffsetFetchRequest{
+		GroupID: r.groupID,
+		Topics:  map[string][]int{r.topic: partitions},
+	})
+	if err != nil {
+		return fmt.Errorf("fetching committed offsets: %w", err)
+	}
+	if committed.Error != nil {
+		return fmt.Errorf("fetching committed offsets: %w", committed.Error)
+	}
+	latest, err := r.client.ListOffsets(ctx, &kafkago.ListOffsetsRequest{
+		Topics: map[string][]kafkago.OffsetRequest{r.topic: latestRequests},
+	})
+	if err != nil {
+		return fmt.Errorf("listing offsets: %w", err)
+	}
+
+	latestOffsets := map[int]int64{}
+	for _, p := range latest.Topics[r.topic] {
+		if p.Error == nil {
+			latestOffsets[p.Partition] = p.LastOffset
+		}
+	}
+	for _, p := range committed.Topics[r.topic] {
+		last, ok := latestOffsets[p.Partition]
+		// a negative committed offset means the group didn't commit on this partition yet
+		if p.Error != nil || !ok || p.CommittedOffset < 0 {
+			continue
+		}
+		r.lag.WithLabelValues(r.stage, r.topic, strconv.Itoa(p.Partition)).Set(float64(max(last-p.CommittedOffset, 0)))
+	}
+	return nil
+}
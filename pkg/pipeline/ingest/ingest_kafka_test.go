@@ -19,6 +19,9 @@ package ingest
 
 import (
 	"context"
+	"errors"
+	"io"
+	"net"
 	"testing"
 	"time"
 
@@ -26,6 +29,8 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	kafkago "github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -130,9 +135,9 @@ func Test_IngestKafka(t *testing.T) {
 	record3 := "{\"Bytes\":20803,\"DstAddr\":\"10.130.2.3\",\"DstPort\":36936,\"Packets\":403,\"SrcAddr\":\"10.130.2.13\",\"SrcPort\":3100}"
 
 	inChan := ingestKafka.in
-	inChan <- []byte(record1)
-	inChan <- []byte(record2)
-	inChan <- []byte(record3)
+	inChan <- kafkago.Message{Value: []byte(record1)}
+	inChan <- kafkago.Message{Value: []byte(record2)}
+	inChan <- kafkago.Message{Value: []byte(record3)}
 
 	// wait for the data to have been processed
 	receivedEntry, err := test.WaitFromChannel(ingestOutput, timeout)
@@ -154,28 +159,39 @@ func Test_IngestKafka(t *testing.T) {
 }
 
 type fakeKafkaReader struct {
-	readToDo int
+	readToDo  int
+	closed    chan struct{}
+	committed []kafkago.Message
 	mock.Mock
 }
 
 var fakeRecord = []byte(`{"Bytes":20801,"DstAddr":"10.130.2.1","DstPort":36936,"Packets":401,"SrcAddr":"10.130.2.13","SrcPort":3100}`)
 
-// ReadMessage runs in the kafka client thread, which blocks until data is available.
+// FetchMessage runs in the kafka client thread, which blocks until data is available.
 // If data is always available, we have an infinite loop. So we return data only a specified number of time.
-func (f *fakeKafkaReader) ReadMessage(_ context.Context) (kafkago.Message, error) {
+func (f *fakeKafkaReader) FetchMessage(_ context.Context) (kafkago.Message, error) {
 	if f.readToDo == 0 {
-		// block indefinitely
-		c := make(chan struct{})
-		<-c
+		// block until closed
+		if f.closed == nil {
+			f.closed = make(chan struct{})
+		}
+		<-f.closed
+		return kafkago.Message{}, io.EOF
 	}
 	message := kafkago.Message{
-		Topic: "topic1",
-		Value: fakeRecord,
+		Topic:  "topic1",
+		Value:  fakeRecord,
+		Offset: int64(f.readToDo),
 	}
 	f.readToDo--
 	return message, nil
 }
 
+func (f *fakeKafkaReader) CommitMessages(_ context.Context, msgs ...kafkago.Message) error {
+	f.committed = append(f.committed, msgs...)
+	return nil
+}
+
 func (f *fakeKafkaReader) Config() kafkago.ReaderConfig {
 	return kafkago.ReaderConfig{}
 }
@@ -184,12 +200,18 @@ func (f *fakeKafkaReader) Stats() kafkago.ReaderStats {
 	return kafkago.ReaderStats{}
 }
 
+func (f *fakeKafkaReader) Close() error {
+	f.Called()
+	close(f.closed)
+	return nil
+}
+
 func Test_KafkaListener(t *testing.T) {
 	ingestOutput := make(chan config.GenericMap)
 	newIngest := initNewIngestKafka(t, testConfig1)
 	ingestKafka := newIngest.(*ingestKafka)
 
-	// change the ReadMessage function to the mock-up
+	// change the FetchMessage function to the mock-up
 	fr := fakeKafkaReader{readToDo: 1}
 	ingestKafka.kafkaReader = &fr
 
@@ -209,6 +231,147 @@ func Test_KafkaListener(t *testing.T) {
 	require.Equal(t, test.DeserializeJSONToMap(t, string(fakeRecord)), receivedEntry)
 }
 
+func Test_KafkaCommitOnExit(t *testing.T) {
+	ingestOutput := make(chan config.GenericMap)
+	newIngest := initNewIngestKafka(t, testConfig1)
+	ingestKafka := newIngest.(*ingestKafka)
+	require.NotNil(t, ingestKafka.lagReporter)
+
+	fr := fakeKafkaReader{readToDo: 1, closed: make(chan struct{})}
+	fr.On("Close").Return()
+	ingestKafka.kafkaReader = &fr
+	exitChan := make(chan struct{})
+	ingestKafka.exitChan = exitChan
+	done := make(chan struct{})
+	go func() {
+		ingestKafka.Ingest(ingestOutput)
+		close(done)
+	}()
+	_, err := test.WaitFromChannel(ingestOutput, 2*time.Second)
+	require.NoError(t, err)
+
+	// closing the reader commits the pending offsets
+	close(exitChan)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		require.Fail(t, "ingester did not exit")
+	}
+	fr.AssertNumberOfCalls(t, "Close", 1)
+	// the message was committed once processed
+	require.Len(t, fr.committed, 1)
+}
+
+func Test_KafkaCommitAfterProcessing(t *testing.T) {
+	ingestOutput := make(chan config.GenericMap)
+	newIngest := initNewIngestKafka(t, testConfig1)
+	ingestKafka := newIngest.(*ingestKafka)
+	fr := fakeKafkaReader{}
+	ingestKafka.kafkaReader = &fr
+
+	// the offset is committed after the message is sent down the pipeline
+	processed := make(chan struct{})
+	go func() {
+		ingestKafka.processMessage(&kafkago.Message{Value: fakeRecord, Offset: 3}, ingestOutput)
+		close(processed)
+	}()
+	_, err := test.WaitFromChannel(ingestOutput, 2*time.Second)
+	require.NoError(t, err)
+	<-processed
+	require.Equal(t, []int64{3}, offsets(fr.committed))
+
+	// empty messages aren't sent, but are committed
+	ingestKafka.processMessage(&kafkago.Message{Offset: 4}, ingestOutput)
+	require.Equal(t, []int64{3, 4}, offsets(fr.committed))
+
+	// without consumer group, there is nothing to commit
+	ingestKafka.commit = false
+	ingestKafka.processMessage(&kafkago.Message{Offset: 5}, ingestOutput)
+	require.Equal(t, []int64{3, 4}, offsets(fr.committed))
+}
+
+func offsets(msgs []kafkago.Message) []int64 {
+	var res []int64
+	for i := range msgs {
+		res = append(res, msgs[i].Offset)
+	}
+	return res
+}
+
+type fakeOffsetsClient struct {
+	committed map[int]int64
+	latest    map[int]int64
+}
+
+func (f *fakeOffsetsClient) Metadata(_ context.Context, req *kafkago.MetadataRequest) (*kafkago.MetadataResponse, error) {
+	topic := kafkago.Topic{Name: req.Topics[0]}
+	for p := range f.latest {
+		topic.Partitions = append(topic.Partitions, kafkago.Partition{Topic: topic.Name, ID: p})
+	}
+	return &kafkago.MetadataResponse{Topics: []kafkago.Topic{topic}}, nil
+}
+
+func (f *fakeOffsetsClient) OffsetFetch(_ context.Context, req *kafkago.OffsetFetchRequest) (*kafkago.OffsetFetchResponse, error) {
+	resp := kafkago.OffsetFetchResponse{Topics: map[string][]kafkago.OffsetFetchPartition{}}
+	for topic, partitions := range req.Topics {
+		for _, p := range partitions {
+			committed, ok := f.committed[p]
+			if !ok {
+				committed = -1
+			}
+			resp.Topics[topic] = append(resp.Topics[topic], kafkago.OffsetFetchPartition{Partition: p, CommittedOffset: committed})
+		}
+	}
+	return &resp, nil
+}
+
+func (f *fakeOffsetsClient) ListOffsets(_ context.Context, req *kafkago.ListOffsetsRequest) (*kafkago.ListOffsetsResponse, error) {
+	resp := kafkago.ListOffsetsResponse{Topics: map[string][]kafkago.PartitionOffsets{}}
+	for topic, requests := range req.Topics {
+		for _, r := range requests {
+			resp.Topics[topic] = append(resp.Topics[topic], kafkago.PartitionOffsets{Partition: r.Partition, LastOffset: f.latest[r.Partition]})
+		}
+	}
+	return &resp, nil
+}
+
+func Test_KafkaLag(t *testing.T) {
+	test.ResetPromRegistry()
+	client := &fakeOffsetsClient{
+		committed: map[int]int64{0: 90, 1: 200},
+		// partition 2 has no committed offset yet
+		latest: map[int]int64{0: 100, 1: 200, 2: 50},
+	}
+	reporter := newKafkaLagReporter(operational.NewMetrics(&config.MetricsSettings{}), "ingest1", "topic1", "group1", time.Second, client)
+	require.NoError(t, reporter.report())
+
+	lag := func(partition string) float64 {
+		var m dto.Metric
+		require.NoError(t, reporter.lag.WithLabelValues("ingest1", "topic1", partition).Write(&m))
+		return m.GetGauge().GetValue()
+	}
+	require.Equal(t, float64(10), lag("0"))
+	require.Equal(t, float64(0), lag("1"))
+	// partition 2 isn't reported
+	metrics := make(chan prometheus.Metric, 10)
+	reporter.lag.Collect(metrics)
+	require.Len(t, metrics, 2)
+}
+
+func Test_KafkaLagError(t *testing.T) {
+	test.ResetPromRegistry()
+	reporter := newKafkaLagReporter(operational.NewMetrics(&config.MetricsSettings{}), "ingest1", "topic1", "group1", time.Second, &failingOffsetsClient{})
+	require.ErrorContains(t, reporter.report(), "broker unavailable")
+}
+
+type failingOffsetsClient struct {
+	fakeOffsetsClient
+}
+
+func (f *failingOffsetsClient) Metadata(_ context.Context, _ *kafkago.MetadataRequest) (*kafkago.MetadataResponse, error) {
+	return nil, errors.New("broker unavailable")
+}
+
 func Test_TLSConfigEmpty(t *testing.T) {
 	test.ResetPromRegistry()
 	stage := config.NewKafkaPipeline("ingest-kafka", api.IngestKafka{
@@ -269,3 +432,64 @@ func Test_MutualTLSConfig(t *testing.T) {
 	require.NotNil(t, tlsConfig.RootCAs)
 	require.Len(t, tlsConfig.RootCAs.Subjects(), 1) //nolint:staticcheck
 }
+
+func Test_SASLConfig(t *testing.T) {
+	secret, cleanup, err := test.DumpToTemp("s3cr3t\n")
+	require.NoError(t, err)
+	defer cleanup()
+	newStage := func(cfg *api.SASLConfig) config.StageParam {
+		stage := config.NewKafkaPipeline("ingest-kafka", api.IngestKafka{
+			Brokers: []string{"any"},
+			Topic:   "topic",
+			Decoder: api.Decoder{Type: "json"},
+			SASL:    cfg,
+		})
+		return stage.GetStageParams()[0]
+	}
+
+	test.ResetPromRegistry()
+	newIngest, err := NewIngestKafka(operational.NewMetrics(&config.MetricsSettings{}), newStage(&api.SASLConfig{
+		Type:             api.SASLScramSHA256,
+		Username:         "flp",
+		ClientSecretPath: secret,
+	}))
+	require.NoError(t, err)
+	mechanism := newIngest.(*ingestKafka).kafkaReader.Config().Dialer.SASLMechanism
+	require.Equal(t, "SCRAM-SHA-256", mechanism.Name())
+
+	for _, cfg := range []*api.SASLConfig{
+		{Type: "oauth", Username: "flp", ClientSecretPath: secret},
+		{Type: api.SASLPlain, ClientSecretPath: secret},
+		{Type: api.SASLPlain, Username: "flp"},
+		{Type: api.SASLPlain, Username: "flp", ClientSecretPath: "/does/not/exist"},
+	} {
+		test.ResetPromRegistry()
+		_, err = NewIngestKafka(operational.NewMetrics(&config.MetricsSettings{}), newStage(cfg))
+		require.Error(t, err, "%+v", cfg)
+	}
+}
+
+type brokersKafkaReader struct {
+	fakeKafkaReader
+	brokers []string
+}
+
+func (f *brokersKafkaReader) Config() kafkago.ReaderConfig {
+	return kafkago.ReaderConfig{Brokers: f.brokers}
+}
+
+func Test_KafkaReady(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	reachable := listener.Addr().String()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := closed.Addr().String()
+	require.NoError(t, closed.Close())
+
+	ingester := &ingestKafka{kafkaReader: &brokersKafkaReader{brokers: []string{unreachable, reachable}}}
+	require.NoError(t, ingester.Ready())
+
+	require.NoError(t, listener.Close())
+	require.Error(t, ingester.Ready())
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	 http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	pUtils "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/netsampler/goflow2/decoders/sflow"
+	"github.com/netsampler/goflow2/producer"
+	"github.com/netsampler/goflow2/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sFlowRecordTypeField    = "_RecordType"
+	sFlowCountersRecordType = "counters"
+)
+
+var (
+	sFlowSamplesReceived = operational.DefineMetric(
+		"ingest_sflow_samples_received",
+		"Number of sFlow samples received, per sample type",
+		operational.TypeCounter,
+		"stage", "type",
+	)
+	sFlowDecodeErrors = operational.DefineMetric(
+		"ingest_sflow_decode_errors_total",
+		"Number of sFlow datagrams that could not be decoded, per error",
+		operational.TypeCounter,
+		"stage", "error",
+	)
+)
+
+type ingestSFlow struct {
+	hostname          string
+	port              int
+	forwardCounters   bool
+	applySamplingRate bool
+	in                chan map[string]interface{}
+	exitChan          <-chan struct{}
+	metrics           *metrics
+	flowSamples       prometheus.Counter
+	counterSamples    prometheus.Counter
+	invalidDatagrams  prometheus.Counter
+	unexpectedMsgs    prometheus.Counter
+	invalidSamples    prometheus.Counter
+	limiter           *rateLimiter
+}
+
+// Ingest ingests sFlow v5 datagrams, decoded using goflow2 library (https://github.com/netsampler/goflow2)
+func (s *ingestSFlow) Ingest(out chan<- config.GenericMap) {
+	s.metrics.createOutQueueLen(out)
+
+	go func() {
+		log.Infof("listening for sflow on host %s, port = %d", s.hostname, s.port)
+		err := utils.UDPStoppableRoutine(s.exitChan, "sFlow", s.decode, 1, s.hostname, s.port, false, log.StandardLogger())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	for {
+		select {
+		case <-s.exitChan:
+			log.Debugf("exiting ingestSFlow because of signal")
+			return
+		case record := <-s.in:
+			out <- record
+		}
+	}
+}
+
+func (s *ingestSFlow) decode(msg interface{}) error {
+	pkt := msg.(utils.BaseMessage)
+	msgDec, err := sflow.DecodeMessage(bytes.NewBuffer(pkt.Payload))
+	if err != nil {
+		s.metrics.error("Cannot decode sFlow datagram")
+		s.invalidDatagrams.Inc()
+		log.WithError(err).Debugf("cannot decode sFlow datagram from %s", pkt.Src)
+		return err
+	}
+	packet, ok := msgDec.(sflow.Packet)
+	if !ok {
+		s.metrics.error("Unexpected sFlow message")
+		s.unexpectedMsgs.Inc()
+		return fmt.Errorf("unexpected sFlow message type %T", msgDec)
+	}
+	ts := uint64(time.Now().Unix())
+
+	flowMessages, err := producer.ProcessMessageSFlow(packet)
+	if err != nil {
+		s.metrics.error("Cannot process sFlow samples")
+		s.invalidSamples.Inc()
+		return err
+	}
+	source := pkt.Src.String()
+	for _, fmsg := range flowMessages {
+		if !s.limiter.allow(source) {
+			continue
+		}
+		fmsg.TimeReceived = ts
+		fmsg.TimeFlowStart = ts
+		fmsg.TimeFlowEnd = ts
+		if s.applySamplingRate && fmsg.SamplingRate > 1 {
+			fmsg.Bytes *= fmsg.SamplingRate
+			fmsg.Packets *= fmsg.SamplingRate
+		}
+		record, err := RenderMessage(fmsg)
+		if err != nil {
+			s.metrics.error("Cannot render sFlow message")
+			continue
+		}
+		s.metrics.flowsProcessed.Inc()
+		s.in <- record
+	}
+
+	for _, sample := range packet.Samples {
+		switch sample := sample.(type) {
+		case sflow.FlowSample, sflow.ExpandedFlowSample:
+			s.flowSamples.Inc()
+		case sflow.CounterSample:
+			s.counterSamples.Inc()
+			if s.forwardCounters {
+				for _, record := range renderCounterSample(&sample, packet.AgentIP, ts) {
+					s.in <- record
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func renderCounterSample(sample *sflow.CounterSample, agentIP net.IP, ts uint64) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, rec := range sample.Records {
+		// only generic interface counters are supported
+		if counters, ok := rec.Data.(sflow.IfCounters); ok {
+			records = append(records, map[string]interface{}{
+				sFlowRecordTypeField: sFlowCountersRecordType,
+				"SamplerAddress":     agentIP.String(),
+				"TimeReceived":       ts,
+				"IfIndex":            counters.IfIndex,
+				"IfType":             counters.IfType,
+				"IfSpeed":            counters.IfSpeed,
+				"IfDirection":        counters.IfDirection,
+				"IfStatus":           counters.IfStatus,
+				"IfInOctets":         counters.IfInOctets,
+				"IfInUcastPkts":      counters.IfInUcastPkts,
+				"IfInDiscards":       counters.IfInDiscards,
+				"IfInErrors":         counters.IfInErrors,
+				"IfOutOctets":        counters.IfOutOctets,
+				"IfOutUcastPkts":     counters.IfOutUcastPkts,
+				"IfOutDiscards":      counters.IfOutDiscards,
+				"IfOutErrors":        counters.IfOutErrors,
+			})
+		}
+	}
+	return records
+}
+
+// NewIngestSFlow create a new sFlow ingester
+func NewIngestSFlow(opMetrics *operational.Metrics, params config.StageParam) (Ingester, error) {
+	cfg := api.IngestSFlow{}
+	if params.Ingest != nil && params.Ingest.SFlow != nil {
+		cfg = *params.Ingest.SFlow
+	}
+	if cfg.HostName == "" {
+		return nil, fmt.Errorf("ingest hostname not specified")
+	}
+	if cfg.Port == 0 {
+		return nil, fmt.Errorf("no ingest port specified")
+	}
+
+	log.Infof("hostname = %s", cfg.HostName)
+	log.Infof("port = %d", cfg.Port)
+
+	in := make(chan map[string]interface{}, channelSize)
+	metrics := newMetrics(opMetrics, params.Name, params.Ingest.Type, func() int { return len(in) })
+
+	return &ingestSFlow{
+		hostname:          cfg.HostName,
+		port:              cfg.Port,
+		forwardCounters:   cfg.ForwardCounters,
+		applySamplingRate: cfg.ApplySamplingRate,
+		exitChan:          pUtils.ExitChannel(),
+		in:                in,
+		metrics:           metrics,
+		flowSamples:       opMetrics.NewCounter(&sFlowSamplesReceived, params.Name, "flow"),
+		counterSamples:    opMetrics.NewCounter(&sFlowSamplesReceived, params.Name, "counter"),
+		invalidDatagrams:  opMetrics.NewCounter(&sFlowDecodeErrors, params.Name, "invalid_datagram"),
+		unexpectedMsgs:    opMetrics.NewCounter(&sFlowDecodeErrors, params.Name, "unexpected_message"),
+		invalidSamples:    opMetrics.NewCounter(&sFlowDecodeErrors, params.Name, "invalid_samples"),
+		limiter:           newRateLimiter(opMetrics, params.Name, params.Ingest.RateLimit),
+	}, nil
+}
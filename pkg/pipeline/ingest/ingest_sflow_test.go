@@ -0,0 +1,202 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/netsampler/goflow2/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestSFlow(t *testing.T) {
+	port, err := test.UDPPort()
+	require.NoError(t, err)
+	stage := config.NewSFlowPipeline("ingest-sflow", api.IngestSFlow{
+		HostName:        "0.0.0.0",
+		Port:            port,
+		ForwardCounters: true,
+	})
+	ingester, err := NewIngestSFlow(operational.NewMetrics(&config.MetricsSettings{}), stage.GetStageParams()[0])
+	require.NoError(t, err)
+	forwarded := make(chan config.GenericMap)
+
+	// GIVEN an sFlow Ingester
+	go ingester.Ingest(forwarded)
+
+	client, err := test.NewSFlowClient(port, "10.0.0.1")
+	require.NoError(t, err)
+
+	// WHEN a flow sample is sent
+	flow := waitForSFlowRecord(t, forwarded, "", func() error {
+		return client.SendFlow("1.2.3.4", "5.6.7.8", 1234, 443, 6, 1500, 512)
+	})
+
+	// THEN it is forwarded with the same fields as goflow2 NetFlow / IPFIX ingest
+	assert.Equal(t, "1.2.3.4", flow["SrcAddr"])
+	assert.Equal(t, "5.6.7.8", flow["DstAddr"])
+	assert.EqualValues(t, 1234, flow["SrcPort"])
+	assert.EqualValues(t, 443, flow["DstPort"])
+	assert.EqualValues(t, 6, flow["Proto"])
+	assert.EqualValues(t, 1500, flow["Bytes"])
+	assert.EqualValues(t, 1, flow["Packets"])
+	assert.EqualValues(t, 512, flow["SamplingRate"])
+	assert.NotContains(t, flow, "_RecordType")
+
+	// WHEN a counter sample is sent
+	counters := waitForSFlowRecord(t, forwarded, "counters", func() error {
+		return client.SendCounters(3, 123456, 654321)
+	})
+
+	// THEN it is forwarded as a counters record
+	assert.Equal(t, "counters", counters["_RecordType"])
+	assert.Equal(t, "10.0.0.1", counters["SamplerAddress"])
+	assert.EqualValues(t, 3, counters["IfIndex"])
+	assert.EqualValues(t, 123456, counters["IfInOctets"])
+	assert.EqualValues(t, 654321, counters["IfOutOctets"])
+}
+
+func TestIngestSFlow_DiscardCounters(t *testing.T) {
+	port, err := test.UDPPort()
+	require.NoError(t, err)
+	stage := config.NewSFlowPipeline("ingest-sflow-nocounters", api.IngestSFlow{
+		HostName: "0.0.0.0",
+		Port:     port,
+	})
+	ingester, err := NewIngestSFlow(operational.NewMetrics(&config.MetricsSettings{}), stage.GetStageParams()[0])
+	require.NoError(t, err)
+	forwarded := make(chan config.GenericMap)
+	go ingester.Ingest(forwarded)
+
+	client, err := test.NewSFlowClient(port, "10.0.0.1")
+	require.NoError(t, err)
+
+	// Wait for the ingester to be ready
+	waitForSFlowRecord(t, forwarded, "", func() error {
+		return client.SendFlow("1.2.3.4", "5.6.7.8", 1234, 443, 6, 1500, 512)
+	})
+
+	// Counters and flows are interleaved: only flows must be forwarded
+	for i := 0; i < 3; i++ {
+		require.NoError(t, client.SendCounters(3, 123456, 654321))
+		require.NoError(t, client.SendFlow("1.2.3.4", "5.6.7.8", 1234, 443, 6, 1500, 512))
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case flow := <-forwarded:
+			assert.NotContains(t, flow, "_RecordType")
+			assert.Equal(t, "1.2.3.4", flow["SrcAddr"])
+		case <-time.After(timeout):
+			require.Fail(t, "error waiting for ingester to forward received data")
+		}
+	}
+}
+
+func TestIngestSFlow_ApplySamplingRate(t *testing.T) {
+	port, err := test.UDPPort()
+	require.NoError(t, err)
+	stage := config.NewSFlowPipeline("ingest-sflow-sampling", api.IngestSFlow{
+		HostName:          "0.0.0.0",
+		Port:              port,
+		ApplySamplingRate: true,
+	})
+	ingester, err := NewIngestSFlow(operational.NewMetrics(&config.MetricsSettings{}), stage.GetStageParams()[0])
+	require.NoError(t, err)
+	forwarded := make(chan config.GenericMap)
+	go ingester.Ingest(forwarded)
+
+	client, err := test.NewSFlowClient(port, "10.0.0.1")
+	require.NoError(t, err)
+
+	// the sampled packet stands for 512 packets
+	flow := waitForSFlowRecord(t, forwarded, "", func() error {
+		return client.SendFlow("1.2.3.4", "5.6.7.8", 1234, 443, 6, 1500, 512)
+	})
+	assert.EqualValues(t, 1500*512, flow["Bytes"])
+	assert.EqualValues(t, 512, flow["Packets"])
+	assert.EqualValues(t, 512, flow["SamplingRate"])
+}
+
+func TestIngestSFlow_MetricsPerStage(t *testing.T) {
+	// GIVEN two sFlow ingesters
+	var ingesters []*ingestSFlow
+	for _, name := range []string{"ingest-sflow-a", "ingest-sflow-b"} {
+		port, err := test.UDPPort()
+		require.NoError(t, err)
+		stage := config.NewSFlowPipeline(name, api.IngestSFlow{HostName: "0.0.0.0", Port: port})
+		ingester, err := NewIngestSFlow(operational.NewMetrics(&config.MetricsSettings{}), stage.GetStageParams()[0])
+		require.NoError(t, err)
+		forwarded := make(chan config.GenericMap)
+		go ingester.Ingest(forwarded)
+		client, err := test.NewSFlowClient(port, "10.0.0.1")
+		require.NoError(t, err)
+
+		// WHEN each receives a flow sample
+		waitForSFlowRecord(t, forwarded, "", func() error {
+			return client.SendFlow("1.2.3.4", "5.6.7.8", 1234, 443, 6, 1500, 512)
+		})
+		ingesters = append(ingesters, ingester.(*ingestSFlow))
+	}
+	// AND the second one a malformed datagram
+	require.Error(t, ingesters[1].decode(utils.BaseMessage{Src: net.ParseIP("10.0.0.1"), Payload: []byte{0, 0, 0, 5, 1}}))
+
+	// THEN the samples of both stages are counted, and the decode error of the second one
+	exposed := test.ReadExposedMetrics(t, prometheus.DefaultGatherer)
+	require.Regexp(t, `ingest_sflow_samples_received\{stage="ingest-sflow-a",type="flow"\} [1-9]`, exposed)
+	require.Regexp(t, `ingest_sflow_samples_received\{stage="ingest-sflow-b",type="flow"\} [1-9]`, exposed)
+	require.Contains(t, exposed, `ingest_sflow_decode_errors_total{error="invalid_datagram",stage="ingest-sflow-b"} 1`)
+	require.Contains(t, exposed, `ingest_sflow_decode_errors_total{error="invalid_datagram",stage="ingest-sflow-a"} 0`)
+}
+
+func TestNewIngestSFlow_Errors(t *testing.T) {
+	opMetrics := operational.NewMetrics(&config.MetricsSettings{})
+	_, err := NewIngestSFlow(opMetrics, config.NewSFlowParams("no-host", api.IngestSFlow{Port: 6343}))
+	require.Error(t, err)
+	_, err = NewIngestSFlow(opMetrics, config.NewSFlowParams("no-port", api.IngestSFlow{HostName: "0.0.0.0"}))
+	require.Error(t, err)
+}
+
+// The client might send information before the Ingester is actually listening,
+// so we might need to repeat the submission until the ingest starts forwarding records of the expected type
+func waitForSFlowRecord(t *testing.T, forwarded chan config.GenericMap, recordType string, send func() error) config.GenericMap {
+	start := time.Now()
+	for {
+		if send() == nil {
+			select {
+			case received := <-forwarded:
+				// ignore records left over from previous submissions
+				if received["_RecordType"] == nil && recordType == "" || received["_RecordType"] == recordType {
+					return received
+				}
+			case <-time.After(50 * time.Millisecond):
+				// nothing yet received
+			}
+		}
+		if time.Since(start) > timeout {
+			require.Fail(t, "error waiting for ingester to forward received data")
+		}
+	}
+}
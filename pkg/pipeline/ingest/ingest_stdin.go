@@ -43,6 +43,11 @@ type ingestStdin struct {
 	decoder  decode.Decoder
 }
 
+// Reload reads the definitions of the decoder again
+func (s *ingestStdin) Reload() error {
+	return reloadDecoder(s.decoder)
+}
+
 // Ingest ingests entries from stdin
 func (s *ingestStdin) Ingest(out chan<- config.GenericMap) {
 	slog.Debugf("entering ingestStdin.Ingest")
@@ -103,7 +108,7 @@ func NewIngestStdin(opMetrics *operational.Metrics, params config.StageParam) (I
 	eof := make(chan struct{})
 	metrics := newMetrics(opMetrics, params.Name, params.Ingest.Type, func() int { return len(in) })
 	decoderParams := api.Decoder{Type: api.DecoderJSON}
-	decoder, err := decode.GetDecoder(decoderParams)
+	decoder, err := decode.GetDecoder(opMetrics, params.Name, decoderParams)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netsampler/goflow2/decoders/netflow"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	orphansDroppedCounter = operational.DefineMetric(
+		"netflow_orphan_datagrams_dropped_total",
+		"Number of NetFlow v9 / IPFIX datagrams dropped because the template of their data records wasn't received in time",
+		operational.TypeCounter,
+		"stage",
+	)
+	orphansReprocessedCounter = operational.DefineMetric(
+		"netflow_orphan_flows_reprocessed_total",
+		"Number of NetFlow v9 / IPFIX flows decoded once the template of their data records was received",
+		operational.TypeCounter,
+		"stage",
+	)
+)
+
+type templateKey struct {
+	source      string
+	version     uint16
+	obsDomainID uint32
+	templateID  uint16
+}
+
+type versionedTemplate struct {
+	template interface{}
+	version  int
+}
+
+// netFlowTemplates stores the NetFlow v9 / IPFIX templates of each exporter. When an exporter redefines a template ID
+// with a different field layout, e.g. after a restart, the template gets a new version.
+type netFlowTemplates struct {
+	lock      sync.RWMutex
+	templates map[templateKey]versionedTemplate
+}
+
+func newNetFlowTemplates() *netFlowTemplates {
+	return &netFlowTemplates{templates: map[templateKey]versionedTemplate{}}
+}
+
+// add stores the template, and returns false when it was already known with the same layout
+func (t *netFlowTemplates) add(key templateKey, template interface{}) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	current, ok := t.templates[key]
+	if ok && reflect.DeepEqual(current.template, template) {
+		return false
+	}
+	next := versionedTemplate{template: template}
+	if ok {
+		next.version = current.version + 1
+		log.Infof("template %d of exporter %s, domain %d redefined with a different layout (version %d)",
+			key.templateID, key.source, key.obsDomainID, next.version)
+	}
+	t.templates[key] = next
+	return true
+}
+
+func (t *netFlowTemplates) removeSource(source string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for key := range t.templates {
+		if key.source == source {
+			delete(t.templates, key)
+		}
+	}
+}
+
+func (t *netFlowTemplates) get(key templateKey) (interface{}, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	current, ok := t.templates[key]
+	return current.template, ok
+}
+
+// exporterTemplates implements the goflow2 NetFlowTemplateSystem for the datagrams of an exporter.
+// It keeps track of the templates received and of the missing one, if any.
+type exporterTemplates struct {
+	store  *netFlowTemplates
+	source string
+	// local holds the templates defined by a reprocessed datagram: they are only used to decode it,
+	// since more recent templates may have been received meanwhile
+	local   map[templateKey]interface{}
+	added   []templateKey
+	missing templateKey
+}
+
+func (e *exporterTemplates) GetTemplate(version uint16, obsDomainID uint32, templateID uint16) (interface{}, error) {
+	key := templateKey{source: e.source, version: version, obsDomainID: obsDomainID, templateID: templateID}
+	if template, ok := e.local[key]; ok {
+		return template, nil
+	}
+	if template, ok := e.store.get(key); ok {
+		return template, nil
+	}
+	e.missing = key
+	return nil, netflow.NewErrorTemplateNotFound(version, obsDomainID, templateID, "info")
+}
+
+func (e *exporterTemplates) AddTemplate(version uint16, obsDomainID uint32, template interface{}) {
+	key := templateKey{source: e.source, version: version, obsDomainID: obsDomainID}
+	switch t := template.(type) {
+	case netflow.TemplateRecord:
+		key.templateID = t.TemplateId
+	case netflow.NFv9OptionsTemplateRecord:
+		key.templateID = t.TemplateId
+	case netflow.IPFIXOptionsTemplateRecord:
+		key.templateID = t.TemplateId
+	}
+	if e.local != nil {
+		e.local[key] = template
+		if _, ok := e.store.get(key); ok {
+			return
+		}
+	}
+	if e.store.add(key, template) {
+		e.added = append(e.added, key)
+	}
+}
+
+type orphanDatagram struct {
+	source   string
+	payload  []byte
+	missing  templateKey
+	received time.Time
+}
+
+// orphanDatagrams buffers the datagrams containing data records whose template is unknown, until the template
+// is received or the timeout expires. Datagrams are kept in reception order.
+type orphanDatagrams struct {
+	lock        sync.Mutex
+	timeout     time.Duration
+	max         int
+	datagrams   []orphanDatagram
+	dropped     prometheus.Counter
+	reprocessed prometheus.Counter
+}
+
+func newOrphanDatagrams(opMetrics *operational.Metrics, stage string, timeout time.Duration, maxDatagrams int) *orphanDatagrams {
+	return &orphanDatagrams{
+		timeout:     timeout,
+		max:         maxDatagrams,
+		dropped:     opMetrics.NewCounter(&orphansDroppedCounter, stage),
+		reprocessed: opMetrics.NewCounter(&orphansReprocessedCounter, stage),
+	}
+}
+
+// add buffers the datagram; it is dropped when buffering is disabled or the buffer is full
+func (o *orphanDatagrams) add(datagram orphanDatagram) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.timeout <= 0 || len(o.datagrams) >= o.max {
+		o.dropped.Inc()
+		return
+	}
+	// a datagram waiting for another template after being reprocessed keeps its reception time
+	i := len(o.datagrams)
+	for i > 0 && o.datagrams[i-1].received.After(datagram.received) {
+		i--
+	}
+	o.datagrams = append(o.datagrams, orphanDatagram{})
+	copy(o.datagrams[i+1:], o.datagrams[i:])
+	o.datagrams[i] = datagram
+}
+
+// expire drops the datagrams buffered for longer than the timeout
+func (o *orphanDatagrams) expire(now time.Time) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	expired := 0
+	for expired < len(o.datagrams) && now.Sub(o.datagrams[expired].received) > o.timeout {
+		expired++
+	}
+	if expired > 0 {
+		log.Debugf("dropping %d NetFlow datagrams whose template wasn't received in time", expired)
+		o.dropped.Add(float64(expired))
+		o.datagrams = o.datagrams[expired:]
+	}
+}
+
+// take removes and returns the datagrams waiting for one of the templates
+func (o *orphanDatagrams) take(templates []templateKey) []orphanDatagram {
+	if len(templates) == 0 {
+		return nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var taken []orphanDatagram
+	kept := o.datagrams[:0]
+	for _, d := range o.datagrams {
+		waiting := false
+		for _, t := range templates {
+			if d.missing == t {
+				waiting = true
+				break
+			}
+		}
+		if waiting {
+			taken = append(taken, d)
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	o.datagrams = kept
+	return taken
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/netsampler/goflow2/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware/go-ipfix/pkg/entities"
+)
+
+var exporterIP = net.ParseIP("10.0.0.1")
+
+func newTestCollector(t *testing.T, cfg api.IngestCollector) *ingestCollector {
+	cfg.HostName = "0.0.0.0"
+	cfg.Port = 1
+	return newTestCollectorFromStage(t, config.NewCollectorPipeline("ingest-ipfix", cfg))
+}
+
+func newTestCollectorFromStage(t *testing.T, stage config.PipelineBuilderStage) *ingestCollector {
+	ic, err := NewIngestCollector(operational.NewMetrics(&config.MetricsSettings{}), stage.GetStageParams()[0])
+	require.NoError(t, err)
+	return ic.(*ingestCollector)
+}
+
+func receiveTemplate(t *testing.T, c *ingestCollector, client *test.IPFIXClient) {
+	payload, err := client.TemplateMessage()
+	require.NoError(t, err)
+	require.NoError(t, c.decodeNetFlow(utils.BaseMessage{Src: exporterIP, Payload: payload}))
+}
+
+func receiveFlow(t *testing.T, c *ingestCollector, client *test.IPFIXClient, timestamp uint32, srcIP string) {
+	payload, err := client.FlowMessage(timestamp, srcIP)
+	require.NoError(t, err)
+	require.NoError(t, c.decodeNetFlow(utils.BaseMessage{Src: exporterIP, Payload: payload}))
+}
+
+func counter(t *testing.T, c prometheus.Counter) float64 {
+	var m dto.Metric
+	require.NoError(t, c.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func TestOrphanDatagramReprocessed(t *testing.T) {
+	c := newTestCollector(t, api.IngestCollector{})
+	client := &test.IPFIXClient{}
+
+	// the data record is received before its template: it's decoded once the template is received
+	receiveFlow(t, c, client, 12345678, "1.2.3.4")
+	require.Empty(t, c.in)
+	receiveTemplate(t, c, client)
+	require.Len(t, c.in, 1)
+	flow := <-c.in
+	assert.Equal(t, "1.2.3.4", flow["SrcAddr"])
+	assert.EqualValues(t, 12345678, flow["TimeFlowStart"])
+	assert.Equal(t, float64(1), counter(t, c.orphans.reprocessed))
+	assert.Equal(t, float64(0), counter(t, c.orphans.dropped))
+
+	// the template is now known
+	receiveFlow(t, c, client, 12345679, "1.2.3.5")
+	require.Len(t, c.in, 1)
+	assert.Equal(t, "1.2.3.5", (<-c.in)["SrcAddr"])
+	assert.Equal(t, float64(1), counter(t, c.orphans.reprocessed))
+}
+
+func TestOrphanDatagramExpired(t *testing.T) {
+	c := newTestCollector(t, api.IngestCollector{OrphanTimeout: &api.Duration{Duration: 10 * time.Millisecond}})
+	client := &test.IPFIXClient{}
+
+	receiveFlow(t, c, client, 12345678, "1.2.3.4")
+	time.Sleep(20 * time.Millisecond)
+	receiveTemplate(t, c, client)
+	require.Empty(t, c.in)
+	assert.Equal(t, float64(1), counter(t, c.orphans.dropped))
+	assert.Equal(t, float64(0), counter(t, c.orphans.reprocessed))
+}
+
+func TestOrphanDatagramBufferDisabledOrFull(t *testing.T) {
+	client := &test.IPFIXClient{}
+
+	c := newTestCollector(t, api.IngestCollector{OrphanTimeout: &api.Duration{}})
+	receiveFlow(t, c, client, 12345678, "1.2.3.4")
+	assert.Equal(t, float64(1), counter(t, c.orphans.dropped))
+
+	c = newTestCollector(t, api.IngestCollector{MaxOrphanDatagrams: 1})
+	receiveFlow(t, c, client, 12345678, "1.2.3.4")
+	receiveFlow(t, c, client, 12345679, "1.2.3.5")
+	assert.Equal(t, float64(1), counter(t, c.orphans.dropped))
+	receiveTemplate(t, c, client)
+	require.Len(t, c.in, 1)
+	assert.Equal(t, "1.2.3.4", (<-c.in)["SrcAddr"])
+}
+
+func TestTemplateRedefined(t *testing.T) {
+	c := newTestCollector(t, api.IngestCollector{
+		EnterpriseElements: []api.EnterpriseElement{{PEN: 32473, ID: 1, Name: "AppID"}},
+	})
+	client := &test.IPFIXClient{}
+	receiveTemplate(t, c, client)
+	receiveFlow(t, c, client, 12345678, "1.2.3.4")
+	require.Len(t, c.in, 1)
+	assert.NotContains(t, <-c.in, "AppID")
+
+	// refreshing the template with the same layout doesn't create a new version
+	receiveTemplate(t, c, client)
+	key := templateKey{source: exporterIP.String(), version: 10, obsDomainID: 1, templateID: 256}
+	assert.Equal(t, 0, c.templates.templates[key].version)
+
+	// the exporter restarts, and reuses the template ID with another layout
+	client.EnterpriseElements = []entities.InfoElementWithValue{
+		entities.NewUnsigned32InfoElement(entities.NewInfoElement("appId", 1, entities.Unsigned32, 32473, 4), 42),
+	}
+	receiveTemplate(t, c, client)
+	assert.Equal(t, 1, c.templates.templates[key].version)
+	receiveFlow(t, c, client, 12345679, "1.2.3.5")
+	require.Len(t, c.in, 1)
+	flow := <-c.in
+	assert.Equal(t, "1.2.3.5", flow["SrcAddr"])
+	assert.Equal(t, uint64(42), flow["AppID"])
+
+	// templates are defined per exporter
+	_, ok := c.templates.get(templateKey{source: "10.0.0.2", version: 10, obsDomainID: 1, templateID: 256})
+	assert.False(t, ok)
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+var rateLimitedCounter = operational.DefineMetric(
+	"rate_limited_total",
+	"Number of flows dropped by the ingest rate limit, per source",
+	operational.TypeCounter,
+	"stage", "source",
+)
+
+// rateLimiter limits the flows of each source with a token bucket. A nil rateLimiter allows all the flows.
+type rateLimiter struct {
+	cfg      api.IngestRateLimit
+	stage    string
+	mutex    sync.Mutex
+	limiters map[string]*rate.Limiter
+	dropped  *prometheus.CounterVec
+}
+
+func newRateLimiter(opMetrics *operational.Metrics, stage string, cfg *api.IngestRateLimit) *rateLimiter {
+	if cfg == nil {
+		return nil
+	}
+	cfg.SetDefaults()
+	return &rateLimiter{
+		cfg:      *cfg,
+		stage:    stage,
+		limiters: map[string]*rate.Limiter{},
+		dropped:  opMetrics.NewCounterVec(&rateLimitedCounter),
+	}
+}
+
+// allow consumes a token of the source bucket, and returns false when the flow must be dropped
+func (r *rateLimiter) allow(source string) bool {
+	if r == nil {
+		return true
+	}
+	r.mutex.Lock()
+	limiter, ok := r.limiters[source]
+	if !ok {
+		if len(r.limiters) >= r.cfg.MaxSources {
+			r.evictIdle()
+		}
+		limiter = r.newLimiter(source)
+		r.limiters[source] = limiter
+	}
+	r.mutex.Unlock()
+	if limiter.Allow() {
+		return true
+	}
+	r.dropped.WithLabelValues(r.stage, source).Inc()
+	return false
+}
+
+func (r *rateLimiter) newLimiter(source string) *rate.Limiter {
+	limit, ok := r.cfg.Sources[source]
+	if !ok {
+		limit = r.cfg.FlowsPerSecond
+	}
+	if limit == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	burst := r.cfg.Burst
+	if burst == 0 {
+		burst = int(math.Max(1, math.Ceil(limit)))
+	}
+	return rate.NewLimiter(rate.Limit(limit), burst)
+}
+
+// evictIdle forgets the sources whose bucket is full: they are recreated in the same state on their next flow.
+// When all the sources are active, the whole map is reset to bound the memory.
+func (r *rateLimiter) evictIdle() {
+	now := time.Now()
+	for source, limiter := range r.limiters {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(r.limiters, source)
+		}
+	}
+	if len(r.limiters) >= r.cfg.MaxSources {
+		r.limiters = map[string]*rate.Limiter{}
+	}
+}
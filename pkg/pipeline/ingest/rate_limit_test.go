@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	dto "github.com/prometheus/client_model/go"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRateLimiter(cfg api.IngestRateLimit) *rateLimiter {
+	return newRateLimiter(operational.NewMetrics(&config.MetricsSettings{}), "ingest", &cfg)
+}
+
+func allowed(r *rateLimiter, source string, flows int) int {
+	n := 0
+	for i := 0; i < flows; i++ {
+		if r.allow(source) {
+			n++
+		}
+	}
+	return n
+}
+
+func rateLimited(t *testing.T, r *rateLimiter, source string) float64 {
+	var m dto.Metric
+	require.NoError(t, r.dropped.WithLabelValues("ingest", source).Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func TestRateLimitPerSource(t *testing.T) {
+	r := newTestRateLimiter(api.IngestRateLimit{FlowsPerSecond: 1, Burst: 10})
+
+	// the burst of the first source is limited, while the second source is not affected
+	require.Equal(t, 10, allowed(r, "10.0.0.1", 50))
+	require.Equal(t, 5, allowed(r, "10.0.0.2", 5))
+	require.Equal(t, float64(40), rateLimited(t, r, "10.0.0.1"))
+	require.Zero(t, rateLimited(t, r, "10.0.0.2"))
+}
+
+func TestRateLimitOverrides(t *testing.T) {
+	r := newTestRateLimiter(api.IngestRateLimit{
+		FlowsPerSecond: 2,
+		Sources:        map[string]float64{"10.0.0.1": 5, "10.0.0.2": 0},
+	})
+
+	// without explicit burst, the burst is the rate of the source
+	require.Equal(t, 5, allowed(r, "10.0.0.1", 20))
+	require.Equal(t, 20, allowed(r, "10.0.0.2", 20))
+	require.Equal(t, 2, allowed(r, "10.0.0.3", 20))
+
+	// without limiter, all the flows are allowed
+	var none *rateLimiter
+	require.True(t, none.allow("10.0.0.1"))
+}
+
+func TestRateLimitMaxSources(t *testing.T) {
+	r := newTestRateLimiter(api.IngestRateLimit{FlowsPerSecond: 1, Burst: 1, MaxSources: 2})
+	require.True(t, r.allow("10.0.0.1"))
+	require.True(t, r.allow("10.0.0.2"))
+	require.True(t, r.allow("10.0.0.3"))
+	require.LessOrEqual(t, len(r.limiters), 2)
+}
+
+func TestRateLimitKafkaSource(t *testing.T) {
+	msg := kafkago.Message{Key: []byte("key"), Headers: []kafkago.Header{{Key: "exporter", Value: []byte("10.0.0.1")}}}
+	k := ingestKafka{}
+	require.Equal(t, "key", k.messageSource(&msg))
+	k.limiterHeader = "exporter"
+	require.Equal(t, "10.0.0.1", k.messageSource(&msg))
+	k.limiterHeader = "other"
+	require.Empty(t, k.messageSource(&msg))
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var sampledOutCounter = operational.DefineMetric(
+	"sampled_out_flows_total",
+	"Number of flows dropped by the ingest sampling",
+	operational.TypeCounter,
+	"stage",
+)
+
+var samplingUpscaledFields = []string{"Bytes", "Packets"}
+
+// samplingIngester keeps 1 flow out of rate from the wrapped ingester, deciding from a hash of the flow fields
+type samplingIngester struct {
+	ingester Ingester
+	rate     uint64
+	// pairs of Src / Dst fields, hashed in a canonical order
+	pairs [][2]string
+	// fields hashed as they are
+	others     []string
+	sampledOut prometheus.Counter
+}
+
+// WithSampling wraps an ingester so that only a deterministic sample of its flows is forwarded, with upscaled counters
+func WithSampling(opMetrics *operational.Metrics, stage string, ingester Ingester, cfg *api.IngestSampling) (Ingester, error) {
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sampling config: %w", err)
+	}
+	if cfg.Rate == 1 {
+		return ingester, nil
+	}
+	s := &samplingIngester{
+		ingester:   ingester,
+		rate:       uint64(cfg.Rate),
+		sampledOut: opMetrics.NewCounter(&sampledOutCounter, stage),
+	}
+	fields := map[string]bool{}
+	for _, f := range cfg.Fields {
+		fields[f] = true
+	}
+	for _, f := range cfg.Fields {
+		if src, ok := strings.CutPrefix(f, "Src"); ok && fields["Dst"+src] {
+			s.pairs = append(s.pairs, [2]string{f, "Dst" + src})
+		} else if dst, ok := strings.CutPrefix(f, "Dst"); !ok || !fields["Src"+dst] {
+			s.others = append(s.others, f)
+		}
+	}
+	return s, nil
+}
+
+// Reload forwards the configuration reload to the sampled ingester
+func (s *samplingIngester) Reload() error {
+	if reloader, ok := s.ingester.(Reloader); ok {
+		return reloader.Reload()
+	}
+	return nil
+}
+
+func (s *samplingIngester) Ingest(out chan<- config.GenericMap) {
+	in := make(chan config.GenericMap, cap(out))
+	go func() {
+		s.ingester.Ingest(in)
+		close(in)
+	}()
+	for flow := range in {
+		if !s.keep(flow) {
+			s.sampledOut.Inc()
+			continue
+		}
+		for _, field := range samplingUpscaledFields {
+			if v, ok := flow[field]; ok {
+				flow[field] = upscale(v, s.rate)
+			}
+		}
+		out <- flow
+	}
+}
+
+func (s *samplingIngester) keep(flow config.GenericMap) bool {
+	h := xxhash.New()
+	for _, pair := range s.pairs {
+		a, b := utils.ConvertToString(flow[pair[0]]), utils.ConvertToString(flow[pair[1]])
+		if a > b {
+			a, b = b, a
+		}
+		_, _ = h.WriteString(a)
+		_, _ = h.WriteString("\x00")
+		_, _ = h.WriteString(b)
+		_, _ = h.WriteString("\x00")
+	}
+	for _, field := range s.others {
+		_, _ = h.WriteString(utils.ConvertToString(flow[field]))
+		_, _ = h.WriteString("\x00")
+	}
+	return h.Sum64()%s.rate == 0
+}
+
+// upscale multiplies a counter by the sampling rate, keeping its type
+func upscale(v interface{}, rate uint64) interface{} {
+	switch n := v.(type) {
+	case int:
+		return n * int(rate)
+	case int32:
+		return n * int32(rate)
+	case int64:
+		return n * int64(rate)
+	case uint32:
+		return n * uint32(rate)
+	case uint64:
+		return n * rate
+	case float64:
+		return n * float64(rate)
+	case float32:
+		return n * float32(rate)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ingest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceIngester forwards a fixed set of flows, then returns
+type sliceIngester []config.GenericMap
+
+func (s sliceIngester) Ingest(out chan<- config.GenericMap) {
+	for _, flow := range s {
+		out <- flow
+	}
+}
+
+func conversation(i int, reverse bool) config.GenericMap {
+	flow := config.GenericMap{
+		"SrcAddr": fmt.Sprintf("10.0.%d.%d", i/256, i%256), "SrcPort": 40000 + i%1000,
+		"DstAddr": "10.1.0.1", "DstPort": 443,
+		"Proto": 6, "Bytes": uint64(100), "Packets": 2,
+	}
+	if reverse {
+		flow["SrcAddr"], flow["DstAddr"] = flow["DstAddr"], flow["SrcAddr"]
+		flow["SrcPort"], flow["DstPort"] = flow["DstPort"], flow["SrcPort"]
+	}
+	return flow
+}
+
+func sample(t *testing.T, cfg *api.IngestSampling, flows sliceIngester) ([]config.GenericMap, float64) {
+	ingester, err := WithSampling(operational.NewMetrics(&config.MetricsSettings{}), "ingest", flows, cfg)
+	require.NoError(t, err)
+	out := make(chan config.GenericMap, len(flows))
+	ingester.Ingest(out)
+	close(out)
+	var kept []config.GenericMap
+	for flow := range out {
+		kept = append(kept, flow)
+	}
+	sampledOut := 0.0
+	if s, ok := ingester.(*samplingIngester); ok {
+		var m dto.Metric
+		require.NoError(t, s.sampledOut.Write(&m))
+		sampledOut = m.GetCounter().GetValue()
+	}
+	return kept, sampledOut
+}
+
+func TestSampling(t *testing.T) {
+	var flows sliceIngester
+	for i := 0; i < 10000; i++ {
+		flows = append(flows, conversation(i, false))
+	}
+	kept, sampledOut := sample(t, &api.IngestSampling{Rate: 10}, flows)
+
+	// about 1 flow out of 10 is kept, with upscaled counters of the same type
+	require.InDelta(t, 1000, len(kept), 150)
+	require.Equal(t, float64(10000-len(kept)), sampledOut)
+	for _, flow := range kept {
+		require.Equal(t, uint64(1000), flow["Bytes"])
+		require.Equal(t, 20, flow["Packets"])
+	}
+}
+
+func TestSamplingConversation(t *testing.T) {
+	// the decision is the same for every flow of a conversation, in both directions
+	var flows sliceIngester
+	for i := 0; i < 1000; i++ {
+		flows = append(flows, conversation(i, false), conversation(i, true), conversation(i, false))
+	}
+	kept, _ := sample(t, &api.IngestSampling{Rate: 5}, flows)
+	require.NotEmpty(t, kept)
+	require.Zero(t, len(kept)%3)
+
+	reversed := map[string]int{}
+	for _, flow := range kept {
+		if flow["DstAddr"] == "10.1.0.1" {
+			reversed[flow["SrcAddr"].(string)]++
+		} else {
+			reversed[flow["DstAddr"].(string)]--
+		}
+	}
+	for addr, n := range reversed {
+		require.Equalf(t, 1, n, "conversation of %s", addr)
+	}
+}
+
+func TestSamplingConfig(t *testing.T) {
+	flows := sliceIngester{conversation(1, false)}
+
+	// rate 1 keeps the ingester unchanged
+	ingester, err := WithSampling(operational.NewMetrics(&config.MetricsSettings{}), "ingest", flows, &api.IngestSampling{})
+	require.NoError(t, err)
+	require.Equal(t, flows, ingester)
+
+	_, err = WithSampling(operational.NewMetrics(&config.MetricsSettings{}), "ingest", flows, &api.IngestSampling{Rate: -2})
+	require.Error(t, err)
+
+	// without a hashed field varying, all the flows get the same decision
+	var many sliceIngester
+	for i := 0; i < 100; i++ {
+		many = append(many, conversation(i, false))
+	}
+	kept, sampledOut := sample(t, &api.IngestSampling{Rate: 3, Fields: []string{"DstAddr", "Proto"}}, many)
+	require.True(t, len(kept) == 0 || len(kept) == 100)
+	require.Equal(t, float64(100-len(kept)), sampledOut)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	test2 "github.com/mariomac/guara/pkg/test"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/ingest"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigIngestMultiple = `---
+log-level: debug
+pipeline:
+  - name: ingest_file
+  - name: ingest_fake
+  - name: transform1
+    followsList: [ingest_file, ingest_fake]
+  - name: write_fake
+    follows: transform1
+parameters:
+  - name: ingest_file
+    ingest:
+      type: file
+      file:
+        filename: ../../hack/examples/ocp-ipfix-flowlogs.json
+        decoder:
+          type: json
+  - name: ingest_fake
+    ingest:
+      type: fake
+  - name: transform1
+    transform:
+      type: none
+  - name: write_fake
+    write:
+      type: fake
+`
+
+func TestIngestMultiple(t *testing.T) {
+	v, cfg := test.InitConfig(t, testConfigIngestMultiple)
+	require.NotNil(t, v)
+	require.Equal(t, []string{"ingest_file", "ingest_fake"}, cfg.Pipeline[2].FollowedStages())
+
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	go mainPipeline.Run()
+
+	in := mainPipeline.pipelineEntryMap["ingest_fake"].Ingester.(*ingest.Fake).In
+	writer := mainPipeline.pipelineEntryMap["write_fake"].Writer.(*write.Fake)
+
+	// the file ingester stops once the file is read, while the fake ingester keeps sending flows
+	test2.Eventually(t, 15*time.Second, func(t require.TestingT) {
+		require.NotEmpty(t, writer.AllRecords())
+	})
+	in <- config.GenericMap{"SrcAddr": "10.0.0.1", "Source": "fake"}
+
+	test2.Eventually(t, 15*time.Second, func(t require.TestingT) {
+		var fromFile, fromFake int
+		for _, record := range writer.AllRecords() {
+			if record["Source"] == "fake" {
+				fromFake++
+			} else {
+				fromFile++
+			}
+		}
+		require.Equal(t, 1, fromFake)
+		require.Positive(t, fromFile)
+	})
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// stalledWriter blocks on the first flow until released, as a stalled backend would
+type stalledWriter struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+	seqs    []int
+}
+
+func (w *stalledWriter) Write(flow config.GenericMap) error {
+	w.once.Do(func() {
+		close(w.started)
+		<-w.release
+	})
+	w.seqs = append(w.seqs, flow["Seq"].(int))
+	return nil
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy   config.OverflowPolicy
+		expected []int
+	}{
+		{policy: config.OverflowDropNewest, expected: []int{0, 1, 2, 3, 4, 5}},
+		{policy: config.OverflowDropOldest, expected: []int{0, 95, 96, 97, 98, 99}},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			test.ResetPromRegistry()
+			builder := config.NewPresetIngesterPipeline()
+			cfg := builder.ToConfigFileStruct()
+			cfg.PerfSettings = config.PerfSettings{NodeBufferLen: 5, Overflow: tc.policy}
+			cfg.Pipeline = append(cfg.Pipeline, config.Stage{Name: "writer", Follows: config.PresetIngesterStage})
+			cfg.Parameters = append(cfg.Parameters, config.StageParam{Name: "writer", Write: &config.Write{Type: api.FakeType}})
+			in := make(chanIngester, 100)
+			p, err := newPipelineFromIngester(cfg, in)
+			require.NoError(t, err)
+			writer := &stalledWriter{started: make(chan struct{}), release: make(chan struct{})}
+			p.pipelineEntryMap["writer"].Writer = writer
+			done := make(chan struct{})
+			go func() {
+				p.Run()
+				close(done)
+			}()
+
+			in <- config.GenericMap{"Seq": 0}
+			<-writer.started
+			for i := 1; i < 100; i++ {
+				in <- config.GenericMap{"Seq": i}
+			}
+			close(in)
+			// the stalled writer doesn't slow the ingester down: the flows beyond the queue are dropped
+			require.Eventually(t, func() bool {
+				return p.pipelineEntryMap[config.PresetIngesterStage].stats.processed.Load() == 100
+			}, 5*time.Second, 10*time.Millisecond)
+			require.Eventually(t, func() bool {
+				return strings.Contains(test.ReadExposedMetrics(t, prometheus.DefaultGatherer), `stage_dropped_flows_total{stage="writer"} 94`)
+			}, 5*time.Second, 10*time.Millisecond)
+			close(writer.release)
+			<-done
+			require.Equal(t, tc.expected, writer.seqs)
+		})
+	}
+}
+
+func TestOverflowPolicies_Invalid(t *testing.T) {
+	builder := config.NewPresetIngesterPipeline()
+	cfg := builder.ToConfigFileStruct()
+	cfg.Pipeline = append(cfg.Pipeline, config.Stage{Name: "writer", Follows: config.PresetIngesterStage, Overflow: "drop-all"})
+	cfg.Parameters = append(cfg.Parameters, config.StageParam{Name: "writer", Write: &config.Write{Type: api.FakeType}})
+	_, err := newPipelineFromIngester(cfg, make(chanIngester))
+	require.ErrorContains(t, err, `stage writer: unknown overflow policy "drop-all"`)
+}
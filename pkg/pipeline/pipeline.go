@@ -19,6 +19,7 @@ package pipeline
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
@@ -46,7 +47,13 @@ type Pipeline struct {
 	// to be able to remove it from here
 	pipelineStages []*pipelineEntry
 	Metrics        *operational.Metrics
-	configWatcher  *pipelineConfigWatcher
+	// Telemetry holds the pipeline stage metrics; it is nil unless the telemetry section is configured
+	Telemetry *operational.PipelineMetrics
+	// Health holds the liveness and readiness checks of the pipeline and of its stages
+	Health        *operational.Health
+	configWatcher *pipelineConfigWatcher
+	// reloadMutex serializes the reloads, triggered by SIGHUP, by the admin API or by ConfigMap updates
+	reloadMutex *sync.Mutex
 }
 
 // NewPipeline defines the pipeline elements
@@ -65,6 +72,9 @@ func newPipelineFromIngester(cfg *config.ConfigFileStruct, ing ingest.Ingester)
 	if ing != nil {
 		builder.presetIngester(ing)
 	}
+	if err := builder.validate(); err != nil {
+		return nil, err
+	}
 	if err := builder.readStages(); err != nil {
 		return nil, err
 	}
@@ -72,7 +82,8 @@ func newPipelineFromIngester(cfg *config.ConfigFileStruct, ing ingest.Ingester)
 	if err != nil {
 		return nil, err
 	}
-	pipeline.configWatcher, err = newPipelineConfigWatcher(cfg, pipeline.pipelineEntryMap)
+	pipeline.initHealth()
+	pipeline.configWatcher, err = newPipelineConfigWatcher(cfg, pipeline)
 	return pipeline, err
 }
 
@@ -107,3 +118,16 @@ func (p *Pipeline) IsAlive() error {
 	}
 	return nil
 }
+
+// initHealth registers the pipeline liveness and readiness, and the readiness of the stages contributing to it
+func (p *Pipeline) initHealth() {
+	p.Health = operational.NewHealth()
+	p.Health.AddLivenessCheck("PipelineCheck", p.IsAlive)
+	p.Health.AddReadinessCheck("PipelineCheck", p.IsReady)
+	for _, pe := range p.pipelineEntryMap {
+		pe.updateContributor()
+		if pe.contributor.Load() != nil {
+			p.Health.AddReadinessCheck("stage "+pe.stageName, pe.ready)
+		}
+	}
+}
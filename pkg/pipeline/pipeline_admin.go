@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AdminAPIPrefix is the path prefix of the admin API endpoints
+const AdminAPIPrefix = "/api/v1/"
+
+// StageStatus is the state of a pipeline stage, as reported by the admin API
+type StageStatus struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Follows      []string `json:"follows,omitempty"`
+	Running      bool     `json:"running"`
+	Processed    int64    `json:"processed"`
+	Errors       int64    `json:"errors"`
+	ChannelDepth int      `json:"channelDepth"`
+}
+
+// Status is the state of the pipeline, as reported by the admin API. It is running when all the stages are running.
+type Status struct {
+	Running bool          `json:"running"`
+	Stages  []StageStatus `json:"stages"`
+}
+
+// Status returns the stages of the pipeline, in the order of the configuration parameters, with their counters
+func (p *Pipeline) Status() Status {
+	status := Status{Running: true, Stages: make([]StageStatus, 0, len(p.pipelineStages))}
+	for _, pe := range p.pipelineStages {
+		stage := StageStatus{
+			Name:         pe.stageName,
+			Type:         pe.stageType,
+			Follows:      pe.follows,
+			Running:      pe.stats.running.Load(),
+			Processed:    pe.stats.processed.Load(),
+			Errors:       pe.stats.errors.Load(),
+			ChannelDepth: pe.stats.channelDepth(),
+		}
+		status.Running = status.Running && stage.Running
+		status.Stages = append(status.Stages, stage)
+	}
+	return status
+}
+
+// AdminHandler serves the admin API:
+//   - GET /api/v1/pipeline returns the stages and their counters
+//   - GET /api/v1/healthz returns 200 when all the stages are running, 503 otherwise
+//   - POST /api/v1/reload hot-reloads the stage parameters with reload, e.g. from the configuration file as on SIGHUP,
+//     or from the configuration ConfigMap; it is refused when reload is nil
+//
+// When token is not empty, the requests must provide it as a bearer token.
+func (p *Pipeline) AdminHandler(reload func(context.Context) error, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+AdminAPIPrefix+"pipeline", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminResponse(w, http.StatusOK, p.Status())
+	})
+	mux.HandleFunc("GET "+AdminAPIPrefix+"healthz", func(w http.ResponseWriter, _ *http.Request) {
+		status := p.Status()
+		code := http.StatusOK
+		if !status.Running {
+			code = http.StatusServiceUnavailable
+		}
+		writeAdminResponse(w, code, status)
+	})
+	mux.HandleFunc("POST "+AdminAPIPrefix+"reload", func(w http.ResponseWriter, r *http.Request) {
+		if reload == nil {
+			writeAdminError(w, http.StatusConflict, "the pipeline was not started from a configuration file or ConfigMap")
+			return
+		}
+		if err := reload(r.Context()); err != nil {
+			log.WithError(err).Error("can't reload pipeline")
+			writeAdminError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeAdminResponse(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.WithError(err).Debug("can't write admin API response")
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, code int, msg string) {
+	writeAdminResponse(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/ingest"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+func adminRequest(t *testing.T, method, url, token string) (int, Status) {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var status Status
+	if resp.Header.Get("Content-Type") == "application/json" && resp.StatusCode != http.StatusUnauthorized {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	}
+	return resp.StatusCode, status
+}
+
+func TestAdminAPI(t *testing.T) {
+	_, cfg := test.InitConfig(t, strings.Replace(testConfigReload, "PROTO", "17", 1))
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(testConfigReload, "PROTO", "6", 1)), 0o600))
+	server := httptest.NewServer(mainPipeline.AdminHandler(func(context.Context) error { return mainPipeline.ReloadFromFile(path) }, "secret"))
+	defer server.Close()
+
+	// the stages aren't running yet
+	code, _ := adminRequest(t, http.MethodGet, server.URL+"/api/v1/healthz", "secret")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+
+	go mainPipeline.Run()
+	fake := mainPipeline.pipelineStages[0].Ingester.(*ingest.Fake)
+	writer := mainPipeline.pipelineStages[2].Writer.(*write.Fake)
+	for _, proto := range []float64{1, 6, 17} {
+		fake.In <- config.GenericMap{"Proto": proto}
+	}
+	require.Eventually(t, func() bool { return len(writer.AllRecords()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	code, status := adminRequest(t, http.MethodGet, server.URL+"/api/v1/pipeline", "secret")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, status.Running)
+	require.Equal(t, []StageStatus{
+		{Name: "ingest_fake", Type: StageIngest, Running: true, Processed: 3},
+		{Name: "filter", Type: StageTransform, Follows: []string{"ingest_fake"}, Running: true, Processed: 3},
+		{Name: "write_fake", Type: StageWrite, Follows: []string{"filter"}, Running: true, Processed: 2},
+	}, status.Stages)
+
+	code, _ = adminRequest(t, http.MethodGet, server.URL+"/api/v1/healthz", "secret")
+	require.Equal(t, http.StatusOK, code)
+
+	// the reloaded configuration removes TCP instead of UDP
+	code, _ = adminRequest(t, http.MethodPost, server.URL+"/api/v1/reload", "secret")
+	require.Equal(t, http.StatusNoContent, code)
+	for _, proto := range []float64{6, 17} {
+		fake.In <- config.GenericMap{"Proto": proto}
+	}
+	require.Eventually(t, func() bool { return len(writer.AllRecords()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 17.0, writer.AllRecords()[2]["Proto"])
+	_, status = adminRequest(t, http.MethodGet, server.URL+"/api/v1/pipeline", "secret")
+	require.Equal(t, int64(5), status.Stages[1].Processed)
+}
+
+func TestAdminAPIErrors(t *testing.T) {
+	_, cfg := test.InitConfig(t, strings.Replace(testConfigReload, "PROTO", "17", 1))
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	server := httptest.NewServer(mainPipeline.AdminHandler(nil, "secret"))
+	defer server.Close()
+
+	code, _ := adminRequest(t, http.MethodGet, server.URL+"/api/v1/pipeline", "")
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = adminRequest(t, http.MethodGet, server.URL+"/api/v1/pipeline", "wrong")
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = adminRequest(t, http.MethodPost, server.URL+"/api/v1/pipeline", "secret")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+	// without configuration file, there's nothing to reload
+	code, _ = adminRequest(t, http.MethodPost, server.URL+"/api/v1/reload", "secret")
+	require.Equal(t, http.StatusConflict, code)
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/benbjohnson/clock"
@@ -31,6 +34,7 @@ const (
 	defaultNodeBufferLen          = 1000
 	defaultExtractBatching        = 1000
 	defaultExtractBatchingTimeout = 5 * time.Second
+	holderExpiryInterval          = time.Second
 )
 
 // Error wraps any error caused by a wrong formation of the pipeline
@@ -61,17 +65,94 @@ type builder struct {
 	batchMaxLen      int
 	batchTimeout     time.Duration
 	nodeBufferLen    int
+	overflow         config.OverflowPolicy
 	updtChans        map[string]chan config.StageParam
+	// telemetry is nil when the pipeline metrics are disabled
+	telemetry *operational.PipelineMetrics
 }
 
 type pipelineEntry struct {
-	stageName   string
-	stageType   string
+	stageName string
+	stageType string
+	params    config.StageParam
+	follows   []string
+	stats     stageStats
+	// workers is the number of goroutines processing the flows of the stage, 1 when not configured
+	workers int
+	// overflow tells what the stage does with the flows it receives while its input is full
+	overflow config.OverflowPolicy
+	// mutex is held while processing flows, so that reloads don't swap the stage in the middle of a flow.
+	// The workers of a stage share it for reading, as they only run stateless transformers.
+	mutex       sync.RWMutex
 	Ingester    ingest.Ingester
 	Transformer transform.Transformer
 	Extractor   extract.Extractor
 	Encoder     encode.Encoder
 	Writer      write.Writer
+	// contributor is read without the mutex, which a stalled stage holds while blocked on a flow
+	contributor atomic.Pointer[operational.ReadinessContributor]
+}
+
+// component returns the ingester, transformer, extractor, encoder or writer of the stage
+func (pe *pipelineEntry) component() any {
+	switch pe.stageType {
+	case StageIngest:
+		return pe.Ingester
+	case StageTransform:
+		return pe.Transformer
+	case StageExtract:
+		return pe.Extractor
+	case StageEncode:
+		return pe.Encoder
+	case StageWrite:
+		return pe.Writer
+	}
+	return nil
+}
+
+// updateContributor keeps the component of the stage contributing to the pipeline readiness, if any
+func (pe *pipelineEntry) updateContributor() {
+	if contributor, ok := pe.component().(operational.ReadinessContributor); ok {
+		pe.contributor.Store(&contributor)
+	} else {
+		pe.contributor.Store(nil)
+	}
+}
+
+// ready checks the readiness of the current component of the stage, which a reload may have replaced
+func (pe *pipelineEntry) ready() error {
+	if contributor := pe.contributor.Load(); contributor != nil {
+		return (*contributor).Ready()
+	}
+	return nil
+}
+
+// stageStats are the counters of a stage reported by the admin API, whether telemetry is enabled or not
+type stageStats struct {
+	running   atomic.Bool
+	processed atomic.Int64
+	errors    atomic.Int64
+	mutex     sync.Mutex
+	depth     func() int
+}
+
+// started flags the stage as running until the returned function is called; depth reports the number
+// of flows in the stage input channel
+func (s *stageStats) started(depth func() int) func() {
+	s.mutex.Lock()
+	s.depth = depth
+	s.mutex.Unlock()
+	s.running.Store(true)
+	return func() { s.running.Store(false) }
+}
+
+func (s *stageStats) channelDepth() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.depth == nil {
+		return 0
+	}
+	return s.depth()
 }
 
 func getDynConfig(cfg *config.ConfigFileStruct) ([]config.StageParam, error) {
@@ -132,6 +213,11 @@ func newBuilder(cfg *config.ConfigFileStruct) *builder {
 		}
 	}
 
+	var telemetry *operational.PipelineMetrics
+	if cfg.Telemetry != nil {
+		telemetry = operational.NewPipelineMetrics()
+	}
+
 	return &builder{
 		pipelineEntryMap: map[string]*pipelineEntry{},
 		createdStages:    map[string]interface{}{},
@@ -142,7 +228,9 @@ func newBuilder(cfg *config.ConfigFileStruct) *builder {
 		batchMaxLen:      bl,
 		batchTimeout:     bt,
 		nodeBufferLen:    nb,
+		overflow:         cfg.PerfSettings.Overflow,
 		updtChans:        map[string]chan config.StageParam{},
+		telemetry:        telemetry,
 	}
 }
 
@@ -159,11 +247,19 @@ func (b *builder) presetIngester(ing ingest.Ingester) {
 
 // read the configuration stages definition and instantiate the corresponding native Go objects
 func (b *builder) readStages() error {
+	workers := map[string]int{}
+	overflows := map[string]config.OverflowPolicy{}
+	for _, stg := range b.configStages {
+		workers[stg.Name] = stg.Workers
+		overflows[stg.Name] = stg.Overflow
+	}
 	for _, param := range b.configParams {
 		log.Debugf("stage = %v", param.Name)
 		pEntry := pipelineEntry{
 			stageName: param.Name,
 			stageType: findStageType(&param),
+			params:    param,
+			workers:   max(workers[param.Name], 1),
 		}
 		var err error
 		switch pEntry.stageType {
@@ -183,12 +279,58 @@ func (b *builder) readStages() error {
 		if err != nil {
 			return err
 		}
+		if err := checkWorkers(&pEntry, workers[param.Name]); err != nil {
+			return err
+		}
+		if pEntry.overflow, err = b.overflowPolicy(&pEntry, overflows[param.Name]); err != nil {
+			return err
+		}
 		b.appendEntry(&pEntry)
 	}
 	log.Debugf("pipeline = %v", b.pipelineStages)
 	return nil
 }
 
+// overflowPolicy returns the overflow policy of the stage, defaulting to the policy of perfSettings
+func (b *builder) overflowPolicy(pe *pipelineEntry, policy config.OverflowPolicy) (config.OverflowPolicy, error) {
+	if policy != "" && pe.stageType == StageIngest {
+		return "", fmt.Errorf("stage %s: ingest stages have no input, they can't have an overflow policy", pe.stageName)
+	}
+	if policy == "" {
+		policy = b.overflow
+	}
+	if err := policy.Validate(); err != nil {
+		return "", fmt.Errorf("stage %s: %w", pe.stageName, err)
+	}
+	if policy == "" {
+		policy = config.OverflowBlock
+	}
+	return policy, nil
+}
+
+// checkWorkers refuses several workers for the stages whose output depends on the order of the flows: several
+// workers process the flows concurrently, without ordering guarantees between them
+func checkWorkers(pe *pipelineEntry, workers int) error {
+	if workers < 0 {
+		return fmt.Errorf("stage %s: workers can't be negative", pe.stageName)
+	}
+	if workers <= 1 {
+		return nil
+	}
+	switch pe.stageType {
+	case StageTransform:
+		if _, ok := pe.Transformer.(transform.Holder); ok {
+			return fmt.Errorf("stage %s: %s transform holds flows across records and can't run with several workers", pe.stageName, pe.params.Transform.Type)
+		}
+		return nil
+	case StageExtract:
+		// extractors aggregate or track connections over batches of records
+		return fmt.Errorf("stage %s: extract stages keep a state across records and can't run with several workers", pe.stageName)
+	default:
+		return fmt.Errorf("stage %s: workers are only supported by transform stages", pe.stageName)
+	}
+}
+
 func (b *builder) appendEntry(pEntry *pipelineEntry) {
 	b.pipelineEntryMap[pEntry.stageName] = pEntry
 	b.pipelineStages = append(b.pipelineStages, pEntry)
@@ -198,69 +340,23 @@ func (b *builder) appendEntry(pEntry *pipelineEntry) {
 // reads the configured Go stages and connects between them
 // readStages must be invoked before this
 func (b *builder) build() (*Pipeline, error) {
-	// accounts start and middle nodes that are connected to another node
-	sendingNodes := map[string]struct{}{}
-	// accounts middle or terminal nodes that receive data from another node
-	receivingNodes := map[string]struct{}{}
 	for _, connection := range b.configStages {
-		if connection.Name == "" || connection.Follows == "" {
+		if connection.Name == "" || len(connection.FollowedStages()) == 0 {
 			// ignore entries that do not represent a connection
 			continue
 		}
-		// instantiates (or loads from cache) the destination node of a connection
-		dstEntry, ok := b.pipelineEntryMap[connection.Name]
-		if !ok {
-			return nil, fmt.Errorf("unknown pipeline stage: %s", connection.Name)
-		}
-		dstNode, err := b.getStageNode(dstEntry, connection.Name)
-		if err != nil {
-			return nil, err
-		}
-		dst, ok := dstNode.(node.Receiver[config.GenericMap])
-		if !ok {
-			return nil, fmt.Errorf("stage %q of type %q can't receive data",
-				connection.Name, dstEntry.stageType)
-		}
-		// instantiates (or loads from cache) the source node of a connection
-		srcEntry, ok := b.pipelineEntryMap[connection.Follows]
-		if !ok {
-			return nil, fmt.Errorf("unknown pipeline stage: %s", connection.Follows)
-		}
-		srcNode, err := b.getStageNode(srcEntry, connection.Follows)
-		if err != nil {
-			return nil, err
-		}
-		src, ok := srcNode.(node.Sender[config.GenericMap])
-		if !ok {
-			return nil, fmt.Errorf("stage %q of type %q can't send data",
-				connection.Follows, srcEntry.stageType)
-		}
-		log.Infof("connecting stages: %s --> %s", connection.Follows, connection.Name)
-
-		sendingNodes[connection.Follows] = struct{}{}
-		receivingNodes[connection.Name] = struct{}{}
-		// connects source and destination node, and catches any panic from the Go-Pipes library.
-		var catchErr *Error
-		func() {
-			defer func() {
-				if msg := recover(); msg != nil {
-					catchErr = &Error{
-						StageName: connection.Name,
-						wrapped: fmt.Errorf("%q and %q stages haven't compatible input/outputs: %v",
-							connection.Follows, connection.Name, msg),
-					}
-				}
-			}()
-			src.SendsTo(dst)
-		}()
-		if catchErr != nil {
-			return nil, catchErr
+		// a stage following several stages receives the flows of all of them, without ordering guarantees between them
+		for _, follows := range connection.FollowedStages() {
+			if follows == "" {
+				continue
+			}
+			if err := b.connect(follows, connection.Name); err != nil {
+				return nil, err
+			}
+			b.pipelineEntryMap[connection.Name].follows = append(b.pipelineEntryMap[connection.Name].follows, follows)
 		}
 	}
 
-	if err := b.verifyConnections(sendingNodes, receivingNodes); err != nil {
-		return nil, err
-	}
 	if len(b.startNodes) == 0 {
 		return nil, errors.New("no ingesters have been defined")
 	}
@@ -273,33 +369,196 @@ func (b *builder) build() (*Pipeline, error) {
 		pipelineStages:   b.pipelineStages,
 		pipelineEntryMap: b.pipelineEntryMap,
 		Metrics:          b.opMetrics,
+		Telemetry:        b.telemetry,
+		reloadMutex:      &sync.Mutex{},
 	}, nil
 }
 
-// verifies that all the start and middle nodes send data to another node
-// verifies that all the middle and terminal nodes receive data from another node
-func (b *builder) verifyConnections(sendingNodes, receivingNodes map[string]struct{}) error {
-	for _, stg := range b.pipelineStages {
-		if isReceptor(stg) {
-			if _, ok := receivingNodes[stg.stageName]; !ok {
-				return &Error{
-					StageName: stg.stageName,
-					wrapped: fmt.Errorf("pipeline stage from type %q"+
-						" should receive data from at least another stage", stg.stageType),
+// connect instantiates (or loads from cache) the source and destination nodes of a connection, and connects them
+func (b *builder) connect(srcName, dstName string) error {
+	dstEntry, ok := b.pipelineEntryMap[dstName]
+	if !ok {
+		return fmt.Errorf("unknown pipeline stage: %s", dstName)
+	}
+	dstNode, err := b.getStageNode(dstEntry, dstName)
+	if err != nil {
+		return err
+	}
+	dst, ok := dstNode.(node.Receiver[config.GenericMap])
+	if !ok {
+		return fmt.Errorf("stage %q of type %q can't receive data",
+			dstName, dstEntry.stageType)
+	}
+	srcEntry, ok := b.pipelineEntryMap[srcName]
+	if !ok {
+		return fmt.Errorf("unknown pipeline stage: %s", srcName)
+	}
+	srcNode, err := b.getStageNode(srcEntry, srcName)
+	if err != nil {
+		return err
+	}
+	src, ok := srcNode.(node.Sender[config.GenericMap])
+	if !ok {
+		return fmt.Errorf("stage %q of type %q can't send data",
+			srcName, srcEntry.stageType)
+	}
+	log.Infof("connecting stages: %s --> %s", srcName, dstName)
+
+	// connects source and destination node, and catches any panic from the Go-Pipes library.
+	var catchErr *Error
+	func() {
+		defer func() {
+			if msg := recover(); msg != nil {
+				catchErr = &Error{
+					StageName: dstName,
+					wrapped: fmt.Errorf("%q and %q stages haven't compatible input/outputs: %v",
+						srcName, dstName, msg),
 				}
 			}
+		}()
+		src.SendsTo(dst)
+	}()
+	if catchErr != nil {
+		return catchErr
+	}
+	return nil
+}
+
+// validate checks the graph of stages declared by the configuration, before any stage is instantiated.
+// It reports all the problems at once: stages following unknown stages, stages without inputs or outputs,
+// stages that can't be reached from an ingester, and cycles.
+func (b *builder) validate() error {
+	types := map[string]string{}
+	var names []string
+	for _, stg := range b.pipelineStages {
+		types[stg.stageName] = stg.stageType
+		names = append(names, stg.stageName)
+	}
+	for i := range b.configParams {
+		param := &b.configParams[i]
+		if _, ok := types[param.Name]; !ok {
+			names = append(names, param.Name)
+		}
+		types[param.Name] = findStageType(param)
+	}
+
+	problems := map[string][]error{}
+	// followers of each stage, and number of inputs of each stage
+	followers := map[string][]string{}
+	inputs := map[string]int{}
+	for _, connection := range b.configStages {
+		if connection.Name == "" {
+			continue
+		}
+		if _, ok := types[connection.Name]; !ok {
+			if _, reported := problems[connection.Name]; !reported {
+				names = append(names, connection.Name)
+			}
+			problems[connection.Name] = append(problems[connection.Name], errors.New("stage has no parameters"))
+			continue
+		}
+		for _, follows := range connection.FollowedStages() {
+			if follows == "" {
+				continue
+			}
+			if _, ok := types[follows]; !ok {
+				problems[connection.Name] = append(problems[connection.Name], fmt.Errorf("follows unknown stage %q", follows))
+				continue
+			}
+			followers[follows] = append(followers[follows], connection.Name)
+			inputs[connection.Name]++
+		}
+	}
+
+	reachable := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if reachable[name] {
+			return
 		}
-		if isSender(stg) {
-			if _, ok := sendingNodes[stg.stageName]; !ok {
-				return &Error{
-					StageName: stg.stageName,
-					wrapped: fmt.Errorf("pipeline stage from type %q"+
-						" should send data to at least another stage", stg.stageType),
+		reachable[name] = true
+		for _, f := range followers[name] {
+			visit(f)
+		}
+	}
+	for _, name := range names {
+		if types[name] == StageIngest {
+			visit(name)
+		}
+	}
+
+	for _, name := range names {
+		stg := &pipelineEntry{stageName: name, stageType: types[name]}
+		switch {
+		case stg.stageType == "":
+			// already reported as having no parameters
+		case stg.stageType == "unknown":
+			problems[name] = append(problems[name], errors.New("invalid stage type"))
+		case !isReceptor(stg) && inputs[name] > 0:
+			problems[name] = append(problems[name], fmt.Errorf("pipeline stage from type %q can't receive data", stg.stageType))
+		case isReceptor(stg) && inputs[name] == 0:
+			problems[name] = append(problems[name], fmt.Errorf("pipeline stage from type %q"+
+				" should receive data from at least another stage", stg.stageType))
+		case isReceptor(stg) && !reachable[name]:
+			problems[name] = append(problems[name], errors.New("stage is not reachable from any ingest stage"))
+		}
+		if stg.stageType != "" && stg.stageType != "unknown" && isSender(stg) && len(followers[name]) == 0 {
+			problems[name] = append(problems[name], fmt.Errorf("pipeline stage from type %q"+
+				" should send data to at least another stage", stg.stageType))
+		}
+	}
+
+	var errs []error
+	for _, name := range names {
+		for _, p := range problems[name] {
+			errs = append(errs, &Error{StageName: name, wrapped: p})
+		}
+	}
+	for _, cycle := range findCycles(names, followers) {
+		errs = append(errs, &Error{
+			StageName: cycle[0],
+			wrapped:   fmt.Errorf("stages form a cycle: %s", strings.Join(cycle, " -> ")),
+		})
+	}
+	return errors.Join(errs...)
+}
+
+// findCycles returns the cycles of the stages graph, as the list of their stages, starting and ending with the same stage
+func findCycles(names []string, followers map[string][]string) [][]string {
+	const (
+		unvisited = iota
+		inPath
+		done
+	)
+	state := map[string]int{}
+	var path []string
+	var cycles [][]string
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = inPath
+		path = append(path, name)
+		for _, f := range followers[name] {
+			switch state[f] {
+			case unvisited:
+				visit(f)
+			case inPath:
+				start := len(path) - 1
+				for path[start] != f {
+					start--
 				}
+				cycle := append(append([]string{}, path[start:]...), f)
+				cycles = append(cycles, cycle)
 			}
 		}
+		path = path[:len(path)-1]
+		state[name] = done
 	}
-	return nil
+	for _, name := range names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return cycles
 }
 
 func isReceptor(p *pipelineEntry) bool {
@@ -310,11 +569,65 @@ func isSender(p *pipelineEntry) bool {
 	return p.stageType != StageWrite && p.stageType != StageEncode
 }
 
-func (b *builder) runMeasured(name string, f func()) {
+func (b *builder) runMeasured(pe *pipelineEntry, name string, telemetry *operational.StageMetrics, f func()) {
 	start := time.Now()
 	f()
 	duration := time.Since(start)
 	b.stageDuration.WithLabelValues(name).Observe(float64(duration.Milliseconds()))
+	pe.stats.processed.Add(1)
+	telemetry.Processed(1)
+	telemetry.Observe(duration)
+}
+
+// instrumentIngest counts the flows sent by the ingester, through an intermediate channel whose depth is exposed
+func (b *builder) instrumentIngest(pe *pipelineEntry, stageID string, ingest func(out chan<- config.GenericMap)) func(out chan<- config.GenericMap) {
+	return func(out chan<- config.GenericMap) {
+		in := make(chan config.GenericMap, b.nodeBufferLen)
+		defer pe.stats.started(func() int { return len(in) })()
+		telemetry := b.telemetry.ForStage(stageID, StageIngest, func() int { return len(in) })
+		go func() {
+			ingest(in)
+			close(in)
+		}()
+		for i := range in {
+			pe.stats.processed.Add(1)
+			telemetry.Processed(1)
+			out <- i
+		}
+	}
+}
+
+// boundedInput applies the overflow policy of a stage. Unless the stage blocks, its input is drained into a queue
+// of nodeBufferLen flows, so that a stalled stage drops flows rather than slowing down the previous stages.
+func (b *builder) boundedInput(pe *pipelineEntry, stageID string, in <-chan config.GenericMap) <-chan config.GenericMap {
+	if pe.overflow != config.OverflowDropOldest && pe.overflow != config.OverflowDropNewest {
+		return in
+	}
+	dropped := b.opMetrics.CreateDroppedFlowsCounter(stageID)
+	queue := make(chan config.GenericMap, b.nodeBufferLen)
+	go func() {
+		defer close(queue)
+		for i := range in {
+			select {
+			case queue <- i:
+				continue
+			default:
+			}
+			if pe.overflow == config.OverflowDropNewest {
+				dropped.Inc()
+				continue
+			}
+			select {
+			case <-queue:
+				dropped.Inc()
+			default:
+				// the stage took a flow in the meantime
+			}
+			// this goroutine is the only sender: there is room for the flow
+			queue <- i
+		}
+	}()
+	return queue
 }
 
 func (b *builder) getStageNode(pe *pipelineEntry, stageID string) (interface{}, error) {
@@ -326,15 +639,24 @@ func (b *builder) getStageNode(pe *pipelineEntry, stageID string) (interface{},
 	// as we do with Ingest
 	switch pe.stageType {
 	case StageIngest:
-		init := node.AsStart(pe.Ingester.Ingest)
+		init := node.AsStart(b.instrumentIngest(pe, stageID, pe.Ingester.Ingest))
 		b.startNodes = append(b.startNodes, init)
 		stage = init
 	case StageWrite:
 		term := node.AsTerminal(func(in <-chan config.GenericMap) {
+			in = b.boundedInput(pe, stageID, in)
 			b.opMetrics.CreateInQueueSizeGauge(stageID, func() int { return len(in) })
+			telemetry := b.telemetry.ForStage(stageID, pe.stageType, func() int { return len(in) })
+			defer pe.stats.started(func() int { return len(in) })()
 			for i := range in {
-				b.runMeasured(stageID, func() {
-					pe.Writer.Write(i)
+				b.runMeasured(pe, stageID, telemetry, func() {
+					pe.mutex.Lock()
+					defer pe.mutex.Unlock()
+					if err := pe.Writer.Write(i); err != nil {
+						pe.stats.errors.Add(1)
+						telemetry.Failed()
+						log.WithError(err).Debugf("stage %s failed to write entry", stageID)
+					}
 				})
 			}
 		}, node.ChannelBufferLen(b.nodeBufferLen))
@@ -342,9 +664,14 @@ func (b *builder) getStageNode(pe *pipelineEntry, stageID string) (interface{},
 		stage = term
 	case StageEncode:
 		encode := node.AsTerminal(func(in <-chan config.GenericMap) {
+			in = b.boundedInput(pe, stageID, in)
 			b.opMetrics.CreateInQueueSizeGauge(stageID, func() int { return len(in) })
+			telemetry := b.telemetry.ForStage(stageID, pe.stageType, func() int { return len(in) })
+			defer pe.stats.started(func() int { return len(in) })()
 			for i := range in {
-				b.runMeasured(stageID, func() {
+				b.runMeasured(pe, stageID, telemetry, func() {
+					pe.mutex.Lock()
+					defer pe.mutex.Unlock()
 					pe.Encoder.Encode(i)
 				})
 			}
@@ -352,26 +679,86 @@ func (b *builder) getStageNode(pe *pipelineEntry, stageID string) (interface{},
 		b.terminalNodes = append(b.terminalNodes, encode)
 		stage = encode
 	case StageTransform:
+		if pe.workers > 1 {
+			stage = b.getWorkersNode(pe, stageID)
+			break
+		}
 		stage = node.AsMiddle(func(in <-chan config.GenericMap, out chan<- config.GenericMap) {
+			in = b.boundedInput(pe, stageID, in)
 			b.opMetrics.CreateInQueueSizeGauge(stageID, func() int { return len(in) })
 			b.opMetrics.CreateOutQueueSizeGauge(stageID, func() int { return len(out) })
-			for i := range in {
-				b.runMeasured(stageID, func() {
-					if transformed, ok := pe.Transformer.Transform(i); ok {
-						out <- transformed
+			telemetry := b.telemetry.ForStage(stageID, pe.stageType, func() int { return len(in) })
+			defer pe.stats.started(func() int { return len(in) })()
+			// transformers holding flows release them on expiry, even when no flow comes in
+			ticker := time.NewTicker(holderExpiryInterval)
+			defer ticker.Stop()
+			var holder transform.Holder
+			release := func(held func(transform.Holder) []config.GenericMap) {
+				pe.mutex.Lock()
+				var flows []config.GenericMap
+				if holder != nil {
+					flows = held(holder)
+				}
+				// after a reload, the flows held by the previous transformer are released at once
+				if current, ok := pe.Transformer.(transform.Holder); ok && current != holder {
+					if holder != nil {
+						flows = append(flows, holder.Flush()...)
 					}
-				})
+					holder = current
+					flows = append(flows, held(holder)...)
+				}
+				pe.mutex.Unlock()
+				for _, f := range flows {
+					out <- f
+				}
+			}
+			for {
+				select {
+				case i, ok := <-in:
+					if !ok {
+						release(transform.Holder.Flush)
+						return
+					}
+					b.runMeasured(pe, stageID, telemetry, func() {
+						pe.mutex.Lock()
+						if multi, ok := pe.Transformer.(transform.MultiTransformer); ok {
+							outputs := multi.TransformMulti(i)
+							pe.mutex.Unlock()
+							// the outputs of a flow are sent in order, before the outputs of the next flow
+							for _, o := range outputs {
+								out <- o
+							}
+							return
+						}
+						transformed, ok := pe.Transformer.Transform(i)
+						pe.mutex.Unlock()
+						if ok {
+							out <- transformed
+						}
+					})
+				case now := <-ticker.C:
+					release(func(h transform.Holder) []config.GenericMap { return h.Expire(now) })
+				}
 			}
 		}, node.ChannelBufferLen(b.nodeBufferLen))
 	case StageExtract:
 		stage = node.AsMiddle(func(in <-chan config.GenericMap, out chan<- config.GenericMap) {
+			in = b.boundedInput(pe, stageID, in)
 			b.opMetrics.CreateInQueueSizeGauge(stageID, func() int { return len(in) })
 			b.opMetrics.CreateOutQueueSizeGauge(stageID, func() int { return len(out) })
+			telemetry := b.telemetry.ForStage(stageID, pe.stageType, func() int { return len(in) })
+			defer pe.stats.started(func() int { return len(in) })()
 			// TODO: replace batcher by rewriting the different extractor implementations
 			// to keep the status while processing flows one by one
 			utils.Batcher(utils.ExitChannel(), b.batchMaxLen, b.batchTimeout, in,
 				func(maps []config.GenericMap) {
+					start := time.Now()
+					pe.mutex.Lock()
 					outs := pe.Extractor.Extract(maps)
+					pe.mutex.Unlock()
+					pe.stats.processed.Add(int64(len(maps)))
+					telemetry.Processed(len(maps))
+					telemetry.Observe(time.Since(start))
 					for _, o := range outs {
 						out <- o
 					}
@@ -388,16 +775,66 @@ func (b *builder) getStageNode(pe *pipelineEntry, stageID string) (interface{},
 	return stage, nil
 }
 
+// getWorkersNode runs a stateless transformer in several goroutines, all reading the stage input and writing
+// to the stage output: the flows are not kept in order, but the outputs of a flow are sent in order
+func (b *builder) getWorkersNode(pe *pipelineEntry, stageID string) *node.Middle[config.GenericMap, config.GenericMap] {
+	return node.AsMiddle(func(in <-chan config.GenericMap, out chan<- config.GenericMap) {
+		in = b.boundedInput(pe, stageID, in)
+		b.opMetrics.CreateInQueueSizeGauge(stageID, func() int { return len(in) })
+		b.opMetrics.CreateOutQueueSizeGauge(stageID, func() int { return len(out) })
+		telemetry := b.telemetry.ForStage(stageID, pe.stageType, func() int { return len(in) })
+		defer pe.stats.started(func() int { return len(in) })()
+		var wg sync.WaitGroup
+		for w := 0; w < pe.workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range in {
+					b.runMeasured(pe, stageID, telemetry, func() {
+						pe.mutex.RLock()
+						if multi, ok := pe.Transformer.(transform.MultiTransformer); ok {
+							outputs := multi.TransformMulti(i)
+							pe.mutex.RUnlock()
+							for _, o := range outputs {
+								out <- o
+							}
+							return
+						}
+						transformed, ok := pe.Transformer.Transform(i)
+						pe.mutex.RUnlock()
+						if ok {
+							out <- transformed
+						}
+					})
+				}
+			}()
+		}
+		wg.Wait()
+	}, node.ChannelBufferLen(b.nodeBufferLen))
+}
+
 func getIngester(opMetrics *operational.Metrics, params config.StageParam) (ingest.Ingester, error) {
+	if limit := params.Ingest.RateLimit; limit != nil {
+		switch params.Ingest.Type {
+		case api.CollectorType, api.SFlowType, api.KafkaType:
+		default:
+			return nil, fmt.Errorf("rateLimit is not supported by the %s ingester", params.Ingest.Type)
+		}
+		if err := limit.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	var ingester ingest.Ingester
 	var err error
 	switch params.Ingest.Type {
 	case api.FileType, api.FileLoopType, api.FileChunksType:
-		ingester, err = ingest.NewIngestFile(params)
+		ingester, err = ingest.NewIngestFile(opMetrics, params)
 	case api.SyntheticType:
 		ingester, err = ingest.NewIngestSynthetic(opMetrics, params)
 	case api.CollectorType:
 		ingester, err = ingest.NewIngestCollector(opMetrics, params)
+	case api.SFlowType:
+		ingester, err = ingest.NewIngestSFlow(opMetrics, params)
 	case api.StdinType:
 		ingester, err = ingest.NewIngestStdin(opMetrics, params)
 	case api.KafkaType:
@@ -409,6 +846,9 @@ func getIngester(opMetrics *operational.Metrics, params config.StageParam) (inge
 	default:
 		panic(fmt.Sprintf("`ingest` type %s not defined", params.Ingest.Type))
 	}
+	if err == nil && params.Ingest.Sampling != nil {
+		ingester, err = ingest.WithSampling(opMetrics, params.Name, ingester, params.Ingest.Sampling)
+	}
 	return ingester, err
 }
 
@@ -426,11 +866,22 @@ func getWriter(opMetrics *operational.Metrics, params config.StageParam) (write.
 		writer, err = write.NewWriteLoki(opMetrics, params)
 	case api.IpfixType:
 		writer, err = write.NewWriteIpfix(params)
+	case api.ClickHouseType:
+		writer, err = write.NewWriteClickHouse(opMetrics, params)
+	case api.InfluxDBType:
+		writer, err = write.NewWriteInfluxDB(opMetrics, params)
+	case api.PcapType:
+		writer, err = write.NewWritePcap(params)
+	case api.S3Type:
+		writer, err = write.NewWriteS3(opMetrics, params)
 	case api.FakeType:
 		writer, err = write.NewWriteFake(params)
 	default:
 		panic(fmt.Sprintf("`write` type %s not defined; if no writer needed, specify `none`", params.Write.Type))
 	}
+	if err == nil && params.Write.DeadLetterQueue != nil {
+		writer, err = write.WithDeadLetterQueue(opMetrics, params.Name, writer, params.Write.DeadLetterQueue)
+	}
 	return writer, err
 }
 
@@ -439,11 +890,17 @@ func getTransformer(opMetrics *operational.Metrics, params config.StageParam) (t
 	var err error
 	switch params.Transform.Type {
 	case api.GenericType:
-		transformer, err = transform.NewTransformGeneric(params)
+		transformer, err = transform.NewTransformGeneric(params, opMetrics)
 	case api.FilterType:
 		transformer, err = transform.NewTransformFilter(params)
 	case api.NetworkType:
 		transformer, err = transform.NewTransformNetwork(params, opMetrics)
+	case api.DedupeType:
+		transformer, err = transform.NewTransformDedupe(params, opMetrics)
+	case api.BiflowType:
+		transformer, err = transform.NewTransformBiflow(params)
+	case api.ExplodeType:
+		transformer, err = transform.NewTransformExplode(params)
 	case api.NoneType:
 		transformer, err = transform.NewTransformNone()
 	default:
@@ -459,7 +916,7 @@ func getExtractor(opMetrics *operational.Metrics, params config.StageParam) (ext
 	case api.NoneType:
 		extractor, _ = extract.NewExtractNone()
 	case api.AggregateType:
-		extractor, err = extract.NewExtractAggregate(params)
+		extractor, err = extract.NewExtractAggregate(opMetrics, params)
 	case api.ConnTrackType:
 		extractor, err = conntrack.NewConnectionTrack(opMetrics, params, clock.New())
 	case api.TimebasedType:
@@ -480,6 +937,8 @@ func getEncoder(opMetrics *operational.Metrics, params config.StageParam) (encod
 		encoder, err = encode.NewEncodeKafka(opMetrics, params)
 	case api.S3Type:
 		encoder, err = encode.NewEncodeS3(opMetrics, params)
+	case api.CSVType:
+		encoder, err = encode.NewEncodeCSV(opMetrics, params)
 	case api.OtlpLogsType:
 		encoder, err = opentelemetry.NewEncodeOtlpLogs(opMetrics, params)
 	case api.OtlpMetricsType:
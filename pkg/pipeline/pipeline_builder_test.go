@@ -99,3 +99,39 @@ pipeline:
 		})
 	}
 }
+
+func TestConnectionVerification_AllProblems(t *testing.T) {
+	_, cfg := test.InitConfig(t, baseConfig+`- transform:
+    type: none
+  name: transform1
+- transform:
+    type: none
+  name: transform2
+- transform:
+    type: none
+  name: transform3
+pipeline:
+- { follows: ingest1, name: write1 }
+- { follows: transform2, name: transform1 }
+- { follows: transform1, name: transform2 }
+- { followsList: [transform2, missing], name: transform3 }
+- { follows: transform3, name: write1 }
+- { follows: ingest1, name: write2 }
+`)
+	_, err := NewPipeline(cfg)
+	require.Error(t, err)
+
+	var stages []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var castErr *Error
+		require.True(t, errors.As(e, &castErr), e.Error())
+		stages = append(stages, castErr.StageName)
+	}
+	assert.Equal(t, []string{"transform1", "transform2", "transform3", "transform3", "write2", "transform1"}, stages)
+	assert.Equal(t, `pipeline stage "transform1": stage is not reachable from any ingest stage
+pipeline stage "transform2": stage is not reachable from any ingest stage
+pipeline stage "transform3": follows unknown stage "missing"
+pipeline stage "transform3": stage is not reachable from any ingest stage
+pipeline stage "write2": stage has no parameters
+pipeline stage "transform1": stages form a cycle: transform1 -> transform2 -> transform1`, err.Error())
+}
@@ -0,0 +1,249 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	putils "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	configMapMinBackoff = time.Second
+	configMapMaxBackoff = time.Minute
+)
+
+// ConfigMapSource reads the configuration file from a ConfigMap, and watches its updates for hot reloads.
+// It also serves the dynamic parameters ConfigMap.
+type ConfigMapSource struct {
+	client     typedcorev1.ConfigMapInterface
+	name       string
+	key        string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// mutex protects the last content read, as the admin API reads the ConfigMap while it is watched
+	mutex   sync.Mutex
+	content string
+}
+
+// NewConfigMapSource connects to the ConfigMap referenced as <namespace>/<name>, or <namespace>/<name>/<key> when
+// the ConfigMap holds several files, with the in-cluster Kubernetes client unless a kubeconfig is found
+func NewConfigMapSource(ref string) (*ConfigMapSource, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+		return nil, fmt.Errorf("invalid ConfigMap %q: expecting <namespace>/<name> or <namespace>/<name>/<key>", ref)
+	}
+	client, err := configMapsClient("", parts[0])
+	if err != nil {
+		return nil, err
+	}
+	key := ""
+	if len(parts) == 3 {
+		key = parts[2]
+	}
+	return newConfigMapSource(client, parts[1], key), nil
+}
+
+// configMapsClient connects to the ConfigMaps of the namespace, with the kubeconfig if any, or in-cluster
+func configMapsClient(kubeConfigPath, namespace string) (typedcorev1.ConfigMapInterface, error) {
+	kubeConfig, err := utils.LoadK8sConfig(kubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return clientset.CoreV1().ConfigMaps(namespace), nil
+}
+
+func newConfigMapSource(client typedcorev1.ConfigMapInterface, name, key string) *ConfigMapSource {
+	return &ConfigMapSource{
+		client:     client,
+		name:       name,
+		key:        key,
+		minBackoff: configMapMinBackoff,
+		maxBackoff: configMapMaxBackoff,
+	}
+}
+
+// Read fetches the configuration file from the ConfigMap
+func (s *ConfigMapSource) Read(ctx context.Context) ([]byte, error) {
+	cm, err := s.client.Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't read ConfigMap %s: %w", s.name, err)
+	}
+	content, err := s.configFile(cm)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	s.content = content
+	s.mutex.Unlock()
+	return []byte(content), nil
+}
+
+// configFile returns the configuration file held by the ConfigMap: the one of the key, or its only file
+func (s *ConfigMapSource) configFile(cm *corev1.ConfigMap) (string, error) {
+	if s.key != "" {
+		content, ok := cm.Data[s.key]
+		if !ok {
+			return "", fmt.Errorf("ConfigMap %s has no %s key", s.name, s.key)
+		}
+		return content, nil
+	}
+	if len(cm.Data) != 1 {
+		return "", fmt.Errorf("ConfigMap %s holds %d files: the key of the configuration must be given as <namespace>/<name>/<key>", s.name, len(cm.Data))
+	}
+	for _, content := range cm.Data {
+		return content, nil
+	}
+	return "", nil
+}
+
+// watch calls onChange with the new configuration file every time the ConfigMap content changes. The watch is
+// restarted when the API server closes it, and after an exponential back-off on errors.
+func (s *ConfigMapSource) watch(ctx context.Context, onChange func([]byte)) {
+	backoff := s.minBackoff
+	for {
+		err := s.watchOnce(ctx, onChange)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			backoff = s.minBackoff
+			continue
+		}
+		log.WithError(err).Warnf("can't watch ConfigMap %s, retrying in %v", s.name, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, s.maxBackoff)
+	}
+}
+
+// watchOnce reads the ConfigMap again, in case it changed while it wasn't watched, then watches it until the watch
+// is closed or fails
+func (s *ConfigMapSource) watchOnce(ctx context.Context, onChange func([]byte)) error {
+	cm, err := s.client.Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	s.update(cm, onChange)
+	watcher, err := s.client.Watch(ctx, metav1.SingleObject(metav1.ObjectMeta{Name: s.name, ResourceVersion: cm.ResourceVersion}))
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, open := <-watcher.ResultChan():
+			if !open {
+				return nil
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if cm, ok := event.Object.(*corev1.ConfigMap); ok {
+					s.update(cm, onChange)
+				}
+			case watch.Deleted:
+				log.Warningf("ConfigMap %s was deleted, keeping the current configuration", s.name)
+			case watch.Error:
+				return apierrors.FromObject(event.Object)
+			}
+		}
+	}
+}
+
+func (s *ConfigMapSource) update(cm *corev1.ConfigMap, onChange func([]byte)) {
+	content, err := s.configFile(cm)
+	if err != nil {
+		log.WithError(err).Error("can't reload pipeline")
+		return
+	}
+	s.mutex.Lock()
+	changed := content != s.content
+	s.content = content
+	s.mutex.Unlock()
+	if changed {
+		onChange([]byte(content))
+	}
+}
+
+// exitContext returns a context that is cancelled when the process exits
+func exitContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := putils.ExitChannel()
+	go func() {
+		<-exit
+		cancel()
+	}()
+	return ctx
+}
+
+// ReloadFromConfigMap reads the configuration file of the ConfigMap and applies its parameters to the running pipeline
+func (p *Pipeline) ReloadFromConfigMap(ctx context.Context, source *ConfigMapSource) error {
+	// the ConfigMap is read under the lock, so that a watch event applied meanwhile isn't overwritten by older content
+	p.reloadMutex.Lock()
+	defer p.reloadMutex.Unlock()
+	content, err := source.Read(ctx)
+	if err != nil {
+		return err
+	}
+	return p.reloadFromConfigMapContent(source, content)
+}
+
+// reloadFromConfigMapContent applies the configuration file read from the ConfigMap; the reload mutex must be held
+func (p *Pipeline) reloadFromConfigMapContent(source *ConfigMapSource, content []byte) error {
+	params, err := config.ParseStageParams(content)
+	if err != nil {
+		return err
+	}
+	log.Infof("reloading pipeline from ConfigMap %s", source.name)
+	p.reload(params)
+	return nil
+}
+
+// WatchConfigMap reloads the configuration file of the ConfigMap every time it changes
+func (p *Pipeline) WatchConfigMap(source *ConfigMapSource) {
+	go source.watch(exitContext(), func(content []byte) {
+		p.reloadMutex.Lock()
+		defer p.reloadMutex.Unlock()
+		if err := p.reloadFromConfigMapContent(source, content); err != nil {
+			log.WithError(err).Error("can't reload pipeline")
+		}
+	})
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/ingest"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeConfigMaps serves a single ConfigMap, and fails the first watches
+type fakeConfigMaps struct {
+	typedcorev1.ConfigMapInterface
+	mu           sync.Mutex
+	cm           *corev1.ConfigMap
+	watchErrors  int
+	watchCalls   int
+	watcher      *watch.FakeWatcher
+	watcherReady chan struct{}
+}
+
+func newFakeConfigMaps(data map[string]string, watchErrors int) *fakeConfigMaps {
+	return &fakeConfigMaps{
+		cm: &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "flp-config", Namespace: "netobserv", ResourceVersion: "1"},
+			Data:       data,
+		},
+		watchErrors:  watchErrors,
+		watcherReady: make(chan struct{}),
+	}
+}
+
+func (f *fakeConfigMaps) Get(_ context.Context, _ string, _ metav1.GetOptions) (*corev1.ConfigMap, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cm.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) Watch(_ context.Context, _ metav1.ListOptions) (watch.Interface, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.watchCalls++
+	if f.watchCalls <= f.watchErrors {
+		return nil, errors.New("connection refused")
+	}
+	f.watcher = watch.NewFake()
+	close(f.watcherReady)
+	return f.watcher, nil
+}
+
+func (f *fakeConfigMaps) modify(data map[string]string) {
+	f.mu.Lock()
+	cm := f.cm.DeepCopy()
+	cm.Data = data
+	cm.ResourceVersion = "2"
+	f.cm = cm
+	watcher := f.watcher
+	f.mu.Unlock()
+	watcher.Modify(cm.DeepCopy())
+}
+
+func TestReloadFromConfigMap(t *testing.T) {
+	client := newFakeConfigMaps(map[string]string{"config.yaml": strings.Replace(testConfigReload, "PROTO", "17", 1)}, 2)
+	source := newConfigMapSource(client, "flp-config", "")
+	source.minBackoff, source.maxBackoff = time.Millisecond, 2*time.Millisecond
+	content, err := source.Read(context.Background())
+	require.NoError(t, err)
+	_, cfg := test.InitConfig(t, string(content))
+
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	go mainPipeline.Run()
+	mainPipeline.WatchConfigMap(source)
+
+	fake := mainPipeline.pipelineStages[0].Ingester.(*ingest.Fake)
+	writer := mainPipeline.pipelineStages[2].Writer.(*write.Fake)
+	fake.In <- config.GenericMap{"Proto": 6.0}
+	fake.In <- config.GenericMap{"Proto": 17.0}
+	require.Eventually(t, func() bool { return len(writer.AllRecords()) == 1 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, 6.0, writer.AllRecords()[0]["Proto"])
+
+	// the watch is retried after the failures, then the update is applied without restarting
+	select {
+	case <-client.watcherReady:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "ConfigMap not watched")
+	}
+	client.modify(map[string]string{"config.yaml": strings.Replace(testConfigReload, "PROTO", "6", 1)})
+	require.Eventually(t, func() bool {
+		fake.In <- config.GenericMap{"Proto": 17.0}
+		for _, r := range writer.AllRecords() {
+			if r["Proto"] == 17.0 {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Same(t, fake, mainPipeline.pipelineStages[0].Ingester)
+}
+
+func TestAdminAPI_ReloadFromConfigMap(t *testing.T) {
+	client := newFakeConfigMaps(map[string]string{"config.yaml": strings.Replace(testConfigReload, "PROTO", "17", 1)}, 0)
+	source := newConfigMapSource(client, "flp-config", "")
+	content, err := source.Read(context.Background())
+	require.NoError(t, err)
+	_, cfg := test.InitConfig(t, string(content))
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	go mainPipeline.Run()
+	server := httptest.NewServer(mainPipeline.AdminHandler(func(ctx context.Context) error {
+		return mainPipeline.ReloadFromConfigMap(ctx, source)
+	}, ""))
+	defer server.Close()
+
+	// the admin API reads the ConfigMap again, without waiting for the watch
+	client.mu.Lock()
+	client.cm.Data = map[string]string{"config.yaml": strings.Replace(testConfigReload, "PROTO", "6", 1)}
+	client.mu.Unlock()
+	code, _ := adminRequest(t, http.MethodPost, server.URL+"/api/v1/reload", "")
+	require.Equal(t, http.StatusNoContent, code)
+
+	fake := mainPipeline.pipelineStages[0].Ingester.(*ingest.Fake)
+	writer := mainPipeline.pipelineStages[2].Writer.(*write.Fake)
+	fake.In <- config.GenericMap{"Proto": 6.0}
+	fake.In <- config.GenericMap{"Proto": 17.0}
+	require.Eventually(t, func() bool { return len(writer.AllRecords()) == 1 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, 17.0, writer.AllRecords()[0]["Proto"])
+}
+
+func TestDynamicParameters_RetryWatch(t *testing.T) {
+	_, cfg := test.InitConfig(t, strings.Replace(testConfigReload, "PROTO", "17", 1))
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	go mainPipeline.Run()
+
+	// the dynamic parameters are applied once the watch succeeds after the failures
+	client := newFakeConfigMaps(map[string]string{"params.json": `{"parameters":[]}`}, 2)
+	source := newConfigMapSource(client, "flp-config", "params.json")
+	source.minBackoff, source.maxBackoff = time.Millisecond, 2*time.Millisecond
+	pcw := &pipelineConfigWatcher{source: source, pipeline: mainPipeline}
+	go pcw.Run()
+	select {
+	case <-client.watcherReady:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "ConfigMap not watched")
+	}
+	client.modify(map[string]string{"params.json": `{"parameters":[{"name":"filter","transform":{"type":"filter","filter":` +
+		`{"rules":[{"type":"remove_entry_if_equal","removeEntry":{"input":"Proto","value":6}}]}}}]}`})
+
+	fake := mainPipeline.pipelineStages[0].Ingester.(*ingest.Fake)
+	writer := mainPipeline.pipelineStages[2].Writer.(*write.Fake)
+	require.Eventually(t, func() bool {
+		fake.In <- config.GenericMap{"Proto": 17.0}
+		return len(writer.AllRecords()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestConfigMapSource_ConfigFile(t *testing.T) {
+	cm := &corev1.ConfigMap{Data: map[string]string{"config.yaml": "a", "other.yaml": "b"}}
+
+	content, err := newConfigMapSource(nil, "flp-config", "other.yaml").configFile(cm)
+	require.NoError(t, err)
+	require.Equal(t, "b", content)
+
+	_, err = newConfigMapSource(nil, "flp-config", "missing.yaml").configFile(cm)
+	require.ErrorContains(t, err, "has no missing.yaml key")
+
+	_, err = newConfigMapSource(nil, "flp-config", "").configFile(cm)
+	require.ErrorContains(t, err, "holds 2 files")
+
+	delete(cm.Data, "other.yaml")
+	content, err = newConfigMapSource(nil, "flp-config", "").configFile(cm)
+	require.NoError(t, err)
+	require.Equal(t, "a", content)
+}
+
+func TestNewConfigMapSource_InvalidRef(t *testing.T) {
+	for _, ref := range []string{"flp-config", "netobserv/", "/flp-config", "netobserv/flp-config/", "a/b/c/d"} {
+		_, err := NewConfigMapSource(ref)
+		require.ErrorContains(t, err, "invalid ConfigMap", ref)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/extract"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/ingest"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reload applies the stage parameters to the running pipeline. Only the stages that can be
+// changed without reconnecting are updated: transform, extract aggregates, encode and write.
+// Stages can't be added or removed, and the pipeline connections stay unchanged.
+func (p *Pipeline) Reload(params []config.StageParam) {
+	p.reloadMutex.Lock()
+	defer p.reloadMutex.Unlock()
+	p.reload(params)
+}
+
+// reload applies the stage parameters; the reload mutex must be held
+func (p *Pipeline) reload(params []config.StageParam) {
+	for _, param := range params {
+		pEntry, ok := p.pipelineEntryMap[param.Name]
+		if !ok {
+			log.Warningf("Hot reloading can't add stage %s, restart is required", param.Name)
+			continue
+		}
+		pEntry.update(p.Metrics, param)
+	}
+}
+
+// ReloadFromFile reads the parameters of the configuration file and applies them to the running pipeline
+func (p *Pipeline) ReloadFromFile(path string) error {
+	p.reloadMutex.Lock()
+	defer p.reloadMutex.Unlock()
+	params, err := config.ReadStageParams(path)
+	if err != nil {
+		return err
+	}
+	log.Infof("reloading pipeline from %s", path)
+	p.reload(params)
+	return nil
+}
+
+// WatchReloadSignal reloads the configuration file every time the process receives SIGHUP
+func (p *Pipeline) WatchReloadSignal(path string) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	exitChan := utils.ExitChannel()
+	go func() {
+		defer signal.Stop(sigChan)
+		for {
+			select {
+			case <-exitChan:
+				return
+			case <-sigChan:
+				if err := p.ReloadFromFile(path); err != nil {
+					log.WithError(err).Error("can't reload pipeline")
+				}
+			}
+		}
+	}()
+}
+
+// update swaps the stage implementation for one built from param. The stage mutex is held during the
+// swap: the flow being processed completes with the previous rules, the following ones use the new rules.
+func (pe *pipelineEntry) update(opMetrics *operational.Metrics, param config.StageParam) {
+	// ingesters aren't rebuilt, but the definitions they read from files are reloaded even when the parameters
+	// didn't change
+	if reloader, ok := pe.Ingester.(ingest.Reloader); ok {
+		if err := reloader.Reload(); err != nil {
+			log.WithError(err).Errorf("Hot reloading failed for stage %s", pe.stageName)
+		}
+	}
+	if reflect.DeepEqual(pe.params, param) {
+		// unchanged transformers aren't rebuilt, but they read their files again
+		if reloader, ok := pe.Transformer.(transform.Reloader); ok {
+			if err := reloader.Reload(); err != nil {
+				log.WithError(err).Errorf("Hot reloading failed for stage %s", pe.stageName)
+			}
+		}
+		return
+	}
+	if stageType := findStageType(&param); stageType != pe.stageType {
+		log.Warningf("Hot reloading can't change stage %s from %s to %s", pe.stageName, pe.stageType, stageType)
+		return
+	}
+	defer func() {
+		// building stages panics on undefined types: a bad reload must not stop the pipeline
+		if r := recover(); r != nil {
+			log.Errorf("Hot reloading failed for stage %s: %v", pe.stageName, r)
+		}
+	}()
+	// the rebuilt stage updates the metrics registered by the stage it replaces
+	opMetrics = opMetrics.ForReload()
+	var err error
+	// the replaced stage is closed once swapped, to release its connections and goroutines
+	var replaced any
+	switch pe.stageType {
+	case StageTransform:
+		transformer, terr := getTransformer(opMetrics, param)
+		if _, holder := transformer.(transform.Holder); terr == nil && holder && pe.workers > 1 {
+			terr = fmt.Errorf("%s transform holds flows across records and can't run with %d workers", param.Transform.Type, pe.workers)
+		}
+		if err = terr; err == nil {
+			pe.mutex.Lock()
+			replaced, pe.Transformer = pe.Transformer, transformer
+			pe.mutex.Unlock()
+			pe.updateContributor()
+		}
+	case StageWrite:
+		writer, werr := getWriter(opMetrics, param)
+		if err = werr; err == nil {
+			pe.mutex.Lock()
+			replaced, pe.Writer = pe.Writer, writer
+			pe.mutex.Unlock()
+			pe.updateContributor()
+		}
+	case StageEncode:
+		pe.mutex.Lock()
+		pe.Encoder.Update(param)
+		pe.mutex.Unlock()
+	case StageExtract:
+		updater, ok := pe.Extractor.(extract.Updater)
+		if !ok || param.Extract.Type != api.AggregateType {
+			log.Warningf("Hot reloading not supported for %s extractor %s, restart is required", pe.params.Extract.Type, pe.stageName)
+			return
+		}
+		pe.mutex.Lock()
+		err = updater.Update(param)
+		pe.mutex.Unlock()
+	default:
+		log.Warningf("Hot reloading not supported for %s stage %s, restart is required", pe.stageType, pe.stageName)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Errorf("Hot reloading failed for stage %s, keeping the previous configuration", pe.stageName)
+		return
+	}
+	pe.params = param
+	log.Infof("Hot reloaded stage %s", pe.stageName)
+	if closer, ok := replaced.(io.Closer); ok {
+		// closing may wait for the pending flows to be sent: the reload doesn't wait for it
+		go func() {
+			if err := closer.Close(); err != nil {
+				log.WithError(err).Warnf("can't close the previous implementation of stage %s", pe.stageName)
+			}
+		}()
+	}
+}
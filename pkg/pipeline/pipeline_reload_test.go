@@ -0,0 +1,375 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/extract"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/ingest"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigReload = `---
+pipeline:
+  - name: ingest_fake
+  - follows: ingest_fake
+    name: filter
+  - follows: filter
+    name: write_fake
+parameters:
+  - name: ingest_fake
+    ingest:
+      type: fake
+  - name: filter
+    transform:
+      type: filter
+      filter:
+        rules:
+          - type: remove_entry_if_equal
+            removeEntry:
+              input: Proto
+              value: PROTO
+  - name: write_fake
+    write:
+      type: fake
+`
+
+// runPipeline runs the pipeline, and stops it at the end of the test by closing the input of its fake ingester
+func runPipeline(t *testing.T, p *Pipeline) *ingest.Fake {
+	fake := p.pipelineStages[0].Ingester.(*ingest.Fake)
+	done := make(chan struct{})
+	go func() {
+		p.Run()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(fake.In)
+		<-done
+	})
+	return fake
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	_, cfg := test.InitConfig(t, strings.Replace(testConfigReload, "PROTO", "17", 1))
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	fake := runPipeline(t, mainPipeline)
+	writer := mainPipeline.pipelineStages[2].Writer.(*write.Fake)
+
+	// the new configuration removes TCP instead of UDP, and tries to change the ingester
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	reloaded := strings.Replace(testConfigReload, "PROTO", "6", 1)
+	reloaded = strings.Replace(reloaded, "type: fake\n  - name: filter", "type: stdin\n  - name: filter", 1)
+	require.NoError(t, os.WriteFile(path, []byte(reloaded), 0o600))
+	mainPipeline.WatchReloadSignal(path)
+
+	// send ICMP, TCP and UDP flows while the configuration is reloaded
+	var sent int64
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for id := 0; ; id++ {
+			select {
+			case <-stop:
+				return
+			case fake.In <- config.GenericMap{"ID": id, "Proto": []float64{1, 6, 17}[id%3]}:
+				atomic.StoreInt64(&sent, int64(id+1))
+				time.Sleep(100 * time.Microsecond)
+			}
+		}
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&sent) > 100 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool {
+		for _, r := range writer.AllRecords() {
+			if r["Proto"] == 17.0 {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, time.Millisecond)
+	close(stop)
+	<-stopped
+
+	total := int(atomic.LoadInt64(&sent))
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&fake.Count) == int64(total) }, 5*time.Second, time.Millisecond)
+	// ICMP flows pass both filters and are written exactly once, in order
+	var records []config.GenericMap
+	require.Eventually(t, func() bool {
+		records = writer.AllRecords()
+		icmp := 0
+		for _, r := range records {
+			if r["Proto"] == 1.0 {
+				icmp++
+			}
+		}
+		return icmp == (total+2)/3
+	}, 5*time.Second, time.Millisecond)
+	lastID := -1
+	reloadedAt := -1
+	for i, r := range records {
+		id := r["ID"].(int)
+		require.Greater(t, id, lastID, "flows must be written once, in order")
+		lastID = id
+		switch r["Proto"] {
+		case 6.0:
+			require.Equal(t, -1, reloadedAt, "TCP flow %d written after the reload", id)
+		case 17.0:
+			if reloadedAt == -1 {
+				reloadedAt = i
+			}
+		}
+	}
+	require.NotEqual(t, -1, reloadedAt)
+
+	// the ingester can't be reloaded and is kept
+	require.Same(t, fake, mainPipeline.pipelineStages[0].Ingester)
+}
+
+func TestReload_Aggregates(t *testing.T) {
+	_, cfg := test.InitConfig(t, `---
+pipeline:
+  - name: ingest_fake
+  - follows: ingest_fake
+    name: aggregate
+  - follows: aggregate
+    name: write_fake
+parameters:
+  - name: ingest_fake
+    ingest:
+      type: fake
+  - name: aggregate
+    extract:
+      type: aggregates
+      aggregates:
+        rules:
+          - name: bytes
+            groupByKeys: [SrcAddr]
+            operationType: sum
+            operationKey: Bytes
+  - name: write_fake
+    write:
+      type: fake
+`)
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	entry := mainPipeline.pipelineEntryMap["aggregate"]
+	extractor := entry.Extractor
+	require.Len(t, extractor.Extract([]config.GenericMap{{"SrcAddr": "10.0.0.1", "Bytes": 10}}), 1)
+
+	params := entry.params
+	params.Extract = &config.Extract{Type: params.Extract.Type, Aggregates: params.Extract.Aggregates}
+	rules := append(params.Extract.Aggregates.Rules, params.Extract.Aggregates.Rules[0])
+	rules[1].Name = "bytes_copy"
+	aggs := *params.Extract.Aggregates
+	aggs.Rules = rules
+	params.Extract.Aggregates = &aggs
+	mainPipeline.Reload([]config.StageParam{params})
+
+	// the extractor is updated in place, and the unchanged aggregate keeps its state
+	require.Same(t, extractor, entry.Extractor)
+	require.Implements(t, (*extract.Updater)(nil), entry.Extractor)
+	metrics := extractor.Extract([]config.GenericMap{{"SrcAddr": "10.0.0.1", "Bytes": 5}})
+	require.Len(t, metrics, 2)
+	require.Equal(t, "bytes", metrics[0]["name"])
+	require.Equal(t, float64(15), metrics[0]["total_value"])
+	require.Equal(t, "bytes_copy", metrics[1]["name"])
+	require.Equal(t, float64(5), metrics[1]["total_value"])
+}
+
+func TestReload_Concurrent(t *testing.T) {
+	_, cfg := test.InitConfig(t, strings.Replace(testConfigReload, "PROTO", "17", 1))
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(testConfigReload, "PROTO", "6", 1)), 0o600))
+	params, err := config.ReadStageParams(path)
+	require.NoError(t, err)
+
+	// the reloads from the different sources are applied one at a time
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			mainPipeline.Reload(params)
+		}()
+		go func() {
+			defer wg.Done()
+			require.NoError(t, mainPipeline.ReloadFromFile(path))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, params[1], mainPipeline.pipelineEntryMap["filter"].params)
+}
+
+func TestReload_PromEncode(t *testing.T) {
+	_, cfg := test.InitConfig(t, `---
+pipeline:
+  - name: ingest_fake
+  - follows: ingest_fake
+    name: prom
+parameters:
+  - name: ingest_fake
+    ingest:
+      type: fake
+  - name: prom
+    encode:
+      type: prom
+      prom:
+        prefix: test_reload_
+        metrics:
+          - name: flows_total
+            type: counter
+            labels: [Proto]
+`)
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	fake := runPipeline(t, mainPipeline)
+
+	params := mainPipeline.pipelineEntryMap["prom"].params
+	prom := *params.Encode.Prom
+	prom.Metrics = append(prom.Metrics, prom.Metrics[0])
+	prom.Metrics[1].Name = "flows_copy_total"
+	params.Encode = &config.Encode{Type: params.Encode.Type, Prom: &prom}
+
+	// the update is applied without waiting for flows
+	reloaded := make(chan struct{})
+	go func() {
+		mainPipeline.Reload([]config.StageParam{params})
+		close(reloaded)
+	}()
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "reload didn't complete")
+	}
+	require.Equal(t, params, mainPipeline.pipelineEntryMap["prom"].params)
+
+	// flows keep being encoded after the update
+	fake.In <- config.GenericMap{"Proto": 6.0}
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&fake.Count) == 1 }, 5*time.Second, time.Millisecond)
+}
+
+type closingTransformer struct {
+	closed chan struct{}
+}
+
+func (c *closingTransformer) Transform(in config.GenericMap) (config.GenericMap, bool) {
+	return in, true
+}
+
+func (c *closingTransformer) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestReload_ClosesReplacedStage(t *testing.T) {
+	previous := &closingTransformer{closed: make(chan struct{})}
+	pe := &pipelineEntry{
+		stageName:   "transform",
+		stageType:   StageTransform,
+		Transformer: previous,
+		params:      config.StageParam{Name: "transform", Transform: &config.Transform{Type: api.NoneType}},
+	}
+	param := config.StageParam{Name: "transform", Transform: &config.Transform{Type: api.FilterType, Filter: &api.TransformFilter{}}}
+	pe.update(operational.NewMetrics(&config.MetricsSettings{}), param)
+	require.Equal(t, param, pe.params)
+	require.NotSame(t, previous, pe.Transformer)
+	select {
+	case <-previous.closed:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the replaced transformer wasn't closed")
+	}
+}
+
+type reloadingIngester struct {
+	ingest.Fake
+	reloads atomic.Int32
+}
+
+func (r *reloadingIngester) Reload() error {
+	r.reloads.Add(1)
+	return nil
+}
+
+func TestReload_IngesterDefinitions(t *testing.T) {
+	ingester := &reloadingIngester{}
+	param := config.StageParam{Name: "ingest_fake", Ingest: &config.Ingest{Type: "fake"}}
+	pe := &pipelineEntry{stageName: "ingest_fake", stageType: StageIngest, Ingester: ingester, params: param}
+
+	// the definitions are read again even though the parameters are unchanged
+	pe.update(nil, param)
+	require.Equal(t, int32(1), ingester.reloads.Load())
+	require.Same(t, ingester, pe.Ingester)
+}
+
+type reloadingTransformer struct {
+	closingTransformer
+	reloads atomic.Int32
+}
+
+func (r *reloadingTransformer) Reload() error {
+	r.reloads.Add(1)
+	return nil
+}
+
+func TestReload_TransformerFiles(t *testing.T) {
+	transformer := &reloadingTransformer{}
+	param := config.StageParam{Name: "transform", Transform: &config.Transform{Type: api.NoneType}}
+	pe := &pipelineEntry{stageName: "transform", stageType: StageTransform, Transformer: transformer, params: param}
+
+	// unchanged transformers are kept, and read their files again
+	pe.update(nil, param)
+	require.Equal(t, int32(1), transformer.reloads.Load())
+	require.Same(t, transformer, pe.Transformer)
+}
+
+func TestReload_KeepsStageMetrics(t *testing.T) {
+	opMetrics := operational.NewMetrics(&config.MetricsSettings{})
+	jsonParams := func(output string) config.StageParam {
+		return config.StageParam{Name: "reload_json", Transform: &config.Transform{Type: api.GenericType, Generic: &api.TransformGeneric{
+			Rules: []api.GenericTransformRule{{Input: "metadata", Output: output, Operation: api.OperationJSON, Path: "$.app"}},
+		}}}
+	}
+	params := jsonParams("App")
+	transformer, err := getTransformer(opMetrics, params)
+	require.NoError(t, err)
+	pe := &pipelineEntry{stageName: params.Name, stageType: StageTransform, Transformer: transformer, params: params}
+
+	// the rebuilt stage counts its errors in the metrics exported for the stage it replaced
+	pe.update(opMetrics, jsonParams("Application"))
+	require.NotSame(t, transformer, pe.Transformer)
+	_, _ = pe.Transformer.Transform(config.GenericMap{"metadata": "not json"})
+	exposed := test.ReadExposedMetrics(t, prometheus.DefaultGatherer)
+	require.Regexp(t, `json_extract_errors_total\{[^}]*stage="reload_json"[^}]*\} 1`, exposed)
+}
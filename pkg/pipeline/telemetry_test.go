@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/ingest"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetry(t *testing.T) {
+	_, cfg := test.InitConfig(t, strings.Replace(testConfigReload, "PROTO", "17", 1))
+	cfg.Telemetry = &config.Telemetry{}
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, mainPipeline.Telemetry)
+	go mainPipeline.Run()
+
+	fake := mainPipeline.pipelineStages[0].Ingester.(*ingest.Fake)
+	writer := mainPipeline.pipelineStages[2].Writer.(*write.Fake)
+	for id := 0; id < 10; id++ {
+		fake.In <- config.GenericMap{"ID": id, "Proto": []float64{6, 17}[id%2]}
+	}
+	// UDP flows are filtered out
+	require.Eventually(t, func() bool { return len(writer.AllRecords()) == 5 }, 5*time.Second, 10*time.Millisecond)
+
+	var exposed string
+	require.Eventually(t, func() bool {
+		exposed = test.ReadExposedMetrics(t, mainPipeline.Telemetry.Registry)
+		return strings.Contains(exposed, `processing_duration_seconds_count{stage="write_fake",type="write"} 5`)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Contains(t, exposed, `flows_processed_total{stage="ingest_fake",type="ingest"} 10`)
+	require.Contains(t, exposed, `flows_processed_total{stage="filter",type="transform"} 10`)
+	require.Contains(t, exposed, `flows_processed_total{stage="write_fake",type="write"} 5`)
+	require.Contains(t, exposed, `processing_duration_seconds_count{stage="filter",type="transform"} 10`)
+	require.Contains(t, exposed, `channel_depth{stage="filter",type="transform"} 0`)
+	require.Contains(t, exposed, `errors_total{stage="write_fake",type="write"} 0`)
+}
+
+func TestTelemetry_Disabled(t *testing.T) {
+	_, cfg := test.InitConfig(t, strings.Replace(testConfigReload, "PROTO", "17", 1))
+	mainPipeline, err := NewPipeline(cfg)
+	require.NoError(t, err)
+	require.Nil(t, mainPipeline.Telemetry)
+	go mainPipeline.Run()
+
+	fake := mainPipeline.pipelineStages[0].Ingester.(*ingest.Fake)
+	writer := mainPipeline.pipelineStages[2].Writer.(*write.Fake)
+	fake.In <- config.GenericMap{"ID": 0, "Proto": 6.0}
+	require.Eventually(t, func() bool { return len(writer.AllRecords()) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
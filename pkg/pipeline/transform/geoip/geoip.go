@@ -0,0 +1,254 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	log = logrus.WithField("component", "transform.GeoIP")
+
+	lookupMissesDef = operational.DefineMetric(
+		"geoip_lookup_misses",
+		"Counter of GeoIP lookups that failed or did not find any record",
+		operational.TypeCounter,
+		"stage",
+	)
+)
+
+type Info struct {
+	Country string
+	ASN     uint
+	City    string
+	// Location is nil when the database has no coordinates for the IP
+	Location *Location
+}
+
+type Location struct {
+	Latitude  float64 `maxminddb:"latitude"`
+	Longitude float64 `maxminddb:"longitude"`
+}
+
+// record holds the subset of the GeoIP2 / GeoLite2 City, Country and ASN schemas that we use
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location *Location `maxminddb:"location"`
+	ASN      uint      `maxminddb:"autonomous_system_number"`
+}
+
+// reloadDelay is the time without change in the database directories to wait before reloading the files,
+// so that files being written are not loaded
+var reloadDelay = 2 * time.Second
+
+type DB struct {
+	dbPath    string
+	asnDBPath string
+	mutex     sync.RWMutex
+	reader    *maxminddb.Reader
+	asnReader *maxminddb.Reader
+	misses    prometheus.Counter
+	watcher   *fsnotify.Watcher
+	// done stops the file watching goroutine when the database is closed
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewMissesCounter(opMetrics *operational.Metrics, stage string) prometheus.Counter {
+	return opMetrics.NewCounter(&lookupMissesDef, stage)
+}
+
+// Open opens the MaxMind databases; asnDBPath is optional
+func Open(dbPath, asnDBPath string, misses prometheus.Counter) (*DB, error) {
+	db := &DB{dbPath: dbPath, asnDBPath: asnDBPath, misses: misses, done: make(chan struct{})}
+	reader, asnReader, err := db.open()
+	if err != nil {
+		return nil, err
+	}
+	db.reader = reader
+	db.asnReader = asnReader
+	return db, nil
+}
+
+func (db *DB) open() (*maxminddb.Reader, *maxminddb.Reader, error) {
+	reader, err := maxminddb.Open(db.dbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening GeoIP database %q: %w", db.dbPath, err)
+	}
+	if db.asnDBPath == "" {
+		return reader, nil, nil
+	}
+	asnReader, err := maxminddb.Open(db.asnDBPath)
+	if err != nil {
+		_ = reader.Close()
+		return nil, nil, fmt.Errorf("opening GeoIP ASN database %q: %w", db.asnDBPath, err)
+	}
+	return reader, asnReader, nil
+}
+
+// Reload re-opens the database files. Lookups keep being served from the previous files until
+// the new ones are loaded; on error, the previous files remain in use.
+func (db *DB) Reload() error {
+	reader, asnReader, err := db.open()
+	if err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	oldReader, oldASNReader := db.reader, db.asnReader
+	db.reader, db.asnReader = reader, asnReader
+	db.mutex.Unlock()
+	closeReaders(oldReader, oldASNReader)
+	log.Infof("GeoIP database %q reloaded", db.dbPath)
+	return nil
+}
+
+// WatchFiles reloads the databases when their files change. The directories of the files are watched, rather
+// than the files, as they are usually replaced by a rename, or by a symbolic link swap on Kubernetes volumes.
+func (db *DB) WatchFiles() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{db.dbPath, db.asnDBPath} {
+		if path == "" {
+			continue
+		}
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			_ = watcher.Close()
+			return fmt.Errorf("watching GeoIP database %q: %w", path, err)
+		}
+	}
+	db.mutex.Lock()
+	db.watcher = watcher
+	db.mutex.Unlock()
+	go db.reloadOnChange(watcher)
+	return nil
+}
+
+func (db *DB) reloadOnChange(watcher *fsnotify.Watcher) {
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-utils.ExitChannel():
+			_ = watcher.Close()
+			return
+		case <-db.done:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Chmod) {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.WithError(err).Warn("error while watching GeoIP databases")
+		case <-timer.C:
+			if err := db.Reload(); err != nil {
+				log.WithError(err).Error("can't reload GeoIP database, keeping the previous one")
+			}
+		}
+	}
+}
+
+// Lookup returns the GeoIP information for the provided IP. Private, loopback and link-local
+// addresses are skipped and return nil without error.
+func (db *DB) Lookup(strIP string) (*Info, error) {
+	ip := net.ParseIP(strIP)
+	if ip == nil {
+		db.misses.Inc()
+		return nil, fmt.Errorf("invalid IP %q", strIP)
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return nil, nil
+	}
+
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	if db.reader == nil {
+		return nil, fmt.Errorf("GeoIP database %q is closed", db.dbPath)
+	}
+	var rec record
+	_, found, err := db.reader.LookupNetwork(ip, &rec)
+	if err != nil {
+		db.misses.Inc()
+		return nil, err
+	}
+	if db.asnReader != nil {
+		_, asnFound, err := db.asnReader.LookupNetwork(ip, &rec)
+		if err != nil {
+			db.misses.Inc()
+			return nil, err
+		}
+		found = found || asnFound
+	}
+	if !found {
+		db.misses.Inc()
+		return nil, fmt.Errorf("no GeoIP record found for IP %s", strIP)
+	}
+	return &Info{
+		Country:  rec.Country.ISOCode,
+		ASN:      rec.ASN,
+		City:     rec.City.Names["en"],
+		Location: rec.Location,
+	}, nil
+}
+
+// Close closes the databases and stops watching them
+func (db *DB) Close() {
+	db.closeOnce.Do(func() { close(db.done) })
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if db.watcher != nil {
+		_ = db.watcher.Close()
+		db.watcher = nil
+	}
+	closeReaders(db.reader, db.asnReader)
+	db.reader, db.asnReader = nil, nil
+}
+
+func closeReaders(readers ...*maxminddb.Reader) {
+	for _, r := range readers {
+		if r != nil {
+			if err := r.Close(); err != nil {
+				log.WithError(err).Warn("can't close GeoIP database")
+			}
+		}
+	}
+}
@@ -0,0 +1,296 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+type testEntry struct {
+	cidr string
+	data map[string]any
+}
+
+func cityData(country, city string) map[string]any {
+	return map[string]any{
+		"country": map[string]any{"iso_code": country},
+		"city":    map[string]any{"names": map[string]any{"en": city}},
+	}
+}
+
+func locatedCityData(country, city string, lat, lon float64) map[string]any {
+	data := cityData(country, city)
+	data["location"] = map[string]any{"latitude": lat, "longitude": lon}
+	return data
+}
+
+func asnData(asn uint32) map[string]any {
+	return map[string]any{"autonomous_system_number": asn}
+}
+
+// writeTestDB writes a minimal IPv6 MaxMind DB file (24 bits records), with IPv4 networks mapped into ::/96
+func writeTestDB(t *testing.T, path string, entries []testEntry) {
+	type rec struct {
+		node int // -1 for none
+		data int // -1 for none
+	}
+	empty := rec{node: -1, data: -1}
+	nodes := [][2]rec{{empty, empty}}
+	var data bytes.Buffer
+	for _, e := range entries {
+		_, ipNet, err := net.ParseCIDR(e.cidr)
+		require.NoError(t, err)
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP.To16()
+		if ipv4 := ipNet.IP.To4(); ipv4 != nil {
+			ip = append(make(net.IP, 12), ipv4...)
+			ones += 96
+		}
+		offset := data.Len()
+		encodeData(&data, e.data)
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = rec{node: -1, data: offset}
+			} else if next := nodes[node][bit].node; next >= 0 {
+				node = next
+			} else {
+				nodes = append(nodes, [2]rec{empty, empty})
+				nodes[node][bit] = rec{node: len(nodes) - 1, data: -1}
+				node = len(nodes) - 1
+			}
+		}
+	}
+
+	nodeCount := len(nodes)
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for _, r := range n {
+			v := nodeCount
+			if r.node >= 0 {
+				v = r.node
+			} else if r.data >= 0 {
+				v = nodeCount + 16 + r.data
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encodeData(&out, map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(6),
+		"database_type":               "Test",
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint32(time.Now().Unix()),
+	})
+
+	// write then rename, as the previous file may be memory-mapped
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, out.Bytes(), 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+}
+
+func encodeControl(buf *bytes.Buffer, typ byte, size int) {
+	switch {
+	case size < 29:
+		buf.WriteByte(typ<<5 | byte(size))
+	case size < 285:
+		buf.Write([]byte{typ<<5 | 29, byte(size - 29)})
+	default:
+		buf.Write([]byte{typ<<5 | 30, byte((size - 285) >> 8), byte(size - 285)})
+	}
+}
+
+func encodeUint(buf *bytes.Buffer, typ byte, v uint64, maxLen int) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	b = bytes.TrimLeft(b[8-maxLen:], "\x00")
+	encodeControl(buf, typ, len(b))
+	buf.Write(b)
+}
+
+func encodeData(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		encodeControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		encodeControl(buf, 3, 8)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case uint16:
+		encodeUint(buf, 5, uint64(v), 2)
+	case uint32:
+		encodeUint(buf, 6, uint64(v), 4)
+	case map[string]any:
+		encodeControl(buf, 7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeData(buf, k)
+			encodeData(buf, v[k])
+		}
+	default:
+		panic("unsupported type")
+	}
+}
+
+func setupDBs(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	cityPath := filepath.Join(dir, "city.mmdb")
+	asnPath := filepath.Join(dir, "asn.mmdb")
+	writeTestDB(t, cityPath, []testEntry{
+		{cidr: "81.2.69.0/24", data: locatedCityData("GB", "London", 51.5142, -0.0931)},
+		{cidr: "2001:db8:1::/48", data: cityData("FR", "Paris")},
+		// should never be looked up
+		{cidr: "10.0.0.0/8", data: cityData("ZZ", "Nowhere")},
+	})
+	writeTestDB(t, asnPath, []testEntry{
+		{cidr: "81.2.69.0/24", data: asnData(20712)},
+		{cidr: "2001:db8:1::/48", data: asnData(64496)},
+	})
+	return cityPath, asnPath
+}
+
+func newTestMisses() *operational.Metrics {
+	return operational.NewMetrics(&config.MetricsSettings{NoPanic: true})
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := dto.Metric{}
+	require.NoError(t, c.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func TestLookup(t *testing.T) {
+	cityPath, asnPath := setupDBs(t)
+	misses := NewMissesCounter(newTestMisses(), "test-lookup")
+	db, err := Open(cityPath, asnPath, misses)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// IPv4
+	info, err := db.Lookup("81.2.69.142")
+	require.NoError(t, err)
+	require.Equal(t, &Info{Country: "GB", ASN: 20712, City: "London", Location: &Location{Latitude: 51.5142, Longitude: -0.0931}}, info)
+
+	// IPv6
+	info, err = db.Lookup("2001:db8:1::10")
+	require.NoError(t, err)
+	require.Equal(t, &Info{Country: "FR", ASN: 64496, City: "Paris"}, info)
+
+	// Private addresses are ignored
+	for _, ip := range []string{"10.1.2.3", "192.168.0.1", "127.0.0.1", "fd00::1", "fe80::1"} {
+		info, err = db.Lookup(ip)
+		require.NoError(t, err)
+		require.Nil(t, info, ip)
+	}
+	require.Equal(t, 0.0, counterValue(t, misses))
+
+	// Not found & invalid
+	_, err = db.Lookup("8.8.8.8")
+	require.Error(t, err)
+	_, err = db.Lookup("not-an-ip")
+	require.Error(t, err)
+	require.Equal(t, 2.0, counterValue(t, misses))
+}
+
+func TestLookupWithoutASNDB(t *testing.T) {
+	cityPath, _ := setupDBs(t)
+	db, err := Open(cityPath, "", NewMissesCounter(newTestMisses(), "test-no-asn"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	info, err := db.Lookup("81.2.69.142")
+	require.NoError(t, err)
+	require.Equal(t, &Info{Country: "GB", City: "London", Location: &Location{Latitude: 51.5142, Longitude: -0.0931}}, info)
+}
+
+func TestOpenError(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing.mmdb"), "", nil)
+	require.Error(t, err)
+}
+
+func TestReload(t *testing.T) {
+	cityPath, asnPath := setupDBs(t)
+	db, err := Open(cityPath, asnPath, NewMissesCounter(newTestMisses(), "test-reload"))
+	require.NoError(t, err)
+
+	info, err := db.Lookup("81.2.69.142")
+	require.NoError(t, err)
+	require.Equal(t, "London", info.City)
+
+	writeTestDB(t, cityPath, []testEntry{
+		{cidr: "81.2.69.0/24", data: cityData("GB", "Manchester")},
+	})
+	require.NoError(t, db.Reload())
+	info, err = db.Lookup("81.2.69.142")
+	require.NoError(t, err)
+	require.Equal(t, "Manchester", info.City)
+
+	// A broken file must not replace the current database
+	require.NoError(t, os.WriteFile(cityPath+".tmp", []byte("garbage"), 0o600))
+	require.NoError(t, os.Rename(cityPath+".tmp", cityPath))
+	require.Error(t, db.Reload())
+	info, err = db.Lookup("81.2.69.142")
+	require.NoError(t, err)
+	require.Equal(t, "Manchester", info.City)
+
+	// lookups fail once the database is closed
+	db.Close()
+	_, err = db.Lookup("81.2.69.142")
+	require.ErrorContains(t, err, "is closed")
+}
+
+func TestReloadOnFileChange(t *testing.T) {
+	defer func(delay time.Duration) { reloadDelay = delay }(reloadDelay)
+	reloadDelay = 50 * time.Millisecond
+	cityPath, asnPath := setupDBs(t)
+	db, err := Open(cityPath, asnPath, NewMissesCounter(newTestMisses(), "test-watch"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.WatchFiles())
+
+	writeTestDB(t, asnPath, []testEntry{
+		{cidr: "81.2.69.0/24", data: asnData(64500)},
+	})
+	require.Eventually(t, func() bool {
+		info, err := db.Lookup("81.2.69.142")
+		return err == nil && info.ASN == 64500 && info.City == "London"
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -1,24 +1,81 @@
 package kubernetes
 
 import (
+	"reflect"
 	"strings"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	inf "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/kubernetes/informers"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
 var informers inf.InformersInterface = &inf.Informers{}
 
+// running describes the started informers. They are shared by the network transforms, and kept when a
+// configuration reload rebuilds a transform.
+var running *informersConfig
+
+type informersConfig struct {
+	config              api.NetworkTransformKubeConfig
+	withNamespaces      bool
+	withNetworkPolicies bool
+}
+
+// covers tells whether the informers started with c provide what is needed by the other configuration
+func (c *informersConfig) covers(config api.NetworkTransformKubeConfig, withNamespaces, withNetworkPolicies bool) bool {
+	return reflect.DeepEqual(c.config, config) &&
+		(c.withNamespaces || !withNamespaces) &&
+		(c.withNetworkPolicies || !withNetworkPolicies)
+}
+
 // For testing
 func MockInformers() {
 	informers = inf.NewInformersMock()
+	running = nil
+}
+
+func InitFromConfig(config api.NetworkTransformKubeConfig, withNamespaces, withNetworkPolicies bool, opMetrics *operational.Metrics) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if running != nil {
+		if running.covers(config, withNamespaces, withNetworkPolicies) {
+			return nil
+		}
+		// the informers are started again with the missing ones; with another configuration, the last one wins
+		if reflect.DeepEqual(running.config, config) {
+			withNamespaces = withNamespaces || running.withNamespaces
+			withNetworkPolicies = withNetworkPolicies || running.withNetworkPolicies
+		}
+		logrus.Infof("starting kubernetes informers again for another network transform configuration")
+	}
+	// mocked informers are kept as they are
+	if _, mocked := informers.(*inf.Mock); !mocked {
+		if len(config.Clusters) > 0 {
+			informers = inf.NewMultiCluster()
+		} else if _, ok := informers.(*inf.MultiCluster); ok {
+			informers = &inf.Informers{}
+		}
+	}
+	if err := informers.InitFromConfig(config, withNamespaces, withNetworkPolicies, opMetrics); err != nil {
+		return err
+	}
+	running = &informersConfig{config: config, withNamespaces: withNamespaces, withNetworkPolicies: withNetworkPolicies}
+	return nil
 }
 
-func InitFromConfig(config api.NetworkTransformKubeConfig, opMetrics *operational.Metrics) error {
-	return informers.InitFromConfig(config, opMetrics)
+// clusterInformers returns the informers of a cluster when several clusters are configured, so that the objects
+// related to an enriched object are looked up in the same cluster
+func clusterInformers(clusterName string) inf.InformersInterface {
+	if mc, ok := informers.(*inf.MultiCluster); ok && clusterName != "" {
+		if k := mc.Cluster(clusterName); k != nil {
+			return k
+		}
+	}
+	return informers
 }
 
 func Enrich(outputEntry config.GenericMap, rule *api.K8sRule) {
@@ -28,6 +85,12 @@ func Enrich(outputEntry config.GenericMap, rule *api.K8sRule) {
 	}
 	potentialKeys := informers.BuildSecondaryNetworkKeys(outputEntry, rule)
 	kubeInfo, err := informers.GetInfo(potentialKeys, ip)
+	if rule.PortField != "" && (err != nil || kubeInfo.Type == inf.TypeNode) {
+		// Host-network Pods share their IP with the Node: when they declare the flow port, they take precedence
+		if hnInfo := getHostNetworkPod(outputEntry, rule.PortField, ip); hnInfo != nil {
+			kubeInfo, err = hnInfo, nil
+		}
+	}
 	if err != nil {
 		logrus.WithError(err).Tracef("can't find kubernetes info for keys %v and IP %s", potentialKeys, ip)
 		return
@@ -43,11 +106,19 @@ func Enrich(outputEntry config.GenericMap, rule *api.K8sRule) {
 		outputEntry[rule.Output+"_OwnerName"] = kubeInfo.Owner.Name
 		outputEntry[rule.Output+"_OwnerType"] = kubeInfo.Owner.Type
 		outputEntry[rule.Output+"_NetworkName"] = kubeInfo.NetworkName
+		if kubeInfo.ClusterName != "" {
+			outputEntry[rule.Output+"_ClusterName"] = kubeInfo.ClusterName
+		}
 		if rule.LabelsPrefix != "" {
 			for labelKey, labelValue := range kubeInfo.Labels {
 				outputEntry[rule.LabelsPrefix+"_"+labelKey] = labelValue
 			}
 		}
+		if rule.NamespaceLabelsPrefix != "" {
+			for labelKey, labelValue := range kubeInfo.NamespaceLabels {
+				outputEntry[rule.NamespaceLabelsPrefix+"_"+labelKey] = labelValue
+			}
+		}
 		if kubeInfo.HostIP != "" {
 			outputEntry[rule.Output+"_HostIP"] = kubeInfo.HostIP
 			if kubeInfo.HostName != "" {
@@ -77,11 +148,19 @@ func Enrich(outputEntry config.GenericMap, rule *api.K8sRule) {
 		outputEntry[rule.Output+"k8s.type"] = kubeInfo.Type
 		outputEntry[rule.Output+"k8s.owner.name"] = kubeInfo.Owner.Name
 		outputEntry[rule.Output+"k8s.owner.type"] = kubeInfo.Owner.Type
+		if kubeInfo.ClusterName != "" {
+			outputEntry[rule.Output+"k8s.cluster.name"] = kubeInfo.ClusterName
+		}
 		if rule.LabelsPrefix != "" {
 			for labelKey, labelValue := range kubeInfo.Labels {
 				outputEntry[rule.LabelsPrefix+"."+labelKey] = labelValue
 			}
 		}
+		if rule.NamespaceLabelsPrefix != "" {
+			for labelKey, labelValue := range kubeInfo.NamespaceLabels {
+				outputEntry[rule.NamespaceLabelsPrefix+"."+labelKey] = labelValue
+			}
+		}
 		if kubeInfo.HostIP != "" {
 			outputEntry[rule.Output+"k8s.host.ip"] = kubeInfo.HostIP
 			if kubeInfo.HostName != "" {
@@ -92,6 +171,23 @@ func Enrich(outputEntry config.GenericMap, rule *api.K8sRule) {
 	}
 }
 
+func getHostNetworkPod(outputEntry config.GenericMap, portField, ip string) *inf.Info {
+	rawPort, ok := outputEntry[portField]
+	if !ok {
+		return nil
+	}
+	port, err := utils.ConvertToInt(rawPort)
+	if err != nil || port == 0 {
+		return nil
+	}
+	info, err := informers.GetHostNetworkPodInfo(ip, port)
+	if err != nil {
+		logrus.WithError(err).Tracef("can't find host-network pod for IP %s and port %d", ip, port)
+		return nil
+	}
+	return info
+}
+
 const nodeZoneLabelName = "topology.kubernetes.io/zone"
 
 func fillInK8sZone(outputEntry config.GenericMap, rule *api.K8sRule, kubeInfo *inf.Info, zonePrefix string) {
@@ -107,7 +203,7 @@ func fillInK8sZone(outputEntry config.GenericMap, rule *api.K8sRule, kubeInfo *i
 		}
 		return
 	case inf.TypePod:
-		nodeInfo, err := informers.GetNodeInfo(kubeInfo.HostName)
+		nodeInfo, err := clusterInformers(kubeInfo.ClusterName).GetNodeInfo(kubeInfo.HostName)
 		if err != nil {
 			logrus.WithError(err).Tracef("can't find nodes info for node %v", kubeInfo.HostName)
 			return
@@ -5,6 +5,7 @@ import (
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	inf "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/kubernetes/informers"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -314,6 +315,31 @@ func TestEnrich_EmptyNamespace(t *testing.T) {
 	assert.NotContains(t, entry, "DstK8s_Namespace")
 }
 
+func TestEnrich_NamespaceLabels(t *testing.T) {
+	informers = inf.SetupStubs(map[string]*inf.Info{
+		"10.0.0.1": {
+			ObjectMeta:      v1.ObjectMeta{Name: "pod-1", Namespace: "ns-1", Labels: map[string]string{"app": "web"}},
+			Type:            "Pod",
+			NamespaceLabels: map[string]string{"team": "network", "environment": "prod"},
+		},
+	}, nil, nil)
+
+	entry := config.GenericMap{"SrcAddr": "10.0.0.1"}
+	Enrich(entry, &api.K8sRule{IPField: "SrcAddr", Output: "SrcK8s", LabelsPrefix: "SrcK8s_Labels", NamespaceLabelsPrefix: "SrcK8s_NamespaceLabels"})
+	assert.Equal(t, "web", entry["SrcK8s_Labels_app"])
+	assert.Equal(t, "network", entry["SrcK8s_NamespaceLabels_team"])
+	assert.Equal(t, "prod", entry["SrcK8s_NamespaceLabels_environment"])
+
+	// namespace labels are only copied when a prefix is set
+	entry = config.GenericMap{"SrcAddr": "10.0.0.1"}
+	Enrich(entry, &api.K8sRule{IPField: "SrcAddr", Output: "SrcK8s"})
+	assert.NotContains(t, entry, "SrcK8s_NamespaceLabels_team")
+
+	entry = config.GenericMap{"SrcAddr": "10.0.0.1"}
+	Enrich(entry, &api.K8sRule{IPField: "SrcAddr", Output: "source.", Assignee: "otel", NamespaceLabelsPrefix: "source.k8s.namespace.label"})
+	assert.Equal(t, "network", entry["source.k8s.namespace.label.team"])
+}
+
 func TestEnrichLayer(t *testing.T) {
 	rule := api.NetworkTransformRule{
 		KubernetesInfra: &api.K8sInfraRule{
@@ -557,3 +583,152 @@ func TestEnrichUsingUDN(t *testing.T) {
 		"DstK8s_NetworkName": "ns-2/primary-udn",
 	}, entry)
 }
+
+func TestEnrichHostNetworkPod(t *testing.T) {
+	withNode := map[string]*inf.Info{"100.0.0.1": nodes["host-1"]}
+	for ip, info := range ipInfo {
+		withNode[ip] = info
+	}
+	stubs := inf.SetupStubs(withNode, customKeysInfo, nodes)
+	stubs.AddHostNetworkPod("100.0.0.1", 9100, &inf.Info{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "node-exporter-1",
+			Namespace: "monitoring",
+		},
+		Type:        "Pod",
+		HostName:    "host-1",
+		HostIP:      "100.0.0.1",
+		NetworkName: "host",
+	})
+	informers = stubs
+	rule := api.K8sRule{
+		IPField:   "DstAddr",
+		PortField: "DstPort",
+		Output:    "DstK8s",
+	}
+
+	// Port declared by a host-network pod: pod takes precedence over node
+	entry := config.GenericMap{
+		"DstAddr": "100.0.0.1",
+		"DstPort": uint16(9100),
+	}
+	Enrich(entry, &rule)
+	assert.Equal(t, "node-exporter-1", entry["DstK8s_Name"])
+	assert.Equal(t, "Pod", entry["DstK8s_Type"])
+	assert.Equal(t, "monitoring", entry["DstK8s_Namespace"])
+	assert.Equal(t, "host", entry["DstK8s_NetworkName"])
+
+	// Other port: resolved as node
+	entry = config.GenericMap{
+		"DstAddr": "100.0.0.1",
+		"DstPort": uint16(22),
+	}
+	Enrich(entry, &rule)
+	assert.Equal(t, "host-1", entry["DstK8s_Name"])
+	assert.Equal(t, "Node", entry["DstK8s_Type"])
+
+	// No port field configured: resolved as node
+	rule.PortField = ""
+	entry = config.GenericMap{
+		"DstAddr": "100.0.0.1",
+		"DstPort": uint16(9100),
+	}
+	Enrich(entry, &rule)
+	assert.Equal(t, "host-1", entry["DstK8s_Name"])
+	assert.Equal(t, "Node", entry["DstK8s_Type"])
+}
+
+func TestEnrich_MultiCluster(t *testing.T) {
+	pod := func(name, host string) *inf.Info {
+		return &inf.Info{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "ns"}, Type: "Pod", HostName: host, HostIP: "100.0.0.1"}
+	}
+	node := func(zone string) map[string]*inf.Info {
+		return map[string]*inf.Info{"host": {
+			ObjectMeta: v1.ObjectMeta{Name: "host", Labels: map[string]string{nodeZoneLabelName: zone}},
+			Type:       "Node",
+		}}
+	}
+	// both clusters have a node named "host", in different zones, and a pod with the IP 10.9.9.9
+	mc := inf.NewMultiCluster()
+	mc.Add("east", inf.SetupStubs(map[string]*inf.Info{
+		"10.0.0.1": pod("pod-east", "host"),
+		"10.9.9.9": pod("pod-both-east", "host"),
+	}, nil, node("us-east-1a")))
+	mc.Add("west", inf.SetupStubs(map[string]*inf.Info{
+		"10.1.0.1": pod("pod-west", "host"),
+		"10.9.9.9": pod("pod-both-west", "host"),
+	}, nil, node("us-west-1a")))
+	informers = mc
+
+	entry := config.GenericMap{
+		"SrcAddr": "10.0.0.1",
+		"DstAddr": "10.1.0.1",
+	}
+	for _, r := range rules {
+		Enrich(entry, r.Kubernetes)
+	}
+	assert.Equal(t, config.GenericMap{
+		"SrcAddr":            "10.0.0.1",
+		"SrcK8s_Name":        "pod-east",
+		"SrcK8s_Namespace":   "ns",
+		"SrcK8s_Type":        "Pod",
+		"SrcK8s_OwnerName":   "",
+		"SrcK8s_OwnerType":   "",
+		"SrcK8s_NetworkName": "",
+		"SrcK8s_ClusterName": "east",
+		"SrcK8s_HostIP":      "100.0.0.1",
+		"SrcK8s_HostName":    "host",
+		"SrcK8s_Zone":        "us-east-1a",
+		"DstAddr":            "10.1.0.1",
+		"DstK8s_Name":        "pod-west",
+		"DstK8s_Namespace":   "ns",
+		"DstK8s_Type":        "Pod",
+		"DstK8s_OwnerName":   "",
+		"DstK8s_OwnerType":   "",
+		"DstK8s_NetworkName": "",
+		"DstK8s_ClusterName": "west",
+		"DstK8s_HostIP":      "100.0.0.1",
+		"DstK8s_HostName":    "host",
+		"DstK8s_Zone":        "us-west-1a",
+	}, entry)
+
+	// the first cluster knowing an IP wins; the cached objects are not modified
+	entry = config.GenericMap{"SrcAddr": "10.9.9.9"}
+	Enrich(entry, rules[0].Kubernetes)
+	assert.Equal(t, "pod-both-east", entry["SrcK8s_Name"])
+	assert.Equal(t, "east", entry["SrcK8s_ClusterName"])
+	found, err := mc.Cluster("east").GetInfo(nil, "10.9.9.9")
+	assert.NoError(t, err)
+	assert.Empty(t, found.ClusterName)
+
+	// unknown IP
+	entry = config.GenericMap{"SrcAddr": "10.5.5.5"}
+	Enrich(entry, rules[0].Kubernetes)
+	assert.Equal(t, config.GenericMap{"SrcAddr": "10.5.5.5"}, entry)
+}
+
+func TestInitFromConfig_ReusesRunningInformers(t *testing.T) {
+	MockInformers()
+	defer MockInformers()
+	mock := informers.(*inf.Mock)
+	cfg := api.NetworkTransformKubeConfig{ConfigPath: "/kubeconfig"}
+
+	// the informers are started once, and reused by the transforms built with the same configuration
+	assert.NoError(t, InitFromConfig(cfg, true, false, nil))
+	assert.NoError(t, InitFromConfig(cfg, true, false, nil))
+	assert.NoError(t, InitFromConfig(cfg, false, false, nil))
+	mock.AssertNumberOfCalls(t, "InitFromConfig", 1)
+
+	// a transform needing other informers gets them started along with the running ones
+	assert.NoError(t, InitFromConfig(cfg, false, true, nil))
+	mock.AssertNumberOfCalls(t, "InitFromConfig", 2)
+	mock.AssertCalled(t, "InitFromConfig", cfg, true, true, (*operational.Metrics)(nil))
+	assert.NoError(t, InitFromConfig(cfg, true, true, nil))
+	mock.AssertNumberOfCalls(t, "InitFromConfig", 2)
+
+	// with another configuration, the informers are started again with it
+	other := api.NetworkTransformKubeConfig{ConfigPath: "/other"}
+	assert.NoError(t, InitFromConfig(other, false, false, nil))
+	mock.AssertNumberOfCalls(t, "InitFromConfig", 3)
+	mock.AssertCalled(t, "InitFromConfig", other, false, false, (*operational.Metrics)(nil))
+}
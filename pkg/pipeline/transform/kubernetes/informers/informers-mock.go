@@ -8,6 +8,7 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/kubernetes/cni"
 	"github.com/stretchr/testify/mock"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
 )
@@ -32,12 +33,12 @@ type Mock struct {
 
 func NewInformersMock() *Mock {
 	inf := new(Mock)
-	inf.On("InitFromConfig", mock.Anything, mock.Anything).Return(nil)
+	inf.On("InitFromConfig", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	return inf
 }
 
-func (o *Mock) InitFromConfig(cfg api.NetworkTransformKubeConfig, opMetrics *operational.Metrics) error {
-	args := o.Called(cfg, opMetrics)
+func (o *Mock) InitFromConfig(cfg api.NetworkTransformKubeConfig, withNamespaces, withNetworkPolicies bool, opMetrics *operational.Metrics) error {
+	args := o.Called(cfg, withNamespaces, withNetworkPolicies, opMetrics)
 	return args.Error(0)
 }
 
@@ -106,6 +107,15 @@ func (m *IndexerMock) MockPod(ip, mac, intf, name, namespace, nodeIP string, own
 	}
 }
 
+func (m *IndexerMock) MockHostNetworkPod(hostIP string, port int, name, namespace string) {
+	m.On("ByIndex", IndexHostPort, hostPortKey(hostIP, port)).Return([]interface{}{&Info{
+		Type:         "Pod",
+		ObjectMeta:   metav1.ObjectMeta{Name: name, Namespace: namespace},
+		HostIP:       hostIP,
+		hostPortKeys: []string{hostPortKey(hostIP, port)},
+	}}, nil)
+}
+
 func (m *IndexerMock) MockNode(ip, name string) {
 	m.On("ByIndex", IndexIP, ip).Return([]interface{}{&Info{
 		Type:       "Node",
@@ -132,8 +142,16 @@ func (m *IndexerMock) MockReplicaSet(name, namespace string, owner Owner) {
 	}, true, nil)
 }
 
+func (m *IndexerMock) MockNamespace(name string, labels map[string]string) {
+	m.On("GetByKey", name).Return(&metav1.ObjectMeta{
+		Name:   name,
+		Labels: labels,
+	}, true, nil)
+}
+
 func (m *IndexerMock) FallbackNotFound() {
 	m.On("ByIndex", IndexIP, mock.Anything).Return([]interface{}{}, nil)
+	m.On("ByIndex", IndexHostPort, mock.Anything).Return([]interface{}{}, nil)
 }
 
 func SetupIndexerMocks(kd *Informers) (pods, nodes, svc, rs *IndexerMock) {
@@ -160,11 +178,22 @@ func SetupIndexerMocks(kd *Informers) (pods, nodes, svc, rs *IndexerMock) {
 	return
 }
 
+func SetupNamespaceIndexerMock(kd *Informers) *IndexerMock {
+	ns := &IndexerMock{}
+	nim := InformerMock{}
+	nim.On("GetIndexer").Return(ns)
+	kd.namespaces = &nim
+	return ns
+}
+
 type FakeInformers struct {
 	InformersInterface
 	ipInfo         map[string]*Info
 	customKeysInfo map[string]*Info
 	nodes          map[string]*Info
+	hostPortInfo   map[string]*Info
+	pods           map[string]*Info
+	policies       map[string][]*networkingv1.NetworkPolicy
 }
 
 func SetupStubs(ipInfo map[string]*Info, customKeysInfo map[string]*Info, nodes map[string]*Info) *FakeInformers {
@@ -175,7 +204,7 @@ func SetupStubs(ipInfo map[string]*Info, customKeysInfo map[string]*Info, nodes
 	}
 }
 
-func (f *FakeInformers) InitFromConfig(_ api.NetworkTransformKubeConfig, _ *operational.Metrics) error {
+func (f *FakeInformers) InitFromConfig(_ api.NetworkTransformKubeConfig, _, _ bool, _ *operational.Metrics) error {
 	return nil
 }
 
@@ -198,6 +227,46 @@ func (f *FakeInformers) BuildSecondaryNetworkKeys(flow config.GenericMap, rule *
 	return buildSecondaryNetworkKeys(flow, rule, secondaryNetConfig, true, true)
 }
 
+// AddHostNetworkPod registers a host-network Pod, resolved by GetHostNetworkPodInfo
+func (f *FakeInformers) AddHostNetworkPod(hostIP string, port int, info *Info) {
+	if f.hostPortInfo == nil {
+		f.hostPortInfo = map[string]*Info{}
+	}
+	f.hostPortInfo[hostPortKey(hostIP, port)] = info
+}
+
+func (f *FakeInformers) GetHostNetworkPodInfo(ip string, port int) (*Info, error) {
+	i := f.hostPortInfo[hostPortKey(ip, port)]
+	if i != nil {
+		return i, nil
+	}
+	return nil, errors.New("notFound")
+}
+
+// AddPod registers a Pod, resolved by GetPodInfo from its namespace and name
+func (f *FakeInformers) AddPod(info *Info) {
+	if f.pods == nil {
+		f.pods = map[string]*Info{}
+	}
+	f.pods[info.Namespace+"/"+info.Name] = info
+}
+
+func (f *FakeInformers) GetPodInfo(namespace, name string) (*Info, error) {
+	return f.pods[namespace+"/"+name], nil
+}
+
+// AddNetworkPolicy registers a NetworkPolicy, returned by GetNetworkPolicies for its namespace
+func (f *FakeInformers) AddNetworkPolicy(np *networkingv1.NetworkPolicy) {
+	if f.policies == nil {
+		f.policies = map[string][]*networkingv1.NetworkPolicy{}
+	}
+	f.policies[np.Namespace] = append(f.policies[np.Namespace], np)
+}
+
+func (f *FakeInformers) GetNetworkPolicies(namespace string) ([]*networkingv1.NetworkPolicy, error) {
+	return f.policies[namespace], nil
+}
+
 func (f *FakeInformers) GetNodeInfo(n string) (*Info, error) {
 	i := f.nodes[n]
 	if i != nil {
@@ -18,8 +18,11 @@
 package informers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
@@ -31,6 +34,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	inf "k8s.io/client-go/informers"
@@ -45,9 +49,11 @@ const (
 	syncTime              = 10 * time.Minute
 	IndexCustom           = "byCustomKey"
 	IndexIP               = "byIP"
+	IndexHostPort         = "byHostPort"
 	TypeNode              = "Node"
 	TypePod               = "Pod"
 	TypeService           = "Service"
+	TypeNamespace         = "Namespace"
 )
 
 var (
@@ -64,7 +70,10 @@ type InformersInterface interface {
 	BuildSecondaryNetworkKeys(flow config.GenericMap, rule *api.K8sRule) []cni.SecondaryNetKey
 	GetInfo([]cni.SecondaryNetKey, string) (*Info, error)
 	GetNodeInfo(string) (*Info, error)
-	InitFromConfig(api.NetworkTransformKubeConfig, *operational.Metrics) error
+	GetHostNetworkPodInfo(string, int) (*Info, error)
+	GetPodInfo(string, string) (*Info, error)
+	GetNetworkPolicies(string) ([]*networkingv1.NetworkPolicy, error)
+	InitFromConfig(api.NetworkTransformKubeConfig, bool, bool, *operational.Metrics) error
 }
 
 type Informers struct {
@@ -74,9 +83,14 @@ type Informers struct {
 	nodes    cache.SharedIndexInformer
 	services cache.SharedIndexInformer
 	// replicaSets caches the ReplicaSets as partially-filled *ObjectMeta pointers
-	replicaSets       cache.SharedIndexInformer
+	replicaSets cache.SharedIndexInformer
+	// namespaces caches the Namespaces as partially-filled *ObjectMeta pointers, when namespace labels are needed
+	namespaces cache.SharedIndexInformer
+	// networkPolicies caches the NetworkPolicies, stripped of their status and metadata, when policies are checked
+	networkPolicies   cache.SharedIndexInformer
 	stopChan          chan struct{}
 	mdStopChan        chan struct{}
+	syncTimeout       time.Duration
 	managedCNI        []string
 	secondaryNetworks []api.SecondaryNetwork
 	hasMultus         bool
@@ -97,13 +111,18 @@ type Owner struct {
 type Info struct {
 	// Informers need that internal object is an ObjectMeta instance
 	metav1.ObjectMeta
-	Type             string
-	Owner            Owner
-	HostName         string
-	HostIP           string
-	NetworkName      string
+	Type            string
+	Owner           Owner
+	HostName        string
+	HostIP          string
+	NetworkName     string
+	NamespaceLabels map[string]string
+	// ClusterName is the name of the cluster of the object, only set when several clusters are configured
+	ClusterName      string
+	ownerResolved    bool
 	ips              []string
 	secondaryNetKeys []string
+	hostPortKeys     []string
 }
 
 var (
@@ -113,8 +132,15 @@ var (
 	customKeyIndexer = func(obj interface{}) ([]string, error) {
 		return obj.(*Info).secondaryNetKeys, nil
 	}
+	hostPortIndexer = func(obj interface{}) ([]string, error) {
+		return obj.(*Info).hostPortKeys, nil
+	}
 )
 
+func hostPortKey(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
 func (k *Informers) BuildSecondaryNetworkKeys(flow config.GenericMap, rule *api.K8sRule) []cni.SecondaryNetKey {
 	return buildSecondaryNetworkKeys(flow, rule, k.secondaryNetworks, k.hasMultus, k.hasUDN)
 }
@@ -134,9 +160,10 @@ func (k *Informers) GetInfo(potentialKeys []cni.SecondaryNetKey, ip string) (*In
 	if info, ok := k.fetchInformers(potentialKeys, ip); ok {
 		// Owner data might be discovered after the owned, so we fetch it
 		// at the last moment
-		if info.Owner.Name == "" {
-			info.Owner = k.getOwner(info)
+		if !info.ownerResolved {
+			info.Owner, info.ownerResolved = k.getOwner(info)
 		}
+		k.fillNamespaceLabels(info)
 		return info, nil
 	}
 
@@ -221,6 +248,59 @@ func (k *Informers) infoForIP(idx cache.Indexer, kind string, ip string) (*Info,
 	return nil, false
 }
 
+// GetHostNetworkPodInfo returns the host-network Pod that declares the provided port on the node owning the provided IP.
+// Host-network Pods share their IP with the Node, so they can't be resolved by IP only.
+func (k *Informers) GetHostNetworkPodInfo(ip string, port int) (*Info, error) {
+	objs, err := k.pods.GetIndexer().ByIndex(IndexHostPort, hostPortKey(ip, port))
+	if err != nil {
+		k.increaseIndexerHits("Pod", "", "host", "informer error")
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("informers can't find host-network Pod for %s", hostPortKey(ip, port))
+	}
+	// the host-network fields are set on a copy: the cached object is shared by the concurrent lookups
+	hostPod := *objs[0].(*Info)
+	info := &hostPod
+	info.NetworkName = "host"
+	k.increaseIndexerHits("Pod", info.Namespace, "host", "")
+	if info.HostName == "" {
+		info.HostName = k.getHostName(info.HostIP)
+	}
+	if !info.ownerResolved {
+		info.Owner, info.ownerResolved = k.getOwner(info)
+	}
+	k.fillNamespaceLabels(info)
+	return info, nil
+}
+
+// GetPodInfo returns the Pod of the provided namespace and name, or nil if it isn't found
+func (k *Informers) GetPodInfo(namespace, name string) (*Info, error) {
+	item, ok, err := k.pods.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil || !ok {
+		return nil, err
+	}
+	info := item.(*Info)
+	k.fillNamespaceLabels(info)
+	return info, nil
+}
+
+// GetNetworkPolicies returns the NetworkPolicies of the provided namespace
+func (k *Informers) GetNetworkPolicies(namespace string) ([]*networkingv1.NetworkPolicy, error) {
+	if k.networkPolicies == nil {
+		return nil, errors.New("the NetworkPolicies informer is not started")
+	}
+	objs, err := k.networkPolicies.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]*networkingv1.NetworkPolicy, 0, len(objs))
+	for _, obj := range objs {
+		policies = append(policies, obj.(*networkingv1.NetworkPolicy))
+	}
+	return policies, nil
+}
+
 func (k *Informers) GetNodeInfo(name string) (*Info, error) {
 	item, ok, err := k.nodes.GetIndexer().GetByKey(name)
 	if err != nil {
@@ -231,34 +311,63 @@ func (k *Informers) GetNodeInfo(name string) (*Info, error) {
 	return nil, nil
 }
 
-func (k *Informers) getOwner(info *Info) Owner {
-	if len(info.OwnerReferences) != 0 {
-		ownerReference := info.OwnerReferences[0]
-		if ownerReference.Kind != "ReplicaSet" {
-			return Owner{
-				Name: ownerReference.Name,
-				Type: ownerReference.Kind,
-			}
-		}
+// getOwner walks the owner chain up to the workload controller: Pod -> ReplicaSet -> Deployment, or e.g.
+// Pod -> DaemonSet. The returned boolean is false when the chain can't be fully resolved yet, e.g. when the
+// ReplicaSet isn't in the informer cache yet: the owner is then looked up again on the next call.
+func (k *Informers) getOwner(info *Info) (Owner, bool) {
+	ownerReference := controllerReference(info.OwnerReferences)
+	if ownerReference == nil {
+		// If no owner references found, return itself as owner
+		return Owner{Name: info.Name, Type: info.Type}, true
+	}
+	owner := Owner{Name: ownerReference.Name, Type: ownerReference.Kind}
+	if ownerReference.Kind != "ReplicaSet" {
+		return owner, true
+	}
 
-		item, ok, err := k.replicaSets.GetIndexer().GetByKey(info.Namespace + "/" + ownerReference.Name)
-		if err != nil {
-			log.WithError(err).WithField("key", info.Namespace+"/"+ownerReference.Name).
-				Debug("can't get ReplicaSet info from informer. Ignoring")
-		} else if ok {
-			rsInfo := item.(*metav1.ObjectMeta)
-			if len(rsInfo.OwnerReferences) > 0 {
-				return Owner{
-					Name: rsInfo.OwnerReferences[0].Name,
-					Type: rsInfo.OwnerReferences[0].Kind,
-				}
-			}
+	item, ok, err := k.replicaSets.GetIndexer().GetByKey(info.Namespace + "/" + ownerReference.Name)
+	if err != nil {
+		log.WithError(err).WithField("key", info.Namespace+"/"+ownerReference.Name).
+			Debug("can't get ReplicaSet info from informer. Ignoring")
+		return owner, false
+	}
+	if !ok {
+		return owner, false
+	}
+	// a ReplicaSet without owner is its own workload controller
+	if rsOwner := controllerReference(item.(*metav1.ObjectMeta).OwnerReferences); rsOwner != nil {
+		owner = Owner{Name: rsOwner.Name, Type: rsOwner.Kind}
+	}
+	return owner, true
+}
+
+// controllerReference returns the reference to the managing controller, or the first reference if none is flagged as such
+func controllerReference(refs []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range refs {
+		if refs[i].Controller != nil && *refs[i].Controller {
+			return &refs[i]
 		}
 	}
-	// If no owner references found, return itself as owner
-	return Owner{
-		Name: info.Name,
-		Type: info.Type,
+	if len(refs) > 0 {
+		return &refs[0]
+	}
+	return nil
+}
+
+// fillNamespaceLabels sets the labels of the object namespace. They are fetched at the last moment,
+// as namespace labels might change independently of the objects they contain.
+func (k *Informers) fillNamespaceLabels(info *Info) {
+	if k.namespaces == nil || info.Namespace == "" {
+		return
+	}
+	item, ok, err := k.namespaces.GetIndexer().GetByKey(info.Namespace)
+	if err != nil {
+		log.WithError(err).WithField("key", info.Namespace).
+			Debug("can't get Namespace info from informer. Ignoring")
+		return
+	}
+	if ok {
+		info.NamespaceLabels = item.(*metav1.ObjectMeta).Labels
 	}
 }
 
@@ -341,6 +450,24 @@ func (k *Informers) initPodInformer(informerFactory inf.SharedInformerFactory) e
 				ips = append(ips, ip.IP)
 			}
 		}
+		// host-networked Pods are instead indexed by host IP + declared container ports
+		var hostPortKeys []string
+		if pod.Spec.HostNetwork {
+			hostIPs := []string{pod.Status.HostIP}
+			if len(pod.Status.HostIPs) > 0 {
+				hostIPs = hostIPs[:0]
+				for _, hostIP := range pod.Status.HostIPs {
+					hostIPs = append(hostIPs, hostIP.IP)
+				}
+			}
+			for _, container := range pod.Spec.Containers {
+				for _, port := range container.Ports {
+					for _, hostIP := range hostIPs {
+						hostPortKeys = append(hostPortKeys, hostPortKey(hostIP, int(port.ContainerPort)))
+					}
+				}
+			}
+		}
 		// Index from secondary network info
 		var keys []string
 		var err error
@@ -371,14 +498,16 @@ func (k *Informers) initPodInformer(informerFactory inf.SharedInformerFactory) e
 			HostIP:           pod.Status.HostIP,
 			HostName:         pod.Spec.NodeName,
 			secondaryNetKeys: keys,
+			hostPortKeys:     hostPortKeys,
 			ips:              ips,
 		}, nil
 	}); err != nil {
 		return fmt.Errorf("can't set pods transform: %w", err)
 	}
 	indexers := cache.Indexers{
-		IndexIP:     ipIndexer,
-		IndexCustom: customKeyIndexer,
+		IndexIP:       ipIndexer,
+		IndexCustom:   customKeyIndexer,
+		IndexHostPort: hostPortIndexer,
 	}
 	if err := pods.AddIndexers(indexers); err != nil {
 		return fmt.Errorf("can't add indexers to Pods informer: %w", err)
@@ -392,28 +521,7 @@ func (k *Informers) initServiceInformer(informerFactory inf.SharedInformerFactor
 	services := informerFactory.Core().V1().Services().Informer()
 	// Transform any *v1.Service instance into a *Info instance to save space
 	// in the informer's cache
-	if err := services.SetTransform(func(i interface{}) (interface{}, error) {
-		svc, ok := i.(*v1.Service)
-		if !ok {
-			return nil, fmt.Errorf("was expecting a Service. Got: %T", i)
-		}
-		ips := make([]string, 0, len(svc.Spec.ClusterIPs))
-		for _, ip := range svc.Spec.ClusterIPs {
-			// ignoring None IPs
-			if isServiceIPSet(ip) {
-				ips = append(ips, ip)
-			}
-		}
-		return &Info{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      svc.Name,
-				Namespace: svc.Namespace,
-				Labels:    svc.Labels,
-			},
-			Type: TypeService,
-			ips:  ips,
-		}, nil
-	}); err != nil {
+	if err := services.SetTransform(transformService); err != nil {
 		return fmt.Errorf("can't set services transform: %w", err)
 	}
 	indexers := cache.Indexers{IndexIP: ipIndexer}
@@ -425,6 +533,31 @@ func (k *Informers) initServiceInformer(informerFactory inf.SharedInformerFactor
 	return nil
 }
 
+// transformService indexes services by their cluster IPs. Headless services (ClusterIP: None) and
+// ExternalName services have no cluster IP, so they are not indexed and can't be resolved from flows.
+func transformService(i interface{}) (interface{}, error) {
+	svc, ok := i.(*v1.Service)
+	if !ok {
+		return nil, fmt.Errorf("was expecting a Service. Got: %T", i)
+	}
+	ips := make([]string, 0, len(svc.Spec.ClusterIPs))
+	for _, ip := range svc.Spec.ClusterIPs {
+		// ignoring None IPs
+		if isServiceIPSet(ip) {
+			ips = append(ips, ip)
+		}
+	}
+	return &Info{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      svc.Name,
+			Namespace: svc.Namespace,
+			Labels:    svc.Labels,
+		},
+		Type: TypeService,
+		ips:  ips,
+	}, nil
+}
+
 func (k *Informers) initReplicaSetInformer(informerFactory metadatainformer.SharedInformerFactory) error {
 	k.replicaSets = informerFactory.ForResource(
 		schema.GroupVersionResource{
@@ -450,12 +583,70 @@ func (k *Informers) initReplicaSetInformer(informerFactory metadatainformer.Shar
 	return nil
 }
 
-func (k *Informers) InitFromConfig(cfg api.NetworkTransformKubeConfig, opMetrics *operational.Metrics) error {
+func (k *Informers) initNamespaceInformer(informerFactory metadatainformer.SharedInformerFactory) error {
+	k.namespaces = informerFactory.ForResource(
+		schema.GroupVersionResource{
+			Group:    "",
+			Version:  "v1",
+			Resource: "namespaces",
+		}).Informer()
+	// Only the namespace labels are needed
+	if err := k.namespaces.SetTransform(transformNamespace); err != nil {
+		return fmt.Errorf("can't set Namespaces transform: %w", err)
+	}
+	return nil
+}
+
+func transformNamespace(i interface{}) (interface{}, error) {
+	ns, ok := i.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return nil, fmt.Errorf("was expecting a Namespace. Got: %T", i)
+	}
+	return &metav1.ObjectMeta{
+		Name:   ns.Name,
+		Labels: ns.Labels,
+	}, nil
+}
+
+func (k *Informers) initNetworkPolicyInformer(informerFactory inf.SharedInformerFactory) error {
+	k.networkPolicies = informerFactory.Networking().V1().NetworkPolicies().Informer()
+	// Only the spec is needed to evaluate the policies
+	if err := k.networkPolicies.SetTransform(transformNetworkPolicy); err != nil {
+		return fmt.Errorf("can't set NetworkPolicies transform: %w", err)
+	}
+	return nil
+}
+
+func transformNetworkPolicy(i interface{}) (interface{}, error) {
+	np, ok := i.(*networkingv1.NetworkPolicy)
+	if !ok {
+		return nil, fmt.Errorf("was expecting a NetworkPolicy. Got: %T", i)
+	}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      np.Name,
+			Namespace: np.Namespace,
+		},
+		Spec: np.Spec,
+	}, nil
+}
+
+// InitFromConfig starts the informers. The Namespaces and NetworkPolicies informers are only started when
+// withNamespaces and withNetworkPolicies are set, as they require extra permissions.
+func (k *Informers) InitFromConfig(cfg api.NetworkTransformKubeConfig, withNamespaces, withNetworkPolicies bool, opMetrics *operational.Metrics) error {
+	return k.initCluster(cfg, withNamespaces, withNetworkPolicies, opMetrics.CreateIndexerHitCounter())
+}
+
+// initCluster starts the informers of a cluster; the indexer hits metric is shared by the clusters
+func (k *Informers) initCluster(cfg api.NetworkTransformKubeConfig, withNamespaces, withNetworkPolicies bool, indexerHitMetric *prometheus.CounterVec) error {
 	// Initialization variables
 	k.stopChan = make(chan struct{})
 	k.mdStopChan = make(chan struct{})
+	if cfg.SyncTimeout != nil {
+		k.syncTimeout = cfg.SyncTimeout.Duration
+	}
 
-	kconf, err := utils.LoadK8sConfig(cfg.ConfigPath)
+	kconf, err := utils.LoadK8sContextConfig(cfg.ConfigPath, cfg.Context)
 	if err != nil {
 		return err
 	}
@@ -485,8 +676,8 @@ func (k *Informers) InitFromConfig(cfg api.NetworkTransformKubeConfig, opMetrics
 			}
 		}
 	}
-	k.indexerHitMetric = opMetrics.CreateIndexerHitCounter()
-	err = k.initInformers(kubeClient, metaKubeClient)
+	k.indexerHitMetric = indexerHitMetric
+	err = k.initInformers(kubeClient, metaKubeClient, withNamespaces, withNetworkPolicies)
 	if err != nil {
 		return err
 	}
@@ -494,7 +685,7 @@ func (k *Informers) InitFromConfig(cfg api.NetworkTransformKubeConfig, opMetrics
 	return nil
 }
 
-func (k *Informers) initInformers(client kubernetes.Interface, metaClient metadata.Interface) error {
+func (k *Informers) initInformers(client kubernetes.Interface, metaClient metadata.Interface, withNamespaces, withNetworkPolicies bool) error {
 	informerFactory := inf.NewSharedInformerFactory(client, syncTime)
 	metadataInformerFactory := metadatainformer.NewSharedInformerFactory(metaClient, syncTime)
 	err := k.initNodeInformer(informerFactory)
@@ -513,19 +704,67 @@ func (k *Informers) initInformers(client kubernetes.Interface, metaClient metada
 	if err != nil {
 		return err
 	}
+	if withNetworkPolicies {
+		err = k.initNetworkPolicyInformer(informerFactory)
+		if err != nil {
+			return err
+		}
+	}
+	if withNamespaces {
+		err = k.initNamespaceInformer(metadataInformerFactory)
+		if err != nil {
+			return err
+		}
+	}
 
 	log.Debugf("starting kubernetes informers, waiting for synchronization")
 	informerFactory.Start(k.stopChan)
-	informerFactory.WaitForCacheSync(k.stopChan)
+	syncStop, cancel := k.syncDeadline(k.stopChan)
+	defer cancel()
+	if err := checkSynced(informerFactory.WaitForCacheSync(syncStop)); err != nil {
+		close(k.stopChan)
+		return err
+	}
 	log.Debugf("kubernetes informers started")
 
 	log.Debugf("starting kubernetes metadata informers, waiting for synchronization")
 	metadataInformerFactory.Start(k.mdStopChan)
-	metadataInformerFactory.WaitForCacheSync(k.mdStopChan)
+	mdSyncStop, mdCancel := k.syncDeadline(k.mdStopChan)
+	defer mdCancel()
+	if err := checkSynced(metadataInformerFactory.WaitForCacheSync(mdSyncStop)); err != nil {
+		close(k.stopChan)
+		close(k.mdStopChan)
+		return err
+	}
 	log.Debugf("kubernetes metadata informers started")
 	return nil
 }
 
+// syncDeadline returns a channel that is closed when stop is closed or, if set, when the sync timeout elapses
+func (k *Informers) syncDeadline(stop <-chan struct{}) (<-chan struct{}, context.CancelFunc) {
+	if k.syncTimeout == 0 {
+		return stop, func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), k.syncTimeout)
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx.Done(), cancel
+}
+
+func checkSynced[K comparable](synced map[K]bool) error {
+	for informer, ok := range synced {
+		if !ok {
+			return fmt.Errorf("kubernetes informer %v could not synchronize before the sync timeout", informer)
+		}
+	}
+	return nil
+}
+
 func isServiceIPSet(ip string) bool {
 	return ip != v1.ClusterIPNone && ip != ""
 }
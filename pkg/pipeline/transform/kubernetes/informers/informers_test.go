@@ -18,13 +18,22 @@
 package informers
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/kubernetes/cni"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
 )
 
 func TestGetInfo(t *testing.T) {
@@ -53,6 +62,7 @@ func TestGetInfo(t *testing.T) {
 		HostName:         "node1",
 		HostIP:           "10.0.0.1",
 		Owner:            Owner{Name: "pod1", Type: "Pod"},
+		ownerResolved:    true,
 		NetworkName:      "primary",
 		ips:              []string{"1.2.3.4"},
 		secondaryNetKeys: []string{"~~AA:BB:CC:DD:EE:FF"},
@@ -82,6 +92,7 @@ func TestGetInfo(t *testing.T) {
 		HostName:         "node1",
 		HostIP:           "10.0.0.1",
 		Owner:            Owner{Name: "dep1", Type: "Deployment"},
+		ownerResolved:    true,
 		NetworkName:      "primary",
 		ips:              []string{"1.2.3.5"},
 		secondaryNetKeys: []string{},
@@ -96,9 +107,10 @@ func TestGetInfo(t *testing.T) {
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "node1",
 		},
-		Owner:       Owner{Name: "node1", Type: "Node"},
-		NetworkName: "primary",
-		ips:         []string{"10.0.0.1"},
+		Owner:         Owner{Name: "node1", Type: "Node"},
+		ownerResolved: true,
+		NetworkName:   "primary",
+		ips:           []string{"10.0.0.1"},
 	}, *info)
 
 	// Test get service
@@ -111,9 +123,10 @@ func TestGetInfo(t *testing.T) {
 			Name:      "svc1",
 			Namespace: "svcNamespace",
 		},
-		Owner:       Owner{Name: "svc1", Type: "Service"},
-		NetworkName: "primary",
-		ips:         []string{"1.2.3.100"},
+		Owner:         Owner{Name: "svc1", Type: "Service"},
+		ownerResolved: true,
+		NetworkName:   "primary",
+		ips:           []string{"1.2.3.100"},
 	}, *info)
 
 	// Test no match
@@ -121,3 +134,221 @@ func TestGetInfo(t *testing.T) {
 	require.NotNil(t, err)
 	require.Nil(t, info)
 }
+
+func TestGetHostNetworkPodInfo(t *testing.T) {
+	metrics := operational.NewMetrics(&config.MetricsSettings{})
+	kubeData := Informers{indexerHitMetric: metrics.CreateIndexerHitCounter()}
+	pidx, hidx, _, ridx := SetupIndexerMocks(&kubeData)
+	pidx.MockHostNetworkPod("10.0.0.1", 9100, "node-exporter", "monitoring")
+	pidx.FallbackNotFound()
+	ridx.FallbackNotFound()
+	hidx.MockNode("10.0.0.1", "node1")
+	hidx.FallbackNotFound()
+
+	info, err := kubeData.GetHostNetworkPodInfo("10.0.0.1", 9100)
+	require.NoError(t, err)
+	require.Equal(t, Info{
+		Type: "Pod",
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "node-exporter",
+			Namespace: "monitoring",
+		},
+		HostName:      "node1",
+		HostIP:        "10.0.0.1",
+		Owner:         Owner{Name: "node-exporter", Type: "Pod"},
+		ownerResolved: true,
+		NetworkName:   "host",
+		hostPortKeys:  []string{"10.0.0.1:9100"},
+	}, *info)
+
+	// the Pod of the informer cache is left unchanged
+	cached, err := pidx.ByIndex(IndexHostPort, "10.0.0.1:9100")
+	require.NoError(t, err)
+	require.NotSame(t, info, cached[0])
+	require.Empty(t, cached[0].(*Info).NetworkName)
+	require.Empty(t, cached[0].(*Info).HostName)
+	require.False(t, cached[0].(*Info).ownerResolved)
+
+	// Port not declared by any host-network pod
+	info, err = kubeData.GetHostNetworkPodInfo("10.0.0.1", 22)
+	require.Error(t, err)
+	require.Nil(t, info)
+}
+
+func TestGetInfo_OwnerChain(t *testing.T) {
+	metrics := operational.NewMetrics(&config.MetricsSettings{})
+	kubeData := Informers{indexerHitMetric: metrics.CreateIndexerHitCounter()}
+	pidx, hidx, _, ridx := SetupIndexerMocks(&kubeData)
+	pidx.MockPod("1.2.4.1", "", "", "agent-x7k2p", "ns", "10.0.0.1", &Owner{Name: "agent", Type: "DaemonSet"})
+	pidx.MockPod("1.2.4.2", "", "", "web-5d8f-abcde", "ns", "10.0.0.1", &Owner{Name: "web-5d8f", Type: "ReplicaSet"})
+	pidx.MockPod("1.2.4.3", "", "", "standalone-fghij", "ns", "10.0.0.1", &Owner{Name: "standalone", Type: "ReplicaSet"})
+	pidx.FallbackNotFound()
+	// the ReplicaSet of the web Pod isn't in the informer cache yet when the Pod is first looked up
+	ridx.On("GetByKey", "ns/web-5d8f").Return(nil, false, nil).Once()
+	ridx.MockReplicaSet("web-5d8f", "ns", Owner{Name: "web", Type: "Deployment"})
+	ridx.On("GetByKey", "ns/standalone").Return(&metav1.ObjectMeta{Name: "standalone", Namespace: "ns"}, true, nil)
+	hidx.MockNode("10.0.0.1", "node1")
+	hidx.FallbackNotFound()
+
+	info, err := kubeData.GetInfo(nil, "1.2.4.1")
+	require.NoError(t, err)
+	require.Equal(t, Owner{Name: "agent", Type: "DaemonSet"}, info.Owner)
+
+	info, err = kubeData.GetInfo(nil, "1.2.4.2")
+	require.NoError(t, err)
+	require.Equal(t, Owner{Name: "web-5d8f", Type: "ReplicaSet"}, info.Owner)
+	// once the ReplicaSet is known, the owner chain resolves to the Deployment, which is then cached
+	info, err = kubeData.GetInfo(nil, "1.2.4.2")
+	require.NoError(t, err)
+	require.Equal(t, Owner{Name: "web", Type: "Deployment"}, info.Owner)
+	_, err = kubeData.GetInfo(nil, "1.2.4.2")
+	require.NoError(t, err)
+	ridx.AssertNumberOfCalls(t, "GetByKey", 2)
+
+	// a ReplicaSet without owner is the workload controller
+	info, err = kubeData.GetInfo(nil, "1.2.4.3")
+	require.NoError(t, err)
+	require.Equal(t, Owner{Name: "standalone", Type: "ReplicaSet"}, info.Owner)
+}
+
+func TestControllerReference(t *testing.T) {
+	isController := true
+	require.Nil(t, controllerReference(nil))
+	require.Equal(t, "first", controllerReference([]metav1.OwnerReference{{Name: "first"}, {Name: "second"}}).Name)
+	require.Equal(t, "second", controllerReference([]metav1.OwnerReference{{Name: "first"}, {Name: "second", Controller: &isController}}).Name)
+}
+
+func TestGetInfo_NamespaceLabels(t *testing.T) {
+	metrics := operational.NewMetrics(&config.MetricsSettings{})
+	kubeData := Informers{indexerHitMetric: metrics.CreateIndexerHitCounter()}
+	pidx, hidx, sidx, ridx := SetupIndexerMocks(&kubeData)
+	nsidx := SetupNamespaceIndexerMock(&kubeData)
+	pidx.MockPod("1.2.3.4", "", "", "pod1", "podNamespace", "10.0.0.1", nil)
+	pidx.FallbackNotFound()
+	ridx.FallbackNotFound()
+	sidx.MockService("1.2.3.100", "svc1", "otherNamespace")
+	sidx.FallbackNotFound()
+	hidx.MockNode("10.0.0.1", "node1")
+	hidx.FallbackNotFound()
+	nsidx.MockNamespace("podNamespace", map[string]string{"team": "network", "environment": "prod"})
+	nsidx.On("GetByKey", mock.Anything).Return(nil, false, nil)
+
+	info, err := kubeData.GetInfo(nil, "1.2.3.4")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "network", "environment": "prod"}, info.NamespaceLabels)
+	// the pod labels are left unchanged
+	require.Empty(t, info.Labels)
+
+	// unknown namespace
+	info, err = kubeData.GetInfo(nil, "1.2.3.100")
+	require.NoError(t, err)
+	require.Nil(t, info.NamespaceLabels)
+
+	// nodes aren't namespaced
+	info, err = kubeData.GetInfo(nil, "10.0.0.1")
+	require.NoError(t, err)
+	require.Nil(t, info.NamespaceLabels)
+}
+
+func TestTransformNamespace(t *testing.T) {
+	obj, err := transformNamespace(&metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ns",
+			Labels:      map[string]string{"team": "network"},
+			Annotations: map[string]string{"big": "annotation"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &metav1.ObjectMeta{Name: "ns", Labels: map[string]string{"team": "network"}}, obj)
+
+	_, err = transformNamespace(&v1.Pod{})
+	require.Error(t, err)
+}
+
+func TestTransformNetworkPolicy(t *testing.T) {
+	spec := networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	}
+	obj, err := transformNetworkPolicy(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "db",
+			Namespace:   "shop",
+			Annotations: map[string]string{"big": "annotation"},
+		},
+		Spec: spec,
+	})
+	require.NoError(t, err)
+	require.Equal(t, &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop"}, Spec: spec}, obj)
+
+	_, err = transformNetworkPolicy(&v1.Pod{})
+	require.Error(t, err)
+}
+
+func TestInitInformersSyncTimeout(t *testing.T) {
+	// API server that never answers
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	kconf := &rest.Config{Host: server.URL}
+	client, err := kubernetes.NewForConfig(kconf)
+	require.NoError(t, err)
+	metaClient, err := metadata.NewForConfig(kconf)
+	require.NoError(t, err)
+
+	k := Informers{
+		stopChan:    make(chan struct{}),
+		mdStopChan:  make(chan struct{}),
+		syncTimeout: 200 * time.Millisecond,
+	}
+	start := time.Now()
+	err = k.initInformers(client, metaClient, false, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not synchronize")
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestTransformService(t *testing.T) {
+	svc := func(typ v1.ServiceType, clusterIPs ...string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", Labels: map[string]string{"app": "web"}},
+			Spec:       v1.ServiceSpec{Type: typ, ClusterIPs: clusterIPs},
+		}
+	}
+
+	// dual-stack ClusterIP service
+	obj, err := transformService(svc(v1.ServiceTypeClusterIP, "172.30.0.10", "fd02::10"))
+	require.NoError(t, err)
+	info := obj.(*Info)
+	require.Equal(t, TypeService, info.Type)
+	require.Equal(t, "svc", info.Name)
+	require.Equal(t, "ns", info.Namespace)
+	require.Equal(t, map[string]string{"app": "web"}, info.Labels)
+	ips, err := ipIndexer(info)
+	require.NoError(t, err)
+	require.Equal(t, []string{"172.30.0.10", "fd02::10"}, ips)
+
+	// headless service
+	obj, err = transformService(svc(v1.ServiceTypeClusterIP, v1.ClusterIPNone))
+	require.NoError(t, err)
+	ips, err = ipIndexer(obj)
+	require.NoError(t, err)
+	require.Empty(t, ips)
+
+	// ExternalName service
+	obj, err = transformService(svc(v1.ServiceTypeExternalName))
+	require.NoError(t, err)
+	ips, err = ipIndexer(obj)
+	require.NoError(t, err)
+	require.Empty(t, ips)
+
+	_, err = transformService(&v1.Pod{})
+	require.Error(t, err)
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package informers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/kubernetes/cni"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// MultiCluster looks the objects up in the informers of several clusters, in the configured order: the first
+// cluster knowing an object wins. The returned objects are copies holding the name of their cluster.
+type MultiCluster struct {
+	InformersInterface
+	clusters []namedInformers
+}
+
+type namedInformers struct {
+	name      string
+	informers InformersInterface
+}
+
+func NewMultiCluster() *MultiCluster {
+	return &MultiCluster{}
+}
+
+// Add appends the informers of a cluster, looked up after the clusters already added
+func (m *MultiCluster) Add(name string, informers InformersInterface) {
+	m.clusters = append(m.clusters, namedInformers{name: name, informers: informers})
+}
+
+// Cluster returns the informers of a cluster, or nil when the cluster is unknown
+func (m *MultiCluster) Cluster(name string) InformersInterface {
+	for _, c := range m.clusters {
+		if c.name == name {
+			return c.informers
+		}
+	}
+	return nil
+}
+
+// InitFromConfig starts the informers of each of the configured clusters
+func (m *MultiCluster) InitFromConfig(cfg api.NetworkTransformKubeConfig, withNamespaces, withNetworkPolicies bool, opMetrics *operational.Metrics) error {
+	indexerHitMetric := opMetrics.CreateIndexerHitCounter()
+	for i := range cfg.Clusters {
+		cluster := &cfg.Clusters[i]
+		k := &Informers{}
+		if err := k.initCluster(cfg.ForCluster(cluster), withNamespaces, withNetworkPolicies, indexerHitMetric); err != nil {
+			return fmt.Errorf("can't start the informers of cluster %s: %w", cluster.Name, err)
+		}
+		m.Add(cluster.Name, k)
+	}
+	return nil
+}
+
+// BuildSecondaryNetworkKeys relies on the first cluster, as the secondary networks configuration is shared by the clusters
+func (m *MultiCluster) BuildSecondaryNetworkKeys(flow config.GenericMap, rule *api.K8sRule) []cni.SecondaryNetKey {
+	if len(m.clusters) == 0 {
+		return nil
+	}
+	return m.clusters[0].informers.BuildSecondaryNetworkKeys(flow, rule)
+}
+
+func (m *MultiCluster) GetInfo(potentialKeys []cni.SecondaryNetKey, ip string) (*Info, error) {
+	return m.first(func(k InformersInterface) (*Info, error) { return k.GetInfo(potentialKeys, ip) })
+}
+
+func (m *MultiCluster) GetNodeInfo(name string) (*Info, error) {
+	return m.first(func(k InformersInterface) (*Info, error) { return k.GetNodeInfo(name) })
+}
+
+func (m *MultiCluster) GetHostNetworkPodInfo(ip string, port int) (*Info, error) {
+	return m.first(func(k InformersInterface) (*Info, error) { return k.GetHostNetworkPodInfo(ip, port) })
+}
+
+func (m *MultiCluster) GetPodInfo(namespace, name string) (*Info, error) {
+	return m.first(func(k InformersInterface) (*Info, error) { return k.GetPodInfo(namespace, name) })
+}
+
+// GetNetworkPolicies returns the NetworkPolicies of the namespace in all the clusters; the policies of the cluster
+// of a pod are returned by the informers of this cluster
+func (m *MultiCluster) GetNetworkPolicies(namespace string) ([]*networkingv1.NetworkPolicy, error) {
+	var policies []*networkingv1.NetworkPolicy
+	for _, c := range m.clusters {
+		p, err := c.informers.GetNetworkPolicies(namespace)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p...)
+	}
+	return policies, nil
+}
+
+// first returns a copy of the first object found, named after its cluster. When no cluster has the object, the
+// last error is returned, if any.
+func (m *MultiCluster) first(get func(InformersInterface) (*Info, error)) (*Info, error) {
+	var lastErr error
+	for _, c := range m.clusters {
+		info, err := get(c.informers)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if info != nil {
+			named := *info
+			named.ClusterName = c.name
+			return &named, nil
+		}
+	}
+	if lastErr == nil && len(m.clusters) == 0 {
+		lastErr = errors.New("no cluster is configured")
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package kubernetes
+
+import (
+	"net"
+	"strings"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	inf "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/kubernetes/informers"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	PolicyAllowed = "allowed"
+	PolicyDenied  = "denied"
+	PolicyUnknown = "unknown"
+)
+
+// protocols maps the protocol numbers to the protocols supported by NetworkPolicies
+var protocols = map[int]v1.Protocol{
+	6:   v1.ProtocolTCP,
+	17:  v1.ProtocolUDP,
+	132: v1.ProtocolSCTP,
+}
+
+// endpoint is a side of a flow: pod is nil unless the endpoint is a Pod found in the informers, which are
+// then the informers of the Pod cluster
+type endpoint struct {
+	pod       *inf.Info
+	informers inf.InformersInterface
+	ip        net.IP
+}
+
+// flowPort is the destination port of a flow, to match against the ports of the policy rules
+type flowPort struct {
+	protocol v1.Protocol
+	port     int32
+}
+
+// CheckNetworkPolicy writes whether the NetworkPolicies allow the flow: the egress policies of the source Pod and
+// the ingress policies of the destination Pod must both allow it. Pods selected by no policy of a direction are
+// not isolated for that direction. The result is unknown when neither side is a Pod, when a Pod isn't found, or
+// when the decision depends on a named port, which can't be resolved from the cached Pods.
+func CheckNetworkPolicy(outputEntry config.GenericMap, rule *api.NetworkPolicyCheckRule) {
+	src, srcOK := policyEndpoint(outputEntry, rule.SrcPrefix, rule.SrcIP)
+	dst, dstOK := policyEndpoint(outputEntry, rule.DstPrefix, rule.DstIP)
+	if !srcOK || !dstOK || (src.pod == nil && dst.pod == nil) {
+		outputEntry[rule.Output] = PolicyUnknown
+		return
+	}
+	port := policyFlowPort(outputEntry, rule)
+	action := PolicyAllowed
+	if src.pod != nil {
+		action = evaluatePolicies(&src, networkingv1.PolicyTypeEgress, &dst, port)
+	}
+	if dst.pod != nil && action != PolicyDenied {
+		if ingress := evaluatePolicies(&dst, networkingv1.PolicyTypeIngress, &src, port); ingress != PolicyAllowed {
+			action = ingress
+		}
+	}
+	outputEntry[rule.Output] = action
+}
+
+// policyEndpoint returns the endpoint described by the add_kubernetes fields of the prefix. It returns false
+// when the fields point to a Pod that can't be found.
+func policyEndpoint(outputEntry config.GenericMap, prefix, ipField string) (endpoint, bool) {
+	var ep endpoint
+	if ip, ok := outputEntry.LookupString(ipField); ok {
+		ep.ip = net.ParseIP(ip)
+	}
+	if kind, _ := outputEntry.LookupString(prefix + "_Type"); kind != inf.TypePod {
+		return ep, true
+	}
+	namespace, _ := outputEntry.LookupString(prefix + "_Namespace")
+	name, _ := outputEntry.LookupString(prefix + "_Name")
+	cluster, _ := outputEntry.LookupString(prefix + "_ClusterName")
+	ep.informers = clusterInformers(cluster)
+	pod, err := ep.informers.GetPodInfo(namespace, name)
+	if err != nil || pod == nil {
+		logrus.WithError(err).Tracef("can't find pod %s/%s to check network policies", namespace, name)
+		return ep, false
+	}
+	ep.pod = pod
+	return ep, true
+}
+
+func policyFlowPort(outputEntry config.GenericMap, rule *api.NetworkPolicyCheckRule) flowPort {
+	var fp flowPort
+	if rawPort, ok := outputEntry[rule.DstPort]; ok {
+		if port, err := utils.ConvertToInt(rawPort); err == nil {
+			fp.port = int32(port)
+		}
+	}
+	if rawProto, ok := outputEntry[rule.Protocol]; ok {
+		if name, ok := rawProto.(string); ok {
+			if proto := v1.Protocol(strings.ToUpper(name)); proto == v1.ProtocolTCP || proto == v1.ProtocolUDP || proto == v1.ProtocolSCTP {
+				fp.protocol = proto
+				return fp
+			}
+		}
+		if num, err := utils.ConvertToInt(rawProto); err == nil {
+			fp.protocol = protocols[num]
+		}
+	}
+	return fp
+}
+
+// evaluatePolicies checks the policies of the pod namespace for a direction: the flow is allowed when the pod
+// isn't selected by any of them, or when a rule of one of them matches the peer and the port
+func evaluatePolicies(ep *endpoint, direction networkingv1.PolicyType, peer *endpoint, port flowPort) string {
+	pod := ep.pod
+	policies, err := ep.informers.GetNetworkPolicies(pod.Namespace)
+	if err != nil {
+		logrus.WithError(err).Tracef("can't get network policies of namespace %s", pod.Namespace)
+		return PolicyUnknown
+	}
+	isolated, unknown := false, false
+	for _, np := range policies {
+		if !policyAppliesTo(np, direction) || !selectorMatches(&np.Spec.PodSelector, pod.Labels) {
+			continue
+		}
+		isolated = true
+		for _, r := range policyRules(np, direction) {
+			if !peersMatch(r.peers, np.Namespace, peer) {
+				continue
+			}
+			matched, known := portsMatch(r.ports, port)
+			if matched {
+				return PolicyAllowed
+			}
+			if !known {
+				unknown = true
+			}
+		}
+	}
+	switch {
+	case !isolated:
+		return PolicyAllowed
+	case unknown:
+		return PolicyUnknown
+	}
+	return PolicyDenied
+}
+
+// policyAppliesTo follows the defaults of policyTypes: Ingress always, Egress when there are egress rules
+func policyAppliesTo(np *networkingv1.NetworkPolicy, direction networkingv1.PolicyType) bool {
+	if len(np.Spec.PolicyTypes) == 0 {
+		return direction == networkingv1.PolicyTypeIngress || len(np.Spec.Egress) > 0
+	}
+	for _, t := range np.Spec.PolicyTypes {
+		if t == direction {
+			return true
+		}
+	}
+	return false
+}
+
+type policyRule struct {
+	peers []networkingv1.NetworkPolicyPeer
+	ports []networkingv1.NetworkPolicyPort
+}
+
+func policyRules(np *networkingv1.NetworkPolicy, direction networkingv1.PolicyType) []policyRule {
+	var rules []policyRule
+	if direction == networkingv1.PolicyTypeIngress {
+		for _, r := range np.Spec.Ingress {
+			rules = append(rules, policyRule{peers: r.From, ports: r.Ports})
+		}
+	} else {
+		for _, r := range np.Spec.Egress {
+			rules = append(rules, policyRule{peers: r.To, ports: r.Ports})
+		}
+	}
+	return rules
+}
+
+// peersMatch tells whether any of the peers matches the endpoint; an empty list matches all the endpoints
+func peersMatch(peers []networkingv1.NetworkPolicyPeer, policyNamespace string, ep *endpoint) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	for i := range peers {
+		if peerMatches(&peers[i], policyNamespace, ep) {
+			return true
+		}
+	}
+	return false
+}
+
+func peerMatches(peer *networkingv1.NetworkPolicyPeer, policyNamespace string, ep *endpoint) bool {
+	if peer.IPBlock != nil {
+		return ipBlockMatches(peer.IPBlock, ep.ip)
+	}
+	// pod and namespace selectors only select Pods
+	if ep.pod == nil {
+		return false
+	}
+	if peer.NamespaceSelector == nil {
+		if ep.pod.Namespace != policyNamespace {
+			return false
+		}
+	} else if !selectorMatches(peer.NamespaceSelector, ep.pod.NamespaceLabels) {
+		return false
+	}
+	return peer.PodSelector == nil || selectorMatches(peer.PodSelector, ep.pod.Labels)
+}
+
+func ipBlockMatches(block *networkingv1.IPBlock, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if _, cidr, err := net.ParseCIDR(block.CIDR); err != nil || !cidr.Contains(ip) {
+		return false
+	}
+	for _, except := range block.Except {
+		if _, cidr, err := net.ParseCIDR(except); err == nil && cidr.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func selectorMatches(selector *metav1.LabelSelector, labels map[string]string) bool {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		logrus.WithError(err).Tracef("invalid label selector %v", selector)
+		return false
+	}
+	return s.Matches(k8slabels.Set(labels))
+}
+
+// portsMatch tells whether any of the ports matches; an empty list matches all the ports. It returns false as the
+// second value when a named port prevents telling whether the port matches.
+func portsMatch(ports []networkingv1.NetworkPolicyPort, port flowPort) (bool, bool) {
+	if len(ports) == 0 {
+		return true, true
+	}
+	known := true
+	for i := range ports {
+		p := &ports[i]
+		protocol := v1.ProtocolTCP
+		if p.Protocol != nil {
+			protocol = *p.Protocol
+		}
+		if protocol != port.protocol {
+			continue
+		}
+		if p.Port == nil {
+			return true, true
+		}
+		if p.Port.Type == intstr.String {
+			known = false
+			continue
+		}
+		end := p.Port.IntVal
+		if p.EndPort != nil {
+			end = *p.EndPort
+		}
+		if port.port >= p.Port.IntVal && port.port <= end {
+			return true, true
+		}
+	}
+	return false, known
+}
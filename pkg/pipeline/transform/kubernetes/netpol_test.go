@@ -0,0 +1,195 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	inf "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/kubernetes/informers"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func setupNetpolStubs(policies ...*networkingv1.NetworkPolicy) {
+	stubs := inf.SetupStubs(nil, nil, nil)
+	stubs.AddPod(&inf.Info{
+		ObjectMeta:      v1.ObjectMeta{Name: "web", Namespace: "shop", Labels: map[string]string{"app": "web"}},
+		Type:            inf.TypePod,
+		NamespaceLabels: map[string]string{"team": "shop"},
+	})
+	stubs.AddPod(&inf.Info{
+		ObjectMeta:      v1.ObjectMeta{Name: "db", Namespace: "shop", Labels: map[string]string{"app": "db"}},
+		Type:            inf.TypePod,
+		NamespaceLabels: map[string]string{"team": "shop"},
+	})
+	stubs.AddPod(&inf.Info{
+		ObjectMeta:      v1.ObjectMeta{Name: "prometheus", Namespace: "monitoring", Labels: map[string]string{"app": "prometheus"}},
+		Type:            inf.TypePod,
+		NamespaceLabels: map[string]string{"team": "monitoring"},
+	})
+	for _, np := range policies {
+		stubs.AddNetworkPolicy(np)
+	}
+	informers = stubs
+}
+
+func podFlow(src, dst string, port int) config.GenericMap {
+	return config.GenericMap{
+		"SrcAddr":          "10.0.0.1",
+		"SrcK8S_Namespace": map[string]string{"web": "shop", "db": "shop", "prometheus": "monitoring"}[src],
+		"SrcK8S_Name":      src,
+		"SrcK8S_Type":      "Pod",
+		"DstAddr":          "10.0.0.2",
+		"DstK8S_Namespace": map[string]string{"web": "shop", "db": "shop", "prometheus": "monitoring"}[dst],
+		"DstK8S_Name":      dst,
+		"DstK8S_Type":      "Pod",
+		"DstPort":          port,
+		"Proto":            6,
+	}
+}
+
+func checkFlow(flow config.GenericMap) string {
+	rule := api.NetworkPolicyCheckRule{}
+	rule.SetDefaults()
+	CheckNetworkPolicy(flow, &rule)
+	return flow["NetworkPolicyAction"].(string)
+}
+
+func tcpPort(port int) []networkingv1.NetworkPolicyPort {
+	p := intstr.FromInt32(int32(port))
+	return []networkingv1.NetworkPolicyPort{{Port: &p}}
+}
+
+var dbAllowWeb = &networkingv1.NetworkPolicy{
+	ObjectMeta: v1.ObjectMeta{Name: "db-allow-web", Namespace: "shop"},
+	Spec: networkingv1.NetworkPolicySpec{
+		PodSelector: v1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{{
+			From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &v1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+			Ports: tcpPort(5432),
+		}, {
+			From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &v1.LabelSelector{MatchLabels: map[string]string{"team": "monitoring"}}}},
+		}},
+	},
+}
+
+var denyAll = &networkingv1.NetworkPolicy{
+	ObjectMeta: v1.ObjectMeta{Name: "deny-all", Namespace: "shop"},
+	Spec: networkingv1.NetworkPolicySpec{
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+	},
+}
+
+func TestNetworkPolicyNoPolicy(t *testing.T) {
+	setupNetpolStubs()
+	// pods selected by no policy are not isolated
+	assert.Equal(t, PolicyAllowed, checkFlow(podFlow("web", "db", 5432)))
+}
+
+func TestNetworkPolicyAllow(t *testing.T) {
+	setupNetpolStubs(dbAllowWeb)
+	assert.Equal(t, PolicyAllowed, checkFlow(podFlow("web", "db", 5432)))
+	// wrong port
+	assert.Equal(t, PolicyDenied, checkFlow(podFlow("web", "db", 8080)))
+	// UDP doesn't match the default TCP protocol
+	flow := podFlow("web", "db", 5432)
+	flow["Proto"] = 17
+	assert.Equal(t, PolicyDenied, checkFlow(flow))
+	// not selected by the pod selector
+	assert.Equal(t, PolicyDenied, checkFlow(podFlow("db", "db", 5432)))
+	// selected by the namespace selector, on any port
+	assert.Equal(t, PolicyAllowed, checkFlow(podFlow("prometheus", "db", 9187)))
+	// web is not isolated
+	assert.Equal(t, PolicyAllowed, checkFlow(podFlow("db", "web", 8080)))
+}
+
+func TestNetworkPolicyDenyAll(t *testing.T) {
+	setupNetpolStubs(denyAll, dbAllowWeb)
+	// the ingress of db is allowed, but not the egress of web
+	assert.Equal(t, PolicyDenied, checkFlow(podFlow("web", "db", 5432)))
+	assert.Equal(t, PolicyDenied, checkFlow(podFlow("prometheus", "web", 8080)))
+	// monitoring is not isolated, and egress to external IPs is denied
+	assert.Equal(t, PolicyAllowed, checkFlow(podFlow("prometheus", "db", 9187)))
+	assert.Equal(t, PolicyDenied, checkFlow(config.GenericMap{
+		"SrcK8S_Namespace": "shop", "SrcK8S_Name": "web", "SrcK8S_Type": "Pod", "DstAddr": "1.1.1.1", "DstPort": 443, "Proto": 6,
+	}))
+}
+
+func TestNetworkPolicyIPBlockAndNamedPort(t *testing.T) {
+	https := intstr.FromString("https")
+	udp := corev1.ProtocolUDP
+	setupNetpolStubs(&networkingv1.NetworkPolicy{
+		ObjectMeta: v1.ObjectMeta{Name: "web-egress", Namespace: "shop"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: v1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{{
+				To:    []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "1.1.0.0/16", Except: []string{"1.1.1.0/24"}}}},
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp}},
+			}, {
+				Ports: []networkingv1.NetworkPolicyPort{{Port: &https}},
+			}},
+		},
+	})
+	external := func(ip string, proto int) config.GenericMap {
+		return config.GenericMap{
+			"SrcK8S_Namespace": "shop", "SrcK8S_Name": "web", "SrcK8S_Type": "Pod", "DstAddr": ip, "DstPort": 53, "Proto": proto,
+		}
+	}
+	assert.Equal(t, PolicyAllowed, checkFlow(external("1.1.2.3", 17)))
+	// TCP can only match the named port, which can't be resolved
+	assert.Equal(t, PolicyUnknown, checkFlow(external("1.1.2.3", 6)))
+	// in the except block
+	assert.Equal(t, PolicyUnknown, checkFlow(external("1.1.1.1", 6)))
+	assert.Equal(t, PolicyDenied, checkFlow(external("1.1.1.1", 17)))
+}
+
+func TestNetworkPolicyMissingMetadata(t *testing.T) {
+	setupNetpolStubs(denyAll)
+	// no kubernetes fields
+	assert.Equal(t, PolicyUnknown, checkFlow(config.GenericMap{"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "DstPort": 80, "Proto": 6}))
+	// a pod missing from the informers
+	assert.Equal(t, PolicyUnknown, checkFlow(podFlow("web", "unknown", 80)))
+	// node to pod: only the ingress of the pod is checked
+	assert.Equal(t, PolicyDenied, checkFlow(config.GenericMap{
+		"SrcK8S_Name": "node-1", "SrcK8S_Type": "Node", "DstK8S_Namespace": "shop", "DstK8S_Name": "web", "DstK8S_Type": "Pod", "DstPort": 80, "Proto": 6,
+	}))
+}
+
+func TestNetworkPolicyMultiCluster(t *testing.T) {
+	setupNetpolStubs()
+	east := informers
+	setupNetpolStubs(denyAll)
+	mc := inf.NewMultiCluster()
+	mc.Add("east", east)
+	mc.Add("west", informers)
+	informers = mc
+
+	// the pods and the policies are looked up in the cluster of the flow ends
+	flow := podFlow("web", "db", 5432)
+	flow["SrcK8S_ClusterName"], flow["DstK8S_ClusterName"] = "east", "east"
+	assert.Equal(t, PolicyAllowed, checkFlow(flow))
+	flow = podFlow("web", "db", 5432)
+	flow["SrcK8S_ClusterName"], flow["DstK8S_ClusterName"] = "west", "west"
+	assert.Equal(t, PolicyDenied, checkFlow(flow))
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netdb
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+)
+
+// transportProtocols are the protocols for which the IANA registry assigns ports, by name
+var transportProtocols = map[string]int{
+	"tcp":  6,
+	"udp":  17,
+	"dccp": 33,
+	"sctp": 132,
+}
+
+// fallbackProtocols are looked up in order when the protocol of a port is not known
+var fallbackProtocols = []int{6, 17, 132}
+
+type portProtoKey struct {
+	port  int
+	proto int
+}
+
+//go:embed iana_services.txt
+var ianaServicesData string
+
+// ianaServices is the bundled registry, parsed once at init
+var ianaServices = parseIANAServices(ianaServicesData)
+
+func parseIANAServices(data string) map[portProtoKey]string {
+	services := map[portProtoKey]string{}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(strings.SplitN(line, "#", 2)[0])
+		if len(fields) < 2 {
+			continue
+		}
+		portproto := strings.SplitN(fields[1], "/", 2)
+		if len(portproto) < 2 {
+			continue
+		}
+		port, err := strconv.Atoi(portproto[0])
+		if err != nil {
+			continue
+		}
+		if proto, ok := transportProtocols[portproto[1]]; ok {
+			services[portProtoKey{port: port, proto: proto}] = fields[0]
+		}
+	}
+	return services
+}
+
+// ProtocolNumber returns the number of a transport protocol given its name, case-insensitive
+func ProtocolNumber(name string) (int, bool) {
+	num, ok := transportProtocols[strings.ToLower(name)]
+	return num, ok
+}
+
+// PortServices resolves port numbers to service names from a subset of the IANA service name
+// registry bundled at build time, with optional site-specific overrides.
+type PortServices struct {
+	overrides map[portProtoKey]string
+}
+
+func NewPortServices() *PortServices {
+	return &PortServices{overrides: map[portProtoKey]string{}}
+}
+
+// Override sets the service name of a port, taking precedence over the registry. A zero protocol
+// number applies to any protocol.
+func (s *PortServices) Override(port, protoNum int, name string) {
+	s.overrides[portProtoKey{port: port, proto: protoNum}] = name
+}
+
+// ByPortAndProtocolNumber returns the service name given a port and a protocol number, or an empty
+// string when no service is known. A zero protocol number looks up TCP, UDP then SCTP.
+func (s *PortServices) ByPortAndProtocolNumber(port, protoNum int) string {
+	if protoNum == 0 {
+		if name, ok := s.overrides[portProtoKey{port: port}]; ok {
+			return name
+		}
+		for _, proto := range fallbackProtocols {
+			if name := s.ByPortAndProtocolNumber(port, proto); name != "" {
+				return name
+			}
+		}
+		return ""
+	}
+	if name, ok := s.overrides[portProtoKey{port: port, proto: protoNum}]; ok {
+		return name
+	}
+	if name, ok := s.overrides[portProtoKey{port: port}]; ok {
+		return name
+	}
+	return ianaServices[portProtoKey{port: port, proto: protoNum}]
+}
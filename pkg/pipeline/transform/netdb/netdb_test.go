@@ -80,3 +80,25 @@ func BenchmarkGetProtoByName(b *testing.B) {
 		db.ByPortAndProtocolName(27017, "TCP")
 	}
 }
+
+func TestPortServices(t *testing.T) {
+	svcs := NewPortServices()
+	assert.Equal(t, "http", svcs.ByPortAndProtocolNumber(80, 6))
+	assert.Equal(t, "https", svcs.ByPortAndProtocolNumber(443, 6))
+	assert.Equal(t, "domain", svcs.ByPortAndProtocolNumber(53, 17))
+	assert.Equal(t, "geneve", svcs.ByPortAndProtocolNumber(6081, 17))
+	// verify it returns nothing if the port isn't registered for that protocol
+	assert.Empty(t, svcs.ByPortAndProtocolNumber(6081, 6))
+	assert.Empty(t, svcs.ByPortAndProtocolNumber(40000, 6))
+	// verify it falls back to UDP when the protocol isn't known
+	assert.Equal(t, "vxlan", svcs.ByPortAndProtocolNumber(4789, 0))
+
+	// overrides take precedence over the registry, the exact protocol first
+	svcs.Override(8080, 0, "my-api")
+	svcs.Override(8080, 17, "my-api-udp")
+	assert.Equal(t, "my-api", svcs.ByPortAndProtocolNumber(8080, 6))
+	assert.Equal(t, "my-api-udp", svcs.ByPortAndProtocolNumber(8080, 17))
+	assert.Equal(t, "my-api", svcs.ByPortAndProtocolNumber(8080, 0))
+	// verify overrides are not shared
+	assert.Equal(t, "http-alt", NewPortServices().ByPortAndProtocolNumber(8080, 6))
+}
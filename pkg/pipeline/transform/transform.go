@@ -18,6 +18,8 @@
 package transform
 
 import (
+	"time"
+
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/sirupsen/logrus"
@@ -27,6 +29,27 @@ type Transformer interface {
 	Transform(in config.GenericMap) (config.GenericMap, bool)
 }
 
+// Reloader is implemented by the transformers reading files that are reloaded with the pipeline configuration,
+// even when the parameters of the stage didn't change
+type Reloader interface {
+	Reload() error
+}
+
+// MultiTransformer is implemented by the transformers that may output several flows from a single one;
+// the pipeline then calls TransformMulti rather than Transform
+type MultiTransformer interface {
+	TransformMulti(in config.GenericMap) []config.GenericMap
+}
+
+// Holder is implemented by the transformers that hold flows for a while, waiting for other flows: the pipeline
+// periodically releases the held flows that expired, and releases all of them when it stops
+type Holder interface {
+	// Expire returns the held flows that expired at now
+	Expire(now time.Time) []config.GenericMap
+	// Flush returns all the held flows
+	Flush() []config.GenericMap
+}
+
 type transformNone struct {
 }
 
@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var blog = logrus.WithField("component", "transform.Biflow")
+
+const (
+	defaultBiflowWindow     = 10 * time.Second
+	defaultBiflowMaxPending = 100000
+)
+
+// Biflow stitches the unidirectional flows of both directions of a connection into a single bidirectional flow.
+// A flow is held until the flow of the opposite direction shows up; if it doesn't within the window, e.g. with
+// asymmetric routing, the flow is forwarded as-is.
+type Biflow struct {
+	window     time.Duration
+	maxPending int
+	now        func() time.Time
+	// pending and fifo are protected by mutex
+	mutex   sync.Mutex
+	pending map[biflowKey]*list.Element
+	// pending flows, from the oldest to the newest
+	fifo *list.List
+}
+
+type biflowKey struct {
+	srcAddr, srcPort, dstAddr, dstPort, proto string
+}
+
+func (k biflowKey) reversed() biflowKey {
+	return biflowKey{srcAddr: k.dstAddr, srcPort: k.dstPort, dstAddr: k.srcAddr, dstPort: k.srcPort, proto: k.proto}
+}
+
+type pendingFlow struct {
+	key  biflowKey
+	flow config.GenericMap
+	seen time.Time
+}
+
+var biflowKeyFields = []string{"SrcAddr", "SrcPort", "DstAddr", "DstPort", "Proto"}
+
+// Transform merges the flow with the pending flow of the opposite direction, if any. Otherwise the flow is held,
+// and a previously held flow may be released as-is to make room for it.
+func (b *Biflow) Transform(entry config.GenericMap) (config.GenericMap, bool) {
+	var values [5]string
+	for i, field := range biflowKeyFields {
+		v, ok := entry[field]
+		if !ok {
+			// flows without the connection tuple can't be stitched
+			return entry, true
+		}
+		values[i] = utils.ConvertToString(v)
+	}
+	key := biflowKey{srcAddr: values[0], srcPort: values[1], dstAddr: values[2], dstPort: values[3], proto: values[4]}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if elem, ok := b.pending[key.reversed()]; ok {
+		b.remove(elem)
+		return mergeBiflow(elem.Value.(*pendingFlow).flow, entry), true
+	}
+	var released config.GenericMap
+	if elem, ok := b.pending[key]; ok {
+		// a new flow of the same direction: the previous one is not waiting anymore
+		released = b.remove(elem)
+	} else if len(b.pending) >= b.maxPending {
+		blog.Trace("pending flows table is full, releasing the oldest flow")
+		released = b.remove(b.fifo.Front())
+	}
+	b.pending[key] = b.fifo.PushBack(&pendingFlow{key: key, flow: entry, seen: b.now()})
+	return released, released != nil
+}
+
+func (b *Biflow) remove(elem *list.Element) config.GenericMap {
+	pf := elem.Value.(*pendingFlow)
+	delete(b.pending, pf.key)
+	b.fifo.Remove(elem)
+	return pf.flow
+}
+
+// Expire releases the flows that waited for the opposite direction for longer than the window
+func (b *Biflow) Expire(now time.Time) []config.GenericMap {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var expired []config.GenericMap
+	for elem := b.fifo.Front(); elem != nil && now.Sub(elem.Value.(*pendingFlow).seen) >= b.window; elem = b.fifo.Front() {
+		expired = append(expired, b.remove(elem))
+	}
+	return expired
+}
+
+// Flush releases all the pending flows
+func (b *Biflow) Flush() []config.GenericMap {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	flows := make([]config.GenericMap, 0, b.fifo.Len())
+	for elem := b.fifo.Front(); elem != nil; elem = b.fifo.Front() {
+		flows = append(flows, b.remove(elem))
+	}
+	return flows
+}
+
+// mergeBiflow builds the bidirectional flow of a connection, from the flow of its first seen direction (AB)
+// and the flow of the opposite one (BA)
+func mergeBiflow(ab, ba config.GenericMap) config.GenericMap {
+	merged := ab.Copy()
+	for _, field := range []string{"Bytes", "Packets"} {
+		delete(merged, field)
+		if v, ok := ab[field]; ok {
+			merged[field+"AB"] = v
+		}
+		if v, ok := ba[field]; ok {
+			merged[field+"BA"] = v
+		}
+	}
+	// the bidirectional flow spans both flows
+	if start, ok := ba["TimeFlowStartMs"]; ok {
+		if current, found := merged["TimeFlowStartMs"]; !found || lessThan(start, current) {
+			merged["TimeFlowStartMs"] = start
+		}
+	}
+	if end, ok := ba["TimeFlowEndMs"]; ok {
+		if current, found := merged["TimeFlowEndMs"]; !found || lessThan(current, end) {
+			merged["TimeFlowEndMs"] = end
+		}
+	}
+	return merged
+}
+
+func lessThan(a, b interface{}) bool {
+	fa, errA := utils.ConvertToFloat64(a)
+	fb, errB := utils.ConvertToFloat64(b)
+	return errA == nil && errB == nil && fa < fb
+}
+
+// NewTransformBiflow creates a new biflow transform
+func NewTransformBiflow(params config.StageParam) (Transformer, error) {
+	blog.Debugf("entering NewTransformBiflow")
+	cfg := api.TransformBiflow{}
+	if params.Transform != nil && params.Transform.Biflow != nil {
+		cfg = *params.Transform.Biflow
+	}
+	b := &Biflow{
+		window:     cfg.Window.Duration,
+		maxPending: cfg.MaxPending,
+		now:        time.Now,
+		pending:    map[biflowKey]*list.Element{},
+		fifo:       list.New(),
+	}
+	if b.window <= 0 {
+		b.window = defaultBiflowWindow
+	}
+	if b.maxPending <= 0 {
+		b.maxPending = defaultBiflowMaxPending
+	}
+	return b, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBiflow(t *testing.T, cfg api.TransformBiflow, clock *time.Time) *Biflow {
+	tr, err := NewTransformBiflow(config.NewTransformBiflowParams("biflow", cfg))
+	require.NoError(t, err)
+	b := tr.(*Biflow)
+	b.now = func() time.Time { return *clock }
+	return b
+}
+
+func biflowFlow(src string, srcPort int, dst string, dstPort int, bytes int) config.GenericMap {
+	return config.GenericMap{
+		"SrcAddr": src, "SrcPort": srcPort, "DstAddr": dst, "DstPort": dstPort, "Proto": 6,
+		"Bytes": bytes, "Packets": bytes / 100,
+		"TimeFlowStartMs": 1000 + srcPort, "TimeFlowEndMs": 2000 + srcPort,
+	}
+}
+
+func Test_Transform_Biflow(t *testing.T) {
+	clock := time.Now()
+	b := newTestBiflow(t, api.TransformBiflow{}, &clock)
+
+	_, ok := b.Transform(biflowFlow("10.0.0.1", 40000, "10.0.0.2", 443, 500))
+	require.False(t, ok)
+	// another connection between the same hosts doesn't match
+	_, ok = b.Transform(biflowFlow("10.0.0.2", 443, "10.0.0.1", 40001, 300))
+	require.False(t, ok)
+
+	merged, ok := b.Transform(biflowFlow("10.0.0.2", 443, "10.0.0.1", 40000, 9000))
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{
+		"SrcAddr": "10.0.0.1", "SrcPort": 40000, "DstAddr": "10.0.0.2", "DstPort": 443, "Proto": 6,
+		"BytesAB": 500, "BytesBA": 9000, "PacketsAB": 5, "PacketsBA": 90,
+		"TimeFlowStartMs": 443 + 1000, "TimeFlowEndMs": 40000 + 2000,
+	}, merged)
+	require.Len(t, b.pending, 1)
+
+	// flows without the connection tuple pass through
+	icmp := config.GenericMap{"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "Proto": 1}
+	out, ok := b.Transform(icmp)
+	require.True(t, ok)
+	require.Equal(t, icmp, out)
+}
+
+func Test_Transform_BiflowExpiry(t *testing.T) {
+	clock := time.Now()
+	b := newTestBiflow(t, api.TransformBiflow{Window: api.Duration{Duration: 10 * time.Second}}, &clock)
+
+	// with asymmetric routing, a direction is never seen: the flow is forwarded as-is after the window
+	oneWay := biflowFlow("10.0.0.1", 40000, "10.0.0.2", 443, 500)
+	_, ok := b.Transform(oneWay)
+	require.False(t, ok)
+	clock = clock.Add(5 * time.Second)
+	_, ok = b.Transform(biflowFlow("10.0.0.1", 40001, "10.0.0.2", 443, 700))
+	require.False(t, ok)
+
+	require.Empty(t, b.Expire(clock.Add(4*time.Second)))
+	require.Equal(t, []config.GenericMap{oneWay}, b.Expire(clock.Add(5*time.Second)))
+
+	// the opposite direction after expiry is not merged anymore
+	_, ok = b.Transform(biflowFlow("10.0.0.2", 443, "10.0.0.1", 40000, 9000))
+	require.False(t, ok)
+	require.Len(t, b.Flush(), 2)
+	require.Empty(t, b.pending)
+	require.Zero(t, b.fifo.Len())
+}
+
+func Test_Transform_BiflowMaxPending(t *testing.T) {
+	clock := time.Now()
+	b := newTestBiflow(t, api.TransformBiflow{MaxPending: 2}, &clock)
+
+	first := biflowFlow("10.0.0.1", 40000, "10.0.0.2", 443, 500)
+	_, ok := b.Transform(first)
+	require.False(t, ok)
+	_, ok = b.Transform(biflowFlow("10.0.0.1", 40001, "10.0.0.2", 443, 500))
+	require.False(t, ok)
+
+	// the table is full: the oldest flow is released to make room
+	out, ok := b.Transform(biflowFlow("10.0.0.1", 40002, "10.0.0.2", 443, 500))
+	require.True(t, ok)
+	require.Equal(t, first, out)
+	require.Len(t, b.pending, 2)
+
+	// a new flow of a pending direction releases the previous one
+	second := biflowFlow("10.0.0.1", 40001, "10.0.0.2", 443, 800)
+	out, ok = b.Transform(second)
+	require.True(t, ok)
+	require.Equal(t, 500, out["Bytes"])
+	require.Equal(t, []config.GenericMap{biflowFlow("10.0.0.1", 40002, "10.0.0.2", 443, 500), second}, b.Flush())
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var dlog = logrus.WithField("component", "transform.Dedupe")
+
+var dedupeDroppedDef = operational.DefineMetric(
+	"dedupe_dropped_flows_total",
+	"Counter of duplicate flows dropped or merged by the dedupe transform",
+	operational.TypeCounter,
+	"stage",
+)
+
+const (
+	defaultDedupeWindow     = 10 * time.Second
+	defaultDedupeMaxEntries = 100000
+)
+
+// Dedupe drops the flows having the same fingerprint as a flow seen less than a window ago. In merge mode, or when
+// counting the duplicates, whose number is known once the window has ended, the first flow of a window is held instead
+// until the window ends; in merge mode, the duplicates are merged into it.
+type Dedupe struct {
+	keys        []string
+	window      time.Duration
+	maxEntries  int
+	countField  string
+	merge       bool
+	holdFlows   bool
+	mergeFields []string
+	now         func() time.Time
+	dropped     prometheus.Counter
+	// hasher, fingerprints, lru and held are protected by mutex
+	mutex        sync.Mutex
+	hasher       hash.Hash64
+	fingerprints map[uint64]*list.Element
+	// fingerprints ordered from the least to the most recently seen
+	lru *list.List
+	// when holding flows, fingerprints holding a flow, from the oldest to the newest window
+	held *list.List
+}
+
+type fingerprint struct {
+	hash        uint64
+	windowStart time.Time
+	duplicates  int
+	// when holding flows, the flow held until the end of the window
+	flow     config.GenericMap
+	heldElem *list.Element
+}
+
+// Transform drops the flow if it is a duplicate; otherwise it is forwarded. When holding flows, other flows are held,
+// and a previously held flow may be released to make room for them; in merge mode, duplicates are merged into the
+// held flow.
+func (d *Dedupe) Transform(entry config.GenericMap) (config.GenericMap, bool) {
+	now := d.now()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	h := d.fingerprint(entry)
+	if elem, ok := d.fingerprints[h]; ok {
+		d.lru.MoveToBack(elem)
+		fp := elem.Value.(*fingerprint)
+		if now.Sub(fp.windowStart) < d.window {
+			fp.duplicates++
+			d.dropped.Inc()
+			if d.merge && fp.flow != nil {
+				d.mergeInto(fp.flow, entry)
+			}
+			return nil, false
+		}
+		// the window has elapsed: this flow starts a new one
+		if d.holdFlows {
+			released := d.release(fp)
+			d.hold(fp, entry, now)
+			return released, released != nil
+		}
+		fp.windowStart = now
+		fp.duplicates = 0
+		return entry, true
+	}
+	var released config.GenericMap
+	if len(d.fingerprints) >= d.maxEntries {
+		oldest := d.lru.Front()
+		fp := oldest.Value.(*fingerprint)
+		released = d.release(fp)
+		delete(d.fingerprints, fp.hash)
+		d.lru.Remove(oldest)
+		dlog.Trace("fingerprints store is full, evicting the least recently seen")
+	}
+	fp := &fingerprint{hash: h, windowStart: now}
+	d.fingerprints[h] = d.lru.PushBack(fp)
+	if d.holdFlows {
+		d.hold(fp, entry, now)
+		return released, released != nil
+	}
+	return entry, true
+}
+
+func (d *Dedupe) hold(fp *fingerprint, entry config.GenericMap, now time.Time) {
+	fp.windowStart = now
+	fp.duplicates = 0
+	// the held flow is modified by the merges
+	fp.flow = entry.Copy()
+	fp.heldElem = d.held.PushBack(fp)
+}
+
+// release returns the flow held by the fingerprint, if any, with the number of its duplicates
+func (d *Dedupe) release(fp *fingerprint) config.GenericMap {
+	if fp.flow == nil {
+		return nil
+	}
+	flow := fp.flow
+	if d.countField != "" {
+		flow[d.countField] = fp.duplicates
+	}
+	d.held.Remove(fp.heldElem)
+	fp.flow = nil
+	fp.heldElem = nil
+	return flow
+}
+
+// mergeInto adds the merge fields of the duplicate to the held flow
+func (d *Dedupe) mergeInto(flow, duplicate config.GenericMap) {
+	for _, field := range d.mergeFields {
+		v, ok := duplicate[field]
+		if !ok {
+			continue
+		}
+		current, ok := flow[field]
+		if !ok {
+			flow[field] = v
+			continue
+		}
+		sum, err := addValues(current, v)
+		if err != nil {
+			dlog.Debugf("can't merge field %s: %v", field, err)
+			continue
+		}
+		flow[field] = sum
+	}
+}
+
+// addValues sums two numbers: as int64 when both are signed integers, as uint64 when both are unsigned, and as
+// float64 otherwise
+func addValues(a, b any) (any, error) {
+	na, nb := normalizeValue(a), normalizeValue(b)
+	switch va := na.(type) {
+	case int64:
+		if vb, ok := nb.(int64); ok {
+			return va + vb, nil
+		}
+	case uint64:
+		if vb, ok := nb.(uint64); ok {
+			return va + vb, nil
+		}
+	}
+	fa, err := utils.ConvertToFloat64(na)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := utils.ConvertToFloat64(nb)
+	if err != nil {
+		return nil, err
+	}
+	return fa + fb, nil
+}
+
+// Expire releases the held flows whose window has ended
+func (d *Dedupe) Expire(now time.Time) []config.GenericMap {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var expired []config.GenericMap
+	for elem := d.held.Front(); elem != nil && now.Sub(elem.Value.(*fingerprint).windowStart) >= d.window; elem = d.held.Front() {
+		expired = append(expired, d.release(elem.Value.(*fingerprint)))
+	}
+	return expired
+}
+
+// Flush releases all the held flows
+func (d *Dedupe) Flush() []config.GenericMap {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	flows := make([]config.GenericMap, 0, d.held.Len())
+	for elem := d.held.Front(); elem != nil; elem = d.held.Front() {
+		flows = append(flows, d.release(elem.Value.(*fingerprint)))
+	}
+	return flows
+}
+
+// fingerprint hashes the values of the key fields; a missing field is distinguished from an empty one
+func (d *Dedupe) fingerprint(entry config.GenericMap) uint64 {
+	d.hasher.Reset()
+	for _, key := range d.keys {
+		if value, ok := entry[key]; ok {
+			_, _ = d.hasher.Write([]byte{1})
+			_, _ = d.hasher.Write([]byte(utils.ConvertToString(value)))
+		}
+		_, _ = d.hasher.Write([]byte{0})
+	}
+	return d.hasher.Sum64()
+}
+
+// NewTransformDedupe creates a new dedupe transform
+func NewTransformDedupe(params config.StageParam, opMetrics *operational.Metrics) (Transformer, error) {
+	dlog.Debugf("entering NewTransformDedupe")
+	cfg := api.TransformDedupe{}
+	if params.Transform != nil && params.Transform.Dedupe != nil {
+		cfg = *params.Transform.Dedupe
+	}
+	if len(cfg.Keys) == 0 {
+		return nil, errors.New("dedupe: keys must be provided")
+	}
+	var hasher hash.Hash64
+	switch cfg.Hash {
+	case "", api.DedupeHashFNV:
+		hasher = fnv.New64a()
+	case api.DedupeHashXXHash:
+		hasher = xxhash.New()
+	default:
+		return nil, fmt.Errorf("dedupe: unknown hash %s", cfg.Hash)
+	}
+	switch cfg.Mode {
+	case "", api.DedupeKeepFirst, api.DedupeMerge:
+	default:
+		return nil, fmt.Errorf("dedupe: unknown mode %s", cfg.Mode)
+	}
+	d := &Dedupe{
+		keys:         cfg.Keys,
+		window:       cfg.Window.Duration,
+		maxEntries:   cfg.MaxEntries,
+		countField:   cfg.CountField,
+		merge:        cfg.Mode == api.DedupeMerge,
+		holdFlows:    cfg.Mode == api.DedupeMerge || cfg.CountField != "",
+		mergeFields:  cfg.MergeFields,
+		now:          time.Now,
+		dropped:      opMetrics.NewCounter(&dedupeDroppedDef, params.Name),
+		hasher:       hasher,
+		fingerprints: map[uint64]*list.Element{},
+		lru:          list.New(),
+		held:         list.New(),
+	}
+	if d.window <= 0 {
+		d.window = defaultDedupeWindow
+	}
+	if d.maxEntries <= 0 {
+		d.maxEntries = defaultDedupeMaxEntries
+	}
+	if d.mergeFields == nil {
+		d.mergeFields = []string{"Bytes", "Packets"}
+	}
+	return d, nil
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigTransformDedupe = `---
+log-level: debug
+pipeline:
+  - name: dedupe1
+parameters:
+  - name: dedupe1
+    transform:
+      type: dedupe
+      dedupe:
+        keys: [SrcAddr, DstAddr, SrcPort, DstPort, Proto]
+        window: 30s
+        hash: xxhash
+`
+
+func newTestDedupe(t *testing.T, cfg api.TransformDedupe, clock *time.Time) *Dedupe {
+	tr, err := NewTransformDedupe(config.NewTransformDedupeParams("dedupe", cfg), opMetrics)
+	require.NoError(t, err)
+	d := tr.(*Dedupe)
+	d.now = func() time.Time { return *clock }
+	return d
+}
+
+func dedupeFlow(srcPort int, bytes any) config.GenericMap {
+	return config.GenericMap{"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "SrcPort": srcPort, "DstPort": 443, "Proto": 6, "Bytes": bytes}
+}
+
+func Test_Transform_Dedupe(t *testing.T) {
+	_, cfg := test.InitConfig(t, testConfigTransformDedupe)
+	clock := time.Now()
+	d := newTestDedupe(t, *cfg.Parameters[0].Transform.Dedupe, &clock)
+
+	out, keep := d.Transform(dedupeFlow(1234, 100))
+	require.True(t, keep)
+	require.Equal(t, 100, out["Bytes"])
+
+	// fields out of the keys don't matter
+	_, keep = d.Transform(dedupeFlow(1234, 200))
+	require.False(t, keep)
+	clock = clock.Add(29 * time.Second)
+	_, keep = d.Transform(dedupeFlow(1234, 300))
+	require.False(t, keep)
+
+	_, keep = d.Transform(dedupeFlow(1235, 100))
+	require.True(t, keep)
+
+	// a missing key differs from an empty one
+	flow := dedupeFlow(1234, 100)
+	delete(flow, "Proto")
+	_, keep = d.Transform(flow)
+	require.True(t, keep)
+	flow["Proto"] = ""
+	_, keep = d.Transform(flow)
+	require.True(t, keep)
+
+	// after the window, the flow is kept
+	clock = clock.Add(time.Second)
+	out, keep = d.Transform(dedupeFlow(1234, 400))
+	require.True(t, keep)
+	require.Equal(t, 400, out["Bytes"])
+	require.NotContains(t, out, "dedupe_count")
+	require.Empty(t, d.Flush())
+	_, keep = d.Transform(dedupeFlow(1234, 500))
+	require.False(t, keep)
+
+	m := &dto.Metric{}
+	require.NoError(t, d.dropped.Write(m))
+	require.Equal(t, 3.0, m.GetCounter().GetValue())
+}
+
+func Test_Transform_DedupeCount(t *testing.T) {
+	clock := time.Now()
+	d := newTestDedupe(t, api.TransformDedupe{
+		Keys:       []string{"SrcPort"},
+		Window:     api.Duration{Duration: 10 * time.Second},
+		CountField: "dedupe_count",
+	}, &clock)
+
+	// the first flow is held until the end of its window, and its duplicates are dropped
+	_, keep := d.Transform(dedupeFlow(1, 100))
+	require.False(t, keep)
+	_, keep = d.Transform(dedupeFlow(1, 200))
+	require.False(t, keep)
+	_, keep = d.Transform(dedupeFlow(1, 300))
+	require.False(t, keep)
+	require.Empty(t, d.Expire(clock.Add(9*time.Second)))
+
+	// it is forwarded when its window ends, with the number of duplicates dropped during the window
+	expired := d.Expire(clock.Add(10 * time.Second))
+	require.Len(t, expired, 1)
+	require.Equal(t, 100, expired[0]["Bytes"])
+	require.Equal(t, 2, expired[0]["dedupe_count"])
+
+	// the flow of the last window is forwarded when the pipeline stops
+	clock = clock.Add(10 * time.Second)
+	_, keep = d.Transform(dedupeFlow(1, 400))
+	require.False(t, keep)
+	_, keep = d.Transform(dedupeFlow(1, 500))
+	require.False(t, keep)
+	flushed := d.Flush()
+	require.Len(t, flushed, 1)
+	require.Equal(t, 400, flushed[0]["Bytes"])
+	require.Equal(t, 1, flushed[0]["dedupe_count"])
+}
+
+func Test_Transform_DedupeMerge(t *testing.T) {
+	clock := time.Now()
+	d := newTestDedupe(t, api.TransformDedupe{
+		Keys:       []string{"SrcPort"},
+		Window:     api.Duration{Duration: 10 * time.Second},
+		Mode:       api.DedupeMerge,
+		CountField: "dedupe_count",
+	}, &clock)
+
+	// the first flow is held, and the counters of its duplicates are added to it
+	first := dedupeFlow(1, 100)
+	first["Packets"] = uint64(1)
+	_, keep := d.Transform(first)
+	require.False(t, keep)
+	dup := dedupeFlow(1, 200)
+	dup["Packets"] = uint32(2)
+	_, keep = d.Transform(dup)
+	require.False(t, keep)
+	_, keep = d.Transform(dedupeFlow(1, 50.5))
+	require.False(t, keep)
+	require.Empty(t, d.Expire(clock.Add(9*time.Second)))
+	require.NotContains(t, first, "dedupe_count")
+
+	clock = clock.Add(5 * time.Second)
+	_, keep = d.Transform(dedupeFlow(2, 10))
+	require.False(t, keep)
+	_, keep = d.Transform(dedupeFlow(2, 20))
+	require.False(t, keep)
+
+	// only the window of the first fingerprint has ended
+	expired := d.Expire(clock.Add(5 * time.Second))
+	require.Equal(t, []config.GenericMap{{
+		"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "SrcPort": 1, "DstPort": 443, "Proto": 6,
+		"Bytes": 350.5, "Packets": uint64(3), "dedupe_count": 2,
+	}}, expired)
+
+	// a flow after the window releases the held one and is held in its turn
+	clock = clock.Add(10 * time.Second)
+	out, keep := d.Transform(dedupeFlow(2, 40))
+	require.True(t, keep)
+	require.Equal(t, int64(30), out["Bytes"])
+	require.Equal(t, 1, out["dedupe_count"])
+
+	flushed := d.Flush()
+	require.Len(t, flushed, 1)
+	require.Equal(t, 40, flushed[0]["Bytes"])
+	require.Equal(t, 0, flushed[0]["dedupe_count"])
+	require.Empty(t, d.Flush())
+
+	m := &dto.Metric{}
+	require.NoError(t, d.dropped.Write(m))
+	require.Equal(t, 3.0, m.GetCounter().GetValue())
+}
+
+func Test_Transform_DedupeMergeEviction(t *testing.T) {
+	clock := time.Now()
+	d := newTestDedupe(t, api.TransformDedupe{Keys: []string{"SrcPort"}, MaxEntries: 1, Mode: api.DedupeMerge}, &clock)
+
+	_, keep := d.Transform(dedupeFlow(1, 100))
+	require.False(t, keep)
+	_, keep = d.Transform(dedupeFlow(1, 100))
+	require.False(t, keep)
+	// the evicted fingerprint releases its flow
+	out, keep := d.Transform(dedupeFlow(2, 100))
+	require.True(t, keep)
+	require.Equal(t, int64(200), out["Bytes"])
+	require.Equal(t, 1, d.held.Len())
+}
+
+func Test_Transform_DedupeEviction(t *testing.T) {
+	clock := time.Now()
+	d := newTestDedupe(t, api.TransformDedupe{Keys: []string{"SrcPort"}, MaxEntries: 2}, &clock)
+
+	flow := dedupeFlow(1, 100)
+	_, keep := d.Transform(flow)
+	require.True(t, keep)
+	require.NotContains(t, flow, "dedupe_count")
+	_, keep = d.Transform(dedupeFlow(2, 100))
+	require.True(t, keep)
+	// 1 is seen again, so 2 is the least recently seen one
+	_, keep = d.Transform(dedupeFlow(1, 100))
+	require.False(t, keep)
+	_, keep = d.Transform(dedupeFlow(3, 100))
+	require.True(t, keep)
+	require.Len(t, d.fingerprints, 2)
+	require.Equal(t, 2, d.lru.Len())
+
+	_, keep = d.Transform(dedupeFlow(1, 100))
+	require.False(t, keep)
+	_, keep = d.Transform(dedupeFlow(2, 100))
+	require.True(t, keep)
+}
+
+func Test_Transform_DedupeConcurrent(t *testing.T) {
+	clock := time.Now()
+	d := newTestDedupe(t, api.TransformDedupe{Keys: []string{"SrcPort"}, MaxEntries: 1000}, &clock)
+
+	var kept atomic.Int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for port := 0; port < 100; port++ {
+				if _, keep := d.Transform(dedupeFlow(port, 100)); keep {
+					kept.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 100, kept.Load())
+}
+
+func Test_NewTransformDedupeErrors(t *testing.T) {
+	_, err := NewTransformDedupe(config.NewTransformDedupeParams("dedupe", api.TransformDedupe{}), opMetrics)
+	require.Error(t, err)
+	_, err = NewTransformDedupe(config.NewTransformDedupeParams("dedupe", api.TransformDedupe{Keys: []string{"SrcAddr"}, Hash: "md5"}), opMetrics)
+	require.Error(t, err)
+
+	_, err = NewTransformDedupe(config.NewTransformDedupeParams("dedupe", api.TransformDedupe{Keys: []string{"SrcAddr"}, Mode: "keep_last"}), opMetrics)
+	require.Error(t, err)
+
+	tr, err := NewTransformDedupe(config.NewTransformDedupeParams("dedupe", api.TransformDedupe{Keys: []string{"SrcAddr"}}), opMetrics)
+	require.NoError(t, err)
+	require.Equal(t, defaultDedupeWindow, tr.(*Dedupe).window)
+	require.Equal(t, defaultDedupeMaxEntries, tr.(*Dedupe).maxEntries)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+var elog = logrus.WithField("component", "transform.Explode")
+
+// Explode emits several records from each flow, e.g. one per header of tunneled flows
+type Explode struct {
+	outputs []api.ExplodeOutput
+}
+
+// TransformMulti returns the records built from the flow, in the order of the configured outputs
+func (e *Explode) TransformMulti(entry config.GenericMap) []config.GenericMap {
+	records := make([]config.GenericMap, 0, len(e.outputs))
+	for i := range e.outputs {
+		output := &e.outputs[i]
+		if output.When != "" {
+			if _, ok := entry[output.When]; !ok {
+				continue
+			}
+		}
+		record := entry.Copy()
+		for _, field := range output.Remove {
+			delete(record, field)
+		}
+		for _, field := range output.Set {
+			switch {
+			case field.Input == "":
+				record[field.Output] = field.Value
+			case entry[field.Input] != nil:
+				record[field.Output] = entry[field.Input]
+			default:
+				delete(record, field.Output)
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// Transform only returns the first record of the flow; the pipeline gets all of them from TransformMulti
+func (e *Explode) Transform(entry config.GenericMap) (config.GenericMap, bool) {
+	records := e.TransformMulti(entry)
+	if len(records) == 0 {
+		return nil, false
+	}
+	return records[0], true
+}
+
+// NewTransformExplode creates a new explode transform
+func NewTransformExplode(params config.StageParam) (Transformer, error) {
+	elog.Debugf("entering NewTransformExplode")
+	cfg := api.TransformExplode{}
+	if params.Transform != nil && params.Transform.Explode != nil {
+		cfg = *params.Transform.Explode
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Explode{outputs: cfg.Outputs}, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigTransformExplode = `---
+log-level: debug
+pipeline:
+  - name: explode1
+parameters:
+  - name: explode1
+    transform:
+      type: explode
+      explode:
+        outputs:
+          - remove: [InnerSrcAddr, InnerDstAddr]
+            set:
+              - { output: Header, value: outer }
+          - when: InnerSrcAddr
+            remove: [InnerSrcAddr, InnerDstAddr]
+            set:
+              - { output: SrcAddr, input: InnerSrcAddr }
+              - { output: DstAddr, input: InnerDstAddr }
+              - { output: Header, value: inner }
+`
+
+func Test_Transform_Explode(t *testing.T) {
+	_, cfg := test.InitConfig(t, testConfigTransformExplode)
+	tr, err := NewTransformExplode(cfg.Parameters[0])
+	require.NoError(t, err)
+	e := tr.(*Explode)
+
+	flow := config.GenericMap{
+		"SrcAddr": "192.168.0.1", "DstAddr": "192.168.0.2",
+		"InnerSrcAddr": "10.0.0.1", "InnerDstAddr": "10.0.0.2", "Bytes": 100,
+	}
+	require.Equal(t, []config.GenericMap{
+		{"SrcAddr": "192.168.0.1", "DstAddr": "192.168.0.2", "Bytes": 100, "Header": "outer"},
+		{"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "Bytes": 100, "Header": "inner"},
+	}, e.TransformMulti(flow))
+	// the input flow is left unchanged
+	require.Len(t, flow, 5)
+
+	// without inner header, only the outer record is emitted
+	records := e.TransformMulti(config.GenericMap{"SrcAddr": "192.168.0.1", "DstAddr": "192.168.0.2"})
+	require.Equal(t, []config.GenericMap{{"SrcAddr": "192.168.0.1", "DstAddr": "192.168.0.2", "Header": "outer"}}, records)
+
+	// Transform returns the first record
+	out, ok := e.Transform(flow)
+	require.True(t, ok)
+	require.Equal(t, "outer", out["Header"])
+}
+
+func Test_Transform_ExplodeInvalid(t *testing.T) {
+	_, err := NewTransformExplode(config.NewTransformExplodeParams("explode", api.TransformExplode{}))
+	require.Error(t, err)
+	_, err = NewTransformExplode(config.NewTransformExplodeParams("explode", api.TransformExplode{
+		Outputs: []api.ExplodeOutput{{Set: []api.ExplodeField{{Input: "InnerSrcAddr"}}}},
+	}))
+	require.Error(t, err)
+}
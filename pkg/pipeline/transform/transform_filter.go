@@ -22,7 +22,6 @@ import (
 	"math/rand"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/Knetic/govaluate"
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
@@ -32,14 +31,15 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-var (
-	tlog   = logrus.WithField("component", "transform.Filter")
-	rndgen = rand.New(rand.NewSource(time.Now().UnixNano()))
-)
+var tlog = logrus.WithField("component", "transform.Filter")
 
 type Filter struct {
 	Rules     []api.TransformFilterRule
 	KeepRules []predicatesRule
+	// CIDR tries, indexed by position in Rules
+	cidrTries map[int]*utils.CIDRTrie
+	// keep_entry_expression and cel predicates, indexed by position in Rules
+	expressions map[int]filters.Predicate
 }
 
 type predicatesRule struct {
@@ -66,6 +66,18 @@ func (f *Filter) Transform(entry config.GenericMap) (config.GenericMap, bool) {
 	}
 	for i := range f.Rules {
 		tlog.Tracef("rule = %v", f.Rules[i])
+		if f.Rules[i].Type == api.CIDRFilter {
+			if !keepCIDRMatch(outputEntry, f.Rules[i].CIDR, f.cidrTries[i]) {
+				return nil, false
+			}
+			continue
+		}
+		if f.Rules[i].Type == api.KeepEntryExpression || f.Rules[i].Type == api.KeepEntryCEL {
+			if !f.expressions[i](outputEntry) {
+				return nil, false
+			}
+			continue
+		}
 		if cont := applyRule(outputEntry, labels, &f.Rules[i]); !cont {
 			return nil, false
 		}
@@ -165,6 +177,12 @@ func applyRule(entry config.GenericMap, labels map[string]string, rule *api.Tran
 	case api.KeepEntryAllSatisfied:
 		// This should be processed only in "applyPredicates". Failure to do so is a bug.
 		tlog.Panicf("unexpected KeepEntryAllSatisfied: %v", rule)
+	case api.CIDRFilter:
+		// This should be processed only in "keepCIDRMatch". Failure to do so is a bug.
+		tlog.Panicf("unexpected CIDRFilter: %v", rule)
+	case api.KeepEntryExpression, api.KeepEntryCEL:
+		// This should be processed only in "Transform". Failure to do so is a bug.
+		tlog.Panicf("unexpected %s: %v", rule.Type, rule)
 	default:
 		tlog.Panicf("unknown type %s for transform.Filter rule: %v", rule.Type, rule)
 	}
@@ -181,6 +199,16 @@ func isRemoveEntrySatisfied(entry config.GenericMap, rules []*api.RemoveEntryRul
 	return true
 }
 
+// keepCIDRMatch returns false if the entry must be removed
+func keepCIDRMatch(entry config.GenericMap, rule *api.TransformFilterCIDRRule, trie *utils.CIDRTrie) bool {
+	ip, _ := entry.LookupString(rule.Input)
+	matches := trie.Contains(ip)
+	if rule.KeepMatching == nil || *rule.KeepMatching {
+		return matches
+	}
+	return !matches
+}
+
 func applyPredicates(entry config.GenericMap, rule predicatesRule) bool {
 	if !rollSampling(rule.sampling) {
 		return false
@@ -202,8 +230,9 @@ func sample(entry config.GenericMap, rules []*api.SamplingCondition) bool {
 	return true
 }
 
+// rollSampling uses the global generator, which is safe for concurrent use when the stage runs several workers
 func rollSampling(value uint16) bool {
-	return value == 0 || (rndgen.Intn(int(value)) == 0)
+	return value == 0 || (rand.Intn(int(value)) == 0)
 }
 
 // NewTransformFilter create a new filter transform
@@ -211,6 +240,8 @@ func NewTransformFilter(params config.StageParam) (Transformer, error) {
 	tlog.Debugf("entering NewTransformFilter")
 	keepRules := []predicatesRule{}
 	rules := []api.TransformFilterRule{}
+	cidrTries := map[int]*utils.CIDRTrie{}
+	expressions := map[int]filters.Predicate{}
 	if params.Transform != nil && params.Transform.Filter != nil {
 		params.Transform.Filter.Preprocess()
 		for i := range params.Transform.Filter.Rules {
@@ -226,13 +257,39 @@ func NewTransformFilter(params config.StageParam) (Transformer, error) {
 				}
 				keepRules = append(keepRules, pr)
 			} else {
+				if baseRules.Type == api.CIDRFilter {
+					if baseRules.CIDR == nil {
+						return nil, fmt.Errorf("missing cidr configuration for cidr filter rule")
+					}
+					trie, err := utils.NewCIDRTrie(baseRules.CIDR.CIDRs)
+					if err != nil {
+						return nil, err
+					}
+					cidrTries[len(rules)] = trie
+				}
+				if baseRules.Type == api.KeepEntryExpression {
+					pred, err := filters.FromExpression(baseRules.KeepEntryExpression)
+					if err != nil {
+						return nil, err
+					}
+					expressions[len(rules)] = pred
+				}
+				if baseRules.Type == api.KeepEntryCEL {
+					pred, err := filters.FromCEL(baseRules.CEL)
+					if err != nil {
+						return nil, err
+					}
+					expressions[len(rules)] = pred
+				}
 				rules = append(rules, *baseRules)
 			}
 		}
 	}
 	transformFilter := &Filter{
-		Rules:     rules,
-		KeepRules: keepRules,
+		Rules:       rules,
+		KeepRules:   keepRules,
+		cidrTries:   cidrTries,
+		expressions: expressions,
 	}
 	return transformFilter, nil
 }
@@ -234,6 +234,194 @@ func TestNewTransformFilterAddField(t *testing.T) {
 	require.Equal(t, 1, output["dummy_field"])
 }
 
+const testConfigTransformFilterKeepEntryCompare = `---
+log-level: debug
+pipeline:
+  - name: filter1
+parameters:
+  - name: filter1
+    transform:
+      type: filter
+      filter:
+        rules:
+        - type: keep_entry_all_satisfied
+          keepEntryAllSatisfied:
+          - type: keep_entry_if_greater_or_equal
+            keepEntry:
+              input: Bytes
+              value: 1000
+          - type: keep_entry_if_in
+            keepEntry:
+              input: Proto
+              value: [6, 17]
+          - type: keep_entry_if_not_in
+            keepEntry:
+              input: Namespace
+              value: [kube-system, openshift-dns]
+`
+
+func Test_Transform_KeepEntryCompare(t *testing.T) {
+	tf := InitNewTransformFilter(t, testConfigTransformFilterKeepEntryCompare)
+
+	_, keep := tf.Transform(config.GenericMap{"Bytes": 1000, "Proto": 6, "Namespace": "default"})
+	require.True(t, keep)
+	// mixed types
+	_, keep = tf.Transform(config.GenericMap{"Bytes": "1500", "Proto": "17", "Namespace": "default"})
+	require.True(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"Bytes": uint64(1500), "Proto": uint8(17)})
+	require.True(t, keep)
+
+	_, keep = tf.Transform(config.GenericMap{"Bytes": 999, "Proto": 6, "Namespace": "default"})
+	require.False(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"Bytes": 1000, "Proto": 1, "Namespace": "default"})
+	require.False(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"Bytes": 1000, "Proto": 6, "Namespace": "kube-system"})
+	require.False(t, keep)
+	// missing fields
+	_, keep = tf.Transform(config.GenericMap{"Proto": 6, "Namespace": "default"})
+	require.False(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"Bytes": 1000, "Namespace": "default"})
+	require.False(t, keep)
+}
+
+func Test_Transform_KeepEntryInRequiresList(t *testing.T) {
+	newFilter := api.TransformFilter{
+		Rules: []api.TransformFilterRule{
+			{
+				Type: api.KeepEntryAllSatisfied,
+				KeepEntryAllSatisfied: []*api.KeepEntryRule{
+					{
+						Type: api.KeepEntryIfIn,
+						KeepEntry: &api.TransformFilterGenericRule{
+							Input: "Proto",
+							Value: "6",
+						},
+					},
+				},
+			},
+		},
+	}
+	_, err := NewTransformFilter(config.StageParam{Transform: &config.Transform{Filter: &newFilter}})
+	require.Error(t, err)
+}
+
+const testConfigTransformFilterKeepEntryExpression = `---
+log-level: debug
+pipeline:
+  - name: filter1
+parameters:
+  - name: filter1
+    transform:
+      type: filter
+      filter:
+        rules:
+        - type: remove_field
+          removeField:
+            input: SrcPort
+        - type: keep_entry_expression
+          keepEntryExpression:
+            or:
+            - condition:
+                type: keep_entry_if_in
+                keepEntry:
+                  input: DstPort
+                  value: [443]
+            - and:
+              - condition:
+                  type: keep_entry_if_equal
+                  keepEntry:
+                    input: DstK8S_Namespace
+                    value: prod
+              - not:
+                  condition:
+                    type: keep_entry_if_exists
+                    keepEntry:
+                      input: SrcPort
+        - type: remove_entry_if_equal
+          removeEntry:
+            input: Proto
+            value: udp
+`
+
+func Test_Transform_KeepEntryExpression(t *testing.T) {
+	tf := InitNewTransformFilter(t, testConfigTransformFilterKeepEntryExpression)
+
+	out, keep := tf.Transform(config.GenericMap{"SrcPort": 1234, "DstPort": 443, "DstK8S_Namespace": "dev", "Proto": "tcp"})
+	require.True(t, keep)
+	require.Equal(t, config.GenericMap{"DstPort": 443, "DstK8S_Namespace": "dev", "Proto": "tcp"}, out)
+
+	// rules are applied in order: SrcPort is already removed when the expression is evaluated
+	_, keep = tf.Transform(config.GenericMap{"SrcPort": 1234, "DstPort": 80, "DstK8S_Namespace": "prod", "Proto": "tcp"})
+	require.True(t, keep)
+
+	_, keep = tf.Transform(config.GenericMap{"DstPort": 80, "DstK8S_Namespace": "dev", "Proto": "tcp"})
+	require.False(t, keep)
+
+	// the rules list is still a conjunction: the last rule removes the entry
+	_, keep = tf.Transform(config.GenericMap{"DstPort": 443, "DstK8S_Namespace": "prod", "Proto": "udp"})
+	require.False(t, keep)
+}
+
+func Test_Transform_KeepEntryExpressionInvalid(t *testing.T) {
+	newFilter := api.TransformFilter{
+		Rules: []api.TransformFilterRule{
+			{
+				Type: api.KeepEntryExpression,
+				KeepEntryExpression: &api.FilterExpression{
+					Or: []*api.FilterExpression{{}},
+				},
+			},
+		},
+	}
+	_, err := NewTransformFilter(config.StageParam{Transform: &config.Transform{Filter: &newFilter}})
+	require.Error(t, err)
+}
+
+const testConfigTransformFilterCEL = `---
+log-level: debug
+pipeline:
+  - name: filter1
+parameters:
+  - name: filter1
+    transform:
+      type: filter
+      filter:
+        rules:
+        - type: cel
+          cel:
+            expression: flow.Proto == 6 && (flow.DstPort == 443 || flow.Zone == "eu")
+            fields:
+            - name: Zone
+              type: string
+`
+
+func Test_Transform_CEL(t *testing.T) {
+	tf := InitNewTransformFilter(t, testConfigTransformFilterCEL)
+
+	_, keep := tf.Transform(config.GenericMap{"Proto": 6, "DstPort": 443})
+	require.True(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"Proto": 6, "DstPort": 80, "Zone": "eu"})
+	require.True(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"Proto": 17, "DstPort": 443})
+	require.False(t, keep)
+	// Zone is missing: the entry is removed
+	_, keep = tf.Transform(config.GenericMap{"Proto": 6, "DstPort": 80})
+	require.False(t, keep)
+}
+
+func Test_Transform_CELInvalid(t *testing.T) {
+	newFilter := api.TransformFilter{
+		Rules: []api.TransformFilterRule{
+			{
+				Type: api.KeepEntryCEL,
+				CEL:  &api.TransformFilterCELRule{Expression: "flow.Unknown > 0"},
+			},
+		},
+	}
+	_, err := NewTransformFilter(config.StageParam{Transform: &config.Transform{Filter: &newFilter}})
+	require.Error(t, err)
+}
+
 func InitNewTransformFilter(t *testing.T, configFile string) Transformer {
 	v, cfg := test.InitConfig(t, configFile)
 	require.NotNil(t, v)
@@ -800,3 +988,52 @@ func Test_Transform_KeepEntrySampling(t *testing.T) {
 	assert.Greater(t, countA, 30)
 	assert.Equal(t, countB, 1000)
 }
+
+func Test_Transform_CIDR(t *testing.T) {
+	newFilter := api.TransformFilter{
+		Rules: []api.TransformFilterRule{
+			{
+				Type: api.CIDRFilter,
+				CIDR: &api.TransformFilterCIDRRule{
+					Input: "SrcAddr",
+					CIDRs: []string{"10.0.0.0/8", "fd00::/8"},
+				},
+			},
+		},
+	}
+
+	tf, err := NewTransformFilter(config.StageParam{Transform: &config.Transform{Filter: &newFilter}})
+	require.NoError(t, err)
+
+	_, keep := tf.Transform(config.GenericMap{"SrcAddr": "10.1.2.3"})
+	require.True(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"SrcAddr": "fd00::1"})
+	require.True(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"SrcAddr": "192.168.0.1"})
+	require.False(t, keep)
+	// missing or invalid IPs never match
+	_, keep = tf.Transform(config.GenericMap{"DstAddr": "10.1.2.3"})
+	require.False(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"SrcAddr": "abcd"})
+	require.False(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"SrcAddr": 42})
+	require.False(t, keep)
+
+	// blocklist mode
+	keepMatching := false
+	newFilter.Rules[0].CIDR.KeepMatching = &keepMatching
+	tf, err = NewTransformFilter(config.StageParam{Transform: &config.Transform{Filter: &newFilter}})
+	require.NoError(t, err)
+
+	_, keep = tf.Transform(config.GenericMap{"SrcAddr": "10.1.2.3"})
+	require.False(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"SrcAddr": "192.168.0.1"})
+	require.True(t, keep)
+	_, keep = tf.Transform(config.GenericMap{"DstAddr": "10.1.2.3"})
+	require.True(t, keep)
+
+	// invalid CIDR
+	newFilter.Rules[0].CIDR.CIDRs = []string{"10.0.0.0/42"}
+	_, err = NewTransformFilter(config.StageParam{Transform: &config.Transform{Filter: &newFilter}})
+	require.Error(t, err)
+}
@@ -18,16 +18,38 @@
 package transform
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Knetic/govaluate"
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
 var glog = logrus.WithField("component", "transform.Generic")
 
+const defaultSamplingRateField = "SamplingRate"
+
+var defaultSamplingFields = []string{"Bytes", "Packets"}
+
 type Generic struct {
 	policy api.TransformGenericOperationEnum
 	rules  []api.GenericTransformRule
+	// compiled regular expressions, indexed by position in rules
+	regexes map[int]*regexp.Regexp
+	// compiled math expressions, indexed by position in rules
+	expressions map[int]*govaluate.EvaluableExpression
+	// type converters, indexed by position in rules
+	converters map[int]*typeConverter
+	// JSON extractors, indexed by position in rules
+	jsonExtractors map[int]*jsonExtractor
 }
 
 // Transform transforms a flow to a new set of keys
@@ -40,8 +62,24 @@ func (g *Generic) Transform(entry config.GenericMap) (config.GenericMap, bool) {
 	} else {
 		outputEntry = config.GenericMap{}
 	}
-	for _, transformRule := range g.rules {
-		if transformRule.Multiplier != 0 {
+	for i, transformRule := range g.rules {
+		if transformRule.Regex != "" {
+			g.performRegex(entry, transformRule, g.regexes[i], outputEntry)
+		} else if transformRule.Operation == api.OperationConvert {
+			g.converters[i].convert(entry, &g.rules[i], outputEntry)
+		} else if transformRule.Operation == api.OperationSampling {
+			g.performSamplingNormalize(entry, transformRule, outputEntry)
+		} else if transformRule.Operation == api.OperationSplit {
+			g.performSplit(entry, transformRule, outputEntry)
+		} else if transformRule.Operation == api.OperationJSON {
+			g.jsonExtractors[i].extract(entry, &g.rules[i], outputEntry)
+		} else if transformRule.Operation == api.OperationTimestamp {
+			g.performNormalizeTimestamp(entry, transformRule, outputEntry)
+		} else if transformRule.Operation == api.OperationMath {
+			g.performMath(entry, transformRule, g.expressions[i], outputEntry)
+		} else if transformRule.Operation != "" {
+			g.performOperation(entry, transformRule, outputEntry)
+		} else if transformRule.Multiplier != 0 {
 			ok = g.performMultiplier(entry, transformRule, outputEntry)
 		} else {
 			outputEntry[transformRule.Output] = entry[transformRule.Input]
@@ -85,8 +123,198 @@ func (g *Generic) performMultiplier(entry config.GenericMap, transformRule api.G
 	return ok
 }
 
+// performOperation sets the output field to the result of the arithmetic operation. Missing or non-numeric
+// inputs, and divisions by zero, leave the output field unset.
+func (g *Generic) performOperation(entry config.GenericMap, transformRule api.GenericTransformRule, outputEntry config.GenericMap) {
+	input, ok := entry[transformRule.Input]
+	if !ok || input == nil {
+		return
+	}
+	val, err := utils.ConvertToFloat64(input)
+	if err != nil {
+		glog.Debugf("%s not of numerical type; cannot perform %s: %v", transformRule.Input, transformRule.Operation, err)
+		return
+	}
+	operand := transformRule.Operand
+	if transformRule.OperandField != "" {
+		fieldOperand, ok := entry[transformRule.OperandField]
+		if !ok || fieldOperand == nil {
+			return
+		}
+		operand, err = utils.ConvertToFloat64(fieldOperand)
+		if err != nil {
+			glog.Debugf("%s not of numerical type; cannot perform %s: %v", transformRule.OperandField, transformRule.Operation, err)
+			return
+		}
+	}
+	switch transformRule.Operation {
+	case api.OperationAdd:
+		outputEntry[transformRule.Output] = val + operand
+	case api.OperationSubtract:
+		outputEntry[transformRule.Output] = val - operand
+	case api.OperationMultiply:
+		outputEntry[transformRule.Output] = val * operand
+	case api.OperationDivide:
+		if operand != 0 {
+			outputEntry[transformRule.Output] = val / operand
+		}
+	}
+}
+
+// performSamplingNormalize multiplies the fields by the sampling rate, so that they represent the actual traffic
+// rather than the sampled one. Integers stay integers when the rate is integral. A missing, non-numeric or
+// unsampled (0 or 1) rate leaves the fields unchanged.
+func (g *Generic) performSamplingNormalize(entry config.GenericMap, transformRule api.GenericTransformRule, outputEntry config.GenericMap) {
+	rateField := transformRule.OperandField
+	if rateField == "" {
+		rateField = defaultSamplingRateField
+	}
+	rawRate, ok := entry[rateField]
+	if !ok || rawRate == nil {
+		return
+	}
+	if str, isString := rawRate.(string); isString {
+		// some exporters send the sampling rate as a string
+		rawRate = strings.TrimSpace(str)
+	}
+	rate, err := utils.ConvertToFloat64(rawRate)
+	if err != nil {
+		glog.Debugf("%s not of numerical type; cannot normalize sampling: %v", rateField, err)
+		return
+	}
+	if rate == 0 || rate == 1 {
+		return
+	}
+	fields := transformRule.Fields
+	if len(fields) == 0 {
+		fields = defaultSamplingFields
+	}
+	for _, field := range fields {
+		value, ok := entry[field]
+		if !ok || value == nil {
+			continue
+		}
+		scaled, err := scaleValue(value, rate)
+		if err != nil {
+			glog.Debugf("%s not of numerical type; cannot normalize sampling: %v", field, err)
+			continue
+		}
+		outputEntry[field] = scaled
+	}
+}
+
+// performSplit sets the target fields to the tokens of the input field split on the separator. An input without
+// the separator is a single token. A missing input leaves the target fields unset.
+func (g *Generic) performSplit(entry config.GenericMap, transformRule api.GenericTransformRule, outputEntry config.GenericMap) {
+	input, ok := entry[transformRule.Input]
+	if !ok || input == nil {
+		return
+	}
+	tokens := strings.SplitN(utils.ConvertToString(input), transformRule.Separator, len(transformRule.TargetFields)+1)
+	for i, field := range transformRule.TargetFields {
+		if i < len(tokens) {
+			outputEntry[field] = tokens[i]
+		} else {
+			outputEntry[field] = ""
+		}
+	}
+	if transformRule.RemoveInput && !slices.Contains(transformRule.TargetFields, transformRule.Input) {
+		delete(outputEntry, transformRule.Input)
+	}
+}
+
+// scaleValue multiplies the value by the factor: as int64 or uint64 for integers when the factor is integral,
+// and as float64 otherwise
+func scaleValue(value any, factor float64) (any, error) {
+	if factor == math.Trunc(factor) && factor > 0 {
+		switch v := normalizeValue(value).(type) {
+		case int64:
+			return v * int64(factor), nil
+		case uint64:
+			return v * uint64(factor), nil
+		}
+	}
+	val, err := utils.ConvertToFloat64(value)
+	if err != nil {
+		return nil, err
+	}
+	return val * factor, nil
+}
+
+// performMath sets the output field to the result of the expression, or to the fallback value when dividing by zero.
+// Missing or non-numeric fields leave the output field unset.
+func (g *Generic) performMath(entry config.GenericMap, transformRule api.GenericTransformRule, expr *govaluate.EvaluableExpression, outputEntry config.GenericMap) {
+	params := make(map[string]interface{}, len(expr.Vars()))
+	for _, field := range expr.Vars() {
+		value, ok := entry[field]
+		if !ok || value == nil {
+			return
+		}
+		val, err := utils.ConvertToFloat64(value)
+		if err != nil {
+			glog.Debugf("%s not of numerical type; cannot evaluate %s: %v", field, transformRule.Expression, err)
+			return
+		}
+		params[field] = val
+	}
+	result, err := expr.Evaluate(params)
+	if err != nil {
+		glog.Debugf("cannot evaluate %s: %v", transformRule.Expression, err)
+		return
+	}
+	// only numbers and arithmetic operators are allowed, so the result is a float64
+	val := result.(float64)
+	if math.IsInf(val, 0) || math.IsNaN(val) {
+		val = transformRule.Fallback
+	}
+	outputEntry[transformRule.Output] = val
+}
+
+// compileMathExpression parses an arithmetic expression, made of fields, numbers, parentheses and the + - * / operators
+func compileMathExpression(expression string) (*govaluate.EvaluableExpression, error) {
+	if expression == "" {
+		return nil, errors.New("missing expression")
+	}
+	expr, err := govaluate.NewEvaluableExpression(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, err)
+	}
+	for _, token := range expr.Tokens() {
+		switch token.Kind {
+		case govaluate.VARIABLE, govaluate.NUMERIC, govaluate.CLAUSE, govaluate.CLAUSE_CLOSE:
+			continue
+		case govaluate.MODIFIER, govaluate.PREFIX:
+			switch token.Value {
+			case "+", "-", "*", "/":
+				continue
+			}
+		}
+		return nil, fmt.Errorf("invalid expression %q: unsupported %s %v", expression, token.Kind, token.Value)
+	}
+	return expr, nil
+}
+
+// performRegex sets an output field for each named group of the regular expression that matched the input.
+// Unmatched groups and inputs leave the output fields unset.
+func (g *Generic) performRegex(entry config.GenericMap, transformRule api.GenericTransformRule, re *regexp.Regexp, outputEntry config.GenericMap) {
+	input, ok := entry[transformRule.Input]
+	if !ok || input == nil {
+		return
+	}
+	str := utils.ConvertToString(input)
+	match := re.FindStringSubmatchIndex(str)
+	if match == nil {
+		return
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" && match[2*i] >= 0 {
+			outputEntry[name] = str[match[2*i]:match[2*i+1]]
+		}
+	}
+}
+
 // NewTransformGeneric create a new transform
-func NewTransformGeneric(params config.StageParam) (Transformer, error) {
+func NewTransformGeneric(params config.StageParam, opMetrics *operational.Metrics) (Transformer, error) {
 	glog.Debugf("entering NewTransformGeneric")
 	genConfig := api.TransformGeneric{}
 	if params.Transform != nil && params.Transform.Generic != nil {
@@ -102,10 +330,70 @@ func NewTransformGeneric(params config.StageParam) (Transformer, error) {
 	default:
 		glog.Panicf("unknown policy %s for transform.generic", policy)
 	}
+	regexes := map[int]*regexp.Regexp{}
+	expressions := map[int]*govaluate.EvaluableExpression{}
+	converters := map[int]*typeConverter{}
+	jsonExtractors := map[int]*jsonExtractor{}
+	for i := range rules {
+		if rules[i].Regex != "" {
+			re, err := regexp.Compile(rules[i].Regex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex for transform.generic input %s: %w", rules[i].Input, err)
+			}
+			if !hasNamedGroup(re) {
+				return nil, fmt.Errorf("regex for transform.generic input %s must define named capture groups", rules[i].Input)
+			}
+			regexes[i] = re
+		}
+		switch rules[i].Operation {
+		case "", api.OperationAdd, api.OperationSubtract, api.OperationMultiply, api.OperationDivide, api.OperationSampling:
+		case api.OperationSplit:
+			if rules[i].Separator == "" || len(rules[i].TargetFields) == 0 {
+				return nil, fmt.Errorf("split operation for transform.generic input %s: separator and targetFields must be set", rules[i].Input)
+			}
+		case api.OperationTimestamp:
+			if err := validateTimestampRule(&rules[i]); err != nil {
+				return nil, err
+			}
+		case api.OperationMath:
+			expr, err := compileMathExpression(rules[i].Expression)
+			if err != nil {
+				return nil, fmt.Errorf("math operation for transform.generic output %s: %w", rules[i].Output, err)
+			}
+			expressions[i] = expr
+		case api.OperationConvert:
+			converter, err := newTypeConverter(&rules[i], opMetrics, params.Name)
+			if err != nil {
+				return nil, err
+			}
+			converters[i] = converter
+		case api.OperationJSON:
+			extractor, err := newJSONExtractor(&rules[i], opMetrics, params.Name)
+			if err != nil {
+				return nil, err
+			}
+			jsonExtractors[i] = extractor
+		default:
+			return nil, fmt.Errorf("unknown operation %s for transform.generic rule %s", rules[i].Operation, rules[i].Output)
+		}
+	}
 	transformGeneric := &Generic{
-		policy: policy,
-		rules:  rules,
+		policy:         policy,
+		rules:          rules,
+		regexes:        regexes,
+		expressions:    expressions,
+		converters:     converters,
+		jsonExtractors: jsonExtractors,
 	}
 	glog.Debugf("transformGeneric = %v", transformGeneric)
 	return transformGeneric, nil
 }
+
+func hasNamedGroup(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
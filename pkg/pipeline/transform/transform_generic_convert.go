@@ -0,0 +1,227 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	util "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var typeConversionErrorsDef = operational.DefineMetric(
+	"type_conversion_errors_total",
+	"Counter of field values that the convert_type rule couldn't convert, replaced by the onError value",
+	operational.TypeCounter,
+	"stage", "field", "type",
+)
+
+type typeConverter struct {
+	target  api.ConvertTypeEnum
+	onError any
+	errors  prometheus.Counter
+}
+
+func newTypeConverter(rule *api.GenericTransformRule, opMetrics *operational.Metrics, stage string) (*typeConverter, error) {
+	if rule.Input == "" {
+		return nil, fmt.Errorf("invalid config for transform.generic operation %s: missing input", api.OperationConvert)
+	}
+	switch rule.TargetType {
+	case api.ConvertInt64, api.ConvertUint64, api.ConvertFloat64, api.ConvertBool, api.ConvertString:
+	default:
+		return nil, fmt.Errorf("invalid config for transform.generic operation %s: unknown target type %q for input %s", api.OperationConvert, rule.TargetType, rule.Input)
+	}
+	var onError any
+	if rule.OnError == "" {
+		onError = zeroValue(rule.TargetType)
+	} else {
+		var err error
+		if onError, err = convertValue(rule.OnError, rule.TargetType); err != nil {
+			return nil, fmt.Errorf("invalid config for transform.generic operation %s: onError of input %s: %w", api.OperationConvert, rule.Input, err)
+		}
+	}
+	return &typeConverter{
+		target:  rule.TargetType,
+		onError: onError,
+		errors:  opMetrics.NewCounter(&typeConversionErrorsDef, stage, rule.Input, string(rule.TargetType)),
+	}, nil
+}
+
+// convert writes the converted input field to the output field, which defaults to the input field.
+// Missing inputs leave the output unset; nil inputs and failed conversions write the onError value.
+func (c *typeConverter) convert(entry config.GenericMap, transformRule *api.GenericTransformRule, outputEntry config.GenericMap) {
+	input, ok := entry[transformRule.Input]
+	if !ok {
+		return
+	}
+	output := transformRule.Output
+	if output == "" {
+		output = transformRule.Input
+	}
+	converted, err := convertValue(input, c.target)
+	if err != nil {
+		glog.Debugf("can't convert %s to %s: %v", transformRule.Input, c.target, err)
+		c.errors.Inc()
+		converted = c.onError
+	}
+	outputEntry[output] = converted
+}
+
+func zeroValue(target api.ConvertTypeEnum) any {
+	switch target {
+	case api.ConvertInt64:
+		return int64(0)
+	case api.ConvertUint64:
+		return uint64(0)
+	case api.ConvertFloat64:
+		return float64(0)
+	case api.ConvertBool:
+		return false
+	}
+	return ""
+}
+
+// convertValue converts integers, floats, booleans and strings to the target type, without losing information:
+// out of range values, fractional values converted to integers and numbers other than 0 and 1 converted to
+// booleans are errors. Booleans convert to 0 and 1.
+func convertValue(value any, target api.ConvertTypeEnum) (any, error) {
+	if value == nil {
+		return nil, fmt.Errorf("nil value")
+	}
+	if target == api.ConvertString {
+		return util.ConvertToString(value), nil
+	}
+	switch v := normalizeValue(value).(type) {
+	case int64:
+		return convertInt64(v, target)
+	case uint64:
+		return convertUint64(v, target)
+	case float64:
+		return convertFloat64(v, target)
+	case bool:
+		n := int64(0)
+		if v {
+			n = 1
+		}
+		return convertInt64(n, target)
+	case string:
+		return convertString(strings.TrimSpace(v), target)
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+// normalizeValue widens integers and floats to int64, uint64 and float64
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return uint64(v)
+	case uint8:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
+
+func convertInt64(v int64, target api.ConvertTypeEnum) (any, error) {
+	switch target {
+	case api.ConvertUint64:
+		if v < 0 {
+			return nil, fmt.Errorf("%d is negative", v)
+		}
+		return uint64(v), nil
+	case api.ConvertFloat64:
+		return float64(v), nil
+	case api.ConvertBool:
+		return intToBool(v == 0, v == 1, v)
+	}
+	return v, nil
+}
+
+func convertUint64(v uint64, target api.ConvertTypeEnum) (any, error) {
+	switch target {
+	case api.ConvertInt64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows int64", v)
+		}
+		return int64(v), nil
+	case api.ConvertFloat64:
+		return float64(v), nil
+	case api.ConvertBool:
+		return intToBool(v == 0, v == 1, v)
+	}
+	return v, nil
+}
+
+func convertFloat64(v float64, target api.ConvertTypeEnum) (any, error) {
+	switch target {
+	case api.ConvertInt64:
+		// float64(math.MaxInt64) rounds up to 2^63, which overflows
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return nil, fmt.Errorf("%v can't be converted to int64", v)
+		}
+		return int64(v), nil
+	case api.ConvertUint64:
+		if v != math.Trunc(v) || v < 0 || v >= math.MaxUint64 {
+			return nil, fmt.Errorf("%v can't be converted to uint64", v)
+		}
+		return uint64(v), nil
+	case api.ConvertBool:
+		return intToBool(v == 0, v == 1, v)
+	}
+	return v, nil
+}
+
+func convertString(v string, target api.ConvertTypeEnum) (any, error) {
+	switch target {
+	case api.ConvertInt64:
+		return strconv.ParseInt(v, 10, 64)
+	case api.ConvertUint64:
+		return strconv.ParseUint(v, 10, 64)
+	case api.ConvertFloat64:
+		return strconv.ParseFloat(v, 64)
+	case api.ConvertBool:
+		return strconv.ParseBool(v)
+	}
+	return v, nil
+}
+
+func intToBool(isZero, isOne bool, v any) (any, error) {
+	if !isZero && !isOne {
+		return nil, fmt.Errorf("%v is neither 0 nor 1", v)
+	}
+	return isOne, nil
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var jsonExtractErrorsDef = operational.DefineMetric(
+	"json_extract_errors_total",
+	"Counter of field values from which the json_extract rule couldn't extract its path, replaced by the onError value, per rule output and error (invalid_json or not_found)",
+	operational.TypeCounter,
+	"stage", "field", "output", "error",
+)
+
+var errJSONPathNotFound = errors.New("path not found")
+
+// jsonPathSegment is an object key, or an array index when key is empty
+type jsonPathSegment struct {
+	key   string
+	index int
+}
+
+type jsonExtractor struct {
+	path          []jsonPathSegment
+	invalidErrors prometheus.Counter
+	missingErrors prometheus.Counter
+}
+
+func newJSONExtractor(rule *api.GenericTransformRule, opMetrics *operational.Metrics, stage string) (*jsonExtractor, error) {
+	if rule.Input == "" || rule.Output == "" {
+		return nil, fmt.Errorf("invalid config for transform.generic operation %s: input and output must be set", api.OperationJSON)
+	}
+	path, err := parseJSONPath(rule.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config for transform.generic operation %s: input %s: %w", api.OperationJSON, rule.Input, err)
+	}
+	return &jsonExtractor{
+		path:          path,
+		invalidErrors: opMetrics.NewCounter(&jsonExtractErrorsDef, stage, rule.Input, rule.Output, "invalid_json"),
+		missingErrors: opMetrics.NewCounter(&jsonExtractErrorsDef, stage, rule.Input, rule.Output, "not_found"),
+	}, nil
+}
+
+// parseJSONPath parses a path starting with $, followed by .key, ['key'] or ["key"] object keys and [n] array indexes
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path %q must start with $", path)
+	}
+	var segments []jsonPathSegment
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("path %q has an empty key", path)
+			}
+			segments = append(segments, jsonPathSegment{key: rest[1:end]})
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, "[\""):
+			end := strings.Index(rest[2:], string(rest[1])+"]")
+			if end <= 0 {
+				return nil, fmt.Errorf("path %q has an unterminated or empty key", path)
+			}
+			segments = append(segments, jsonPathSegment{key: rest[2 : end+2]})
+			rest = rest[end+4:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unterminated index", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %q has an invalid index %q", path, rest[1:end])
+			}
+			segments = append(segments, jsonPathSegment{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %q has an unexpected %q", path, rest[0])
+		}
+	}
+	return segments, nil
+}
+
+// extract writes the value at the path of the input field to the output field. Missing inputs leave the output
+// unset; inputs that aren't JSON, or that lack the path, write the onError value.
+func (e *jsonExtractor) extract(entry config.GenericMap, transformRule *api.GenericTransformRule, outputEntry config.GenericMap) {
+	input, ok := entry[transformRule.Input]
+	if !ok {
+		return
+	}
+	var reader io.Reader
+	switch v := input.(type) {
+	case string:
+		reader = strings.NewReader(v)
+	case []byte:
+		reader = bytes.NewReader(v)
+	default:
+		glog.Debugf("can't extract %s from %s: %T isn't a JSON string", transformRule.Path, transformRule.Input, input)
+		e.invalidErrors.Inc()
+		outputEntry[transformRule.Output] = transformRule.OnError
+		return
+	}
+	value, err := extractJSONPath(json.NewDecoder(reader), e.path)
+	if err != nil {
+		glog.Debugf("can't extract %s from %s: %v", transformRule.Path, transformRule.Input, err)
+		if errors.Is(err, errJSONPathNotFound) {
+			e.missingErrors.Inc()
+		} else {
+			e.invalidErrors.Inc()
+		}
+		outputEntry[transformRule.Output] = transformRule.OnError
+		return
+	}
+	outputEntry[transformRule.Output] = value
+}
+
+// extractJSONPath reads the tokens of the document up to the path, skipping the other values rather than decoding
+// them. The value at the path is decoded; objects and arrays are returned as their JSON string.
+func extractJSONPath(dec *json.Decoder, path []jsonPathSegment) (any, error) {
+	for _, segment := range path {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if segment.key != "" {
+			if token != json.Delim('{') {
+				return nil, errJSONPathNotFound
+			}
+			if err := seekKey(dec, segment.key); err != nil {
+				return nil, err
+			}
+		} else {
+			if token != json.Delim('[') {
+				return nil, errJSONPathNotFound
+			}
+			if err := seekIndex(dec, segment.index); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	if len(raw) > 0 && (raw[0] == '{' || raw[0] == '[') {
+		return string(raw), nil
+	}
+	var value any
+	scalar := json.NewDecoder(bytes.NewReader(raw))
+	scalar.UseNumber()
+	if err := scalar.Decode(&value); err != nil {
+		return nil, err
+	}
+	if number, ok := value.(json.Number); ok {
+		if i, err := number.Int64(); err == nil {
+			return i, nil
+		}
+		return number.Float64()
+	}
+	return value, nil
+}
+
+// seekKey moves the decoder, positioned in an object, to the value of the key
+func seekKey(dec *json.Decoder, key string) error {
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if token == key {
+			return nil
+		}
+		if err := skipJSONValue(dec); err != nil {
+			return err
+		}
+	}
+	return errJSONPathNotFound
+}
+
+// seekIndex moves the decoder, positioned in an array, to the value at the index
+func seekIndex(dec *json.Decoder, index int) error {
+	for i := 0; dec.More(); i++ {
+		if i == index {
+			return nil
+		}
+		if err := skipJSONValue(dec); err != nil {
+			return err
+		}
+	}
+	return errJSONPathNotFound
+}
+
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
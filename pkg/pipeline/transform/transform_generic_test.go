@@ -18,14 +18,21 @@
 package transform
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 )
 
+var opMetrics = operational.NewMetrics(&config.MetricsSettings{})
+
 const testConfigTransformGenericMaintainFalse = `---
 log-level: debug
 pipeline:
@@ -137,7 +144,7 @@ func InitNewTransformGeneric(t *testing.T, configFile string) Transformer {
 	require.NotNil(t, v)
 
 	configParams := cfg.Parameters[0]
-	newTransform, err := NewTransformGeneric(configParams)
+	newTransform, err := NewTransformGeneric(configParams, opMetrics)
 	require.NoError(t, err)
 	return newTransform
 }
@@ -213,7 +220,7 @@ parameters:
 	require.NotNil(t, v)
 
 	configParams := cfg.Parameters[0]
-	_, err := NewTransformGeneric(configParams)
+	_, err := NewTransformGeneric(configParams, opMetrics)
 	require.NoError(t, err)
 
 	var badConfig = []byte(`
@@ -232,3 +239,463 @@ parameters:
 	require.Nil(t, v)
 	require.Nil(t, cfg)
 }
+
+func Test_Transform_Operation(t *testing.T) {
+	newTransform, err := NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "preserve_original_keys",
+		Rules: []api.GenericTransformRule{
+			{Input: "Bytes", Output: "Bits", Operation: api.OperationMultiply, Operand: 8},
+			{Input: "Bytes", Output: "Throughput", Operation: api.OperationDivide, OperandField: "Duration"},
+			{Input: "Bytes", Output: "BytesWithHeaders", Operation: api.OperationAdd, OperandField: "Headers"},
+			{Input: "Bytes", Output: "Remaining", Operation: api.OperationSubtract, Operand: 100},
+		},
+	}}}, opMetrics)
+	require.NoError(t, err)
+
+	output, ok := newTransform.Transform(config.GenericMap{"Bytes": 1000, "Duration": uint32(4), "Headers": "40"})
+	require.True(t, ok)
+	require.Equal(t, 8000.0, output["Bits"])
+	require.Equal(t, 250.0, output["Throughput"])
+	require.Equal(t, 1040.0, output["BytesWithHeaders"])
+	require.Equal(t, 900.0, output["Remaining"])
+
+	// missing, nil or non-numeric inputs and division by zero leave the outputs unset, without dropping the entry
+	for _, entry := range []config.GenericMap{
+		{"Duration": 0, "Headers": true},
+		{"Bytes": nil, "Duration": nil, "Headers": nil},
+		{"Bytes": "not_a_number", "Duration": 4},
+		{"Bytes": true, "Duration": 4},
+	} {
+		output, ok = newTransform.Transform(entry)
+		require.True(t, ok)
+		require.NotContains(t, output, "Bits")
+		require.NotContains(t, output, "Throughput")
+		require.NotContains(t, output, "BytesWithHeaders")
+		require.NotContains(t, output, "Remaining")
+	}
+	output, ok = newTransform.Transform(config.GenericMap{"Bytes": 1000, "Duration": 0})
+	require.True(t, ok)
+	require.Equal(t, 8000.0, output["Bits"])
+	require.NotContains(t, output, "Throughput")
+	require.NotContains(t, output, "BytesWithHeaders")
+
+	_, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Rules: []api.GenericTransformRule{{Input: "Bytes", Output: "Bits", Operation: "modulo", Operand: 8}},
+	}}}, opMetrics)
+	require.Error(t, err)
+}
+
+func Test_Transform_Math(t *testing.T) {
+	newTransform, err := NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "replace_keys",
+		Rules: []api.GenericTransformRule{
+			{Output: "BytesPerPacket", Operation: api.OperationMath, Expression: "Bytes / Packets"},
+			{Output: "DurationMs", Operation: api.OperationMath, Expression: "(TimeFlowEnd - TimeFlowStart) * 1000"},
+			{Output: "Ratio", Operation: api.OperationMath, Expression: "-Bytes / (Packets - 4) + 0.5", Fallback: -1},
+		},
+	}}}, opMetrics)
+	require.NoError(t, err)
+
+	output, ok := newTransform.Transform(config.GenericMap{"Bytes": uint64(1000), "Packets": "4", "TimeFlowStart": 10, "TimeFlowEnd": 12.5})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"BytesPerPacket": 250.0, "DurationMs": 2500.0, "Ratio": -1.0}, output)
+
+	output, ok = newTransform.Transform(config.GenericMap{"Bytes": 1000, "Packets": 0})
+	require.True(t, ok)
+	// division by zero: the default fallback is 0
+	require.Equal(t, config.GenericMap{"BytesPerPacket": 0.0, "Ratio": 250.5}, output)
+
+	// missing, nil or non-numeric fields leave the output unset
+	output, ok = newTransform.Transform(config.GenericMap{"Bytes": "abc", "Packets": nil, "TimeFlowStart": 10})
+	require.True(t, ok)
+	require.Empty(t, output)
+
+	for _, expr := range []string{"", "Bytes /", "(Bytes + 1", "Bytes % 2", "Bytes > 2", "'abc' + Bytes", "max(Bytes, 1)", "Bytes ** 2"} {
+		_, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+			Rules: []api.GenericTransformRule{{Output: "Out", Operation: api.OperationMath, Expression: expr}},
+		}}}, opMetrics)
+		require.Error(t, err, "expression %q", expr)
+	}
+}
+
+func Test_Transform_Regex(t *testing.T) {
+	newTransform, err := NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "replace_keys",
+		Rules: []api.GenericTransformRule{
+			{Input: "Interface", Regex: `^(?P<Iface>[^.]+)(\.(?P<VLAN>\d+))?$`},
+			// substring
+			{Input: "Namespace", Regex: `^(?P<Team>.{3})`},
+		},
+	}}}, opMetrics)
+	require.NoError(t, err)
+
+	output, ok := newTransform.Transform(config.GenericMap{"Interface": "eth0.100", "Namespace": "abcdef"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Iface": "eth0", "VLAN": "100", "Team": "abc"}, output)
+
+	// optional group not matched
+	output, ok = newTransform.Transform(config.GenericMap{"Interface": "eth0"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Iface": "eth0"}, output)
+
+	// unmatched, nil or missing inputs leave outputs absent
+	output, ok = newTransform.Transform(config.GenericMap{"Interface": "", "Namespace": nil})
+	require.True(t, ok)
+	require.Empty(t, output)
+
+	_, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Rules: []api.GenericTransformRule{{Input: "Interface", Regex: `^([^.]+)`}},
+	}}}, opMetrics)
+	require.Error(t, err)
+	_, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Rules: []api.GenericTransformRule{{Input: "Interface", Regex: `^(?P<Iface>[^.]+`}},
+	}}}, opMetrics)
+	require.Error(t, err)
+}
+
+func Test_Transform_ConvertType(t *testing.T) {
+	type conversion struct {
+		input    any
+		expected any
+	}
+	for target, conversions := range map[api.ConvertTypeEnum][]conversion{
+		api.ConvertInt64: {
+			{"12345", int64(12345)}, {" -12 ", int64(-12)}, {int32(-7), int64(-7)}, {uint64(42), int64(42)},
+			{42.0, int64(42)}, {float32(3), int64(3)}, {true, int64(1)}, {false, int64(0)},
+		},
+		api.ConvertUint64: {
+			{"12345", uint64(12345)}, {uint8(7), uint64(7)}, {int64(42), uint64(42)}, {42.0, uint64(42)}, {true, uint64(1)},
+		},
+		api.ConvertFloat64: {
+			{"1.5", 1.5}, {"12", 12.0}, {-3, -3.0}, {uint32(3), 3.0}, {float32(0.5), 0.5}, {true, 1.0},
+		},
+		api.ConvertBool: {
+			{"true", true}, {"0", false}, {"T", true}, {1, true}, {uint64(0), false}, {1.0, true}, {false, false},
+		},
+		api.ConvertString: {
+			{"abc", "abc"}, {12345, "12345"}, {int64(-1), "-1"}, {uint64(7), "7"}, {1.5, "1.5"}, {true, "true"},
+		},
+	} {
+		newTransform, err := NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+			Rules: []api.GenericTransformRule{{Input: "Field", Operation: api.OperationConvert, TargetType: target}},
+		}}}, opMetrics)
+		require.NoError(t, err)
+		for _, c := range conversions {
+			output, ok := newTransform.Transform(config.GenericMap{"Field": c.input})
+			require.True(t, ok)
+			require.Equal(t, c.expected, output["Field"], "converting %v (%T) to %s", c.input, c.input, target)
+		}
+	}
+}
+
+func Test_Transform_ConvertTypeErrors(t *testing.T) {
+	newTransform, err := NewTransformGeneric(config.StageParam{Name: "convert", Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "replace_keys",
+		Rules: []api.GenericTransformRule{
+			{Input: "Bytes", Operation: api.OperationConvert, TargetType: api.ConvertInt64},
+			{Input: "Packets", Operation: api.OperationConvert, TargetType: api.ConvertUint64, OnError: "1"},
+			{Input: "Rtt", Output: "RttMs", Operation: api.OperationConvert, TargetType: api.ConvertFloat64, OnError: "-1"},
+			{Input: "Sampled", Operation: api.OperationConvert, TargetType: api.ConvertBool},
+		},
+	}}}, opMetrics)
+	require.NoError(t, err)
+
+	// conversions are composable with the other rules, and can write to another field
+	output, ok := newTransform.Transform(config.GenericMap{"Bytes": "100", "Packets": "2", "Rtt": "0.5", "Sampled": 1})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Bytes": int64(100), "Packets": uint64(2), "RttMs": 0.5, "Sampled": true}, output)
+
+	for _, entry := range []config.GenericMap{
+		{"Bytes": "12.5", "Packets": "-2", "Rtt": "fast", "Sampled": 2},
+		{"Bytes": 1.5, "Packets": -2, "Rtt": nil, "Sampled": "yes"},
+		{"Bytes": uint64(1) << 63, "Packets": 1e30, "Rtt": []string{"1"}, "Sampled": 0.5},
+	} {
+		output, ok = newTransform.Transform(entry)
+		require.True(t, ok)
+		require.Equal(t, config.GenericMap{"Bytes": int64(0), "Packets": uint64(1), "RttMs": -1.0, "Sampled": false}, output, "entry %v", entry)
+	}
+	m := dto.Metric{}
+	require.NoError(t, newTransform.(*Generic).converters[1].errors.Write(&m))
+	require.Equal(t, 3.0, m.Counter.GetValue())
+
+	// missing fields are left unset
+	output, ok = newTransform.Transform(config.GenericMap{})
+	require.True(t, ok)
+	require.Empty(t, output)
+
+	for _, rule := range []api.GenericTransformRule{
+		{Operation: api.OperationConvert, TargetType: api.ConvertInt64},
+		{Input: "Bytes", Operation: api.OperationConvert},
+		{Input: "Bytes", Operation: api.OperationConvert, TargetType: "int32"},
+		{Input: "Bytes", Operation: api.OperationConvert, TargetType: api.ConvertInt64, OnError: "none"},
+	} {
+		_, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+			Rules: []api.GenericTransformRule{rule},
+		}}}, opMetrics)
+		require.Error(t, err, "rule %v", rule)
+	}
+}
+
+func Test_Transform_SamplingNormalize(t *testing.T) {
+	newTransform, err := NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "preserve_original_keys",
+		Rules:  []api.GenericTransformRule{{Operation: api.OperationSampling}},
+	}}}, opMetrics)
+	require.NoError(t, err)
+
+	output, ok := newTransform.Transform(config.GenericMap{"SamplingRate": 1000, "Bytes": 500, "Packets": uint32(2)})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"SamplingRate": 1000, "Bytes": int64(500000), "Packets": uint64(2000)}, output)
+
+	// the sampling rate is coerced from strings, and fractional rates give floats
+	output, ok = newTransform.Transform(config.GenericMap{"SamplingRate": " 50 ", "Bytes": 500.5, "Packets": "3"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"SamplingRate": " 50 ", "Bytes": 25025.0, "Packets": 150.0}, output)
+	output, ok = newTransform.Transform(config.GenericMap{"SamplingRate": 2.5, "Bytes": 10})
+	require.True(t, ok)
+	require.Equal(t, 25.0, output["Bytes"])
+
+	// unsampled, missing or non-numeric rates, and non-numeric fields, are left unchanged
+	for _, entry := range []config.GenericMap{
+		{"SamplingRate": 0, "Bytes": 500, "Packets": 2},
+		{"SamplingRate": "1", "Bytes": 500, "Packets": 2},
+		{"Bytes": 500, "Packets": 2},
+		{"SamplingRate": "fast", "Bytes": 500, "Packets": 2},
+		{"SamplingRate": nil, "Bytes": 500, "Packets": 2},
+	} {
+		output, ok = newTransform.Transform(entry)
+		require.True(t, ok)
+		require.Equal(t, entry, output)
+	}
+	output, ok = newTransform.Transform(config.GenericMap{"SamplingRate": 10, "Bytes": "n/a", "Packets": 2})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"SamplingRate": 10, "Bytes": "n/a", "Packets": int64(20)}, output)
+
+	// custom rate field and fields
+	newTransform, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "preserve_original_keys",
+		Rules:  []api.GenericTransformRule{{Operation: api.OperationSampling, OperandField: "Sampling", Fields: []string{"Bytes"}}},
+	}}}, opMetrics)
+	require.NoError(t, err)
+	output, ok = newTransform.Transform(config.GenericMap{"Sampling": uint64(10), "SamplingRate": 1000, "Bytes": uint64(5), "Packets": 1})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Sampling": uint64(10), "SamplingRate": 1000, "Bytes": uint64(50), "Packets": 1}, output)
+}
+
+func Test_Transform_Split(t *testing.T) {
+	newTransform, err := NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "preserve_original_keys",
+		Rules: []api.GenericTransformRule{{
+			Operation:    api.OperationSplit,
+			Input:        "Workload",
+			Separator:    ":",
+			TargetFields: []string{"Namespace", "Owner", "Pod"},
+		}},
+	}}}, opMetrics)
+	require.NoError(t, err)
+
+	output, ok := newTransform.Transform(config.GenericMap{"Workload": "netobserv:flowlogs-pipeline:flp-x7k2"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Workload": "netobserv:flowlogs-pipeline:flp-x7k2", "Namespace": "netobserv", "Owner": "flowlogs-pipeline", "Pod": "flp-x7k2"}, output)
+
+	// fewer tokens than target fields
+	output, ok = newTransform.Transform(config.GenericMap{"Workload": "netobserv:flowlogs-pipeline"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Workload": "netobserv:flowlogs-pipeline", "Namespace": "netobserv", "Owner": "flowlogs-pipeline", "Pod": ""}, output)
+
+	// more tokens than target fields: the remainder is discarded
+	output, ok = newTransform.Transform(config.GenericMap{"Workload": "a:b:c:d:e"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Workload": "a:b:c:d:e", "Namespace": "a", "Owner": "b", "Pod": "c"}, output)
+
+	// no separator: a single token
+	output, ok = newTransform.Transform(config.GenericMap{"Workload": "netobserv"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Workload": "netobserv", "Namespace": "netobserv", "Owner": "", "Pod": ""}, output)
+
+	// missing input
+	output, ok = newTransform.Transform(config.GenericMap{"Bytes": 10})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"Bytes": 10}, output)
+
+	// the input field is removed, and multi-character separators are supported
+	newTransform, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "preserve_original_keys",
+		Rules: []api.GenericTransformRule{{
+			Operation:    api.OperationSplit,
+			Input:        "App",
+			Separator:    " / ",
+			TargetFields: []string{"AppName", "AppVersion"},
+			RemoveInput:  true,
+		}},
+	}}}, opMetrics)
+	require.NoError(t, err)
+	output, ok = newTransform.Transform(config.GenericMap{"App": "frontend / v1.2", "Bytes": 10})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"AppName": "frontend", "AppVersion": "v1.2", "Bytes": 10}, output)
+
+	_, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Rules: []api.GenericTransformRule{{Operation: api.OperationSplit, Input: "App", TargetFields: []string{"AppName"}}},
+	}}}, opMetrics)
+	require.Error(t, err, "the separator is required")
+}
+
+func Test_Transform_NormalizeTimestamp(t *testing.T) {
+	newTransform, err := NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "preserve_original_keys",
+		Rules: []api.GenericTransformRule{{
+			Operation: api.OperationTimestamp,
+			Fields:    []string{"TimeFlowStart", "TimeFlowEnd"},
+		}},
+	}}}, opMetrics)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		input    any
+		expected int64
+	}{
+		{name: "seconds", input: 1716284172, expected: 1716284172000},
+		{name: "fractional seconds", input: 1716284172.5, expected: 1716284172500},
+		{name: "milliseconds", input: int64(1716284172123), expected: 1716284172123},
+		{name: "microseconds", input: uint64(1716284172123456), expected: 1716284172123},
+		{name: "nanoseconds", input: int64(1716284172123456789), expected: 1716284172123},
+		{name: "numeric string", input: "1716284172123", expected: 1716284172123},
+		{name: "RFC3339", input: "2024-05-21T09:36:12.123Z", expected: 1716284172123},
+		{name: "RFC3339 with offset", input: "2024-05-21T11:36:12.123+02:00", expected: 1716284172123},
+		{name: "leap second", input: "2016-12-31T23:59:60Z", expected: 1483228800000},
+		{name: "leap second with fraction", input: "2016-12-31T23:59:60.5Z", expected: 1483228800500},
+		{name: "leap second with offset", input: "2017-01-01T05:29:60+05:30", expected: 1483228800000},
+		{name: "epoch", input: 0, expected: 0},
+		{name: "pre-epoch seconds", input: -86400, expected: -86400000},
+		{name: "pre-epoch RFC3339", input: "1969-12-31T23:59:59.5Z", expected: -500},
+		{name: "pre-epoch milliseconds", input: int64(-31536000000000), expected: -31536000000000},
+	} {
+		output, ok := newTransform.Transform(config.GenericMap{"TimeFlowStart": tc.input, "Bytes": 10})
+		require.True(t, ok)
+		require.Equal(t, config.GenericMap{"TimeFlowStart": tc.expected, "Bytes": 10}, output, tc.name)
+	}
+
+	// invalid timestamps are flagged and left unchanged
+	for _, input := range []any{"yesterday", "2016-12-31T23:59:61Z", "2016-12-31T23:58:60Z", true} {
+		output, ok := newTransform.Transform(config.GenericMap{"TimeFlowStart": input, "TimeFlowEnd": 1716284172})
+		require.True(t, ok)
+		require.Equal(t, config.GenericMap{"TimeFlowStart": input, "TimeFlowEnd": int64(1716284172000), "InvalidTimestamp": true}, output, input)
+	}
+
+	// explicit format, in which pre-epoch values can't be mistaken for another unit
+	newTransform, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "preserve_original_keys",
+		Rules: []api.GenericTransformRule{{
+			Operation:    api.OperationTimestamp,
+			Fields:       []string{"TimeFlowStart"},
+			InputFormat:  api.TimestampMicros,
+			InvalidField: "BadTime",
+		}},
+	}}}, opMetrics)
+	require.NoError(t, err)
+	output, ok := newTransform.Transform(config.GenericMap{"TimeFlowStart": -1500})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"TimeFlowStart": int64(-2)}, output)
+	output, ok = newTransform.Transform(config.GenericMap{"TimeFlowStart": "2024-05-21T09:36:12Z"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"TimeFlowStart": "2024-05-21T09:36:12Z", "BadTime": true}, output)
+
+	_, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Rules: []api.GenericTransformRule{{Operation: api.OperationTimestamp, Fields: []string{"TimeFlowStart"}, InputFormat: "hours"}},
+	}}}, opMetrics)
+	require.Error(t, err)
+	_, err = NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Rules: []api.GenericTransformRule{{Operation: api.OperationTimestamp}},
+	}}}, opMetrics)
+	require.Error(t, err, "the fields are required")
+}
+
+func Test_Transform_JSONExtract(t *testing.T) {
+	newTransform, err := NewTransformGeneric(config.StageParam{Name: "json", Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Policy: "replace_keys",
+		Rules: []api.GenericTransformRule{
+			{Input: "metadata", Output: "App", Operation: api.OperationJSON, Path: "$.app", OnError: "unknown"},
+			{Input: "metadata", Output: "Team", Operation: api.OperationJSON, Path: "$.owner.team"},
+			{Input: "metadata", Output: "SecondPort", Operation: api.OperationJSON, Path: "$.ports[1].number"},
+			{Input: "metadata", Output: "Name", Operation: api.OperationJSON, Path: "$.labels['app.kubernetes.io/name']"},
+		},
+	}}}, opMetrics)
+	require.NoError(t, err)
+
+	metadata := `{"env":"prod","owner":{"team":"netobserv","members":["a","b"]},"ports":[{"number":80},{"number":8080,"name":"http-alt"}],` +
+		`"labels":{"app.kubernetes.io/name":"flp"},"app":"foo"}`
+	output, ok := newTransform.Transform(config.GenericMap{"metadata": metadata})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"App": "foo", "Team": "netobserv", "SecondPort": int64(8080), "Name": "flp"}, output)
+
+	// missing paths
+	output, ok = newTransform.Transform(config.GenericMap{"metadata": `{"app":"foo","owner":"netobserv","ports":[{"number":80}]}`})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"App": "foo", "Team": "", "SecondPort": "", "Name": ""}, output)
+	m := dto.Metric{}
+	require.NoError(t, newTransform.(*Generic).jsonExtractors[2].missingErrors.Write(&m))
+	require.Equal(t, 1.0, m.Counter.GetValue())
+
+	// inputs that aren't JSON
+	for _, input := range []any{"app=foo", `{"app":`, 42, map[string]any{"app": "foo"}} {
+		output, ok = newTransform.Transform(config.GenericMap{"metadata": input})
+		require.True(t, ok)
+		require.Equal(t, config.GenericMap{"App": "unknown", "Team": "", "SecondPort": "", "Name": ""}, output, "input %v", input)
+	}
+	require.NoError(t, newTransform.(*Generic).jsonExtractors[0].invalidErrors.Write(&m))
+	require.Equal(t, 4.0, m.Counter.GetValue())
+	// each rule exports its own errors
+	exposed := test.ReadExposedMetrics(t, prometheus.DefaultGatherer)
+	require.Contains(t, exposed, `json_extract_errors_total{error="invalid_json",field="metadata",output="App",stage="json"} 4`)
+	require.Contains(t, exposed, `json_extract_errors_total{error="invalid_json",field="metadata",output="Name",stage="json"} 4`)
+	require.Contains(t, exposed, `json_extract_errors_total{error="not_found",field="metadata",output="SecondPort",stage="json"} 1`)
+	require.Contains(t, exposed, `json_extract_errors_total{error="not_found",field="metadata",output="App",stage="json"} 0`)
+
+	// missing inputs leave the outputs unset
+	output, ok = newTransform.Transform(config.GenericMap{"Bytes": 10})
+	require.True(t, ok)
+	require.Empty(t, output)
+}
+
+func Test_Transform_JSONExtractValues(t *testing.T) {
+	document := `{"a":{"b":[1,{"c":[true,null,"x"]}],"f":1.5,"big":12345678901234567890},"arr":[[1,2],[3,4]]}`
+	for _, tc := range []struct {
+		path     string
+		expected any
+	}{
+		{path: "$.a.b[0]", expected: int64(1)},
+		{path: "$.a.b[1].c[0]", expected: true},
+		{path: "$.a.b[1].c[1]", expected: nil},
+		{path: "$.a.b[1].c[2]", expected: "x"},
+		{path: "$.a.f", expected: 1.5},
+		{path: "$.a.big", expected: 12345678901234567890.0},
+		{path: "$.arr[1][0]", expected: int64(3)},
+		{path: `$["a"].f`, expected: 1.5},
+		// objects and arrays are kept as JSON
+		{path: "$.a.b[1]", expected: `{"c":[true,null,"x"]}`},
+		{path: "$.arr[0]", expected: "[1,2]"},
+	} {
+		path, err := parseJSONPath(tc.path)
+		require.NoError(t, err, tc.path)
+		value, err := extractJSONPath(json.NewDecoder(strings.NewReader(document)), path)
+		require.NoError(t, err, tc.path)
+		require.Equal(t, tc.expected, value, tc.path)
+	}
+
+	for _, path := range []string{"$.a.c", "$.a.b[2]", "$.a.f.g", "$.arr.a", "$.a[0]"} {
+		segments, err := parseJSONPath(path)
+		require.NoError(t, err, path)
+		_, err = extractJSONPath(json.NewDecoder(strings.NewReader(document)), segments)
+		require.ErrorIs(t, err, errJSONPathNotFound, path)
+	}
+
+	for _, path := range []string{"", "a.b", "$.", "$..a", "$.a[", "$.a[-1]", "$.a[x]", "$['a", "$['']", "$a"} {
+		_, err := parseJSONPath(path)
+		require.Error(t, err, path)
+	}
+	_, err := NewTransformGeneric(config.StageParam{Transform: &config.Transform{Generic: &api.TransformGeneric{
+		Rules: []api.GenericTransformRule{{Input: "metadata", Operation: api.OperationJSON, Path: "$.app"}},
+	}}}, opMetrics)
+	require.Error(t, err, "the output is required")
+}
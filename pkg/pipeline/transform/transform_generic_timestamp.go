@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+)
+
+const defaultInvalidTimestampField = "InvalidTimestamp"
+
+// auto-detection bounds of the numeric timestamps: 1e11 seconds and 1e14 milliseconds are both in year 5138,
+// while 1e11 milliseconds is in 1973
+const (
+	maxAutoSeconds = 1e11
+	maxAutoMillis  = 1e14
+	maxAutoMicros  = 1e17
+)
+
+func validateTimestampRule(rule *api.GenericTransformRule) error {
+	if len(rule.Fields) == 0 {
+		return fmt.Errorf("invalid config for transform.generic operation %s: missing fields", api.OperationTimestamp)
+	}
+	switch rule.InputFormat {
+	case "", api.TimestampAuto, api.TimestampSeconds, api.TimestampMillis, api.TimestampMicros, api.TimestampNanos, api.TimestampRFC3339:
+		return nil
+	}
+	return fmt.Errorf("invalid config for transform.generic operation %s: unknown input format %q", api.OperationTimestamp, rule.InputFormat)
+}
+
+// performNormalizeTimestamp converts the fields in place to milliseconds since the epoch. Missing fields are left
+// unset; invalid ones are left unchanged, and flagged by setting the invalid field to true.
+func (g *Generic) performNormalizeTimestamp(entry config.GenericMap, transformRule api.GenericTransformRule, outputEntry config.GenericMap) {
+	for _, field := range transformRule.Fields {
+		value, ok := entry[field]
+		if !ok || value == nil {
+			continue
+		}
+		millis, err := toEpochMillis(value, transformRule.InputFormat)
+		if err != nil {
+			glog.Debugf("invalid timestamp %s: %v", field, err)
+			invalidField := transformRule.InvalidField
+			if invalidField == "" {
+				invalidField = defaultInvalidTimestampField
+			}
+			outputEntry[field] = value
+			outputEntry[invalidField] = true
+			continue
+		}
+		outputEntry[field] = millis
+	}
+}
+
+func toEpochMillis(value any, format api.TimestampFormatEnum) (int64, error) {
+	if str, ok := value.(string); ok {
+		str = strings.TrimSpace(str)
+		if format == api.TimestampRFC3339 {
+			return parseRFC3339Millis(str)
+		}
+		if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+			value = i
+		} else if f, err := strconv.ParseFloat(str, 64); err == nil {
+			value = f
+		} else if format == "" || format == api.TimestampAuto {
+			return parseRFC3339Millis(str)
+		} else {
+			return 0, fmt.Errorf("%q is not a number of %s", str, format)
+		}
+	} else if format == api.TimestampRFC3339 {
+		return 0, fmt.Errorf("%v is not an RFC3339 string", value)
+	}
+	switch v := normalizeValue(value).(type) {
+	case int64:
+		return intToEpochMillis(v, numericFormat(float64(v), format))
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("%d is out of range", v)
+		}
+		return intToEpochMillis(int64(v), numericFormat(float64(v), format))
+	case float64:
+		return floatToEpochMillis(v, numericFormat(v, format))
+	}
+	return 0, fmt.Errorf("%v is of unsupported type %T", value, value)
+}
+
+// numericFormat returns the unit of a number, detected from its magnitude in auto format
+func numericFormat(v float64, format api.TimestampFormatEnum) api.TimestampFormatEnum {
+	if format != "" && format != api.TimestampAuto {
+		return format
+	}
+	switch abs := math.Abs(v); {
+	case abs < maxAutoSeconds:
+		return api.TimestampSeconds
+	case abs < maxAutoMillis:
+		return api.TimestampMillis
+	case abs < maxAutoMicros:
+		return api.TimestampMicros
+	}
+	return api.TimestampNanos
+}
+
+// intToEpochMillis converts an integer timestamp, rounding the sub-millisecond ones down, including before the epoch
+func intToEpochMillis(v int64, format api.TimestampFormatEnum) (int64, error) {
+	switch format {
+	case api.TimestampSeconds:
+		if v > math.MaxInt64/1000 || v < math.MinInt64/1000 {
+			return 0, fmt.Errorf("%d seconds is out of range", v)
+		}
+		return v * 1000, nil
+	case api.TimestampMicros:
+		return time.UnixMicro(v).UnixMilli(), nil
+	case api.TimestampNanos:
+		return time.Unix(0, v).UnixMilli(), nil
+	}
+	return v, nil
+}
+
+func floatToEpochMillis(v float64, format api.TimestampFormatEnum) (int64, error) {
+	var millis float64
+	switch format {
+	case api.TimestampSeconds:
+		millis = v * 1e3
+	case api.TimestampMicros:
+		millis = v / 1e3
+	case api.TimestampNanos:
+		millis = v / 1e6
+	default:
+		millis = v
+	}
+	// rounding rather than flooring avoids off-by-one results, as 1.001 seconds is 1000.9999999999999 milliseconds
+	millis = math.Round(millis)
+	if math.IsNaN(millis) || millis >= math.MaxInt64 || millis < math.MinInt64 {
+		return 0, fmt.Errorf("%v %s is out of range", v, format)
+	}
+	return int64(millis), nil
+}
+
+// parseRFC3339Millis parses an RFC3339 timestamp, such as 2024-05-21T09:36:12.5+02:00. As for Unix time, a leap
+// second (23:59:60) is the same as the first second of the next day.
+func parseRFC3339Millis(str string) (int64, error) {
+	t, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		if len(str) < 19 || str[17:19] != "60" {
+			return 0, err
+		}
+		leap, leapErr := time.Parse(time.RFC3339Nano, str[:17]+"59"+str[19:])
+		// leap seconds are only inserted at the end of a UTC day
+		if leapErr != nil || leap.UTC().Hour() != 23 || leap.UTC().Minute() != 59 {
+			return 0, err
+		}
+		t = leap.Add(time.Second)
+	}
+	return t.UnixMilli(), nil
+}
@@ -18,6 +18,7 @@
 package transform
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -27,11 +28,13 @@ import (
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/geoip"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/kubernetes"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/location"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/netdb"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	util "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
@@ -42,6 +45,11 @@ type Network struct {
 	svcNames     *netdb.ServiceNames
 	snLabels     []subnetLabel
 	ipLabelCache *utils.TimedCache
+	geoIPDBs     map[string]*geoip.DB
+	hashers      map[*api.NetworkHashRule]*fieldHasher
+	durations    map[*api.NetworkDurationRule]*durationComputer
+	dnsReversers map[*api.NetworkDNSReverseRule]*dnsReverser
+	portServices map[*api.NetworkPortToServiceRule]*netdb.PortServices
 }
 
 type subnetLabel struct {
@@ -136,6 +144,9 @@ func (n *Network) Transform(inputEntry config.GenericMap) (config.GenericMap, bo
 						lbl = n.applySubnetLabel(strIP)
 						n.ipLabelCache.UpdateCacheEntry(strIP, lbl)
 					}
+					if lbl == "" {
+						lbl = rule.AddSubnetLabel.Default
+					}
 					if lbl != "" {
 						outputEntry[rule.AddSubnetLabel.Output] = lbl
 					}
@@ -148,6 +159,24 @@ func (n *Network) Transform(inputEntry config.GenericMap) (config.GenericMap, bo
 					outputEntry[rule.DecodeTCPFlags.Output] = flags
 				}
 			}
+		case api.NetworkAddGeoIP:
+			if rule.AddGeoIP == nil {
+				log.Errorf("Missing add geoip configuration")
+				continue
+			}
+			n.addGeoIP(outputEntry, rule.AddGeoIP)
+		case api.NetworkHash:
+			n.hashers[rule.Hash].hash(outputEntry, rule.Hash.Input)
+		case api.NetworkDuration:
+			n.durations[rule.Duration].compute(outputEntry, rule.Duration)
+		case api.NetworkPrefix:
+			networkPrefix(outputEntry, rule.NetworkPrefix)
+		case api.NetworkDNSReverse:
+			n.dnsReversers[rule.DNSReverse].annotate(outputEntry)
+		case api.NetworkPortToService:
+			portToService(outputEntry, rule.PortToService, n.portServices[rule.PortToService])
+		case api.NetworkPolicyCheck:
+			kubernetes.CheckNetworkPolicy(outputEntry, rule.NetpolCheck)
 
 		default:
 			log.Panicf("unknown type %s for transform.Network rule: %v", rule.Type, rule)
@@ -157,38 +186,121 @@ func (n *Network) Transform(inputEntry config.GenericMap) (config.GenericMap, bo
 	return outputEntry, true
 }
 
+// Reload reloads the GeoIP databases files
+func (n *Network) Reload() error {
+	var errs []error
+	for _, db := range n.geoIPDBs {
+		errs = append(errs, db.Reload())
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases the GeoIP databases and stops the DNS lookups, once a configuration reload replaced the transformer
+func (n *Network) Close() error {
+	for _, db := range n.geoIPDBs {
+		db.Close()
+	}
+	for _, r := range n.dnsReversers {
+		r.stop()
+	}
+	return nil
+}
+
+func (n *Network) addGeoIP(outputEntry config.GenericMap, rule *api.NetworkAddGeoIPRule) {
+	strIP, ok := outputEntry.LookupString(rule.Input)
+	if !ok {
+		return
+	}
+	info, err := n.geoIPDBs[geoIPKey(rule)].Lookup(strIP)
+	if err != nil {
+		log.Debugf("Can't find GeoIP info for IP %v err %v", strIP, err)
+		return
+	}
+	if info == nil {
+		// private address
+		return
+	}
+	fields := rule.OutputFields()
+	if fields.Country != "" && info.Country != "" {
+		outputEntry[fields.Country] = info.Country
+	}
+	if fields.ASN != "" && info.ASN != 0 {
+		outputEntry[fields.ASN] = info.ASN
+	}
+	if fields.City != "" && info.City != "" {
+		outputEntry[fields.City] = info.City
+	}
+	if info.Location != nil {
+		if fields.Latitude != "" {
+			outputEntry[fields.Latitude] = info.Location.Latitude
+		}
+		if fields.Longitude != "" {
+			outputEntry[fields.Longitude] = info.Location.Longitude
+		}
+	}
+}
+
+func geoIPKey(rule *api.NetworkAddGeoIPRule) string {
+	return rule.DBPath + "|" + rule.ASNDBPath
+}
+
+// applySubnetLabel returns the label of the most specific subnet containing the IP
 func (n *Network) applySubnetLabel(strIP string) string {
 	ip := net.ParseIP(strIP)
-	if ip != nil {
-		for _, subnetCat := range n.snLabels {
-			for _, cidr := range subnetCat.cidrs {
-				if cidr.Contains(ip) {
-					return subnetCat.name
-				}
+	if ip == nil {
+		return ""
+	}
+	label, longest := "", -1
+	for _, subnetCat := range n.snLabels {
+		for _, cidr := range subnetCat.cidrs {
+			if ones, _ := cidr.Mask.Size(); ones > longest && cidr.Contains(ip) {
+				label, longest = subnetCat.name, ones
 			}
 		}
 	}
-	return ""
+	return label
 }
 
 // NewTransformNetwork create a new transform
 //
 //nolint:cyclop
-func NewTransformNetwork(params config.StageParam, opMetrics *operational.Metrics) (Transformer, error) {
+func NewTransformNetwork(params config.StageParam, opMetrics *operational.Metrics) (_ Transformer, err error) {
 	var needToInitLocationDB = false
 	var needToInitKubeData = false
+	var needToInitNamespaces = false
+	var needToInitNetworkPolicies = false
 	var needToInitNetworkServices = false
 
 	jsonNetworkTransform := api.TransformNetwork{}
 	if params.Transform != nil && params.Transform.Network != nil {
 		jsonNetworkTransform = *params.Transform.Network
 	}
+	geoIPDBs := map[string]*geoip.DB{}
+	var geoIPMisses prometheus.Counter
+	hashers := map[*api.NetworkHashRule]*fieldHasher{}
+	durations := map[*api.NetworkDurationRule]*durationComputer{}
+	dnsReversers := map[*api.NetworkDNSReverseRule]*dnsReverser{}
+	portServices := map[*api.NetworkPortToServiceRule]*netdb.PortServices{}
+	// the GeoIP databases and DNS lookups started for the first rules are released when the configuration is invalid
+	defer func() {
+		if err != nil {
+			for _, db := range geoIPDBs {
+				db.Close()
+			}
+			for _, r := range dnsReversers {
+				r.stop()
+			}
+		}
+	}()
 	for _, rule := range jsonNetworkTransform.Rules {
 		switch rule.Type {
 		case api.NetworkAddLocation:
 			needToInitLocationDB = true
 		case api.NetworkAddKubernetes:
 			needToInitKubeData = true
+			if rule.Kubernetes != nil && rule.Kubernetes.NamespaceLabelsPrefix != "" {
+				needToInitNamespaces = true
+			}
 		case api.NetworkAddKubernetesInfra:
 			needToInitKubeData = true
 		case api.NetworkAddService:
@@ -201,6 +313,65 @@ func NewTransformNetwork(params config.StageParam, opMetrics *operational.Metric
 			if len(jsonNetworkTransform.SubnetLabels) == 0 {
 				return nil, fmt.Errorf("a rule '%s' was found, but there are no subnet labels configured", api.NetworkAddSubnetLabel)
 			}
+		case api.NetworkAddGeoIP:
+			if rule.AddGeoIP == nil || rule.AddGeoIP.DBPath == "" {
+				return nil, fmt.Errorf("a rule '%s' was found, but there is no dbPath configured", api.NetworkAddGeoIP)
+			}
+			key := geoIPKey(rule.AddGeoIP)
+			if _, ok := geoIPDBs[key]; ok {
+				continue
+			}
+			if geoIPMisses == nil {
+				geoIPMisses = geoip.NewMissesCounter(opMetrics, params.Name)
+			}
+			db, err := geoip.Open(rule.AddGeoIP.DBPath, rule.AddGeoIP.ASNDBPath, geoIPMisses)
+			if err != nil {
+				return nil, err
+			}
+			if err := db.WatchFiles(); err != nil {
+				log.WithError(err).Warn("can't watch GeoIP databases: they are only reloaded on SIGHUP")
+			}
+			geoIPDBs[key] = db
+		case api.NetworkHash:
+			hasher, err := newFieldHasher(rule.Hash, opMetrics, params.Name)
+			if err != nil {
+				return nil, err
+			}
+			hashers[rule.Hash] = hasher
+		case api.NetworkDuration:
+			computer, err := newDurationComputer(rule.Duration, opMetrics, params.Name)
+			if err != nil {
+				return nil, err
+			}
+			durations[rule.Duration] = computer
+		case api.NetworkPrefix:
+			if err := validateNetworkPrefixRule(rule.NetworkPrefix); err != nil {
+				return nil, err
+			}
+		case api.NetworkDNSReverse:
+			if err := validateDNSReverseRule(rule.DNSReverse); err != nil {
+				return nil, err
+			}
+			resolver, err := newDNSClientResolver(rule.DNSReverse)
+			if err != nil {
+				return nil, err
+			}
+			dnsReversers[rule.DNSReverse] = newDNSReverser(rule.DNSReverse, resolver, opMetrics, params.Name)
+		case api.NetworkPortToService:
+			services, err := newPortServices(rule.PortToService)
+			if err != nil {
+				return nil, err
+			}
+			portServices[rule.PortToService] = services
+		case api.NetworkPolicyCheck:
+			if rule.NetpolCheck == nil {
+				return nil, fmt.Errorf("invalid config for transform.Network rule %s: missing configuration", api.NetworkPolicyCheck)
+			}
+			rule.NetpolCheck.SetDefaults()
+			// namespace labels are needed by the namespace selectors
+			needToInitKubeData = true
+			needToInitNamespaces = true
+			needToInitNetworkPolicies = true
 		case api.NetworkAddSubnet, api.NetworkDecodeTCPFlags:
 			// nothing
 		}
@@ -214,7 +385,7 @@ func NewTransformNetwork(params config.StageParam, opMetrics *operational.Metric
 	}
 
 	if needToInitKubeData {
-		err := kubernetes.InitFromConfig(jsonNetworkTransform.KubeConfig, opMetrics)
+		err := kubernetes.InitFromConfig(jsonNetworkTransform.KubeConfig, needToInitNamespaces, needToInitNetworkPolicies, opMetrics)
 		if err != nil {
 			return nil, err
 		}
@@ -263,5 +434,10 @@ func NewTransformNetwork(params config.StageParam, opMetrics *operational.Metric
 		svcNames:     servicesDB,
 		snLabels:     subnetCats,
 		ipLabelCache: utils.NewQuietExpiringTimedCache(2 * time.Minute),
+		geoIPDBs:     geoIPDBs,
+		hashers:      hashers,
+		durations:    durations,
+		dnsReversers: dnsReversers,
+		portServices: portServices,
 	}, nil
 }
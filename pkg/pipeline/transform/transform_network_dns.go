@@ -0,0 +1,309 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// dnsNXDomain is written for the IPs without PTR record
+	dnsNXDomain = "<nxdomain>"
+	// dnsNegativeTTL is the time to cache a missing PTR record, when the response has no SOA record
+	dnsNegativeTTL = 5 * time.Minute
+	dnsQueueSize   = 1000
+)
+
+var (
+	errNXDomain = errors.New("no PTR record")
+
+	dnsReverseCacheDef = operational.DefineMetric(
+		"dns_reverse_cache_lookups",
+		"Counter of the dns_reverse rule cache lookups, by result (hit or miss)",
+		operational.TypeCounter,
+		"stage", "field", "result",
+	)
+	dnsReverseQueriesDef = operational.DefineMetric(
+		"dns_reverse_queries",
+		"Counter of the dns_reverse rule DNS queries, by result (found, nxdomain, error, or dropped when too many queries are pending)",
+		operational.TypeCounter,
+		"stage", "field", "result",
+	)
+	dnsReverseLatencyDef = operational.DefineMetric(
+		"dns_reverse_query_duration_seconds",
+		"Histogram of the dns_reverse rule DNS queries duration, in seconds",
+		operational.TypeHistogram,
+		"stage", "field",
+	)
+)
+
+// ptrResolver looks up the hostname of an IP, along with the time to cache it
+type ptrResolver interface {
+	lookupPTR(ip netip.Addr) (string, time.Duration, error)
+}
+
+type dnsClientResolver struct {
+	client  *dns.Client
+	servers []string
+}
+
+func newDNSClientResolver(rule *api.NetworkDNSReverseRule) (*dnsClientResolver, error) {
+	servers := []string{rule.Server}
+	if rule.Server == "" {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: can't read the system resolver configuration: %w", api.NetworkDNSReverse, err)
+		}
+		servers = servers[:0]
+		for _, server := range conf.Servers {
+			servers = append(servers, net.JoinHostPort(server, conf.Port))
+		}
+	}
+	return &dnsClientResolver{client: &dns.Client{Timeout: rule.Timeout.Duration}, servers: servers}, nil
+}
+
+func (r *dnsClientResolver) lookupPTR(ip netip.Addr) (string, time.Duration, error) {
+	name, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return "", 0, err
+	}
+	query := new(dns.Msg).SetQuestion(name, dns.TypePTR)
+	for _, server := range r.servers {
+		var resp *dns.Msg
+		resp, _, err = r.client.Exchange(query, server)
+		if err != nil {
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			err = fmt.Errorf("%s answered %s", server, dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		for _, answer := range resp.Answer {
+			if ptr, ok := answer.(*dns.PTR); ok {
+				return strings.TrimSuffix(ptr.Ptr, "."), time.Duration(ptr.Hdr.Ttl) * time.Second, nil
+			}
+		}
+		// negative answers are cached as long as the SOA record tells to
+		ttl := dnsNegativeTTL
+		for _, ns := range resp.Ns {
+			if soa, ok := ns.(*dns.SOA); ok {
+				ttl = time.Duration(min(soa.Hdr.Ttl, soa.Minttl)) * time.Second
+			}
+		}
+		return "", ttl, errNXDomain
+	}
+	return "", 0, err
+}
+
+type dnsCacheEntry struct {
+	ip       netip.Addr
+	hostname string
+	expiry   time.Time
+}
+
+// dnsReverser annotates the flows with the hostname of an IP. The lookups never block the pipeline:
+// on a cache miss, the output is empty and the IP is queued to be looked up in the background, so that
+// the next flows get the hostname. Expired entries are still used until they are refreshed.
+type dnsReverser struct {
+	rule     *api.NetworkDNSReverseRule
+	resolver ptrResolver
+	limiter  *rate.Limiter
+	queue    chan netip.Addr
+	exitChan <-chan struct{}
+	closing  chan struct{}
+	// mutex protects the cache, shared with the lookup goroutine
+	mutex   sync.Mutex
+	entries map[netip.Addr]*list.Element
+	lru     *list.List
+	pending map[netip.Addr]struct{}
+	metrics dnsReverseMetrics
+}
+
+type dnsReverseMetrics struct {
+	hits, misses                     prometheus.Counter
+	found, nxdomain, errors, dropped prometheus.Counter
+	latency                          prometheus.Histogram
+}
+
+func newDNSReverser(rule *api.NetworkDNSReverseRule, resolver ptrResolver, opMetrics *operational.Metrics, stage string) *dnsReverser {
+	r := &dnsReverser{
+		rule:     rule,
+		resolver: resolver,
+		limiter:  rate.NewLimiter(rate.Limit(rule.RateLimit), 1),
+		queue:    make(chan netip.Addr, dnsQueueSize),
+		exitChan: utils.ExitChannel(),
+		closing:  make(chan struct{}),
+		entries:  map[netip.Addr]*list.Element{},
+		lru:      list.New(),
+		pending:  map[netip.Addr]struct{}{},
+		metrics: dnsReverseMetrics{
+			hits:     opMetrics.NewCounter(&dnsReverseCacheDef, stage, rule.Input, "hit"),
+			misses:   opMetrics.NewCounter(&dnsReverseCacheDef, stage, rule.Input, "miss"),
+			found:    opMetrics.NewCounter(&dnsReverseQueriesDef, stage, rule.Input, "found"),
+			nxdomain: opMetrics.NewCounter(&dnsReverseQueriesDef, stage, rule.Input, "nxdomain"),
+			errors:   opMetrics.NewCounter(&dnsReverseQueriesDef, stage, rule.Input, "error"),
+			dropped:  opMetrics.NewCounter(&dnsReverseQueriesDef, stage, rule.Input, "dropped"),
+			latency:  opMetrics.NewHistogram(&dnsReverseLatencyDef, []float64{.001, .005, .01, .05, .1, .5, 1, 5}, stage, rule.Input),
+		},
+	}
+	go r.run()
+	return r
+}
+
+func validateDNSReverseRule(rule *api.NetworkDNSReverseRule) error {
+	if rule == nil {
+		return fmt.Errorf("invalid config for transform.Network rule %s: missing configuration", api.NetworkDNSReverse)
+	}
+	rule.SetDefaults()
+	if err := rule.Validate(); err != nil {
+		return fmt.Errorf("invalid config for transform.Network rule %s: %w", api.NetworkDNSReverse, err)
+	}
+	return nil
+}
+
+func (r *dnsReverser) annotate(outputEntry config.GenericMap) {
+	str, ok := outputEntry.LookupString(r.rule.Input)
+	if !ok || str == "" {
+		return
+	}
+	ip, err := netip.ParseAddr(str)
+	if err != nil {
+		log.Debugf("Can't lookup hostname for IP %v - err %v", str, err)
+		return
+	}
+	ip = ip.Unmap()
+	hostname, found := r.get(ip)
+	outputEntry[r.rule.Output] = hostname
+	if found {
+		r.metrics.hits.Inc()
+	} else {
+		r.metrics.misses.Inc()
+	}
+}
+
+// get returns the cached hostname, and queues a lookup when the IP is not cached or is expired
+func (r *dnsReverser) get(ip netip.Addr) (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	elem, found := r.entries[ip]
+	var hostname string
+	if found {
+		r.lru.MoveToFront(elem)
+		entry := elem.Value.(*dnsCacheEntry)
+		hostname = entry.hostname
+		if time.Now().Before(entry.expiry) {
+			return hostname, true
+		}
+	}
+	if _, ok := r.pending[ip]; !ok {
+		select {
+		case r.queue <- ip:
+			r.pending[ip] = struct{}{}
+		default:
+			r.metrics.dropped.Inc()
+		}
+	}
+	return hostname, found
+}
+
+func (r *dnsReverser) set(ip netip.Addr, hostname string, ttl time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.pending, ip)
+	entry := &dnsCacheEntry{ip: ip, hostname: hostname, expiry: time.Now().Add(ttl)}
+	if elem, ok := r.entries[ip]; ok {
+		elem.Value = entry
+		r.lru.MoveToFront(elem)
+		return
+	}
+	r.entries[ip] = r.lru.PushFront(entry)
+	if r.lru.Len() > r.rule.CacheSize {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.entries, oldest.Value.(*dnsCacheEntry).ip)
+	}
+}
+
+// stop stops the lookup goroutine
+func (r *dnsReverser) stop() {
+	close(r.closing)
+}
+
+func (r *dnsReverser) run() {
+	for {
+		select {
+		case <-r.exitChan:
+			return
+		case <-r.closing:
+			return
+		case ip := <-r.queue:
+			// the lookups are rate-limited, to avoid overwhelming the DNS servers
+			select {
+			case <-r.exitChan:
+				return
+			case <-r.closing:
+				return
+			case <-time.After(r.limiter.Reserve().Delay()):
+			}
+			r.lookup(ip)
+		}
+	}
+}
+
+func (r *dnsReverser) lookup(ip netip.Addr) {
+	start := time.Now()
+	hostname, ttl, err := r.resolver.lookupPTR(ip)
+	r.metrics.latency.Observe(time.Since(start).Seconds())
+	if r.rule.TTL != nil {
+		ttl = r.rule.TTL.Duration
+	}
+	switch {
+	case errors.Is(err, errNXDomain):
+		r.metrics.nxdomain.Inc()
+		hostname = dnsNXDomain
+		if r.rule.NegativeTTL != nil {
+			ttl = r.rule.NegativeTTL.Duration
+		}
+	case err != nil:
+		// not cached: the lookup is retried with the next flows
+		r.metrics.errors.Inc()
+		log.Debugf("Can't lookup hostname for IP %v - err %v", ip, err)
+		r.mutex.Lock()
+		delete(r.pending, ip)
+		r.mutex.Unlock()
+		return
+	default:
+		r.metrics.found.Inc()
+	}
+	r.set(ip, hostname, ttl)
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolverAnswer struct {
+	hostname string
+	err      error
+}
+
+type fakeResolver struct {
+	sync.Mutex
+	answers map[string]fakeResolverAnswer
+	calls   map[string]int
+}
+
+func (f *fakeResolver) lookupPTR(ip netip.Addr) (string, time.Duration, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.calls[ip.String()]++
+	answer, ok := f.answers[ip.String()]
+	if !ok {
+		return "", time.Hour, errNXDomain
+	}
+	return answer.hostname, time.Hour, answer.err
+}
+
+func (f *fakeResolver) callsTo(ip string) int {
+	f.Lock()
+	defer f.Unlock()
+	return f.calls[ip]
+}
+
+func newFakeDNSReverser(t *testing.T, rule *api.NetworkDNSReverseRule) (*dnsReverser, *fakeResolver) {
+	require.NoError(t, validateDNSReverseRule(rule))
+	resolver := &fakeResolver{
+		answers: map[string]fakeResolverAnswer{
+			"10.0.0.1": {hostname: "host1.example.com"},
+			"10.0.0.2": {hostname: "host2.example.com"},
+			"10.0.0.3": {hostname: "host3.example.com"},
+			"10.0.0.9": {err: errors.New("i/o timeout")},
+		},
+		calls: map[string]int{},
+	}
+	return newDNSReverser(rule, resolver, operational.NewMetrics(&config.MetricsSettings{}), "dns"), resolver
+}
+
+// annotateEventually annotates the entry until the output field is set to the expected value
+func annotateEventually(t *testing.T, r *dnsReverser, ip, expected string) {
+	require.Eventually(t, func() bool {
+		entry := config.GenericMap{"DstAddr": ip}
+		r.annotate(entry)
+		return entry["DstAddr_ReverseDNS"] == expected
+	}, time.Second, time.Millisecond)
+}
+
+func Test_DNSReverseCache(t *testing.T) {
+	r, resolver := newFakeDNSReverser(t, &api.NetworkDNSReverseRule{Input: "DstAddr"})
+
+	// a miss doesn't block: the output is empty until the lookup completes
+	entry := config.GenericMap{"DstAddr": "10.0.0.1"}
+	r.annotate(entry)
+	require.Equal(t, config.GenericMap{"DstAddr": "10.0.0.1", "DstAddr_ReverseDNS": ""}, entry)
+	annotateEventually(t, r, "10.0.0.1", "host1.example.com")
+
+	// hits don't query the resolver
+	for i := 0; i < 10; i++ {
+		entry = config.GenericMap{"DstAddr": "10.0.0.1"}
+		r.annotate(entry)
+		require.Equal(t, "host1.example.com", entry["DstAddr_ReverseDNS"])
+	}
+	require.Equal(t, 1, resolver.callsTo("10.0.0.1"))
+
+	// IPs without PTR record get a sentinel
+	annotateEventually(t, r, "192.168.0.1", dnsNXDomain)
+	require.Equal(t, 1, resolver.callsTo("192.168.0.1"))
+
+	// failed lookups are not cached
+	r.annotate(config.GenericMap{"DstAddr": "10.0.0.9"})
+	require.Eventually(t, func() bool { return resolver.callsTo("10.0.0.9") == 1 }, time.Second, time.Millisecond)
+	annotateEventually(t, r, "10.0.0.9", "")
+	require.Eventually(t, func() bool { return resolver.callsTo("10.0.0.9") > 1 }, time.Second, time.Millisecond)
+
+	// invalid and missing IPs are ignored
+	entry = config.GenericMap{"DstAddr": "invalid"}
+	r.annotate(entry)
+	require.NotContains(t, entry, "DstAddr_ReverseDNS")
+	entry = config.GenericMap{}
+	r.annotate(entry)
+	require.NotContains(t, entry, "DstAddr_ReverseDNS")
+}
+
+func Test_DNSReverseTTL(t *testing.T) {
+	r, resolver := newFakeDNSReverser(t, &api.NetworkDNSReverseRule{Input: "DstAddr", TTL: &api.Duration{Duration: 50 * time.Millisecond}})
+	annotateEventually(t, r, "10.0.0.1", "host1.example.com")
+	require.Equal(t, 1, resolver.callsTo("10.0.0.1"))
+
+	// once expired, the entry is still used while it's refreshed
+	time.Sleep(60 * time.Millisecond)
+	entry := config.GenericMap{"DstAddr": "10.0.0.1"}
+	r.annotate(entry)
+	require.Equal(t, "host1.example.com", entry["DstAddr_ReverseDNS"])
+	require.Eventually(t, func() bool { return resolver.callsTo("10.0.0.1") == 2 }, time.Second, time.Millisecond)
+}
+
+func Test_DNSReverseNegativeTTL(t *testing.T) {
+	r, resolver := newFakeDNSReverser(t, &api.NetworkDNSReverseRule{
+		Input:       "DstAddr",
+		NegativeTTL: &api.Duration{Duration: 50 * time.Millisecond},
+	})
+	annotateEventually(t, r, "10.0.0.1", "host1.example.com")
+	annotateEventually(t, r, "192.168.0.1", dnsNXDomain)
+
+	// only the missing PTR record expires
+	time.Sleep(60 * time.Millisecond)
+	r.annotate(config.GenericMap{"DstAddr": "10.0.0.1"})
+	r.annotate(config.GenericMap{"DstAddr": "192.168.0.1"})
+	require.Eventually(t, func() bool { return resolver.callsTo("192.168.0.1") == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, 1, resolver.callsTo("10.0.0.1"))
+
+	// every query is timed
+	require.Eventually(t, func() bool {
+		m := &dto.Metric{}
+		require.NoError(t, r.metrics.latency.Write(m))
+		return m.GetHistogram().GetSampleCount() == 3
+	}, time.Second, time.Millisecond)
+}
+
+func Test_DNSReverseLRU(t *testing.T) {
+	r, resolver := newFakeDNSReverser(t, &api.NetworkDNSReverseRule{Input: "DstAddr", CacheSize: 2})
+	annotateEventually(t, r, "10.0.0.1", "host1.example.com")
+	annotateEventually(t, r, "10.0.0.2", "host2.example.com")
+	// 10.0.0.1 is used again, 10.0.0.2 becomes the least recently used
+	annotateEventually(t, r, "10.0.0.1", "host1.example.com")
+	annotateEventually(t, r, "10.0.0.3", "host3.example.com")
+
+	r.mutex.Lock()
+	require.Len(t, r.entries, 2)
+	require.Contains(t, r.entries, netip.MustParseAddr("10.0.0.1"))
+	require.NotContains(t, r.entries, netip.MustParseAddr("10.0.0.2"))
+	r.mutex.Unlock()
+	annotateEventually(t, r, "10.0.0.2", "host2.example.com")
+	require.Equal(t, 2, resolver.callsTo("10.0.0.2"))
+	require.Equal(t, 1, resolver.callsTo("10.0.0.1"))
+}
+
+func Test_DNSReverseRateLimit(t *testing.T) {
+	r, resolver := newFakeDNSReverser(t, &api.NetworkDNSReverseRule{Input: "DstAddr", RateLimit: 5})
+	start := time.Now()
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		r.annotate(config.GenericMap{"DstAddr": ip})
+	}
+	require.Eventually(t, func() bool { return resolver.callsTo("10.0.0.3") == 1 }, time.Second, time.Millisecond)
+	// the first query is immediate, the next ones are spaced by 200ms
+	require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func Test_ValidateDNSReverse(t *testing.T) {
+	for _, rule := range []*api.NetworkDNSReverseRule{
+		nil,
+		{Server: "10.0.0.53:53"},
+		{Input: "DstAddr", Server: "10.0.0.53"},
+		{Input: "DstAddr", CacheSize: -1},
+		{Input: "DstAddr", TTL: &api.Duration{}},
+		{Input: "DstAddr", NegativeTTL: &api.Duration{Duration: -time.Second}},
+	} {
+		require.Error(t, validateDNSReverseRule(rule), "rule %v", rule)
+	}
+	rule := &api.NetworkDNSReverseRule{Input: "DstAddr"}
+	require.NoError(t, validateDNSReverseRule(rule))
+	require.Equal(t, "DstAddr_ReverseDNS", rule.Output)
+}
+
+func Test_DNSClientResolver(t *testing.T) {
+	// local DNS server answering PTR queries for 10.0.0.1 only
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg).SetReply(req)
+		if req.Question[0].Name == "1.0.0.10.in-addr.arpa." {
+			resp.Answer = append(resp.Answer, &dns.PTR{
+				Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 300},
+				Ptr: "host1.example.com.",
+			})
+		} else {
+			resp.Rcode = dns.RcodeNameError
+			resp.Ns = append(resp.Ns, &dns.SOA{
+				Hdr:    dns.RR_Header{Name: "10.in-addr.arpa.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+				Ns:     "ns.example.com.",
+				Mbox:   "admin.example.com.",
+				Minttl: 60,
+			})
+		}
+		_ = w.WriteMsg(resp)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	defer func() { _ = server.Shutdown() }()
+
+	rule := &api.NetworkDNSReverseRule{Input: "DstAddr", Server: conn.LocalAddr().String()}
+	require.NoError(t, validateDNSReverseRule(rule))
+	resolver, err := newDNSClientResolver(rule)
+	require.NoError(t, err)
+
+	hostname, ttl, err := resolver.lookupPTR(netip.MustParseAddr("10.0.0.1"))
+	require.NoError(t, err)
+	require.Equal(t, "host1.example.com", hostname)
+	require.Equal(t, 5*time.Minute, ttl)
+
+	// negative answers are cached for the SOA minimum TTL
+	_, ttl, err = resolver.lookupPTR(netip.MustParseAddr("10.0.0.2"))
+	require.ErrorIs(t, err, errNXDomain)
+	require.Equal(t, time.Minute, ttl)
+}
+
+func Test_NewTransformNetwork_StopsDNSReverserOnError(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	// the DNS lookups of the first rule are started before the invalid second rule is read
+	_, err := NewTransformNetwork(config.StageParam{Name: "dns_error", Transform: &config.Transform{Network: &api.TransformNetwork{
+		Rules: api.NetworkTransformRules{
+			{Type: api.NetworkDNSReverse, DNSReverse: &api.NetworkDNSReverseRule{Input: "DstAddr", Server: "127.0.0.1:53"}},
+			{Type: api.NetworkAddSubnetLabel, AddSubnetLabel: &api.NetworkAddSubnetLabelRule{Input: "DstAddr", Output: "DstLabel"}},
+		},
+	}}}, opMetrics)
+	require.Error(t, err)
+	// polled here rather than with require.Eventually, which runs its condition in another goroutine
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), goroutines, "the DNS lookup goroutine was not stopped")
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	util "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var durationReversedDef = operational.DefineMetric(
+	"duration_reversed_timestamps",
+	"Counter of entries whose end timestamp is before the start timestamp, for which the duration rule output 0",
+	operational.TypeCounter,
+	"stage", "field",
+)
+
+type durationComputer struct {
+	reversed prometheus.Counter
+}
+
+func newDurationComputer(rule *api.NetworkDurationRule, opMetrics *operational.Metrics, stage string) (*durationComputer, error) {
+	if rule == nil || rule.Start == "" || rule.End == "" || rule.Output == "" {
+		return nil, fmt.Errorf("invalid config for transform.Network rule %s: start, end and output must be set", api.NetworkDuration)
+	}
+	return &durationComputer{
+		reversed: opMetrics.NewCounter(&durationReversedDef, stage, rule.Output),
+	}, nil
+}
+
+// compute writes the duration in milliseconds between the start and end timestamps, which are in seconds,
+// as int64 or float64. The output is left unset when any of the timestamps is missing or isn't a number.
+func (d *durationComputer) compute(outputEntry config.GenericMap, rule *api.NetworkDurationRule) {
+	start, ok := timestampField(outputEntry, rule.Start)
+	if !ok {
+		return
+	}
+	end, ok := timestampField(outputEntry, rule.End)
+	if !ok {
+		return
+	}
+	if end < start {
+		log.Debugf("duration rule: %s is before %s, output 0", rule.End, rule.Start)
+		d.reversed.Inc()
+		outputEntry[rule.Output] = int64(0)
+		return
+	}
+	outputEntry[rule.Output] = int64(math.Round((end - start) * 1000))
+}
+
+func timestampField(entry config.GenericMap, field string) (float64, bool) {
+	v, ok := entry[field]
+	if !ok || v == nil {
+		return 0, false
+	}
+	f, err := util.ConvertToFloat64(v)
+	if err != nil {
+		log.Debugf("duration rule: can't convert %s: %v", field, err)
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	util "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var hashEmptyValuesDef = operational.DefineMetric(
+	"hash_empty_values",
+	"Counter of empty field values that the hash rule left unchanged",
+	operational.TypeCounter,
+	"stage", "field",
+)
+
+type fieldHasher struct {
+	key         []byte
+	truncate    int
+	emptyValues prometheus.Counter
+}
+
+// newFieldHasher loads the HMAC key once; the key itself must never be logged nor returned in errors
+func newFieldHasher(rule *api.NetworkHashRule, opMetrics *operational.Metrics, stage string) (*fieldHasher, error) {
+	if rule == nil || rule.Input == "" {
+		return nil, fmt.Errorf("invalid config for transform.Network rule %s: missing input", api.NetworkHash)
+	}
+	if (rule.KeyEnv == "") == (rule.KeyFile == "") {
+		return nil, fmt.Errorf("invalid config for transform.Network rule %s: exactly one of keyEnv or keyFile must be set", api.NetworkHash)
+	}
+	if rule.Truncate < 0 || rule.Truncate > hex.EncodedLen(sha256.Size) {
+		return nil, fmt.Errorf("invalid config for transform.Network rule %s: truncate must be between 0 and %d", api.NetworkHash, hex.EncodedLen(sha256.Size))
+	}
+	var key string
+	if rule.KeyEnv != "" {
+		key = os.Getenv(rule.KeyEnv)
+	} else {
+		content, err := os.ReadFile(rule.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: can't read key file %s: %w", api.NetworkHash, rule.KeyFile, err)
+		}
+		// secrets are often written with a trailing newline
+		key = strings.TrimRight(string(content), "\r\n")
+	}
+	if key == "" {
+		return nil, fmt.Errorf("invalid config for transform.Network rule %s: the key for field %s is empty", api.NetworkHash, rule.Input)
+	}
+	return &fieldHasher{
+		key:         []byte(key),
+		truncate:    rule.Truncate,
+		emptyValues: opMetrics.NewCounter(&hashEmptyValuesDef, stage, rule.Input),
+	}, nil
+}
+
+func (h *fieldHasher) hash(outputEntry config.GenericMap, field string) {
+	v, ok := outputEntry[field]
+	if !ok {
+		return
+	}
+	var str string
+	if v != nil {
+		str = util.ConvertToString(v)
+	}
+	if str == "" {
+		h.emptyValues.Inc()
+		return
+	}
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(str))
+	digest := hex.EncodeToString(mac.Sum(nil))
+	if h.truncate > 0 {
+		digest = digest[:h.truncate]
+	}
+	outputEntry[field] = digest
+}
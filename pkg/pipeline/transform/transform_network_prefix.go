@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+)
+
+func validateNetworkPrefixRule(rule *api.NetworkPrefixRule) error {
+	if rule == nil {
+		return fmt.Errorf("invalid config for transform.Network rule %s: missing configuration", api.NetworkPrefix)
+	}
+	rule.SetDefaults()
+	if err := rule.Validate(); err != nil {
+		return fmt.Errorf("invalid config for transform.Network rule %s: %w", api.NetworkPrefix, err)
+	}
+	return nil
+}
+
+// networkPrefix masks the input IP with the prefix length of its family. IPv4-mapped IPv6 addresses are handled
+// as IPv4. Invalid IPs are left unchanged.
+func networkPrefix(outputEntry config.GenericMap, rule *api.NetworkPrefixRule) {
+	str, ok := outputEntry.LookupString(rule.Input)
+	if !ok || str == "" {
+		return
+	}
+	addr, err := netip.ParseAddr(str)
+	if err != nil {
+		log.Warningf("Can't find network prefix for IP %v - err %v", str, err)
+		return
+	}
+	addr = addr.Unmap()
+	bits := rule.IPv6PrefixLength
+	if addr.Is4() {
+		bits = rule.IPv4PrefixLength
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		log.Warningf("Can't find network prefix for IP %v and prefix length %d - err %v", str, bits, err)
+		return
+	}
+	outputEntry[rule.Output] = prefix.String()
+}
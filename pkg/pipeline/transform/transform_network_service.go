@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/netdb"
+	util "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+)
+
+func newPortServices(rule *api.NetworkPortToServiceRule) (*netdb.PortServices, error) {
+	if rule == nil || rule.Input == "" || rule.Output == "" {
+		return nil, fmt.Errorf("invalid config for transform.Network rule %s: input and output must be set", api.NetworkPortToService)
+	}
+	services := netdb.NewPortServices()
+	for _, o := range rule.Overrides {
+		if o.Port <= 0 || o.Port > 65535 {
+			return nil, fmt.Errorf("invalid config for transform.Network rule %s: invalid override port %d", api.NetworkPortToService, o.Port)
+		}
+		if o.Service == "" {
+			return nil, fmt.Errorf("invalid config for transform.Network rule %s: missing service name for override port %d", api.NetworkPortToService, o.Port)
+		}
+		var protoNum int
+		if o.Protocol != "" {
+			var ok bool
+			if protoNum, ok = netdb.ProtocolNumber(o.Protocol); !ok {
+				return nil, fmt.Errorf("invalid config for transform.Network rule %s: unknown protocol %q for override port %d", api.NetworkPortToService, o.Protocol, o.Port)
+			}
+		}
+		services.Override(o.Port, protoNum, o.Service)
+	}
+	return services, nil
+}
+
+// portToService writes the service name of the input port, or unknown_<port> when there is none. The protocol
+// field may hold a number or a name. Entries without a valid port are left unchanged.
+func portToService(outputEntry config.GenericMap, rule *api.NetworkPortToServiceRule, services *netdb.PortServices) {
+	rawPort, ok := outputEntry[rule.Input]
+	if !ok || rawPort == nil {
+		return
+	}
+	port, err := util.ConvertToInt(rawPort)
+	if err != nil {
+		log.Debugf("Can't convert port to int: Port %v - err %v", rawPort, err)
+		return
+	}
+	var protoNum int
+	if rule.Protocol != "" {
+		if rawProto, ok := outputEntry[rule.Protocol]; ok && rawProto != nil {
+			protoNum = protocolNumber(rawProto)
+		}
+	}
+	name := services.ByPortAndProtocolNumber(port, protoNum)
+	if name == "" {
+		name = "unknown_" + strconv.Itoa(port)
+	}
+	outputEntry[rule.Output] = name
+}
+
+// protocolNumber returns the number of a protocol given as a number or a name, or 0 when it is not known
+func protocolNumber(proto any) int {
+	if str, ok := proto.(string); ok {
+		if num, ok := netdb.ProtocolNumber(str); ok {
+			return num
+		}
+	}
+	num, err := util.ConvertToInt(proto)
+	if err != nil {
+		return 0
+	}
+	return num
+}
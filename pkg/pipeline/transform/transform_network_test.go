@@ -18,15 +18,20 @@
 package transform
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path"
 	"testing"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
 	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/location"
 	netdb "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/transform/netdb"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -262,6 +267,47 @@ func Test_Categorize(t *testing.T) {
 	}, output)
 }
 
+func Test_CategorizeLongestPrefix(t *testing.T) {
+	cfg := config.StageParam{
+		Transform: &config.Transform{
+			Network: &api.TransformNetwork{
+				Rules: []api.NetworkTransformRule{
+					{Type: api.NetworkAddSubnetLabel, AddSubnetLabel: &api.NetworkAddSubnetLabelRule{Input: "SrcAddr", Output: "SrcZone", Default: "external"}},
+					{Type: api.NetworkAddSubnetLabel, AddSubnetLabel: &api.NetworkAddSubnetLabelRule{Input: "DstAddr", Output: "DstZone"}},
+				},
+				SubnetLabels: []api.NetworkTransformSubnetLabel{{
+					Name:  "internal",
+					CIDRs: []string{"10.0.0.0/8", "fd00::/8"},
+				}, {
+					Name:  "dmz",
+					CIDRs: []string{"10.10.0.0/16", "fd00:10::/32"},
+				}, {
+					Name:  "vpn",
+					CIDRs: []string{"10.10.8.0/24"},
+				}},
+			},
+		},
+	}
+	tr, err := NewTransformNetwork(cfg, nil)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		src, dst   string
+		srcZ, dstZ any
+	}{
+		{src: "10.1.2.3", dst: "10.10.1.1", srcZ: "internal", dstZ: "dmz"},
+		{src: "10.10.8.4", dst: "10.10.9.4", srcZ: "vpn", dstZ: "dmz"},
+		{src: "fd00:10::1", dst: "fd00:20::1", srcZ: "dmz", dstZ: "internal"},
+		// unmatched IPs get the default label, when configured
+		{src: "8.8.8.8", dst: "2001:db8::1", srcZ: "external", dstZ: nil},
+	} {
+		output, ok := tr.Transform(config.GenericMap{"SrcAddr": tc.src, "DstAddr": tc.dst})
+		require.True(t, ok)
+		require.Equal(t, tc.srcZ, output["SrcZone"], tc.src)
+		require.Equal(t, tc.dstZ, output["DstZone"], tc.dst)
+	}
+}
+
 func Test_ReinterpretDirection(t *testing.T) {
 	cfg := config.StageParam{
 		Transform: &config.Transform{
@@ -521,3 +567,302 @@ func Test_ValidateReinterpretDirection(t *testing.T) {
 		"FlowDirection": 1,
 	}, output)
 }
+
+func Test_ValidateGeoIP(t *testing.T) {
+	// Missing configuration
+	_, err := NewTransformNetwork(config.StageParam{
+		Transform: &config.Transform{
+			Network: &api.TransformNetwork{
+				Rules: []api.NetworkTransformRule{{
+					Type: api.NetworkAddGeoIP,
+				}},
+			},
+		},
+	}, nil)
+	require.Contains(t, err.Error(), "no dbPath configured")
+
+	// Missing database file
+	_, err = NewTransformNetwork(config.StageParam{
+		Transform: &config.Transform{
+			Network: &api.TransformNetwork{
+				Rules: []api.NetworkTransformRule{{
+					Type: api.NetworkAddGeoIP,
+					AddGeoIP: &api.NetworkAddGeoIPRule{
+						Input:  "SrcAddr",
+						DBPath: "/nonexistent/GeoLite2-City.mmdb",
+					},
+				}},
+			},
+		},
+	}, operational.NewMetrics(&config.MetricsSettings{}))
+	require.Contains(t, err.Error(), "opening GeoIP database")
+}
+
+func Test_GeoIPOutputFields(t *testing.T) {
+	rule := api.NetworkAddGeoIPRule{Input: "DstAddr"}
+	require.Equal(t, api.GeoIPFields{
+		Country:   "DstAddr_Country",
+		City:      "DstAddr_City",
+		Latitude:  "DstAddr_Latitude",
+		Longitude: "DstAddr_Longitude",
+		ASN:       "DstAddr_ASN",
+	}, rule.OutputFields())
+
+	rule.Output = "Dst"
+	require.Equal(t, "Dst_Latitude", rule.OutputFields().Latitude)
+
+	// only the named fields are generated
+	rule.Fields = &api.GeoIPFields{Country: "DstCountry", ASN: "DstASN"}
+	require.Equal(t, api.GeoIPFields{Country: "DstCountry", ASN: "DstASN"}, rule.OutputFields())
+}
+
+func newHashTransform(rules ...*api.NetworkHashRule) (*Network, error) {
+	var networkRules api.NetworkTransformRules
+	for _, rule := range rules {
+		networkRules = append(networkRules, api.NetworkTransformRule{Type: api.NetworkHash, Hash: rule})
+	}
+	tr, err := NewTransformNetwork(config.StageParam{
+		Name:      "hash",
+		Transform: &config.Transform{Network: &api.TransformNetwork{Rules: networkRules}},
+	}, operational.NewMetrics(&config.MetricsSettings{}))
+	if err != nil {
+		return nil, err
+	}
+	return tr.(*Network), nil
+}
+
+func Test_TransformNetworkHash(t *testing.T) {
+	t.Setenv("FLP_HASH_KEY", "secret-key")
+	hmacHex := func(value string) string {
+		mac := hmac.New(sha256.New, []byte("secret-key"))
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	keyFile := path.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("secret-key\n"), 0600))
+
+	rules := []*api.NetworkHashRule{
+		{Input: "SrcAddr", KeyEnv: "FLP_HASH_KEY"},
+		{Input: "DstMac", KeyFile: keyFile, Truncate: 12},
+		{Input: "Port", KeyEnv: "FLP_HASH_KEY"},
+	}
+	tr, err := newHashTransform(rules...)
+	require.NoError(t, err)
+
+	output, ok := tr.Transform(config.GenericMap{"SrcAddr": "10.0.0.1", "DstMac": "0A:58:0A:80:00:01", "Port": 8080, "Bytes": 10})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{
+		"SrcAddr": hmacHex("10.0.0.1"),
+		// the key file trailing newline is ignored
+		"DstMac": hmacHex("0A:58:0A:80:00:01")[:12],
+		// non-string values are hashed from their string representation
+		"Port":  hmacHex("8080"),
+		"Bytes": 10,
+	}, output)
+
+	// same key, same output after a restart
+	restarted, err := newHashTransform(rules...)
+	require.NoError(t, err)
+	restartedOutput, _ := restarted.Transform(config.GenericMap{"SrcAddr": "10.0.0.1", "DstMac": "0A:58:0A:80:00:01", "Port": 8080, "Bytes": 10})
+	require.Equal(t, output, restartedOutput)
+
+	// empty values are left unchanged and counted
+	output, _ = tr.Transform(config.GenericMap{"SrcAddr": "", "DstMac": nil})
+	require.Equal(t, config.GenericMap{"SrcAddr": "", "DstMac": nil}, output)
+	var m dto.Metric
+	require.NoError(t, tr.hashers[rules[0]].emptyValues.Write(&m))
+	require.Equal(t, 1.0, m.GetCounter().GetValue())
+}
+
+func Test_ValidateHash(t *testing.T) {
+	t.Setenv("FLP_HASH_KEY", "secret-key")
+	t.Setenv("FLP_EMPTY_KEY", "")
+	for _, rule := range []*api.NetworkHashRule{
+		nil,
+		{KeyEnv: "FLP_HASH_KEY"},
+		{Input: "SrcAddr"},
+		{Input: "SrcAddr", KeyEnv: "FLP_HASH_KEY", KeyFile: "/tmp/key"},
+		{Input: "SrcAddr", KeyEnv: "FLP_EMPTY_KEY"},
+		{Input: "SrcAddr", KeyFile: "/nonexistent/key"},
+		{Input: "SrcAddr", KeyEnv: "FLP_HASH_KEY", Truncate: 65},
+	} {
+		_, err := newHashTransform(rule)
+		require.Error(t, err, "rule %v", rule)
+		require.NotContains(t, err.Error(), "secret-key")
+	}
+}
+
+func newDurationTransform(rules ...*api.NetworkDurationRule) (*Network, error) {
+	var networkRules api.NetworkTransformRules
+	for _, rule := range rules {
+		networkRules = append(networkRules, api.NetworkTransformRule{Type: api.NetworkDuration, Duration: rule})
+	}
+	tr, err := NewTransformNetwork(config.StageParam{
+		Name:      "duration",
+		Transform: &config.Transform{Network: &api.TransformNetwork{Rules: networkRules}},
+	}, operational.NewMetrics(&config.MetricsSettings{}))
+	if err != nil {
+		return nil, err
+	}
+	return tr.(*Network), nil
+}
+
+func Test_TransformNetworkDuration(t *testing.T) {
+	rule := &api.NetworkDurationRule{Start: "TimeFlowStart", End: "TimeFlowEnd", Output: "DurationMs"}
+	tr, err := newDurationTransform(rule)
+	require.NoError(t, err)
+
+	// int64 epoch seconds
+	output, ok := tr.Transform(config.GenericMap{"TimeFlowStart": int64(1700000000), "TimeFlowEnd": int64(1700000003)})
+	require.True(t, ok)
+	require.Equal(t, int64(3000), output["DurationMs"])
+
+	// float64 seconds
+	output, _ = tr.Transform(config.GenericMap{"TimeFlowStart": 1700000000.25, "TimeFlowEnd": 1700000001.5})
+	require.Equal(t, int64(1250), output["DurationMs"])
+
+	// missing timestamp: no output
+	output, _ = tr.Transform(config.GenericMap{"TimeFlowStart": 1700000000.25})
+	require.NotContains(t, output, "DurationMs")
+
+	// reversed timestamps: 0, and counted
+	output, _ = tr.Transform(config.GenericMap{"TimeFlowStart": int64(1700000003), "TimeFlowEnd": 1700000000.0})
+	require.Equal(t, int64(0), output["DurationMs"])
+	var m dto.Metric
+	require.NoError(t, tr.durations[rule].reversed.Write(&m))
+	require.Equal(t, 1.0, m.GetCounter().GetValue())
+}
+
+func Test_ValidateDuration(t *testing.T) {
+	for _, rule := range []*api.NetworkDurationRule{
+		nil,
+		{End: "TimeFlowEnd", Output: "DurationMs"},
+		{Start: "TimeFlowStart", Output: "DurationMs"},
+		{Start: "TimeFlowStart", End: "TimeFlowEnd"},
+	} {
+		_, err := newDurationTransform(rule)
+		require.Error(t, err, "rule %v", rule)
+	}
+}
+
+func newPrefixTransform(rules ...*api.NetworkPrefixRule) (*Network, error) {
+	var networkRules api.NetworkTransformRules
+	for _, rule := range rules {
+		networkRules = append(networkRules, api.NetworkTransformRule{Type: api.NetworkPrefix, NetworkPrefix: rule})
+	}
+	tr, err := NewTransformNetwork(config.StageParam{
+		Name:      "prefix",
+		Transform: &config.Transform{Network: &api.TransformNetwork{Rules: networkRules}},
+	}, operational.NewMetrics(&config.MetricsSettings{}))
+	if err != nil {
+		return nil, err
+	}
+	return tr.(*Network), nil
+}
+
+func Test_TransformNetworkPrefix(t *testing.T) {
+	tr, err := newPrefixTransform(
+		&api.NetworkPrefixRule{Input: "SrcAddr"},
+		&api.NetworkPrefixRule{Input: "DstAddr", Output: "DstPrefix", IPv4PrefixLength: 16, IPv6PrefixLength: 64},
+	)
+	require.NoError(t, err)
+
+	output, ok := tr.Transform(config.GenericMap{"SrcAddr": "10.1.2.3", "DstAddr": "10.1.2.4"})
+	require.True(t, ok)
+	require.Equal(t, config.GenericMap{"SrcAddr": "10.1.2.0/24", "DstAddr": "10.1.2.4", "DstPrefix": "10.1.0.0/16"}, output)
+
+	output, _ = tr.Transform(config.GenericMap{"SrcAddr": "2001:db8:1:2::1", "DstAddr": "2001:db8:1:2::2"})
+	require.Equal(t, config.GenericMap{"SrcAddr": "2001:db8:1::/48", "DstAddr": "2001:db8:1:2::2", "DstPrefix": "2001:db8:1:2::/64"}, output)
+
+	// IPv4-mapped IPv6 addresses are handled as IPv4
+	output, _ = tr.Transform(config.GenericMap{"SrcAddr": "::ffff:10.1.2.3"})
+	require.Equal(t, "10.1.2.0/24", output["SrcAddr"])
+
+	// invalid IPs are left unchanged
+	output, _ = tr.Transform(config.GenericMap{"SrcAddr": "not-an-ip", "DstAddr": ""})
+	require.Equal(t, config.GenericMap{"SrcAddr": "not-an-ip", "DstAddr": ""}, output)
+}
+
+func Test_ValidateNetworkPrefix(t *testing.T) {
+	for _, rule := range []*api.NetworkPrefixRule{
+		nil,
+		{IPv4PrefixLength: 24},
+		{Input: "SrcAddr", IPv4PrefixLength: 33},
+		{Input: "SrcAddr", IPv6PrefixLength: -1},
+	} {
+		_, err := newPrefixTransform(rule)
+		require.Error(t, err, "rule %v", rule)
+	}
+}
+
+func BenchmarkTransformNetworkPrefix(b *testing.B) {
+	tr, err := newPrefixTransform(&api.NetworkPrefixRule{Input: "SrcAddr"}, &api.NetworkPrefixRule{Input: "DstAddr"})
+	require.NoError(b, err)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Transform(config.GenericMap{"SrcAddr": "10.1.2.3", "DstAddr": "2001:db8:1:2::2"})
+	}
+}
+
+func newPortToServiceTransform(rule *api.NetworkPortToServiceRule) (*Network, error) {
+	tr, err := NewTransformNetwork(config.StageParam{
+		Name: "services",
+		Transform: &config.Transform{Network: &api.TransformNetwork{Rules: api.NetworkTransformRules{
+			{Type: api.NetworkPortToService, PortToService: rule},
+		}}},
+	}, operational.NewMetrics(&config.MetricsSettings{}))
+	if err != nil {
+		return nil, err
+	}
+	return tr.(*Network), nil
+}
+
+func Test_TransformNetworkPortToService(t *testing.T) {
+	tr, err := newPortToServiceTransform(&api.NetworkPortToServiceRule{
+		Input:    "DstPort",
+		Protocol: "Proto",
+		Output:   "DstService",
+		Overrides: []api.PortServiceOverride{
+			{Port: 9000, Protocol: "tcp", Service: "my-api"},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		port     any
+		proto    any
+		expected string
+	}{
+		{name: "http", port: uint16(80), proto: uint8(6), expected: "http"},
+		{name: "https", port: uint16(443), proto: uint8(6), expected: "https"},
+		{name: "dns", port: uint16(53), proto: uint8(17), expected: "domain"},
+		{name: "protocol name", port: float64(443), proto: "TCP", expected: "https"},
+		{name: "custom port", port: uint16(9000), proto: uint8(6), expected: "my-api"},
+		{name: "custom port, other protocol", port: uint16(9000), proto: uint8(17), expected: "unknown_9000"},
+		{name: "unknown port", port: uint16(40000), proto: uint8(6), expected: "unknown_40000"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			output, ok := tr.Transform(config.GenericMap{"DstPort": tc.port, "Proto": tc.proto})
+			require.True(t, ok)
+			require.Equal(t, tc.expected, output["DstService"])
+		})
+	}
+
+	// entries without port are left unchanged
+	output, _ := tr.Transform(config.GenericMap{"Proto": uint8(1)})
+	require.Equal(t, config.GenericMap{"Proto": uint8(1)}, output)
+}
+
+func Test_ValidatePortToService(t *testing.T) {
+	for _, rule := range []*api.NetworkPortToServiceRule{
+		nil,
+		{Input: "DstPort"},
+		{Input: "DstPort", Output: "DstService", Overrides: []api.PortServiceOverride{{Port: 70000, Service: "x"}}},
+		{Input: "DstPort", Output: "DstService", Overrides: []api.PortServiceOverride{{Port: 9000}}},
+		{Input: "DstPort", Output: "DstService", Overrides: []api.PortServiceOverride{{Port: 9000, Protocol: "icmp", Service: "x"}}},
+	} {
+		_, err := newPortToServiceTransform(rule)
+		require.Error(t, err, "rule %v", rule)
+	}
+}
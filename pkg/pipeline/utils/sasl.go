@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"fmt"
 	"os"
 	"strings"
 
@@ -12,29 +11,29 @@ import (
 )
 
 func SetupSASLMechanism(cfg *api.SASLConfig) (sasl.Mechanism, error) {
-	// Read client ID
-	id, err := os.ReadFile(cfg.ClientIDPath)
-	if err != nil {
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
-	strID := strings.TrimSpace(string(id))
+	// Read client ID, unless provided inline
+	strID := cfg.Username
+	if strID == "" {
+		id, err := os.ReadFile(cfg.ClientIDPath)
+		if err != nil {
+			return nil, err
+		}
+		strID = strings.TrimSpace(string(id))
+	}
 	// Read password
 	pwd, err := os.ReadFile(cfg.ClientSecretPath)
 	if err != nil {
 		return nil, err
 	}
 	strPwd := strings.TrimSpace(string(pwd))
-	var mechanism sasl.Mechanism
 	switch cfg.Type {
-	case api.SASLPlain:
-		mechanism = plain.Mechanism{Username: strID, Password: strPwd}
+	case api.SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, strID, strPwd)
 	case api.SASLScramSHA512:
-		mechanism, err = scram.Mechanism(scram.SHA512, strID, strPwd)
-	default:
-		return nil, fmt.Errorf("unknown SASL type: %s", cfg.Type)
-	}
-	if err != nil {
-		return nil, err
+		return scram.Mechanism(scram.SHA512, strID, strPwd)
 	}
-	return mechanism, nil
+	return plain.Mechanism{Username: strID, Password: strPwd}, nil
 }
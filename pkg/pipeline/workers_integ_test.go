@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pipeline
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/write"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageWorkers(t *testing.T) {
+	builder := config.NewPresetIngesterPipeline()
+	generic := builder.TransformGeneric("generic", api.TransformGeneric{
+		Policy: api.PreserveOriginalKeys,
+		Rules:  []api.GenericTransformRule{{Input: "SrcAddr", Output: "Src"}},
+	})
+	generic.WithWorkers(4)
+	explode := generic.TransformExplode("explode", api.TransformExplode{Outputs: []api.ExplodeOutput{
+		{},
+		{When: "Copy", Set: []api.ExplodeField{{Output: "Src", Input: "Copy"}}},
+	}})
+	explode.WithWorkers(3)
+	cfg := builder.ToConfigFileStruct()
+	require.Equal(t, []int{4, 3}, []int{cfg.Pipeline[0].Workers, cfg.Pipeline[1].Workers})
+	cfg.Pipeline = append(cfg.Pipeline, config.Stage{Name: "writer", Follows: "explode"})
+	cfg.Parameters = append(cfg.Parameters, config.StageParam{Name: "writer", Write: &config.Write{Type: api.FakeType}})
+
+	in := make(chanIngester, 100)
+	p, err := newPipelineFromIngester(cfg, in)
+	require.NoError(t, err)
+
+	var expected []config.GenericMap
+	for i := 0; i < 100; i++ {
+		src := fmt.Sprintf("10.0.0.%d", i)
+		flow := config.GenericMap{"SrcAddr": src, "Seq": i}
+		expected = append(expected, config.GenericMap{"SrcAddr": src, "Src": src, "Seq": i})
+		if i%10 == 0 {
+			flow["Copy"] = "copy"
+			expected = append(expected, config.GenericMap{"SrcAddr": src, "Src": "copy", "Seq": i, "Copy": "copy"})
+			expected[len(expected)-2]["Copy"] = "copy"
+		}
+		in <- flow
+	}
+	close(in)
+	p.Run()
+
+	// the workers don't keep the flows in order
+	require.ElementsMatch(t, expected, p.pipelineEntryMap["writer"].Writer.(*write.Fake).AllRecords())
+	require.Equal(t, int64(100), p.pipelineEntryMap["generic"].stats.processed.Load())
+}
+
+func TestStageWorkers_Refused(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		param config.StageParam
+		err   string
+	}{{
+		name:  "dedupe",
+		param: config.NewTransformDedupeParams("dedupe", api.TransformDedupe{Keys: []string{"SrcAddr"}}),
+		err:   "stage dedupe: dedupe transform holds flows across records and can't run with several workers",
+	}, {
+		name:  "extract",
+		param: config.StageParam{Name: "extract", Extract: &config.Extract{Type: api.NoneType}},
+		err:   "stage extract: extract stages keep a state across records and can't run with several workers",
+	}, {
+		name:  "write",
+		param: config.StageParam{Name: "write", Write: &config.Write{Type: api.FakeType}},
+		err:   "stage write: workers are only supported by transform stages",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			builder := config.NewPresetIngesterPipeline()
+			cfg := builder.ToConfigFileStruct()
+			cfg.Pipeline = append(cfg.Pipeline, config.Stage{Name: tc.param.Name, Follows: config.PresetIngesterStage, Workers: 2})
+			cfg.Parameters = append(cfg.Parameters, tc.param)
+			if tc.param.Write == nil {
+				cfg.Pipeline = append(cfg.Pipeline, config.Stage{Name: "writer", Follows: tc.param.Name})
+				cfg.Parameters = append(cfg.Parameters, config.StageParam{Name: "writer", Write: &config.Write{Type: api.FakeType}})
+			}
+			_, err := newPipelineFromIngester(cfg, make(chanIngester))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
@@ -25,7 +25,8 @@ import (
 )
 
 type Writer interface {
-	Write(in config.GenericMap)
+	// Write writes the entry, returning an error when it could not be written
+	Write(in config.GenericMap) error
 }
 type None struct {
 	// synchronized access to avoid race conditions
@@ -34,11 +35,12 @@ type None struct {
 }
 
 // Write writes entries
-func (t *None) Write(in config.GenericMap) {
+func (t *None) Write(in config.GenericMap) error {
 	logrus.Debugf("entering Write none, in = %v", in)
 	t.mt.Lock()
 	t.prevRecords = append(t.prevRecords, in)
 	t.mt.Unlock()
+	return nil
 }
 
 func (t *None) PrevRecords() []config.GenericMap {
@@ -0,0 +1,391 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	putils "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const clickHouseTimeout = 30 * time.Second
+
+var (
+	chlog = logrus.WithField("component", "write.ClickHouse")
+
+	clickHouseDropped = operational.DefineMetric(
+		"clickhouse_dropped_flows_total",
+		"Number of flows dropped because the ClickHouse backlog is full or because ClickHouse rejected them",
+		operational.TypeCounter,
+		"stage",
+	)
+
+	// errRowsRejected is returned when the rows can't be appended to an insert: retrying would fail the same way
+	errRowsRejected = errors.New("rows rejected")
+)
+
+type clickHouseClient interface {
+	exec(ctx context.Context, query string) error
+	insert(ctx context.Context, query string, rows [][]any) error
+}
+
+type clickHouseConn struct {
+	conn driver.Conn
+}
+
+// writeClickHouse accumulates flows into batches, inserted by a single goroutine.
+// While ClickHouse is unavailable, up to maxBacklog batches wait to be retried; further batches are dropped.
+type writeClickHouse struct {
+	params         api.WriteClickHouse
+	client         clickHouseClient
+	createQuery    string
+	insertQuery    string
+	mutex          sync.Mutex
+	pending        [][]any
+	backlog        chan [][]any
+	tableReady     bool
+	exitChan       <-chan struct{}
+	closing        chan struct{}
+	stopped        chan struct{}
+	recordsWritten prometheus.Counter
+	dropped        prometheus.Counter
+}
+
+// Write converts a flow to a table row, and queues the current batch once it is complete
+func (w *writeClickHouse) Write(entry config.GenericMap) error {
+	row := make([]any, len(w.params.Columns))
+	for i, col := range w.params.Columns {
+		v, err := clickHouseValue(col.Type, entry[col.Name])
+		if err != nil {
+			return fmt.Errorf("can't convert field %s to %s: %w", col.Name, col.Type, err)
+		}
+		row[i] = v
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.pending = append(w.pending, row)
+	if len(w.pending) >= w.params.BatchSize {
+		w.enqueue()
+	}
+	return nil
+}
+
+// The mutex must be held when calling enqueue
+func (w *writeClickHouse) enqueue() {
+	select {
+	case w.backlog <- w.pending:
+	default:
+		chlog.Warnf("ClickHouse backlog is full, dropping %d flows", len(w.pending))
+		w.dropped.Add(float64(len(w.pending)))
+	}
+	w.pending = make([][]any, 0, w.params.BatchSize)
+}
+
+// Close inserts the current batch and the backlog, with a single attempt each, then closes the ClickHouse connection
+func (w *writeClickHouse) Close() error {
+	w.mutex.Lock()
+	if len(w.pending) > 0 {
+		w.enqueue()
+	}
+	close(w.closing)
+	w.mutex.Unlock()
+	<-w.stopped
+	if closer, ok := w.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (w *writeClickHouse) flushLoop() {
+	ticker := time.NewTicker(w.params.FlushInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			return
+		case <-ticker.C:
+			w.mutex.Lock()
+			if len(w.pending) > 0 {
+				w.enqueue()
+			}
+			w.mutex.Unlock()
+		}
+	}
+}
+
+func (w *writeClickHouse) sendLoop() {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			// the queued batches are sent once, without retrying
+			for {
+				select {
+				case rows := <-w.backlog:
+					w.send(rows)
+				default:
+					return
+				}
+			}
+		case rows := <-w.backlog:
+			w.send(rows)
+		}
+	}
+}
+
+// send inserts the rows, retrying with an exponential back-off until it succeeds or the rows are rejected
+func (w *writeClickHouse) send(rows [][]any) {
+	backoff := w.params.MinBackoff.Duration
+	for {
+		err := w.insert(rows)
+		if err == nil {
+			w.recordsWritten.Add(float64(len(rows)))
+			return
+		}
+		if errors.Is(err, errRowsRejected) {
+			chlog.WithError(err).Errorf("ClickHouse rejected %d flows, dropping them", len(rows))
+			w.dropped.Add(float64(len(rows)))
+			return
+		}
+		chlog.WithError(err).Warnf("can't insert %d flows into ClickHouse, retrying in %v", len(rows), backoff)
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			chlog.Warnf("ClickHouse writer closed, dropping %d flows", len(rows))
+			w.dropped.Add(float64(len(rows)))
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, w.params.MaxBackoff.Duration)
+	}
+}
+
+func (w *writeClickHouse) insert(rows [][]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), clickHouseTimeout)
+	defer cancel()
+	// the table is created before the first insert, so that ClickHouse doesn't need to be up when the pipeline starts
+	if !w.tableReady {
+		if err := w.client.exec(ctx, w.createQuery); err != nil {
+			return fmt.Errorf("can't create table: %w", err)
+		}
+		w.tableReady = true
+	}
+	return w.client.insert(ctx, w.insertQuery, rows)
+}
+
+func (c *clickHouseConn) exec(ctx context.Context, query string) error {
+	return c.conn.Exec(ctx, query)
+}
+
+func (c *clickHouseConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *clickHouseConn) insert(ctx context.Context, query string, rows [][]any) error {
+	batch, err := c.conn.PrepareBatch(ctx, query)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := batch.Append(row...); err != nil {
+			_ = batch.Abort()
+			return fmt.Errorf("%w: %w", errRowsRejected, err)
+		}
+	}
+	return batch.Send()
+}
+
+// clickHouseValue converts a flow field to the Go type expected by the column; missing fields get the zero value
+func clickHouseValue(t api.ClickHouseTypeEnum, v any) (any, error) {
+	switch t {
+	case api.ClickHouseUInt8, api.ClickHouseUInt16, api.ClickHouseUInt32, api.ClickHouseUInt64:
+		var n uint64
+		var err error
+		if v != nil {
+			n, err = putils.ConvertToUint64(v)
+		}
+		switch t {
+		case api.ClickHouseUInt8:
+			return uint8(n), err
+		case api.ClickHouseUInt16:
+			return uint16(n), err
+		case api.ClickHouseUInt32:
+			return uint32(n), err
+		}
+		return n, err
+	case api.ClickHouseInt64, api.ClickHouseDateTime, api.ClickHouseDateTime64:
+		var n int64
+		var err error
+		if v != nil {
+			n, err = putils.ConvertToInt64(v)
+		}
+		switch t {
+		case api.ClickHouseDateTime:
+			return time.Unix(n, 0), err
+		case api.ClickHouseDateTime64:
+			return time.UnixMilli(n), err
+		}
+		return n, err
+	case api.ClickHouseFloat64:
+		if v == nil {
+			return float64(0), nil
+		}
+		return putils.ConvertToFloat64(v)
+	case api.ClickHouseBool:
+		if v == nil {
+			return false, nil
+		}
+		return putils.ConvertToBool(v)
+	case api.ClickHouseIPv6:
+		var s string
+		if v != nil {
+			s = putils.ConvertToString(v)
+		}
+		if s == "" {
+			return netip.IPv6Unspecified(), nil
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		// IPv4 addresses are stored as IPv4-mapped IPv6 addresses
+		return netip.AddrFrom16(addr.As16()), nil
+	case api.ClickHouseString:
+		if v == nil {
+			return "", nil
+		}
+		return putils.ConvertToString(v), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", t)
+}
+
+func clickHouseQueries(params *api.WriteClickHouse) (create string, insert string) {
+	table := fmt.Sprintf("`%s`.`%s`", params.Database, params.Table)
+	var columns, definitions, orderBy []string
+	for _, col := range params.Columns {
+		columns = append(columns, "`"+col.Name+"`")
+		colType := string(col.Type)
+		switch col.Type {
+		case api.ClickHouseDateTime64:
+			colType = "DateTime64(3)"
+			orderBy = append(orderBy, "`"+col.Name+"`")
+		case api.ClickHouseDateTime:
+			orderBy = append(orderBy, "`"+col.Name+"`")
+		}
+		definitions = append(definitions, "`"+col.Name+"` "+colType)
+	}
+	// rows are sorted by time when there are timestamp columns
+	sortingKey := "tuple()"
+	if len(orderBy) > 0 {
+		sortingKey = "(" + strings.Join(orderBy, ", ") + ")"
+	}
+	create = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s) ENGINE = MergeTree ORDER BY %s",
+		table, strings.Join(definitions, ", "), sortingKey)
+	insert = fmt.Sprintf("INSERT INTO %s (%s)", table, strings.Join(columns, ", "))
+	return create, insert
+}
+
+func newClickHouseConn(params *api.WriteClickHouse) (*clickHouseConn, error) {
+	opts := clickhouse.Options{
+		Addr: params.Addresses,
+		Auth: clickhouse.Auth{
+			Database: params.Database,
+			Username: params.Username,
+		},
+		DialTimeout: clickHouseTimeout,
+	}
+	if params.PasswordPath != "" {
+		password, err := os.ReadFile(params.PasswordPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read password file: %w", err)
+		}
+		opts.Auth.Password = strings.TrimRight(string(password), "\r\n")
+	}
+	if params.TLS != nil {
+		tlsConfig, err := params.TLS.Build()
+		if err != nil {
+			return nil, err
+		}
+		opts.TLS = tlsConfig
+	}
+	// Open doesn't connect: connections are (re)established on use, so that the writer survives ClickHouse restarts
+	conn, err := clickhouse.Open(&opts)
+	if err != nil {
+		return nil, err
+	}
+	return &clickHouseConn{conn: conn}, nil
+}
+
+// NewWriteClickHouse creates a writer inserting the flows into a ClickHouse table
+func NewWriteClickHouse(opMetrics *operational.Metrics, params config.StageParam) (Writer, error) {
+	chlog.Debugf("entering NewWriteClickHouse")
+	configIn := api.WriteClickHouse{}
+	if params.Write != nil && params.Write.ClickHouse != nil {
+		configIn = *params.Write.ClickHouse
+	}
+	configIn.SetDefaults()
+	if err := configIn.Validate(); err != nil {
+		return nil, fmt.Errorf("the provided config is not valid: %w", err)
+	}
+	conn, err := newClickHouseConn(&configIn)
+	if err != nil {
+		return nil, err
+	}
+	return newWriteClickHouse(opMetrics, params.Name, &configIn, conn), nil
+}
+
+func newWriteClickHouse(opMetrics *operational.Metrics, stage string, params *api.WriteClickHouse, client clickHouseClient) *writeClickHouse {
+	createQuery, insertQuery := clickHouseQueries(params)
+	w := &writeClickHouse{
+		params:         *params,
+		client:         client,
+		createQuery:    createQuery,
+		insertQuery:    insertQuery,
+		pending:        make([][]any, 0, params.BatchSize),
+		backlog:        make(chan [][]any, params.MaxBacklog),
+		exitChan:       utils.ExitChannel(),
+		closing:        make(chan struct{}),
+		stopped:        make(chan struct{}),
+		recordsWritten: opMetrics.CreateRecordsWrittenCounter(stage),
+		dropped:        opMetrics.NewCounter(&clickHouseDropped, stage),
+	}
+	go w.flushLoop()
+	go w.sendLoop()
+	return w
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClickHouse struct {
+	sync.Mutex
+	failures int
+	queries  []string
+	rows     [][]any
+}
+
+func (f *fakeClickHouse) exec(_ context.Context, query string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.queries = append(f.queries, query)
+	return nil
+}
+
+func (f *fakeClickHouse) insert(_ context.Context, _ string, rows [][]any) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.failures != 0 {
+		f.failures--
+		return errors.New("connection refused")
+	}
+	f.rows = append(f.rows, rows...)
+	return nil
+}
+
+func (f *fakeClickHouse) inserted() [][]any {
+	f.Lock()
+	defer f.Unlock()
+	return f.rows
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := dto.Metric{}
+	require.NoError(t, c.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func testClickHouseParams(batchSize int) *api.WriteClickHouse {
+	params := api.WriteClickHouse{
+		Addresses:     []string{"clickhouse:9000"},
+		Columns:       []api.ClickHouseField{{Name: "SrcAddr", Type: api.ClickHouseIPv6}, {Name: "Bytes", Type: api.ClickHouseUInt64}},
+		BatchSize:     batchSize,
+		FlushInterval: &api.Duration{Duration: time.Hour},
+		MinBackoff:    &api.Duration{Duration: time.Millisecond},
+		MaxBackoff:    &api.Duration{Duration: 10 * time.Millisecond},
+	}
+	params.SetDefaults()
+	return &params
+}
+
+func TestClickHouseQueries(t *testing.T) {
+	params := api.WriteClickHouse{Addresses: []string{"clickhouse:9000"}}
+	params.SetDefaults()
+	require.NoError(t, params.Validate())
+	params.Columns = []api.ClickHouseField{
+		{Name: "TimeFlowEndMs", Type: api.ClickHouseDateTime64},
+		{Name: "SrcAddr", Type: api.ClickHouseIPv6},
+		{Name: "SrcPort", Type: api.ClickHouseUInt32},
+	}
+	create, insert := clickHouseQueries(&params)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS `default`.`flows` (`TimeFlowEndMs` DateTime64(3), `SrcAddr` IPv6, `SrcPort` UInt32) ENGINE = MergeTree ORDER BY (`TimeFlowEndMs`)", create)
+	assert.Equal(t, "INSERT INTO `default`.`flows` (`TimeFlowEndMs`, `SrcAddr`, `SrcPort`)", insert)
+
+	params.Columns = params.Columns[1:]
+	create, _ = clickHouseQueries(&params)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS `default`.`flows` (`SrcAddr` IPv6, `SrcPort` UInt32) ENGINE = MergeTree ORDER BY tuple()", create)
+
+	params.Table = "flows; DROP TABLE flows"
+	require.Error(t, params.Validate())
+}
+
+func TestClickHouseValue(t *testing.T) {
+	for _, tc := range []struct {
+		t        api.ClickHouseTypeEnum
+		in       any
+		expected any
+	}{
+		{t: api.ClickHouseUInt32, in: float64(8080), expected: uint32(8080)},
+		{t: api.ClickHouseUInt8, in: nil, expected: uint8(0)},
+		{t: api.ClickHouseUInt64, in: 1234, expected: uint64(1234)},
+		{t: api.ClickHouseIPv6, in: "10.0.0.1", expected: netip.MustParseAddr("::ffff:10.0.0.1")},
+		{t: api.ClickHouseIPv6, in: "fe80::1", expected: netip.MustParseAddr("fe80::1")},
+		{t: api.ClickHouseIPv6, in: nil, expected: netip.IPv6Unspecified()},
+		{t: api.ClickHouseDateTime, in: 1700000000, expected: time.Unix(1700000000, 0)},
+		{t: api.ClickHouseDateTime64, in: int64(1700000000123), expected: time.UnixMilli(1700000000123)},
+		{t: api.ClickHouseString, in: "ns", expected: "ns"},
+		{t: api.ClickHouseBool, in: true, expected: true},
+	} {
+		v, err := clickHouseValue(tc.t, tc.in)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, v, "%s %v", tc.t, tc.in)
+	}
+	_, err := clickHouseValue(api.ClickHouseIPv6, "not an IP")
+	require.Error(t, err)
+}
+
+func TestClickHouseWrite_RetryOnFailure(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	fake := &fakeClickHouse{failures: 2}
+	opMetrics := operational.NewMetrics(&config.MetricsSettings{})
+	w := newWriteClickHouse(opMetrics, "ch", testClickHouseParams(2), fake)
+
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.1", "Bytes": 10}))
+	require.Error(t, w.Write(config.GenericMap{"SrcAddr": "invalid"}))
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.2", "Bytes": 20}))
+
+	// the batch is complete: it's inserted after two failed attempts
+	require.Eventually(t, func() bool { return len(fake.inserted()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []any{netip.MustParseAddr("::ffff:10.0.0.2"), uint64(20)}, fake.inserted()[1])
+	assert.Len(t, fake.queries, 1, "table should be created once")
+	assert.Equal(t, float64(2), counterValue(t, w.recordsWritten))
+}
+
+func TestClickHouseWrite_FlushInterval(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	fake := &fakeClickHouse{}
+	params := testClickHouseParams(100)
+	params.FlushInterval.Duration = 10 * time.Millisecond
+	w := newWriteClickHouse(operational.NewMetrics(&config.MetricsSettings{}), "ch", params, fake)
+
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.1", "Bytes": 10}))
+	require.Eventually(t, func() bool { return len(fake.inserted()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestClickHouseWrite_BacklogFull(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	// ClickHouse is down: the first batch is being retried, the second one waits in the backlog
+	fake := &fakeClickHouse{failures: -1}
+	params := testClickHouseParams(1)
+	params.MaxBacklog = 1
+	w := newWriteClickHouse(operational.NewMetrics(&config.MetricsSettings{}), "ch", params, fake)
+
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.1"}))
+	require.Eventually(t, func() bool { return len(w.backlog) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.2"}))
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.3"}))
+	assert.Equal(t, float64(1), counterValue(t, w.dropped))
+	assert.Empty(t, fake.inserted())
+}
+
+func TestClickHouseWrite_Close(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	fake := &fakeClickHouse{}
+	w := newWriteClickHouse(operational.NewMetrics(&config.MetricsSettings{}), t.Name(), testClickHouseParams(100), fake)
+
+	// the pending flows are sent before the writer stops
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.1", "Bytes": 10}))
+	require.NoError(t, w.Close())
+	assert.Len(t, fake.inserted(), 1)
+
+	// while ClickHouse is down, the queued flows are dropped rather than retried
+	fake = &fakeClickHouse{failures: -1}
+	w = newWriteClickHouse(operational.NewMetrics(&config.MetricsSettings{}), t.Name()+"_down", testClickHouseParams(100), fake)
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.1", "Bytes": 10}))
+	require.NoError(t, w.Close())
+	assert.Empty(t, fake.inserted())
+	assert.Equal(t, float64(1), counterValue(t, w.dropped))
+}
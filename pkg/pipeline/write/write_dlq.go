@@ -0,0 +1,243 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/encode"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultDLQLength = 1000
+
+var (
+	dlog = logrus.WithField("component", "write.DeadLetterQueue")
+
+	dlqOverflow = operational.DefineMetric(
+		"dlq_overflow_total",
+		"Number of flows dropped because the dead-letter queue is full",
+		operational.TypeCounter,
+		"stage",
+	)
+)
+
+// deadLetterQueue wraps a writer: the flows that still fail after the configured retries are sent to a fallback target.
+// The target is written asynchronously, only once per flow, so that its own failures don't cascade to the pipeline.
+type deadLetterQueue struct {
+	writer   Writer
+	retries  int
+	queue    chan config.GenericMap
+	overflow prometheus.Counter
+	exitChan <-chan struct{}
+	closing  chan struct{}
+	stopped  chan struct{}
+}
+
+// Write writes the entry with the wrapped writer; on failure, the entry is queued for the dead-letter queue target.
+// The returned error is the one of the last attempt, unless the entry could be queued.
+func (d *deadLetterQueue) Write(in config.GenericMap) error {
+	var err error
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if err = d.writer.Write(in); err == nil {
+			return nil
+		}
+	}
+	if !d.enqueue(in, err) {
+		return fmt.Errorf("dead-letter queue is full: %w", err)
+	}
+	return nil
+}
+
+// Ready forwards the readiness of the wrapped writer
+func (d *deadLetterQueue) Ready() error {
+	if contributor, ok := d.writer.(operational.ReadinessContributor); ok {
+		return contributor.Ready()
+	}
+	return nil
+}
+
+// Close closes the wrapped writer, then stops the dead-letter queue once the queued flows are written to its target
+func (d *deadLetterQueue) Close() error {
+	// the wrapped writer may still report failures while it closes
+	var err error
+	if closer, ok := d.writer.(io.Closer); ok {
+		err = closer.Close()
+	}
+	close(d.closing)
+	<-d.stopped
+	return err
+}
+
+// enqueue sends a copy of the flow, with the failure reason, to the dead-letter queue. It returns false when the queue is full.
+func (d *deadLetterQueue) enqueue(in config.GenericMap, err error) bool {
+	out := in.Copy()
+	out[api.DLQReasonFieldName] = err.Error()
+	select {
+	case d.queue <- out:
+		return true
+	default:
+		d.overflow.Inc()
+		return false
+	}
+}
+
+// asyncWriter is implemented by the writers that send flows after Write returned, such as the loki writer:
+// the flows they fail to send are reported through the provided function.
+type asyncWriter interface {
+	setDeadLetter(func(config.GenericMap, error))
+}
+
+func (d *deadLetterQueue) run(target func(config.GenericMap) error, closer io.Closer) {
+	defer close(d.stopped)
+	defer func() {
+		if closer != nil {
+			_ = closer.Close()
+		}
+	}()
+	for {
+		select {
+		case <-d.exitChan:
+			return
+		case <-d.closing:
+			for {
+				select {
+				case entry := <-d.queue:
+					d.write(target, entry)
+				default:
+					return
+				}
+			}
+		case entry := <-d.queue:
+			d.write(target, entry)
+		}
+	}
+}
+
+func (d *deadLetterQueue) write(target func(config.GenericMap) error, entry config.GenericMap) {
+	if err := target(entry); err != nil {
+		dlog.WithError(err).Error("can't write into the dead-letter queue, dropping flow")
+	}
+}
+
+func newFileTarget(path string) (func(config.GenericMap) error, io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't open dead-letter queue file: %w", err)
+	}
+	return func(entry config.GenericMap) error {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(append(line, '\n'))
+		return err
+	}, file, nil
+}
+
+func newStdoutTarget() func(config.GenericMap) error {
+	return func(entry config.GenericMap) error {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(line))
+		return err
+	}
+}
+
+func newKafkaTarget(opMetrics *operational.Metrics, stage string, cfg *api.EncodeKafka) (func(config.GenericMap) error, error) {
+	encoder, err := encode.NewEncodeKafka(opMetrics, config.StageParam{
+		Name:   stage + "-dlq",
+		Encode: &config.Encode{Type: api.KafkaType, Kafka: cfg},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the kafka encoder logs its own errors
+	return func(entry config.GenericMap) error {
+		encoder.Encode(entry)
+		return nil
+	}, nil
+}
+
+// newDeadLetterQueue starts the dead-letter queue described by cfg
+func newDeadLetterQueue(opMetrics *operational.Metrics, stage string, cfg *api.DeadLetterQueue) (*deadLetterQueue, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid dead-letter queue config: %w", err)
+	}
+	var target func(config.GenericMap) error
+	var closer io.Closer
+	var err error
+	switch cfg.Type {
+	case api.DLQFile:
+		target, closer, err = newFileTarget(cfg.File.Path)
+	case api.DLQStdout:
+		target = newStdoutTarget()
+	case api.DLQKafka:
+		target, err = newKafkaTarget(opMetrics, stage, cfg.Kafka)
+	}
+	if err != nil {
+		return nil, err
+	}
+	length := cfg.QueueLength
+	if length == 0 {
+		length = defaultDLQLength
+	}
+	d := &deadLetterQueue{
+		retries:  cfg.Retries,
+		queue:    make(chan config.GenericMap, length),
+		overflow: opMetrics.NewCounter(&dlqOverflow, stage),
+		exitChan: utils.ExitChannel(),
+		closing:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go d.run(target, closer)
+	return d, nil
+}
+
+// WithDeadLetterQueue wraps the writer of the stage with the dead-letter queue described by cfg
+func WithDeadLetterQueue(opMetrics *operational.Metrics, stage string, writer Writer, cfg *api.DeadLetterQueue) (Writer, error) {
+	d, err := newDeadLetterQueue(opMetrics, stage, cfg)
+	if err != nil {
+		return nil, err
+	}
+	d.writer = writer
+	if async, ok := writer.(asyncWriter); ok {
+		async.setDeadLetter(func(flow config.GenericMap, err error) { d.enqueue(flow, err) })
+	}
+	return d, nil
+}
+
+// NewDeadLetter starts the dead-letter queue described by cfg for a stage other than a write one, and returns
+// the function sending it the flows that the stage failed to process, with the reason of the failure
+func NewDeadLetter(opMetrics *operational.Metrics, stage string, cfg *api.DeadLetterQueue) (func(config.GenericMap, error), error) {
+	d, err := newDeadLetterQueue(opMetrics, stage, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(flow config.GenericMap, err error) { d.enqueue(flow, err) }, nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// failingWriter fails the first `failures` writes
+type failingWriter struct {
+	failures int
+	calls    int
+	written  []config.GenericMap
+}
+
+func (w *failingWriter) Write(in config.GenericMap) error {
+	w.calls++
+	if w.calls <= w.failures {
+		return errors.New("connection refused")
+	}
+	w.written = append(w.written, in)
+	return nil
+}
+
+func TestDeadLetterQueue_File(t *testing.T) {
+	test.ResetPromRegistry()
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	path := filepath.Join(t.TempDir(), "dlq.json")
+	writer := &failingWriter{failures: 3}
+	dlq, err := WithDeadLetterQueue(operational.NewMetrics(&config.MetricsSettings{}), "write1", writer, &api.DeadLetterQueue{
+		Retries: 1,
+		Type:    api.DLQFile,
+		File:    &api.DeadLetterQueueFile{Path: path},
+	})
+	require.NoError(t, err)
+
+	// first flow fails twice and goes to the dead-letter queue
+	require.NoError(t, dlq.Write(config.GenericMap{"SrcAddr": "10.0.0.1"}))
+	require.Equal(t, 2, writer.calls)
+	// second flow fails once, then succeeds on retry
+	require.NoError(t, dlq.Write(config.GenericMap{"SrcAddr": "10.0.0.2"}))
+	require.Equal(t, 4, writer.calls)
+	require.Equal(t, []config.GenericMap{{"SrcAddr": "10.0.0.2"}}, writer.written)
+
+	var lines []string
+	require.Eventually(t, func() bool {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		lines = strings.Split(strings.TrimSpace(string(content)), "\n")
+		return len(lines) == 1 && lines[0] != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	var flow map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &flow))
+	require.Equal(t, map[string]interface{}{
+		"SrcAddr":     "10.0.0.1",
+		"_dlq_reason": "connection refused",
+	}, flow)
+}
+
+func TestDeadLetterQueue_Overflow(t *testing.T) {
+	test.ResetPromRegistry()
+	// no consumer is running, so the queue fills up
+	dlq := &deadLetterQueue{
+		writer:   &failingWriter{failures: 10},
+		queue:    make(chan config.GenericMap, 1),
+		overflow: operational.NewMetrics(&config.MetricsSettings{}).NewCounter(&dlqOverflow, "write1"),
+	}
+	require.NoError(t, dlq.Write(config.GenericMap{"SrcAddr": "10.0.0.1"}))
+	err := dlq.Write(config.GenericMap{"SrcAddr": "10.0.0.2"})
+	require.ErrorContains(t, err, "dead-letter queue is full")
+	require.Len(t, dlq.queue, 1)
+
+	exposed := test.ReadExposedMetrics(t, prometheus.DefaultGatherer)
+	require.Contains(t, exposed, `dlq_overflow_total{stage="write1"} 1`)
+}
+
+func TestDeadLetterQueue_InvalidConfig(t *testing.T) {
+	opMetrics := operational.NewMetrics(&config.MetricsSettings{})
+	for _, cfg := range []api.DeadLetterQueue{
+		{Type: "console"},
+		{Type: api.DLQFile},
+		{Type: api.DLQKafka},
+		{Type: api.DLQKafka, Kafka: &api.EncodeKafka{Compression: "brotli"}},
+		{Type: api.DLQFile, File: &api.DeadLetterQueueFile{Path: "dlq.json"}, Retries: -1},
+	} {
+		_, err := WithDeadLetterQueue(opMetrics, "write1", &None{}, &cfg)
+		require.Error(t, err)
+	}
+}
@@ -31,11 +31,12 @@ type Fake struct {
 }
 
 // Write stores in memory all records.
-func (w *Fake) Write(in config.GenericMap) {
+func (w *Fake) Write(in config.GenericMap) error {
 	logrus.Trace("entering writeFake Write")
 	w.mt.Lock()
 	w.allRecords = append(w.allRecords, in.Copy())
 	w.mt.Unlock()
+	return nil
 }
 
 func (w *Fake) AllRecords() []config.GenericMap {
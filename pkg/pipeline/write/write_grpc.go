@@ -19,7 +19,7 @@ type writeGRPC struct {
 }
 
 // Write writes a flow before being stored
-func (t *writeGRPC) Write(v config.GenericMap) {
+func (t *writeGRPC) Write(v config.GenericMap) error {
 	logrus.Tracef("entering writeGRPC Write %s", v)
 	value, _ := json.Marshal(v)
 	if _, err := t.clientConn.Client().Send(context.TODO(), &genericmap.Flow{
@@ -28,7 +28,14 @@ func (t *writeGRPC) Write(v config.GenericMap) {
 		},
 	}); err != nil {
 		logrus.Errorf("writeGRPC send error: %v", err)
+		return err
 	}
+	return nil
+}
+
+// Close closes the connection to the collector
+func (t *writeGRPC) Close() error {
+	return t.clientConn.Close()
 }
 
 // NewWriteGRPC create a new write
@@ -0,0 +1,307 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	influxapi "github.com/influxdata/influxdb-client-go/v2/api"
+	influxhttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	influxwrite "github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	putils "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const influxDBTimeout = 30 * time.Second
+
+var (
+	idblog = logrus.WithField("component", "write.InfluxDB")
+
+	influxDBDropped = operational.DefineMetric(
+		"influxdb_dropped_flows_total",
+		"Number of flows dropped because the InfluxDB backlog is full or because InfluxDB rejected them",
+		operational.TypeCounter,
+		"stage",
+	)
+)
+
+type influxDBClient interface {
+	writePoints(ctx context.Context, points []*influxwrite.Point) error
+}
+
+type influxDBWriteAPI struct {
+	client influxdb2.Client
+	api    influxapi.WriteAPIBlocking
+}
+
+// writeInfluxDB accumulates flows into batches of points, written by a single goroutine.
+// While InfluxDB is unavailable or throttling, up to maxBacklog batches wait to be retried; further batches are dropped.
+type writeInfluxDB struct {
+	params         api.WriteInfluxDB
+	client         influxDBClient
+	mutex          sync.Mutex
+	pending        []*influxwrite.Point
+	backlog        chan []*influxwrite.Point
+	exitChan       <-chan struct{}
+	closing        chan struct{}
+	stopped        chan struct{}
+	recordsWritten prometheus.Counter
+	dropped        prometheus.Counter
+}
+
+// Write converts a flow to a point, and queues the current batch once it is complete
+func (w *writeInfluxDB) Write(entry config.GenericMap) error {
+	point, err := w.point(entry)
+	if err != nil {
+		w.dropped.Inc()
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.pending = append(w.pending, point)
+	if len(w.pending) >= w.params.BatchSize {
+		w.enqueue()
+	}
+	return nil
+}
+
+// point maps the configured flow fields to the point tags and fields; missing or empty fields are skipped
+func (w *writeInfluxDB) point(entry config.GenericMap) (*influxwrite.Point, error) {
+	tags := map[string]string{}
+	for _, name := range w.params.Tags {
+		if v, ok := entry[name]; ok && v != nil {
+			if s := putils.ConvertToString(v); s != "" {
+				tags[name] = s
+			}
+		}
+	}
+	fields := map[string]any{}
+	for _, name := range w.params.Fields {
+		if v, ok := entry[name]; ok && v != nil {
+			fields[name] = v
+		}
+	}
+	if len(fields) == 0 {
+		// InfluxDB rejects points without any field
+		return nil, fmt.Errorf("flow has none of the fields %v", w.params.Fields)
+	}
+	ts := time.Now()
+	if v, ok := entry[w.params.TimestampField]; ok && v != nil {
+		ms, err := putils.ConvertToInt64(v)
+		if err != nil {
+			return nil, fmt.Errorf("can't convert timestamp field %s: %w", w.params.TimestampField, err)
+		}
+		ts = time.UnixMilli(ms)
+	}
+	return influxwrite.NewPoint(w.params.Measurement, tags, fields, ts), nil
+}
+
+// The mutex must be held when calling enqueue
+func (w *writeInfluxDB) enqueue() {
+	select {
+	case w.backlog <- w.pending:
+	default:
+		idblog.Warnf("InfluxDB backlog is full, dropping %d flows", len(w.pending))
+		w.dropped.Add(float64(len(w.pending)))
+	}
+	w.pending = make([]*influxwrite.Point, 0, w.params.BatchSize)
+}
+
+// Close writes the pending points and the queued batches, without backing off on failures, then releases the
+// InfluxDB client
+func (w *writeInfluxDB) Close() error {
+	w.mutex.Lock()
+	if len(w.pending) > 0 {
+		w.enqueue()
+	}
+	close(w.closing)
+	w.mutex.Unlock()
+	<-w.stopped
+	if closer, ok := w.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (w *writeInfluxDB) flushLoop() {
+	ticker := time.NewTicker(w.params.FlushInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			return
+		case <-ticker.C:
+			w.mutex.Lock()
+			if len(w.pending) > 0 {
+				w.enqueue()
+			}
+			w.mutex.Unlock()
+		}
+	}
+}
+
+func (w *writeInfluxDB) sendLoop() {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			// the queued batches are sent once, without retrying
+			for {
+				select {
+				case points := <-w.backlog:
+					w.send(points)
+				default:
+					return
+				}
+			}
+		case points := <-w.backlog:
+			w.send(points)
+		}
+	}
+}
+
+// send writes the points, retrying with an exponential back-off until it succeeds or the points are rejected.
+// When InfluxDB throttles the writes (HTTP 429), the Retry-After delay it returns takes precedence over the back-off.
+func (w *writeInfluxDB) send(points []*influxwrite.Point) {
+	backoff := w.params.MinBackoff.Duration
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), influxDBTimeout)
+		err := w.client.writePoints(ctx, points)
+		cancel()
+		if err == nil {
+			w.recordsWritten.Add(float64(len(points)))
+			return
+		}
+		delay := backoff
+		var httpErr *influxhttp.Error
+		if errors.As(err, &httpErr) {
+			if !influxDBRetryable(httpErr.StatusCode) {
+				idblog.WithError(err).Errorf("InfluxDB rejected %d flows, dropping them", len(points))
+				w.dropped.Add(float64(len(points)))
+				return
+			}
+			if httpErr.RetryAfter > 0 {
+				delay = time.Duration(httpErr.RetryAfter) * time.Second
+			}
+		}
+		idblog.WithError(err).Warnf("can't write %d flows to InfluxDB, retrying in %v", len(points), delay)
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			idblog.Warnf("InfluxDB writer closed, dropping %d flows", len(points))
+			w.dropped.Add(float64(len(points)))
+			return
+		case <-time.After(delay):
+		}
+		backoff = min(2*backoff, w.params.MaxBackoff.Duration)
+	}
+}
+
+// influxDBRetryable tells whether a write failing with this status code may succeed later.
+// Status 0 means that no response was received, e.g. on network errors.
+func influxDBRetryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+func (c *influxDBWriteAPI) writePoints(ctx context.Context, points []*influxwrite.Point) error {
+	return c.api.WritePoint(ctx, points...)
+}
+
+func (c *influxDBWriteAPI) Close() error {
+	c.client.Close()
+	return nil
+}
+
+func newInfluxDBWriteAPI(params *api.WriteInfluxDB) (*influxDBWriteAPI, error) {
+	var token string
+	if params.TokenPath != "" {
+		b, err := os.ReadFile(params.TokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read token file: %w", err)
+		}
+		token = strings.TrimRight(string(b), "\r\n")
+	}
+	opts := influxdb2.DefaultOptions().
+		SetHTTPRequestTimeout(uint(influxDBTimeout.Seconds())).
+		SetPrecision(time.Millisecond)
+	if params.TLS != nil {
+		tlsConfig, err := params.TLS.Build()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	// the client doesn't connect before the first write, so that InfluxDB doesn't need to be up when the pipeline starts
+	client := influxdb2.NewClientWithOptions(params.URL, token, opts)
+	// the blocking API is used without its implicit batching: batches and retries are managed by the writer
+	return &influxDBWriteAPI{client: client, api: client.WriteAPIBlocking(params.Org, params.Bucket)}, nil
+}
+
+// NewWriteInfluxDB creates a writer sending the flows to an InfluxDB 2.x bucket
+func NewWriteInfluxDB(opMetrics *operational.Metrics, params config.StageParam) (Writer, error) {
+	idblog.Debugf("entering NewWriteInfluxDB")
+	configIn := api.WriteInfluxDB{}
+	if params.Write != nil && params.Write.InfluxDB != nil {
+		configIn = *params.Write.InfluxDB
+	}
+	configIn.SetDefaults()
+	if err := configIn.Validate(); err != nil {
+		return nil, fmt.Errorf("the provided config is not valid: %w", err)
+	}
+	client, err := newInfluxDBWriteAPI(&configIn)
+	if err != nil {
+		return nil, err
+	}
+	return newWriteInfluxDB(opMetrics, params.Name, &configIn, client), nil
+}
+
+func newWriteInfluxDB(opMetrics *operational.Metrics, stage string, params *api.WriteInfluxDB, client influxDBClient) *writeInfluxDB {
+	w := &writeInfluxDB{
+		params:         *params,
+		client:         client,
+		pending:        make([]*influxwrite.Point, 0, params.BatchSize),
+		backlog:        make(chan []*influxwrite.Point, params.MaxBacklog),
+		exitChan:       utils.ExitChannel(),
+		closing:        make(chan struct{}),
+		stopped:        make(chan struct{}),
+		recordsWritten: opMetrics.CreateRecordsWrittenCounter(stage),
+		dropped:        opMetrics.NewCounter(&influxDBDropped, stage),
+	}
+	go w.flushLoop()
+	go w.sendLoop()
+	return w
+}
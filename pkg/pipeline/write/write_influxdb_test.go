@@ -0,0 +1,185 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	influxhttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	influxwrite "github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInfluxDB struct {
+	sync.Mutex
+	errs   []error
+	points []*influxwrite.Point
+}
+
+func (f *fakeInfluxDB) writePoints(_ context.Context, points []*influxwrite.Point) error {
+	f.Lock()
+	defer f.Unlock()
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.points = append(f.points, points...)
+	return nil
+}
+
+func (f *fakeInfluxDB) written() []*influxwrite.Point {
+	f.Lock()
+	defer f.Unlock()
+	return f.points
+}
+
+func testInfluxDBParams(batchSize int) *api.WriteInfluxDB {
+	params := api.WriteInfluxDB{
+		Org:           "netobserv",
+		Bucket:        "flows",
+		Tags:          []string{"SrcK8S_Namespace", "Proto"},
+		BatchSize:     batchSize,
+		FlushInterval: &api.Duration{Duration: time.Hour},
+		MinBackoff:    &api.Duration{Duration: time.Millisecond},
+		MaxBackoff:    &api.Duration{Duration: 10 * time.Millisecond},
+	}
+	params.SetDefaults()
+	return &params
+}
+
+func TestInfluxDBPoint(t *testing.T) {
+	params := testInfluxDBParams(1)
+	require.NoError(t, params.Validate())
+	w := &writeInfluxDB{params: *params}
+
+	point, err := w.point(config.GenericMap{"SrcK8S_Namespace": "ns", "Proto": 6, "Bytes": 100, "TimeFlowEndMs": int64(1700000000123), "DstPort": 443})
+	require.NoError(t, err)
+	assert.Equal(t, "flows,Proto=6,SrcK8S_Namespace=ns Bytes=100i 1700000000123000000\n", influxwrite.PointToLineProtocol(point, time.Nanosecond))
+
+	_, err = w.point(config.GenericMap{"SrcK8S_Namespace": "ns"})
+	require.Error(t, err, "a point without fields should be rejected")
+
+	params.Fields = []string{"Proto"}
+	require.Error(t, params.Validate(), "a flow field can't be both a tag and a field")
+}
+
+func TestInfluxDBWrite_RetryOnThrottling(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	fake := &fakeInfluxDB{errs: []error{
+		&influxhttp.Error{StatusCode: http.StatusTooManyRequests},
+		influxhttp.NewError(errors.New("connection refused")),
+	}}
+	w := newWriteInfluxDB(operational.NewMetrics(&config.MetricsSettings{}), "influx", testInfluxDBParams(2), fake)
+
+	require.NoError(t, w.Write(config.GenericMap{"Proto": 6, "Bytes": 10}))
+	require.NoError(t, w.Write(config.GenericMap{"Proto": 17, "Bytes": 20}))
+
+	// the batch is complete: it's written after a throttled attempt and a network error
+	require.Eventually(t, func() bool { return len(fake.written()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, float64(2), counterValue(t, w.recordsWritten))
+	assert.Equal(t, float64(0), counterValue(t, w.dropped))
+}
+
+func TestInfluxDBWrite_Rejected(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	fake := &fakeInfluxDB{errs: []error{&influxhttp.Error{StatusCode: http.StatusBadRequest, Code: "invalid", Message: "unable to parse"}}}
+	w := newWriteInfluxDB(operational.NewMetrics(&config.MetricsSettings{}), "influx", testInfluxDBParams(1), fake)
+
+	require.NoError(t, w.Write(config.GenericMap{"Bytes": 10}))
+	require.Eventually(t, func() bool { return counterValue(t, w.dropped) == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, w.Write(config.GenericMap{"Bytes": 20}))
+	require.Eventually(t, func() bool { return len(fake.written()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestInfluxDBWrite_BacklogFull(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	// InfluxDB is throttling: the first batch is being retried, the second one waits in the backlog
+	errs := make([]error, 1000)
+	for i := range errs {
+		errs[i] = &influxhttp.Error{StatusCode: http.StatusTooManyRequests}
+	}
+	fake := &fakeInfluxDB{errs: errs}
+	params := testInfluxDBParams(1)
+	params.MaxBacklog = 1
+	params.MinBackoff.Duration = time.Hour
+	params.MaxBackoff.Duration = time.Hour
+	w := newWriteInfluxDB(operational.NewMetrics(&config.MetricsSettings{}), "influx", params, fake)
+
+	require.NoError(t, w.Write(config.GenericMap{"Bytes": 1}))
+	require.Eventually(t, func() bool { return len(w.backlog) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, w.Write(config.GenericMap{"Bytes": 2}))
+	require.NoError(t, w.Write(config.GenericMap{"Bytes": 3}))
+	assert.Equal(t, float64(1), counterValue(t, w.dropped))
+	assert.Empty(t, fake.written())
+}
+
+func TestInfluxDBWrite_HTTP(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	var mutex sync.Mutex
+	var requests int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		if requests == 1 {
+			rw.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		assert.Equal(t, "/api/v2/write", r.URL.Path)
+		assert.Equal(t, "netobserv", r.URL.Query().Get("org"))
+		assert.Equal(t, "flows", r.URL.Query().Get("bucket"))
+		assert.Equal(t, "ms", r.URL.Query().Get("precision"))
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	params := testInfluxDBParams(2)
+	params.URL = server.URL
+	client, err := newInfluxDBWriteAPI(params)
+	require.NoError(t, err)
+	w := newWriteInfluxDB(operational.NewMetrics(&config.MetricsSettings{}), "influx", params, client)
+
+	require.NoError(t, w.Write(config.GenericMap{"Proto": 6, "Bytes": 10, "Packets": 1, "TimeFlowEndMs": 1700000000000}))
+	require.NoError(t, w.Write(config.GenericMap{"Proto": 17, "Bytes": 20, "Packets": 2, "TimeFlowEndMs": 1700000000001}))
+
+	require.Eventually(t, func() bool { return counterValue(t, w.recordsWritten) == 2 }, time.Second, 5*time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, "flows,Proto=6 Bytes=10i,Packets=1i 1700000000000\nflows,Proto=17 Bytes=20i,Packets=2i 1700000000001\n", body)
+}
@@ -504,20 +504,27 @@ func (t *writeIpfix) sendDataRecord(record config.GenericMap, v6 bool) error {
 	return nil
 }
 
+// Close closes the connection to the collector
+func (t *writeIpfix) Close() error {
+	t.exporter.CloseConnToCollector()
+	return nil
+}
+
 // Write writes a flow before being stored
-func (t *writeIpfix) Write(entry config.GenericMap) {
+func (t *writeIpfix) Write(entry config.GenericMap) error {
 	ilog.Tracef("entering writeIpfix Write")
 	if IPv6Type == entry["Etype"].(uint16) {
 		err := t.sendDataRecord(entry, true)
 		if err != nil {
 			ilog.WithError(err).Error("Failed in send v6 IPFIX record")
 		}
-	} else {
-		err := t.sendDataRecord(entry, false)
-		if err != nil {
-			ilog.WithError(err).Error("Failed in send v4 IPFIX record")
-		}
+		return err
+	}
+	err := t.sendDataRecord(entry, false)
+	if err != nil {
+		ilog.WithError(err).Error("Failed in send v4 IPFIX record")
 	}
+	return err
 }
 
 // NewWriteIpfix creates a new write
@@ -29,11 +29,11 @@ import (
 	pUtils "github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
 
-	logAdapter "github.com/go-kit/kit/log/logrus"
 	jsonIter "github.com/json-iterator/go"
 	"github.com/netobserv/loki-client-go/loki"
 	"github.com/netobserv/loki-client-go/pkg/backoff"
 	"github.com/netobserv/loki-client-go/pkg/urlutil"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/sirupsen/logrus"
 )
@@ -46,8 +46,30 @@ var (
 
 var log = logrus.WithField("component", "write.Loki")
 
+var (
+	lokiOversizedEntries = operational.DefineMetric(
+		"loki_oversized_entries_total",
+		"Number of flows dropped because their Loki entry exceeds maxBatchSizeBytes",
+		operational.TypeCounter,
+		"stage",
+	)
+	lokiRetries = operational.DefineMetric(
+		"loki_retries_total",
+		"Number of retries of Loki push requests",
+		operational.TypeCounter,
+		"stage",
+	)
+	lokiDroppedEntries = operational.DefineMetric(
+		"loki_dropped_entries_total",
+		"Number of Loki entries dropped because their push request failed after the configured retries",
+		operational.TypeCounter,
+		"stage",
+	)
+)
+
 type emitter interface {
-	Handle(labels model.LabelSet, timestamp time.Time, record string) error
+	Handle(labels, metadata model.LabelSet, timestamp time.Time, record string) error
+	Stop()
 }
 
 // Loki record writer
@@ -60,6 +82,8 @@ type Loki struct {
 	timeNow        func() time.Time
 	exitChan       <-chan struct{}
 	metrics        *metrics
+	oversized      prometheus.Counter
+	deadLetter     func(config.GenericMap, error)
 }
 
 func buildLokiConfig(c *api.WriteLoki) (loki.Config, error) {
@@ -116,10 +140,12 @@ func (l *Loki) ProcessRecord(in config.GenericMap) error {
 		labels[k] = v
 	}
 	l.addLabels(in, labels)
+	metadata := l.structuredMetadata(in)
 
-	// Remove labels and configured ignore list from record
+	// Remove labels, structured metadata and configured ignore list from record
 	ignoreList := l.apiConfig.IgnoreList
 	ignoreList = append(ignoreList, l.apiConfig.Labels...)
+	ignoreList = append(ignoreList, l.apiConfig.StructuredMetadata...)
 	for _, label := range ignoreList {
 		delete(out, label)
 	}
@@ -130,13 +156,58 @@ func (l *Loki) ProcessRecord(in config.GenericMap) error {
 	}
 
 	timestamp := l.extractTimestamp(out)
-	err = l.client.Handle(labels, timestamp, string(js))
+	if l.apiConfig.MaxBatchSizeBytes > 0 {
+		if size := lokiStreamSize(labels.String()) + lokiEntrySize(string(js), metadata); size > l.apiConfig.MaxBatchSizeBytes {
+			log.WithFields(logrus.Fields{"size": size, "maxBatchSizeBytes": l.apiConfig.MaxBatchSizeBytes}).
+				Warn("Loki entry exceeds maxBatchSizeBytes. Dropping it")
+			l.oversized.Inc()
+			return nil
+		}
+	}
+	err = l.client.Handle(labels, metadata, timestamp, string(js))
 	if err == nil {
 		l.metrics.recordsWritten.Inc()
 	}
 	return err
 }
 
+// setDeadLetter sends the entries of the batches that can't be pushed to the dead-letter queue of the stage
+// Ready fails while the pushes to Loki fail and are retried: a stalled Loki makes the pipeline unready, rather than
+// getting it restarted
+func (l *Loki) Ready() error {
+	if contributor, ok := l.client.(operational.ReadinessContributor); ok {
+		return contributor.Ready()
+	}
+	return nil
+}
+
+func (l *Loki) setDeadLetter(deadLetter func(config.GenericMap, error)) {
+	l.deadLetter = deadLetter
+}
+
+// onPushFailure rebuilds the flows from the entries of a failed batch, the label and metadata fields being restored
+func (l *Loki) onPushFailure(entries []lokiEntry, err error) {
+	if l.deadLetter == nil {
+		return
+	}
+	for i := range entries {
+		flow := config.GenericMap{}
+		if jsonErr := jsonEncodingConfig.UnmarshalFromString(entries[i].line, &flow); jsonErr != nil {
+			log.WithError(jsonErr).Warn("can't decode Loki entry for the dead-letter queue")
+			continue
+		}
+		for k, v := range entries[i].labels {
+			if _, ok := flow[string(k)]; !ok {
+				flow[string(k)] = string(v)
+			}
+		}
+		for k, v := range entries[i].metadata {
+			flow[string(k)] = string(v)
+		}
+		l.deadLetter(flow, err)
+	}
+}
+
 func (l *Loki) extractTimestamp(record map[string]interface{}) time.Time {
 	if l.apiConfig.TimestampLabel == "" {
 		return l.timeNow()
@@ -184,6 +255,22 @@ func (l *Loki) addLabels(record config.GenericMap, labels model.LabelSet) {
 	}
 }
 
+// structuredMetadata returns the configured structured metadata fields of the record, or nil when there are none
+func (l *Loki) structuredMetadata(record config.GenericMap) model.LabelSet {
+	var metadata model.LabelSet
+	for _, field := range l.apiConfig.StructuredMetadata {
+		val, ok := record[field]
+		if !ok {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(model.LabelSet, len(l.apiConfig.StructuredMetadata))
+		}
+		metadata[model.LabelName(field)] = model.LabelValue(utils.ConvertToString(val))
+	}
+	return metadata
+}
+
 func getFloat64(timestamp interface{}) (ft float64, ok bool) {
 	switch i := timestamp.(type) {
 	case float64:
@@ -206,13 +293,20 @@ func getFloat64(timestamp interface{}) (ft float64, ok bool) {
 	}
 }
 
+// Close sends the pending batch and stops the client
+func (l *Loki) Close() error {
+	l.client.Stop()
+	return nil
+}
+
 // Write writes a flow before being stored
-func (l *Loki) Write(entry config.GenericMap) {
+func (l *Loki) Write(entry config.GenericMap) error {
 	log.Tracef("writing entry: %#v", entry)
 	err := l.ProcessRecord(entry)
 	if err != nil {
 		log.WithError(err).Warn("can't write into loki")
 	}
+	return err
 }
 
 // NewWriteLoki creates a Loki writer from configuration
@@ -233,11 +327,6 @@ func NewWriteLoki(opMetrics *operational.Metrics, params config.StageParam) (*Lo
 	if buildconfigErr != nil {
 		return nil, buildconfigErr
 	}
-	client, newWithLoggerErr := loki.NewWithLogger(lokiConfig, logAdapter.NewLogger(log.WithField("module", "export/loki")))
-	if newWithLoggerErr != nil {
-		return nil, newWithLoggerErr
-	}
-
 	timestampScale, err := time.ParseDuration(lokiConfigIn.TimestampScale)
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse TimestampScale: %w", err)
@@ -260,11 +349,17 @@ func NewWriteLoki(opMetrics *operational.Metrics, params config.StageParam) (*Lo
 		apiConfig:      lokiConfigIn,
 		timestampScale: float64(timestampScale),
 		saneLabels:     saneLabels,
-		client:         client,
 		timeNow:        time.Now,
 		exitChan:       pUtils.ExitChannel(),
 		metrics:        newMetrics(opMetrics, params.Name),
+		oversized:      opMetrics.NewCounter(&lokiOversizedEntries, params.Name),
+	}
+	client, err := newLokiClient(lokiConfig, lokiConfigIn.MaxBatchSizeBytes,
+		opMetrics.NewCounter(&lokiRetries, params.Name), opMetrics.NewCounter(&lokiDroppedEntries, params.Name), l.onPushFailure)
+	if err != nil {
+		return nil, err
 	}
+	l.client = client
 
 	return l, nil
 }
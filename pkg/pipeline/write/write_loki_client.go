@@ -0,0 +1,303 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/netobserv/loki-client-go/loki"
+	"github.com/netobserv/loki-client-go/pkg/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	promConfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// estimated protobuf overhead of a push request: timestamp and framing of each entry, framing of each stream
+	lokiEntryOverhead    = 16
+	lokiStreamOverhead   = 8
+	lokiMetadataOverhead = 6
+	// maximum length of the Loki error message read from a response
+	lokiMaxErrMsgLen = 1024
+)
+
+type lokiEntry struct {
+	labels    model.LabelSet
+	stream    string
+	timestamp time.Time
+	line      string
+	// metadata is sent as structured metadata, which Loki stores along with the line without indexing it
+	metadata model.LabelSet
+}
+
+// lokiBatch holds the entries of the next push request, grouped by stream
+type lokiBatch struct {
+	streams   map[string][]*lokiEntry
+	entries   []lokiEntry
+	lineBytes int
+	pushBytes int
+	createdAt time.Time
+}
+
+// lokiClient batches the entries and pushes them to Loki. It replaces the loki-client-go client, which doesn't
+// report the batches it fails to send.
+type lokiClient struct {
+	cfg       loki.Config
+	maxBytes  int
+	client    *http.Client
+	entries   chan lokiEntry
+	quit      chan struct{}
+	once      sync.Once
+	wg        sync.WaitGroup
+	retries   prometheus.Counter
+	dropped   prometheus.Counter
+	onFailure func(entries []lokiEntry, err error)
+	waitCheck time.Duration
+	// pushErr is the error of the last push when it can be retried, i.e. while Loki is unreachable or overloaded
+	pushErr atomic.Pointer[error]
+}
+
+func lokiStreamSize(stream string) int {
+	return len(stream) + lokiStreamOverhead
+}
+
+func lokiEntrySize(line string, metadata model.LabelSet) int {
+	size := len(line) + lokiEntryOverhead
+	for k, v := range metadata {
+		size += len(k) + len(v) + lokiMetadataOverhead
+	}
+	return size
+}
+
+func newLokiBatch() *lokiBatch {
+	return &lokiBatch{streams: map[string][]*lokiEntry{}, createdAt: time.Now()}
+}
+
+// sizesAfter returns the size of the lines and the estimated size of the push request once the entry is added
+func (b *lokiBatch) sizesAfter(e *lokiEntry) (lineBytes, pushBytes int) {
+	pushBytes = b.pushBytes + lokiEntrySize(e.line, e.metadata)
+	if _, ok := b.streams[e.stream]; !ok {
+		pushBytes += lokiStreamSize(e.stream)
+	}
+	return b.lineBytes + len(e.line), pushBytes
+}
+
+func (b *lokiBatch) add(e lokiEntry) {
+	b.lineBytes, b.pushBytes = b.sizesAfter(&e)
+	b.entries = append(b.entries, e)
+	b.streams[e.stream] = append(b.streams[e.stream], &e)
+}
+
+// encode builds the snappy-compressed protobuf push request. It is encoded here rather than with the logproto
+// package, whose entries don't have the structured metadata field introduced with Loki 3:
+//
+//	PushRequest { repeated Stream streams = 1; }
+//	Stream { string labels = 1; repeated Entry entries = 2; }
+//	Entry { Timestamp timestamp = 1; string line = 2; repeated LabelPair structuredMetadata = 3; }
+//	LabelPair { string name = 1; string value = 2; }
+func (b *lokiBatch) encode() []byte {
+	var req []byte
+	for labels, entries := range b.streams {
+		stream := protowire.AppendTag(nil, 1, protowire.BytesType)
+		stream = protowire.AppendString(stream, labels)
+		for _, e := range entries {
+			stream = protowire.AppendTag(stream, 2, protowire.BytesType)
+			stream = protowire.AppendBytes(stream, encodeLokiEntry(e))
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, stream)
+	}
+	return snappy.Encode(nil, req)
+}
+
+func encodeLokiEntry(e *lokiEntry) []byte {
+	var ts []byte
+	if seconds := e.timestamp.Unix(); seconds != 0 {
+		ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(seconds))
+	}
+	if nanos := e.timestamp.Nanosecond(); nanos != 0 {
+		ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(nanos))
+	}
+	buf := protowire.AppendTag(nil, 1, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, ts)
+	if e.line != "" {
+		buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+		buf = protowire.AppendString(buf, e.line)
+	}
+	// metadata is sorted for a deterministic encoding
+	names := make([]string, 0, len(e.metadata))
+	for name := range e.metadata {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pair := protowire.AppendTag(nil, 1, protowire.BytesType)
+		pair = protowire.AppendString(pair, name)
+		pair = protowire.AppendTag(pair, 2, protowire.BytesType)
+		pair = protowire.AppendString(pair, string(e.metadata[model.LabelName(name)]))
+		buf = protowire.AppendTag(buf, 3, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, pair)
+	}
+	return buf
+}
+
+func newLokiClient(cfg loki.Config, maxBytes int, retries, dropped prometheus.Counter, onFailure func([]lokiEntry, error)) (*lokiClient, error) {
+	if err := cfg.Client.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := promConfig.NewClientFromConfig(cfg.Client, "flowlogs-pipeline", promConfig.WithKeepAlivesDisabled(), promConfig.WithHTTP2Disabled())
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = cfg.Timeout
+	c := &lokiClient{
+		cfg:       cfg,
+		maxBytes:  maxBytes,
+		client:    client,
+		entries:   make(chan lokiEntry),
+		quit:      make(chan struct{}),
+		retries:   retries,
+		dropped:   dropped,
+		onFailure: onFailure,
+		// batches are checked 10 times per batchWait, but not more often than every 10ms
+		waitCheck: max(cfg.BatchWait/10, 10*time.Millisecond),
+	}
+	c.wg.Add(1)
+	go c.run()
+	return c, nil
+}
+
+// Handle queues an entry for the next batch; the batch is sent asynchronously
+func (c *lokiClient) Handle(labels, metadata model.LabelSet, timestamp time.Time, line string) error {
+	c.entries <- lokiEntry{labels: labels, stream: labels.String(), timestamp: timestamp, line: line, metadata: metadata}
+	return nil
+}
+
+// Stop sends the pending batch and stops the client
+func (c *lokiClient) Stop() {
+	c.once.Do(func() { close(c.quit) })
+	c.wg.Wait()
+}
+
+func (c *lokiClient) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.waitCheck)
+	defer ticker.Stop()
+	var batch *lokiBatch
+	for {
+		select {
+		case <-c.quit:
+			if batch != nil {
+				c.send(batch)
+			}
+			return
+		case e := <-c.entries:
+			if batch == nil {
+				batch = newLokiBatch()
+			} else if lineBytes, pushBytes := batch.sizesAfter(&e); lineBytes > c.cfg.BatchSize || (c.maxBytes > 0 && pushBytes > c.maxBytes) {
+				// the batch is sent before the entry makes it exceed the limits
+				c.send(batch)
+				batch = newLokiBatch()
+			}
+			batch.add(e)
+		case <-ticker.C:
+			if batch != nil && time.Since(batch.createdAt) >= c.cfg.BatchWait {
+				c.send(batch)
+				batch = nil
+			}
+		}
+	}
+}
+
+// send pushes the batch, retrying with an exponential back-off and jitter on 429, 5xx and connection errors.
+// Once the retries are exhausted, or on any other error, the entries are dropped and reported to onFailure.
+func (c *lokiClient) send(batch *lokiBatch) {
+	buf := batch.encode()
+	var err error
+	bo := backoff.New(context.Background(), c.cfg.BackoffConfig)
+	for bo.Ongoing() {
+		if bo.NumRetries() > 0 {
+			c.retries.Inc()
+		}
+		var status int
+		if status, err = c.push(buf); err == nil {
+			c.pushErr.Store(nil)
+			return
+		}
+		if status > 0 && status != http.StatusTooManyRequests && status/100 != 5 {
+			break
+		}
+		c.pushErr.Store(&err)
+		log.WithError(err).WithField("status", status).Warn("can't send batch to Loki, will retry")
+		bo.Wait()
+	}
+	log.WithError(err).Errorf("can't send batch to Loki, dropping %d entries", len(batch.entries))
+	c.dropped.Add(float64(len(batch.entries)))
+	if c.onFailure != nil {
+		c.onFailure(batch.entries, err)
+	}
+}
+
+// Ready fails while the pushes to Loki fail with errors that are retried
+func (c *lokiClient) Ready() error {
+	if err := c.pushErr.Load(); err != nil {
+		return fmt.Errorf("can't push to Loki: %w", *err)
+	}
+	return nil
+}
+
+func (c *lokiClient) push(buf []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL.String(), bytes.NewReader(buf))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", loki.UserAgent)
+	if c.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.cfg.TenantID)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		scanner := bufio.NewScanner(io.LimitReader(resp.Body, lokiMaxErrMsgLen))
+		line := ""
+		if scanner.Scan() {
+			line = scanner.Text()
+		}
+		return resp.StatusCode, fmt.Errorf("server returned HTTP status %s: %s", resp.Status, line)
+	}
+	return resp.StatusCode, nil
+}
@@ -20,21 +20,31 @@ package write
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/rand"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/golang/snappy"
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
 	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/netobserv/loki-client-go/pkg/logproto"
 	"github.com/prometheus/common/model"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 const timeout = 5 * time.Second
@@ -43,7 +53,7 @@ type fakeEmitter struct {
 	mock.Mock
 }
 
-func (f *fakeEmitter) Handle(labels model.LabelSet, timestamp time.Time, record string) error {
+func (f *fakeEmitter) Handle(labels, metadata model.LabelSet, timestamp time.Time, record string) error {
 	// sort alphabetically records just for simplifying testing verification with JSON strings
 	recordMap := map[string]interface{}{}
 	if err := json.Unmarshal([]byte(record), &recordMap); err != nil {
@@ -53,10 +63,14 @@ func (f *fakeEmitter) Handle(labels model.LabelSet, timestamp time.Time, record
 	if err != nil {
 		panic("error unmarshaling: " + err.Error())
 	}
-	a := f.Mock.Called(labels, timestamp, string(recordBytes))
+	a := f.Mock.Called(labels, metadata, timestamp, string(recordBytes))
 	return a.Error(0)
 }
 
+func (f *fakeEmitter) Stop() {
+	f.Mock.Called()
+}
+
 func Test_buildLokiConfig(t *testing.T) {
 	var yamlConfig = `
 log-level: debug
@@ -122,7 +136,7 @@ parameters:
 	require.NoError(t, err)
 
 	fe := fakeEmitter{}
-	fe.On("Handle", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	fe.On("Handle", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	loki.client = &fe
 
 	// WHEN it processes input records
@@ -136,13 +150,114 @@ parameters:
 		"bar":    "barLabel",
 		"foo":    "fooLabel",
 		"static": "label",
-	}, time.Unix(123456, 0), `{"ts":123456,"value":1234}`)
+	}, mock.Anything, time.Unix(123456, 0), `{"ts":123456,"value":1234}`)
 
 	fe.AssertCalled(t, "Handle", model.LabelSet{
 		"bar":    "barLabel2",
 		"foo":    "fooLabel2",
 		"static": "label",
-	}, time.Unix(124567, 0), `{"other":"val","ts":124567,"value":5678}`)
+	}, mock.Anything, time.Unix(124567, 0), `{"other":"val","ts":124567,"value":5678}`)
+}
+
+func TestStructuredMetadata(t *testing.T) {
+	var yamlConfig = `
+log-level: debug
+pipeline:
+  - name: write1
+parameters:
+  - name: write1
+    write:
+      type: loki
+      loki:
+        url: http://loki:3100/
+        timestampLabel: ts
+        labels:
+          - foo
+        structuredMetadata:
+          - PodUID
+          - ConnID
+`
+	_, cfg := test.InitConfig(t, yamlConfig)
+	loki, err := NewWriteLoki(operational.NewMetrics(&config.MetricsSettings{}), cfg.Parameters[0])
+	require.NoError(t, err)
+
+	fe := fakeEmitter{}
+	fe.On("Handle", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	loki.client = &fe
+
+	require.NoError(t, loki.ProcessRecord(map[string]interface{}{
+		"ts": 123456, "foo": "fooLabel", "PodUID": "a1b2", "ConnID": 42, "value": 1234}))
+	require.NoError(t, loki.ProcessRecord(map[string]interface{}{"ts": 124567, "foo": "fooLabel", "value": 5678}))
+
+	// the metadata fields are neither labels nor part of the line
+	fe.AssertCalled(t, "Handle", model.LabelSet{"foo": "fooLabel"}, model.LabelSet{"PodUID": "a1b2", "ConnID": "42"},
+		time.Unix(123456, 0), `{"ts":123456,"value":1234}`)
+	fe.AssertCalled(t, "Handle", model.LabelSet{"foo": "fooLabel"}, model.LabelSet(nil),
+		time.Unix(124567, 0), `{"ts":124567,"value":5678}`)
+}
+
+func TestStructuredMetadata_InvalidConfig(t *testing.T) {
+	for _, metadata := range [][]string{{"pod.uid"}, {"1st"}, {"foo"}} {
+		cfg := api.WriteLoki{URL: "http://loki:3100/", Labels: []string{"foo"}, StructuredMetadata: metadata}
+		cfg.SetDefaults()
+		require.Error(t, cfg.Validate(), "%v", metadata)
+	}
+}
+
+// decodeStructuredMetadata returns the structured metadata of each entry of a protobuf push request
+func decodeStructuredMetadata(t *testing.T, buf []byte) []map[string]string {
+	var all []map[string]string
+	forEachField(t, buf, 1, func(stream []byte) {
+		forEachField(t, stream, 2, func(entry []byte) {
+			metadata := map[string]string{}
+			forEachField(t, entry, 3, func(pair []byte) {
+				var name, value string
+				forEachField(t, pair, 1, func(b []byte) { name = string(b) })
+				forEachField(t, pair, 2, func(b []byte) { value = string(b) })
+				metadata[name] = value
+			})
+			all = append(all, metadata)
+		})
+	})
+	return all
+}
+
+func forEachField(t *testing.T, buf []byte, field protowire.Number, fn func([]byte)) {
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		require.GreaterOrEqual(t, n, 0)
+		buf = buf[n:]
+		if num == field && typ == protowire.BytesType {
+			v, m := protowire.ConsumeBytes(buf)
+			require.GreaterOrEqual(t, m, 0)
+			fn(v)
+		}
+		n = protowire.ConsumeFieldValue(num, typ, buf)
+		require.GreaterOrEqual(t, n, 0)
+		buf = buf[n:]
+	}
+}
+
+func TestStructuredMetadata_Encoding(t *testing.T) {
+	batch := newLokiBatch()
+	labels := model.LabelSet{"foo": "bar"}
+	batch.add(lokiEntry{labels: labels, stream: labels.String(), timestamp: time.Unix(123456, 789), line: `{"value":1}`,
+		metadata: model.LabelSet{"PodUID": "a1b2", "ConnID": "42"}})
+	batch.add(lokiEntry{labels: labels, stream: labels.String(), timestamp: time.Unix(123457, 0), line: `{"value":2}`})
+
+	decoded, err := snappy.Decode(nil, batch.encode())
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"PodUID": "a1b2", "ConnID": "42"}, {}}, decodeStructuredMetadata(t, decoded))
+
+	// the encoding stays compatible with the push requests of earlier Loki versions
+	pr := logproto.PushRequest{}
+	require.NoError(t, pr.Unmarshal(decoded))
+	require.Len(t, pr.Streams, 1)
+	assert.Equal(t, `{foo="bar"}`, pr.Streams[0].Labels)
+	assert.Equal(t, []logproto.Entry{
+		{Timestamp: time.Unix(123456, 789).UTC(), Line: `{"value":1}`},
+		{Timestamp: time.Unix(123457, 0).UTC(), Line: `{"value":2}`},
+	}, pr.Streams[0].Entries)
 }
 
 func TestTimestampScale(t *testing.T) {
@@ -176,11 +291,11 @@ parameters:
 			require.NoError(t, err)
 
 			fe := fakeEmitter{}
-			fe.On("Handle", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			fe.On("Handle", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 			loki.client = &fe
 
 			require.NoError(t, loki.ProcessRecord(map[string]interface{}{"TimeReceived": 123456789}))
-			fe.AssertCalled(t, "Handle", model.LabelSet{},
+			fe.AssertCalled(t, "Handle", model.LabelSet{}, mock.Anything,
 				testCase.expected, `{"TimeReceived":123456789}`)
 		})
 	}
@@ -219,7 +334,7 @@ func TestTimestampExtraction_LocalTime(t *testing.T) {
 			loki.apiConfig.TimestampLabel = testCase.tsLabel
 
 			fe := fakeEmitter{}
-			fe.On("Handle", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			fe.On("Handle", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 			loki.client = &fe
 
 			loki.timeNow = func() time.Time {
@@ -227,7 +342,7 @@ func TestTimestampExtraction_LocalTime(t *testing.T) {
 			}
 			jsonInput, _ := json.Marshal(testCase.input)
 			require.NoError(t, loki.ProcessRecord(testCase.input))
-			fe.AssertCalled(t, "Handle", model.LabelSet{},
+			fe.AssertCalled(t, "Handle", model.LabelSet{}, mock.Anything,
 				time.Unix(12345678, 0), string(jsonInput))
 		})
 	}
@@ -259,7 +374,7 @@ parameters:
 	require.NoError(t, err)
 
 	fe := fakeEmitter{}
-	fe.On("Handle", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	fe.On("Handle", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	loki.client = &fe
 
 	require.NoError(t, loki.ProcessRecord(map[string]interface{}{
@@ -269,7 +384,155 @@ parameters:
 		"ba_r": "isBar",
 		"fo_o": "isFoo",
 		"ba_z": "isBaz",
-	}, mock.Anything, mock.Anything)
+	}, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// fakeLokiPushes records the number of entries of each push request, answering with the given status
+func fakeLokiPushes(t *testing.T, status int) (*httptest.Server, func() []int) {
+	var mutex sync.Mutex
+	var pushes []int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		pr := logproto.PushRequest{}
+		require.NoError(t, pr.Unmarshal(decoded))
+		entries := 0
+		for i := range pr.Streams {
+			entries += len(pr.Streams[i].Entries)
+		}
+		mutex.Lock()
+		pushes = append(pushes, entries)
+		mutex.Unlock()
+		rw.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return pushes
+	}
+}
+
+func TestMaxBatchSizeBytes(t *testing.T) {
+	server, pushes := fakeLokiPushes(t, http.StatusNoContent)
+	// the budget fits two entries: the stream {foo="bar"} is accounted once per push request
+	line := `{"ts":1,"value":"` + strings.Repeat("x", 40) + `"}`
+	maxBytes := lokiStreamSize(`{foo="bar"}`) + 2*lokiEntrySize(line, nil)
+	var yamlConfig = fmt.Sprintf(`
+log-level: debug
+pipeline:
+  - name: write1
+parameters:
+  - name: write1
+    write:
+      type: loki
+      loki:
+        url: %s
+        batchWait: 1h
+        timestampLabel: ts
+        maxBatchSizeBytes: %d
+        labels:
+          - foo
+`, server.URL, maxBytes)
+	_, cfg := test.InitConfig(t, yamlConfig)
+	loki, err := NewWriteLoki(operational.NewMetrics(&config.MetricsSettings{}), cfg.Parameters[0])
+	require.NoError(t, err)
+
+	entry := config.GenericMap{"ts": 1, "foo": "bar", "value": strings.Repeat("x", 40)}
+	require.NoError(t, loki.ProcessRecord(entry))
+	require.NoError(t, loki.ProcessRecord(entry))
+	// the third entry exceeds the budget: the pending batch is sent first
+	require.NoError(t, loki.ProcessRecord(entry))
+	require.Eventually(t, func() bool { return len(pushes()) == 1 }, timeout, 10*time.Millisecond)
+	assert.Equal(t, []int{2}, pushes())
+
+	// an entry larger than the budget is dropped
+	require.NoError(t, loki.ProcessRecord(config.GenericMap{"ts": 1, "foo": "bar", "value": strings.Repeat("x", maxBytes)}))
+	assert.Equal(t, 1.0, counterValue(t, loki.oversized))
+
+	loki.client.Stop()
+	assert.Equal(t, []int{2, 1}, pushes())
+}
+
+func TestLokiRetries(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	for _, tc := range []struct {
+		name            string
+		status          int
+		expectedPushes  int
+		expectedRetries float64
+		expectedReady   bool
+	}{
+		{name: "server error is retried", status: http.StatusInternalServerError, expectedPushes: 3, expectedRetries: 2},
+		{name: "too many requests is retried", status: http.StatusTooManyRequests, expectedPushes: 3, expectedRetries: 2},
+		{name: "bad request is not retried", status: http.StatusBadRequest, expectedPushes: 1, expectedRetries: 0, expectedReady: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, pushes := fakeLokiPushes(t, tc.status)
+			dlqPath := filepath.Join(t.TempDir(), "dlq.json")
+			var yamlConfig = fmt.Sprintf(`
+log-level: debug
+pipeline:
+  - name: write1
+parameters:
+  - name: write1
+    write:
+      type: loki
+      loki:
+        url: %s
+        batchWait: 1h
+        minBackoff: 1ms
+        maxBackoff: 2ms
+        maxRetries: 3
+        timestampLabel: ts
+        labels:
+          - foo
+        structuredMetadata:
+          - PodUID
+      deadLetterQueue:
+        type: file
+        file:
+          path: %s
+`, server.URL, dlqPath)
+			_, cfg := test.InitConfig(t, yamlConfig)
+			opMetrics := operational.NewMetrics(&config.MetricsSettings{})
+			loki, err := NewWriteLoki(opMetrics, cfg.Parameters[0])
+			require.NoError(t, err)
+			writer, err := WithDeadLetterQueue(opMetrics, "write1", loki, cfg.Parameters[0].Write.DeadLetterQueue)
+			require.NoError(t, err)
+
+			require.NoError(t, writer.Write(config.GenericMap{"ts": 1, "foo": "bar", "PodUID": "a1b2", "value": 1234}))
+			// stopping the client sends the pending batch
+			loki.client.Stop()
+			assert.Len(t, pushes(), tc.expectedPushes)
+			assert.Equal(t, tc.expectedRetries, counterValue(t, loki.client.(*lokiClient).retries))
+			assert.Equal(t, 1.0, counterValue(t, loki.client.(*lokiClient).dropped))
+			// a Loki failing with retried errors makes the writer unready, also through the dead-letter queue
+			readiness := writer.(operational.ReadinessContributor).Ready()
+			if tc.expectedReady {
+				assert.NoError(t, readiness)
+			} else {
+				assert.ErrorContains(t, readiness, strconv.Itoa(tc.status))
+			}
+
+			// the flow is rebuilt with its label and metadata fields for the dead-letter queue
+			require.Eventually(t, func() bool {
+				content, _ := os.ReadFile(dlqPath)
+				return len(content) > 0
+			}, timeout, 10*time.Millisecond)
+			content, err := os.ReadFile(dlqPath)
+			require.NoError(t, err)
+			flow := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal(content, &flow))
+			assert.Equal(t, "bar", flow["foo"])
+			assert.Equal(t, "a1b2", flow["PodUID"])
+			assert.Equal(t, float64(1234), flow["value"])
+			assert.Contains(t, flow[api.DLQReasonFieldName], strconv.Itoa(tc.status))
+		})
+	}
 }
 
 func TestHTTPInvocations(t *testing.T) {
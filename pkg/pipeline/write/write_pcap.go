@@ -0,0 +1,273 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	putils "github.com/netobserv/flowlogs-pipeline/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var pcaplog = logrus.WithField("component", "write.Pcap")
+
+const (
+	pcapSnapLen      = 65535
+	pcapFileHeader   = 24
+	pcapRecordHeader = 16
+	ipv4HeaderLen    = 20
+	ipv6HeaderLen    = 40
+	tcpHeaderLen     = 20
+	udpHeaderLen     = 8
+	pcapDefaultTTL   = 64
+	pcapTimeFormat   = "20060102T150405.000Z"
+)
+
+// pcapFile is a PCAP file being written; the packets are written unbuffered, so that the file can be read at any time
+type pcapFile struct {
+	file    *os.File
+	writer  *pcapgo.Writer
+	size    int64
+	created time.Time
+}
+
+// writePcap writes each flow as a synthetic packet, made of the IP and TCP or UDP headers rebuilt from the flow
+// fields, to rotating PCAP files: one for IPv4 flows and one for IPv6 flows, as a PCAP file has a single link type.
+type writePcap struct {
+	params api.WritePcap
+	files  map[layers.LinkType]*pcapFile
+	now    func() time.Time
+}
+
+// Write appends the packet of the flow to the file of its IP family
+func (w *writePcap) Write(entry config.GenericMap) error {
+	packet, linkType, err := flowPacket(entry)
+	if err != nil {
+		return err
+	}
+	ts := w.now()
+	if ms, ok := entry["TimeFlowStartMs"]; ok {
+		if v, err := putils.ConvertToInt64(ms); err == nil && v > 0 {
+			ts = time.UnixMilli(v)
+		}
+	}
+	// the IP length holds the flow bytes, which are not captured
+	length := int(binary.BigEndian.Uint16(packet[2:4]))
+	if linkType == layers.LinkTypeIPv6 {
+		length = ipv6HeaderLen + int(binary.BigEndian.Uint16(packet[4:6]))
+	}
+	f, err := w.file(linkType, int64(pcapRecordHeader+len(packet)))
+	if err != nil {
+		return err
+	}
+	ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(packet), Length: length}
+	if err := f.writer.WritePacket(ci, packet); err != nil {
+		return fmt.Errorf("can't write to %s: %w", f.file.Name(), err)
+	}
+	f.size += int64(pcapRecordHeader + len(packet))
+	return nil
+}
+
+// Close closes the current files
+func (w *writePcap) Close() error {
+	var errs []error
+	for linkType, f := range w.files {
+		errs = append(errs, f.file.Close())
+		delete(w.files, linkType)
+	}
+	return errors.Join(errs...)
+}
+
+// file returns the file of the link type, starting a new one when the record doesn't fit in the current one,
+// or when the current one is older than the rotation interval
+func (w *writePcap) file(linkType layers.LinkType, recordSize int64) (*pcapFile, error) {
+	f := w.files[linkType]
+	if f != nil {
+		full := f.size > pcapFileHeader && f.size+recordSize > w.params.MaxFileSize
+		expired := w.params.RotationInterval.Duration > 0 && w.now().Sub(f.created) >= w.params.RotationInterval.Duration
+		if !full && !expired {
+			return f, nil
+		}
+		if err := f.file.Close(); err != nil {
+			pcaplog.WithError(err).Warnf("can't close %s", f.file.Name())
+		}
+		delete(w.files, linkType)
+	}
+	f, err := w.createFile(linkType)
+	if err != nil {
+		return nil, err
+	}
+	w.files[linkType] = f
+	return f, nil
+}
+
+func (w *writePcap) createFile(linkType layers.LinkType) (*pcapFile, error) {
+	family := "ipv4"
+	if linkType == layers.LinkTypeIPv6 {
+		family = "ipv6"
+	}
+	created := w.now()
+	base := filepath.Join(w.params.Directory, w.params.FilePrefix+"-"+family+"-"+created.UTC().Format(pcapTimeFormat))
+	path := base + ".pcap"
+	// files created within the same millisecond get a suffix
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	for i := 1; errors.Is(err, os.ErrExist); i++ {
+		path = base + "-" + strconv.Itoa(i) + ".pcap"
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't create PCAP file: %w", err)
+	}
+	writer := pcapgo.NewWriter(file)
+	if err := writer.WriteFileHeader(pcapSnapLen, linkType); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("can't write to %s: %w", path, err)
+	}
+	pcaplog.Debugf("writing flows to %s", path)
+	return &pcapFile{file: file, writer: writer, size: pcapFileHeader, created: created}, nil
+}
+
+// flowPacket rebuilds the IP header of the flow, followed by its TCP or UDP header. The IP length is the number
+// of bytes of the flow, bounded by the maximum IP length, and the fields missing from the flow, such as the
+// checksums of the TCP and UDP headers, are zero-filled.
+func flowPacket(entry config.GenericMap) ([]byte, layers.LinkType, error) {
+	src, dst := flowIP(entry, "SrcAddr"), flowIP(entry, "DstAddr")
+	if src == nil || dst == nil {
+		return nil, 0, errors.New("missing or invalid SrcAddr or DstAddr")
+	}
+	proto, _ := flowUint(entry, "Proto", 0xff)
+	var l4 []byte
+	switch proto {
+	case uint64(layers.IPProtocolTCP):
+		l4 = make([]byte, tcpHeaderLen)
+		// data offset, in 32-bit words
+		l4[12] = tcpHeaderLen / 4 << 4
+		// the eBPF agent reports additional flags above the 8 TCP ones
+		flags, _ := flowUint(entry, "Flags", 0xffff)
+		l4[13] = byte(flags)
+	case uint64(layers.IPProtocolUDP):
+		l4 = make([]byte, udpHeaderLen)
+	}
+	if l4 != nil {
+		srcPort, _ := flowUint(entry, "SrcPort", 0xffff)
+		dstPort, _ := flowUint(entry, "DstPort", 0xffff)
+		binary.BigEndian.PutUint16(l4[0:2], uint16(srcPort))
+		binary.BigEndian.PutUint16(l4[2:4], uint16(dstPort))
+	}
+	bytes, _ := flowUint(entry, "Bytes", 0xffff)
+
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		packet := make([]byte, ipv4HeaderLen+len(l4))
+		length := max(bytes, uint64(len(packet)))
+		// version 4, header length in 32-bit words
+		packet[0] = 4<<4 | ipv4HeaderLen/4
+		binary.BigEndian.PutUint16(packet[2:4], uint16(length))
+		packet[8] = pcapDefaultTTL
+		packet[9] = byte(proto)
+		copy(packet[12:16], src4)
+		copy(packet[16:20], dst4)
+		binary.BigEndian.PutUint16(packet[10:12], ipv4Checksum(packet[:ipv4HeaderLen]))
+		copy(packet[ipv4HeaderLen:], l4)
+		if proto == uint64(layers.IPProtocolUDP) {
+			binary.BigEndian.PutUint16(packet[ipv4HeaderLen+4:], uint16(length-ipv4HeaderLen))
+		}
+		return packet, layers.LinkTypeIPv4, nil
+	}
+	if src.To4() != nil || dst.To4() != nil {
+		return nil, 0, fmt.Errorf("SrcAddr %s and DstAddr %s are not of the same IP family", src, dst)
+	}
+	packet := make([]byte, ipv6HeaderLen+len(l4))
+	payload := max(bytes, uint64(len(packet))) - ipv6HeaderLen
+	packet[0] = 6 << 4
+	binary.BigEndian.PutUint16(packet[4:6], uint16(payload))
+	packet[6] = byte(proto)
+	packet[7] = pcapDefaultTTL
+	copy(packet[8:24], src)
+	copy(packet[24:40], dst)
+	copy(packet[ipv6HeaderLen:], l4)
+	if proto == uint64(layers.IPProtocolUDP) {
+		binary.BigEndian.PutUint16(packet[ipv6HeaderLen+4:], uint16(payload))
+	}
+	return packet, layers.LinkTypeIPv6, nil
+}
+
+func flowIP(entry config.GenericMap, field string) net.IP {
+	v, ok := entry.LookupString(field)
+	if !ok {
+		return nil
+	}
+	return net.ParseIP(v)
+}
+
+// flowUint returns the value of the field, bounded by maxValue, or 0 when it's missing or invalid
+func flowUint(entry config.GenericMap, field string, maxValue uint64) (uint64, bool) {
+	v, ok := entry[field]
+	if !ok {
+		return 0, false
+	}
+	n, err := putils.ConvertToInt64(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return min(uint64(n), maxValue), true
+}
+
+// ipv4Checksum computes the checksum of an IPv4 header whose checksum field is zero
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// NewWritePcap creates a writer appending the flows as synthetic packets to PCAP files
+func NewWritePcap(params config.StageParam) (Writer, error) {
+	pcaplog.Debugf("entering NewWritePcap")
+	configIn := api.WritePcap{}
+	if params.Write != nil && params.Write.Pcap != nil {
+		configIn = *params.Write.Pcap
+	}
+	configIn.SetDefaults()
+	if err := configIn.Validate(); err != nil {
+		return nil, fmt.Errorf("the provided config is not valid: %w", err)
+	}
+	if err := os.MkdirAll(configIn.Directory, 0o755); err != nil {
+		return nil, fmt.Errorf("can't create directory %s: %w", configIn.Directory, err)
+	}
+	return &writePcap{
+		params: configIn,
+		files:  map[layers.LinkType]*pcapFile{},
+		now:    time.Now,
+	}, nil
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWritePcap(t *testing.T, params api.WritePcap, clock *time.Time) *writePcap {
+	params.Directory = filepath.Join(t.TempDir(), "pcap")
+	writer, err := NewWritePcap(config.StageParam{Write: &config.Write{Type: api.PcapType, Pcap: &params}})
+	require.NoError(t, err)
+	w := writer.(*writePcap)
+	w.now = func() time.Time { return *clock }
+	return w
+}
+
+// readPcapFiles returns the packets of the files of the directory, by file name
+func readPcapFiles(t *testing.T, dir string) map[string][]gopacket.Packet {
+	names, err := filepath.Glob(filepath.Join(dir, "*.pcap"))
+	require.NoError(t, err)
+	files := map[string][]gopacket.Packet{}
+	for _, name := range names {
+		f, err := os.Open(name)
+		require.NoError(t, err)
+		reader, err := pcapgo.NewReader(f)
+		require.NoError(t, err)
+		// gopacket has no decoder for the raw IP link types, so the IP layer is decoded directly
+		firstLayer := map[layers.LinkType]gopacket.LayerType{
+			layers.LinkTypeIPv4: layers.LayerTypeIPv4,
+			layers.LinkTypeIPv6: layers.LayerTypeIPv6,
+		}[reader.LinkType()]
+		require.NotZero(t, firstLayer, "unexpected link type %v", reader.LinkType())
+		var packets []gopacket.Packet
+		for {
+			data, ci, err := reader.ReadPacketData()
+			if err != nil {
+				break
+			}
+			packet := gopacket.NewPacket(data, firstLayer, gopacket.Default)
+			packet.Metadata().CaptureInfo = ci
+			packets = append(packets, packet)
+		}
+		require.NoError(t, f.Close())
+		files[filepath.Base(name)] = packets
+	}
+	return files
+}
+
+func fileNames(files map[string][]gopacket.Packet) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestWritePcap(t *testing.T) {
+	clock := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	w := newTestWritePcap(t, api.WritePcap{}, &clock)
+
+	require.NoError(t, w.Write(config.GenericMap{
+		"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "SrcPort": 34567, "DstPort": 443, "Proto": 6,
+		"Bytes": 1500, "Flags": 0x112, "TimeFlowStartMs": int64(1704200000000),
+	}))
+	require.NoError(t, w.Write(config.GenericMap{
+		"SrcAddr": "10.0.0.3", "DstAddr": "8.8.8.8", "SrcPort": 5353, "DstPort": 53, "Proto": 17, "Bytes": 80,
+	}))
+	require.NoError(t, w.Write(config.GenericMap{
+		"SrcAddr": "fd00::1", "DstAddr": "fd00::2", "SrcPort": 34567, "DstPort": 8080, "Proto": 6, "Bytes": 100000,
+	}))
+	// other protocols only get an IP header, and missing fields are zero-filled
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "Proto": 1}))
+
+	// flows that can't be written
+	require.Error(t, w.Write(config.GenericMap{"DstAddr": "10.0.0.2", "Proto": 6}))
+	require.Error(t, w.Write(config.GenericMap{"SrcAddr": "not-an-ip", "DstAddr": "10.0.0.2", "Proto": 6}))
+	require.Error(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.1", "DstAddr": "fd00::2", "Proto": 6}))
+
+	files := readPcapFiles(t, w.params.Directory)
+	require.Equal(t, []string{"flows-ipv4-20240102T150405.000Z.pcap", "flows-ipv6-20240102T150405.000Z.pcap"}, fileNames(files))
+
+	v4 := files["flows-ipv4-20240102T150405.000Z.pcap"]
+	require.Len(t, v4, 3)
+	for _, p := range v4 {
+		require.Nil(t, p.ErrorLayer(), "%v", p)
+	}
+	ip := v4[0].Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	assert.Equal(t, net.ParseIP("10.0.0.1").To4(), ip.SrcIP)
+	assert.Equal(t, net.ParseIP("10.0.0.2").To4(), ip.DstIP)
+	assert.Equal(t, uint16(1500), ip.Length)
+	assert.Equal(t, uint8(64), ip.TTL)
+	tcp := v4[0].Layer(layers.LayerTypeTCP).(*layers.TCP)
+	assert.Equal(t, layers.TCPPort(34567), tcp.SrcPort)
+	assert.Equal(t, layers.TCPPort(443), tcp.DstPort)
+	assert.True(t, tcp.SYN)
+	assert.True(t, tcp.ACK)
+	assert.False(t, tcp.FIN)
+	// the flow bytes are not captured
+	ci := v4[0].Metadata().CaptureInfo
+	assert.Equal(t, 40, ci.CaptureLength)
+	assert.Equal(t, 1500, ci.Length)
+	assert.Equal(t, time.UnixMilli(1704200000000).UTC(), ci.Timestamp.UTC())
+
+	udp := v4[1].Layer(layers.LayerTypeUDP).(*layers.UDP)
+	assert.Equal(t, layers.UDPPort(5353), udp.SrcPort)
+	assert.Equal(t, layers.UDPPort(53), udp.DstPort)
+	assert.Equal(t, uint16(60), udp.Length)
+	assert.Equal(t, clock, v4[1].Metadata().CaptureInfo.Timestamp.UTC())
+
+	ip = v4[2].Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	assert.Equal(t, layers.IPProtocolICMPv4, ip.Protocol)
+	assert.Equal(t, uint16(20), ip.Length)
+
+	v6 := files["flows-ipv6-20240102T150405.000Z.pcap"]
+	require.Len(t, v6, 1)
+	require.Nil(t, v6[0].ErrorLayer())
+	ip6 := v6[0].Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	assert.Equal(t, net.ParseIP("fd00::1"), ip6.SrcIP)
+	assert.Equal(t, net.ParseIP("fd00::2"), ip6.DstIP)
+	// larger flows are bounded by the maximum IP length
+	assert.Equal(t, uint16(65535-40), ip6.Length)
+	tcp = v6[0].Layer(layers.LayerTypeTCP).(*layers.TCP)
+	assert.Equal(t, layers.TCPPort(8080), tcp.DstPort)
+}
+
+func TestWritePcapRotation(t *testing.T) {
+	clock := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	// room for the file header and 2 TCP packets of 56 bytes
+	w := newTestWritePcap(t, api.WritePcap{MaxFileSize: 24 + 2*56, RotationInterval: api.Duration{Duration: time.Minute}}, &clock)
+	flow := config.GenericMap{"SrcAddr": "10.0.0.1", "DstAddr": "10.0.0.2", "SrcPort": 34567, "DstPort": 443, "Proto": 6, "Bytes": 60}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.Write(flow))
+	}
+	// rotated by size within the same millisecond
+	clock = clock.Add(30 * time.Second)
+	require.NoError(t, w.Write(flow))
+	// rotated by age
+	clock = clock.Add(time.Minute)
+	require.NoError(t, w.Write(flow))
+
+	files := readPcapFiles(t, w.params.Directory)
+	require.Equal(t, []string{
+		"flows-ipv4-20240102T150405.000Z-1.pcap",
+		"flows-ipv4-20240102T150405.000Z.pcap",
+		"flows-ipv4-20240102T150535.000Z.pcap",
+	}, fileNames(files))
+	assert.Len(t, files["flows-ipv4-20240102T150405.000Z.pcap"], 2)
+	assert.Len(t, files["flows-ipv4-20240102T150405.000Z-1.pcap"], 2)
+	assert.Len(t, files["flows-ipv4-20240102T150535.000Z.pcap"], 1)
+}
+
+func TestWritePcapConfig(t *testing.T) {
+	_, err := NewWritePcap(config.StageParam{Write: &config.Write{Type: api.PcapType, Pcap: &api.WritePcap{}}})
+	require.Error(t, err)
+	_, err = NewWritePcap(config.StageParam{Write: &config.Write{Type: api.PcapType, Pcap: &api.WritePcap{Directory: t.TempDir(), MaxFileSize: -1}}})
+	require.Error(t, err)
+}
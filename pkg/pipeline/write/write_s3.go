@@ -0,0 +1,318 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	s3Timeout    = 5 * time.Minute
+	s3MinBackoff = time.Second
+	s3MaxBackoff = time.Minute
+)
+
+var (
+	s3log = logrus.WithField("component", "write.S3")
+
+	s3UploadedObjects = operational.DefineMetric(
+		"s3_uploaded_objects_total",
+		"Number of objects uploaded to S3",
+		operational.TypeCounter,
+		"stage",
+	)
+	s3UploadedBytes = operational.DefineMetric(
+		"s3_uploaded_bytes_total",
+		"Number of compressed bytes uploaded to S3",
+		operational.TypeCounter,
+		"stage",
+	)
+	s3Dropped = operational.DefineMetric(
+		"s3_dropped_flows_total",
+		"Number of flows dropped because the S3 backlog is full or because S3 rejected them",
+		operational.TypeCounter,
+		"stage",
+	)
+)
+
+type s3Uploader interface {
+	upload(ctx context.Context, key string, data []byte) error
+}
+
+type minioUploader struct {
+	client   *minio.Client
+	bucket   string
+	partSize uint64
+}
+
+// s3Object is a complete object, waiting to be uploaded
+type s3Object struct {
+	key   string
+	data  []byte
+	flows int
+}
+
+// writeS3 compresses flows as JSON lines into objects, uploaded by a single goroutine.
+// While S3 is unavailable, up to maxBacklog objects wait to be retried; the flows of further objects are dropped.
+type writeS3 struct {
+	params          api.WriteS3
+	client          s3Uploader
+	instanceID      string
+	mutex           sync.Mutex
+	buffer          *bytes.Buffer
+	gz              *gzip.Writer
+	pending         int
+	sequence        int64
+	backlog         chan s3Object
+	exitChan        <-chan struct{}
+	closing         chan struct{}
+	stopped         chan struct{}
+	recordsWritten  prometheus.Counter
+	uploadedObjects prometheus.Counter
+	uploadedBytes   prometheus.Counter
+	dropped         prometheus.Counter
+}
+
+// Write appends a flow to the current object, and queues the object once it reaches its maximum size
+func (w *writeS3) Write(entry config.GenericMap) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		w.dropped.Inc()
+		return err
+	}
+	line = append(line, '\n')
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, err := w.gz.Write(line); err != nil {
+		w.dropped.Inc()
+		return err
+	}
+	w.pending++
+	// the compressor holds some data until it is flushed, so that the object may slightly exceed its maximum size
+	if int64(w.buffer.Len()) >= w.params.MaxObjectSize {
+		w.enqueue(time.Now())
+	}
+	return nil
+}
+
+// objectKey returns a unique key, sorted by creation time: prefix/YYYY/MM/DD/<time>-<instance id>-<sequence>.jsonl.gz
+func (w *writeS3) objectKey(now time.Time) string {
+	now = now.UTC()
+	w.sequence++
+	return fmt.Sprintf("%s/%s/%s-%s-%08d.jsonl.gz", w.params.Prefix, now.Format("2006/01/02"), now.Format("20060102T150405.000Z"), w.instanceID, w.sequence)
+}
+
+// The mutex must be held when calling enqueue
+func (w *writeS3) enqueue(now time.Time) {
+	if err := w.gz.Close(); err != nil {
+		s3log.WithError(err).Errorf("can't compress S3 object, dropping %d flows", w.pending)
+		w.dropped.Add(float64(w.pending))
+	} else {
+		object := s3Object{key: w.objectKey(now), data: w.buffer.Bytes(), flows: w.pending}
+		select {
+		case w.backlog <- object:
+		default:
+			s3log.Warnf("S3 backlog is full, dropping %d flows", w.pending)
+			w.dropped.Add(float64(w.pending))
+		}
+	}
+	// the object data is still referenced by the backlog: a new buffer is needed
+	w.buffer = &bytes.Buffer{}
+	w.gz.Reset(w.buffer)
+	w.pending = 0
+}
+
+// Close compresses the current object and uploads it along with the queued objects. The objects failing to upload
+// are not retried: their flows are counted as dropped.
+func (w *writeS3) Close() error {
+	w.mutex.Lock()
+	if w.pending > 0 {
+		w.enqueue(time.Now())
+	}
+	close(w.closing)
+	w.mutex.Unlock()
+	<-w.stopped
+	return nil
+}
+
+func (w *writeS3) flushLoop() {
+	ticker := time.NewTicker(w.params.FlushInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			return
+		case now := <-ticker.C:
+			w.mutex.Lock()
+			if w.pending > 0 {
+				w.enqueue(now)
+			}
+			w.mutex.Unlock()
+		}
+	}
+}
+
+func (w *writeS3) uploadLoop() {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			// the queued batches are sent once, without retrying
+			for {
+				select {
+				case object := <-w.backlog:
+					w.upload(object)
+				default:
+					return
+				}
+			}
+		case object := <-w.backlog:
+			w.upload(object)
+		}
+	}
+}
+
+// upload uploads the object, retrying with an exponential back-off until it succeeds or S3 rejects it
+func (w *writeS3) upload(object s3Object) {
+	backoff := s3MinBackoff
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+		err := w.client.upload(ctx, object.key, object.data)
+		cancel()
+		if err == nil {
+			w.uploadedObjects.Inc()
+			w.uploadedBytes.Add(float64(len(object.data)))
+			w.recordsWritten.Add(float64(object.flows))
+			return
+		}
+		if !s3Retryable(minio.ToErrorResponse(err).StatusCode) {
+			s3log.WithError(err).Errorf("S3 rejected object %s, dropping %d flows", object.key, object.flows)
+			w.dropped.Add(float64(object.flows))
+			return
+		}
+		s3log.WithError(err).Warnf("can't upload object %s to S3, retrying in %v", object.key, backoff)
+		select {
+		case <-w.exitChan:
+			return
+		case <-w.closing:
+			s3log.Warnf("S3 writer closed, dropping %d flows", object.flows)
+			w.dropped.Add(float64(object.flows))
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, s3MaxBackoff)
+	}
+}
+
+// s3Retryable tells whether an upload failing with this status code may succeed later.
+// Status 0 means that no response was received, e.g. on network errors.
+func s3Retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// upload puts the object, as a multipart upload when it is larger than the part size
+func (u *minioUploader) upload(ctx context.Context, key string, data []byte) error {
+	_, err := u.client.PutObject(ctx, u.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/gzip",
+		PartSize:    u.partSize,
+	})
+	return err
+}
+
+func newMinioUploader(params *api.WriteS3, transport http.RoundTripper) (*minioUploader, error) {
+	// the credentials are looked up as by the AWS SDKs: environment, shared credentials file, then IAM role
+	// (including the web identity of EKS service accounts)
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+	client, err := minio.New(params.Endpoint, &minio.Options{
+		Creds:     creds,
+		Secure:    !params.Insecure,
+		Region:    params.Region,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't create S3 client: %w", err)
+	}
+	return &minioUploader{client: client, bucket: params.Bucket, partSize: uint64(params.PartSize)}, nil
+}
+
+// NewWriteS3 creates a writer archiving the flows into an S3 bucket, as gzip-compressed JSON lines
+func NewWriteS3(opMetrics *operational.Metrics, params config.StageParam) (Writer, error) {
+	s3log.Debugf("entering NewWriteS3")
+	configIn := api.WriteS3{}
+	if params.Write != nil && params.Write.S3 != nil {
+		configIn = *params.Write.S3
+	}
+	configIn.SetDefaults()
+	if err := configIn.Validate(); err != nil {
+		return nil, fmt.Errorf("the provided config is not valid: %w", err)
+	}
+	// the client doesn't connect before the first upload, so that S3 doesn't need to be reachable when the pipeline starts
+	client, err := newMinioUploader(&configIn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newWriteS3(opMetrics, params.Name, &configIn, client), nil
+}
+
+func newWriteS3(opMetrics *operational.Metrics, stage string, params *api.WriteS3, client s3Uploader) *writeS3 {
+	buffer := &bytes.Buffer{}
+	w := &writeS3{
+		params:          *params,
+		client:          client,
+		instanceID:      uuid.NewString(),
+		buffer:          buffer,
+		gz:              gzip.NewWriter(buffer),
+		backlog:         make(chan s3Object, params.MaxBacklog),
+		exitChan:        utils.ExitChannel(),
+		closing:         make(chan struct{}),
+		stopped:         make(chan struct{}),
+		recordsWritten:  opMetrics.CreateRecordsWrittenCounter(stage),
+		uploadedObjects: opMetrics.NewCounter(&s3UploadedObjects, stage),
+		uploadedBytes:   opMetrics.NewCounter(&s3UploadedBytes, stage),
+		dropped:         opMetrics.NewCounter(&s3Dropped, stage),
+	}
+	go w.flushLoop()
+	go w.uploadLoop()
+	return w
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package write
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/operational"
+	"github.com/netobserv/flowlogs-pipeline/pkg/pipeline/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in-memory S3 server, supporting the single and multipart uploads
+type fakeS3 struct {
+	sync.Mutex
+	failures   int
+	rejected   bool
+	objects    map[string][]byte
+	multiparts map[string]map[int][]byte
+	partsCount int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, multiparts: map[string]map[int][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if f.rejected {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")
+		return
+	}
+	query := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.multiparts))
+		f.multiparts[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		var part int
+		_, _ = fmt.Sscan(query.Get("partNumber"), &part)
+		f.multiparts[query.Get("uploadId")][part] = body
+		f.partsCount++
+		w.Header().Set("ETag", fmt.Sprintf("%q", fmt.Sprintf("part-%d", part)))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts := f.multiparts[query.Get("uploadId")]
+		var numbers []int
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var data []byte
+		for _, n := range numbers {
+			data = append(data, parts[n]...)
+		}
+		f.objects[r.URL.Path] = data
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>archive</Bucket><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodPut:
+		f.objects[r.URL.Path] = body
+		w.Header().Set("ETag", `"done"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) keys() []string {
+	f.Lock()
+	defer f.Unlock()
+	var keys []string
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeS3) flows(t *testing.T, key string) []config.GenericMap {
+	f.Lock()
+	defer f.Unlock()
+	gz, err := gzip.NewReader(bytes.NewReader(f.objects[key]))
+	require.NoError(t, err)
+	var flows []config.GenericMap
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var flow config.GenericMap
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &flow))
+		flows = append(flows, flow)
+	}
+	require.NoError(t, scanner.Err())
+	return flows
+}
+
+func initS3Test(t *testing.T, params *api.WriteS3) (*writeS3, *fakeS3) {
+	fake := newFakeS3()
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	params.Endpoint = serverURL.Host
+	params.Region = "us-east-1"
+	params.Bucket = "archive"
+	params.SetDefaults()
+	require.NoError(t, params.Validate())
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "access")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	client, err := newMinioUploader(params, server.Client().Transport)
+	require.NoError(t, err)
+	w := newWriteS3(operational.NewMetrics(&config.MetricsSettings{}), "s3", params, client)
+	return w, fake
+}
+
+func TestS3Write_FlushInterval(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	w, fake := initS3Test(t, &api.WriteS3{FlushInterval: &api.Duration{Duration: 50 * time.Millisecond}})
+
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.1", "Bytes": 100}))
+	require.NoError(t, w.Write(config.GenericMap{"SrcAddr": "10.0.0.2", "Bytes": 200}))
+
+	require.Eventually(t, func() bool { return len(fake.keys()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	key := fake.keys()[0]
+	assert.Regexp(t, `^/archive/flows/\d{4}/\d{2}/\d{2}/\d{8}T\d{6}\.\d{3}Z-`+w.instanceID+`-00000001\.jsonl\.gz$`, key)
+	assert.Equal(t, []config.GenericMap{
+		{"SrcAddr": "10.0.0.1", "Bytes": float64(100)},
+		{"SrcAddr": "10.0.0.2", "Bytes": float64(200)},
+	}, fake.flows(t, key))
+	assert.Equal(t, float64(2), counterValue(t, w.recordsWritten))
+	assert.Equal(t, float64(1), counterValue(t, w.uploadedObjects))
+	assert.Equal(t, float64(len(fake.objects[key])), counterValue(t, w.uploadedBytes))
+	assert.Equal(t, float64(0), counterValue(t, w.dropped))
+}
+
+func TestS3Write_Multipart(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	w, fake := initS3Test(t, &api.WriteS3{
+		Prefix:        "archive/flows",
+		MaxObjectSize: 6 * 1024 * 1024,
+		PartSize:      5 * 1024 * 1024,
+		FlushInterval: &api.Duration{Duration: time.Hour},
+	})
+	// the fake server fails first, so that the upload is retried
+	fake.failures = 1
+
+	// hex-encoded random data only compresses by half: the object reaches its maximum size after about 12MB of flows
+	payload := make([]byte, 16*1024)
+	var written int
+	for queued := false; !queued; {
+		_, err := rand.Read(payload)
+		require.NoError(t, err)
+		require.NoError(t, w.Write(config.GenericMap{"Payload": hex.EncodeToString(payload)}))
+		written++
+		w.mutex.Lock()
+		queued = w.sequence == 1
+		w.mutex.Unlock()
+	}
+	require.Eventually(t, func() bool { return len(fake.keys()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	key := fake.keys()[0]
+	assert.True(t, strings.HasPrefix(key, "/archive/archive/flows/"), key)
+	assert.Len(t, fake.flows(t, key), written)
+	assert.Equal(t, 2, fake.partsCount)
+	assert.Equal(t, float64(written), counterValue(t, w.recordsWritten))
+	assert.Equal(t, float64(1), counterValue(t, w.uploadedObjects))
+}
+
+func TestS3Write_Rejected(t *testing.T) {
+	utils.InitExitChannel()
+	defer utils.CloseExitChannel()
+	w, fake := initS3Test(t, &api.WriteS3{FlushInterval: &api.Duration{Duration: 50 * time.Millisecond}})
+	fake.rejected = true
+
+	require.NoError(t, w.Write(config.GenericMap{"Bytes": 10}))
+	require.Eventually(t, func() bool { return counterValue(t, w.dropped) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Empty(t, fake.keys())
+	assert.Equal(t, float64(0), counterValue(t, w.uploadedObjects))
+}
+
+func TestS3Validate(t *testing.T) {
+	params := api.WriteS3{Bucket: "archive"}
+	params.SetDefaults()
+	require.NoError(t, params.Validate())
+	params.PartSize = 1024
+	require.Error(t, params.Validate(), "S3 parts are at least 5MB")
+	params = api.WriteS3{}
+	params.SetDefaults()
+	require.Error(t, params.Validate(), "the bucket is required")
+}
@@ -34,7 +34,7 @@ type writeStdout struct {
 }
 
 // Write writes a flow before being stored
-func (t *writeStdout) Write(v config.GenericMap) {
+func (t *writeStdout) Write(v config.GenericMap) error {
 	logrus.Tracef("entering writeStdout Write")
 	if t.format == "json" {
 		txt, _ := json.Marshal(v)
@@ -54,6 +54,7 @@ func (t *writeStdout) Write(v config.GenericMap) {
 	} else {
 		fmt.Printf("%s: %v\n", time.Now().Format(time.StampMilli), v)
 	}
+	return nil
 }
 
 // NewWriteStdout create a new write
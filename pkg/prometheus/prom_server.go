@@ -19,11 +19,15 @@ package prometheus
 
 import (
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
@@ -43,6 +47,7 @@ var (
 type PromServer struct {
 	httpServer      *http.Server
 	namedRegistries sync.Map
+	openMetrics     atomic.Bool
 }
 
 func (ps *PromServer) Gather() ([]*dto.MetricFamily, error) {
@@ -63,6 +68,24 @@ func (ps *PromServer) SetRegistry(name string, registry prom.Gatherer) {
 	ps.namedRegistries.Store(name, registry)
 }
 
+// EnableOpenMetrics lets scrapers negotiate the OpenMetrics format, which is the only text format carrying exemplars.
+// It isn't enabled by default, as OpenMetrics exposes the counters lacking the "_total" suffix with the unknown type.
+func (ps *PromServer) EnableOpenMetrics() {
+	ps.openMetrics.Store(true)
+}
+
+func (ps *PromServer) handler() http.Handler {
+	classic := promhttp.HandlerFor(ps, promhttp.HandlerOpts{})
+	openMetrics := promhttp.HandlerFor(ps, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ps.openMetrics.Load() {
+			openMetrics.ServeHTTP(w, r)
+		} else {
+			classic.ServeHTTP(w, r)
+		}
+	})
+}
+
 // InitializePrometheus starts the global Prometheus server, used for operational metrics and prom-encode stages if they don't override the server settings
 func InitializePrometheus(settings *config.MetricsSettings) *PromServer {
 	if settings.NoPanic {
@@ -87,7 +110,7 @@ func StartServerAsync(conn *api.PromConnectionInfo, regName string, registry pro
 	// if value of address is empty, then by default it will take 0.0.0.0
 	port := conn.Port
 	if port == 0 {
-		port = 9090
+		port = config.DefaultMetricsPort
 	}
 	addr := fmt.Sprintf("%s:%v", conn.Address, port)
 	plog.Infof("StartServerAsync: addr = %s", addr)
@@ -117,10 +140,75 @@ func StartServerAsync(conn *api.PromConnectionInfo, regName string, registry pro
 		}
 	}()
 
-	p := PromServer{httpServer: &httpServer}
+	p := &PromServer{httpServer: &httpServer}
 	p.namedRegistries.Store(regName, registry)
 
-	mux.Handle("/metrics", promhttp.HandlerFor(&p, promhttp.HandlerOpts{}))
+	if err := conn.Validate(); err != nil {
+		maybePanic("invalid metrics endpoint: %v", err)
+		return p
+	}
+	handler := p.handler()
+	if conn.Auth != nil {
+		var err error
+		if handler, err = authHandler(conn.Auth, handler); err != nil {
+			// without its credentials, the endpoint isn't served rather than served without authentication
+			maybePanic("can't set up the metrics endpoint authentication: %v", err)
+			return p
+		}
+	}
+	path := conn.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	mux.Handle(path, handler)
+
+	return p
+}
 
-	return &p
+// authHandler answers the requests lacking the expected bearer token or basic authentication credentials with
+// 401 Unauthorized. The secrets are read once, from their files.
+func authHandler(auth *api.PromAuth, next http.Handler) (http.Handler, error) {
+	if auth.BearerTokenPath != "" {
+		token, err := readSecret(auth.BearerTokenPath)
+		if err != nil {
+			return nil, err
+		}
+		expected := []byte("Bearer " + token)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}), nil
+	}
+	password, err := readSecret(auth.PasswordPath)
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		// both are compared, so that the response time doesn't tell which one is wrong
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(auth.Username))
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(password))
+		if !ok || userOK&passOK != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), nil
+}
+
+func readSecret(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(content))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
 }
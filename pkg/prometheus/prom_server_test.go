@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -70,6 +74,74 @@ func TestStartPromServer_HeadersLimit(t *testing.T) {
 	_ = srv.Shutdown(context.Background())
 }
 
+func TestStartPromServer_PathAndAuth(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("s3cr3t\n"), 0o600))
+	passwordPath := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(passwordPath, []byte("pa55"), 0o600))
+
+	bearer := StartServerAsync(&api.PromConnectionInfo{
+		Port: 9194, Path: "/flows", Auth: &api.PromAuth{BearerTokenPath: tokenPath},
+	}, "", prom.DefaultGatherer)
+	defer func() { _ = bearer.Shutdown(context.Background()) }()
+	basic := StartServerAsync(&api.PromConnectionInfo{
+		Port: 9195, Auth: &api.PromAuth{Username: "prom", PasswordPath: passwordPath},
+	}, "", prom.DefaultGatherer)
+	defer func() { _ = basic.Shutdown(context.Background()) }()
+
+	httpClient := &http.Client{}
+	checkHTTPReady(httpClient, "http://0.0.0.0:9194")
+	checkHTTPReady(httpClient, "http://0.0.0.0:9195")
+	scrape := func(url string, setAuth func(r *http.Request)) int {
+		r, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		if setAuth != nil {
+			setAuth(r)
+		}
+		resp, err := httpClient.Do(r)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		if resp.StatusCode == http.StatusOK {
+			require.Contains(t, string(body), "go_gc_duration_seconds")
+		}
+		return resp.StatusCode
+	}
+	withToken := func(token string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	withPassword := func(user, password string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, password) }
+	}
+
+	assert.Equal(t, http.StatusOK, scrape("http://0.0.0.0:9194/flows", withToken("s3cr3t")))
+	assert.Equal(t, http.StatusUnauthorized, scrape("http://0.0.0.0:9194/flows", nil))
+	assert.Equal(t, http.StatusUnauthorized, scrape("http://0.0.0.0:9194/flows", withToken("s3cr3")))
+	assert.Equal(t, http.StatusUnauthorized, scrape("http://0.0.0.0:9194/flows", withPassword("prom", "s3cr3t")))
+	assert.Equal(t, http.StatusNotFound, scrape("http://0.0.0.0:9194/metrics", withToken("s3cr3t")))
+
+	assert.Equal(t, http.StatusOK, scrape("http://0.0.0.0:9195/metrics", withPassword("prom", "pa55")))
+	assert.Equal(t, http.StatusUnauthorized, scrape("http://0.0.0.0:9195/metrics", nil))
+	assert.Equal(t, http.StatusUnauthorized, scrape("http://0.0.0.0:9195/metrics", withPassword("prom", "pass")))
+	assert.Equal(t, http.StatusUnauthorized, scrape("http://0.0.0.0:9195/metrics", withPassword("admin", "pa55")))
+	assert.Equal(t, http.StatusUnauthorized, scrape("http://0.0.0.0:9195/metrics", withToken("pa55")))
+}
+
+func TestPromConnectionInfo_Validate(t *testing.T) {
+	require.NoError(t, (&api.PromConnectionInfo{Path: "/flows", Auth: &api.PromAuth{BearerTokenPath: "/token"}}).Validate())
+	for _, conn := range []api.PromConnectionInfo{
+		{Path: "flows"},
+		{Auth: &api.PromAuth{}},
+		{Auth: &api.PromAuth{Username: "prom"}},
+		{Auth: &api.PromAuth{PasswordPath: "/password"}},
+		{Auth: &api.PromAuth{BearerTokenPath: "/token", Username: "prom", PasswordPath: "/password"}},
+	} {
+		require.Error(t, conn.Validate(), "%+v", conn)
+	}
+}
+
 func checkHTTPReady(httpClient *http.Client, url string) {
 	for i := 0; i < 60; i++ {
 		if r, err := httpClient.Get(url); err == nil {
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test/e2e"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/klient/wait"
+	"sigs.k8s.io/e2e-framework/klient/wait/conditions"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+)
+
+// clickHouseNodePort is the node port of the ClickHouse native protocol, see clickhouse.yaml
+const clickHouseNodePort = 30900
+
+func waitForDeployment(cfg *envconf.Config, namespace, name string) error {
+	client, err := cfg.NewClient()
+	if err != nil {
+		return fmt.Errorf("NewClient error: %w", err)
+	}
+	dep := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	// wait for the deployment to finish becoming available
+	err = wait.For(
+		conditions.New(client.Resources()).DeploymentConditionMatch(&dep, appsv1.DeploymentAvailable, corev1.ConditionTrue), wait.WithTimeout(time.Minute*3))
+	if err != nil {
+		return fmt.Errorf("wait.For error: %w", err)
+	}
+	return nil
+}
+
+func postClickHouseDeploy(_ context.Context, cfg *envconf.Config, namespace string) error {
+	fmt.Printf("====> Waiting for ClickHouse Deployment\n")
+	if err := waitForDeployment(cfg, namespace, "clickhouse"); err != nil {
+		return fmt.Errorf("postClickHouseDeploy: %w", err)
+	}
+	fmt.Printf("====> Done.\n")
+	return nil
+}
+
+func postFLPDeploy(_ context.Context, cfg *envconf.Config, namespace string) error {
+	fmt.Printf("====> Waiting for FLP Deployment\n")
+	if err := waitForDeployment(cfg, namespace, "flowlogs-pipeline"); err != nil {
+		return fmt.Errorf("postFLPDeploy: %w", err)
+	}
+	fmt.Printf("====> Done.\n")
+	return nil
+}
+
+func TestWriteClickHouse(t *testing.T) {
+	pipelineFeature := features.New("FLP/clickhouse").WithLabel("env", "dev").
+		Setup(func(ctx context.Context, _ *testing.T, _ *envconf.Config) context.Context {
+			return ctx
+		}).
+		Assess("flows written to ClickHouse", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			client, err := cfg.NewClient()
+			require.NoError(t, err)
+			coreV1Client, err := e2e.GetCoreV1Client(cfg.KubeconfigFile())
+			require.NoError(t, err)
+
+			command := "kubectl get nodes -o=jsonpath='{.items[0].status.addresses[?(@.type==\"InternalIP\")].address}'"
+			nodeAddr := strings.Trim(test.RunCommand(command), "'")
+			clickHouseAddr := fmt.Sprintf("%s:%d", nodeAddr, clickHouseNodePort)
+			fmt.Printf("ClickHouse = %s \n", clickHouseAddr)
+
+			conn, err := clickhouse.Open(&clickhouse.Options{Addr: []string{clickHouseAddr}})
+			require.NoError(t, err)
+			defer conn.Close()
+
+			// the synthetic flows are inserted by batches of 10, every second
+			var count uint64
+			if !assert.Eventually(t, func() bool {
+				return conn.QueryRow(ctx, "SELECT count() FROM default.flows").Scan(&count) == nil && count >= 30
+			}, 2*time.Minute, time.Second) {
+				var pods corev1.PodList
+				require.NoError(t, client.Resources(cfg.Namespace()).List(ctx, &pods, resources.WithLabelSelector("app=flowlogs-pipeline")))
+				fmt.Print(e2e.LogsFromPods(&pods, coreV1Client, cfg.Namespace()))
+				t.FailNow()
+			}
+
+			var dstAddr string
+			var flows, bytes uint64
+			require.NoError(t, conn.QueryRow(ctx,
+				"SELECT toString(DstAddr), count(), sum(Bytes) FROM default.flows GROUP BY DstAddr").Scan(&dstAddr, &flows, &bytes))
+			require.Equal(t, "::ffff:11.1.1.1", dstAddr)
+			require.Equal(t, 100*flows, bytes)
+
+			return ctx
+		}).Feature()
+
+	TestEnv.Test(t, pipelineFeature)
+}
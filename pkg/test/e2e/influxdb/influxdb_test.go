@@ -0,0 +1,137 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test"
+	"github.com/netobserv/flowlogs-pipeline/pkg/test/e2e"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/e2e-framework/klient/k8s/resources"
+	"sigs.k8s.io/e2e-framework/klient/wait"
+	"sigs.k8s.io/e2e-framework/klient/wait/conditions"
+	"sigs.k8s.io/e2e-framework/pkg/envconf"
+	"sigs.k8s.io/e2e-framework/pkg/features"
+)
+
+// see influxdb.yaml
+const (
+	influxDBNodePort = 30086
+	influxDBOrg      = "netobserv"
+	influxDBToken    = "flp-e2e-token"
+)
+
+func waitForDeployment(cfg *envconf.Config, namespace, name string) error {
+	client, err := cfg.NewClient()
+	if err != nil {
+		return fmt.Errorf("NewClient error: %w", err)
+	}
+	dep := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	// wait for the deployment to finish becoming available
+	err = wait.For(
+		conditions.New(client.Resources()).DeploymentConditionMatch(&dep, appsv1.DeploymentAvailable, corev1.ConditionTrue), wait.WithTimeout(time.Minute*3))
+	if err != nil {
+		return fmt.Errorf("wait.For error: %w", err)
+	}
+	return nil
+}
+
+func postInfluxDBDeploy(_ context.Context, cfg *envconf.Config, namespace string) error {
+	fmt.Printf("====> Waiting for InfluxDB Deployment\n")
+	if err := waitForDeployment(cfg, namespace, "influxdb"); err != nil {
+		return fmt.Errorf("postInfluxDBDeploy: %w", err)
+	}
+	fmt.Printf("====> Done.\n")
+	return nil
+}
+
+func postFLPDeploy(_ context.Context, cfg *envconf.Config, namespace string) error {
+	fmt.Printf("====> Waiting for FLP Deployment\n")
+	if err := waitForDeployment(cfg, namespace, "flowlogs-pipeline"); err != nil {
+		return fmt.Errorf("postFLPDeploy: %w", err)
+	}
+	fmt.Printf("====> Done.\n")
+	return nil
+}
+
+// queryInt returns the single value of a flux query ending with an aggregation
+func queryInt(ctx context.Context, client influxdb2.Client, query string) (int64, bool) {
+	result, err := client.QueryAPI(influxDBOrg).Query(ctx, query)
+	if err != nil || !result.Next() {
+		return 0, false
+	}
+	value, ok := result.Record().Value().(int64)
+	return value, ok
+}
+
+func TestWriteInfluxDB(t *testing.T) {
+	pipelineFeature := features.New("FLP/influxdb").WithLabel("env", "dev").
+		Setup(func(ctx context.Context, _ *testing.T, _ *envconf.Config) context.Context {
+			return ctx
+		}).
+		Assess("flows written to InfluxDB", func(ctx context.Context, t *testing.T, cfg *envconf.Config) context.Context {
+			client, err := cfg.NewClient()
+			require.NoError(t, err)
+			coreV1Client, err := e2e.GetCoreV1Client(cfg.KubeconfigFile())
+			require.NoError(t, err)
+
+			command := "kubectl get nodes -o=jsonpath='{.items[0].status.addresses[?(@.type==\"InternalIP\")].address}'"
+			nodeAddr := strings.Trim(test.RunCommand(command), "'")
+			influxDBURL := fmt.Sprintf("http://%s:%d", nodeAddr, influxDBNodePort)
+			fmt.Printf("InfluxDB = %s \n", influxDBURL)
+
+			influxClient := influxdb2.NewClient(influxDBURL, influxDBToken)
+			defer influxClient.Close()
+
+			// the synthetic flows are written by batches of 10, every second
+			bytesQuery := `from(bucket: "flows") |> range(start: -1h, stop: %s) |> filter(fn: (r) => r._measurement == "flows" and r._field == "Bytes") |> group() |> %s()`
+			if !assert.Eventually(t, func() bool {
+				flows, ok := queryInt(ctx, influxClient, fmt.Sprintf(bytesQuery, "now()", "count"))
+				return ok && flows >= 30
+			}, 2*time.Minute, time.Second) {
+				var pods corev1.PodList
+				require.NoError(t, client.Resources(cfg.Namespace()).List(ctx, &pods, resources.WithLabelSelector("app=flowlogs-pipeline")))
+				fmt.Print(e2e.LogsFromPods(&pods, coreV1Client, cfg.Namespace()))
+				t.FailNow()
+			}
+
+			// flows keep being written: count and sum them over the same, already flushed, time range
+			stop := time.Now().Add(-5 * time.Second).Format(time.RFC3339Nano)
+			flows, ok := queryInt(ctx, influxClient, fmt.Sprintf(bytesQuery, stop, "count"))
+			require.True(t, ok)
+			bytes, ok := queryInt(ctx, influxClient, fmt.Sprintf(bytesQuery, stop, "sum"))
+			require.True(t, ok)
+			require.Equal(t, 100*flows, bytes)
+
+			return ctx
+		}).Feature()
+
+	TestEnv.Test(t, pipelineFeature)
+}
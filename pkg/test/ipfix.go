@@ -23,6 +23,8 @@ var (
 // IPFIXClient for IPFIX tests
 type IPFIXClient struct {
 	conn net.Conn
+	// EnterpriseElements are added to the template and to the flows
+	EnterpriseElements []entities.InfoElementWithValue
 }
 
 // NewIPFIXClient returns an IPFIXClient that sends data to the given port
@@ -39,43 +41,72 @@ func NewIPFIXClient(port int) (*IPFIXClient, error) {
 
 // SendTemplate must be executed before sending any flow
 func (ke *IPFIXClient) SendTemplate() error {
+	msg, err := ke.TemplateMessage()
+	if err != nil {
+		return err
+	}
+	_, err = ke.conn.Write(msg)
+	return err
+}
+
+// SendFlow containing the information passed as an argument
+func (ke *IPFIXClient) SendFlow(timestamp uint32, srcIP string) error {
+	msg, err := ke.FlowMessage(timestamp, srcIP)
+	if err != nil {
+		return err
+	}
+	_, err = ke.conn.Write(msg)
+	return err
+}
+
+// TemplateMessage returns the IPFIX message sent by SendTemplate
+func (ke *IPFIXClient) TemplateMessage() ([]byte, error) {
 	// TODO: add more fields
 	templateElements := []entities.InfoElementWithValue{
 		entities.NewIPAddressInfoElement(sourceIPv4Address, nil),
 		entities.NewDateTimeSecondsInfoElement(flowStartSeconds, 0),
 		entities.NewDateTimeSecondsInfoElement(flowEndSeconds, 0),
 	}
+	for _, e := range ke.EnterpriseElements {
+		// template elements can't have values
+		element, err := entities.DecodeAndCreateInfoElementWithValue(e.GetInfoElement(), nil)
+		if err != nil {
+			return nil, err
+		}
+		templateElements = append(templateElements, element)
+	}
 	set := entities.NewSet(false)
 	if err := set.PrepareSet(entities.Template, templateID); err != nil {
-		return err
+		return nil, err
 	}
 	if err := set.AddRecord(templateElements, templateID); err != nil {
-		return nil
+		return nil, err
 	}
 	set.UpdateLenInHeader()
-	return ke.sendMessage(set)
+	return encodeMessage(set), nil
 }
 
-// SendFlow containing the information passed as an argument
-func (ke *IPFIXClient) SendFlow(timestamp uint32, srcIP string) error {
+// FlowMessage returns the IPFIX message sent by SendFlow
+func (ke *IPFIXClient) FlowMessage(timestamp uint32, srcIP string) ([]byte, error) {
 	// TODO: add more fields
 	templateElements := []entities.InfoElementWithValue{
 		entities.NewIPAddressInfoElement(sourceIPv4Address, net.ParseIP(srcIP)),
 		entities.NewDateTimeSecondsInfoElement(flowStartSeconds, timestamp),
 		entities.NewDateTimeSecondsInfoElement(flowEndSeconds, timestamp),
 	}
+	templateElements = append(templateElements, ke.EnterpriseElements...)
 	set := entities.NewSet(false)
 	if err := set.PrepareSet(entities.Data, templateID); err != nil {
-		return err
+		return nil, err
 	}
 	if err := set.AddRecord(templateElements, templateID); err != nil {
-		return nil
+		return nil, err
 	}
 	set.UpdateLenInHeader()
-	return ke.sendMessage(set)
+	return encodeMessage(set), nil
 }
 
-func (ke *IPFIXClient) sendMessage(set entities.Set) error {
+func encodeMessage(set entities.Set) []byte {
 	msg := entities.NewMessage(false)
 	msg.SetVersion(10)
 	msg.AddSet(set)
@@ -94,8 +125,7 @@ func (ke *IPFIXClient) sendMessage(set entities.Set) error {
 		copy(bytesSlice[index:index+l], record.GetBuffer())
 		index += l
 	}
-	_, err := ke.conn.Write(bytesSlice)
-	return err
+	return bytesSlice
 }
 
 // UDPPort asks the kernel for a free open port that is ready to use.
@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// sFlow v5 formats, see https://sflow.org/sflow_version_5.txt
+const (
+	sFlowFlowSampleFormat    = 1
+	sFlowCounterSampleFormat = 2
+	sFlowIPv4RecordFormat    = 3
+	sFlowIfCountersFormat    = 1
+)
+
+// SFlowClient for sFlow tests
+type SFlowClient struct {
+	conn     net.Conn
+	agentIP  net.IP
+	sequence uint32
+}
+
+// NewSFlowClient returns an SFlowClient that sends sFlow v5 datagrams to the given port
+func NewSFlowClient(port int, agentIP string) (*SFlowClient, error) {
+	conn, err := net.Dial("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("can't open UDP connection on port %d :%w",
+			port, err)
+	}
+	return &SFlowClient{
+		conn:    conn,
+		agentIP: net.ParseIP(agentIP).To4(),
+	}, nil
+}
+
+// SendFlow sends a datagram containing a single flow sample, made of a sampled IPv4 record
+func (c *SFlowClient) SendFlow(srcIP, dstIP string, srcPort, dstPort, proto, length, samplingRate uint32) error {
+	record := c.encode(
+		length, proto, net.ParseIP(srcIP).To4(), net.ParseIP(dstIP).To4(),
+		srcPort, dstPort, uint32(0) /* tcp flags */, uint32(0), /* tos */
+	)
+	sample := c.encode(
+		uint32(1) /* sequence */, uint32(1) /* source id */, samplingRate, uint32(0), /* pool */
+		uint32(0) /* drops */, uint32(1) /* input */, uint32(2) /* output */, uint32(1), /* records */
+		uint32(sFlowIPv4RecordFormat), uint32(len(record)), record,
+	)
+	return c.sendDatagram(sFlowFlowSampleFormat, sample)
+}
+
+// SendCounters sends a datagram containing a single counter sample, made of generic interface counters
+func (c *SFlowClient) SendCounters(ifIndex uint32, inOctets, outOctets uint64) error {
+	record := c.encode(
+		ifIndex, uint32(6) /* type */, uint64(10_000_000_000) /* speed */, uint32(1) /* direction */, uint32(3), /* status */
+		inOctets, uint32(100), uint32(0), uint32(0), uint32(1), uint32(2), uint32(0),
+		outOctets, uint32(200), uint32(0), uint32(0), uint32(3), uint32(4), uint32(0),
+	)
+	sample := c.encode(
+		uint32(1) /* sequence */, uint32(1) /* source id */, uint32(1), /* records */
+		uint32(sFlowIfCountersFormat), uint32(len(record)), record,
+	)
+	return c.sendDatagram(sFlowCounterSampleFormat, sample)
+}
+
+func (c *SFlowClient) sendDatagram(sampleFormat uint32, sample []byte) error {
+	c.sequence++
+	datagram := c.encode(
+		uint32(5) /* version */, uint32(1) /* IPv4 agent */, []byte(c.agentIP),
+		uint32(0) /* sub agent */, c.sequence, uint32(1000) /* uptime */, uint32(1), /* samples */
+		sampleFormat, uint32(len(sample)), sample,
+	)
+	_, err := c.conn.Write(datagram)
+	return err
+}
+
+func (c *SFlowClient) encode(fields ...interface{}) []byte {
+	buf := bytes.Buffer{}
+	for _, f := range fields {
+		// errors can't happen when writing fixed-size data into a bytes.Buffer
+		_ = binary.Write(&buf, binary.BigEndian, f)
+	}
+	return buf.Bytes()
+}
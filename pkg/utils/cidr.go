@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// CIDRTrie is a binary trie matching IP addresses against a set of IPv4 and IPv6 CIDRs.
+// IPv4 CIDRs are stored as IPv4-mapped IPv6 prefixes, so that both families share the same trie.
+type CIDRTrie struct {
+	root cidrNode
+}
+
+type cidrNode struct {
+	children [2]*cidrNode
+	terminal bool
+}
+
+func NewCIDRTrie(cidrs []string) (*CIDRTrie, error) {
+	trie := CIDRTrie{}
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse CIDR %q: %w", cidr, err)
+		}
+		bits := prefix.Bits()
+		if prefix.Addr().Is4() {
+			bits += 96
+		}
+		trie.insert(prefix.Addr().As16(), bits)
+	}
+	return &trie, nil
+}
+
+func (t *CIDRTrie) insert(addr [16]byte, bits int) {
+	node := &t.root
+	for i := 0; i < bits; i++ {
+		if node.terminal {
+			// a wider CIDR already covers this one
+			return
+		}
+		bit := addrBit(addr, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &cidrNode{}
+		}
+		node = node.children[bit]
+	}
+	node.terminal = true
+	node.children = [2]*cidrNode{}
+}
+
+// Contains returns whether the provided IP belongs to one of the CIDRs. Invalid IPs never match.
+func (t *CIDRTrie) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	bytes := addr.As16()
+	node := &t.root
+	for i := 0; i < 128 && node != nil; i++ {
+		if node.terminal {
+			return true
+		}
+		node = node.children[addrBit(bytes, i)]
+	}
+	return node != nil && node.terminal
+}
+
+func addrBit(addr [16]byte, i int) byte {
+	return (addr[i/8] >> (7 - uint(i%8))) & 1
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCIDRTrie(t *testing.T) {
+	trie, err := NewCIDRTrie([]string{"10.0.0.0/8", "192.168.1.0/24", "10.1.0.0/16", "2001:db8::/32", "1.2.3.4/32"})
+	require.NoError(t, err)
+
+	assert.True(t, trie.Contains("10.1.2.3"))
+	assert.True(t, trie.Contains("10.200.0.1"))
+	assert.True(t, trie.Contains("192.168.1.255"))
+	assert.False(t, trie.Contains("192.168.2.1"))
+	assert.True(t, trie.Contains("1.2.3.4"))
+	assert.False(t, trie.Contains("1.2.3.5"))
+	assert.True(t, trie.Contains("2001:db8:1::1"))
+	assert.False(t, trie.Contains("2001:db9::1"))
+	// IPv4-mapped IPv6
+	assert.True(t, trie.Contains("::ffff:10.0.0.1"))
+	// invalid IPs never match
+	assert.False(t, trie.Contains(""))
+	assert.False(t, trie.Contains("not-an-ip"))
+
+	_, err = NewCIDRTrie([]string{"10.0.0.0/33"})
+	require.Error(t, err)
+	_, err = NewCIDRTrie([]string{"10.0.0.0"})
+	require.Error(t, err)
+}
+
+func TestCIDRTrieMatchAll(t *testing.T) {
+	trie, err := NewCIDRTrie([]string{"0.0.0.0/0"})
+	require.NoError(t, err)
+	assert.True(t, trie.Contains("8.8.8.8"))
+	assert.False(t, trie.Contains("2001:db8::1"))
+
+	trie, err = NewCIDRTrie(nil)
+	require.NoError(t, err)
+	assert.False(t, trie.Contains("8.8.8.8"))
+}
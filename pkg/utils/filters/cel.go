@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2024 IBM, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/interpreter"
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
+	"github.com/netobserv/flowlogs-pipeline/pkg/config"
+	"github.com/netobserv/flowlogs-pipeline/pkg/utils"
+)
+
+// celFlowPrefix is the prefix of the flow fields in CEL expressions
+const celFlowPrefix = "flow."
+
+// celFlowSchema is the default schema of the fields that CEL expressions can reference
+var celFlowSchema = map[string]api.CELFieldTypeEnum{
+	"Bytes":                  api.CELInt,
+	"Packets":                api.CELInt,
+	"Proto":                  api.CELInt,
+	"SrcPort":                api.CELInt,
+	"DstPort":                api.CELInt,
+	"Etype":                  api.CELInt,
+	"Flags":                  api.CELInt,
+	"Dscp":                   api.CELInt,
+	"IcmpType":               api.CELInt,
+	"IcmpCode":               api.CELInt,
+	"FlowDirection":          api.CELInt,
+	"Sampling":               api.CELInt,
+	"TimeReceived":           api.CELInt,
+	"TimeFlowStartMs":        api.CELInt,
+	"TimeFlowEndMs":          api.CELInt,
+	"TimeFlowRttNs":          api.CELInt,
+	"DnsId":                  api.CELInt,
+	"DnsFlags":               api.CELInt,
+	"DnsErrno":               api.CELInt,
+	"DnsLatencyMs":           api.CELInt,
+	"PktDropBytes":           api.CELInt,
+	"PktDropPackets":         api.CELInt,
+	"PktDropLatestFlags":     api.CELInt,
+	"SrcAddr":                api.CELString,
+	"DstAddr":                api.CELString,
+	"SrcMac":                 api.CELString,
+	"DstMac":                 api.CELString,
+	"AgentIP":                api.CELString,
+	"Interface":              api.CELString,
+	"DnsFlagsResponseCode":   api.CELString,
+	"PktDropLatestState":     api.CELString,
+	"PktDropLatestDropCause": api.CELString,
+	"K8S_FlowLayer":          api.CELString,
+	"SrcK8S_Name":            api.CELString,
+	"SrcK8S_Namespace":       api.CELString,
+	"SrcK8S_OwnerName":       api.CELString,
+	"SrcK8S_OwnerType":       api.CELString,
+	"SrcK8S_Type":            api.CELString,
+	"SrcK8S_HostName":        api.CELString,
+	"SrcK8S_Zone":            api.CELString,
+	"DstK8S_Name":            api.CELString,
+	"DstK8S_Namespace":       api.CELString,
+	"DstK8S_OwnerName":       api.CELString,
+	"DstK8S_OwnerType":       api.CELString,
+	"DstK8S_Type":            api.CELString,
+	"DstK8S_HostName":        api.CELString,
+	"DstK8S_Zone":            api.CELString,
+	"Duplicate":              api.CELBool,
+}
+
+func celType(t api.CELFieldTypeEnum) (*cel.Type, error) {
+	switch t {
+	case api.CELInt:
+		return cel.IntType, nil
+	case api.CELDouble:
+		return cel.DoubleType, nil
+	case api.CELString:
+		return cel.StringType, nil
+	case api.CELBool:
+		return cel.BoolType, nil
+	}
+	return nil, fmt.Errorf("unknown CEL field type %q", t)
+}
+
+// flowActivation resolves the flow fields referenced by a CEL program, converted to their declared type
+type flowActivation struct {
+	flow   config.GenericMap
+	schema map[string]api.CELFieldTypeEnum
+}
+
+func (a *flowActivation) ResolveName(name string) (any, bool) {
+	field, ok := strings.CutPrefix(name, celFlowPrefix)
+	if !ok {
+		return nil, false
+	}
+	value, ok := a.flow[field]
+	if !ok {
+		return nil, false
+	}
+	var err error
+	switch a.schema[field] {
+	case api.CELInt:
+		value, err = utils.ConvertToInt64(value)
+	case api.CELDouble:
+		value, err = utils.ConvertToFloat64(value)
+	case api.CELString:
+		value = utils.ConvertToString(value)
+	case api.CELBool:
+		value, err = utils.ConvertToBool(value)
+	}
+	return value, err == nil
+}
+
+func (a *flowActivation) Parent() interpreter.Activation {
+	return nil
+}
+
+// FromCEL compiles the CEL expression of the rule, type-checked against the flow schema. References
+// to unknown fields are rejected here. At runtime, a flow lacking a referenced field doesn't match.
+func FromCEL(from *api.TransformFilterCELRule) (Predicate, error) {
+	if from == nil || from.Expression == "" {
+		return nil, errors.New("missing expression for cel filter rule")
+	}
+	schema := make(map[string]api.CELFieldTypeEnum, len(celFlowSchema)+len(from.Fields))
+	for field, t := range celFlowSchema {
+		schema[field] = t
+	}
+	for _, field := range from.Fields {
+		schema[field.Name] = field.Type
+	}
+	var opts []cel.EnvOption
+	for field, t := range schema {
+		ct, err := celType(t)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		opts = append(opts, cel.Variable(celFlowPrefix+field, ct))
+	}
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(from.Expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid cel expression: %w", issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("cel expression must be a boolean, got %v", ast.OutputType())
+	}
+	program, err := env.Program(ast, cel.EvalOptions(cel.OptOptimize))
+	if err != nil {
+		return nil, err
+	}
+	return func(flow config.GenericMap) bool {
+		out, _, err := program.Eval(&flowActivation{flow: flow, schema: schema})
+		if err != nil {
+			return false
+		}
+		keep, _ := out.Value().(bool)
+		return keep
+	}, nil
+}
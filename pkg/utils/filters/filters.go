@@ -2,6 +2,7 @@ package filters
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"strings"
 
@@ -87,6 +88,125 @@ func NotRegex(key string, filterRegex *regexp.Regexp) Predicate {
 	return func(flow config.GenericMap) bool { return !pred(flow) }
 }
 
+// Comparator compares a flow value with a filter value: negative when lower, zero when equal, positive when greater
+type Comparator func(cmp int) bool
+
+var (
+	GreaterThan    Comparator = func(cmp int) bool { return cmp > 0 }
+	GreaterOrEqual Comparator = func(cmp int) bool { return cmp >= 0 }
+	LessThan       Comparator = func(cmp int) bool { return cmp < 0 }
+	LessOrEqual    Comparator = func(cmp int) bool { return cmp <= 0 }
+)
+
+// Compare returns a predicate comparing the flow value with the filter value.
+// When the filter value is numeric (including numeric strings such as "6"), the flow value is converted to a number,
+// and flows with a non-numeric value are not matching. Otherwise, values are compared as strings.
+// Flows without the key are never matching.
+func Compare(key string, filterValue any, comparator Comparator) Predicate {
+	if num, ok := toNumber(filterValue); ok {
+		return func(flow config.GenericMap) bool {
+			if val, found := flow[key]; found {
+				if fVal, ok := toNumber(val); ok {
+					return comparator(cmpFloat(fVal, num))
+				}
+			}
+			return false
+		}
+	}
+	sFilter := utils.ConvertToString(filterValue)
+	return func(flow config.GenericMap) bool {
+		if val, found := flow[key]; found {
+			return comparator(strings.Compare(utils.ConvertToString(val), sFilter))
+		}
+		return false
+	}
+}
+
+// In returns a predicate checking that the flow value equals one of the filter values.
+// Numeric values are compared as numbers, so that "6" matches 6; other values are compared as strings.
+// Flows without the key are never matching.
+func In(key string, filterValues []any) Predicate {
+	numbers := map[float64]struct{}{}
+	strs := map[string]struct{}{}
+	for _, v := range filterValues {
+		if num, ok := toNumber(v); ok {
+			numbers[num] = struct{}{}
+		} else {
+			strs[utils.ConvertToString(v)] = struct{}{}
+		}
+	}
+	return func(flow config.GenericMap) bool {
+		val, found := flow[key]
+		if !found {
+			return false
+		}
+		if num, ok := toNumber(val); ok {
+			if _, ok := numbers[num]; ok {
+				return true
+			}
+		}
+		_, ok := strs[utils.ConvertToString(val)]
+		return ok
+	}
+}
+
+func NotIn(key string, filterValues []any) Predicate {
+	pred := In(key, filterValues)
+	return func(flow config.GenericMap) bool { return !pred(flow) }
+}
+
+func toNumber(value any) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+	if _, isBool := value.(bool); isBool {
+		return 0, false
+	}
+	f, err := utils.ConvertToFloat64(value)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// And returns a predicate satisfied when all of the predicates are satisfied; they are evaluated in order, until one isn't
+func And(preds ...Predicate) Predicate {
+	return func(flow config.GenericMap) bool {
+		for _, p := range preds {
+			if !p(flow) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a predicate satisfied when one of the predicates is satisfied; they are evaluated in order, until one is
+func Or(preds ...Predicate) Predicate {
+	return func(flow config.GenericMap) bool {
+		for _, p := range preds {
+			if p(flow) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func Not(pred Predicate) Predicate {
+	return func(flow config.GenericMap) bool { return !pred(flow) }
+}
+
 func extractVarLookups(value any) [][]string {
 	// Extract list of variables to lookup
 	// E.g: filter "$(SrcAddr):$(SrcPort)" would return [SrcAddr,SrcPort]
@@ -124,6 +244,26 @@ func FromKeepEntry(from *api.KeepEntryRule) (Predicate, error) {
 		return Equal(from.KeepEntry.Input, from.KeepEntry.Value, true), nil
 	case api.KeepEntryIfNotEqual:
 		return NotEqual(from.KeepEntry.Input, from.KeepEntry.Value, true), nil
+	case api.KeepEntryIfGreaterThan:
+		return Compare(from.KeepEntry.Input, from.KeepEntry.Value, GreaterThan), nil
+	case api.KeepEntryIfGreaterOrEq:
+		return Compare(from.KeepEntry.Input, from.KeepEntry.Value, GreaterOrEqual), nil
+	case api.KeepEntryIfLessThan:
+		return Compare(from.KeepEntry.Input, from.KeepEntry.Value, LessThan), nil
+	case api.KeepEntryIfLessOrEq:
+		return Compare(from.KeepEntry.Input, from.KeepEntry.Value, LessOrEqual), nil
+	case api.KeepEntryIfIn:
+		if values, err := valuesList(from.KeepEntry); err != nil {
+			return nil, err
+		} else {
+			return In(from.KeepEntry.Input, values), nil
+		}
+	case api.KeepEntryIfNotIn:
+		if values, err := valuesList(from.KeepEntry); err != nil {
+			return nil, err
+		} else {
+			return NotIn(from.KeepEntry.Input, values), nil
+		}
 	case api.KeepEntryIfRegexMatch:
 		if r, err := compileRegex(from.KeepEntry); err != nil {
 			return nil, err
@@ -151,3 +291,56 @@ func compileRegex(from *api.TransformFilterGenericRule) (*regexp.Regexp, error)
 	}
 	return r, nil
 }
+
+func valuesList(from *api.TransformFilterGenericRule) ([]any, error) {
+	values, ok := from.Value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid set membership keep rule: rule value must be a list [%v]", from)
+	}
+	return values, nil
+}
+
+// FromExpression builds the predicate of a boolean expression tree
+func FromExpression(from *api.FilterExpression) (Predicate, error) {
+	if from == nil {
+		return nil, fmt.Errorf("invalid filter expression: missing expression")
+	}
+	set := 0
+	for _, isSet := range []bool{len(from.And) > 0, len(from.Or) > 0, from.Not != nil, from.Condition != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("invalid filter expression: exactly one of and, or, not, condition must be set [%v]", from)
+	}
+	switch {
+	case from.Condition != nil:
+		if from.Condition.KeepEntry == nil {
+			return nil, fmt.Errorf("invalid filter expression: missing keepEntry in condition [%v]", from.Condition)
+		}
+		return FromKeepEntry(from.Condition)
+	case from.Not != nil:
+		pred, err := FromExpression(from.Not)
+		if err != nil {
+			return nil, err
+		}
+		return Not(pred), nil
+	}
+	subs := from.And
+	if len(from.Or) > 0 {
+		subs = from.Or
+	}
+	preds := make([]Predicate, 0, len(subs))
+	for _, sub := range subs {
+		pred, err := FromExpression(sub)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+	if len(from.Or) > 0 {
+		return Or(preds...), nil
+	}
+	return And(preds...), nil
+}
@@ -4,8 +4,10 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/netobserv/flowlogs-pipeline/pkg/api"
 	"github.com/netobserv/flowlogs-pipeline/pkg/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var flow = config.GenericMap{
@@ -128,3 +130,191 @@ func Test_Filters_extractVarLookups(t *testing.T) {
 	variables = extractVarLookups("")
 	assert.Empty(t, variables)
 }
+
+func TestFilterCompare(t *testing.T) {
+	pred := Compare("bytes", 10, GreaterThan)
+	assert.True(t, pred(flow))
+
+	pred = Compare("bytes", 15, GreaterThan)
+	assert.False(t, pred(flow))
+
+	pred = Compare("bytes", 15, GreaterOrEqual)
+	assert.True(t, pred(flow))
+
+	pred = Compare("bytes", 15.5, LessThan)
+	assert.True(t, pred(flow))
+
+	pred = Compare("bytes", 15, LessOrEqual)
+	assert.True(t, pred(flow))
+
+	// numeric strings are compared as numbers, on both sides
+	pred = Compare("bytes", "9", GreaterThan)
+	assert.True(t, pred(flow))
+
+	pred = Compare("bytes", 9, LessThan)
+	assert.False(t, pred(config.GenericMap{"bytes": "15"}))
+
+	// non-numeric value can't be compared to a number
+	pred = Compare("namespace", 9, LessThan)
+	assert.False(t, pred(flow))
+
+	// non-numeric filter values are compared as strings
+	pred = Compare("namespace", "bar", GreaterThan)
+	assert.True(t, pred(flow))
+
+	pred = Compare("namespace", "goo", GreaterOrEqual)
+	assert.False(t, pred(flow))
+
+	// missing key never matches
+	pred = Compare("bytesszzz", 10, GreaterThan)
+	assert.False(t, pred(flow))
+
+	pred = Compare("bytesszzz", 10, LessThan)
+	assert.False(t, pred(flow))
+}
+
+func TestFilterIn(t *testing.T) {
+	pred := In("bytes", []any{6, 15})
+	assert.True(t, pred(flow))
+
+	pred = In("bytes", []any{6, 17})
+	assert.False(t, pred(flow))
+
+	// mixed types
+	pred = In("bytes", []any{"6", "15"})
+	assert.True(t, pred(flow))
+
+	pred = In("bytes", []any{15.0})
+	assert.True(t, pred(config.GenericMap{"bytes": uint64(15)}))
+
+	pred = In("bytes", []any{6, 17})
+	assert.True(t, pred(config.GenericMap{"bytes": "17"}))
+
+	pred = In("namespace", []any{"foo", 6})
+	assert.True(t, pred(flow))
+
+	pred = In("namespace", []any{"goo", 6})
+	assert.False(t, pred(flow))
+
+	pred = In("namespacezzz", []any{"foo"})
+	assert.False(t, pred(flow))
+}
+
+func TestFilterNotIn(t *testing.T) {
+	pred := NotIn("bytes", []any{6, 15})
+	assert.False(t, pred(flow))
+
+	pred = NotIn("bytes", []any{"6", "17"})
+	assert.True(t, pred(flow))
+
+	pred = NotIn("namespace", []any{"foo"})
+	assert.False(t, pred(flow))
+
+	pred = NotIn("namespacezzz", []any{"foo"})
+	assert.True(t, pred(flow))
+}
+
+func TestFilterAndOrNot(t *testing.T) {
+	var evaluated []string
+	tracked := func(name string, result bool) Predicate {
+		return func(config.GenericMap) bool {
+			evaluated = append(evaluated, name)
+			return result
+		}
+	}
+
+	assert.True(t, And(tracked("a", true), tracked("b", true))(flow))
+	assert.Equal(t, []string{"a", "b"}, evaluated)
+
+	// short-circuits, in order
+	evaluated = nil
+	assert.False(t, And(tracked("a", false), tracked("b", true))(flow))
+	assert.Equal(t, []string{"a"}, evaluated)
+
+	evaluated = nil
+	assert.True(t, Or(tracked("a", false), tracked("b", true), tracked("c", true))(flow))
+	assert.Equal(t, []string{"a", "b"}, evaluated)
+
+	evaluated = nil
+	assert.False(t, Or(tracked("a", false), tracked("b", false))(flow))
+	assert.Equal(t, []string{"a", "b"}, evaluated)
+
+	assert.False(t, Not(Presence("namespace"))(flow))
+	assert.True(t, Not(Presence("namespacezzz"))(flow))
+}
+
+func TestFilterFromExpression(t *testing.T) {
+	cond := func(typ api.TransformFilterKeepEntryEnum, input string, value any) *api.FilterExpression {
+		return &api.FilterExpression{Condition: &api.KeepEntryRule{Type: typ, KeepEntry: &api.TransformFilterGenericRule{Input: input, Value: value}}}
+	}
+	// namespace == foo AND (bytes > 100 OR NOT name == bar)
+	pred, err := FromExpression(&api.FilterExpression{And: []*api.FilterExpression{
+		cond(api.KeepEntryIfEqual, "namespace", "foo"),
+		{Or: []*api.FilterExpression{
+			cond(api.KeepEntryIfGreaterThan, "bytes", 100),
+			{Not: cond(api.KeepEntryIfEqual, "name", "bar")},
+		}},
+	}})
+	require.NoError(t, err)
+	assert.False(t, pred(flow))
+	assert.True(t, pred(config.GenericMap{"namespace": "foo", "name": "bar", "bytes": 150}))
+	assert.True(t, pred(config.GenericMap{"namespace": "foo", "name": "baz", "bytes": 15}))
+	assert.False(t, pred(config.GenericMap{"namespace": "fooz", "name": "baz", "bytes": 150}))
+
+	for _, invalid := range []*api.FilterExpression{
+		nil,
+		{},
+		{And: []*api.FilterExpression{}},
+		{Not: cond(api.KeepEntryIfExists, "bytes", nil), Condition: cond(api.KeepEntryIfExists, "bytes", nil).Condition},
+		{Or: []*api.FilterExpression{{}}},
+		{Condition: &api.KeepEntryRule{Type: api.KeepEntryIfExists}},
+		cond("keep_entry_if_unknown", "bytes", nil),
+	} {
+		_, err = FromExpression(invalid)
+		assert.Error(t, err, "expression %v", invalid)
+	}
+}
+
+func TestFilterFromCEL(t *testing.T) {
+	pred, err := FromCEL(&api.TransformFilterCELRule{
+		Expression: `flow.Proto == 6 && flow.DstPort < 1024 && flow.DstK8S_Namespace.startsWith("prod")`,
+	})
+	require.NoError(t, err)
+	assert.True(t, pred(config.GenericMap{"Proto": 6, "DstPort": 443, "DstK8S_Namespace": "prod-1"}))
+	// numeric values are converted to the declared type
+	assert.True(t, pred(config.GenericMap{"Proto": 6.0, "DstPort": uint16(80), "DstK8S_Namespace": "prod"}))
+	assert.False(t, pred(config.GenericMap{"Proto": 17, "DstPort": 443, "DstK8S_Namespace": "prod"}))
+	assert.False(t, pred(config.GenericMap{"Proto": 6, "DstPort": 8080, "DstK8S_Namespace": "prod"}))
+	// missing field: no match
+	assert.False(t, pred(config.GenericMap{"Proto": 6, "DstPort": 443}))
+
+	pred, err = FromCEL(&api.TransformFilterCELRule{
+		Expression: `flow.namespace == "foo" && flow.bytes > 10.0`,
+		Fields:     []api.CELField{{Name: "namespace", Type: api.CELString}, {Name: "bytes", Type: api.CELDouble}},
+	})
+	require.NoError(t, err)
+	assert.True(t, pred(flow))
+
+	for _, invalid := range []*api.TransformFilterCELRule{
+		nil,
+		{},
+		{Expression: `flow.Foo == 1`},
+		{Expression: `flow.Proto == "tcp"`},
+		{Expression: `flow.Proto + 1`},
+		{Expression: `flow.Proto ==`},
+		{Expression: `flow.foo == 1`, Fields: []api.CELField{{Name: "foo", Type: "uint8"}}},
+	} {
+		_, err = FromCEL(invalid)
+		assert.Error(t, err, "rule %v", invalid)
+	}
+}
+
+func BenchmarkFilterFromCEL(b *testing.B) {
+	pred, err := FromCEL(&api.TransformFilterCELRule{Expression: `flow.Proto == 6 && flow.DstPort < 1024 && flow.Bytes > 1000`})
+	require.NoError(b, err)
+	flow := config.GenericMap{"Proto": 6, "DstPort": 443, "Bytes": 1500, "SrcK8S_Namespace": "foo"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pred(flow)
+	}
+}
@@ -14,6 +14,12 @@ const (
 )
 
 func LoadK8sConfig(kubeConfigPath string) (*rest.Config, error) {
+	return LoadK8sContextConfig(kubeConfigPath, "")
+}
+
+// LoadK8sContextConfig loads the kubeconfig like LoadK8sConfig, using the given context rather than the current one.
+// There is no fallback to the in-cluster config when a context is given.
+func LoadK8sContextConfig(kubeConfigPath, context string) (*rest.Config, error) {
 	// if no config path is provided, load it from the env variable
 	if kubeConfigPath == "" {
 		kubeConfigPath = os.Getenv(kubeConfigEnvVariable)
@@ -26,6 +32,16 @@ func LoadK8sConfig(kubeConfigPath string) (*rest.Config, error) {
 		}
 		kubeConfigPath = path.Join(homeDir, ".kube", "config")
 	}
+	if context != "" {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+			&clientcmd.ConfigOverrides{CurrentContext: context},
+		).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("can't load context %s from %s: %w", context, kubeConfigPath, err)
+		}
+		return config, nil
+	}
 	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
 	if err == nil {
 		return config, nil